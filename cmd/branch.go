@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -11,6 +12,8 @@ import (
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
 
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
@@ -120,6 +123,7 @@ func init() {
 	branchListCmd.Flags().Int("port", 5432, "Database port")
 	branchListCmd.Flags().String("user", "", "Database username")
 	branchListCmd.Flags().String("password", "", "Database password")
+	branchListCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
 
 	// Delete command flags
 	branchDeleteCmd.Flags().String("pattern", "", "Delete branches matching pattern")
@@ -130,6 +134,10 @@ func init() {
 	branchDeleteCmd.Flags().Int("port", 5432, "Database port")
 	branchDeleteCmd.Flags().String("user", "", "Database username")
 	branchDeleteCmd.Flags().String("password", "", "Database password")
+	branchDeleteCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
+	branchDeleteCmd.Flags().Bool("gradual-drop", false, "Empty large tables one at a time before dropping, so the drop does not stall the server")
+	branchDeleteCmd.Flags().Int("gradual-min-table-mb", 1024, "Tables of at least this many MB are emptied on their own with --gradual-drop")
+	branchDeleteCmd.Flags().Duration("gradual-pause", 5*time.Second, "Pause between emptied tables with --gradual-drop")
 }
 
 func runBranchCreate(cmd *cobra.Command, args []string) error {
@@ -230,14 +238,10 @@ func runBranchList(cmd *cobra.Command, args []string) error {
 	pattern, _ := cmd.Flags().GetString("pattern")
 	showSize, _ := cmd.Flags().GetBool("show-size")
 
-	// Get database connection parameters
-	host, _ := cmd.Flags().GetString("host")
-	port, _ := cmd.Flags().GetInt("port")
-	user, _ := cmd.Flags().GetString("user")
-	password, _ := cmd.Flags().GetString("password")
+	server := branchServer(cmd)
 
 	// Get list of databases that look like branches
-	databases, err := getDatabaseList(pattern, host, port, user, password, showSize)
+	databases, err := getDatabaseList(pattern, server, showSize)
 	if err != nil {
 		return fmt.Errorf("failed to list databases: %w", err)
 	}
@@ -256,9 +260,9 @@ func runBranchList(cmd *cobra.Command, args []string) error {
 
 		for _, branch := range databases {
 			fmt.Printf("%-20s %-15s %-20s",
-				truncateStringLocal(branch["name"].(string), 20),
-				truncateStringLocal(branch["source"].(string), 15),
-				truncateStringLocal(branch["created"].(string), 20))
+				output.Truncate(branch["name"].(string), 20),
+				output.Truncate(branch["source"].(string), 15),
+				output.Truncate(branch["created"].(string), 20))
 			if showSize {
 				fmt.Printf(" %-10s", branch["size"])
 			}
@@ -279,11 +283,18 @@ func runBranchDelete(cmd *cobra.Command, args []string) error {
 	force, _ := cmd.Flags().GetBool("force")
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 
-	// Get database connection parameters
-	host, _ := cmd.Flags().GetString("host")
-	port, _ := cmd.Flags().GetInt("port")
-	user, _ := cmd.Flags().GetString("user")
-	password, _ := cmd.Flags().GetString("password")
+	var gradual *db.GradualDropOptions
+	if enabled, _ := cmd.Flags().GetBool("gradual-drop"); enabled {
+		minTableMB, _ := cmd.Flags().GetInt("gradual-min-table-mb")
+		pause, _ := cmd.Flags().GetDuration("gradual-pause")
+		gradual = &db.GradualDropOptions{
+			MinTableSize: int64(minTableMB) << 20,
+			Pause:        pause,
+			Progress:     printDropProgress,
+		}
+	}
+
+	server := branchServer(cmd)
 
 	var branchName string
 	if len(args) > 0 {
@@ -297,14 +308,14 @@ func runBranchDelete(cmd *cobra.Command, args []string) error {
 	var databasesToDelete []map[string]interface{}
 	if branchName != "" {
 		// Get single database info
-		databases, err := getDatabaseList(branchName, host, port, user, password, true)
+		databases, err := getDatabaseList(branchName, server, true)
 		if err != nil {
 			return fmt.Errorf("failed to get database info: %w", err)
 		}
 		databasesToDelete = databases
 	} else {
 		// Get databases matching pattern
-		databases, err := getDatabaseList(pattern, host, port, user, password, true)
+		databases, err := getDatabaseList(pattern, server, true)
 		if err != nil {
 			return fmt.Errorf("failed to list databases: %w", err)
 		}
@@ -359,7 +370,7 @@ func runBranchDelete(cmd *cobra.Command, args []string) error {
 	for _, db := range databasesToDelete {
 		name := db["name"].(string)
 		fmt.Printf("🗑️  Deleting branch '%s'...\n", name)
-		err := deleteDatabaseBranch(name, host, port, user, password)
+		err := deleteDatabaseBranch(name, server, gradual)
 		if err != nil {
 			fmt.Printf("❌ Failed to delete '%s': %v\n", name, err)
 		} else {
@@ -370,10 +381,21 @@ func runBranchDelete(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// branchServer reads the server branches are listed and deleted on from the flags
+func branchServer(cmd *cobra.Command) config.DatabaseConfig {
+	server := config.DatabaseConfig{SSLMode: "prefer"}
+	server.Host, _ = cmd.Flags().GetString("host")
+	server.Port, _ = cmd.Flags().GetInt("port")
+	server.Username, _ = cmd.Flags().GetString("user")
+	server.Password, _ = cmd.Flags().GetString("password")
+	server.AdminDatabase, _ = cmd.Flags().GetString("admin-db")
+	return server
+}
+
 // getDatabaseList returns a list of databases with metadata, optionally filtered by pattern
-func getDatabaseList(pattern, host string, port int, user, password string, includeMetadata bool) ([]map[string]interface{}, error) {
+func getDatabaseList(pattern string, server config.DatabaseConfig, includeMetadata bool) ([]map[string]interface{}, error) {
 	// If no connection details provided, return mock data
-	if user == "" {
+	if server.Username == "" {
 		allDatabases := []string{"main", "staging", "pr-123", "pr-456", "feature-api", "dev"}
 
 		var filtered []string
@@ -397,17 +419,9 @@ func getDatabaseList(pattern, host string, port int, user, password string, incl
 		return result, nil
 	}
 
-	// Connect to database and get real data
-	dbConfig := &config.DatabaseConfig{
-		Host:     host,
-		Port:     port,
-		Username: user,
-		Password: password,
-		Database: "postgres", // Connect to postgres database for admin queries
-		SSLMode:  "prefer",
-	}
-
-	conn, err := db.NewConnection(dbConfig)
+	// Connect to the maintenance database for admin queries
+	dbConfig := server.Admin()
+	conn, err := db.NewConnection(&dbConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -417,17 +431,23 @@ func getDatabaseList(pattern, host string, port int, user, password string, incl
 		}
 	}()
 
+	// Managed services deny pg_stat_file, which dates the databases
+	profile, err := provider.Detect(context.Background(), conn, server.Host)
+	if err != nil {
+		log.Debugf("Assuming a self-hosted server: %v", err)
+	}
+
 	// Query databases with metadata
-	query := `
+	query := fmt.Sprintf(`
 		SELECT
 			d.datname,
 			pg_get_userbyid(d.datdba) as owner,
 			pg_database_size(d.datname) as size_bytes,
-			pg_stat_file('base/'||d.oid||'/PG_VERSION').modification as created_time
+			%s as created_time
 		FROM pg_database d
 		WHERE d.datistemplate = false
 		  AND d.datname NOT IN ('postgres', 'template0', 'template1')
-		ORDER BY d.datname`
+		ORDER BY d.datname`, profile.CreationTime("d.oid"))
 
 	rows, err := conn.DB.Query(query)
 	if err != nil {
@@ -443,7 +463,7 @@ func getDatabaseList(pattern, host string, port int, user, password string, incl
 	for rows.Next() {
 		var name, owner string
 		var sizeBytes int64
-		var createdTime time.Time
+		var createdTime sql.NullTime
 
 		if err := rows.Scan(&name, &owner, &sizeBytes, &createdTime); err != nil {
 			continue // Skip problematic rows
@@ -455,13 +475,16 @@ func getDatabaseList(pattern, host string, port int, user, password string, incl
 		}
 
 		dbInfo := map[string]interface{}{
-			"name":         name,
-			"source":       owner, // Using owner as a proxy for source
-			"created":      createdTime.Format("2006-01-02 15:04:05"),
-			"size":         formatBytesForBranch(sizeBytes),
-			"type":         "branch",
-			"created_time": createdTime,
-			"size_bytes":   sizeBytes,
+			"name":       name,
+			"source":     owner, // Using owner as a proxy for source
+			"created":    "unknown",
+			"size":       output.FormatBytes(sizeBytes),
+			"type":       "branch",
+			"size_bytes": sizeBytes,
+		}
+		if createdTime.Valid {
+			dbInfo["created"] = createdTime.Time.Format("2006-01-02 15:04:05")
+			dbInfo["created_time"] = createdTime.Time
 		}
 
 		allDatabases = append(allDatabases, dbInfo)
@@ -528,25 +551,18 @@ func filterDatabasesByAgeBranch(databases []map[string]interface{}, olderThanStr
 	return filtered, nil
 }
 
-// deleteDatabaseBranch deletes a database branch
-func deleteDatabaseBranch(dbName, host string, port int, user, password string) error {
-	if user == "" {
+// deleteDatabaseBranch deletes a database branch, emptying its large tables first
+// when gradual drop options are given
+func deleteDatabaseBranch(dbName string, server config.DatabaseConfig, gradual *db.GradualDropOptions) error {
+	if server.Username == "" {
 		// Mock deletion for demo purposes
 		time.Sleep(100 * time.Millisecond)
 		return nil
 	}
 
-	// Connect to database
-	dbConfig := &config.DatabaseConfig{
-		Host:     host,
-		Port:     port,
-		Username: user,
-		Password: password,
-		Database: "postgres", // Connect to postgres database for admin operations
-		SSLMode:  "prefer",
-	}
-
-	conn, err := db.NewConnection(dbConfig)
+	// Connect to the maintenance database for admin operations
+	dbConfig := server.Admin()
+	conn, err := db.NewConnection(&dbConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -556,6 +572,10 @@ func deleteDatabaseBranch(dbName, host string, port int, user, password string)
 		}
 	}()
 
+	if gradual != nil {
+		return conn.GradualDropDatabaseContext(context.Background(), dbName, *gradual)
+	}
+
 	// Terminate any active connections to the database
 	terminateQuery := `
 		SELECT pg_terminate_backend(pid)
@@ -577,25 +597,3 @@ func deleteDatabaseBranch(dbName, host string, port int, user, password string)
 
 	return nil
 }
-
-// formatBytesForBranch converts bytes to human readable format
-func formatBytesForBranch(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
-
-// truncateStringLocal truncates a string to maxLen characters
-func truncateStringLocal(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen-3] + "..."
-}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// SequenceCheckResult represents the result of a sequence check
+type SequenceCheckResult struct {
+	Format    string              `json:"format"`
+	Success   bool                `json:"success"`
+	Message   string              `json:"message,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Database  string              `json:"database,omitempty"`
+	Checked   int                 `json:"checked"`
+	AtRisk    int                 `json:"at_risk"`
+	Fixed     int                 `json:"fixed"`
+	Sequences []db.SequenceStatus `json:"sequences,omitempty"`
+	Duration  string              `json:"duration"`
+}
+
+// checkSequencesCmd represents the check-sequences command
+var checkSequencesCmd = &cobra.Command{
+	Use:   "check-sequences [database]",
+	Short: "Report sequences that would collide with existing data",
+	Long: `Compare every serial and identity sequence with the data in its column.
+
+After partial, data-only or filtered restores a sequence can lag behind the rows that
+were copied, so the next insert fails with a duplicate key error. This command lists
+the sequences whose next value is already in use and, with --fix, moves them past the
+existing data.
+
+The database defaults to the configured target database (PGFORK_TARGET_DATABASE).
+The command exits with code 1 while sequences remain at risk.
+
+Examples:
+  # Report sequences at risk in a forked database
+  postgres-db-fork check-sequences myapp_pr_123 --host localhost --user admin
+
+  # Bump every lagging sequence past its column's data
+  postgres-db-fork check-sequences myapp_pr_123 --fix
+
+  # JSON output for CI/CD scripts
+  postgres-db-fork check-sequences myapp_pr_123 --output-format json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCheckSequences,
+}
+
+func init() {
+	rootCmd.AddCommand(checkSequencesCmd)
+
+	// Database connection flags
+	checkSequencesCmd.Flags().String("host", "localhost", "Database server host")
+	checkSequencesCmd.Flags().Int("port", 5432, "Database server port")
+	checkSequencesCmd.Flags().String("user", "", "Database username (required)")
+	checkSequencesCmd.Flags().String("password", "", "Database password")
+	checkSequencesCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	checkSequencesCmd.Flags().String("sslmode", "prefer", "SSL mode")
+
+	// Check options
+	checkSequencesCmd.Flags().Bool("fix", false, "Move sequences at risk past the existing data")
+	checkSequencesCmd.Flags().Bool("all", false, "List every sequence, not only those at risk")
+
+	// Output options
+	checkSequencesCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+	checkSequencesCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("check_sequences")
+	config.RegisterOptions(
+		checkSequencesFixOpt, checkSequencesAllOpt, checkSequencesOutputOpt, checkSequencesQuietOpt,
+	)
+}
+
+// Check-sequences options, resolved through the shared options builder
+var (
+	checkSequencesFixOpt    = config.Option{Key: "check_sequences.fix", Env: []string{"PGFORK_CHECK_SEQUENCES_FIX"}, Flag: "fix"}
+	checkSequencesAllOpt    = config.Option{Key: "check_sequences.all", Flag: "all"}
+	checkSequencesOutputOpt = config.Option{Key: "check_sequences.output_format", Env: []string{"PGFORK_OUTPUT_FORMAT", "PGFORK_CHECK_SEQUENCES_OUTPUT_FORMAT"}, Flag: "output-format"}
+	checkSequencesQuietOpt  = config.Option{Key: "check_sequences.quiet", Env: []string{"PGFORK_QUIET", "PGFORK_CHECK_SEQUENCES_QUIET"}, Flag: "quiet"}
+)
+
+func runCheckSequences(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(checkSequencesOutputOpt, "text")
+	quiet, _ := builder.GetBool(checkSequencesQuietOpt, false)
+	fail := func(err error) error {
+		return outputSequenceCheckResult(&SequenceCheckResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet)
+	}
+
+	dbConfig, err := databaseConnection(builder, "check_sequences", args)
+	if err != nil {
+		return fail(err)
+	}
+	if dbConfig.Database == "" {
+		return fail(fmt.Errorf("database is required (pass it as an argument or set PGFORK_TARGET_DATABASE)"))
+	}
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_CHECK_SEQUENCES_USER)"))
+	}
+
+	fix, err := builder.GetBool(checkSequencesFixOpt, false)
+	if err != nil {
+		return fail(err)
+	}
+	showAll, _ := builder.GetBool(checkSequencesAllOpt, false)
+
+	conn, err := db.NewConnection(dbConfig)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	sequences, err := conn.CheckSequences()
+	if err != nil {
+		return fail(err)
+	}
+
+	result := &SequenceCheckResult{
+		Format:   outputFormat,
+		Success:  true,
+		Database: dbConfig.Database,
+		Checked:  len(sequences),
+	}
+	for i := range sequences {
+		if !sequences[i].AtRisk {
+			if showAll {
+				result.Sequences = append(result.Sequences, sequences[i])
+			}
+			continue
+		}
+		if fix {
+			if err := conn.FixSequence(&sequences[i]); err != nil {
+				return fail(err)
+			}
+			result.Fixed++
+		} else {
+			result.AtRisk++
+		}
+		result.Sequences = append(result.Sequences, sequences[i])
+	}
+
+	switch {
+	case result.AtRisk > 0:
+		result.Success = false
+		result.Error = fmt.Sprintf("%d of %d sequences would collide with existing data (use --fix to bump them)", result.AtRisk, result.Checked)
+	case result.Fixed > 0:
+		result.Message = fmt.Sprintf("Fixed %d of %d sequences", result.Fixed, result.Checked)
+	default:
+		result.Message = fmt.Sprintf("All %d sequences are ahead of their data", result.Checked)
+	}
+	result.Duration = time.Since(start).String()
+
+	return outputSequenceCheckResult(result, quiet)
+}
+
+// sequenceCheckView renders the sequence check result, with the quiet flag that text
+// output needs. Its JSON encoding is the SequenceCheckResult.
+type sequenceCheckView struct {
+	*SequenceCheckResult
+	quiet bool
+}
+
+// WriteText writes every sequence checked, or nothing in quiet mode unless the check failed
+func (v sequenceCheckView) WriteText(w io.Writer) error {
+	if v.quiet && v.Success {
+		return nil
+	}
+
+	if len(v.Sequences) > 0 {
+		fmt.Fprintf(w, "Sequences in %s:\n", v.Database)
+		for _, s := range v.Sequences {
+			status := "ok"
+			switch {
+			case s.Fixed:
+				status = "fixed"
+			case s.AtRisk:
+				status = "AT RISK"
+			}
+			fmt.Fprintf(w, "  - %s (%s.%s): next %d, data %d [%s]\n", s.Sequence, s.Table, s.Column, s.NextValue, s.DataValue, status)
+		}
+	}
+	if v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+		fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+	}
+	return nil
+}
+
+// outputSequenceCheckResult outputs the sequence check result in the specified format
+func outputSequenceCheckResult(result *SequenceCheckResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, sequenceCheckView{SequenceCheckResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
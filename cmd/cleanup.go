@@ -1,8 +1,9 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strings"
@@ -10,9 +11,9 @@ import (
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // CleanupResult represents the result of a cleanup operation
@@ -21,10 +22,12 @@ type CleanupResult struct {
 	Success          bool     `json:"success"`
 	Message          string   `json:"message,omitempty"`
 	Error            string   `json:"error,omitempty"`
+	DryRun           bool     `json:"dry_run,omitempty"`
 	DeletedCount     int      `json:"deleted_count"`
 	DeletedDatabases []string `json:"deleted_databases,omitempty"`
 	SkippedCount     int      `json:"skipped_count"`
 	SkippedDatabases []string `json:"skipped_databases,omitempty"`
+	FailedDatabases  []string `json:"failed_databases,omitempty"`
 	Duration         string   `json:"duration"`
 }
 
@@ -51,8 +54,15 @@ Examples:
   # Delete specific PR database
   postgres-db-fork cleanup --pattern "myapp_pr_123" --force
 
+  # Empty tables over 10 GB one at a time, a minute apart, before each drop
+  postgres-db-fork cleanup --pattern "analytics_pr_*" --force --gradual-drop \
+    --gradual-min-table-mb 10240 --gradual-pause 1m --timeout 12h
+
   # JSON output for CI/CD integration
-  postgres-db-fork cleanup --pattern "myapp_pr_*" --older-than 3d --output-format json`,
+  postgres-db-fork cleanup --pattern "myapp_pr_*" --older-than 3d --output-format json
+
+  # Retention report for capacity planning: nothing is deleted
+  postgres-db-fork cleanup --pattern "myapp_*" --older-than 14d --report --output-format csv`,
 	RunE: runCleanup,
 }
 
@@ -64,93 +74,152 @@ func init() {
 	cleanupCmd.Flags().Int("port", 5432, "Database server port")
 	cleanupCmd.Flags().String("user", "", "Database username (required)")
 	cleanupCmd.Flags().String("password", "", "Database password")
+	cleanupCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
 	cleanupCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	cleanupCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
 
 	// Cleanup criteria
 	cleanupCmd.Flags().String("pattern", "", "Database name pattern (supports wildcards like 'myapp_pr_*') (required)")
 	cleanupCmd.Flags().Duration("older-than", 0, "Delete databases older than this duration (e.g., 7d, 24h)")
 	cleanupCmd.Flags().StringSlice("exclude", []string{}, "Database names to exclude from deletion")
 	cleanupCmd.Flags().Bool("force", false, "Force deletion without age requirement")
+	cleanupCmd.Flags().Duration("timeout", 10*time.Minute, "Overall timeout for queries and drops")
+	cleanupCmd.Flags().Bool("report", false, "Report databases by age and owner and what the policy would reclaim, without deleting anything")
+
+	// Gradual drop of very large databases
+	cleanupCmd.Flags().Bool("gradual-drop", false, "Empty large tables one at a time before dropping each database, so the drop does not stall the server")
+	cleanupCmd.Flags().Int("gradual-min-table-mb", 1024, "Tables of at least this many MB are emptied on their own with --gradual-drop")
+	cleanupCmd.Flags().Duration("gradual-pause", 5*time.Second, "Pause between emptied tables with --gradual-drop")
 
 	// Output options
-	cleanupCmd.Flags().String("output-format", "text", "Output format: text or json")
+	cleanupCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain, or csv with --report")
+	addPorcelainFlag(cleanupCmd)
 	cleanupCmd.Flags().Bool("quiet", false, "Suppress output except errors")
 	cleanupCmd.Flags().Bool("dry-run", false, "Show what would be deleted without actually deleting")
 
-	// Mark required flags
-	if err := cleanupCmd.MarkFlagRequired("pattern"); err != nil {
-		panic(fmt.Sprintf("Failed to mark flag as required: %v", err))
+	// Keys this command reads from config files
+	config.RegisterConnection("cleanup")
+	config.RegisterOptions(
+		cleanupPatternOpt, cleanupOlderThanOpt, cleanupExcludeOpt, cleanupForceOpt, cleanupOutputOpt,
+		cleanupQuietOpt, cleanupDryRunOpt, cleanupTimeoutOpt, cleanupGradualOpt, cleanupMinTableOpt,
+		cleanupPauseOpt, cleanupReportOpt,
+	)
+}
+
+// Cleanup options, resolved through the shared options builder
+var (
+	cleanupPatternOpt   = config.Option{Key: "cleanup.pattern", Env: []string{"PGFORK_TARGET_DATABASE", "PGFORK_CLEANUP_PATTERN"}, Flag: "pattern"}
+	cleanupOlderThanOpt = config.Option{Key: "cleanup.older_than", Env: []string{"PGFORK_CLEANUP_OLDER_THAN"}, Flag: "older-than"}
+	cleanupExcludeOpt   = config.Option{Key: "cleanup.exclude", Env: []string{"PGFORK_CLEANUP_EXCLUDE"}, Flag: "exclude"}
+	cleanupForceOpt     = config.Option{Key: "cleanup.force", Env: []string{"PGFORK_CLEANUP_FORCE"}, Flag: "force"}
+	cleanupOutputOpt    = config.Option{Key: "cleanup.output_format", Env: []string{"PGFORK_OUTPUT_FORMAT", "PGFORK_CLEANUP_OUTPUT_FORMAT"}, Flag: "output-format"}
+	cleanupQuietOpt     = config.Option{Key: "cleanup.quiet", Env: []string{"PGFORK_QUIET", "PGFORK_CLEANUP_QUIET"}, Flag: "quiet"}
+	cleanupDryRunOpt    = config.Option{Key: "cleanup.dry_run", Env: []string{"PGFORK_DRY_RUN", "PGFORK_CLEANUP_DRY_RUN"}, Flag: "dry-run"}
+	cleanupTimeoutOpt   = config.Option{Key: "cleanup.timeout", Env: []string{"PGFORK_CLEANUP_TIMEOUT"}, Flag: "timeout"}
+	cleanupGradualOpt   = config.Option{Key: "cleanup.gradual_drop", Env: []string{"PGFORK_CLEANUP_GRADUAL_DROP"}, Flag: "gradual-drop"}
+	cleanupMinTableOpt  = config.Option{Key: "cleanup.gradual_min_table_mb", Env: []string{"PGFORK_CLEANUP_GRADUAL_MIN_TABLE_MB"}, Flag: "gradual-min-table-mb"}
+	cleanupPauseOpt     = config.Option{Key: "cleanup.gradual_pause", Env: []string{"PGFORK_CLEANUP_GRADUAL_PAUSE"}, Flag: "gradual-pause"}
+	cleanupReportOpt    = config.Option{Key: "cleanup.report", Env: []string{"PGFORK_CLEANUP_REPORT"}, Flag: "report"}
+)
+
+func runCleanup(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
 	}
-	if err := cleanupCmd.MarkFlagRequired("user"); err != nil {
-		panic(fmt.Sprintf("Failed to mark flag as required: %v", err))
+
+	outputFormat, _ := builder.GetString(cleanupOutputOpt, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(cleanupQuietOpt, false)
+	// Progress lines would break up JSON, YAML and porcelain output
+	showProgress := !quiet && !output.IsStructured(outputFormat) && outputFormat != output.Porcelain
+	fail := func(err error) error {
+		return outputCleanupResult(&CleanupResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet)
 	}
 
-	// Bind to viper
-	if err := viper.BindPFlag("cleanup.host", cleanupCmd.Flags().Lookup("host")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	// Build database configuration (connect to the admin database)
+	dbConfig, err := builder.BuildConnection(config.ServerConnection("cleanup"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.port", cleanupCmd.Flags().Lookup("port")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	*dbConfig = dbConfig.Admin()
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.user", cleanupCmd.Flags().Lookup("user")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+
+	// Get cleanup parameters
+	pattern, err := builder.GetString(cleanupPatternOpt, "")
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.password", cleanupCmd.Flags().Lookup("password")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	olderThan, err := builder.GetDuration(cleanupOlderThanOpt, 0)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.sslmode", cleanupCmd.Flags().Lookup("sslmode")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	exclude, err := builder.GetStringSlice(cleanupExcludeOpt, nil)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.pattern", cleanupCmd.Flags().Lookup("pattern")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	force, err := builder.GetBool(cleanupForceOpt, false)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.older_than", cleanupCmd.Flags().Lookup("older-than")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	dryRun, err := builder.GetBool(cleanupDryRunOpt, false)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.exclude", cleanupCmd.Flags().Lookup("exclude")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	timeout, err := builder.GetDuration(cleanupTimeoutOpt, 10*time.Minute)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.force", cleanupCmd.Flags().Lookup("force")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	gradual, err := builder.GetBool(cleanupGradualOpt, false)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.output_format", cleanupCmd.Flags().Lookup("output-format")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	minTableMB, err := builder.GetInt(cleanupMinTableOpt, 1024)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.quiet", cleanupCmd.Flags().Lookup("quiet")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	pause, err := builder.GetDuration(cleanupPauseOpt, 5*time.Second)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("cleanup.dry_run", cleanupCmd.Flags().Lookup("dry-run")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	report, err := builder.GetBool(cleanupReportOpt, false)
+	if err != nil {
+		return fail(err)
 	}
-}
-
-func runCleanup(cmd *cobra.Command, args []string) error {
-	start := time.Now()
 
-	// Load configuration from environment variables
-	loadCleanupFromEnvironment()
-
-	// Build database configuration
-	dbConfig := &config.DatabaseConfig{
-		Host:     viper.GetString("cleanup.host"),
-		Port:     viper.GetInt("cleanup.port"),
-		Username: viper.GetString("cleanup.user"),
-		Password: viper.GetString("cleanup.password"),
-		Database: "postgres", // Connect to postgres database for admin operations
-		SSLMode:  viper.GetString("cleanup.sslmode"),
+	if report {
+		switch {
+		case outputFormat == output.Porcelain:
+			return fail(fmt.Errorf("--report supports text, json, yaml and csv output"))
+		case pattern == "":
+			// A report covers every database unless narrowed down
+			pattern = "*"
+		}
+	} else if outputFormat == "csv" {
+		return fail(fmt.Errorf("csv output requires --report"))
 	}
 
-	// Get cleanup parameters
-	pattern := viper.GetString("cleanup.pattern")
-	olderThan := viper.GetDuration("cleanup.older_than")
-	exclude := viper.GetStringSlice("cleanup.exclude")
-	force := viper.GetBool("cleanup.force")
-	outputFormat := viper.GetString("cleanup.output_format")
-	quiet := viper.GetBool("cleanup.quiet")
-	dryRun := viper.GetBool("cleanup.dry_run")
+	if pattern == "" {
+		return fail(fmt.Errorf("database pattern is required (use --pattern or PGFORK_CLEANUP_PATTERN)"))
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_CLEANUP_USER)"))
+	}
 
 	// Validate parameters
-	if !force && olderThan == 0 {
+	if !report && !force && olderThan == 0 {
 		return outputCleanupResult(&CleanupResult{
 			Format:  outputFormat,
 			Success: false,
@@ -158,8 +227,11 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 		}, quiet)
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	// Connect to database
-	conn, err := db.NewConnection(dbConfig)
+	conn, err := db.NewConnectionContext(ctx, dbConfig)
 	if err != nil {
 		return outputCleanupResult(&CleanupResult{
 			Format:  outputFormat,
@@ -173,8 +245,12 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
+	if report {
+		return runCleanupReport(ctx, conn, pattern, exclude, retentionPolicy{force: force, olderThan: olderThan}, outputFormat, start)
+	}
+
 	// Find matching databases
-	databases, err := findMatchingDatabases(conn, pattern, exclude)
+	databases, err := findMatchingDatabases(ctx, conn, pattern, exclude)
 	if err != nil {
 		return outputCleanupResult(&CleanupResult{
 			Format:  outputFormat,
@@ -198,9 +274,9 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 
 	for _, dbName := range databases {
 		if !force && olderThan > 0 {
-			age, err := getDatabaseAge(conn, dbName)
+			age, err := getDatabaseAge(ctx, conn, dbName)
 			if err != nil {
-				if !quiet {
+				if showProgress {
 					fmt.Printf("Warning: Could not determine age of database %s: %v\n", dbName, err)
 				}
 				skipped = append(skipped, dbName)
@@ -227,6 +303,7 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 	}
 
 	if dryRun {
+		result.DryRun = true
 		result.Message = fmt.Sprintf("DRY RUN: Would delete %d databases", len(toDelete))
 		return outputCleanupResult(result, quiet)
 	}
@@ -234,16 +311,26 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 	// Delete databases
 	var deleted []string
 	var failed []string
+	var gradualOpts *db.GradualDropOptions
+	if gradual {
+		gradualOpts = &db.GradualDropOptions{
+			MinTableSize: int64(minTableMB) << 20,
+			Pause:        pause,
+		}
+		if showProgress {
+			gradualOpts.Progress = printDropProgress
+		}
+	}
 
 	for _, dbName := range toDelete {
-		if err := conn.DropDatabase(dbName); err != nil {
-			if !quiet {
+		if err := dropDatabase(ctx, conn, dbName, gradualOpts); err != nil {
+			if showProgress {
 				fmt.Printf("Failed to delete database %s: %v\n", dbName, err)
 			}
 			failed = append(failed, dbName)
 		} else {
 			deleted = append(deleted, dbName)
-			if !quiet && outputFormat != "json" {
+			if showProgress {
 				fmt.Printf("Deleted database: %s\n", dbName)
 			}
 		}
@@ -251,6 +338,7 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 
 	result.DeletedCount = len(deleted)
 	result.DeletedDatabases = deleted
+	result.FailedDatabases = failed
 
 	if len(failed) > 0 {
 		result.Success = false
@@ -262,88 +350,22 @@ func runCleanup(cmd *cobra.Command, args []string) error {
 	return outputCleanupResult(result, quiet)
 }
 
-// loadCleanupFromEnvironment loads cleanup configuration from environment variables
-func loadCleanupFromEnvironment() {
-	// Load general PGFORK_ environment variables first (as fallback)
-	if host := os.Getenv("PGFORK_DEST_HOST"); host != "" {
-		viper.Set("cleanup.host", host)
-	}
-	if port := os.Getenv("PGFORK_DEST_PORT"); port != "" {
-		viper.Set("cleanup.port", port)
-	}
-	if user := os.Getenv("PGFORK_DEST_USER"); user != "" {
-		viper.Set("cleanup.user", user)
-	}
-	if password := os.Getenv("PGFORK_DEST_PASSWORD"); password != "" {
-		viper.Set("cleanup.password", password)
-	}
-	if sslmode := os.Getenv("PGFORK_DEST_SSLMODE"); sslmode != "" {
-		viper.Set("cleanup.sslmode", sslmode)
-	}
-	if pattern := os.Getenv("PGFORK_TARGET_DATABASE"); pattern != "" {
-		viper.Set("cleanup.pattern", pattern)
-	}
-	if force := os.Getenv("PGFORK_CLEANUP_FORCE"); force != "" {
-		viper.Set("cleanup.force", force == "true")
-	}
-	if dryRun := os.Getenv("PGFORK_DRY_RUN"); dryRun != "" {
-		viper.Set("cleanup.dry_run", dryRun == "true")
-	}
-	if quiet := os.Getenv("PGFORK_QUIET"); quiet != "" {
-		viper.Set("cleanup.quiet", quiet == "true")
-	}
-	if outputFormat := os.Getenv("PGFORK_OUTPUT_FORMAT"); outputFormat != "" {
-		viper.Set("cleanup.output_format", outputFormat)
+// dropDatabase drops a database, emptying its large tables first when gradual
+// drop options are given
+func dropDatabase(ctx context.Context, conn *db.Connection, name string, gradual *db.GradualDropOptions) error {
+	if gradual != nil {
+		return conn.GradualDropDatabaseContext(ctx, name, *gradual)
 	}
+	return conn.DropDatabaseContext(ctx, name)
+}
 
-	// Load specific PGFORK_CLEANUP_ environment variables (these override general ones)
-	if host := os.Getenv("PGFORK_CLEANUP_HOST"); host != "" {
-		viper.Set("cleanup.host", host)
-	}
-	if port := os.Getenv("PGFORK_CLEANUP_PORT"); port != "" {
-		viper.Set("cleanup.port", port)
-	}
-	if user := os.Getenv("PGFORK_CLEANUP_USER"); user != "" {
-		viper.Set("cleanup.user", user)
-	}
-	if password := os.Getenv("PGFORK_CLEANUP_PASSWORD"); password != "" {
-		viper.Set("cleanup.password", password)
-	}
-	if sslmode := os.Getenv("PGFORK_CLEANUP_SSLMODE"); sslmode != "" {
-		viper.Set("cleanup.sslmode", sslmode)
-	}
-	if pattern := os.Getenv("PGFORK_CLEANUP_PATTERN"); pattern != "" {
-		viper.Set("cleanup.pattern", pattern)
-	}
-	if olderThan := os.Getenv("PGFORK_CLEANUP_OLDER_THAN"); olderThan != "" {
-		if duration, err := time.ParseDuration(olderThan); err == nil {
-			viper.Set("cleanup.older_than", duration)
-		}
-	}
-	if force := os.Getenv("PGFORK_CLEANUP_FORCE"); force != "" {
-		viper.Set("cleanup.force", force == "true")
-	}
-	if dryRun := os.Getenv("PGFORK_CLEANUP_DRY_RUN"); dryRun != "" {
-		viper.Set("cleanup.dry_run", dryRun == "true")
-	}
-	if exclude := os.Getenv("PGFORK_CLEANUP_EXCLUDE"); exclude != "" {
-		// Parse comma-separated list
-		excludeList := strings.Split(exclude, ",")
-		for i, item := range excludeList {
-			excludeList[i] = strings.TrimSpace(item)
-		}
-		viper.Set("cleanup.exclude", excludeList)
-	}
-	if quiet := os.Getenv("PGFORK_CLEANUP_QUIET"); quiet != "" {
-		viper.Set("cleanup.quiet", quiet == "true")
-	}
-	if outputFormat := os.Getenv("PGFORK_CLEANUP_OUTPUT_FORMAT"); outputFormat != "" {
-		viper.Set("cleanup.output_format", outputFormat)
-	}
+// printDropProgress reports a table emptied by a gradual drop
+func printDropProgress(p db.DropProgress) {
+	fmt.Printf("  %s: emptied %s (%s) [%d/%d]\n", p.Database, p.Table, output.FormatBytes(p.Size), p.Done, p.Total)
 }
 
 // findMatchingDatabases finds databases matching the given pattern
-func findMatchingDatabases(conn *db.Connection, pattern string, exclude []string) ([]string, error) {
+func findMatchingDatabases(ctx context.Context, conn *db.Connection, pattern string, exclude []string) ([]string, error) {
 	// Convert wildcard pattern to regex
 	regexPattern := strings.ReplaceAll(pattern, "*", ".*")
 	regexPattern = strings.ReplaceAll(regexPattern, "?", ".")
@@ -366,7 +388,7 @@ func findMatchingDatabases(conn *db.Connection, pattern string, exclude []string
 		  AND datname NOT IN ('postgres', 'template0', 'template1')
 		ORDER BY datname`
 
-	rows, err := conn.DB.Query(query)
+	rows, err := conn.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -393,14 +415,14 @@ func findMatchingDatabases(conn *db.Connection, pattern string, exclude []string
 }
 
 // getDatabaseAge returns the age of a database
-func getDatabaseAge(conn *db.Connection, dbName string) (time.Duration, error) {
+func getDatabaseAge(ctx context.Context, conn *db.Connection, dbName string) (time.Duration, error) {
 	query := `
 		SELECT EXTRACT(EPOCH FROM (NOW() - pg_stat_file('base/'||oid||'/PG_VERSION').modification))::int
 		FROM pg_database
 		WHERE datname = $1`
 
 	var ageSeconds int64
-	err := conn.DB.QueryRow(query, dbName).Scan(&ageSeconds)
+	err := conn.DB.QueryRowContext(ctx, query, dbName).Scan(&ageSeconds)
 	if err != nil {
 		// Fallback: try to get creation time from pg_stat_database
 		fallbackQuery := `
@@ -408,7 +430,7 @@ func getDatabaseAge(conn *db.Connection, dbName string) (time.Duration, error) {
 			FROM pg_stat_database
 			WHERE datname = $1 AND stats_reset IS NOT NULL`
 
-		err = conn.DB.QueryRow(fallbackQuery, dbName).Scan(&ageSeconds)
+		err = conn.DB.QueryRowContext(ctx, fallbackQuery, dbName).Scan(&ageSeconds)
 		if err != nil {
 			return 0, fmt.Errorf("could not determine database age: %w", err)
 		}
@@ -417,45 +439,80 @@ func getDatabaseAge(conn *db.Connection, dbName string) (time.Duration, error) {
 	return time.Duration(ageSeconds) * time.Second, nil
 }
 
-// outputCleanupResult outputs the cleanup result in the specified format
-func outputCleanupResult(result *CleanupResult, quiet bool) error {
-	if result.Format == "json" {
-		jsonOutput, err := json.MarshalIndent(result, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal JSON output: %w", err)
-		}
-		fmt.Println(string(jsonOutput))
-	} else {
-		// Text output
-		if !quiet {
-			if result.Success {
-				if result.Message != "" {
-					fmt.Printf("✅ %s\n", result.Message)
-				}
-				if result.DeletedCount > 0 {
-					fmt.Printf("Deleted databases (%d):\n", result.DeletedCount)
-					for _, db := range result.DeletedDatabases {
-						fmt.Printf("  - %s\n", db)
-					}
-				}
-				if result.SkippedCount > 0 {
-					fmt.Printf("Skipped databases (%d):\n", result.SkippedCount)
-					for _, db := range result.SkippedDatabases {
-						fmt.Printf("  - %s\n", db)
-					}
-				}
-				fmt.Printf("Duration: %s\n", result.Duration)
-			} else {
-				fmt.Printf("❌ %s\n", result.Error)
-			}
+// cleanupView renders the cleanup result, with the quiet flag that text output needs.
+// Its JSON encoding is the CleanupResult.
+type cleanupView struct {
+	*CleanupResult
+	quiet bool
+}
+
+// WriteText writes the databases deleted and skipped, or only how many were deleted in quiet mode
+func (v cleanupView) WriteText(w io.Writer) error {
+	if v.quiet {
+		// Only essential output
+		if v.Success {
+			fmt.Fprintf(w, "%d\n", v.DeletedCount)
 		} else {
-			// Quiet mode - only essential output
-			if result.Success {
-				fmt.Printf("%d\n", result.DeletedCount)
-			} else {
-				fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
-			}
+			fmt.Fprintf(os.Stderr, "Error: %s\n", v.Error)
 		}
+		return nil
+	}
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+
+	if v.Message != "" {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	}
+	if v.DeletedCount > 0 {
+		fmt.Fprintf(w, "Deleted databases (%d):\n", v.DeletedCount)
+		for _, db := range v.DeletedDatabases {
+			fmt.Fprintf(w, "  - %s\n", db)
+		}
+	}
+	if v.SkippedCount > 0 {
+		fmt.Fprintf(w, "Skipped databases (%d):\n", v.SkippedCount)
+		for _, db := range v.SkippedDatabases {
+			fmt.Fprintf(w, "  - %s\n", db)
+		}
+	}
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// WritePorcelain writes the cleanup result as porcelain records, one per
+// database:
+//
+//	deleted	<name>
+//	would-delete	<name>
+//	skipped	<name>
+//	failed	<name>
+func (v cleanupView) WritePorcelain(w io.Writer) {
+	deleted := "deleted"
+	if v.DryRun {
+		deleted = "would-delete"
+	}
+	for _, name := range v.DeletedDatabases {
+		output.WritePorcelain(w, deleted, name)
+	}
+	for _, name := range v.SkippedDatabases {
+		output.WritePorcelain(w, "skipped", name)
+	}
+	for _, name := range v.FailedDatabases {
+		output.WritePorcelain(w, "failed", name)
+	}
+}
+
+// Outcome reports whether every database was cleaned up
+func (v cleanupView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputCleanupResult outputs the cleanup result in the specified format
+func outputCleanupResult(result *CleanupResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, cleanupView{CleanupResult: result, quiet: quiet}); err != nil {
+		return err
 	}
 
 	// Set exit code
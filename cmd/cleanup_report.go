@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+)
+
+// RetentionReport summarises the databases a cleanup pattern matches and what the
+// current cleanup policy would reclaim, without deleting anything
+type RetentionReport struct {
+	Format       string              `json:"format"`
+	Success      bool                `json:"success"`
+	Error        string              `json:"error,omitempty"`
+	Pattern      string              `json:"pattern"`
+	Policy       string              `json:"policy"`
+	Count        int                 `json:"count"`
+	SizeBytes    int64               `json:"size_bytes"`
+	AgeBuckets   []RetentionGroup    `json:"age_buckets"`
+	Owners       []RetentionGroup    `json:"owners"`
+	ReclaimCount int                 `json:"reclaim_count"`
+	ReclaimBytes int64               `json:"reclaim_bytes"`
+	Databases    []RetentionDatabase `json:"databases,omitempty"`
+	GeneratedAt  time.Time           `json:"generated_at"`
+	Duration     string              `json:"duration"`
+}
+
+// RetentionGroup is the number and total size of the databases in one group
+type RetentionGroup struct {
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// RetentionDatabase is one database of a retention report
+type RetentionDatabase struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+	// AgeSeconds is -1 when the age could not be determined
+	AgeSeconds int64  `json:"age_seconds"`
+	Owner      string `json:"owner,omitempty"`
+	Source     string `json:"source,omitempty"`
+	// Reclaim is set when the current policy would delete the database
+	Reclaim bool `json:"reclaim"`
+}
+
+// retentionPolicy is the part of the cleanup options that decides what is deleted
+type retentionPolicy struct {
+	force     bool
+	olderThan time.Duration
+}
+
+// String describes the policy in words
+func (p retentionPolicy) String() string {
+	switch {
+	case p.force:
+		return "delete every match (--force)"
+	case p.olderThan > 0:
+		return "delete matches older than " + output.FormatAge(p.olderThan)
+	default:
+		return "none (set --older-than or --force to predict reclaim)"
+	}
+}
+
+// reclaims reports whether the policy deletes a database of the given age; a
+// database of unknown age is skipped unless the policy deletes every match
+func (p retentionPolicy) reclaims(age time.Duration, known bool) bool {
+	if p.force {
+		return true
+	}
+	return p.olderThan > 0 && known && age >= p.olderThan
+}
+
+// retentionAgeBuckets are the age groups of a retention report, youngest first; the
+// last one is open-ended
+var retentionAgeBuckets = []struct {
+	name  string
+	under time.Duration
+}{
+	{"< 1d", 24 * time.Hour},
+	{"1d - 7d", 7 * 24 * time.Hour},
+	{"7d - 30d", 30 * 24 * time.Hour},
+	{"30d - 90d", 90 * 24 * time.Hour},
+	{">= 90d", 0},
+}
+
+// runCleanupReport reports on the databases matching pattern instead of deleting them
+func runCleanupReport(ctx context.Context, conn *db.Connection, pattern string, exclude []string, policy retentionPolicy, outputFormat string, start time.Time) error {
+	report := &RetentionReport{Format: outputFormat, Success: true, Pattern: pattern}
+	fail := func(err error) error {
+		report.Success = false
+		report.Error = err.Error()
+		report.Duration = time.Since(start).String()
+		return outputRetentionReport(report)
+	}
+
+	databases, err := findDatabasesWithInfo(ctx, conn, pattern, exclude, true, true, true)
+	if err != nil {
+		return fail(fmt.Errorf("failed to find databases: %w", err))
+	}
+	if err := addLineage(ctx, conn, databases); err != nil {
+		return fail(err)
+	}
+
+	buildRetentionReport(report, databases, policy)
+	report.GeneratedAt = time.Now().UTC()
+	report.Duration = time.Since(start).String()
+	return outputRetentionReport(report)
+}
+
+// buildRetentionReport fills in the report from the matched databases
+func buildRetentionReport(report *RetentionReport, databases []DatabaseInfo, policy retentionPolicy) {
+	report.Policy = policy.String()
+	report.AgeBuckets = make([]RetentionGroup, len(retentionAgeBuckets), len(retentionAgeBuckets)+1)
+	for i, bucket := range retentionAgeBuckets {
+		report.AgeBuckets[i].Name = bucket.name
+	}
+	var unknown RetentionGroup
+	owners := make(map[string]*RetentionGroup)
+
+	for _, info := range databases {
+		// findDatabasesWithInfo leaves Age empty when the age could not be read
+		known := info.Age != ""
+		age := time.Duration(info.AgeSeconds) * time.Second
+		entry := RetentionDatabase{
+			Name:       info.Name,
+			SizeBytes:  info.SizeBytes,
+			AgeSeconds: -1,
+			Owner:      info.Owner,
+			Reclaim:    policy.reclaims(age, known),
+		}
+		if info.Lineage != nil {
+			entry.Source = info.Lineage.Source
+		}
+
+		group := &unknown
+		if known {
+			entry.AgeSeconds = info.AgeSeconds
+			for i, bucket := range retentionAgeBuckets {
+				if bucket.under == 0 || age < bucket.under {
+					group = &report.AgeBuckets[i]
+					break
+				}
+			}
+		}
+		group.Count++
+		group.SizeBytes += info.SizeBytes
+
+		owner := owners[info.Owner]
+		if owner == nil {
+			owner = &RetentionGroup{Name: info.Owner}
+			owners[info.Owner] = owner
+		}
+		owner.Count++
+		owner.SizeBytes += info.SizeBytes
+
+		report.Count++
+		report.SizeBytes += info.SizeBytes
+		if entry.Reclaim {
+			report.ReclaimCount++
+			report.ReclaimBytes += info.SizeBytes
+		}
+		report.Databases = append(report.Databases, entry)
+	}
+
+	if unknown.Count > 0 {
+		unknown.Name = "unknown"
+		report.AgeBuckets = append(report.AgeBuckets, unknown)
+	}
+	report.Owners = make([]RetentionGroup, 0, len(owners))
+	for _, owner := range owners {
+		report.Owners = append(report.Owners, *owner)
+	}
+	// Largest owners first
+	sort.Slice(report.Owners, func(i, j int) bool {
+		if report.Owners[i].SizeBytes != report.Owners[j].SizeBytes {
+			return report.Owners[i].SizeBytes > report.Owners[j].SizeBytes
+		}
+		return report.Owners[i].Name < report.Owners[j].Name
+	})
+}
+
+// outputRetentionReport outputs the retention report in the specified format
+func outputRetentionReport(report *RetentionReport) error {
+	switch report.Format {
+	case output.JSON, output.YAML:
+		if err := output.WriteStructured(os.Stdout, report.Format, report); err != nil {
+			return err
+		}
+	case "csv":
+		if report.Success {
+			if err := writeRetentionCSV(os.Stdout, report); err != nil {
+				return fmt.Errorf("failed to write CSV output: %w", err)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", report.Error)
+		}
+	default:
+		if report.Success {
+			writeRetentionText(os.Stdout, report)
+		} else {
+			fmt.Printf("❌ %s\n", report.Error)
+		}
+	}
+
+	// Set exit code
+	if !report.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// writeRetentionText writes the report for people
+func writeRetentionText(w io.Writer, report *RetentionReport) {
+	_, _ = fmt.Fprintf(w, "📊 Retention report for '%s'\n", report.Pattern)
+	_, _ = fmt.Fprintf(w, "Databases: %d, %s in total\n", report.Count, output.FormatBytes(report.SizeBytes))
+	_, _ = fmt.Fprintln(w, "By age:")
+	for _, group := range report.AgeBuckets {
+		_, _ = fmt.Fprintf(w, "  %-10s %5d  %10s\n", group.Name, group.Count, output.FormatBytes(group.SizeBytes))
+	}
+	_, _ = fmt.Fprintln(w, "By owner:")
+	for _, group := range report.Owners {
+		_, _ = fmt.Fprintf(w, "  %-20s %5d  %10s\n", group.Name, group.Count, output.FormatBytes(group.SizeBytes))
+	}
+	_, _ = fmt.Fprintf(w, "Policy: %s\n", report.Policy)
+	_, _ = fmt.Fprintf(w, "Predicted reclaim: %d databases, %s\n", report.ReclaimCount, output.FormatBytes(report.ReclaimBytes))
+}
+
+// writeRetentionCSV writes one row per database, for spreadsheets; the totals are
+// left to the spreadsheet
+func writeRetentionCSV(w io.Writer, report *RetentionReport) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"name", "size_bytes", "age_seconds", "owner", "source", "reclaim"}); err != nil {
+		return err
+	}
+	for _, entry := range report.Databases {
+		age := ""
+		if entry.AgeSeconds >= 0 {
+			age = strconv.FormatInt(entry.AgeSeconds, 10)
+		}
+		if err := out.Write([]string{
+			entry.Name,
+			strconv.FormatInt(entry.SizeBytes, 10),
+			age,
+			entry.Owner,
+			entry.Source,
+			strconv.FormatBool(entry.Reclaim),
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
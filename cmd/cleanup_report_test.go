@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRetentionReport(t *testing.T) {
+	day := int64(24 * 60 * 60)
+	databases := []DatabaseInfo{
+		{Name: "app_pr_1", SizeBytes: 100, AgeSeconds: 2 * day, Age: "2d 0h", Owner: "ci", Lineage: &db.Lineage{Source: "app"}},
+		{Name: "app_pr_2", SizeBytes: 300, AgeSeconds: 40 * day, Age: "40d 0h", Owner: "ci"},
+		{Name: "app_pr_3", SizeBytes: 50, AgeSeconds: 3600, Age: "1h 0m", Owner: "alice"},
+		{Name: "app_pr_4", SizeBytes: 1000, Owner: "alice"},
+	}
+
+	report := &RetentionReport{}
+	buildRetentionReport(report, databases, retentionPolicy{olderThan: 7 * 24 * time.Hour})
+
+	assert.Equal(t, 4, report.Count)
+	assert.Equal(t, int64(1450), report.SizeBytes)
+	assert.Equal(t, []RetentionGroup{
+		{Name: "< 1d", Count: 1, SizeBytes: 50},
+		{Name: "1d - 7d", Count: 1, SizeBytes: 100},
+		{Name: "7d - 30d"},
+		{Name: "30d - 90d", Count: 1, SizeBytes: 300},
+		{Name: ">= 90d"},
+		{Name: "unknown", Count: 1, SizeBytes: 1000},
+	}, report.AgeBuckets)
+	assert.Equal(t, []RetentionGroup{
+		{Name: "alice", Count: 2, SizeBytes: 1050},
+		{Name: "ci", Count: 2, SizeBytes: 400},
+	}, report.Owners)
+	assert.Equal(t, 1, report.ReclaimCount)
+	assert.Equal(t, int64(300), report.ReclaimBytes)
+	assert.Equal(t, "delete matches older than 7d 0h", report.Policy)
+	require.Len(t, report.Databases, 4)
+	assert.Equal(t, "app", report.Databases[0].Source)
+	assert.Equal(t, int64(-1), report.Databases[3].AgeSeconds)
+
+	report = &RetentionReport{}
+	buildRetentionReport(report, databases, retentionPolicy{force: true})
+	assert.Equal(t, 4, report.ReclaimCount)
+
+	report = &RetentionReport{}
+	buildRetentionReport(report, databases, retentionPolicy{})
+	assert.Zero(t, report.ReclaimCount)
+}
+
+func TestWriteRetentionCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeRetentionCSV(&buf, &RetentionReport{
+		Databases: []RetentionDatabase{
+			{Name: "app_pr_1", SizeBytes: 100, AgeSeconds: 86400, Owner: "ci", Source: "app", Reclaim: true},
+			{Name: "app,pr", SizeBytes: 5, AgeSeconds: -1},
+		},
+	}))
+	assert.Equal(t, "name,size_bytes,age_seconds,owner,source,reclaim\n"+
+		"app_pr_1,100,86400,ci,app,true\n"+
+		"\"app,pr\",5,,,,false\n", buf.String())
+}
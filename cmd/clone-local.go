@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/container"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// cloneLocalCmd represents the clone-local command
+var cloneLocalCmd = &cobra.Command{
+	Use:   "clone-local",
+	Short: "Clone a database into a local Docker PostgreSQL for development",
+	Long: `Clone a remote database into a PostgreSQL container on this machine.
+
+clone-local combines the steps app developers usually script by hand:
+- Resolves the source from flags, PGFORK_SOURCE_* variables, the config file or --profile
+- Starts (or reuses) a PostgreSQL container per branch with a persistent data volume,
+  on a free host port that is remembered for the next run
+- Forks the source into it with laptop-friendly defaults (2 parallel connections)
+- Applies a masking profile from the config file, if one is selected
+- Shows progress while transferring
+
+Re-running the command is cheap: the branch's container and port are reused, a clone
+that completed is left alone unless --refresh is given, and a clone that was interrupted
+is dropped and started again from scratch; clones are not resumed table by table.
+--recreate throws the container away and starts fresh.
+
+Masking profiles are lists of rules in the config file:
+
+  masking_profiles:
+    dev:
+      - {table: users, column: email, strategy: email}
+      - {table: users, column: phone, strategy: "null"}
+      - {table: payments, column: card_number, strategy: redact}
+
+Strategies: null, hash, email, value (with a fixed "value"), redact.
+
+Examples:
+  # Clone staging into a local container using a saved profile
+  postgres-db-fork clone-local --profile staging --source-db myapp
+
+  # Clone with masking into the container for a feature branch
+  postgres-db-fork clone-local --source-uri "postgresql://reader@staging/myapp" \
+    --branch feature-login --masking-profile dev
+
+  # Throw away the local copy and clone again
+  postgres-db-fork clone-local --source-db myapp --refresh`,
+	RunE: runCloneLocal,
+}
+
+func init() {
+	rootCmd.AddCommand(cloneLocalCmd)
+
+	// Source database flags
+	cloneLocalCmd.Flags().String("source-uri", "", "Source database URI, replaces the individual source flags")
+	cloneLocalCmd.Flags().String("source", "", "Source database URI or heroku:<app>::<config var> reference (alias for --source-uri)")
+	cloneLocalCmd.Flags().String("source-host", "localhost", "Source database host, or comma-separated hosts tried in order (host:port, [IPv6 address]:port)")
+	cloneLocalCmd.Flags().Int("source-port", 5432, "Source database port")
+	cloneLocalCmd.Flags().String("source-user", "", "Source database username")
+	cloneLocalCmd.Flags().String("source-password", "", "Source database password")
+	cloneLocalCmd.Flags().Bool("source-password-stdin", false, "Read the source database password from standard input")
+	cloneLocalCmd.Flags().String("source-db", "", "Source database name (required)")
+	cloneLocalCmd.Flags().String("source-sslmode", "prefer", "Source database SSL mode")
+
+	// Local target
+	cloneLocalCmd.Flags().String("target-db", "", "Local database name (defaults to the source database name, supports templates)")
+	cloneLocalCmd.Flags().String("branch", "", "Branch whose container to use (defaults to the local database name)")
+	cloneLocalCmd.Flags().String("container", "", "Name of the local PostgreSQL container (defaults to one per branch)")
+	cloneLocalCmd.Flags().String("image", container.DefaultPostgresOptions().Image, "PostgreSQL image used when creating the container")
+	cloneLocalCmd.Flags().Int("port", 0, "Host port published when creating the container (default: a free port, remembered per branch)")
+	cloneLocalCmd.Flags().Bool("refresh", false, "Drop and re-clone a database that was already cloned")
+	cloneLocalCmd.Flags().Bool("recreate", false, "Remove the branch's container and data volume and start fresh")
+	cloneLocalCmd.Flags().String("masking-profile", "", "Masking profile from the config file to apply after cloning")
+
+	// Transfer options
+	cloneLocalCmd.Flags().Int("max-connections", 2, "Maximum number of parallel connections for data transfer")
+	cloneLocalCmd.Flags().Duration("timeout", 2*time.Hour, "Operation timeout")
+	cloneLocalCmd.Flags().StringSlice("exclude-tables", []string{}, "Tables to exclude from transfer")
+	cloneLocalCmd.Flags().StringSlice("include-tables", []string{}, "Tables to include in transfer")
+	cloneLocalCmd.Flags().Bool("schema-only", false, "Transfer schema only (no data)")
+	cloneLocalCmd.Flags().StringToString("template-var", map[string]string{}, "Template variables (e.g., --template-var BRANCH=main)")
+
+	// Output
+	cloneLocalCmd.Flags().String("output-format", "text", "Output format: text or json")
+	cloneLocalCmd.Flags().Bool("quiet", false, "Suppress all output except errors and final result")
+
+	// Keys this command reads from config files
+	config.RegisterKeys("masking_profiles")
+	config.RegisterOptions(
+		cloneLocalBranchOpt, cloneLocalContainerOpt, cloneLocalImageOpt, cloneLocalPortOpt,
+		cloneLocalMaskingOpt,
+	)
+}
+
+// Options specific to clone-local
+var (
+	cloneLocalBranchOpt    = config.Option{Key: "clone_local.branch", Env: []string{"PGFORK_CLONE_LOCAL_BRANCH"}, Flag: "branch"}
+	cloneLocalContainerOpt = config.Option{Key: "clone_local.container", Env: []string{"PGFORK_CLONE_LOCAL_CONTAINER"}, Flag: "container"}
+	cloneLocalImageOpt     = config.Option{Key: "clone_local.image", Env: []string{"PGFORK_CLONE_LOCAL_IMAGE"}, Flag: "image"}
+	cloneLocalPortOpt      = config.Option{Key: "clone_local.port", Env: []string{"PGFORK_CLONE_LOCAL_PORT"}, Flag: "port"}
+	cloneLocalMaskingOpt   = config.Option{Key: "clone_local.masking_profile", Env: []string{"PGFORK_MASKING_PROFILE"}, Flag: "masking-profile"}
+)
+
+func runCloneLocal(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	cfg := &config.ForkConfig{}
+	fail := func(err error) error {
+		return outputResult(cfg, false, "", err.Error(), time.Since(start))
+	}
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+	loaded, err := builder.BuildForkConfig()
+	if err != nil {
+		return fail(fmt.Errorf("configuration error: %w", err))
+	}
+	cfg = loaded
+
+	// Laptop defaults apply unless the user configured something else
+	if _, ok := builder.Value(config.OptMaxConnections); !ok {
+		cfg.MaxConnections = 2
+	}
+	if _, ok := builder.Value(config.OptTimeout); !ok {
+		cfg.Timeout = 2 * time.Hour
+	}
+
+	if cfg.Source.Database == "" {
+		return fail(fmt.Errorf("source database is required (use --source-db, --source-uri or PGFORK_SOURCE_DATABASE)"))
+	}
+	if cfg.TargetDatabase == "" {
+		cfg.TargetDatabase = cfg.Source.Database
+	}
+	if err := cfg.ProcessTemplates(); err != nil {
+		return fail(fmt.Errorf("template processing failed: %w", err))
+	}
+
+	rules, err := loadMaskingRules(builder, cloneLocalMaskingOpt)
+	if err != nil {
+		return fail(err)
+	}
+
+	branch, err := builder.GetString(cloneLocalBranchOpt, cfg.TargetDatabase)
+	if err != nil {
+		return fail(err)
+	}
+	branches, err := container.NewBranchStore("")
+	if err != nil {
+		return fail(err)
+	}
+	target, err := branches.Load(branch)
+	if err != nil {
+		return fail(err)
+	}
+	opts, err := localContainerOptions(builder, branch, target)
+	if err != nil {
+		return fail(err)
+	}
+	opts.Recreate, _ = cmd.Flags().GetBool("recreate")
+
+	if err := newPasswordInput(cmd).resolve(&cfg.Source, "source-password-stdin", "Source"); err != nil {
+		return fail(err)
+	}
+
+	pg, err := container.EnsurePostgres(opts)
+	if err != nil {
+		return fail(err)
+	}
+	if target == nil || opts.Recreate {
+		target = &container.BranchTarget{Branch: branch}
+	}
+	target.Container = pg.Options.Name
+	target.Image = pg.Options.Image
+	target.Port = pg.Options.Port
+	target.CI = config.DetectCI()
+	if err := branches.Save(target); err != nil {
+		logrus.Warnf("Failed to record container for branch %s: %v", branch, err)
+	}
+	cfg.Destination = pg.Config(cfg.TargetDatabase)
+
+	if err := cfg.Validate(); err != nil {
+		return fail(fmt.Errorf("configuration validation failed: %w", err))
+	}
+
+	// The job state only tells an interrupted clone apart from a finished one; an
+	// interrupted clone is not resumed but cloned again
+	jobID := "clone-local-" + cfg.TargetDatabase
+	jobState := fork.NewResumptionManager("", jobID)
+	previous, err := jobState.LoadState()
+	if err != nil {
+		logrus.Warnf("Ignoring unreadable state of previous clone: %v", err)
+	}
+
+	refresh, _ := cmd.Flags().GetBool("refresh")
+	exists, err := localDatabaseExists(pg, cfg.TargetDatabase)
+	if err != nil {
+		return fail(err)
+	}
+	switch {
+	case exists && refresh:
+		cfg.DropIfExists = true
+	case exists && previous != nil && previous.Status != "completed":
+		logrus.Infof("Previous clone of %s did not finish, starting it again", cfg.TargetDatabase)
+		cfg.DropIfExists = true
+	case exists && previous != nil:
+		return outputResult(cfg, true, fmt.Sprintf("Local database '%s' is already cloned (use --refresh to clone it again)", cfg.TargetDatabase), "", time.Since(start))
+	case exists:
+		return fail(fmt.Errorf("local database '%s' already exists and was not created by clone-local (use --refresh to replace it)", cfg.TargetDatabase))
+	}
+
+	if _, _, err := jobState.InitializeJob(fork.NewDatabaseConfigSnapshot(cfg.Source), fork.NewDatabaseConfigSnapshot(cfg.Destination), cfg.TargetDatabase, map[string]int64{}); err != nil {
+		return fail(err)
+	}
+	if err := jobState.RecordConfig(cfg); err != nil {
+		return fail(err)
+	}
+	if err := cloneLocal(cfg, pg, rules); err != nil {
+		if stateErr := jobState.SetError(err); stateErr != nil {
+			logrus.Warnf("Failed to record clone failure: %v", stateErr)
+		}
+		return fail(err)
+	}
+	if err := jobState.CompleteJob(false); err != nil {
+		logrus.Warnf("Failed to record clone completion: %v", err)
+	}
+
+	return outputResult(cfg, true, fmt.Sprintf("Cloned '%s' into %s", cfg.Source.Database, cfg.Destination.Redacted()), "", time.Since(start))
+}
+
+// cloneLocal forks the source into the container and masks the result. A clone that
+// cannot be masked is dropped so unmasked data does not linger on the laptop.
+func cloneLocal(cfg *config.ForkConfig, pg *container.Postgres, rules []masking.Rule) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	if err := fork.NewForker(cfg).Fork(ctx); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	target := pg.Config(cfg.TargetDatabase)
+	conn, err := db.NewConnection(&target)
+	if err != nil {
+		return fmt.Errorf("failed to connect to local database for masking: %w", err)
+	}
+	maskErr := masking.Apply(ctx, conn.DB, rules)
+	if err := conn.Close(); err != nil {
+		logrus.Warnf("Failed to close masking connection: %v", err)
+	}
+	if maskErr == nil {
+		return nil
+	}
+
+	admin := pg.Config("postgres")
+	adminConn, err := db.NewConnection(&admin)
+	if err != nil {
+		return fmt.Errorf("%w (and could not connect to drop the unmasked clone: %v)", maskErr, err)
+	}
+	defer func() {
+		if err := adminConn.Close(); err != nil {
+			logrus.Warnf("Failed to close admin connection: %v", err)
+		}
+	}()
+	if err := adminConn.DropDatabase(cfg.TargetDatabase); err != nil {
+		return fmt.Errorf("%w (and dropping the unmasked clone failed: %v)", maskErr, err)
+	}
+	return fmt.Errorf("%w; the unmasked clone was dropped", maskErr)
+}
+
+// localContainerOptions resolves the container for a branch. Explicit settings win,
+// then whatever was recorded for the branch, then a per-branch default.
+func localContainerOptions(builder *config.OptionsBuilder, branch string, target *container.BranchTarget) (container.PostgresOptions, error) {
+	opts := container.DefaultPostgresOptions()
+	opts.Name = container.ContainerName(branch)
+	if target != nil {
+		opts.Name = target.Container
+		opts.Image = target.Image
+		opts.Port = target.Port
+	}
+
+	var err error
+	if opts.Name, err = builder.GetString(cloneLocalContainerOpt, opts.Name); err != nil {
+		return opts, err
+	}
+	if opts.Image, err = builder.GetString(cloneLocalImageOpt, opts.Image); err != nil {
+		return opts, err
+	}
+	// A port the user asked for must be honoured; a remembered one may move on conflict
+	if _, explicit := builder.Value(cloneLocalPortOpt); explicit {
+		if opts.Port, err = builder.GetInt(cloneLocalPortOpt, opts.Port); err != nil {
+			return opts, err
+		}
+		opts.StrictPort = opts.Port != 0
+	}
+	opts.Volume = opts.Name + "-data"
+	return opts, nil
+}
+
+// loadMaskingRules reads the masking profile selected by opt from the config file or profile
+func loadMaskingRules(builder *config.OptionsBuilder, opt config.Option) ([]masking.Rule, error) {
+	name, err := builder.GetString(opt, "")
+	if err != nil || name == "" {
+		return nil, err
+	}
+	value, ok := builder.Value(config.Option{Key: "masking_profiles." + name})
+	if !ok {
+		return nil, fmt.Errorf("masking profile '%s' not found in configuration", name)
+	}
+	rules, err := masking.ParseRules(value)
+	if err != nil {
+		return nil, fmt.Errorf("masking profile '%s': %w", name, err)
+	}
+	return rules, nil
+}
+
+// localDatabaseExists reports whether a database exists in the container
+func localDatabaseExists(pg *container.Postgres, name string) (bool, error) {
+	admin := pg.Config("postgres")
+	conn, err := db.NewConnection(&admin)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to local PostgreSQL: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logrus.Warnf("Failed to close admin connection: %v", err)
+		}
+	}()
+	return conn.DatabaseExists(name)
+}
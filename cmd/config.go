@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -135,6 +137,10 @@ func runConfigSet(cmd *cobra.Command, args []string) error {
 	key := args[0]
 	value := args[1]
 
+	if err := config.CheckKey(key); err != nil {
+		return err
+	}
+
 	// Get the config file path
 	configFile := viper.ConfigFileUsed()
 	if configFile == "" {
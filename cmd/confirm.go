@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"golang.org/x/term"
+)
+
+// confirmFork shows the resolved fork on stderr and asks the user to go ahead. A fork
+// that drops an existing database only runs after the target name is typed back.
+func confirmFork(cfg *config.ForkConfig) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return false, fmt.Errorf("--confirm needs a terminal to ask for confirmation")
+	}
+
+	fmt.Fprintln(os.Stderr, "\n--- Fork Summary ---")
+	for _, line := range forkSummary(cfg) {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	stdio := survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)
+	if cfg.DropIfExists {
+		var answer string
+		prompt := &survey.Input{Message: fmt.Sprintf("Type the target database name (%s) to start the fork:", cfg.TargetDatabase)}
+		if err := survey.AskOne(prompt, &answer, stdio); err != nil {
+			return false, fmt.Errorf("confirmation prompt failed: %w", err)
+		}
+		return strings.TrimSpace(answer) == cfg.TargetDatabase, nil
+	}
+
+	confirmed := false
+	if err := survey.AskOne(&survey.Confirm{Message: "Start the fork?"}, &confirmed, stdio); err != nil {
+		return false, fmt.Errorf("confirmation prompt failed: %w", err)
+	}
+	return confirmed, nil
+}
+
+// forkSummary describes the resolved fork: where it copies from and to, how, and
+// everything it changes besides creating the target
+func forkSummary(cfg *config.ForkConfig) []string {
+	lines := []string{
+		"Source: " + connectionTarget(cfg.Source, cfg.Source.Database),
+		"Target: " + connectionTarget(cfg.Destination, cfg.TargetDatabase),
+	}
+	lines = append(lines, fork.NewPlan(cfg).Describe()...)
+
+	var warnings []string
+	if cfg.DropIfExists {
+		warnings = append(warnings, fmt.Sprintf("Drops the existing database %s on %s",
+			cfg.TargetDatabase, cfg.Destination.Address()))
+	}
+	if len(cfg.Seed) > 0 {
+		warnings = append(warnings, "Runs seed SQL against the target: "+strings.Join(cfg.Seed, ", "))
+	}
+	hooks := []struct {
+		stage    string
+		commands []string
+	}{
+		{"before the fork", cfg.Hooks.PreFork},
+		{"after seeding", cfg.Hooks.Seed},
+		{"after the fork", cfg.Hooks.PostFork},
+		{"if the fork fails", cfg.Hooks.OnError},
+	}
+	for _, hook := range hooks {
+		for _, command := range hook.commands {
+			warnings = append(warnings, fmt.Sprintf("Runs %s: %s", hook.stage, command))
+		}
+	}
+	for _, warning := range warnings {
+		lines = append(lines, "⚠️  "+warning)
+	}
+	return lines
+}
+
+// connectionTarget names a database on a connection's server, without the password
+func connectionTarget(conn config.DatabaseConfig, database string) string {
+	target := conn.Address() + "/" + database
+	if conn.Username != "" {
+		target = conn.Username + "@" + target
+	}
+	return target
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForkSummary(t *testing.T) {
+	cfg := &config.ForkConfig{
+		Source:         config.DatabaseConfig{Host: "prod.internal", Port: 5432, Username: "app", Password: "secret", Database: "app"},
+		Destination:    config.DatabaseConfig{Host: "dev.internal", Port: 5433, Username: "dev", Database: "postgres"},
+		TargetDatabase: "app_copy",
+		DropIfExists:   true,
+		ExcludeTables:  []string{"audit_log"},
+		MaxConnections: 4,
+		ChunkSize:      1000,
+		Hooks:          config.HooksConfig{PostFork: []string{"make migrate"}},
+	}
+
+	lines := forkSummary(cfg)
+	assert.Equal(t, "Source: app@prod.internal:5432/app", lines[0])
+	assert.Equal(t, "Target: dev@dev.internal:5433/app_copy", lines[1])
+	assert.Contains(t, lines, "Method: Cross-server data transfer with COPY operations")
+	assert.Contains(t, lines, "Excluding tables: [audit_log]")
+	assert.Contains(t, lines, "⚠️  Drops the existing database app_copy on dev.internal:5433")
+	assert.Contains(t, lines, "⚠️  Runs after the fork: make migrate")
+	for _, line := range lines {
+		assert.NotContains(t, line, "secret")
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// CutoverResult represents the result of a cutover
+type CutoverResult struct {
+	Format   string              `json:"format"`
+	Success  bool                `json:"success"`
+	Message  string              `json:"message,omitempty"`
+	Error    string              `json:"error,omitempty"`
+	Source   string              `json:"source,omitempty"`
+	Database string              `json:"database,omitempty"`
+	Cutover  *fork.CutoverResult `json:"cutover,omitempty"`
+	Duration string              `json:"duration"`
+}
+
+// cutoverCmd represents the cutover command
+var cutoverCmd = &cobra.Command{
+	Use:   "cutover",
+	Short: "Promote a target that follows the source, finishing a migration",
+	Long: `Switch from the source database to a target that has been following it.
+
+Once a target set up with replicate has caught up, or the destination server is a
+warm standby of the source, cutover finishes the migration:
+- Optionally bars the application roles (--pause-roles) from logging in to the
+  source and ends their sessions, so no more writes land there
+- Waits until the target has every change the source made up to that point
+- Promotes the target: a standby is promoted with pg_promote; a replicated target's
+  subscription is detached, its slot and publication are dropped on the source and
+  its sequences are moved past the replicated rows
+- Prints how applications connect to the target
+
+If the cutover fails before the target is promoted, the paused roles are allowed
+back in. After a successful cutover they stay paused on the source; re-enable them
+with ALTER ROLE ... LOGIN once applications point at the target.
+
+Examples:
+  # Cut over a replicated target, pausing the application's role first
+  postgres-db-fork cutover --source-host prod --source-db myapp \
+    --dest-host new-prod --target-db myapp --pause-roles app_rw
+
+  # Promote a warm standby once it has replayed everything
+  postgres-db-fork cutover --source-host old-primary --source-db myapp \
+    --dest-host standby --target-db myapp --timeout 5m`,
+	RunE: runCutover,
+}
+
+func init() {
+	rootCmd.AddCommand(cutoverCmd)
+
+	// Source database flags
+	cutoverCmd.Flags().String("source-uri", "", "Source database URI, replaces the individual source flags")
+	cutoverCmd.Flags().String("source", "", "Source database URI or heroku:<app>::<config var> reference (alias for --source-uri)")
+	cutoverCmd.Flags().String("source-host", "localhost", "Source database host, or comma-separated hosts tried in order (host:port, [IPv6 address]:port)")
+	cutoverCmd.Flags().Int("source-port", 5432, "Source database port")
+	cutoverCmd.Flags().String("source-user", "", "Source database username")
+	cutoverCmd.Flags().String("source-password", "", "Source database password")
+	cutoverCmd.Flags().Bool("source-password-stdin", false, "Read the source database password from standard input")
+	cutoverCmd.Flags().String("source-db", "", "Source database name (required)")
+	cutoverCmd.Flags().String("source-sslmode", "prefer", "Source database SSL mode")
+
+	// Destination database flags
+	cutoverCmd.Flags().String("dest-uri", "", "Destination server URI, replaces the individual destination flags")
+	cutoverCmd.Flags().String("dest-host", "", "Destination database host, or comma-separated hosts tried in order (defaults to source-host)")
+	cutoverCmd.Flags().Int("dest-port", 0, "Destination database port (defaults to source-port)")
+	cutoverCmd.Flags().String("dest-user", "", "Destination database username (defaults to source-user)")
+	cutoverCmd.Flags().String("dest-password", "", "Destination database password (defaults to source-password)")
+	cutoverCmd.Flags().Bool("dest-password-stdin", false, "Read the destination database password from standard input")
+	cutoverCmd.Flags().String("dest-sslmode", "", "Destination database SSL mode (defaults to source-sslmode)")
+	cutoverCmd.Flags().String("admin-db", "", "Maintenance database on the destination server for admin connections (default: postgres)")
+	cutoverCmd.Flags().String("target-db", "", "Target database name (required, supports templates)")
+
+	// Cutover options
+	cutoverCmd.Flags().StringSlice("pause-roles", []string{}, "Source roles to bar from logging in, ending their sessions, before waiting for the target")
+	cutoverCmd.Flags().String("publication", "", "Publication name on the source (default: pgfork_<target-db>)")
+	cutoverCmd.Flags().String("slot", "", "Replication slot name on the source (default: pgfork_<target-db>)")
+	cutoverCmd.Flags().String("subscription", "", "Subscription name on the target (default: pgfork_<target-db>)")
+	cutoverCmd.Flags().Duration("timeout", 10*time.Minute, "How long to wait for the target to catch up before giving up")
+	cutoverCmd.Flags().StringToString("template-var", map[string]string{}, "Template variables (e.g., --template-var PR_NUMBER=123)")
+
+	// Output options
+	cutoverCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(cutoverCmd)
+	cutoverCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterOptions(cutoverPauseRolesOpt)
+}
+
+// Cutover options, resolved through the shared options builder. The replication
+// names are shared with replicate, which created them.
+var (
+	cutoverPauseRolesOpt = config.Option{Key: "cutover.pause_roles", Env: []string{"PGFORK_CUTOVER_PAUSE_ROLES"}, Flag: "pause-roles"}
+)
+
+func runCutover(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	fail := func(err error) error {
+		return outputCutoverResult(&CutoverResult{
+			Format:   outputFormat,
+			Success:  false,
+			Error:    err.Error(),
+			Duration: time.Since(start).String(),
+		}, quiet)
+	}
+
+	cfg, err := builder.BuildForkConfig()
+	if err != nil {
+		return fail(fmt.Errorf("configuration error: %w", err))
+	}
+	if cfg.Source.Database == "" {
+		return fail(fmt.Errorf("source database is required (use --source-db, --source-uri or PGFORK_SOURCE_DATABASE)"))
+	}
+	if cfg.TargetDatabase == "" {
+		return fail(fmt.Errorf("target database is required (use --target-db or PGFORK_TARGET_DATABASE)"))
+	}
+	if err := cfg.ProcessTemplates(); err != nil {
+		return fail(fmt.Errorf("template processing failed: %w", err))
+	}
+	if err := cfg.Validate(); err != nil {
+		return fail(fmt.Errorf("configuration validation failed: %w", err))
+	}
+
+	opts := fork.CutoverOptions{}
+	if opts.PauseRoles, err = builder.GetStringSlice(cutoverPauseRolesOpt, nil); err != nil {
+		return fail(err)
+	}
+	if opts.Publication, err = builder.GetString(replicatePublicationOpt, ""); err != nil {
+		return fail(err)
+	}
+	if opts.Slot, err = builder.GetString(replicateSlotOpt, ""); err != nil {
+		return fail(err)
+	}
+	if opts.Subscription, err = builder.GetString(replicateSubscriptionOpt, ""); err != nil {
+		return fail(err)
+	}
+
+	if err := newPasswordInput(cmd).resolveForkPasswords(cfg); err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	cutover, err := fork.Cutover(ctx, cfg, opts, logging.GetGlobalLogger())
+	if err != nil {
+		return fail(err)
+	}
+
+	return outputCutoverResult(&CutoverResult{
+		Format:   outputFormat,
+		Success:  true,
+		Message:  fmt.Sprintf("Cut over from %s to %s", cfg.Source.Database, cfg.TargetDatabase),
+		Source:   cfg.Source.Database,
+		Database: cfg.TargetDatabase,
+		Cutover:  cutover,
+		Duration: time.Since(start).String(),
+	}, quiet)
+}
+
+// cutoverView renders a cutover result, with the quiet flag that text output needs.
+// Its JSON encoding is the CutoverResult.
+type cutoverView struct {
+	*CutoverResult
+	quiet bool
+}
+
+// WriteText writes what the cutover did and how to connect to the target, or only
+// the error in quiet mode
+func (v cutoverView) WriteText(w io.Writer) error {
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+	if v.quiet {
+		return nil
+	}
+
+	c := v.Cutover
+	fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	if c.Mode == fork.CutoverStandby {
+		fmt.Fprintln(w, "Promoted the standby to a primary")
+	} else {
+		fmt.Fprintln(w, "Detached the target from the source")
+	}
+	fmt.Fprintf(w, "Caught up with the source at %s after %s\n", c.LSN, c.WaitedFor)
+	if len(c.PausedRoles) > 0 {
+		fmt.Fprintf(w, "Paused on the source: %v (%d sessions ended)\n", c.PausedRoles, c.TerminatedSessions)
+	}
+	if c.SequencesFixed > 0 {
+		fmt.Fprintf(w, "Sequences moved past the replicated rows: %d\n", c.SequencesFixed)
+	}
+	fmt.Fprintf(w, "Connect to: %s\n", c.Target)
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// WritePorcelain writes the promoted target and how it was promoted:
+//
+//	database	<name>
+//	cutover	<mode>	<lsn>	<waited for>	<sequences fixed>
+//	paused-role	<role>
+//	connect	<target>
+func (v cutoverView) WritePorcelain(w io.Writer) {
+	if !v.Success {
+		return
+	}
+	c := v.Cutover
+	output.WritePorcelain(w, "database", v.Database)
+	output.WritePorcelain(w, "cutover", c.Mode, c.LSN, c.WaitedFor, c.SequencesFixed)
+	for _, role := range c.PausedRoles {
+		output.WritePorcelain(w, "paused-role", role)
+	}
+	output.WritePorcelain(w, "connect", c.Target)
+}
+
+// Outcome reports whether the cutover succeeded
+func (v cutoverView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputCutoverResult outputs the cutover result in the specified format
+func outputCutoverResult(result *CutoverResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, cutoverView{CutoverResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// DataDiffResult represents the result of comparing the data of two databases
+type DataDiffResult struct {
+	Format    string              `json:"format"`
+	Success   bool                `json:"success"`
+	Message   string              `json:"message,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	DatabaseA string              `json:"database_a"`
+	DatabaseB string              `json:"database_b"`
+	Tables    []*db.TableDataDiff `json:"tables,omitempty"`
+	Skipped   []DataDiffSkipped   `json:"skipped,omitempty"`
+	Differing int                 `json:"differing"`
+	Duration  string              `json:"duration"`
+}
+
+// DataDiffSkipped is a table that could not be compared, and why
+type DataDiffSkipped struct {
+	Table  string `json:"table"`
+	Reason string `json:"reason"`
+}
+
+// dataDiffCmd represents the data-diff command
+var dataDiffCmd = &cobra.Command{
+	Use:   "data-diff <db-a> <db-b>",
+	Short: "Count added, removed and changed rows between two databases",
+	Long: `Compare the rows of tables in two databases on the same server, matched by
+primary key, and report how many rows were added, removed or changed in the second
+database relative to the first. Use it to check what a sync or masking run did.
+
+Rows are split into buckets by a hash of their key, and each bucket is checksummed
+on both sides. Only buckets whose checksums differ are read back row by row, so
+large tables that mostly match are compared cheaply. Raise --buckets for large
+tables with scattered changes.
+
+Tables without a primary key cannot be matched and are skipped. Without --tables,
+every table of the first database is compared.
+
+The command exits with code 1 when any table differs.
+
+Examples:
+  # Compare two tables of a fork with its source
+  postgres-db-fork data-diff myapp myapp_pr_123 --tables users,orders --user admin
+
+  # Compare every table, as JSON
+  postgres-db-fork data-diff myapp myapp_masked --output-format json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDataDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(dataDiffCmd)
+
+	// Database connection flags
+	dataDiffCmd.Flags().String("host", "localhost", "Database server host")
+	dataDiffCmd.Flags().Int("port", 5432, "Database server port")
+	dataDiffCmd.Flags().String("user", "", "Database username (required)")
+	dataDiffCmd.Flags().String("password", "", "Database password")
+	dataDiffCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	dataDiffCmd.Flags().String("sslmode", "prefer", "SSL mode")
+
+	// Diff options
+	dataDiffCmd.Flags().StringSlice("tables", []string{}, "Tables to compare, as table or schema.table (default: all)")
+	dataDiffCmd.Flags().Int("buckets", 1024, "Number of key hash buckets checksummed per table")
+	dataDiffCmd.Flags().Duration("timeout", 30*time.Minute, "Timeout for the whole comparison")
+
+	// Output options
+	dataDiffCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(dataDiffCmd)
+	dataDiffCmd.Flags().Bool("quiet", false, "Print only the summary")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("data_diff")
+	config.RegisterOptions(dataDiffTablesOpt, dataDiffBucketsOpt, dataDiffTimeoutOpt)
+}
+
+// Data-diff options, resolved through the shared options builder
+var (
+	dataDiffTablesOpt  = config.Option{Key: "data_diff.tables", Env: []string{"PGFORK_DATA_DIFF_TABLES"}, Flag: "tables"}
+	dataDiffBucketsOpt = config.Option{Key: "data_diff.buckets", Env: []string{"PGFORK_DATA_DIFF_BUCKETS"}, Flag: "buckets"}
+	dataDiffTimeoutOpt = config.Option{Key: "data_diff.timeout", Env: []string{"PGFORK_DATA_DIFF_TIMEOUT"}, Flag: "timeout"}
+)
+
+func runDataDiff(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	result := &DataDiffResult{
+		Format:    outputFormat,
+		Success:   true,
+		DatabaseA: args[0],
+		DatabaseB: args[1],
+	}
+	fail := func(err error) error {
+		result.Success = false
+		result.Error = err.Error()
+		result.Duration = time.Since(start).String()
+		return outputDataDiffResult(result, quiet)
+	}
+
+	dbConfig, err := builder.BuildConnection(config.ServerConnection("data_diff"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_DATA_DIFF_USER)"))
+	}
+	tables, err := builder.GetStringSlice(dataDiffTablesOpt, nil)
+	if err != nil {
+		return fail(err)
+	}
+	buckets, err := builder.GetInt(dataDiffBucketsOpt, 1024)
+	if err != nil {
+		return fail(err)
+	}
+	if buckets < 1 {
+		return fail(fmt.Errorf("buckets must be at least 1, got %d", buckets))
+	}
+	timeout, err := builder.GetDuration(dataDiffTimeoutOpt, 30*time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	connA, err := connectDatabase(ctx, dbConfig, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	defer func() {
+		if err := connA.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+	connB, err := connectDatabase(ctx, dbConfig, args[1])
+	if err != nil {
+		return fail(err)
+	}
+	defer func() {
+		if err := connB.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	keys, err := connA.PrimaryKeysContext(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	selected, err := selectDiffTables(keys, tables)
+	if err != nil {
+		return fail(fmt.Errorf("%w in %s", err, args[0]))
+	}
+
+	for _, key := range selected {
+		name := key.Schema + "." + key.Table
+		if key.Index == "" {
+			result.Skipped = append(result.Skipped, DataDiffSkipped{Table: name, Reason: "no primary key"})
+			continue
+		}
+		diff, err := db.DiffTableDataContext(ctx, connA, connB, key, buckets)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fail(fmt.Errorf("comparison timed out after %s: %w", timeout, err))
+			}
+			result.Skipped = append(result.Skipped, DataDiffSkipped{Table: name, Reason: err.Error()})
+			continue
+		}
+		result.Tables = append(result.Tables, diff)
+		if !diff.Identical() {
+			result.Differing++
+		}
+	}
+
+	compared := len(result.Tables)
+	if result.Differing > 0 {
+		result.Success = false
+		result.Error = fmt.Sprintf("%d of %d tables differ", result.Differing, compared)
+	} else {
+		result.Message = fmt.Sprintf("All %d compared tables hold the same rows", compared)
+	}
+	if len(result.Skipped) > 0 {
+		note := fmt.Sprintf(" (%d skipped)", len(result.Skipped))
+		if result.Success {
+			result.Message += note
+		} else {
+			result.Error += note
+		}
+	}
+	result.Duration = time.Since(start).String()
+	return outputDataDiffResult(result, quiet)
+}
+
+// connectDatabase connects to a database of the server described by cfg
+func connectDatabase(ctx context.Context, cfg *config.DatabaseConfig, database string) (*db.Connection, error) {
+	target := cfg.WithDatabase(database)
+	conn, err := db.NewConnectionContext(ctx, &target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database %s: %w", database, err)
+	}
+	return conn, nil
+}
+
+// selectDiffTables picks the named tables from keys; names without a schema are in
+// public. With no names, every table is selected.
+func selectDiffTables(keys []db.PrimaryKey, names []string) ([]db.PrimaryKey, error) {
+	if len(names) == 0 {
+		return keys, nil
+	}
+	byName := make(map[string]db.PrimaryKey, len(keys))
+	for _, key := range keys {
+		byName[key.Schema+"."+key.Table] = key
+	}
+	selected := make([]db.PrimaryKey, 0, len(names))
+	for _, name := range names {
+		qualified := name
+		if !strings.Contains(name, ".") {
+			qualified = "public." + name
+		}
+		key, ok := byName[qualified]
+		if !ok {
+			return nil, fmt.Errorf("table %s not found", name)
+		}
+		selected = append(selected, key)
+	}
+	return selected, nil
+}
+
+// dataDiffView renders the data diff result, with the quiet flag that text output
+// needs. Its JSON encoding is the DataDiffResult.
+type dataDiffView struct {
+	*DataDiffResult
+	quiet bool
+}
+
+// WriteText writes how each table differs, or only the summary in quiet mode
+func (v dataDiffView) WriteText(w io.Writer) error {
+	if !v.quiet && (len(v.Tables) > 0 || len(v.Skipped) > 0) {
+		fmt.Fprintf(w, "🔍 Comparing data of %s → %s\n", v.DatabaseA, v.DatabaseB)
+		for _, diff := range v.Tables {
+			if diff.Identical() {
+				fmt.Fprintf(w, "  %-30s identical (%d rows)\n", diff.Table, diff.RowsA)
+				continue
+			}
+			fmt.Fprintf(w, "  %-30s rows %d → %d: +%d added, -%d removed, ~%d changed\n",
+				diff.Table, diff.RowsA, diff.RowsB, diff.Added, diff.Removed, diff.Changed)
+		}
+		for _, skipped := range v.Skipped {
+			fmt.Fprintf(w, "  %-30s skipped: %s\n", skipped.Table, skipped.Reason)
+		}
+	}
+	if v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+	}
+	return nil
+}
+
+// WritePorcelain writes the data diff result as porcelain records:
+//
+//	table	<schema.table>	<rows a>	<rows b>	<added>	<removed>	<changed>
+//	skipped	<schema.table>	<reason>
+func (v dataDiffView) WritePorcelain(w io.Writer) {
+	for _, diff := range v.Tables {
+		output.WritePorcelain(w, "table", diff.Table, diff.RowsA, diff.RowsB, diff.Added, diff.Removed, diff.Changed)
+	}
+	for _, skipped := range v.Skipped {
+		output.WritePorcelain(w, "skipped", skipped.Table, skipped.Reason)
+	}
+}
+
+// Outcome reports whether the databases hold the same data
+func (v dataDiffView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputDataDiffResult outputs the data diff result in the specified format
+func outputDataDiffResult(result *DataDiffResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, dataDiffView{DataDiffResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectDiffTables(t *testing.T) {
+	keys := []db.PrimaryKey{
+		{Schema: "billing", Table: "invoices", Index: "invoices_pkey"},
+		{Schema: "public", Table: "audit_log"},
+		{Schema: "public", Table: "users", Index: "users_pkey"},
+	}
+
+	selected, err := selectDiffTables(keys, nil)
+	require.NoError(t, err)
+	assert.Equal(t, keys, selected)
+
+	selected, err = selectDiffTables(keys, []string{"users", "billing.invoices"})
+	require.NoError(t, err)
+	assert.Equal(t, []db.PrimaryKey{keys[2], keys[0]}, selected)
+
+	_, err = selectDiffTables(keys, []string{"invoices"})
+	assert.EqualError(t, err, "table invoices not found")
+}
+
+func TestWriteDataDiffPorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, dataDiffView{DataDiffResult: &DataDiffResult{
+		Success: false,
+		Error:   "1 of 2 tables differ (1 skipped)",
+		Tables: []*db.TableDataDiff{
+			{Table: "public.orders", RowsA: 10, RowsB: 11, Added: 2, Removed: 1, Changed: 3},
+			{Table: "public.users", RowsA: 5, RowsB: 5},
+		},
+		Skipped: []DataDiffSkipped{{Table: "public.audit_log", Reason: "no primary key"}},
+	}}))
+	assert.Equal(t, "table\tpublic.orders\t10\t11\t2\t1\t3\n"+
+		"table\tpublic.users\t5\t5\t0\t0\t0\n"+
+		"skipped\tpublic.audit_log\tno primary key\n"+
+		"status\terror\t1 of 2 tables differ (1 skipped)\n", buf.String())
+}
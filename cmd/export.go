@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/dataset"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// ExportResult represents the result of an export
+type ExportResult struct {
+	Format     string                `json:"format"`
+	Success    bool                  `json:"success"`
+	Message    string                `json:"message,omitempty"`
+	Error      string                `json:"error,omitempty"`
+	Database   string                `json:"database,omitempty"`
+	FileFormat string                `json:"file_format,omitempty"`
+	OutputDir  string                `json:"output_dir,omitempty"`
+	Masked     bool                  `json:"masked"`
+	Tables     []dataset.TableExport `json:"tables,omitempty"`
+	Duration   string                `json:"duration"`
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export [database]",
+	Short: "Export tables to CSV or Parquet files",
+	Long: `Write the rows of selected tables to local files, one file per table.
+
+Files are named <schema>.<table>.csv or <schema>.<table>.parquet in the output
+directory. All tables are read in one repeatable-read transaction, so the files are
+consistent with each other. Values keep their PostgreSQL text representation; CSV
+files use the COPY CSV dialect with a header line and load back with
+COPY ... (FORMAT csv, HEADER), and Parquet files store every column as an optional
+UTF8 string.
+
+With --masked, the columns covered by the masking profile are masked in the query,
+so unmasked values never leave the server.
+
+The database defaults to the configured target database (PGFORK_TARGET_DATABASE).
+
+Examples:
+  # Export two tables of a fork as CSV
+  postgres-db-fork export myapp_pr_123 --tables users,orders --output-dir ./export
+
+  # Export every table as Parquet with the dev masking profile applied
+  postgres-db-fork export myapp --format parquet --masked --masking-profile dev`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	// Database connection flags
+	exportCmd.Flags().String("host", "localhost", "Database server host")
+	exportCmd.Flags().Int("port", 5432, "Database server port")
+	exportCmd.Flags().String("user", "", "Database username (required)")
+	exportCmd.Flags().String("password", "", "Database password")
+	exportCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	exportCmd.Flags().String("sslmode", "prefer", "SSL mode")
+
+	// Export options
+	exportCmd.Flags().String("format", "csv", "File format: csv or parquet")
+	exportCmd.Flags().StringSlice("tables", []string{}, "Tables to export (default: all tables)")
+	exportCmd.Flags().String("output-dir", ".", "Directory the files are written to")
+	exportCmd.Flags().Bool("masked", false, "Apply the masking profile to the exported values")
+	exportCmd.Flags().String("masking-profile", "", "Masking profile from the config file (required with --masked)")
+	exportCmd.Flags().Duration("timeout", 30*time.Minute, "Timeout for the export")
+
+	// Output options
+	exportCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+	exportCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("export")
+	config.RegisterOptions(
+		exportFormatOpt, exportTablesOpt, exportDirOpt, exportMaskedOpt, exportMaskingOpt,
+		exportTimeoutOpt,
+	)
+}
+
+// Export options, resolved through the shared options builder
+var (
+	exportFormatOpt  = config.Option{Key: "export.format", Env: []string{"PGFORK_EXPORT_FORMAT"}, Flag: "format"}
+	exportTablesOpt  = config.Option{Key: "export.tables", Env: []string{"PGFORK_EXPORT_TABLES"}, Flag: "tables"}
+	exportDirOpt     = config.Option{Key: "export.output_dir", Env: []string{"PGFORK_EXPORT_OUTPUT_DIR"}, Flag: "output-dir"}
+	exportMaskedOpt  = config.Option{Key: "export.masked", Env: []string{"PGFORK_EXPORT_MASKED"}, Flag: "masked"}
+	exportMaskingOpt = config.Option{Key: "export.masking_profile", Env: []string{"PGFORK_MASKING_PROFILE"}, Flag: "masking-profile"}
+	exportTimeoutOpt = config.Option{Key: "export.timeout", Env: []string{"PGFORK_EXPORT_TIMEOUT"}, Flag: "timeout"}
+)
+
+func runExport(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	fail := func(err error) error {
+		return outputExportResult(&ExportResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet)
+	}
+
+	dbConfig, err := databaseConnection(builder, "export", args)
+	if err != nil {
+		return fail(err)
+	}
+	if dbConfig.Database == "" {
+		return fail(fmt.Errorf("database is required (pass it as an argument or set PGFORK_TARGET_DATABASE)"))
+	}
+
+	opts := dataset.ExportOptions{}
+	formatName, err := builder.GetString(exportFormatOpt, "csv")
+	if err != nil {
+		return fail(err)
+	}
+	if opts.Format, err = dataset.ParseFormat(formatName); err != nil {
+		return fail(err)
+	}
+	if opts.Tables, err = builder.GetStringSlice(exportTablesOpt, nil); err != nil {
+		return fail(err)
+	}
+	if opts.Dir, err = builder.GetString(exportDirOpt, "."); err != nil {
+		return fail(err)
+	}
+	masked, err := builder.GetBool(exportMaskedOpt, false)
+	if err != nil {
+		return fail(err)
+	}
+	if masked {
+		if opts.Rules, err = loadMaskingRules(builder, exportMaskingOpt); err != nil {
+			return fail(err)
+		}
+		if len(opts.Rules) == 0 {
+			return fail(fmt.Errorf("--masked requires a masking profile with rules (use --masking-profile or PGFORK_MASKING_PROFILE)"))
+		}
+	}
+	timeout, err := builder.GetDuration(exportTimeoutOpt, 30*time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_EXPORT_USER)"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := db.NewConnectionContext(ctx, dbConfig)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	tables, err := dataset.Export(ctx, conn.DB, opts)
+	if err != nil {
+		return fail(err)
+	}
+
+	var rows int64
+	for _, table := range tables {
+		rows += table.Rows
+	}
+	return outputExportResult(&ExportResult{
+		Format:     outputFormat,
+		Success:    true,
+		Message:    fmt.Sprintf("Exported %d rows from %d tables", rows, len(tables)),
+		Database:   dbConfig.Database,
+		FileFormat: string(opts.Format),
+		OutputDir:  opts.Dir,
+		Masked:     masked,
+		Tables:     tables,
+		Duration:   time.Since(start).String(),
+	}, quiet)
+}
+
+// exportView renders the export result, with the quiet flag that text output needs.
+// Its JSON encoding is the ExportResult.
+type exportView struct {
+	*ExportResult
+	quiet bool
+}
+
+// WriteText writes the file each table was exported to, or only the error in quiet mode
+func (v exportView) WriteText(w io.Writer) error {
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+	if v.quiet {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	for _, table := range v.Tables {
+		if table.Masked > 0 {
+			fmt.Fprintf(w, "  %s: %d rows -> %s (%d masked columns)\n", table.Table, table.Rows, table.File, table.Masked)
+		} else {
+			fmt.Fprintf(w, "  %s: %d rows -> %s\n", table.Table, table.Rows, table.File)
+		}
+	}
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// outputExportResult outputs the export result in the specified format
+func outputExportResult(result *ExportResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, exportView{ExportResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -3,11 +3,17 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/telemetry"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -24,12 +30,15 @@ func TestForkCmd(t *testing.T) {
 func TestForkCmdFlags(t *testing.T) {
 	// Test that all expected flags are present
 	expectedFlags := []string{
-		"source-host", "source-port", "source-user", "source-password",
-		"source-db", "source-sslmode", "dest-host", "dest-port",
+		"source-uri", "source-host", "source-port", "source-user", "source-password",
+		"source-db", "source-sslmode", "dest-uri", "target-uri", "dest-host", "dest-port",
 		"dest-user", "dest-password", "dest-sslmode", "target-db",
-		"drop-if-exists", "max-connections", "chunk-size", "timeout",
-		"exclude-tables", "include-tables", "schema-only", "data-only",
+		"drop-if-exists", "auto-suffix", "use-template-cache", "max-connections", "chunk-size", "timeout",
+		"exclude-tables", "include-tables", "table-pattern-mode", "schema-only", "data-only", "minimal-schema", "seed",
+		"synthesize-data", "synthesize-rows", "synthesize-table-rows",
+		"vacuum-report", "vacuum-freeze-tables", "verify-sample", "verify-interval", "table-group",
 		"output-format", "quiet", "dry-run", "template-var", "env-vars", "background",
+		"job-id",
 	}
 
 	for _, flagName := range expectedFlags {
@@ -208,6 +217,118 @@ func TestForkCmdOutputFormats(t *testing.T) {
 	}
 }
 
+func TestForkResultJSON(t *testing.T) {
+	result := forkResult{
+		OutputConfig: &config.OutputConfig{Format: "json", Success: true, Database: "app_copy", Duration: "1m0s"},
+		Report: &fork.Report{
+			Method:  fork.MethodTransfer,
+			Reason:  "source and destination are on different servers",
+			Engines: []fork.Engine{fork.EnginePgDump, fork.EngineCopy},
+			Workers: 4,
+			Phases:  []fork.Phase{{Name: "data", Duration: "50s", DurationMs: 50000}},
+		},
+	}
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "app_copy", decoded["database"])
+	report := decoded["report"].(map[string]interface{})
+	assert.Equal(t, "transfer", report["method"])
+	assert.Equal(t, []interface{}{"pgdump", "copy"}, report["engines"])
+	assert.Equal(t, float64(4), report["workers"])
+	assert.Equal(t, float64(50000), report["phases"].([]interface{})[0].(map[string]interface{})["duration_ms"])
+
+	// Results of forks that never started carry no report
+	data, err = json.Marshal(forkResult{OutputConfig: &config.OutputConfig{Format: "json"}})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "report")
+}
+
+func TestWriteReportFile(t *testing.T) {
+	path := t.TempDir() + "/report.json"
+	cfg := &config.ForkConfig{TargetDatabase: "app_copy", Privacy: "alias"}
+	require.NoError(t, writeReportFile(path, newForkResult(cfg, nil, true, "Fork completed", "", time.Second)))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "app_copy", decoded["database"], "the report keeps names intact")
+}
+
+func TestForkEvent(t *testing.T) {
+	cfg := &config.ForkConfig{TargetDatabase: "app_copy", SchemaCache: true, Bench: "builtin"}
+	result := newForkResult(cfg, &fork.Report{Method: fork.MethodTransfer, Engines: []fork.Engine{fork.EngineCopy}}, false, "", "boom", 90*time.Second)
+	result.errorClass = "timeout"
+
+	event := forkEvent(cfg, &telemetry.Settings{InstallID: "abc"}, result)
+	assert.Equal(t, "transfer", event.Method)
+	assert.Equal(t, []string{"copy"}, event.Engines)
+	assert.Equal(t, []string{"schema_cache", "bench"}, event.Features)
+	assert.Equal(t, "1m-10m", event.Duration)
+	assert.Equal(t, "timeout", event.ErrorClass)
+
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "app_copy")
+	assert.NotContains(t, string(data), "boom")
+}
+
+func TestForkResultQuotaExceeded(t *testing.T) {
+	exceeded := &fork.QuotaExceededError{
+		Quota: "team", Team: "payments", LimitDatabases: 2, RequestedBytes: 1024,
+		Usage: fork.QuotaUsage{TotalBytes: 4096, Team: "payments", TeamBytes: 2048, TeamDatabases: 2},
+	}
+	cfg := &config.ForkConfig{TargetDatabase: "app_copy", OutputFormat: "porcelain"}
+	result := newForkResult(cfg, nil, false, "", exceeded.Error(), time.Second)
+	assert.True(t, errors.As(fmt.Errorf("fork failed: %w", exceeded), &result.QuotaExceeded))
+
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, result))
+	assert.Equal(t, "quota-exceeded\tteam\tpayments\t2048\t1024\t0\t2\t2\n"+
+		"status\terror\tquota exceeded: team payments already has 2 of its 2 databases\n", buf.String())
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	quota := decoded["quota_exceeded"].(map[string]interface{})
+	assert.Equal(t, "team", quota["quota"])
+	assert.Equal(t, float64(2), quota["usage"].(map[string]interface{})["team_databases"])
+}
+
+func TestForkResultPreflight(t *testing.T) {
+	failed := &preflightError{results: []ValidationResult{
+		{Check: "source_connectivity", Status: "pass", Message: "Source database connection successful"},
+		{Check: "target_database_exists", Status: "fail", Message: "Target database already exists (use --drop-if-exists to overwrite)"},
+	}}
+	assert.Equal(t, "preflight checks failed (target_database_exists: Target database already exists (use --drop-if-exists to overwrite)); fix them or fork with --skip-validate", failed.Error())
+
+	cfg := &config.ForkConfig{TargetDatabase: "app_copy", OutputFormat: "porcelain"}
+	result := newForkResult(cfg, nil, false, "", failed.Error(), time.Second)
+	var preflightErr *preflightError
+	require.True(t, errors.As(fmt.Errorf("fork failed: %w", failed), &preflightErr))
+	result.Validation = preflightErr.results
+
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, result))
+	assert.True(t, strings.HasPrefix(buf.String(), "check\tsource_connectivity\tpass\ncheck\ttarget_database_exists\tfail\n"))
+
+	buf.Reset()
+	require.NoError(t, result.WriteText(&buf))
+	assert.Contains(t, buf.String(), "target_database_exists: Target database already exists")
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"validation":[{"check":"source_connectivity","status":"pass"`)
+}
+
 func TestForkCmdTemplateVariables(t *testing.T) {
 	// Test template variable handling
 	viper.Reset()
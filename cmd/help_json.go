@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// helpJSONFlag prints a command's definition as JSON instead of running it
+const helpJSONFlag = "help-json"
+
+// CommandHelp describes a command and its flags for --help-json, so wrappers can build
+// forms and validation from the CLI definition
+type CommandHelp struct {
+	Name        string        `json:"name"`
+	Path        string        `json:"path"`
+	Usage       string        `json:"usage"`
+	Short       string        `json:"short,omitempty"`
+	Long        string        `json:"long,omitempty"`
+	Example     string        `json:"example,omitempty"`
+	Aliases     []string      `json:"aliases,omitempty"`
+	Runnable    bool          `json:"runnable"`
+	Flags       []FlagHelp    `json:"flags,omitempty"`
+	Subcommands []CommandHelp `json:"subcommands,omitempty"`
+}
+
+// FlagHelp describes one flag of a command
+type FlagHelp struct {
+	Name       string `json:"name"`
+	Shorthand  string `json:"shorthand,omitempty"`
+	Type       string `json:"type"`
+	Default    string `json:"default"`
+	Usage      string `json:"usage"`
+	Required   bool   `json:"required,omitempty"`
+	Inherited  bool   `json:"inherited,omitempty"`
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+func init() {
+	rootCmd.PersistentFlags().Bool(helpJSONFlag, false, "Print the command's flags and subcommands as JSON")
+}
+
+// helpJSONCommand returns the command named by args when they ask for --help-json.
+// The request is handled before cobra runs the command, so argument and required
+// flag checks do not get in the way of describing it.
+func helpJSONCommand(args []string) (*cobra.Command, bool) {
+	requested := false
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--"+helpJSONFlag || arg == "--"+helpJSONFlag+"=true" {
+			requested = true
+		}
+	}
+	if !requested {
+		return nil, false
+	}
+	cmd, _, err := rootCmd.Find(args)
+	if err != nil {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// printCommandHelpJSON writes the description of cmd and its subcommands
+func printCommandHelpJSON(w io.Writer, cmd *cobra.Command) error {
+	data, err := json.MarshalIndent(describeCommand(cmd), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal command help: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// describeCommand returns the description of cmd, including its available subcommands
+func describeCommand(cmd *cobra.Command) CommandHelp {
+	help := CommandHelp{
+		Name:     cmd.Name(),
+		Path:     cmd.CommandPath(),
+		Usage:    cmd.UseLine(),
+		Short:    cmd.Short,
+		Long:     cmd.Long,
+		Example:  cmd.Example,
+		Aliases:  cmd.Aliases,
+		Runnable: cmd.Runnable(),
+	}
+
+	addFlags := func(flags *pflag.FlagSet, inherited bool) {
+		flags.VisitAll(func(f *pflag.Flag) {
+			if f.Hidden || f.Name == "help" || f.Name == helpJSONFlag {
+				return
+			}
+			required := f.Annotations[cobra.BashCompOneRequiredFlag]
+			help.Flags = append(help.Flags, FlagHelp{
+				Name:       f.Name,
+				Shorthand:  f.Shorthand,
+				Type:       f.Value.Type(),
+				Default:    f.DefValue,
+				Usage:      f.Usage,
+				Required:   len(required) > 0 && required[0] == "true",
+				Inherited:  inherited,
+				Deprecated: f.Deprecated,
+			})
+		})
+	}
+	addFlags(cmd.NonInheritedFlags(), false)
+	addFlags(cmd.InheritedFlags(), true)
+
+	for _, sub := range cmd.Commands() {
+		if sub.IsAvailableCommand() {
+			help.Subcommands = append(help.Subcommands, describeCommand(sub))
+		}
+	}
+	return help
+}
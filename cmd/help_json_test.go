@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelpJSONCommand(t *testing.T) {
+	cmd, ok := helpJSONCommand([]string{"branch", "create", "--from", "main", "--help-json"})
+	require.True(t, ok)
+	assert.Equal(t, branchCreateCmd, cmd)
+
+	_, ok = helpJSONCommand([]string{"fork", "--target-db", "x"})
+	assert.False(t, ok)
+
+	// Arguments after -- belong to the command
+	_, ok = helpJSONCommand([]string{"fork", "--", "--help-json"})
+	assert.False(t, ok)
+}
+
+func TestDescribeCommand(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, printCommandHelpJSON(&buf, psCmd))
+
+	var help CommandHelp
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &help))
+	assert.Equal(t, "postgres-db-fork ps", help.Path)
+	assert.True(t, help.Runnable)
+
+	flags := make(map[string]FlagHelp)
+	for _, f := range help.Flags {
+		flags[f.Name] = f
+	}
+	assert.Equal(t, FlagHelp{Name: "user", Type: "string", Usage: psCmd.Flags().Lookup("user").Usage, Required: true}, flags["user"])
+	assert.True(t, flags["config"].Inherited)
+	assert.NotContains(t, flags, helpJSONFlag)
+
+	root := describeCommand(rootCmd)
+	var names []string
+	for _, sub := range root.Subcommands {
+		names = append(names, sub.Name)
+	}
+	assert.Contains(t, names, "fork")
+}
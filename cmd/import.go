@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/dataset"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// ImportResult represents the result of an import
+type ImportResult struct {
+	Format   string                `json:"format"`
+	Success  bool                  `json:"success"`
+	Message  string                `json:"message,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	Database string                `json:"database,omitempty"`
+	Files    []dataset.TableImport `json:"files,omitempty"`
+	Duration string                `json:"duration"`
+}
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <file>...",
+	Short: "Load CSV or Parquet files into tables of a fork",
+	Long: `Bulk-load CSV or Parquet files into existing tables with COPY.
+
+Each file is loaded in its own transaction into the table named by the file, as
+written by export (<schema>.<table>.csv, <table>.parquet), or into --table. CSV files
+need a header line and use the COPY CSV dialect: an empty unquoted field is NULL.
+Parquet files must have flat columns; values are converted to their PostgreSQL text
+form and cast by the table's column types.
+
+File columns load into the table columns of the same name. --map renames a column
+(--map mail=email) or skips it when mapped to nothing (--map legacy_id=).
+
+Rows the table rejects (invalid values, constraint violations, wrong column counts)
+are written with the error to <file>.rejected.csv in --quarantine-dir instead of
+failing the load. Once more than --max-errors rows of a file are rejected, the file's
+load is rolled back; -1 allows any number.
+
+With --truncate, each table is loaded with COPY FREEZE, which writes its rows already
+frozen so the fork needs no anti-wraparound vacuum of them later. FREEZE cannot be
+combined with quarantining rows, so a file with a rejected row, or a table the server
+cannot freeze (such as a partitioned table), is loaded again without it. --freeze=false
+turns this off.
+
+The database defaults to the configured target database (PGFORK_TARGET_DATABASE).
+
+Examples:
+  # Load an export back into a fork
+  postgres-db-fork import ./export/*.csv --target-db myapp_pr_123
+
+  # Load a Parquet file into a differently named table and columns
+  postgres-db-fork import customers.parquet --target-db myapp_pr_123 \
+    --table crm.contacts --map mail=email --map legacy_id= --truncate`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	// Database connection flags
+	importCmd.Flags().String("host", "localhost", "Database server host")
+	importCmd.Flags().Int("port", 5432, "Database server port")
+	importCmd.Flags().String("user", "", "Database username (required)")
+	importCmd.Flags().String("password", "", "Database password")
+	importCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	importCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	importCmd.Flags().String("target-db", "", "Database to load into (required)")
+
+	// Import options
+	importCmd.Flags().String("table", "", "Table to load every file into (default: from each file name)")
+	importCmd.Flags().String("format", "", "File format: csv or parquet (default: from each file extension)")
+	importCmd.Flags().StringToString("map", map[string]string{}, "Map a file column to a table column (e.g., --map mail=email); an empty target skips the column")
+	importCmd.Flags().Bool("truncate", false, "Empty each table before loading it")
+	importCmd.Flags().Bool("freeze", true, "Load truncated tables with COPY FREEZE")
+	importCmd.Flags().Int("batch-size", dataset.DefaultImportBatchSize, "Rows sent in one COPY")
+	importCmd.Flags().Int("max-errors", 100, "Rejected rows allowed per file before its load is rolled back (-1 for no limit)")
+	importCmd.Flags().String("quarantine-dir", "", "Directory for rejected rows (default: next to each file)")
+	importCmd.Flags().Duration("timeout", 30*time.Minute, "Timeout for the import")
+
+	// Output options
+	importCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+	importCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("import")
+	config.RegisterOptions(
+		importTableOpt, importFormatOpt, importTruncateOpt, importFreezeOpt, importBatchSizeOpt,
+		importMaxErrorsOpt, importQuarantineOpt, importTimeoutOpt,
+	)
+}
+
+// Import options, resolved through the shared options builder
+var (
+	importTableOpt      = config.Option{Key: "import.table", Flag: "table"}
+	importFormatOpt     = config.Option{Key: "import.format", Env: []string{"PGFORK_IMPORT_FORMAT"}, Flag: "format"}
+	importTruncateOpt   = config.Option{Key: "import.truncate", Env: []string{"PGFORK_IMPORT_TRUNCATE"}, Flag: "truncate"}
+	importFreezeOpt     = config.Option{Key: "import.freeze", Env: []string{"PGFORK_IMPORT_FREEZE"}, Flag: "freeze"}
+	importBatchSizeOpt  = config.Option{Key: "import.batch_size", Env: []string{"PGFORK_IMPORT_BATCH_SIZE"}, Flag: "batch-size"}
+	importMaxErrorsOpt  = config.Option{Key: "import.max_errors", Env: []string{"PGFORK_IMPORT_MAX_ERRORS"}, Flag: "max-errors"}
+	importQuarantineOpt = config.Option{Key: "import.quarantine_dir", Env: []string{"PGFORK_IMPORT_QUARANTINE_DIR"}, Flag: "quarantine-dir"}
+	importTimeoutOpt    = config.Option{Key: "import.timeout", Env: []string{"PGFORK_IMPORT_TIMEOUT"}, Flag: "timeout"}
+)
+
+func runImport(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	fail := func(err error) error {
+		return outputImportResult(&ImportResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet)
+	}
+
+	// The arguments are the files to import, so the database comes from --target-db
+	dbConfig, err := databaseConnection(builder, "import", nil)
+	if err != nil {
+		return fail(err)
+	}
+	if dbConfig.Database == "" {
+		return fail(fmt.Errorf("database is required (use --target-db or PGFORK_TARGET_DATABASE)"))
+	}
+
+	opts := dataset.ImportOptions{}
+	if opts.Table, err = builder.GetString(importTableOpt, ""); err != nil {
+		return fail(err)
+	}
+	formatName, err := builder.GetString(importFormatOpt, "")
+	if err != nil {
+		return fail(err)
+	}
+	if formatName != "" {
+		if opts.Format, err = dataset.ParseFormat(formatName); err != nil {
+			return fail(err)
+		}
+	}
+	if opts.Mapping, err = cmd.Flags().GetStringToString("map"); err != nil {
+		return fail(err)
+	}
+	if opts.Truncate, err = builder.GetBool(importTruncateOpt, false); err != nil {
+		return fail(err)
+	}
+	if opts.Freeze, err = builder.GetBool(importFreezeOpt, true); err != nil {
+		return fail(err)
+	}
+	if opts.BatchSize, err = builder.GetInt(importBatchSizeOpt, dataset.DefaultImportBatchSize); err != nil {
+		return fail(err)
+	}
+	if opts.MaxErrors, err = builder.GetInt(importMaxErrorsOpt, 100); err != nil {
+		return fail(err)
+	}
+	if opts.QuarantineDir, err = builder.GetString(importQuarantineOpt, ""); err != nil {
+		return fail(err)
+	}
+	timeout, err := builder.GetDuration(importTimeoutOpt, 30*time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_IMPORT_USER)"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := db.NewConnectionContext(ctx, dbConfig)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	files, err := dataset.Import(ctx, conn.DB, args, opts)
+	result := &ImportResult{
+		Format:   outputFormat,
+		Success:  err == nil,
+		Database: dbConfig.Database,
+		Files:    files,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		// Files before the failing one are committed, so report them too
+		result.Error = err.Error()
+		return outputImportResult(result, quiet)
+	}
+
+	var rows, rejected int64
+	for _, file := range files {
+		rows += file.Rows
+		rejected += file.Rejected
+	}
+	result.Message = fmt.Sprintf("Imported %d rows from %d files", rows, len(files))
+	if rejected > 0 {
+		result.Message += fmt.Sprintf(", %d rows quarantined", rejected)
+	}
+	return outputImportResult(result, quiet)
+}
+
+// importView renders the import result, with the quiet flag that text output needs.
+// Its JSON encoding is the ImportResult.
+type importView struct {
+	*ImportResult
+	quiet bool
+}
+
+// WriteText writes the rows loaded from each file, or nothing in quiet mode unless the import failed
+func (v importView) WriteText(w io.Writer) error {
+	if v.quiet && v.Success {
+		return nil
+	}
+
+	if v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	}
+	for _, file := range v.Files {
+		fmt.Fprintf(w, "  %s -> %s: %d rows", file.File, file.Table, file.Rows)
+		if file.Frozen {
+			fmt.Fprint(w, " (frozen)")
+		}
+		if file.Rejected > 0 {
+			fmt.Fprintf(w, ", %d rejected (%s)", file.Rejected, file.Quarantine)
+		}
+		fmt.Fprintln(w)
+	}
+	if v.Success {
+		fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+	}
+	return nil
+}
+
+// outputImportResult outputs the import result in the specified format
+func outputImportResult(result *ImportResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, importView{ImportResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
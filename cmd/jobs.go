@@ -1,12 +1,15 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
 
 	"github.com/spf13/cobra"
 )
@@ -139,13 +142,15 @@ func init() {
 	jobsCmd.AddCommand(jobsShowCmd)
 
 	// List command flags
-	jobsListCmd.Flags().String("output-format", "text", "Output format: text or json")
+	jobsListCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(jobsListCmd)
 	jobsListCmd.Flags().String("status", "", "Filter by status: running, paused, completed, failed")
 	jobsListCmd.Flags().Int("limit", 0, "Limit number of jobs shown (0 = no limit)")
 	jobsListCmd.Flags().String("state-dir", "", "Job state directory")
 
 	// Show command flags
-	jobsShowCmd.Flags().String("output-format", "text", "Output format: text or json")
+	jobsShowCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(jobsShowCmd)
 	jobsShowCmd.Flags().String("state-dir", "", "Job state directory")
 
 	// Global state-dir flag for other commands
@@ -156,6 +161,7 @@ func init() {
 
 func runJobsList(cmd *cobra.Command, args []string) error {
 	outputFormat, _ := cmd.Flags().GetString("output-format")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
 	statusFilter, _ := cmd.Flags().GetString("status")
 	limit, _ := cmd.Flags().GetInt("limit")
 	stateDir, _ := cmd.Flags().GetString("state-dir")
@@ -181,11 +187,7 @@ func runJobsList(cmd *cobra.Command, args []string) error {
 		jobs = jobs[:limit]
 	}
 
-	if outputFormat == "json" {
-		return outputJobsJSON(jobs)
-	}
-
-	return outputJobsText(jobs)
+	return output.Render(os.Stdout, outputFormat, jobList(jobs))
 }
 
 func runJobsCancel(cmd *cobra.Command, args []string) error {
@@ -227,6 +229,7 @@ func runJobsResume(cmd *cobra.Command, args []string) error {
 func runJobsShow(cmd *cobra.Command, args []string) error {
 	jobID := args[0]
 	outputFormat, _ := cmd.Flags().GetString("output-format")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
 	stateDir, _ := cmd.Flags().GetString("state-dir")
 
 	job, err := getJobByID(stateDir, jobID)
@@ -234,38 +237,23 @@ func runJobsShow(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get job %s: %w", jobID, err)
 	}
 
-	if outputFormat == "json" {
-		jsonOutput, err := json.MarshalIndent(job, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal job: %w", err)
-		}
-		fmt.Println(string(jsonOutput))
-	} else {
-		printJobDetails(job)
-	}
-
-	return nil
+	return output.Render(os.Stdout, outputFormat, (*jobDetails)(job))
 }
 
-func outputJobsJSON(jobs []fork.JobState) error {
-	jsonOutput, err := json.MarshalIndent(jobs, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal jobs: %w", err)
-	}
-	fmt.Println(string(jsonOutput))
-	return nil
-}
+// jobList renders the jobs of jobs list
+type jobList []fork.JobState
 
-func outputJobsText(jobs []fork.JobState) error {
+// WriteText writes the jobs as a table
+func (jobs jobList) WriteText(w io.Writer) error {
 	if len(jobs) == 0 {
-		fmt.Println("No jobs found")
+		fmt.Fprintln(w, "No jobs found")
 		return nil
 	}
 
 	// Print header
-	fmt.Printf("%-20s %-10s %-8s %-19s %-19s %-50s\n",
+	fmt.Fprintf(w, "%-20s %-10s %-8s %-19s %-19s %-50s\n",
 		"JOB ID", "STATUS", "PROGRESS", "STARTED", "LAST UPDATED", "SOURCE → TARGET")
-	fmt.Printf("%s\n", strings.Repeat("-", 120))
+	fmt.Fprintf(w, "%s\n", strings.Repeat("-", 120))
 
 	for _, job := range jobs {
 		progress := calculateProgress(&job)
@@ -276,56 +264,152 @@ func outputJobsText(jobs []fork.JobState) error {
 			job.SourceConfig.Database)
 		target := fmt.Sprintf("%s → %s", source, job.TargetDatabase)
 
-		fmt.Printf("%-20s %-10s %6.1f%% %-19s %-19s %-50s\n",
-			truncateString(job.JobID, 20),
-			getJobStatusIcon(job.Status)+job.Status,
+		fmt.Fprintf(w, "%-20s %-10s %6.1f%% %-19s %-19s %-50s\n",
+			output.Truncate(job.JobID, 20),
+			output.StatusIcon(job.Status)+" "+job.Status,
 			progress,
 			job.StartTime.Format("2006-01-02 15:04:05"),
 			job.LastUpdated.Format("2006-01-02 15:04:05"),
-			truncateString(target, 50))
+			output.Truncate(target, 50))
 	}
 
-	fmt.Printf("\nTotal: %d jobs\n", len(jobs))
+	fmt.Fprintf(w, "\nTotal: %d jobs\n", len(jobs))
 	return nil
 }
 
-func printJobDetails(job *fork.JobState) {
-	fmt.Printf("Job ID: %s\n", job.JobID)
-	fmt.Printf("Status: %s %s\n", getJobStatusIcon(job.Status), job.Status)
-	fmt.Printf("Phase: %s\n", job.Phase)
-	fmt.Printf("Progress: %.1f%%\n", calculateProgress(job))
-	fmt.Printf("Started: %s\n", job.StartTime.Format(time.RFC3339))
-	fmt.Printf("Last Updated: %s\n", job.LastUpdated.Format(time.RFC3339))
-	fmt.Println()
+// WritePorcelain writes a job record for each job
+func (jobs jobList) WritePorcelain(w io.Writer) {
+	for i := range jobs {
+		writeJobPorcelain(w, &jobs[i])
+	}
+}
 
-	fmt.Printf("Source: %s@%s:%d/%s\n",
+// Outcome reports success, as listing jobs that could be read cannot fail
+func (jobs jobList) Outcome() (bool, string) {
+	return true, ""
+}
+
+// writeJobPorcelain writes a job as a porcelain record:
+//
+//	job	<id>	<status>	<phase>	<progress %>	<started>	<last updated>	<source database>	<target database>	<error>	<ci run url>
+//
+// Times are RFC 3339.
+func writeJobPorcelain(w io.Writer, job *fork.JobState) {
+	var runURL string
+	if job.CI != nil {
+		runURL = job.CI.RunURL
+	}
+	output.WritePorcelain(w, "job",
+		job.JobID,
+		job.Status,
+		job.Phase,
+		fmt.Sprintf("%.1f", calculateProgress(job)),
+		job.StartTime.Format(time.RFC3339),
+		job.LastUpdated.Format(time.RFC3339),
+		job.SourceConfig.Database,
+		job.TargetDatabase,
+		job.Error,
+		runURL)
+}
+
+// jobDetails renders the job of jobs show
+type jobDetails fork.JobState
+
+// WriteText writes the job's progress, tables and error
+func (d *jobDetails) WriteText(w io.Writer) error {
+	job := (*fork.JobState)(d)
+	fmt.Fprintf(w, "Job ID: %s\n", job.JobID)
+	fmt.Fprintf(w, "Status: %s %s\n", output.StatusIcon(job.Status), job.Status)
+	fmt.Fprintf(w, "Phase: %s\n", job.Phase)
+	fmt.Fprintf(w, "Progress: %.1f%%\n", calculateProgress(job))
+	fmt.Fprintf(w, "Started: %s\n", job.StartTime.Format(time.RFC3339))
+	fmt.Fprintf(w, "Last Updated: %s\n", job.LastUpdated.Format(time.RFC3339))
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Source: %s@%s:%d/%s\n",
 		job.SourceConfig.Username,
 		job.SourceConfig.Host,
 		job.SourceConfig.Port,
 		job.SourceConfig.Database)
-	fmt.Printf("Target: %s\n", job.TargetDatabase)
-	fmt.Println()
+	fmt.Fprintf(w, "Target: %s\n", job.TargetDatabase)
+	if job.CI != nil {
+		fmt.Fprintf(w, "CI: %s\n", job.CI)
+		if job.CI.Commit != "" {
+			fmt.Fprintf(w, "Commit: %s\n", job.CI.Commit)
+		}
+		if job.CI.Actor != "" {
+			fmt.Fprintf(w, "Actor: %s\n", job.CI.Actor)
+		}
+	}
+	fmt.Fprintln(w)
+
+	if job.Config != nil {
+		fmt.Fprintln(w, "Configuration:")
+		fmt.Fprintf(w, "  Source: %s\n", job.Config.Source.Redacted())
+		fmt.Fprintf(w, "  Destination: %s\n", job.Config.Destination.Redacted())
+		for _, line := range fork.NewPlan(job.Config).Describe() {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		fmt.Fprintln(w)
+	}
 
-	fmt.Printf("Schema Completed: %s\n", getJobBoolIcon(job.SchemaCompleted))
-	fmt.Printf("Indexes Completed: %s\n", getJobBoolIcon(job.IndexesCompleted))
-	fmt.Printf("Completed Tables: %d\n", len(job.CompletedTables))
-	fmt.Printf("Failed Tables: %d\n", len(job.FailedTables))
-	fmt.Printf("Total Tables: %d\n", len(job.TableRowCounts))
-	fmt.Println()
+	fmt.Fprintf(w, "Schema Completed: %s\n", output.BoolIcon(job.SchemaCompleted))
+	fmt.Fprintf(w, "Indexes Completed: %s\n", output.BoolIcon(job.IndexesCompleted))
+	fmt.Fprintf(w, "Completed Tables: %d\n", len(job.CompletedTables))
+	fmt.Fprintf(w, "Failed Tables: %d\n", len(job.FailedTables))
+	fmt.Fprintf(w, "Total Tables: %d\n", len(job.TableRowCounts))
+	fmt.Fprintln(w)
+
+	if len(job.Phases) > 0 {
+		fmt.Fprintln(w, "Phases:")
+		for _, phase := range job.Phases {
+			fmt.Fprintf(w, "  %s: %s\n", phase.Name, phase.Duration)
+		}
+		fmt.Fprintln(w)
+	}
 
 	if len(job.FailedTables) > 0 {
-		fmt.Println("Failed Tables:")
-		for table, err := range job.FailedTables {
-			fmt.Printf("  %s: %s\n", table, err)
+		fmt.Fprintln(w, "Failed Tables:")
+		for _, table := range failedTables(job) {
+			fmt.Fprintf(w, "  %s: %s\n", table, job.FailedTables[table])
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	if job.Error != "" {
-		fmt.Printf("Error: %s\n", job.Error)
+		fmt.Fprintf(w, "Error: %s\n", job.Error)
+	}
+	return nil
+}
+
+// WritePorcelain writes the job record, a phase record per phase and a failed-table
+// record per failed table
+func (d *jobDetails) WritePorcelain(w io.Writer) {
+	job := (*fork.JobState)(d)
+	writeJobPorcelain(w, job)
+	for _, phase := range job.Phases {
+		output.WritePorcelain(w, "phase", phase.Name, phase.DurationMs)
+	}
+	for _, table := range failedTables(job) {
+		output.WritePorcelain(w, "failed-table", table, job.FailedTables[table])
 	}
 }
 
+// Outcome reports success, as the job was found
+func (d *jobDetails) Outcome() (bool, string) {
+	return true, ""
+}
+
+// failedTables returns the names of the tables a job failed to copy, sorted
+func failedTables(job *fork.JobState) []string {
+	tables := make([]string, 0, len(job.FailedTables))
+	for table := range job.FailedTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
 func calculateProgress(job *fork.JobState) float64 {
 	totalTables := len(job.TableRowCounts)
 	if totalTables == 0 {
@@ -403,34 +487,3 @@ func updateJobStatus(stateDir, jobID, newStatus string) error {
 		return fmt.Errorf("unsupported status update: %s", newStatus)
 	}
 }
-
-func getJobStatusIcon(status string) string {
-	switch status {
-	case "running":
-		return "🏃 "
-	case "paused":
-		return "⏸️ "
-	case "completed":
-		return "✅ "
-	case "failed":
-		return "❌ "
-	case "cancelled":
-		return "🛑 "
-	default:
-		return "❓ "
-	}
-}
-
-func getJobBoolIcon(value bool) string {
-	if value {
-		return "✅ Yes"
-	}
-	return "❌ No"
-}
-
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen-3] + "..."
-}
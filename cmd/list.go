@@ -1,28 +1,31 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // DatabaseInfo represents information about a database
 type DatabaseInfo struct {
-	Name       string `json:"name"`
-	Size       string `json:"size,omitempty"`
-	SizeBytes  int64  `json:"size_bytes,omitempty"`
-	Age        string `json:"age,omitempty"`
-	AgeSeconds int64  `json:"age_seconds,omitempty"`
-	Owner      string `json:"owner,omitempty"`
+	Name       string      `json:"name"`
+	Size       string      `json:"size,omitempty"`
+	SizeBytes  int64       `json:"size_bytes,omitempty"`
+	Age        string      `json:"age,omitempty"`
+	AgeSeconds int64       `json:"age_seconds,omitempty"`
+	Owner      string      `json:"owner,omitempty"`
+	Lineage    *db.Lineage `json:"lineage,omitempty"`
 }
 
 // ListResult represents the result of a list operation
@@ -58,6 +61,9 @@ Examples:
   # JSON output for CI/CD scripts
   postgres-db-fork list --pattern "myapp_*" --output-format json
 
+  # Show where each fork came from
+  postgres-db-fork list --pattern "myapp_*" --show-lineage
+
   # Show database age information
   postgres-db-fork list --pattern "temp_*" --show-age --older-than 7d`,
 	RunE: runList,
@@ -71,7 +77,9 @@ func init() {
 	listCmd.Flags().Int("port", 5432, "Database server port")
 	listCmd.Flags().String("user", "", "Database username (required)")
 	listCmd.Flags().String("password", "", "Database password")
+	listCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
 	listCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	listCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
 
 	// Filtering options
 	listCmd.Flags().String("pattern", "*", "Database name pattern (supports wildcards)")
@@ -83,105 +91,116 @@ func init() {
 	listCmd.Flags().Bool("show-size", false, "Include database size information")
 	listCmd.Flags().Bool("show-age", false, "Include database age information")
 	listCmd.Flags().Bool("show-owner", false, "Include database owner information")
+	listCmd.Flags().Bool("show-lineage", false, "Include the source, job and tool version recorded when each fork was made")
 	listCmd.Flags().String("sort-by", "name", "Sort by: name, size, age")
 	listCmd.Flags().Bool("reverse", false, "Reverse sort order")
 
 	// Output options
-	listCmd.Flags().String("output-format", "text", "Output format: text or json")
+	listCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(listCmd)
 	listCmd.Flags().Bool("quiet", false, "Suppress output except database names (or JSON)")
 	listCmd.Flags().Bool("count-only", false, "Only output the count of matching databases")
+	listCmd.Flags().Duration("timeout", 5*time.Minute, "Overall timeout for the listing queries")
+	listCmd.Flags().Duration("cache-ttl", 0, "Reuse database sizes read within this long (0 disables the metadata cache)")
+	listCmd.Flags().String("cache-dir", "", "Directory of the metadata cache (default: system temp directory)")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("list")
+	config.RegisterOptions(
+		listPatternOpt, listExcludeOpt, listOlderThanOpt, listNewerThanOpt, listShowSizeOpt,
+		listShowAgeOpt, listShowOwnerOpt, listLineageOpt, listSortByOpt, listReverseOpt,
+		listOutputOpt, listQuietOpt, listCountOnlyOpt, listTimeoutOpt,
+	)
+}
 
-	// Mark required flags
-	if err := listCmd.MarkFlagRequired("user"); err != nil {
-		panic(fmt.Sprintf("Failed to mark flag as required: %v", err))
-	}
+// List options, resolved through the shared options builder
+var (
+	listPatternOpt   = config.Option{Key: "list.pattern", Env: []string{"PGFORK_LIST_PATTERN"}, Flag: "pattern"}
+	listExcludeOpt   = config.Option{Key: "list.exclude", Env: []string{"PGFORK_LIST_EXCLUDE"}, Flag: "exclude"}
+	listOlderThanOpt = config.Option{Key: "list.older_than", Env: []string{"PGFORK_LIST_OLDER_THAN"}, Flag: "older-than"}
+	listNewerThanOpt = config.Option{Key: "list.newer_than", Env: []string{"PGFORK_LIST_NEWER_THAN"}, Flag: "newer-than"}
+	listShowSizeOpt  = config.Option{Key: "list.show_size", Flag: "show-size"}
+	listShowAgeOpt   = config.Option{Key: "list.show_age", Flag: "show-age"}
+	listShowOwnerOpt = config.Option{Key: "list.show_owner", Flag: "show-owner"}
+	listLineageOpt   = config.Option{Key: "list.show_lineage", Flag: "show-lineage"}
+	listSortByOpt    = config.Option{Key: "list.sort_by", Flag: "sort-by"}
+	listReverseOpt   = config.Option{Key: "list.reverse", Flag: "reverse"}
+	listOutputOpt    = config.Option{Key: "list.output_format", Env: []string{"PGFORK_OUTPUT_FORMAT", "PGFORK_LIST_OUTPUT_FORMAT"}, Flag: "output-format"}
+	listQuietOpt     = config.Option{Key: "list.quiet", Env: []string{"PGFORK_QUIET", "PGFORK_LIST_QUIET"}, Flag: "quiet"}
+	listCountOnlyOpt = config.Option{Key: "list.count_only", Flag: "count-only"}
+	listTimeoutOpt   = config.Option{Key: "list.timeout", Env: []string{"PGFORK_LIST_TIMEOUT"}, Flag: "timeout"}
+)
 
-	// Bind to viper
-	if err := viper.BindPFlag("list.host", listCmd.Flags().Lookup("host")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.port", listCmd.Flags().Lookup("port")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.user", listCmd.Flags().Lookup("user")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.password", listCmd.Flags().Lookup("password")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.sslmode", listCmd.Flags().Lookup("sslmode")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.pattern", listCmd.Flags().Lookup("pattern")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.exclude", listCmd.Flags().Lookup("exclude")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.older_than", listCmd.Flags().Lookup("older-than")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.newer_than", listCmd.Flags().Lookup("newer-than")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
-	}
-	if err := viper.BindPFlag("list.show_size", listCmd.Flags().Lookup("show-size")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+func runList(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
 	}
-	if err := viper.BindPFlag("list.show_age", listCmd.Flags().Lookup("show-age")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+
+	outputFormat, _ := builder.GetString(listOutputOpt, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(listQuietOpt, false)
+	countOnly, _ := builder.GetBool(listCountOnlyOpt, false)
+	fail := func(err error) error {
+		return outputListResult(&ListResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet, countOnly)
 	}
-	if err := viper.BindPFlag("list.show_owner", listCmd.Flags().Lookup("show-owner")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+
+	// Build database configuration (connect to the admin database)
+	dbConfig, err := builder.BuildConnection(config.ServerConnection("list"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("list.sort_by", listCmd.Flags().Lookup("sort-by")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	*dbConfig = dbConfig.Admin()
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("list.reverse", listCmd.Flags().Lookup("reverse")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_LIST_USER)"))
 	}
-	if err := viper.BindPFlag("list.output_format", listCmd.Flags().Lookup("output-format")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+
+	// Get list parameters
+	pattern, err := builder.GetString(listPatternOpt, "*")
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("list.quiet", listCmd.Flags().Lookup("quiet")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	exclude, err := builder.GetStringSlice(listExcludeOpt, nil)
+	if err != nil {
+		return fail(err)
 	}
-	if err := viper.BindPFlag("list.count_only", listCmd.Flags().Lookup("count-only")); err != nil {
-		fmt.Printf("Failed to bind flag: %v\n", err)
+	olderThan, err := builder.GetDuration(listOlderThanOpt, 0)
+	if err != nil {
+		return fail(err)
 	}
-}
-
-func runList(cmd *cobra.Command, args []string) error {
-	start := time.Now()
-
-	// Load configuration from environment variables
-	loadListFromEnvironment()
-
-	// Build database configuration
-	dbConfig := &config.DatabaseConfig{
-		Host:     viper.GetString("list.host"),
-		Port:     viper.GetInt("list.port"),
-		Username: viper.GetString("list.user"),
-		Password: viper.GetString("list.password"),
-		Database: "postgres", // Connect to postgres database for admin operations
-		SSLMode:  viper.GetString("list.sslmode"),
+	newerThan, err := builder.GetDuration(listNewerThanOpt, 0)
+	if err != nil {
+		return fail(err)
+	}
+	showSize, _ := builder.GetBool(listShowSizeOpt, false)
+	showAge, _ := builder.GetBool(listShowAgeOpt, false)
+	showOwner, _ := builder.GetBool(listShowOwnerOpt, false)
+	showLineage, _ := builder.GetBool(listLineageOpt, false)
+	sortBy, _ := builder.GetString(listSortByOpt, "name")
+	reverse, _ := builder.GetBool(listReverseOpt, false)
+	timeout, err := builder.GetDuration(listTimeoutOpt, 5*time.Minute)
+	if err != nil {
+		return fail(err)
 	}
 
-	// Get list parameters
-	pattern := viper.GetString("list.pattern")
-	exclude := viper.GetStringSlice("list.exclude")
-	olderThan := viper.GetDuration("list.older_than")
-	newerThan := viper.GetDuration("list.newer_than")
-	showSize := viper.GetBool("list.show_size")
-	showAge := viper.GetBool("list.show_age")
-	showOwner := viper.GetBool("list.show_owner")
-	sortBy := viper.GetString("list.sort_by")
-	reverse := viper.GetBool("list.reverse")
-	outputFormat := viper.GetString("list.output_format")
-	quiet := viper.GetBool("list.quiet")
-	countOnly := viper.GetBool("list.count_only")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
 	// Connect to database
-	conn, err := db.NewConnection(dbConfig)
+	conn, err := db.NewConnectionContext(ctx, dbConfig)
 	if err != nil {
 		return outputListResult(&ListResult{
 			Format:  outputFormat,
@@ -194,9 +213,12 @@ func runList(cmd *cobra.Command, args []string) error {
 			fmt.Printf("Warning: Failed to close connection: %v\n", err)
 		}
 	}()
+	if err := attachMetadataCache(builder, conn); err != nil {
+		return fail(err)
+	}
 
 	// Find matching databases
-	databases, err := findDatabasesWithInfo(conn, pattern, exclude, showSize, showAge, showOwner)
+	databases, err := findDatabasesWithInfo(ctx, conn, pattern, exclude, showSize, showAge, showOwner)
 	if err != nil {
 		return outputListResult(&ListResult{
 			Format:  outputFormat,
@@ -204,6 +226,11 @@ func runList(cmd *cobra.Command, args []string) error {
 			Error:   fmt.Sprintf("Failed to query databases: %v", err),
 		}, quiet, countOnly)
 	}
+	if showLineage {
+		if err := addLineage(ctx, conn, databases); err != nil {
+			return fail(err)
+		}
+	}
 
 	// Filter by age if specified
 	if olderThan > 0 || newerThan > 0 {
@@ -230,30 +257,8 @@ func runList(cmd *cobra.Command, args []string) error {
 	return outputListResult(result, quiet, countOnly)
 }
 
-// loadListFromEnvironment loads list configuration from environment variables
-func loadListFromEnvironment() {
-	if host := os.Getenv("PGFORK_LIST_HOST"); host != "" {
-		viper.Set("list.host", host)
-	}
-	if port := os.Getenv("PGFORK_LIST_PORT"); port != "" {
-		viper.Set("list.port", port)
-	}
-	if user := os.Getenv("PGFORK_LIST_USER"); user != "" {
-		viper.Set("list.user", user)
-	}
-	if password := os.Getenv("PGFORK_LIST_PASSWORD"); password != "" {
-		viper.Set("list.password", password)
-	}
-	if sslmode := os.Getenv("PGFORK_LIST_SSLMODE"); sslmode != "" {
-		viper.Set("list.sslmode", sslmode)
-	}
-	if pattern := os.Getenv("PGFORK_LIST_PATTERN"); pattern != "" {
-		viper.Set("list.pattern", pattern)
-	}
-}
-
 // findDatabasesWithInfo finds databases with optional metadata
-func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string, showSize, showAge, showOwner bool) ([]DatabaseInfo, error) {
+func findDatabasesWithInfo(ctx context.Context, conn *db.Connection, pattern string, exclude []string, showSize, showAge, showOwner bool) ([]DatabaseInfo, error) {
 	// Convert wildcard pattern to regex
 	regexPattern := strings.ReplaceAll(pattern, "*", ".*")
 	regexPattern = strings.ReplaceAll(regexPattern, "?", ".")
@@ -268,12 +273,16 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 		excludeMap[name] = true
 	}
 
+	// Sizes come from the metadata cache when there is one, and otherwise from the
+	// listing query
+	inlineSize := showSize && conn.Cache == nil
+
 	// Build query
 	query := `
 		SELECT
 			d.datname`
 
-	if showSize {
+	if inlineSize {
 		query += `,
 			pg_database_size(d.datname) as size_bytes`
 	}
@@ -289,7 +298,7 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 		  AND d.datname NOT IN ('postgres', 'template0', 'template1')
 		ORDER BY d.datname`
 
-	rows, err := conn.DB.Query(query)
+	rows, err := conn.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -308,7 +317,7 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 		// Prepare scan arguments
 		scanArgs := []interface{}{&dbInfo.Name}
 
-		if showSize {
+		if inlineSize {
 			scanArgs = append(scanArgs, &sizeBytes)
 		}
 		if showOwner {
@@ -325,9 +334,16 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 		}
 
 		// Add size information
+		if showSize && !inlineSize {
+			size, err := conn.GetDatabaseSizeContext(ctx, dbInfo.Name)
+			if err != nil {
+				return nil, err
+			}
+			sizeBytes = &size
+		}
 		if showSize && sizeBytes != nil {
 			dbInfo.SizeBytes = *sizeBytes
-			dbInfo.Size = formatBytes(*sizeBytes)
+			dbInfo.Size = output.FormatBytes(*sizeBytes)
 		}
 
 		// Add owner information
@@ -337,10 +353,10 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 
 		// Add age information if requested
 		if showAge {
-			age, err := getDatabaseAge(conn, dbInfo.Name)
+			age, err := getDatabaseAge(ctx, conn, dbInfo.Name)
 			if err == nil {
 				dbInfo.AgeSeconds = int64(age.Seconds())
-				dbInfo.Age = formatDuration(age)
+				dbInfo.Age = output.FormatAge(age)
 			}
 		}
 
@@ -350,6 +366,20 @@ func findDatabasesWithInfo(conn *db.Connection, pattern string, exclude []string
 	return databases, rows.Err()
 }
 
+// addLineage attaches the recorded lineage to the databases that have one
+func addLineage(ctx context.Context, conn *db.Connection, databases []DatabaseInfo) error {
+	lineages, err := conn.LineagesContext(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range databases {
+		if lineage, ok := lineages[databases[i].Name]; ok {
+			databases[i].Lineage = &lineage
+		}
+	}
+	return nil
+}
+
 // filterDatabasesByAge filters databases by age criteria
 func filterDatabasesByAge(databases []DatabaseInfo, olderThan, newerThan time.Duration) []DatabaseInfo {
 	var filtered []DatabaseInfo
@@ -374,83 +404,128 @@ func sortDatabases(databases []DatabaseInfo, sortBy string, reverse bool) {
 	// For now, keeping it simple since databases are already sorted by name
 }
 
-// formatBytes converts bytes to human readable format
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// formatLineage describes where a fork came from in one line
+func formatLineage(lineage *db.Lineage) string {
+	source := lineage.Source
+	if lineage.SourceHost != "" {
+		source = lineage.SourceHost + "/" + source
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	text := fmt.Sprintf("forked from %s at %s", source, lineage.ForkedAt.Format(time.RFC3339))
+	if lineage.JobID != "" {
+		text += fmt.Sprintf(" job:%s", lineage.JobID)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	if lineage.ToolVersion != "" {
+		text += fmt.Sprintf(" version:%s", lineage.ToolVersion)
+	}
+	if lineage.PullRequest > 0 {
+		text += fmt.Sprintf(" pr:%d", lineage.PullRequest)
+	}
+	if lineage.ExpiresAt != nil {
+		text += fmt.Sprintf(" expires:%s", lineage.ExpiresAt.Format(time.RFC3339))
+	}
+	if lineage.CI != nil {
+		text += fmt.Sprintf(" ci:%s", lineage.CI)
+	}
+	return text
 }
 
-// formatDuration formats a duration in human-readable format
-func formatDuration(d time.Duration) string {
-	days := int(d.Hours() / 24)
-	hours := int(d.Hours()) % 24
-	minutes := int(d.Minutes()) % 60
-
-	if days > 0 {
-		return fmt.Sprintf("%dd %dh", days, hours)
-	} else if hours > 0 {
-		return fmt.Sprintf("%dh %dm", hours, minutes)
-	} else {
-		return fmt.Sprintf("%dm", minutes)
-	}
+// listView renders a list result, with the flags that pick what text and porcelain
+// output show. Its JSON encoding is the ListResult.
+type listView struct {
+	*ListResult
+	quiet     bool
+	countOnly bool
 }
 
-// outputListResult outputs the list result in the specified format
-func outputListResult(result *ListResult, quiet, countOnly bool) error {
-	if result.Format == "json" {
-		jsonOutput, err := json.MarshalIndent(result, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal JSON output: %w", err)
+// WriteText writes the matching databases with their details, only their names in
+// quiet mode, or only their count
+func (v listView) WriteText(w io.Writer) error {
+	if v.countOnly {
+		fmt.Fprintln(w, v.Count)
+		return nil
+	}
+	if v.quiet {
+		for _, db := range v.Databases {
+			fmt.Fprintln(w, db.Name)
 		}
-		fmt.Println(string(jsonOutput))
-	} else {
-		// Text output
-		if countOnly {
-			fmt.Println(result.Count)
-		} else if quiet {
-			// Quiet mode - only database names
-			for _, db := range result.Databases {
-				fmt.Println(db.Name)
+		return nil
+	}
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+
+	if v.Message != "" {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	}
+	if len(v.Databases) > 0 {
+		fmt.Fprintln(w, "\nDatabases:")
+		for _, db := range v.Databases {
+			line := fmt.Sprintf("  - %s", db.Name)
+			if db.Size != "" {
+				line += fmt.Sprintf(" (%s)", db.Size)
 			}
-		} else {
-			// Full text output
-			if !result.Success {
-				fmt.Printf("❌ %s\n", result.Error)
-			} else {
-				if result.Message != "" {
-					fmt.Printf("✅ %s\n", result.Message)
-				}
+			if db.Age != "" {
+				line += fmt.Sprintf(" [%s old]", db.Age)
+			}
+			if db.Owner != "" {
+				line += fmt.Sprintf(" owner:%s", db.Owner)
+			}
+			if db.Lineage != nil {
+				line += " " + formatLineage(db.Lineage)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
 
-				if len(result.Databases) > 0 {
-					fmt.Println("\nDatabases:")
-					for _, db := range result.Databases {
-						line := fmt.Sprintf("  - %s", db.Name)
-						if db.Size != "" {
-							line += fmt.Sprintf(" (%s)", db.Size)
-						}
-						if db.Age != "" {
-							line += fmt.Sprintf(" [%s old]", db.Age)
-						}
-						if db.Owner != "" {
-							line += fmt.Sprintf(" owner:%s", db.Owner)
-						}
-						fmt.Println(line)
-					}
-				}
+	fmt.Fprintf(w, "\nTotal: %d databases\n", v.Count)
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
 
-				fmt.Printf("\nTotal: %d databases\n", result.Count)
-				fmt.Printf("Duration: %s\n", result.Duration)
+// WritePorcelain writes the list result as porcelain records:
+//
+//	database	<name>	<size bytes>	<age seconds>	<owner>	<source>	<job id>	<ci run url>
+//	count	<databases>
+//
+// Fields of details that were not requested are empty; source, job id and CI run URL
+// come from the recorded lineage.
+func (v listView) WritePorcelain(w io.Writer) {
+	if !v.Success {
+		return
+	}
+	if !v.countOnly {
+		for _, info := range v.Databases {
+			var size, age, source, jobID, runURL string
+			if info.Size != "" {
+				size = strconv.FormatInt(info.SizeBytes, 10)
+			}
+			if info.Age != "" {
+				age = strconv.FormatInt(info.AgeSeconds, 10)
+			}
+			if info.Lineage != nil {
+				source, jobID = info.Lineage.Source, info.Lineage.JobID
+				if info.Lineage.CI != nil {
+					runURL = info.Lineage.CI.RunURL
+				}
 			}
+			output.WritePorcelain(w, "database", info.Name, size, age, info.Owner, source, jobID, runURL)
 		}
 	}
+	output.WritePorcelain(w, "count", v.Count)
+}
+
+// Outcome reports whether the databases could be listed
+func (v listView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputListResult outputs the list result in the specified format
+func outputListResult(result *ListResult, quiet, countOnly bool) error {
+	view := listView{ListResult: result, quiet: quiet, countOnly: countOnly}
+	if err := output.Render(os.Stdout, result.Format, view); err != nil {
+		return err
+	}
 
 	// Set exit code based on results
 	if !result.Success {
@@ -1,13 +1,15 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
 
 	"github.com/spf13/cobra"
 )
@@ -32,6 +34,8 @@ type MetricsSummary struct {
 	AverageDuration      time.Duration `json:"average_duration"`
 	TotalDataMoved       int64         `json:"total_data_moved_bytes"`
 	TotalTablesProcessed int           `json:"total_tables_processed"`
+	// Provisional is set when the totals include jobs that are still running
+	Provisional bool `json:"provisional"`
 }
 
 // JobMetric represents metrics for a single job
@@ -48,6 +52,13 @@ type JobMetric struct {
 	ErrorCount      int           `json:"error_count"`
 	Source          string        `json:"source"`
 	Target          string        `json:"target"`
+	// Provisional is set for running jobs, whose numbers come from their last
+	// heartbeat and will change
+	Provisional     bool          `json:"provisional"`
+	LastHeartbeat   *time.Time    `json:"last_heartbeat,omitempty"`
+	HeartbeatStale  bool          `json:"heartbeat_stale,omitempty"`
+	PercentComplete float64       `json:"percent_complete,omitempty"`
+	ETA             time.Duration `json:"eta,omitempty"`
 }
 
 // PerformanceStats provides performance analytics
@@ -106,14 +117,18 @@ Examples:
   postgres-db-fork metrics --detailed
 
   # Show only performance summary
-  postgres-db-fork metrics --summary-only`,
+  postgres-db-fork metrics --summary-only
+
+Running jobs are reported with the throughput and ETA of their last heartbeat.
+These numbers are provisional: they are marked as such in both text and JSON
+output, and jobs whose heartbeat has stopped are flagged as stale.`,
 	RunE: runMetrics,
 }
 
 func init() {
 	rootCmd.AddCommand(metricsCmd)
 
-	metricsCmd.Flags().String("output-format", "text", "Output format: text or json")
+	metricsCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
 	metricsCmd.Flags().String("period", "7d", "Time period for metrics (1d, 7d, 30d, 90d)")
 	metricsCmd.Flags().Bool("detailed", false, "Show detailed job breakdowns")
 	metricsCmd.Flags().Bool("summary-only", false, "Show only summary statistics")
@@ -142,11 +157,7 @@ func runMetrics(cmd *cobra.Command, args []string) error {
 	}
 
 	// Output results
-	if outputFormat == "json" {
-		return outputMetricsJSON(report)
-	}
-
-	return outputMetricsText(report, detailed, summaryOnly)
+	return output.Render(os.Stdout, outputFormat, metricsView{MetricsReport: report, detailed: detailed, summaryOnly: summaryOnly})
 }
 
 func parsePeriod(period string) (time.Duration, error) {
@@ -183,7 +194,7 @@ func generateMetricsReport(stateDir string, period time.Duration, includeTrends
 	// Convert to job metrics
 	jobMetrics := make([]JobMetric, len(filteredJobs))
 	for i, job := range filteredJobs {
-		jobMetrics[i] = convertToJobMetric(&job)
+		jobMetrics[i] = convertToJobMetric(&job, time.Now())
 	}
 
 	// Generate report
@@ -202,7 +213,7 @@ func generateMetricsReport(stateDir string, period time.Duration, includeTrends
 	return report, nil
 }
 
-func convertToJobMetric(job *fork.JobState) JobMetric {
+func convertToJobMetric(job *fork.JobState, now time.Time) JobMetric {
 	metric := JobMetric{
 		JobID:           job.JobID,
 		Status:          job.Status,
@@ -219,7 +230,8 @@ func convertToJobMetric(job *fork.JobState) JobMetric {
 		metric.EndTime = &endTime
 		metric.Duration = endTime.Sub(job.StartTime)
 	} else {
-		metric.Duration = time.Since(job.StartTime)
+		metric.Duration = now.Sub(job.StartTime)
+		metric.Provisional = true
 	}
 
 	// Estimate data transferred (simplified calculation)
@@ -232,6 +244,10 @@ func convertToJobMetric(job *fork.JobState) JobMetric {
 		metric.TransferRate = mbTransferred / seconds
 	}
 
+	if metric.Provisional && job.Checkpoint != nil {
+		applyCheckpoint(&metric, job, now)
+	}
+
 	// Count errors
 	metric.ErrorCount = len(job.FailedTables)
 	if job.Error != "" {
@@ -241,6 +257,33 @@ func convertToJobMetric(job *fork.JobState) JobMetric {
 	return metric
 }
 
+// applyCheckpoint replaces the estimates of a running job with the live progress of
+// its last heartbeat, measuring throughput up to the heartbeat rather than up to now
+func applyCheckpoint(metric *JobMetric, job *fork.JobState, now time.Time) {
+	checkpoint := job.Checkpoint
+	heartbeat := checkpoint.Time
+	metric.LastHeartbeat = &heartbeat
+	metric.HeartbeatStale = checkpoint.Stale(now)
+	metric.DataTransferred = checkpoint.BytesTransferred
+	metric.TransferRate = 0
+	metric.ETA = 0
+
+	elapsed := checkpoint.Time.Sub(job.StartTime).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	bytesPerSecond := float64(checkpoint.BytesTransferred) / elapsed
+	metric.TransferRate = bytesPerSecond / (1024 * 1024)
+
+	if checkpoint.BytesTotal > 0 {
+		metric.PercentComplete = min(float64(checkpoint.BytesTransferred)/float64(checkpoint.BytesTotal)*100, 100)
+		// A job whose heartbeat stopped is not going to finish on schedule
+		if remaining := checkpoint.BytesTotal - checkpoint.BytesTransferred; remaining > 0 && bytesPerSecond > 0 && !metric.HeartbeatStale {
+			metric.ETA = time.Duration(float64(remaining) / bytesPerSecond * float64(time.Second))
+		}
+	}
+}
+
 func estimateDataTransferred(job *fork.JobState) int64 {
 	// Simplified estimation based on table row counts
 	// In a real implementation, this would track actual bytes transferred
@@ -276,6 +319,10 @@ func calculateSummary(metrics []JobMetric) MetricsSummary {
 			summary.RunningJobs++
 		}
 
+		if metric.Provisional {
+			summary.Provisional = true
+		}
+
 		totalDuration += metric.Duration
 		totalData += metric.DataTransferred
 		totalTables += metric.TablesProcessed
@@ -433,31 +480,41 @@ func calculateTrends(metrics []JobMetric) TrendAnalysis {
 	return trends
 }
 
-func outputMetricsJSON(report *MetricsReport) error {
-	jsonOutput, err := json.MarshalIndent(report, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal metrics: %w", err)
-	}
-	fmt.Println(string(jsonOutput))
-	return nil
+// metricsView renders a metrics report, with the flags that pick what text output
+// shows. Its JSON encoding is the MetricsReport.
+type metricsView struct {
+	*MetricsReport
+	detailed    bool
+	summaryOnly bool
 }
 
-func outputMetricsText(report *MetricsReport, detailed, summaryOnly bool) error {
-	fmt.Printf("📊 Transfer Metrics Report - %s\n", report.Period)
-	fmt.Printf("Generated: %s\n", report.GeneratedAt.Format(time.RFC3339))
-	fmt.Println()
+// WriteText writes the summary and, unless summaryOnly is set, performance, records,
+// running jobs, trends and, if detailed is set, every job
+func (v metricsView) WriteText(w io.Writer) error {
+	report, detailed, summaryOnly := v.MetricsReport, v.detailed, v.summaryOnly
+	fmt.Fprintf(w, "📊 Transfer Metrics Report - %s\n", report.Period)
+	fmt.Fprintf(w, "Generated: %s\n", report.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintln(w)
 
 	// Summary
 	summary := report.Summary
-	fmt.Println("📈 Summary:")
-	fmt.Printf("  Total Jobs: %d\n", summary.TotalJobs)
-	fmt.Printf("  Completed: %d (%.1f%%)\n", summary.CompletedJobs, summary.SuccessRate)
-	fmt.Printf("  Failed: %d\n", summary.FailedJobs)
-	fmt.Printf("  Running: %d\n", summary.RunningJobs)
-	fmt.Printf("  Average Duration: %v\n", summary.AverageDuration.Round(time.Second))
-	fmt.Printf("  Total Data Moved: %s\n", formatBytesMetrics(summary.TotalDataMoved))
-	fmt.Printf("  Total Tables: %d\n", summary.TotalTablesProcessed)
-	fmt.Println()
+	fmt.Fprintln(w, "📈 Summary:")
+	fmt.Fprintf(w, "  Total Jobs: %d\n", summary.TotalJobs)
+	fmt.Fprintf(w, "  Completed: %d (%.1f%%)\n", summary.CompletedJobs, summary.SuccessRate)
+	fmt.Fprintf(w, "  Failed: %d\n", summary.FailedJobs)
+	if summary.RunningJobs > 0 {
+		fmt.Fprintf(w, "  Running: %d (provisional)\n", summary.RunningJobs)
+	} else {
+		fmt.Fprintf(w, "  Running: %d\n", summary.RunningJobs)
+	}
+	fmt.Fprintf(w, "  Average Duration: %v\n", summary.AverageDuration.Round(time.Second))
+	if summary.Provisional {
+		fmt.Fprintf(w, "  Total Data Moved: %s (provisional)\n", output.FormatBytes(summary.TotalDataMoved))
+	} else {
+		fmt.Fprintf(w, "  Total Data Moved: %s\n", output.FormatBytes(summary.TotalDataMoved))
+	}
+	fmt.Fprintf(w, "  Total Tables: %d\n", summary.TotalTablesProcessed)
+	fmt.Fprintln(w)
 
 	if summaryOnly {
 		return nil
@@ -465,59 +522,102 @@ func outputMetricsText(report *MetricsReport, detailed, summaryOnly bool) error
 
 	// Performance Stats
 	stats := report.PerformanceStats
-	fmt.Println("⚡ Performance:")
-	fmt.Printf("  Average Speed: %.2f MB/s\n", stats.AverageSpeed)
-	fmt.Printf("  Median Duration: %v\n", stats.MedianDuration.Round(time.Second))
-	fmt.Printf("  95th Percentile Duration: %v\n", stats.P95Duration.Round(time.Second))
-	fmt.Printf("  Error Rate: %.1f%%\n", stats.ErrorRate)
-	fmt.Println()
+	fmt.Fprintln(w, "⚡ Performance:")
+	fmt.Fprintf(w, "  Average Speed: %.2f MB/s\n", stats.AverageSpeed)
+	fmt.Fprintf(w, "  Median Duration: %v\n", stats.MedianDuration.Round(time.Second))
+	fmt.Fprintf(w, "  95th Percentile Duration: %v\n", stats.P95Duration.Round(time.Second))
+	fmt.Fprintf(w, "  Error Rate: %.1f%%\n", stats.ErrorRate)
+	fmt.Fprintln(w)
 
 	// Record holders
 	if stats.FastestJob != nil {
-		fmt.Println("🏆 Records:")
-		fmt.Printf("  Fastest Job: %s (%v)\n", stats.FastestJob.JobID, stats.FastestJob.Duration.Round(time.Second))
+		fmt.Fprintln(w, "🏆 Records:")
+		fmt.Fprintf(w, "  Fastest Job: %s (%v)\n", stats.FastestJob.JobID, stats.FastestJob.Duration.Round(time.Second))
 		if stats.SlowestJob != nil {
-			fmt.Printf("  Slowest Job: %s (%v)\n", stats.SlowestJob.JobID, stats.SlowestJob.Duration.Round(time.Second))
+			fmt.Fprintf(w, "  Slowest Job: %s (%v)\n", stats.SlowestJob.JobID, stats.SlowestJob.Duration.Round(time.Second))
 		}
 		if stats.LargestTransfer != nil {
-			fmt.Printf("  Largest Transfer: %s (%s)\n", stats.LargestTransfer.JobID, formatBytesMetrics(stats.LargestTransfer.DataTransferred))
+			fmt.Fprintf(w, "  Largest Transfer: %s (%s)\n", stats.LargestTransfer.JobID, output.FormatBytes(stats.LargestTransfer.DataTransferred))
 		}
 		if stats.MostTables != nil {
-			fmt.Printf("  Most Tables: %s (%d tables)\n", stats.MostTables.JobID, stats.MostTables.TablesProcessed)
+			fmt.Fprintf(w, "  Most Tables: %s (%d tables)\n", stats.MostTables.JobID, stats.MostTables.TablesProcessed)
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
+	writeRunningJobsText(w, report.JobMetrics, report.GeneratedAt)
+
 	// Trends
 	if len(report.Trends.DailyStats) > 0 {
-		fmt.Println("📊 Trends:")
-		fmt.Printf("  Speed Trend: %s\n", getTrendIcon(report.Trends.SpeedTrend)+report.Trends.SpeedTrend)
-		fmt.Printf("  Success Trend: %s\n", getTrendIcon(report.Trends.SuccessTrend)+report.Trends.SuccessTrend)
-		fmt.Println()
+		fmt.Fprintln(w, "📊 Trends:")
+		fmt.Fprintf(w, "  Speed Trend: %s\n", getTrendIcon(report.Trends.SpeedTrend)+report.Trends.SpeedTrend)
+		fmt.Fprintf(w, "  Success Trend: %s\n", getTrendIcon(report.Trends.SuccessTrend)+report.Trends.SuccessTrend)
+		fmt.Fprintln(w)
 	}
 
 	// Detailed job metrics
 	if detailed && len(report.JobMetrics) > 0 {
-		fmt.Println("📋 Job Details:")
-		fmt.Printf("%-20s %-10s %-8s %-10s %-8s %-8s %-10s\n",
+		fmt.Fprintln(w, "📋 Job Details:")
+		fmt.Fprintf(w, "%-20s %-10s %-8s %-10s %-8s %-8s %-10s\n",
 			"JOB ID", "STATUS", "DURATION", "SPEED", "TABLES", "ERRORS", "DATA")
-		fmt.Printf("%s\n", strings.Repeat("-", 80))
+		fmt.Fprintf(w, "%s\n", strings.Repeat("-", 80))
 
 		for _, metric := range report.JobMetrics {
-			fmt.Printf("%-20s %-10s %-8s %-10s %-8d %-8d %-10s\n",
-				truncateString(metric.JobID, 20),
-				metric.Status,
+			status := metric.Status
+			if metric.Provisional {
+				status += "*"
+			}
+			fmt.Fprintf(w, "%-20s %-10s %-8s %-10s %-8d %-8d %-10s\n",
+				output.Truncate(metric.JobID, 20),
+				status,
 				metric.Duration.Round(time.Second).String(),
 				fmt.Sprintf("%.1fMB/s", metric.TransferRate),
 				metric.TablesProcessed,
 				metric.ErrorCount,
-				formatBytesMetrics(metric.DataTransferred))
+				output.FormatBytes(metric.DataTransferred))
+		}
+		if report.Summary.Provisional {
+			fmt.Fprintln(w, "* provisional: the job is still running")
 		}
 	}
 
 	return nil
 }
 
+// writeRunningJobsText shows the live throughput and ETA of running jobs
+func writeRunningJobsText(w io.Writer, metrics []JobMetric, now time.Time) {
+	var running []JobMetric
+	for _, metric := range metrics {
+		if metric.Provisional {
+			running = append(running, metric)
+		}
+	}
+	if len(running) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "⏳ Running Jobs (provisional):")
+	for _, metric := range running {
+		if metric.LastHeartbeat == nil {
+			fmt.Fprintf(w, "  %s: %s, no heartbeat yet\n", metric.JobID, metric.Status)
+			continue
+		}
+		line := fmt.Sprintf("  %s: %s at %.2f MB/s", metric.JobID, output.FormatBytes(metric.DataTransferred), metric.TransferRate)
+		if metric.PercentComplete > 0 {
+			line += fmt.Sprintf(" (%.1f%%)", metric.PercentComplete)
+		}
+		if metric.ETA > 0 {
+			line += fmt.Sprintf(", ETA %v", metric.ETA.Round(time.Second))
+		}
+		line += fmt.Sprintf(", heartbeat %v ago", now.Sub(*metric.LastHeartbeat).Round(time.Second))
+		if metric.HeartbeatStale {
+			line += " (stale)"
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w)
+}
+
 func getTrendIcon(trend string) string {
 	switch trend {
 	case "improving":
@@ -530,19 +630,3 @@ func getTrendIcon(trend string) string {
 		return "❓ "
 	}
 }
-
-// formatBytesMetrics converts bytes to human readable format
-func formatBytesMetrics(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
-}
-
-// Note: truncateString function is also defined in other cmd files - should be moved to shared utility
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertToJobMetric_Running(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	job := &fork.JobState{
+		JobID:       "fork-1",
+		Status:      "running",
+		StartTime:   start,
+		LastUpdated: start.Add(100 * time.Second),
+		Checkpoint: &fork.JobCheckpoint{
+			Time:             start.Add(100 * time.Second),
+			BytesTransferred: 100 * 1024 * 1024,
+			BytesTotal:       400 * 1024 * 1024,
+		},
+	}
+
+	metric := convertToJobMetric(job, start.Add(105*time.Second))
+	assert.True(t, metric.Provisional)
+	assert.Nil(t, metric.EndTime)
+	require.NotNil(t, metric.LastHeartbeat)
+	assert.False(t, metric.HeartbeatStale)
+	assert.Equal(t, int64(100*1024*1024), metric.DataTransferred)
+	assert.InDelta(t, 1.0, metric.TransferRate, 0.001)
+	assert.InDelta(t, 25.0, metric.PercentComplete, 0.001)
+	assert.Equal(t, 300*time.Second, metric.ETA)
+
+	// A job whose heartbeat stopped has no ETA
+	metric = convertToJobMetric(job, start.Add(time.Hour))
+	assert.True(t, metric.HeartbeatStale)
+	assert.Zero(t, metric.ETA)
+	assert.InDelta(t, 1.0, metric.TransferRate, 0.001)
+
+	summary := calculateSummary([]JobMetric{metric})
+	assert.True(t, summary.Provisional)
+	assert.Equal(t, 1, summary.RunningJobs)
+}
+
+func TestConvertToJobMetric_Finished(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	job := &fork.JobState{
+		JobID:       "fork-1",
+		Status:      "completed",
+		StartTime:   start,
+		LastUpdated: start.Add(time.Minute),
+		Checkpoint:  &fork.JobCheckpoint{Time: start.Add(50 * time.Second), BytesTransferred: 1024},
+	}
+
+	metric := convertToJobMetric(job, start.Add(time.Hour))
+	assert.False(t, metric.Provisional)
+	assert.Nil(t, metric.LastHeartbeat)
+	assert.Equal(t, time.Minute, metric.Duration)
+	assert.False(t, calculateSummary([]JobMetric{metric}).Provisional)
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/spf13/cobra"
+)
+
+// addPorcelainFlag adds --porcelain to a command with an --output-format flag
+func addPorcelainFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("porcelain", false, "Stable line-oriented output for scripts (same as --output-format porcelain)")
+}
+
+// resolveOutputFormat returns the porcelain format when --porcelain is set, and
+// format otherwise
+func resolveOutputFormat(cmd *cobra.Command, format string) string {
+	if porcelain, _ := cmd.Flags().GetBool("porcelain"); porcelain {
+		return output.Porcelain
+	}
+	return format
+}
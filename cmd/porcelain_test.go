@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteListPorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, listView{ListResult: &ListResult{
+		Success: true,
+		Count:   2,
+		Databases: []DatabaseInfo{
+			{Name: "app_pr_1", Size: "1.0 KB", SizeBytes: 1024, Lineage: &db.Lineage{Source: "app", JobID: "job-1",
+				CI: &config.CIProvenance{Provider: "github", RunURL: "https://github.com/acme/app/actions/runs/7"}}},
+			{Name: "app_pr_2"},
+		},
+	}}))
+	assert.Equal(t, "database\tapp_pr_1\t1024\t\t\tapp\tjob-1\thttps://github.com/acme/app/actions/runs/7\n"+
+		"database\tapp_pr_2\t\t\t\t\t\t\n"+
+		"count\t2\n"+
+		"status\tok\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.Render(&buf, output.Porcelain, listView{ListResult: &ListResult{Success: false, Error: "connection refused"}}))
+	assert.Equal(t, "status\terror\tconnection refused\n", buf.String())
+}
+
+func TestWriteCleanupPorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, cleanupView{CleanupResult: &CleanupResult{
+		Success:          false,
+		Error:            "Failed to delete 1 databases: [app_pr_3]",
+		DeletedDatabases: []string{"app_pr_1"},
+		SkippedDatabases: []string{"app_pr_2"},
+		FailedDatabases:  []string{"app_pr_3"},
+	}}))
+	assert.Equal(t, "deleted\tapp_pr_1\nskipped\tapp_pr_2\nfailed\tapp_pr_3\n"+
+		"status\terror\tFailed to delete 1 databases: [app_pr_3]\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.Render(&buf, output.Porcelain, cleanupView{CleanupResult: &CleanupResult{Success: true, DryRun: true, DeletedDatabases: []string{"app_pr_1"}}}))
+	assert.Equal(t, "would-delete\tapp_pr_1\nstatus\tok\n", buf.String())
+}
+
+func TestWriteCutoverPorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, cutoverView{CutoverResult: &CutoverResult{
+		Success:  true,
+		Database: "myapp",
+		Cutover: &fork.CutoverResult{Mode: fork.CutoverStandby, LSN: "0/3000060", PausedRoles: []string{"app_rw"},
+			Target: "postgresql://app@standby:5432/myapp", WaitedFor: "2s"},
+	}}))
+	assert.Equal(t, "database\tmyapp\ncutover\tstandby\t0/3000060\t2s\t0\npaused-role\tapp_rw\n"+
+		"connect\tpostgresql://app@standby:5432/myapp\nstatus\tok\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, output.Render(&buf, output.Porcelain, cutoverView{CutoverResult: &CutoverResult{Error: "timed out"}}))
+	assert.Equal(t, "status\terror\ttimed out\n", buf.String())
+}
@@ -0,0 +1,515 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/forge"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// PRResult represents the result of a pr create, sync or destroy
+type PRResult struct {
+	Format     string     `json:"format"`
+	Success    bool       `json:"success"`
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Action     string     `json:"action"`
+	DryRun     bool       `json:"dry_run,omitempty"`
+	Number     int        `json:"number,omitempty"`
+	Database   string     `json:"database,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Pruned     []string   `json:"pruned,omitempty"`
+	CommentURL string     `json:"comment_url,omitempty"`
+	Warnings   []string   `json:"warnings,omitempty"`
+	Duration   string     `json:"duration"`
+}
+
+// prCmd represents the pr command
+var prCmd = &cobra.Command{
+	Use:   "pr",
+	Short: "Create, refresh and destroy the database of a pull request",
+	Long: `Manage the database of one pull request in a single opinionated step.
+
+Each pull request gets one database, named from --name-template (default
+"{{.SOURCE_DB}}_pr_{{.PR_NUMBER}}"). The number is read from --number, or in CI
+from GITHUB_PR_NUMBER or CI_MERGE_REQUEST_IID.
+
+  create   Fork the source unless the pull request already has a database
+  sync     Re-fork the source, replacing the pull request's database
+  destroy  Drop the pull request's database
+
+Guardrails:
+- The pull request number and expiry are recorded in the database's lineage. A
+  database that exists but was not forked for this pull request is never replaced
+  or dropped without --force.
+- Databases get a TTL (--ttl, default 168h; 0 never expires). Every run first drops
+  the expired pull request databases of the same source (--prune-expired).
+- --max-databases refuses to create more pull request databases of one source.
+
+When GITHUB_TOKEN and GITHUB_REPOSITORY (GitHub Actions) or GITLAB_TOKEN and
+CI_PROJECT_ID (GitLab CI) are set, the database is described in a comment on the
+pull request, which later runs edit instead of adding new ones. Disable it with
+--comment=false. A failed comment is reported as a warning.
+
+Examples:
+  # Create the database when a pull request is opened or updated
+  postgres-db-fork pr create --source-db myapp_staging
+
+  # Refresh it from the source, e.g. after a migration landed on staging
+  postgres-db-fork pr sync --source-db myapp_staging --number 123
+
+  # Drop it when the pull request is closed
+  postgres-db-fork pr destroy --source-db myapp_staging --number 123
+
+  # Only the schema, at most 20 pull request databases, kept for three days
+  postgres-db-fork pr create --source-db myapp_staging --schema-only \
+    --max-databases 20 --ttl 72h --output-format json`,
+}
+
+var prCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create the database of a pull request",
+	Long: `Fork the source into the pull request's database.
+
+If the pull request already has its database, it is left as it is, so create can
+run on every push. Use sync to replace it with a fresh fork.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPR(cmd, "create")
+	},
+}
+
+var prSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Replace the database of a pull request with a fresh fork",
+	Long: `Drop the pull request's database and fork the source again, restarting its TTL.
+
+The database is created if the pull request does not have one yet.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPR(cmd, "sync")
+	},
+}
+
+var prDestroyCmd = &cobra.Command{
+	Use:   "destroy",
+	Short: "Drop the database of a pull request",
+	Long: `Drop the pull request's database. A pull request without a database is not an
+error, so destroy can run on every close event.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPR(cmd, "destroy")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(prCmd)
+	prCmd.AddCommand(prCreateCmd)
+	prCmd.AddCommand(prSyncCmd)
+	prCmd.AddCommand(prDestroyCmd)
+
+	flags := prCmd.PersistentFlags()
+
+	// Source database flags
+	flags.String("source-uri", "", "Source database URI, replaces the individual source flags")
+	flags.String("source-host", "localhost", "Source database host")
+	flags.Int("source-port", 5432, "Source database port")
+	flags.String("source-user", "", "Source database username")
+	flags.String("source-password", "", "Source database password")
+	flags.Bool("source-password-stdin", false, "Read the source database password from standard input")
+	flags.String("source-db", "", "Source database name (required)")
+	flags.String("source-sslmode", "prefer", "Source database SSL mode")
+
+	// Destination database flags
+	flags.String("dest-uri", "", "Destination server URI, replaces the individual destination flags")
+	flags.String("dest-host", "", "Destination database host (defaults to source-host)")
+	flags.Int("dest-port", 0, "Destination database port (defaults to source-port)")
+	flags.String("dest-user", "", "Destination database username (defaults to source-user)")
+	flags.String("dest-password", "", "Destination database password (defaults to source-password)")
+	flags.Bool("dest-password-stdin", false, "Read the destination database password from standard input")
+	flags.String("dest-sslmode", "", "Destination database SSL mode (defaults to source-sslmode)")
+	flags.String("admin-db", "", "Maintenance database on the destination server for admin connections (default: postgres)")
+
+	// Pull request options
+	flags.Int("number", 0, "Pull request number (defaults to GITHUB_PR_NUMBER or CI_MERGE_REQUEST_IID)")
+	flags.String("name-template", config.DefaultPullRequestDatabase, "Template of the database name")
+	flags.StringToString("template-var", map[string]string{}, "Additional name template variables (e.g., --template-var APP=shop)")
+	flags.Duration("ttl", 7*24*time.Hour, "Time after which the database may be pruned (0 never expires)")
+	flags.Bool("prune-expired", true, "Drop expired pull request databases of the same source first")
+	flags.Int("max-databases", 0, "Refuse to create more pull request databases of the source than this (0 is unlimited)")
+	flags.Bool("comment", true, "Describe the database in a comment on the pull request when forge credentials are set")
+	flags.Duration("timeout", 30*time.Minute, "Operation timeout")
+	flags.String("team", "", "Team that owns the database, for quotas and allow-lists")
+	flags.String("team-token", "", "Token of the team, when the configuration requires one (prefer PGFORK_TEAM_TOKEN)")
+
+	// Output options
+	flags.String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	flags.Bool("porcelain", false, "Stable line-oriented output for scripts (same as --output-format porcelain)")
+	flags.Bool("quiet", false, "Suppress output except errors and the final result")
+	flags.Bool("dry-run", false, "Show what would be done without making changes")
+
+	// Fork options of create and sync
+	for _, c := range []*cobra.Command{prCreateCmd, prSyncCmd} {
+		c.Flags().Bool("schema-only", false, "Transfer schema only (no data)")
+		c.Flags().Bool("minimal-schema", false, "Copy only tables, views, types and sequences")
+		c.Flags().StringSlice("include-tables", []string{}, "Tables to include in transfer")
+		c.Flags().StringSlice("exclude-tables", []string{}, "Tables to exclude from transfer")
+		c.Flags().StringSlice("seed", []string{}, "SQL file or directory of *.sql files to run against the new database")
+		c.Flags().Bool("use-template-cache", false, "Clone same-server forks from the source's cached template when one exists")
+		c.Flags().Bool("schema-cache", false, "Reuse the source's schema dump while its schema is unchanged")
+		c.Flags().Int("max-connections", 4, "Maximum number of parallel connections for data transfer")
+	}
+
+	// Keys this command reads from config files
+	config.RegisterOptions(
+		prNumberOpt, prNameTemplateOpt, prTTLOpt, prPruneOpt, prMaxDatabasesOpt, prCommentOpt,
+	)
+}
+
+// Pull request options, resolved through the shared options builder
+var (
+	prNumberOpt       = config.Option{Key: "pr.number", Env: []string{"CI_MERGE_REQUEST_IID", "GITHUB_PR_NUMBER", "PGFORK_PR_NUMBER"}, Flag: "number"}
+	prNameTemplateOpt = config.Option{Key: "pr.name_template", Env: []string{"PGFORK_PR_NAME_TEMPLATE"}, Flag: "name-template"}
+	prTTLOpt          = config.Option{Key: "pr.ttl", Env: []string{"PGFORK_PR_TTL"}, Flag: "ttl"}
+	prPruneOpt        = config.Option{Key: "pr.prune_expired", Env: []string{"PGFORK_PR_PRUNE_EXPIRED"}, Flag: "prune-expired"}
+	prMaxDatabasesOpt = config.Option{Key: "pr.max_databases", Env: []string{"PGFORK_PR_MAX_DATABASES"}, Flag: "max-databases"}
+	prCommentOpt      = config.Option{Key: "pr.comment", Env: []string{"PGFORK_PR_COMMENT"}, Flag: "comment"}
+)
+
+func runPR(cmd *cobra.Command, action string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	result := &PRResult{
+		Format:  outputFormat,
+		Success: true,
+		Action:  action,
+	}
+	fail := func(err error) error {
+		result.Success = false
+		result.Error = err.Error()
+		result.Duration = time.Since(start).String()
+		return outputPRResult(result, quiet)
+	}
+
+	number, err := builder.GetInt(prNumberOpt, 0)
+	if err != nil {
+		return fail(err)
+	}
+	if number <= 0 {
+		return fail(fmt.Errorf("pull request number is required (use --number, PGFORK_PR_NUMBER or GITHUB_PR_NUMBER)"))
+	}
+	result.Number = number
+
+	cfg, settings, err := resolvePRConfig(cmd, builder, outputFormat)
+	if err != nil {
+		return fail(err)
+	}
+	if err := settings.target(cfg, number); err != nil {
+		return fail(err)
+	}
+	result.DryRun = cfg.DryRun
+	if err := newPasswordInput(cmd).resolveForkPasswords(cfg); err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	if err := runPRAction(ctx, cfg, settings, action, result); err != nil {
+		return fail(err)
+	}
+	result.Duration = time.Since(start).String()
+	return outputPRResult(result, quiet)
+}
+
+// prSettings are the options of a pr action besides its fork configuration
+type prSettings struct {
+	nameTemplate string
+	prune        bool
+	maxDatabases int
+	comment      bool
+	force        bool
+}
+
+// resolvePRConfig resolves the fork configuration and pull request options of a pr
+// command. The target database is left for target to fill in.
+func resolvePRConfig(cmd *cobra.Command, builder *config.OptionsBuilder, outputFormat string) (*config.ForkConfig, *prSettings, error) {
+	cfg, err := builder.BuildForkConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuration error: %w", err)
+	}
+	if cfg.Source.Database == "" {
+		return nil, nil, fmt.Errorf("source database is required (use --source-db or PGFORK_SOURCE_DATABASE)")
+	}
+	cfg.OutputFormat = outputFormat
+
+	settings := &prSettings{}
+	if settings.nameTemplate, err = builder.GetString(prNameTemplateOpt, config.DefaultPullRequestDatabase); err != nil {
+		return nil, nil, err
+	}
+	if cfg.TTL, err = builder.GetDuration(prTTLOpt, 7*24*time.Hour); err != nil {
+		return nil, nil, err
+	}
+	if settings.prune, err = builder.GetBool(prPruneOpt, true); err != nil {
+		return nil, nil, err
+	}
+	if settings.maxDatabases, err = builder.GetInt(prMaxDatabasesOpt, 0); err != nil {
+		return nil, nil, err
+	}
+	if settings.comment, err = builder.GetBool(prCommentOpt, true); err != nil {
+		return nil, nil, err
+	}
+	settings.force, _ = cmd.Flags().GetBool("force")
+	return cfg, settings, nil
+}
+
+// target points cfg at the database of pull request number and validates it
+func (s *prSettings) target(cfg *config.ForkConfig, number int) error {
+	target, err := config.PullRequestDatabase(s.nameTemplate, number, cfg.Source.Database, cfg.TemplateVars)
+	if err != nil {
+		return err
+	}
+	cfg.TargetDatabase = target
+	cfg.Destination.Database = target
+	cfg.PullRequest = number
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+	return nil
+}
+
+// runPRAction creates, syncs or destroys the database of the pull request cfg
+// targets, recording what it did in result
+func runPRAction(ctx context.Context, cfg *config.ForkConfig, settings *prSettings, action string, result *PRResult) error {
+	number := cfg.PullRequest
+	result.Number = number
+	result.Database = cfg.TargetDatabase
+	result.Source = cfg.Source.Database
+
+	adminConfig := cfg.Destination.Admin()
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to destination server: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	lineages, err := conn.LineagesContext(ctx)
+	if err != nil {
+		return err
+	}
+	if settings.prune {
+		expired := expiredPRDatabases(lineages, cfg.Source.Database, cfg.TargetDatabase, time.Now())
+		for _, name := range expired {
+			if !cfg.DryRun {
+				if err := conn.DropDatabaseContext(ctx, name); err != nil {
+					result.Warnings = append(result.Warnings, fmt.Sprintf("failed to prune %s: %v", name, err))
+					continue
+				}
+			}
+			delete(lineages, name)
+			result.Pruned = append(result.Pruned, name)
+		}
+	}
+
+	exists, err := conn.DatabaseExistsContext(ctx, cfg.TargetDatabase)
+	if err != nil {
+		return fmt.Errorf("failed to check database %s: %w", cfg.TargetDatabase, err)
+	}
+	lineage, known := lineages[cfg.TargetDatabase]
+	owned := known && lineage.PullRequest == number
+	if exists && !owned && !settings.force {
+		return fmt.Errorf("database %s exists but was not forked for pull request %d; use --force to replace it", cfg.TargetDatabase, number)
+	}
+
+	switch {
+	case action == "destroy" && !exists:
+		result.Message = fmt.Sprintf("Pull request %d has no database %s, nothing to destroy", number, cfg.TargetDatabase)
+	case action == "destroy" && cfg.DryRun:
+		result.Message = fmt.Sprintf("DRY RUN: Would drop database %s", cfg.TargetDatabase)
+	case action == "destroy":
+		if err := conn.DropDatabaseContext(ctx, cfg.TargetDatabase); err != nil {
+			return fmt.Errorf("failed to drop database %s: %w", cfg.TargetDatabase, err)
+		}
+		result.Message = fmt.Sprintf("Dropped database %s of pull request %d", cfg.TargetDatabase, number)
+	case action == "create" && exists && owned:
+		result.ExpiresAt = lineage.ExpiresAt
+		result.Message = fmt.Sprintf("Pull request %d already has database %s", number, cfg.TargetDatabase)
+	default:
+		if !exists && settings.maxDatabases > 0 {
+			if count := countPRDatabases(lineages, cfg.Source.Database); count >= settings.maxDatabases {
+				return fmt.Errorf("%s already has %d pull request databases (limit %d); destroy some or raise --max-databases", cfg.Source.Database, count, settings.maxDatabases)
+			}
+		}
+		if cfg.DryRun {
+			result.Message = fmt.Sprintf("DRY RUN: Would fork %s to %s", cfg.Source.Database, cfg.TargetDatabase)
+			break
+		}
+		cfg.DropIfExists = exists
+		if err := fork.NewForker(cfg).Fork(ctx); err != nil {
+			return err
+		}
+		if cfg.TTL > 0 {
+			expiresAt := time.Now().UTC().Add(cfg.TTL)
+			result.ExpiresAt = &expiresAt
+		}
+		result.Message = fmt.Sprintf("Forked %s to %s for pull request %d", cfg.Source.Database, cfg.TargetDatabase, number)
+	}
+
+	if settings.comment && !cfg.DryRun {
+		if commenter := forge.FromEnvironment(); commenter != nil {
+			url, err := commenter.UpsertComment(ctx, number, prCommentBody(result))
+			if err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("failed to comment on pull request %d: %v", number, err))
+			}
+			result.CommentURL = url
+		}
+	}
+	return nil
+}
+
+// expiredPRDatabases returns the pull request databases of source, other than keep,
+// whose TTL has passed at now
+func expiredPRDatabases(lineages map[string]db.Lineage, source, keep string, now time.Time) []string {
+	var expired []string
+	for name, lineage := range lineages {
+		if name != keep && lineage.PullRequest > 0 && lineage.Source == source && lineage.Expired(now) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+// countPRDatabases counts the pull request databases forked from source
+func countPRDatabases(lineages map[string]db.Lineage, source string) int {
+	count := 0
+	for _, lineage := range lineages {
+		if lineage.PullRequest > 0 && lineage.Source == source {
+			count++
+		}
+	}
+	return count
+}
+
+// prCommentBody describes the pull request's database for the forge comment
+func prCommentBody(result *PRResult) string {
+	var b strings.Builder
+	b.WriteString(forge.CommentMarker + "\n")
+	if result.Action == "destroy" {
+		fmt.Fprintf(&b, "🗑️ The database `%s` of this pull request has been dropped.\n", result.Database)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "🐘 This pull request has the database `%s`, forked from `%s`.\n", result.Database, result.Source)
+	if result.ExpiresAt != nil {
+		fmt.Fprintf(&b, "\nIt expires at %s; run `postgres-db-fork pr sync` to refresh it.\n",
+			result.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	return b.String()
+}
+
+// prView renders the pr result, with the quiet flag that text output needs.
+// Its JSON encoding is the PRResult.
+type prView struct {
+	*PRResult
+	quiet bool
+}
+
+// WriteText writes what the pr command did, or only the database name in quiet mode
+func (v prView) WriteText(w io.Writer) error {
+	if v.quiet {
+		// Only the database name, for use in scripts
+		if v.Success {
+			fmt.Fprintln(w, v.Database)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", v.Error)
+		}
+		return nil
+	}
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	if v.ExpiresAt != nil {
+		fmt.Fprintf(w, "Expires: %s\n", v.ExpiresAt.Format(time.RFC3339))
+	}
+	for _, name := range v.Pruned {
+		fmt.Fprintf(w, "Pruned expired database: %s\n", name)
+	}
+	if v.CommentURL != "" {
+		fmt.Fprintf(w, "Comment: %s\n", v.CommentURL)
+	}
+	for _, warning := range v.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// WritePorcelain writes the pr result as porcelain records:
+//
+//	database	<name>
+//	expires	<RFC 3339 time>
+//	pruned	<name>
+//	comment	<url>
+//	warning	<message>
+func (v prView) WritePorcelain(w io.Writer) {
+	if v.Success && v.Database != "" {
+		output.WritePorcelain(w, "database", v.Database)
+	}
+	if v.ExpiresAt != nil {
+		output.WritePorcelain(w, "expires", v.ExpiresAt.Format(time.RFC3339))
+	}
+	for _, name := range v.Pruned {
+		output.WritePorcelain(w, "pruned", name)
+	}
+	if v.CommentURL != "" {
+		output.WritePorcelain(w, "comment", v.CommentURL)
+	}
+	for _, warning := range v.Warnings {
+		output.WritePorcelain(w, "warning", warning)
+	}
+}
+
+// Outcome reports whether the pr command succeeded
+func (v prView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputPRResult outputs the pr result in the specified format
+func outputPRResult(result *PRResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, prView{PRResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
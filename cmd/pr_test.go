@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/forge"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPRCmdFlags(t *testing.T) {
+	for _, sub := range []string{"create", "sync", "destroy", "webhook"} {
+		cmd, _, err := prCmd.Find([]string{sub})
+		assert.NoError(t, err)
+		assert.Equal(t, sub, cmd.Name())
+	}
+
+	for _, flagName := range []string{"source-db", "dest-uri", "number", "name-template", "ttl", "prune-expired", "max-databases", "comment", "porcelain"} {
+		assert.NotNil(t, prCmd.PersistentFlags().Lookup(flagName), "Flag %s should exist", flagName)
+	}
+	assert.NotNil(t, prCreateCmd.Flags().Lookup("schema-only"))
+	assert.Nil(t, prDestroyCmd.Flags().Lookup("schema-only"))
+}
+
+func TestExpiredPRDatabases(t *testing.T) {
+	now := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	lineages := map[string]db.Lineage{
+		"app_pr_1":   {Source: "app", PullRequest: 1, ExpiresAt: &past},
+		"app_pr_2":   {Source: "app", PullRequest: 2, ExpiresAt: &future},
+		"app_pr_3":   {Source: "app", PullRequest: 3},
+		"app_pr_4":   {Source: "app", PullRequest: 4, ExpiresAt: &past},
+		"other_pr_1": {Source: "other", PullRequest: 1, ExpiresAt: &past},
+		"app_copy":   {Source: "app", ExpiresAt: &past},
+	}
+
+	assert.Equal(t, []string{"app_pr_1"}, expiredPRDatabases(lineages, "app", "app_pr_4", now))
+	assert.Equal(t, 4, countPRDatabases(lineages, "app"))
+}
+
+func TestPRCommentBody(t *testing.T) {
+	expiresAt := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+	body := prCommentBody(&PRResult{Action: "create", Database: "app_pr_7", Source: "app", ExpiresAt: &expiresAt})
+	assert.Contains(t, body, forge.CommentMarker)
+	assert.Contains(t, body, "`app_pr_7`, forked from `app`")
+	assert.Contains(t, body, "2024-03-08 12:00 UTC")
+
+	body = prCommentBody(&PRResult{Action: "destroy", Database: "app_pr_7"})
+	assert.Contains(t, body, "has been dropped")
+}
+
+func TestWritePRPorcelain(t *testing.T) {
+	expiresAt := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, prView{PRResult: &PRResult{
+		Success:   true,
+		Database:  "app_pr_7",
+		ExpiresAt: &expiresAt,
+		Pruned:    []string{"app_pr_1"},
+		Warnings:  []string{"failed to comment"},
+	}}))
+	assert.Equal(t, "database\tapp_pr_7\nexpires\t2024-03-08T12:00:00Z\npruned\tapp_pr_1\nwarning\tfailed to comment\nstatus\tok\n", buf.String())
+}
+
+func TestPRWebhookHandler(t *testing.T) {
+	handler := &prWebhookHandler{secret: "secret", repository: "group/app"}
+	deliver := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+		req.Header.Set("X-Gitlab-Event", "Merge Request Hook")
+		req.Header.Set("X-Gitlab-Token", token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	closed := `{"object_attributes": {"iid": 7, "action": "close"}, "project": {"path_with_namespace": "group/other"}}`
+	assert.Equal(t, http.StatusMethodNotAllowed, deliver(http.MethodGet, "secret", closed).Code)
+	assert.Equal(t, http.StatusUnauthorized, deliver(http.MethodPost, "wrong", closed).Code)
+
+	rec := deliver(http.MethodPost, "secret", closed)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Pull request of group/other, not group/app")
+
+	opened := `{"object_attributes": {"iid": 7, "action": "open"}, "project": {"path_with_namespace": "group/app"}}`
+	rec = deliver(http.MethodPost, "secret", opened)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"action":"ignored"`)
+	assert.Contains(t, rec.Body.String(), "Pull request 7 is still open")
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/forge"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// maxWebhookBody bounds the size of a webhook delivery
+const maxWebhookBody = 1 << 20
+
+var prWebhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Drop pull request databases when forge webhooks report them closed",
+	Long: `Run a server that receives GitHub and GitLab webhooks and drops the database of
+every pull request that is closed or merged, as pr destroy would. No cleanup job has
+to run in the pipeline.
+
+Point a GitHub "Pull requests" webhook or a GitLab "Merge request events" webhook at
+http://<host><path> with the secret given by --webhook-secret (or
+PGFORK_WEBHOOK_SECRET). GitHub deliveries must carry a valid X-Hub-Signature-256 and
+GitLab deliveries the secret token; anything else is rejected. --repository limits the
+server to the pull requests of one repository. Each response is the JSON result of
+the destroy, which shows up in the forge's delivery log.
+
+The source, destination, name template and pruning flags are those of the other pr
+commands. GET /healthz reports that the server is up.
+
+Examples:
+  postgres-db-fork pr webhook --source-db myapp_staging --listen :8080 \
+    --repository acme/myapp`,
+	RunE: runPRWebhook,
+}
+
+func init() {
+	prCmd.AddCommand(prWebhookCmd)
+	prWebhookCmd.Flags().String("listen", ":8080", "Address the webhook server listens on")
+	prWebhookCmd.Flags().String("path", "/webhook", "URL path that receives webhooks")
+	prWebhookCmd.Flags().String("webhook-secret", "", "Secret the webhooks are signed with (prefer PGFORK_WEBHOOK_SECRET)")
+	prWebhookCmd.Flags().String("repository", "", "Only handle pull requests of this repository (owner/repo or group/project)")
+
+	config.RegisterOptions(prWebhookListenOpt, prWebhookPathOpt, prWebhookSecretOpt, prWebhookRepositoryOpt)
+}
+
+// Webhook server options, resolved through the shared options builder
+var (
+	prWebhookListenOpt     = config.Option{Key: "pr.webhook.listen", Env: []string{"PGFORK_WEBHOOK_LISTEN"}, Flag: "listen"}
+	prWebhookPathOpt       = config.Option{Key: "pr.webhook.path", Env: []string{"PGFORK_WEBHOOK_PATH"}, Flag: "path"}
+	prWebhookSecretOpt     = config.Option{Key: "pr.webhook.secret", Env: []string{"PGFORK_WEBHOOK_SECRET"}, Flag: "webhook-secret"}
+	prWebhookRepositoryOpt = config.Option{Key: "pr.webhook.repository", Env: []string{"PGFORK_WEBHOOK_REPOSITORY"}, Flag: "repository"}
+)
+
+func runPRWebhook(cmd *cobra.Command, args []string) error {
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	listen, err := builder.GetString(prWebhookListenOpt, ":8080")
+	if err != nil {
+		return err
+	}
+	path, err := builder.GetString(prWebhookPathOpt, "/webhook")
+	if err != nil {
+		return err
+	}
+	secret, err := builder.GetString(prWebhookSecretOpt, "")
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("a webhook secret is required (use --webhook-secret or PGFORK_WEBHOOK_SECRET)")
+	}
+	repository, err := builder.GetString(prWebhookRepositoryOpt, "")
+	if err != nil {
+		return err
+	}
+
+	cfg, settings, err := resolvePRConfig(cmd, builder, "json")
+	if err != nil {
+		return err
+	}
+	// Check the configuration once with a sample pull request, so a bad name template
+	// fails now instead of on the first delivery
+	sample := *cfg
+	if err := settings.target(&sample, 1); err != nil {
+		return err
+	}
+	if err := newPasswordInput(cmd).resolveForkPasswords(cfg); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, &prWebhookHandler{cfg: cfg, settings: settings, secret: secret, repository: repository})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logrus.Warnf("Webhook server shutdown failed: %v", err)
+		}
+	}()
+
+	logrus.Infof("Receiving pull request webhooks on %s%s", listen, path)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("webhook server failed: %w", err)
+	}
+	return nil
+}
+
+// prWebhookHandler drops the database of each pull request a verified webhook
+// reports closed. Deliveries are handled one at a time.
+type prWebhookHandler struct {
+	cfg        *config.ForkConfig
+	settings   *prSettings
+	secret     string
+	repository string
+
+	mu sync.Mutex
+}
+
+// ServeHTTP verifies a webhook delivery and runs the destroy it asks for
+func (h *prWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookBody {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	event, err := forge.ParseWebhook(r.Header, body, h.secret)
+	if errors.Is(err, forge.ErrWebhookUnauthorized) {
+		logrus.Warnf("Rejected webhook from %s: %v", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, result := h.handle(event)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// handle drops the database of the pull request event closed, and returns the HTTP
+// status and result to answer the delivery with
+func (h *prWebhookHandler) handle(event *forge.WebhookEvent) (int, *PRResult) {
+	start := time.Now()
+	result := &PRResult{Format: "json", Success: true, Action: "ignored"}
+	ignore := func(reason string) (int, *PRResult) {
+		result.Message = reason
+		result.Duration = time.Since(start).String()
+		return http.StatusAccepted, result
+	}
+	switch {
+	case event == nil:
+		return ignore("Not a pull request event")
+	case h.repository != "" && event.Repository != h.repository:
+		return ignore(fmt.Sprintf("Pull request of %s, not %s", event.Repository, h.repository))
+	case !event.Closed:
+		return ignore(fmt.Sprintf("Pull request %d is still open", event.Number))
+	case event.Number <= 0:
+		return ignore("Event has no pull request number")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result.Action = "destroy"
+	cfg := *h.cfg
+	err := h.settings.target(&cfg, event.Number)
+	if err == nil {
+		// The destroy outlives the delivery, which forges time out after seconds
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+		err = runPRAction(ctx, &cfg, h.settings, "destroy", result)
+	}
+	result.Duration = time.Since(start).String()
+	if err != nil {
+		logrus.Errorf("Failed to destroy the database of %s pull request %d: %v", event.Repository, event.Number, err)
+		result.Success = false
+		result.Error = err.Error()
+		return http.StatusInternalServerError, result
+	}
+	logrus.Infof("%s (%s pull request %d closed)", result.Message, event.Repository, event.Number)
+	return http.StatusOK, result
+}
@@ -148,6 +148,17 @@ func init() {
 	profileUseCmd.Flags().Bool("merge", false, "Merge with current config instead of replacing")
 }
 
+// builtinProfiles are available without a profile file; a saved profile of the same
+// name replaces them
+var builtinProfiles = []Profile{
+	{
+		Name:        "minimal-schema",
+		Description: "Tables, views and types only, for fast unit-test databases",
+		Config:      map[string]interface{}{"minimal_schema": true},
+		Tags:        []string{"builtin"},
+	},
+}
+
 func getProfileStore() (*ProfileStore, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -164,6 +175,10 @@ func getProfileStore() (*ProfileStore, error) {
 		Profiles:    make(map[string]Profile),
 	}
 
+	for _, profile := range builtinProfiles {
+		store.Profiles[profile.Name] = profile
+	}
+
 	// Load existing profiles
 	if err := store.loadProfiles(); err != nil {
 		return nil, fmt.Errorf("failed to load profiles: %w", err)
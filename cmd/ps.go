@@ -59,6 +59,7 @@ func init() {
 	psCmd.Flags().String("user", "", "Database username (required)")
 	psCmd.Flags().String("password", "", "Database password")
 	psCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	psCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
 
 	// Output options
 	psCmd.Flags().String("output-format", "text", "Output format: text or json")
@@ -85,29 +86,38 @@ func init() {
 	if err := viper.BindPFlag("ps.sslmode", psCmd.Flags().Lookup("sslmode")); err != nil {
 		fmt.Printf("Failed to bind flag: %v\n", err)
 	}
+	if err := viper.BindPFlag("ps.admin_database", psCmd.Flags().Lookup("admin-db")); err != nil {
+		fmt.Printf("Failed to bind flag: %v\n", err)
+	}
 	if err := viper.BindPFlag("ps.output_format", psCmd.Flags().Lookup("output-format")); err != nil {
 		fmt.Printf("Failed to bind flag: %v\n", err)
 	}
 	if err := viper.BindPFlag("ps.quiet", psCmd.Flags().Lookup("quiet")); err != nil {
 		fmt.Printf("Failed to bind flag: %v\n", err)
 	}
+
+	// Keys this command reads from config files
+	config.RegisterConnection("ps")
+	config.RegisterKeys("ps.output_format", "ps.quiet")
 }
 
 func runPs(cmd *cobra.Command, args []string) error {
 	start := time.Now()
 
-	dbConfig := &config.DatabaseConfig{
-		Host:     viper.GetString("ps.host"),
-		Port:     viper.GetInt("ps.port"),
-		Username: viper.GetString("ps.user"),
-		Password: viper.GetString("ps.password"),
-		Database: "postgres", // Connect to postgres database for admin operations
-		SSLMode:  viper.GetString("ps.sslmode"),
+	server := config.DatabaseConfig{
+		Host:          viper.GetString("ps.host"),
+		Port:          viper.GetInt("ps.port"),
+		Username:      viper.GetString("ps.user"),
+		Password:      viper.GetString("ps.password"),
+		SSLMode:       viper.GetString("ps.sslmode"),
+		AdminDatabase: viper.GetString("ps.admin_database"),
 	}
+	// Connect to the maintenance database for admin operations
+	dbConfig := server.Admin()
 	outputFormat := viper.GetString("ps.output_format")
 	quiet := viper.GetBool("ps.quiet")
 
-	conn, err := db.NewConnection(dbConfig)
+	conn, err := db.NewConnection(&dbConfig)
 	if err != nil {
 		return outputPsResult(&PsResult{
 			Format:  outputFormat,
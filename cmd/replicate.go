@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// ReplicateResult represents the result of setting up replication
+type ReplicateResult struct {
+	Format      string                  `json:"format"`
+	Success     bool                    `json:"success"`
+	Message     string                  `json:"message,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	Source      string                  `json:"source,omitempty"`
+	Database    string                  `json:"database,omitempty"`
+	Replication *fork.ReplicationResult `json:"replication,omitempty"`
+	Duration    string                  `json:"duration"`
+}
+
+// replicateCmd represents the replicate command
+var replicateCmd = &cobra.Command{
+	Use:   "replicate",
+	Short: "Keep a fork continuously updated with logical replication",
+	Long: `Set up logical replication from the source database into a target database.
+
+A fork is a snapshot; replicate creates a copy that keeps following the source:
+- Copies the schema of the chosen tables (--include-tables, default all) with pg_dump
+- Creates a publication and a logical replication slot on the source
+- Creates a subscription on the target, which copies the existing rows and then
+  streams every change
+
+The source needs wal_level = logical and a user allowed to create publications and
+replication slots. The publication, slot and subscription are named
+pgfork_<target database> unless given. If a step fails, the objects created before it
+are dropped again.
+
+To stop replicating, drop the subscription on the target (DROP SUBSCRIPTION), which
+also drops the slot on the source, then drop the publication on the source.
+
+Examples:
+  # Replicate two tables into a reporting database on another server
+  postgres-db-fork replicate --source-host prod --source-db myapp \
+    --dest-host reporting --target-db myapp_live --include-tables orders,customers
+
+  # The destination server reaches the source on a private address
+  postgres-db-fork replicate --source-db myapp --target-db myapp_live \
+    --source-conninfo "host=10.0.0.5 dbname=myapp user=replicator"
+
+  # Subscribe a database whose schema is already in place
+  postgres-db-fork replicate --source-db myapp --target-db myapp_live --skip-schema`,
+	RunE: runReplicate,
+}
+
+func init() {
+	rootCmd.AddCommand(replicateCmd)
+
+	// Source database flags
+	replicateCmd.Flags().String("source-uri", "", "Source database URI, replaces the individual source flags")
+	replicateCmd.Flags().String("source", "", "Source database URI or heroku:<app>::<config var> reference (alias for --source-uri)")
+	replicateCmd.Flags().String("source-host", "localhost", "Source database host, or comma-separated hosts tried in order (host:port, [IPv6 address]:port)")
+	replicateCmd.Flags().Int("source-port", 5432, "Source database port")
+	replicateCmd.Flags().String("source-user", "", "Source database username")
+	replicateCmd.Flags().String("source-password", "", "Source database password")
+	replicateCmd.Flags().Bool("source-password-stdin", false, "Read the source database password from standard input")
+	replicateCmd.Flags().String("source-db", "", "Source database name (required)")
+	replicateCmd.Flags().String("source-sslmode", "prefer", "Source database SSL mode")
+
+	// Destination database flags
+	replicateCmd.Flags().String("dest-uri", "", "Destination server URI, replaces the individual destination flags")
+	replicateCmd.Flags().String("dest-host", "", "Destination database host, or comma-separated hosts tried in order (defaults to source-host)")
+	replicateCmd.Flags().Int("dest-port", 0, "Destination database port (defaults to source-port)")
+	replicateCmd.Flags().String("dest-user", "", "Destination database username (defaults to source-user)")
+	replicateCmd.Flags().String("dest-password", "", "Destination database password (defaults to source-password)")
+	replicateCmd.Flags().Bool("dest-password-stdin", false, "Read the destination database password from standard input")
+	replicateCmd.Flags().String("dest-sslmode", "", "Destination database SSL mode (defaults to source-sslmode)")
+	replicateCmd.Flags().String("admin-db", "", "Maintenance database on the destination server for admin connections (default: postgres)")
+	replicateCmd.Flags().String("target-db", "", "Target database name (required, supports templates)")
+
+	// Replication options
+	replicateCmd.Flags().StringSlice("include-tables", []string{}, "Tables to replicate (default: all tables)")
+	replicateCmd.Flags().String("table-pattern-mode", "glob", "How --include-tables is matched: glob (e.g. audit_*, analytics.*) or regex")
+	replicateCmd.Flags().String("publication", "", "Publication name on the source (default: pgfork_<target-db>)")
+	replicateCmd.Flags().String("slot", "", "Replication slot name on the source (default: pgfork_<target-db>)")
+	replicateCmd.Flags().String("subscription", "", "Subscription name on the target (default: pgfork_<target-db>)")
+	replicateCmd.Flags().Bool("skip-schema", false, "Do not copy the schema; the target database and tables must already exist")
+	replicateCmd.Flags().String("source-conninfo", "", "Connection string the destination server uses to reach the source (default: the source connection)")
+	replicateCmd.Flags().Duration("timeout", 30*time.Minute, "Timeout for the setup (the initial row copy continues in the background)")
+	replicateCmd.Flags().StringToString("template-var", map[string]string{}, "Template variables (e.g., --template-var PR_NUMBER=123)")
+
+	// Output options
+	replicateCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+	replicateCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterOptions(
+		replicatePublicationOpt, replicateSlotOpt, replicateSubscriptionOpt, replicateSkipSchemaOpt,
+		replicateConnInfoOpt,
+	)
+}
+
+// Replicate options, resolved through the shared options builder
+var (
+	replicatePublicationOpt  = config.Option{Key: "replicate.publication", Env: []string{"PGFORK_REPLICATE_PUBLICATION"}, Flag: "publication"}
+	replicateSlotOpt         = config.Option{Key: "replicate.slot", Env: []string{"PGFORK_REPLICATE_SLOT"}, Flag: "slot"}
+	replicateSubscriptionOpt = config.Option{Key: "replicate.subscription", Env: []string{"PGFORK_REPLICATE_SUBSCRIPTION"}, Flag: "subscription"}
+	replicateSkipSchemaOpt   = config.Option{Key: "replicate.skip_schema", Env: []string{"PGFORK_REPLICATE_SKIP_SCHEMA"}, Flag: "skip-schema"}
+	replicateConnInfoOpt     = config.Option{Key: "replicate.source_conninfo", Env: []string{"PGFORK_REPLICATE_SOURCE_CONNINFO"}, Flag: "source-conninfo"}
+)
+
+func runReplicate(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	fail := func(err error) error {
+		return outputReplicateResult(&ReplicateResult{
+			Format:  outputFormat,
+			Success: false,
+			Error:   err.Error(),
+		}, quiet)
+	}
+
+	cfg, err := builder.BuildForkConfig()
+	if err != nil {
+		return fail(fmt.Errorf("configuration error: %w", err))
+	}
+	if cfg.Source.Database == "" {
+		return fail(fmt.Errorf("source database is required (use --source-db, --source-uri or PGFORK_SOURCE_DATABASE)"))
+	}
+	if cfg.TargetDatabase == "" {
+		return fail(fmt.Errorf("target database is required (use --target-db or PGFORK_TARGET_DATABASE)"))
+	}
+	if err := cfg.ProcessTemplates(); err != nil {
+		return fail(fmt.Errorf("template processing failed: %w", err))
+	}
+	if err := cfg.Validate(); err != nil {
+		return fail(fmt.Errorf("configuration validation failed: %w", err))
+	}
+
+	opts := fork.ReplicationOptions{}
+	if opts.Publication, err = builder.GetString(replicatePublicationOpt, ""); err != nil {
+		return fail(err)
+	}
+	if opts.Slot, err = builder.GetString(replicateSlotOpt, ""); err != nil {
+		return fail(err)
+	}
+	if opts.Subscription, err = builder.GetString(replicateSubscriptionOpt, ""); err != nil {
+		return fail(err)
+	}
+	if opts.SkipSchema, err = builder.GetBool(replicateSkipSchemaOpt, false); err != nil {
+		return fail(err)
+	}
+	if opts.SourceConnInfo, err = builder.GetString(replicateConnInfoOpt, ""); err != nil {
+		return fail(err)
+	}
+
+	if err := newPasswordInput(cmd).resolveForkPasswords(cfg); err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	replication, err := fork.Replicate(ctx, cfg, opts, logging.GetGlobalLogger())
+	if err != nil {
+		return fail(err)
+	}
+
+	return outputReplicateResult(&ReplicateResult{
+		Format:      outputFormat,
+		Success:     true,
+		Message:     fmt.Sprintf("Replicating %s into %s", cfg.Source.Database, cfg.TargetDatabase),
+		Source:      cfg.Source.Database,
+		Database:    cfg.TargetDatabase,
+		Replication: replication,
+		Duration:    time.Since(start).String(),
+	}, quiet)
+}
+
+// replicateView renders the replication result, with the quiet flag that text output
+// needs. Its JSON encoding is the ReplicateResult.
+type replicateView struct {
+	*ReplicateResult
+	quiet bool
+}
+
+// WriteText writes the replication set up and how to follow it, or only the error in quiet mode
+func (v replicateView) WriteText(w io.Writer) error {
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+	if v.quiet {
+		return nil
+	}
+
+	r := v.Replication
+	fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	fmt.Fprintf(w, "Publication: %s (source)\n", r.Publication)
+	fmt.Fprintf(w, "Slot: %s, starting at %s (source)\n", r.Slot, r.SlotLSN)
+	fmt.Fprintf(w, "Subscription: %s (target)\n", r.Subscription)
+	if len(r.Tables) > 0 {
+		fmt.Fprintf(w, "Tables: %v\n", r.Tables)
+	}
+	fmt.Fprintln(w, "The initial row copy runs in the background; follow it in pg_stat_subscription on the target.")
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// outputReplicateResult outputs the replication result in the specified format
+func outputReplicateResult(result *ReplicateResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, replicateView{ReplicateResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/heroku"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -30,6 +34,14 @@ Features:
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	if cmd, ok := helpJSONCommand(os.Args[1:]); ok {
+		if err := printCommandHelpJSON(os.Stdout, cmd); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -45,6 +57,8 @@ func init() {
 	rootCmd.PersistentFlags().Bool("verbose", false, "Enable verbose output")
 	rootCmd.PersistentFlags().Bool("no-color", false, "Disable colored output")
 	rootCmd.PersistentFlags().Bool("force", false, "Skip confirmation prompts")
+	rootCmd.PersistentFlags().String("profile", "", "Configuration profile to apply (see 'profile list')")
+	rootCmd.PersistentFlags().Bool("no-password-prompt", false, "Never prompt for missing database passwords")
 
 	// Bind flags to viper
 	if err := viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level")); err != nil {
@@ -59,6 +73,113 @@ func init() {
 	if err := viper.BindPFlag("force", rootCmd.PersistentFlags().Lookup("force")); err != nil {
 		fmt.Printf("Failed to bind flag: %v\n", err)
 	}
+	config.RegisterKeys("log-level", "verbose", "no-color", "force")
+}
+
+// configFileSettings exposes the values read from the config file to the options builder
+type configFileSettings struct{}
+
+func (configFileSettings) IsSet(key string) bool      { return viper.InConfig(key) }
+func (configFileSettings) Get(key string) interface{} { return viper.Get(key) }
+
+// All returns the settings read from the config file, leaving out the flags bound to viper
+func (configFileSettings) All() map[string]interface{} {
+	return inConfig("", viper.AllSettings())
+}
+
+// inConfig returns the entries of settings under prefix that come from the config file
+func inConfig(prefix string, settings map[string]interface{}) map[string]interface{} {
+	entries := make(map[string]interface{})
+	for key, value := range settings {
+		if !viper.InConfig(prefix + key) {
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = inConfig(prefix+key+".", nested)
+		}
+		entries[key] = value
+	}
+	return entries
+}
+
+// newOptionsBuilder returns an options builder layering the config file, the selected
+// profile, PGFORK_* environment variables and the command's flags
+func newOptionsBuilder(cmd *cobra.Command) (*config.OptionsBuilder, error) {
+	if err := config.CheckKeys(configFileSettings{}.All()); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", viper.ConfigFileUsed(), err)
+	}
+	builder := config.NewOptionsBuilder(cmd.Flags()).WithSettings(configFileSettings{}).
+		WithURIResolver(heroku.Scheme, heroku.FromEnvironment().ResolveURI)
+
+	profileName, _ := cmd.Flags().GetString("profile")
+	if profileName == "" {
+		profileName = os.Getenv("PGFORK_PROFILE")
+	}
+	if profileName != "" {
+		settings, err := profileSettings(profileName)
+		if err != nil {
+			return nil, err
+		}
+		builder.WithSettings(settings)
+	}
+
+	return builder, nil
+}
+
+// profileSettings returns the settings of a saved profile, rejecting unknown keys
+func profileSettings(name string) (config.MapSettings, error) {
+	store, err := getProfileStore()
+	if err != nil {
+		return nil, err
+	}
+	profile, exists := store.Profiles[name]
+	if !exists {
+		return nil, fmt.Errorf("profile '%s' not found", name)
+	}
+	if err := config.CheckKeys(profile.Config); err != nil {
+		return nil, fmt.Errorf("profile '%s': %w", name, err)
+	}
+	return config.MapSettings(profile.Config), nil
+}
+
+// databaseConnection resolves the connection of a command working on one database of
+// the server, named by its first argument or the target database option. A configured
+// URI names its own database, so it is replaced by its settings when one is named.
+func databaseConnection(builder *config.OptionsBuilder, command string, args []string) (*config.DatabaseConfig, error) {
+	dbConfig, err := builder.BuildConnection(config.ServerConnection(command), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return nil, err
+	}
+	target, err := builder.GetString(config.OptTargetDatabase, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		target = args[0]
+	}
+	if target != "" {
+		*dbConfig = dbConfig.WithDatabase(target)
+	}
+	return dbConfig, nil
+}
+
+// attachMetadataCache serves conn's size and table lookups from the server's metadata
+// cache when a cache TTL is configured
+func attachMetadataCache(builder *config.OptionsBuilder, conn *db.Connection) error {
+	ttl, err := builder.GetDuration(config.OptCacheTTL, 0)
+	if err != nil || ttl <= 0 {
+		return err
+	}
+	dir, err := builder.GetString(config.OptCacheDir, "")
+	if err != nil {
+		return err
+	}
+	conn.Cache = db.OpenMetadataCache(dir, conn.Config, ttl)
+	return nil
 }
 
 // initConfig reads in config file and ENV variables if set.
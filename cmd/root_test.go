@@ -3,12 +3,16 @@ package cmd
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
 )
 
 func TestRootCmd(t *testing.T) {
@@ -254,3 +258,66 @@ func TestDefaultValues(t *testing.T) {
 	force := viper.GetBool("force")
 	assert.False(t, force) // Should default to false
 }
+
+func TestExampleConfigsUseKnownKeys(t *testing.T) {
+	files, err := filepath.Glob("../examples/*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			var settings map[string]interface{}
+			require.NoError(t, yaml.Unmarshal(data, &settings))
+			assert.NoError(t, config.CheckKeys(settings))
+		})
+	}
+}
+
+func TestConfigFileSettingsAll(t *testing.T) {
+	defer viper.Reset()
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader("source:\n  host: prod\ndrop_if_exist: true\n")))
+	require.NoError(t, viper.BindPFlag("source.port", forkCmd.Flags().Lookup("source-port")))
+
+	settings := configFileSettings{}.All()
+	assert.Equal(t, map[string]interface{}{
+		"source":        map[string]interface{}{"host": "prod"},
+		"drop_if_exist": true,
+	}, settings)
+	assert.EqualError(t, config.CheckKeys(settings), "unknown config key drop_if_exist (did you mean drop_if_exists?)")
+}
+
+func TestDatabaseConnection(t *testing.T) {
+	t.Setenv("PGFORK_DEST_URI", "postgresql://app@db.internal:6432/postgres")
+
+	for _, tc := range []struct {
+		name    string
+		command *cobra.Command
+		server  string
+		args    []string
+	}{
+		{"check-sequences", checkSequencesCmd, "check_sequences", []string{"feature_db"}},
+		{"export", exportCmd, "export", []string{"feature_db"}},
+		{"import", importCmd, "import", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			builder := config.NewOptionsBuilder(tc.command.Flags())
+			dbConfig, err := databaseConnection(builder, tc.server, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "postgres", dbConfig.Database, "without a database named, the URI's own is used")
+
+			if tc.args == nil {
+				t.Setenv("PGFORK_TARGET_DATABASE", "feature_db")
+			}
+			dbConfig, err = databaseConnection(builder, tc.server, tc.args)
+			require.NoError(t, err)
+			assert.Empty(t, dbConfig.URI)
+			assert.Equal(t, "db.internal", dbConfig.Host)
+			assert.Equal(t, "feature_db", dbConfig.Database)
+			assert.Contains(t, dbConfig.ConnectionString(), "dbname=feature_db")
+		})
+	}
+}
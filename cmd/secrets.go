@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// passwordInput reads secrets that should not appear in shell history or in the
+// process arguments visible to ps
+type passwordInput struct {
+	cmd   *cobra.Command
+	stdin io.Reader
+	// stdinUsed records which flag consumed standard input, as it can only be read once
+	stdinUsed string
+	// interactive reports whether missing passwords may be prompted for
+	interactive bool
+}
+
+// newPasswordInput prepares password resolution for the command. Prompting is only
+// enabled when both stdin and stderr are terminals and --no-password-prompt is not set.
+func newPasswordInput(cmd *cobra.Command) *passwordInput {
+	noPrompt, _ := cmd.Flags().GetBool("no-password-prompt")
+	return &passwordInput{
+		cmd:         cmd,
+		stdin:       os.Stdin,
+		interactive: !noPrompt && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+// resolve fills in the password for dbConfig. A password read with stdinFlag takes
+// precedence over every other source; otherwise the user is prompted when no password
+// was configured and libpq has no other way of finding one.
+func (p *passwordInput) resolve(dbConfig *config.DatabaseConfig, stdinFlag, label string) error {
+	if p.flagSet(stdinFlag) {
+		if p.stdinUsed != "" {
+			return fmt.Errorf("--%s cannot be combined with --%s, standard input can only be read once", stdinFlag, p.stdinUsed)
+		}
+		p.stdinUsed = stdinFlag
+
+		password, err := readPasswordFromStdin(p.stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read --%s: %w", stdinFlag, err)
+		}
+		dbConfig.SetPassword(password)
+		return nil
+	}
+
+	if dbConfig.Password != "" || !p.interactive || hasExternalPassword() {
+		return nil
+	}
+
+	var password string
+	prompt := &survey.Password{Message: fmt.Sprintf("%s password for %s:", label, dbConfig.Redacted())}
+	if err := survey.AskOne(prompt, &password, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr)); err != nil {
+		return fmt.Errorf("password prompt failed: %w", err)
+	}
+	dbConfig.SetPassword(password)
+	return nil
+}
+
+// resolveForkPasswords fills in the source and destination passwords of a fork
+// configuration. A destination on the same server as the source reuses its password.
+func (p *passwordInput) resolveForkPasswords(cfg *config.ForkConfig) error {
+	if err := p.resolve(&cfg.Source, "source-password-stdin", "Source"); err != nil {
+		return err
+	}
+
+	if cfg.Destination.Password == "" && cfg.IsSameServer() && !p.flagSet("dest-password-stdin") {
+		cfg.Destination.SetPassword(cfg.Source.Password)
+		return nil
+	}
+	return p.resolve(&cfg.Destination, "dest-password-stdin", "Destination")
+}
+
+// flagSet reports whether a boolean flag was enabled on the command
+func (p *passwordInput) flagSet(name string) bool {
+	value, _ := p.cmd.Flags().GetBool(name)
+	return value
+}
+
+// readPasswordFromStdin reads the first line of r, without its line terminator
+func readPasswordFromStdin(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password provided on standard input")
+	}
+	return password, nil
+}
+
+// hasExternalPassword reports whether libpq can find a password without our help,
+// either through PGPASSWORD or a password file
+func hasExternalPassword() bool {
+	if os.Getenv("PGPASSWORD") != "" {
+		return true
+	}
+
+	passFile := os.Getenv("PGPASSFILE")
+	if passFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		passFile = filepath.Join(home, ".pgpass")
+	}
+	_, err := os.Stat(passFile)
+	return err == nil
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/selfupdate"
+
+	"github.com/spf13/cobra"
+)
+
+// ReleasePublicKey is the base64 Ed25519 public key that release checksums are signed
+// with, set by linker flags in release builds
+var ReleasePublicKey = ""
+
+// SelfUpdateResult represents the result of a self-update
+type SelfUpdateResult struct {
+	Format         string `json:"format"`
+	Success        bool   `json:"success"`
+	Message        string `json:"message,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Channel        string `json:"channel,omitempty"`
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version,omitempty"`
+	Updated        bool   `json:"updated"`
+	Duration       string `json:"duration"`
+}
+
+// selfUpdateCmd represents the self-update command
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update postgres-db-fork to the latest release",
+	Long: `Replace the running binary with the latest GitHub release of its channel.
+
+The stable channel follows full releases; edge also follows prereleases. The channel
+can be set in the config file (self_update.channel) or with PGFORK_UPDATE_CHANNEL.
+A release is only installed when it is newer than the running version, so a build
+on edge is never downgraded by a later stable check.
+
+Each release publishes checksums.txt, the SHA-256 of every archive, signed with the
+project's release key. The downloaded archive must match its checksum and the
+checksums must carry a valid signature from the key built into the binary. Builds
+without a key (such as builds from source) refuse to update unless
+--insecure-skip-signature accepts checksums alone.
+
+Set GITHUB_TOKEN to raise the GitHub API rate limit on shared CI runners.
+
+Examples:
+  # Update to the latest stable release
+  postgres-db-fork self-update
+
+  # Only report whether an update is available
+  postgres-db-fork self-update --check --output-format json
+
+  # Follow prereleases
+  postgres-db-fork self-update --channel edge`,
+	RunE: runSelfUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+
+	selfUpdateCmd.Flags().String("channel", string(selfupdate.ChannelStable), "Release channel: stable or edge")
+	selfUpdateCmd.Flags().Bool("check", false, "Only report whether a newer release is available")
+	selfUpdateCmd.Flags().Bool("insecure-skip-signature", false, "Accept a release verified by its checksum alone, without a signature")
+	selfUpdateCmd.Flags().Duration("timeout", 5*time.Minute, "Timeout for checking and downloading the release")
+
+	// Output options
+	selfUpdateCmd.Flags().String("output-format", "text", "Output format: text or json")
+	selfUpdateCmd.Flags().Bool("quiet", false, "Suppress output except errors")
+
+	// Keys this command reads from config files
+	config.RegisterOptions(selfUpdateChannelOpt, selfUpdateTimeoutOpt)
+}
+
+// Self-update options, resolved through the shared options builder
+var (
+	selfUpdateChannelOpt = config.Option{Key: "self_update.channel", Env: []string{"PGFORK_UPDATE_CHANNEL"}, Flag: "channel"}
+	selfUpdateTimeoutOpt = config.Option{Key: "self_update.timeout", Env: []string{"PGFORK_UPDATE_TIMEOUT"}, Flag: "timeout"}
+)
+
+func runSelfUpdate(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	result := &SelfUpdateResult{
+		Format:         outputFormat,
+		Success:        true,
+		CurrentVersion: Version,
+	}
+	fail := func(err error) error {
+		result.Success = false
+		result.Error = err.Error()
+		result.Duration = time.Since(start).String()
+		return outputSelfUpdateResult(result, quiet)
+	}
+
+	channelName, err := builder.GetString(selfUpdateChannelOpt, string(selfupdate.ChannelStable))
+	if err != nil {
+		return fail(err)
+	}
+	channel, err := selfupdate.ParseChannel(channelName)
+	if err != nil {
+		return fail(err)
+	}
+	result.Channel = string(channel)
+	timeout, err := builder.GetDuration(selfUpdateTimeoutOpt, 5*time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+	checkOnly, _ := cmd.Flags().GetBool("check")
+	skipSignature, _ := cmd.Flags().GetBool("insecure-skip-signature")
+
+	publicKey, err := releasePublicKey()
+	if err != nil {
+		return fail(err)
+	}
+	if publicKey == nil && !skipSignature && !checkOnly {
+		return fail(fmt.Errorf("this build has no release signing key; use --insecure-skip-signature to verify releases by checksum only"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	updater := selfupdate.NewUpdater(publicKey)
+	updater.Token = os.Getenv("GITHUB_TOKEN")
+	release, err := updater.Latest(ctx, channel)
+	if err != nil {
+		return fail(fmt.Errorf("failed to find the latest %s release: %w", channel, err))
+	}
+	result.LatestVersion = release.Tag
+
+	if !selfupdate.Newer(release.Tag, Version) {
+		result.Message = fmt.Sprintf("Already up to date (%s, latest %s release is %s)", Version, channel, release.Tag)
+		result.Duration = time.Since(start).String()
+		return outputSelfUpdateResult(result, quiet)
+	}
+	if checkOnly {
+		result.Message = fmt.Sprintf("Update available: %s -> %s", Version, release.Tag)
+		result.Duration = time.Since(start).String()
+		return outputSelfUpdateResult(result, quiet)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fail(fmt.Errorf("failed to locate the running binary: %w", err))
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fail(fmt.Errorf("failed to locate the running binary: %w", err))
+	}
+
+	binary, err := updater.Download(ctx, release, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return fail(err)
+	}
+	if err := selfupdate.Replace(executable, binary); err != nil {
+		return fail(err)
+	}
+
+	result.Updated = true
+	result.Message = fmt.Sprintf("Updated %s from %s to %s", executable, Version, release.Tag)
+	result.Duration = time.Since(start).String()
+	return outputSelfUpdateResult(result, quiet)
+}
+
+// releasePublicKey decodes ReleasePublicKey, returning nil when the build has none
+func releasePublicKey() (ed25519.PublicKey, error) {
+	if ReleasePublicKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(ReleasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("built-in release signing key is not a base64 Ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// outputSelfUpdateResult outputs the self-update result in the specified format
+func outputSelfUpdateResult(result *SelfUpdateResult, quiet bool) error {
+	if result.Format == "json" {
+		jsonOutput, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON output: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+	} else if !quiet || !result.Success {
+		if result.Success {
+			fmt.Printf("✅ %s\n", result.Message)
+			fmt.Printf("Duration: %s\n", result.Duration)
+		} else {
+			fmt.Printf("❌ %s\n", result.Error)
+		}
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
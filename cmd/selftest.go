@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/synthetic"
+
+	"github.com/spf13/cobra"
+)
+
+// SelftestResult represents the result of a selftest run
+type SelftestResult struct {
+	Format        string           `json:"format"`
+	Success       bool             `json:"success"`
+	Message       string           `json:"message,omitempty"`
+	Error         string           `json:"error,omitempty"`
+	Server        string           `json:"server,omitempty"`
+	ServerVersion string           `json:"server_version,omitempty"`
+	ToolVersion   string           `json:"tool_version"`
+	Database      string           `json:"database,omitempty"`
+	Rows          int              `json:"rows"`
+	SetupDuration string           `json:"setup_duration,omitempty"`
+	Engines       []SelftestEngine `json:"engines,omitempty"`
+	// Leftovers are test databases that could not be dropped
+	Leftovers []string `json:"leftovers,omitempty"`
+	Duration  string   `json:"duration"`
+}
+
+// SelftestEngine is the outcome of forking the test database with one engine
+type SelftestEngine struct {
+	Engine  string `json:"engine"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Target is the fork, dropped again after verification
+	Target         string `json:"target"`
+	Tables         int    `json:"tables"`
+	Rows           int64  `json:"rows"`
+	ForkDuration   string `json:"fork_duration,omitempty"`
+	VerifyDuration string `json:"verify_duration,omitempty"`
+}
+
+// selftestEngines are the fork methods selftest exercises, in the order they run
+var selftestEngines = []fork.Method{fork.MethodTemplate, fork.MethodTransfer}
+
+// selftestSchema is the test database: a parent and child table with the keys,
+// constraints, index and view a real schema has
+var selftestSchema = []string{
+	`CREATE TABLE customers (
+		id serial PRIMARY KEY,
+		email varchar(100) NOT NULL UNIQUE,
+		name text,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE orders (
+		id bigserial PRIMARY KEY,
+		customer_id integer NOT NULL REFERENCES customers (id),
+		status text NOT NULL CHECK (status IN ('new', 'paid', 'shipped')),
+		total numeric(10, 2) NOT NULL CHECK (total >= 0),
+		ordered_at timestamptz NOT NULL
+	)`,
+	`CREATE INDEX orders_customer_id_idx ON orders (customer_id)`,
+	`CREATE VIEW customer_totals AS
+		SELECT customer_id, count(*) AS orders, sum(total) AS total FROM orders GROUP BY customer_id`,
+}
+
+// selftestCmd represents the selftest command
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Fork a small test database with each engine and report timings",
+	Long: `Smoke test the fork infrastructure of a server, e.g. after upgrading PostgreSQL
+or this tool.
+
+selftest creates a small database of synthetic data on the server, forks it with
+each engine, verifies every fork row by row against the test database, and drops
+all of them again. Engines:
+  template  CREATE DATABASE ... TEMPLATE on the same server
+  transfer  pg_dump/pg_restore, which also needs the PostgreSQL client tools
+
+The whole run is bounded by --timeout. Test databases are named
+pgfork_selftest_<time> and are dropped even when a step fails; any that cannot be
+dropped are reported. The command exits non-zero if any engine fails.
+
+The server is read from --against, a saved profile, or from the usual flags,
+PGFORK_SELFTEST_* and PGFORK_DEST_* variables and the config file.
+
+Examples:
+  # Test the server of the staging profile
+  postgres-db-fork selftest --against staging
+
+  # Test one engine with more data
+  postgres-db-fork selftest --host localhost --user postgres --engines transfer --rows 5000
+
+  # JSON report for monitoring
+  postgres-db-fork selftest --against staging --output-format json`,
+	RunE: runSelftest,
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+
+	selftestCmd.Flags().String("against", "", "Profile naming the server to test (see 'profile list')")
+
+	// Database connection flags
+	selftestCmd.Flags().String("host", "localhost", "Database server host")
+	selftestCmd.Flags().Int("port", 5432, "Database server port")
+	selftestCmd.Flags().String("user", "", "Database username (needs CREATEDB)")
+	selftestCmd.Flags().String("password", "", "Database password")
+	selftestCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	selftestCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	selftestCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
+
+	// Test options
+	selftestCmd.Flags().StringSlice("engines", []string{"template", "transfer"}, "Engines to test: template, transfer")
+	selftestCmd.Flags().Int("rows", 1000, "Rows of synthetic data per table")
+	selftestCmd.Flags().Duration("timeout", 10*time.Minute, "Time limit for the whole test")
+
+	// Output options
+	selftestCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(selftestCmd)
+	selftestCmd.Flags().Bool("quiet", false, "Print only the final result")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("selftest")
+	config.RegisterOptions(selftestEnginesOpt, selftestRowsOpt, selftestTimeoutOpt)
+}
+
+// Selftest options, resolved through the shared options builder
+var (
+	selftestEnginesOpt = config.Option{Key: "selftest.engines", Env: []string{"PGFORK_SELFTEST_ENGINES"}, Flag: "engines"}
+	selftestRowsOpt    = config.Option{Key: "selftest.rows", Env: []string{"PGFORK_SELFTEST_ROWS"}, Flag: "rows"}
+	selftestTimeoutOpt = config.Option{Key: "selftest.timeout", Env: []string{"PGFORK_SELFTEST_TIMEOUT"}, Flag: "timeout"}
+)
+
+func runSelftest(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+	if against, _ := cmd.Flags().GetString("against"); against != "" {
+		settings, err := profileSettings(against)
+		if err != nil {
+			return err
+		}
+		builder.WithSettings(settings)
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	result := &SelftestResult{
+		Format:      outputFormat,
+		Success:     true,
+		ToolVersion: fork.ToolVersion,
+	}
+	// Test databases are dropped before any result is written, as a failed result
+	// exits the process; they are dropped even when the time is up
+	var created []string
+	var admin *db.Connection
+	dropCreated := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for _, database := range created {
+			if err := admin.DropDatabaseContext(ctx, database); err != nil {
+				result.Leftovers = append(result.Leftovers, database)
+			}
+		}
+		created = nil
+	}
+	fail := func(err error) error {
+		dropCreated()
+		result.Success = false
+		result.Error = err.Error()
+		if len(result.Leftovers) > 0 {
+			result.Error += fmt.Sprintf(" (could not drop %s)", strings.Join(result.Leftovers, ", "))
+		}
+		result.Duration = time.Since(start).String()
+		return outputSelftestResult(result, quiet)
+	}
+
+	dbConfig, err := builder.BuildConnection(config.ServerConnection("selftest"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return fail(err)
+	}
+	*dbConfig = dbConfig.Admin()
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --against, --user or PGFORK_SELFTEST_USER)"))
+	}
+	result.Server = dbConfig.Redacted()
+
+	engineNames, err := builder.GetStringSlice(selftestEnginesOpt, []string{"template", "transfer"})
+	if err != nil {
+		return fail(err)
+	}
+	engines, err := parseSelftestEngines(engineNames)
+	if err != nil {
+		return fail(err)
+	}
+	if result.Rows, err = builder.GetInt(selftestRowsOpt, 1000); err != nil {
+		return fail(err)
+	}
+	if result.Rows < 1 || result.Rows > 1000000 {
+		return fail(fmt.Errorf("rows must be between 1 and 1000000, got %d", result.Rows))
+	}
+	timeout, err := builder.GetDuration(selftestTimeoutOpt, 10*time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	admin, err = db.NewConnectionContext(ctx, dbConfig)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to server: %w", err))
+	}
+	defer func() {
+		if err := admin.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+	if result.ServerVersion, err = admin.GetVersionContext(ctx); err != nil {
+		return fail(err)
+	}
+
+	result.Database = fmt.Sprintf("pgfork_selftest_%d", time.Now().Unix())
+	created = append(created, result.Database)
+
+	setupStart := time.Now()
+	if err := createSelftestDatabase(ctx, admin, dbConfig, result.Database, result.Rows); err != nil {
+		return fail(timedOut(ctx, timeout, fmt.Errorf("failed to create test database: %w", err)))
+	}
+	result.SetupDuration = time.Since(setupStart).String()
+
+	for _, engine := range engines {
+		outcome := SelftestEngine{
+			Engine: string(engine),
+			Target: result.Database + "_" + string(engine),
+		}
+		created = append(created, outcome.Target)
+		if err := runSelftestEngine(ctx, dbConfig, result.Database, engine, &outcome); err != nil {
+			outcome.Error = timedOut(ctx, timeout, err).Error()
+		}
+		outcome.Success = outcome.Error == ""
+		result.Engines = append(result.Engines, outcome)
+		if !outcome.Success {
+			result.Success = false
+		}
+	}
+
+	dropCreated()
+
+	var failed []string
+	for _, engine := range result.Engines {
+		if !engine.Success {
+			failed = append(failed, engine.Engine)
+		}
+	}
+	if len(failed) > 0 {
+		result.Error = fmt.Sprintf("%d of %d engines failed: %s", len(failed), len(result.Engines), strings.Join(failed, ", "))
+	} else {
+		result.Message = fmt.Sprintf("All %d engines forked and verified the test database", len(result.Engines))
+	}
+	if len(result.Leftovers) > 0 {
+		note := fmt.Sprintf(" (could not drop %s)", strings.Join(result.Leftovers, ", "))
+		if result.Success {
+			result.Message += note
+		} else {
+			result.Error += note
+		}
+	}
+	result.Duration = time.Since(start).String()
+	return outputSelftestResult(result, quiet)
+}
+
+// parseSelftestEngines checks the engine names given on the command line
+func parseSelftestEngines(names []string) ([]fork.Method, error) {
+	var engines []fork.Method
+	for _, name := range names {
+		found := false
+		for _, engine := range selftestEngines {
+			if strings.EqualFold(name, string(engine)) {
+				engines = append(engines, engine)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown engine %q (available: template, transfer)", name)
+		}
+	}
+	if len(engines) == 0 {
+		return nil, fmt.Errorf("no engines to test")
+	}
+	return engines, nil
+}
+
+// timedOut explains an error caused by the selftest running out of time
+func timedOut(ctx context.Context, timeout time.Duration, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+// createSelftestDatabase creates the test database and fills it with synthetic rows
+func createSelftestDatabase(ctx context.Context, admin *db.Connection, server *config.DatabaseConfig, database string, rows int) error {
+	if err := admin.CreateDatabaseContext(ctx, database, "template0", false); err != nil {
+		return err
+	}
+	conn, err := connectDatabase(ctx, server, database)
+	if err != nil {
+		return err
+	}
+	// Template cloning needs the test database to have no connections
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	for _, statement := range selftestSchema {
+		if _, err := conn.DB.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	if _, err := synthetic.Generate(ctx, conn.DB, synthetic.Options{Rows: rows}); err != nil {
+		return fmt.Errorf("failed to generate data: %w", err)
+	}
+	return nil
+}
+
+// runSelftestEngine forks the test database with one engine and verifies the fork
+func runSelftestEngine(ctx context.Context, server *config.DatabaseConfig, database string, engine fork.Method, outcome *SelftestEngine) error {
+	cfg := &config.ForkConfig{
+		Source:         *server,
+		Destination:    *server,
+		TargetDatabase: outcome.Target,
+		MaxConnections: 2,
+		ChunkSize:      1000,
+		Timeout:        time.Hour,
+		ForceTransfer:  engine == fork.MethodTransfer,
+		OutputFormat:   "text",
+		Quiet:          true,
+		LogLevel:       "warn",
+		JobID:          "selftest-" + database,
+	}
+	cfg.Source.Database = database
+	cfg.Destination.Database = outcome.Target
+	if deadline, ok := ctx.Deadline(); ok {
+		cfg.Timeout = time.Until(deadline)
+	}
+	if method := fork.NewPlan(cfg).Method; method != engine {
+		return fmt.Errorf("the %s engine cannot fork on this server (plan chose %s)", engine, method)
+	}
+
+	forkStart := time.Now()
+	if err := fork.NewForker(cfg).Fork(ctx); err != nil {
+		return fmt.Errorf("fork failed: %w", err)
+	}
+	outcome.ForkDuration = time.Since(forkStart).String()
+
+	verifyStart := time.Now()
+	if err := verifySelftestFork(ctx, server, database, outcome); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	outcome.VerifyDuration = time.Since(verifyStart).String()
+	return nil
+}
+
+// verifySelftestFork compares every table of the fork with the test database by
+// primary key
+func verifySelftestFork(ctx context.Context, server *config.DatabaseConfig, database string, outcome *SelftestEngine) error {
+	source, err := connectDatabase(ctx, server, database)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := source.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+	target, err := connectDatabase(ctx, server, outcome.Target)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := target.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	keys, err := source.PrimaryKeysContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		diff, err := db.DiffTableDataContext(ctx, source, target, key, 64)
+		if err != nil {
+			return err
+		}
+		if !diff.Identical() {
+			return fmt.Errorf("%s differs: +%d added, -%d removed, ~%d changed", diff.Table, diff.Added, diff.Removed, diff.Changed)
+		}
+		outcome.Tables++
+		outcome.Rows += diff.RowsB
+	}
+	if outcome.Rows == 0 {
+		return fmt.Errorf("the fork has no rows")
+	}
+	return nil
+}
+
+// selftestView renders the selftest result, with the quiet flag that text output needs.
+// Its JSON encoding is the SelftestResult.
+type selftestView struct {
+	*SelftestResult
+	quiet bool
+}
+
+// WriteText writes how each engine did, or only the outcome in quiet mode
+func (v selftestView) WriteText(w io.Writer) error {
+	if !v.quiet && len(v.Engines) > 0 {
+		fmt.Fprintf(w, "🧪 Selftest of %s\n", v.Server)
+		fmt.Fprintf(w, "  Server: %s\n", v.ServerVersion)
+		fmt.Fprintf(w, "  Test database: %s (%d rows per table, created in %s)\n", v.Database, v.Rows, v.SetupDuration)
+		for _, engine := range v.Engines {
+			if engine.Success {
+				fmt.Fprintf(w, "  %s %-10s fork %s, verify %s (%d tables, %d rows)\n", output.StatusIcon("ok"),
+					engine.Engine, engine.ForkDuration, engine.VerifyDuration, engine.Tables, engine.Rows)
+			} else {
+				fmt.Fprintf(w, "  %s %-10s %s\n", output.StatusIcon("failed"), engine.Engine, engine.Error)
+			}
+		}
+	}
+	if v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+	}
+	return nil
+}
+
+// WritePorcelain writes the selftest result as porcelain records:
+//
+//	engine	<engine>	ok	<fork duration>	<verify duration>	<tables>	<rows>
+//	engine	<engine>	failed	<error>
+//	leftover	<database>
+func (v selftestView) WritePorcelain(w io.Writer) {
+	for _, engine := range v.Engines {
+		if engine.Success {
+			output.WritePorcelain(w, "engine", engine.Engine, "ok", engine.ForkDuration, engine.VerifyDuration, engine.Tables, engine.Rows)
+		} else {
+			output.WritePorcelain(w, "engine", engine.Engine, "failed", engine.Error)
+		}
+	}
+	for _, database := range v.Leftovers {
+		output.WritePorcelain(w, "leftover", database)
+	}
+}
+
+// Outcome reports whether every engine passed
+func (v selftestView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputSelftestResult outputs the selftest result in the specified format
+func outputSelftestResult(result *SelftestResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, selftestView{SelftestResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelftestEngines(t *testing.T) {
+	engines, err := parseSelftestEngines([]string{"Transfer", "template"})
+	require.NoError(t, err)
+	assert.Equal(t, []fork.Method{fork.MethodTransfer, fork.MethodTemplate}, engines)
+
+	_, err = parseSelftestEngines([]string{"logical"})
+	assert.EqualError(t, err, `unknown engine "logical" (available: template, transfer)`)
+
+	_, err = parseSelftestEngines(nil)
+	assert.EqualError(t, err, "no engines to test")
+}
+
+func TestWriteSelftestPorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, output.Render(&buf, output.Porcelain, selftestView{SelftestResult: &SelftestResult{
+		Engines: []SelftestEngine{
+			{Engine: "template", Success: true, ForkDuration: "1.2s", VerifyDuration: "40ms", Tables: 2, Rows: 2000},
+			{Engine: "transfer", Error: "fork failed: pg_dump not found"},
+		},
+		Leftovers: []string{"pgfork_selftest_1_transfer"},
+		Error:     "1 of 2 engines failed: transfer",
+	}}))
+	assert.Equal(t, "engine\ttemplate\tok\t1.2s\t40ms\t2\t2000\n"+
+		"engine\ttransfer\tfailed\tfork failed: pg_dump not found\n"+
+		"leftover\tpgfork_selftest_1_transfer\n"+
+		"status\terror\t1 of 2 engines failed: transfer\n", buf.String())
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
 
 	"github.com/spf13/cobra"
 )
@@ -283,7 +284,7 @@ func outputStatus(status *SystemStatus, outputFormat string) error {
 
 func printStatusText(status *SystemStatus) {
 	// Status header
-	statusIcon := getStatusIcon(status.Status)
+	statusIcon := output.StatusIcon(status.Status)
 	fmt.Printf("%s System Status: %s\n", statusIcon, status.Status)
 	fmt.Printf("Version: %s\n", status.Version)
 	fmt.Printf("Uptime: %s\n", status.Uptime)
@@ -302,7 +303,7 @@ func printStatusText(status *SystemStatus) {
 	// Resource status
 	fmt.Println("💻 Resources:")
 	fmt.Printf("  Memory: %s (%.1f%%)\n",
-		formatBytes(int64(status.Resources.MemoryUsed)),
+		output.FormatBytes(int64(status.Resources.MemoryUsed)),
 		status.Resources.MemoryPercent)
 	fmt.Printf("  Goroutines: %d\n", status.Resources.GoRoutines)
 	if status.Resources.FileDescriptors > 0 {
@@ -312,9 +313,9 @@ func printStatusText(status *SystemStatus) {
 
 	// Health status
 	fmt.Println("🏥 Health:")
-	fmt.Printf("  Config Valid: %s\n", getBoolIcon(status.Health.ConfigValid))
-	fmt.Printf("  State Directory: %s\n", getBoolIcon(status.Health.StateDirectoryOk))
-	fmt.Printf("  Logging: %s\n", getBoolIcon(status.Health.LoggingOk))
+	fmt.Printf("  Config Valid: %s\n", output.BoolIcon(status.Health.ConfigValid))
+	fmt.Printf("  State Directory: %s\n", output.BoolIcon(status.Health.StateDirectoryOk))
+	fmt.Printf("  Logging: %s\n", output.BoolIcon(status.Health.LoggingOk))
 	if status.Health.LastError != "" {
 		fmt.Printf("  Last Error: %s\n", status.Health.LastError)
 	}
@@ -331,25 +332,3 @@ func printStatusText(status *SystemStatus) {
 		fmt.Printf("  Last Error: %s\n", status.Connections.LastConnectError)
 	}
 }
-
-func getStatusIcon(status string) string {
-	switch status {
-	case "healthy":
-		return "✅"
-	case "degraded":
-		return "⚠️"
-	case "error":
-		return "❌"
-	default:
-		return "ℹ️"
-	}
-}
-
-func getBoolIcon(value bool) string {
-	if value {
-		return "✅ Yes"
-	}
-	return "❌ No"
-}
-
-// Note: formatBytes function is also defined in list.go - should be moved to a shared utility package
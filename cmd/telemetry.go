@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/telemetry"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// TelemetryEndpoint is where usage events are posted once telemetry is on, set by
+// linker flags in release builds and overridden by PGFORK_TELEMETRY_ENDPOINT
+var TelemetryEndpoint = ""
+
+// telemetryTimeout bounds how long a fork waits to report its usage
+const telemetryTimeout = 2 * time.Second
+
+var telemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "Show or change whether anonymous usage stats are reported",
+	Long: `Show or change whether anonymous usage stats are reported.
+
+Telemetry is off until you turn it on. Once on, each fork reports the engines and
+features it used, its duration in broad buckets such as 1m-10m, and the class of
+any error, such as a SQLSTATE class or timeout, to help prioritise work. Database
+and host names, table names, queries, error messages and sizes are never sent.
+
+The choice is stored in ~/.postgres-db-fork/telemetry.yaml. DO_NOT_TRACK=1 or
+PGFORK_TELEMETRY=off turn telemetry off whatever was chosen.
+
+Available subcommands:
+  status  - Show whether telemetry is on and what it sends
+  on      - Turn telemetry on
+  off     - Turn telemetry off
+
+Examples:
+  postgres-db-fork telemetry status
+  postgres-db-fork telemetry on`,
+}
+
+var telemetryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether telemetry is on and what it sends",
+	Args:  cobra.NoArgs,
+	RunE:  runTelemetryStatus,
+}
+
+var telemetryOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Turn anonymous usage stats on",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setTelemetry(cmd, true)
+	},
+}
+
+var telemetryOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Turn anonymous usage stats off",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setTelemetry(cmd, false)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(telemetryCmd)
+	telemetryCmd.AddCommand(telemetryStatusCmd)
+	telemetryCmd.AddCommand(telemetryOnCmd)
+	telemetryCmd.AddCommand(telemetryOffCmd)
+
+	for _, cmd := range []*cobra.Command{telemetryStatusCmd, telemetryOnCmd, telemetryOffCmd} {
+		cmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+	}
+}
+
+// telemetryStatus is the telemetry choice and where events go
+type telemetryStatus struct {
+	Enabled bool `json:"enabled"`
+	// DisabledByEnv is set when DO_NOT_TRACK or PGFORK_TELEMETRY turn telemetry off
+	DisabledByEnv bool   `json:"disabled_by_env"`
+	InstallID     string `json:"install_id,omitempty"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	SettingsFile  string `json:"settings_file"`
+}
+
+// WriteText writes the telemetry status for people
+func (s telemetryStatus) WriteText(w io.Writer) error {
+	state := "off"
+	if s.Enabled {
+		state = "on"
+	}
+	fmt.Fprintf(w, "Telemetry: %s\n", state)
+	if s.DisabledByEnv {
+		fmt.Fprintln(w, "Disabled by DO_NOT_TRACK or PGFORK_TELEMETRY; nothing is sent")
+	}
+	if s.InstallID != "" {
+		fmt.Fprintf(w, "Install ID: %s\n", s.InstallID)
+	}
+	if s.Endpoint != "" {
+		fmt.Fprintf(w, "Endpoint: %s\n", s.Endpoint)
+	} else {
+		fmt.Fprintln(w, "Endpoint: none in this build; nothing is sent")
+	}
+	fmt.Fprintf(w, "Settings: %s\n", s.SettingsFile)
+	if s.Enabled {
+		fmt.Fprintln(w, "Sent per fork: version, OS, engines, features used, duration bucket, error class")
+	}
+	return nil
+}
+
+func runTelemetryStatus(cmd *cobra.Command, args []string) error {
+	store, err := telemetry.NewStore("")
+	if err != nil {
+		return err
+	}
+	settings, err := store.Load()
+	if err != nil {
+		return err
+	}
+	outputFormat, _ := cmd.Flags().GetString("output-format")
+	return output.Render(os.Stdout, outputFormat, newTelemetryStatus(store, settings))
+}
+
+func setTelemetry(cmd *cobra.Command, enabled bool) error {
+	store, err := telemetry.NewStore("")
+	if err != nil {
+		return err
+	}
+	settings, err := store.SetEnabled(enabled)
+	if err != nil {
+		return err
+	}
+	outputFormat, _ := cmd.Flags().GetString("output-format")
+	return output.Render(os.Stdout, outputFormat, newTelemetryStatus(store, settings))
+}
+
+func newTelemetryStatus(store *telemetry.Store, settings *telemetry.Settings) telemetryStatus {
+	return telemetryStatus{
+		Enabled:       settings.Enabled,
+		DisabledByEnv: telemetry.Disabled(),
+		InstallID:     settings.InstallID,
+		Endpoint:      telemetryEndpoint(),
+		SettingsFile:  store.Path,
+	}
+}
+
+// telemetryEndpoint returns where usage events are posted, empty for none
+func telemetryEndpoint() string {
+	if endpoint := os.Getenv("PGFORK_TELEMETRY_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	return TelemetryEndpoint
+}
+
+// reportForkTelemetry posts the anonymous usage of a fork when telemetry is on.
+// Until a choice is made, the first fork run from a terminal says how to turn it
+// on instead. Failures are only logged at debug level.
+func reportForkTelemetry(cfg *config.ForkConfig, result forkResult) {
+	if telemetry.Disabled() {
+		return
+	}
+	store, err := telemetry.NewStore("")
+	if err != nil {
+		return
+	}
+	settings, err := store.Load()
+	if err != nil {
+		logrus.Debugf("Skipping telemetry: %v", err)
+		return
+	}
+	if !settings.Enabled {
+		if !settings.Noticed && config.DetectCI() == nil && term.IsTerminal(int(os.Stderr.Fd())) {
+			fmt.Fprintln(os.Stderr, "Anonymous usage stats are off. To help prioritise features, run 'postgres-db-fork telemetry on'.")
+			settings.Noticed = true
+			if err := store.Save(settings); err != nil {
+				logrus.Debugf("Failed to record telemetry notice: %v", err)
+			}
+		}
+		return
+	}
+	endpoint := telemetryEndpoint()
+	if endpoint == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+	defer cancel()
+	if err := telemetry.Send(ctx, endpoint, forkEvent(cfg, settings, result)); err != nil {
+		logrus.Debugf("Failed to send telemetry: %v", err)
+	}
+}
+
+// forkEvent describes the fork's usage without anything identifying it
+func forkEvent(cfg *config.ForkConfig, settings *telemetry.Settings, result forkResult) *telemetry.Event {
+	event := telemetry.NewEvent(settings, Version, "fork")
+	event.Success = result.Success
+	if duration, err := time.ParseDuration(result.Duration); err == nil {
+		event.Duration = telemetry.DurationBucket(duration)
+	}
+	if !result.Success {
+		event.ErrorClass = result.errorClass
+		if event.ErrorClass == "" {
+			event.ErrorClass = "other"
+		}
+	}
+	if r := result.Report; r != nil {
+		event.Method = string(r.Method)
+		for _, engine := range r.Engines {
+			event.Engines = append(event.Engines, string(engine))
+		}
+	}
+	for _, feature := range []struct {
+		name string
+		used bool
+	}{
+		{"dry_run", cfg.DryRun},
+		{"schema_only", cfg.SchemaOnly},
+		{"data_only", cfg.DataOnly},
+		{"minimal_schema", cfg.MinimalSchema},
+		{"schema_cache", cfg.SchemaCache},
+		{"template_cache", cfg.UseTemplateCache},
+		{"table_filters", len(cfg.IncludeTables) > 0 || len(cfg.ExcludeTables) > 0},
+		{"table_groups", len(cfg.TableGroups) > 0},
+		{"synthesize_data", cfg.SynthesizeData},
+		{"deterministic", cfg.Deterministic},
+		{"standby_chunking", cfg.StandbyChunking},
+		{"verify_sample", cfg.VerifySample > 0},
+		{"bench", cfg.Bench != ""},
+		{"seed", len(cfg.Seed) > 0},
+		{"vacuum", cfg.VacuumReport || cfg.VacuumFreezeTables > 0},
+		{"privacy", cfg.Redactor() != nil},
+	} {
+		if feature.used {
+			event.Features = append(event.Features, feature.name)
+		}
+	}
+	return event
+}
@@ -0,0 +1,390 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// TemplateResult represents the result of a template cache command
+type TemplateResult struct {
+	Format    string              `json:"format"`
+	Success   bool                `json:"success"`
+	Message   string              `json:"message,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Templates []db.CachedTemplate `json:"templates,omitempty"`
+	Dropped   []string            `json:"dropped,omitempty"`
+	DryRun    bool                `json:"dry_run,omitempty"`
+	Duration  string              `json:"duration"`
+}
+
+// templateCmd represents the template command
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage cached template databases",
+	Long: `Manage cached template databases used for fast same-server forks.
+
+Cloning a database with CREATE DATABASE ... TEMPLATE needs the source to have no
+other sessions, so forking a busy database means disconnecting its users. A cached
+template is a copy of the source, named pgfork_tpl_<source>, that accepts no
+connections; forks run with --use-template-cache clone it instead of the source.
+The cache is only as fresh as its last refresh.
+
+Available subcommands:
+  refresh - Build or rebuild the cached template of a source database
+  list    - List cached templates with their age and size
+  gc      - Drop stale cached templates and those whose source is gone
+
+Examples:
+  # Build the cache for myapp if it is missing or older than a day
+  postgres-db-fork template refresh myapp --max-age 24h
+
+  # Fork from the cache
+  postgres-db-fork fork --source-db myapp --target-db myapp_pr_123 --use-template-cache
+
+  # Drop caches not refreshed in a week
+  postgres-db-fork template gc --older-than 168h`,
+}
+
+var templateRefreshCmd = &cobra.Command{
+	Use:   "refresh <source-database>",
+	Short: "Build or rebuild a cached template",
+	Long: `Build the cached template of a source database, or rebuild it when it is older
+than --max-age. --force rebuilds regardless of age.
+
+The new copy is built under a temporary name and swapped in when complete, so forks
+can keep using the previous template meanwhile. Building clones the source, which
+needs it to be free of other sessions for a moment.
+
+Examples:
+  # Rebuild now
+  postgres-db-fork template refresh myapp --force
+
+  # Nightly job: rebuild only if older than 12 hours
+  postgres-db-fork template refresh myapp --max-age 12h`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTemplateRefresh,
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached templates",
+	Long:  `List cached templates with their source database, age and size, oldest first.`,
+	RunE:  runTemplateList,
+}
+
+var templateGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Drop stale cached templates",
+	Long: `Drop cached templates older than --older-than, and those whose source database
+no longer exists.
+
+Examples:
+  # Show what would be dropped
+  postgres-db-fork template gc --older-than 72h --dry-run
+
+  # Drop only caches of deleted sources
+  postgres-db-fork template gc`,
+	RunE: runTemplateGC,
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateRefreshCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateGCCmd)
+
+	for _, cmd := range []*cobra.Command{templateRefreshCmd, templateListCmd, templateGCCmd} {
+		// Database connection flags
+		cmd.Flags().String("host", "localhost", "Database server host")
+		cmd.Flags().Int("port", 5432, "Database server port")
+		cmd.Flags().String("user", "", "Database username (required)")
+		cmd.Flags().String("password", "", "Database password")
+		cmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+		cmd.Flags().String("sslmode", "prefer", "SSL mode")
+		cmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
+		cmd.Flags().Duration("timeout", 30*time.Minute, "Timeout for the operation")
+
+		// Output options
+		cmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
+		cmd.Flags().Bool("quiet", false, "Suppress output except errors")
+	}
+
+	templateRefreshCmd.Flags().Duration("max-age", 0, "Only rebuild a cache older than this (0 always rebuilds)")
+	templateRefreshCmd.Flags().Bool("force", false, "Rebuild even if the cache is younger than --max-age")
+
+	templateGCCmd.Flags().Duration("older-than", 0, "Drop caches older than this (0 keeps caches whose source exists)")
+	templateGCCmd.Flags().Bool("dry-run", false, "Show what would be dropped without dropping it")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("template")
+	config.RegisterOptions(
+		templateTimeoutOpt, templateMaxAgeOpt, templateForceOpt, templateOlderThanOpt,
+		templateDryRunOpt,
+	)
+}
+
+// Template options, resolved through the shared options builder
+var (
+	templateTimeoutOpt   = config.Option{Key: "template.timeout", Env: []string{"PGFORK_TEMPLATE_TIMEOUT"}, Flag: "timeout"}
+	templateMaxAgeOpt    = config.Option{Key: "template.max_age", Env: []string{"PGFORK_TEMPLATE_MAX_AGE"}, Flag: "max-age"}
+	templateForceOpt     = config.Option{Key: "template.force", Flag: "force"}
+	templateOlderThanOpt = config.Option{Key: "template.older_than", Env: []string{"PGFORK_TEMPLATE_OLDER_THAN"}, Flag: "older-than"}
+	templateDryRunOpt    = config.Option{Key: "template.dry_run", Flag: "dry-run"}
+)
+
+// templateSession holds what every template subcommand needs: the admin connection
+// to the server, the output settings and a deadline
+type templateSession struct {
+	builder *config.OptionsBuilder
+	conn    *db.Connection
+	ctx     context.Context
+	cancel  context.CancelFunc
+	format  string
+	quiet   bool
+}
+
+// fail reports an error in the command's output format
+func (s *templateSession) fail(err error) error {
+	return outputTemplateResult(&TemplateResult{Format: s.format, Success: false, Error: err.Error()}, s.quiet)
+}
+
+// close releases the connection and the deadline
+func (s *templateSession) close() {
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// newTemplateSession resolves the output settings of a template subcommand
+func newTemplateSession(cmd *cobra.Command) (*templateSession, error) {
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s := &templateSession{builder: builder}
+	s.format, _ = builder.GetString(config.OptOutputFormat, "text")
+	s.quiet, _ = builder.GetBool(config.OptQuiet, false)
+	return s, nil
+}
+
+// connect resolves the connection options and connects to the server's postgres database
+func (s *templateSession) connect(cmd *cobra.Command) error {
+	dbConfig, err := s.builder.BuildConnection(config.ServerConnection("template"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return err
+	}
+	*dbConfig = dbConfig.Admin()
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return err
+	}
+	if dbConfig.Username == "" {
+		return fmt.Errorf("database user is required (use --user or PGFORK_TEMPLATE_USER)")
+	}
+	timeout, err := s.builder.GetDuration(templateTimeoutOpt, 30*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), timeout)
+	if s.conn, err = db.NewConnectionContext(s.ctx, dbConfig); err != nil {
+		return fmt.Errorf("failed to connect to database server: %w", err)
+	}
+	return nil
+}
+
+func runTemplateRefresh(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	s, err := newTemplateSession(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	if err := s.connect(cmd); err != nil {
+		return s.fail(err)
+	}
+
+	source := args[0]
+	maxAge, err := s.builder.GetDuration(templateMaxAgeOpt, 0)
+	if err != nil {
+		return s.fail(err)
+	}
+	force, _ := s.builder.GetBool(templateForceOpt, false)
+
+	exists, err := s.conn.DatabaseExistsContext(s.ctx, source)
+	if err != nil {
+		return s.fail(err)
+	}
+	if !exists {
+		return s.fail(fmt.Errorf("source database '%s' does not exist", source))
+	}
+
+	cached, err := s.conn.CachedTemplate(s.ctx, source)
+	if err != nil {
+		return s.fail(err)
+	}
+	if cached != nil && !force && maxAge > 0 && cached.Age() < maxAge {
+		return outputTemplateResult(&TemplateResult{
+			Format:    s.format,
+			Success:   true,
+			Message:   fmt.Sprintf("Cached template %s is %s old, younger than --max-age %s; not rebuilt", cached.Name, output.FormatAge(cached.Age()), maxAge),
+			Templates: []db.CachedTemplate{*cached},
+			Duration:  time.Since(start).String(),
+		}, s.quiet)
+	}
+
+	refreshed, err := s.conn.RefreshCachedTemplate(s.ctx, source)
+	if err != nil {
+		return s.fail(err)
+	}
+	verb := "Built"
+	if cached != nil {
+		verb = "Rebuilt"
+	}
+	return outputTemplateResult(&TemplateResult{
+		Format:    s.format,
+		Success:   true,
+		Message:   fmt.Sprintf("%s cached template %s from %s", verb, refreshed.Name, source),
+		Templates: []db.CachedTemplate{*refreshed},
+		Duration:  time.Since(start).String(),
+	}, s.quiet)
+}
+
+func runTemplateList(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	s, err := newTemplateSession(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	if err := s.connect(cmd); err != nil {
+		return s.fail(err)
+	}
+
+	templates, err := s.conn.ListCachedTemplates(s.ctx)
+	if err != nil {
+		return s.fail(err)
+	}
+	return outputTemplateResult(&TemplateResult{
+		Format:    s.format,
+		Success:   true,
+		Message:   fmt.Sprintf("%d cached templates", len(templates)),
+		Templates: templates,
+		Duration:  time.Since(start).String(),
+	}, s.quiet)
+}
+
+func runTemplateGC(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	s, err := newTemplateSession(cmd)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	if err := s.connect(cmd); err != nil {
+		return s.fail(err)
+	}
+
+	olderThan, err := s.builder.GetDuration(templateOlderThanOpt, 0)
+	if err != nil {
+		return s.fail(err)
+	}
+	dryRun, _ := s.builder.GetBool(templateDryRunOpt, false)
+
+	templates, err := s.conn.ListCachedTemplates(s.ctx)
+	if err != nil {
+		return s.fail(err)
+	}
+
+	result := &TemplateResult{Format: s.format, Success: true, DryRun: dryRun}
+	for _, t := range templates {
+		stale := olderThan > 0 && t.Age() > olderThan
+		if !stale {
+			exists, err := s.conn.DatabaseExistsContext(s.ctx, t.Source)
+			if err != nil {
+				return s.fail(err)
+			}
+			stale = !exists
+		}
+		if !stale {
+			result.Templates = append(result.Templates, t)
+			continue
+		}
+		if !dryRun {
+			if err := s.conn.DropCachedTemplate(s.ctx, t.Name); err != nil {
+				return s.fail(err)
+			}
+		}
+		result.Dropped = append(result.Dropped, t.Name)
+	}
+
+	if dryRun {
+		result.Message = fmt.Sprintf("Would drop %d of %d cached templates", len(result.Dropped), len(templates))
+	} else {
+		result.Message = fmt.Sprintf("Dropped %d of %d cached templates", len(result.Dropped), len(templates))
+	}
+	result.Duration = time.Since(start).String()
+	return outputTemplateResult(result, s.quiet)
+}
+
+// templateView renders the template command result, with the quiet flag that text
+// output needs. Its JSON encoding is the TemplateResult.
+type templateView struct {
+	*TemplateResult
+	quiet bool
+}
+
+// WriteText writes the templates created, dropped or listed, or only the error in quiet mode
+func (v templateView) WriteText(w io.Writer) error {
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+	if v.quiet {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s %s\n", output.StatusIcon("ok"), v.Message)
+	for _, name := range v.Dropped {
+		fmt.Fprintf(w, "  dropped %s\n", name)
+	}
+	if len(v.Templates) > 0 {
+		fmt.Fprintf(w, "%-40s %-25s %-10s %s\n", "TEMPLATE", "SOURCE", "AGE", "SIZE")
+		for _, t := range v.Templates {
+			fmt.Fprintf(w, "%-40s %-25s %-10s %s\n", t.Name, t.Source, output.FormatAge(t.Age()), output.FormatBytes(t.Size))
+		}
+	}
+	fmt.Fprintf(w, "Duration: %s\n", v.Duration)
+	return nil
+}
+
+// outputTemplateResult outputs the template command result in the specified format
+func outputTemplateResult(result *TemplateResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, templateView{TemplateResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
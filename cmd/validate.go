@@ -1,14 +1,20 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -66,18 +72,26 @@ func init() {
 	rootCmd.AddCommand(validateCmd)
 
 	// Use same flags as fork command for consistency
-	validateCmd.Flags().String("source-host", "localhost", "Source database host")
+	validateCmd.Flags().String("source-uri", "", "Source database URI, replaces the individual source flags")
+	validateCmd.Flags().String("source", "", "Source database URI or heroku:<app>::<config var> reference (alias for --source-uri)")
+	validateCmd.Flags().String("source-host", "localhost", "Source database host, or comma-separated hosts tried in order (host:port, [IPv6 address]:port)")
 	validateCmd.Flags().Int("source-port", 5432, "Source database port")
 	validateCmd.Flags().String("source-user", "", "Source database username")
 	validateCmd.Flags().String("source-password", "", "Source database password")
+	validateCmd.Flags().Bool("source-password-stdin", false, "Read the source database password from standard input")
 	validateCmd.Flags().String("source-db", "", "Source database name")
 	validateCmd.Flags().String("source-sslmode", "prefer", "Source database SSL mode")
 
-	validateCmd.Flags().String("dest-host", "", "Destination database host")
+	validateCmd.Flags().String("dest-uri", "", "Destination server URI, replaces the individual destination flags")
+	validateCmd.Flags().String("target-uri", "", "Alias for --dest-uri")
+	validateCmd.Flags().String("dest-host", "", "Destination database host, or comma-separated hosts tried in order")
 	validateCmd.Flags().Int("dest-port", 0, "Destination database port")
 	validateCmd.Flags().String("dest-user", "", "Destination database username")
 	validateCmd.Flags().String("dest-password", "", "Destination database password")
+	validateCmd.Flags().Bool("dest-password-stdin", false, "Read the destination database password from standard input")
 	validateCmd.Flags().String("dest-sslmode", "", "Destination database SSL mode")
+	validateCmd.Flags().String("admin-db", "", "Maintenance database on the destination server for admin connections (default: postgres)")
+	validateCmd.Flags().String("provider", "auto", "Managed service hosting the destination: "+strings.Join(provider.Names(), ", "))
 
 	validateCmd.Flags().String("target-db", "", "Target database name (supports templates)")
 	validateCmd.Flags().StringToString("template-var", map[string]string{}, "Template variables")
@@ -86,31 +100,52 @@ func init() {
 	validateCmd.Flags().Bool("quick", false, "Only test basic connectivity (skip detailed checks)")
 	validateCmd.Flags().Bool("skip-permissions", false, "Skip permission checks")
 	validateCmd.Flags().Bool("check-resources", false, "Check available disk space and resources")
+	validateCmd.Flags().Duration("cache-ttl", 0, "Reuse source sizes read within this long for --check-resources (0 disables the metadata cache)")
+	validateCmd.Flags().String("cache-dir", "", "Directory of the metadata cache (default: system temp directory)")
 
 	// Output options
-	validateCmd.Flags().String("output-format", "text", "Output format: text or json")
+	validateCmd.Flags().String("output-format", "text", "Output format: text, json or yaml")
 	validateCmd.Flags().Bool("quiet", false, "Only output errors and final result")
 }
 
 func runValidate(cmd *cobra.Command, args []string) error {
 	start := time.Now()
 
-	outputFormat, _ := cmd.Flags().GetString("output-format")
-	quiet, _ := cmd.Flags().GetBool("quiet")
 	quick, _ := cmd.Flags().GetBool("quick")
 	skipPermissions, _ := cmd.Flags().GetBool("skip-permissions")
 	checkResources, _ := cmd.Flags().GetBool("check-resources")
 
 	var results []ValidationResult
 
-	// Build configuration similar to fork command
-	cfg := &config.ForkConfig{}
-
-	// Load from environment variables
-	cfg.LoadFromEnvironment()
-
-	// Apply flag values (similar to fork command logic)
-	applyValidationFlags(cmd, cfg)
+	// Build configuration exactly as the fork command would
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+	cfg, err := builder.BuildForkConfig()
+	if err != nil {
+		outputFormat, _ := cmd.Flags().GetString("output-format")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		return outputValidationResult(&ValidateOutput{
+			Format:   outputFormat,
+			Success:  false,
+			Error:    fmt.Sprintf("Configuration error: %v", err),
+			Results:  []ValidationResult{},
+			Duration: time.Since(start).String(),
+		}, quiet)
+	}
+	outputFormat := cfg.OutputFormat
+	quiet := cfg.Quiet
+
+	if err := newPasswordInput(cmd).resolveForkPasswords(cfg); err != nil {
+		return outputValidationResult(&ValidateOutput{
+			Format:   outputFormat,
+			Success:  false,
+			Error:    err.Error(),
+			Results:  []ValidationResult{},
+			Duration: time.Since(start).String(),
+		}, quiet)
+	}
 
 	// 1. Configuration validation
 	results = append(results, validateConfiguration(cfg)...)
@@ -131,7 +166,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 
 		// 5. Resource checks
 		if checkResources {
-			results = append(results, validateResources(cfg)...)
+			results = append(results, validateResources(cfg, builder)...)
 		}
 	} else {
 		results = append(results, validateQuickConnectivity(cfg)...)
@@ -147,7 +182,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	output := &ValidateOutput{
+	result := &ValidateOutput{
 		Format:   outputFormat,
 		Success:  success,
 		Results:  results,
@@ -155,82 +190,12 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	}
 
 	if success {
-		output.Message = "All validation checks passed"
+		result.Message = "All validation checks passed"
 	} else {
-		output.Error = fmt.Sprintf("Validation failed: %v", failedChecks)
-	}
-
-	return outputValidationResult(output, quiet)
-}
-
-// applyValidationFlags applies command flags to configuration
-func applyValidationFlags(cmd *cobra.Command, cfg *config.ForkConfig) {
-	// Source configuration
-	if cmd.Flag("source-host").Changed {
-		cfg.Source.Host, _ = cmd.Flags().GetString("source-host")
-	}
-	if cmd.Flag("source-port").Changed {
-		cfg.Source.Port, _ = cmd.Flags().GetInt("source-port")
-	}
-	if cmd.Flag("source-user").Changed {
-		cfg.Source.Username, _ = cmd.Flags().GetString("source-user")
-	}
-	if cmd.Flag("source-password").Changed {
-		cfg.Source.Password, _ = cmd.Flags().GetString("source-password")
-	}
-	if cmd.Flag("source-db").Changed {
-		cfg.Source.Database, _ = cmd.Flags().GetString("source-db")
-	}
-	if cmd.Flag("source-sslmode").Changed {
-		cfg.Source.SSLMode, _ = cmd.Flags().GetString("source-sslmode")
-	}
-
-	// Destination configuration with defaults
-	if cmd.Flag("dest-host").Changed {
-		cfg.Destination.Host, _ = cmd.Flags().GetString("dest-host")
-	} else if cfg.Destination.Host == "" {
-		cfg.Destination.Host = cfg.Source.Host
-	}
-
-	if cmd.Flag("dest-port").Changed {
-		cfg.Destination.Port, _ = cmd.Flags().GetInt("dest-port")
-	} else if cfg.Destination.Port == 0 {
-		cfg.Destination.Port = cfg.Source.Port
-	}
-
-	if cmd.Flag("dest-user").Changed {
-		cfg.Destination.Username, _ = cmd.Flags().GetString("dest-user")
-	} else if cfg.Destination.Username == "" {
-		cfg.Destination.Username = cfg.Source.Username
-	}
-
-	if cmd.Flag("dest-password").Changed {
-		cfg.Destination.Password, _ = cmd.Flags().GetString("dest-password") // pragma: allowlist secret
-	} else if cfg.Destination.Password == "" {
-		cfg.Destination.Password = cfg.Source.Password // pragma: allowlist secret
+		result.Error = fmt.Sprintf("Validation failed: %v", failedChecks)
 	}
 
-	if cmd.Flag("dest-sslmode").Changed {
-		cfg.Destination.SSLMode, _ = cmd.Flags().GetString("dest-sslmode")
-	} else if cfg.Destination.SSLMode == "" {
-		cfg.Destination.SSLMode = cfg.Source.SSLMode
-	}
-
-	// Target database
-	if cmd.Flag("target-db").Changed {
-		cfg.TargetDatabase, _ = cmd.Flags().GetString("target-db")
-	}
-
-	// Template variables
-	if cmd.Flag("template-var").Changed {
-		templateVars, _ := cmd.Flags().GetStringToString("template-var")
-		if cfg.TemplateVars == nil {
-			cfg.TemplateVars = make(map[string]string)
-		}
-		for k, v := range templateVars {
-			cfg.TemplateVars[k] = v
-		}
-	}
+	return outputValidationResult(result, quiet)
 }
 
 // validateConfiguration validates basic configuration
@@ -280,18 +245,28 @@ func validateConfiguration(cfg *config.ForkConfig) []ValidationResult {
 		})
 	}
 
-	// Check for same-server vs cross-server
-	if cfg.IsSameServer() {
+	// Report how the fork will run, including selective forks that cannot use templates
+	plan := fork.NewPlan(cfg)
+	if plan.Method == fork.MethodTemplate {
 		results = append(results, ValidationResult{
 			Check:   "fork_mode",
 			Status:  "pass",
 			Message: "Same-server fork detected (fast template-based cloning)",
+			Details: plan.Reason,
+		})
+	} else if plan.SameServer {
+		results = append(results, ValidationResult{
+			Check:   "fork_mode",
+			Status:  "pass",
+			Message: "Same-server fork using selective data transfer (template cloning not possible)",
+			Details: plan.Reason,
 		})
 	} else {
 		results = append(results, ValidationResult{
 			Check:   "fork_mode",
 			Status:  "pass",
 			Message: "Cross-server fork detected (data transfer required)",
+			Details: plan.Reason,
 		})
 	}
 
@@ -355,8 +330,7 @@ func validateQuickConnectivity(cfg *config.ForkConfig) []ValidationResult {
 	}
 
 	// Test destination connection (admin database)
-	adminConfig := cfg.Destination
-	adminConfig.Database = "postgres"
+	adminConfig := cfg.Destination.Admin()
 	destConn, err := db.NewConnection(&adminConfig)
 	if err != nil {
 		results = append(results, ValidationResult{
@@ -396,9 +370,11 @@ func validateDatabaseConnectivity(cfg *config.ForkConfig) []ValidationResult {
 		})
 		return results
 	}
-	if err := sourceConn.Close(); err != nil {
-		fmt.Printf("Warning: Failed to close source connection: %v\n", err)
-	}
+	defer func() {
+		if err := sourceConn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close source connection: %v\n", err)
+		}
+	}()
 
 	results = append(results, ValidationResult{
 		Check:   "source_connectivity",
@@ -432,8 +408,7 @@ func validateDatabaseConnectivity(cfg *config.ForkConfig) []ValidationResult {
 	}
 
 	// Destination server checks
-	adminConfig := cfg.Destination
-	adminConfig.Database = "postgres"
+	adminConfig := cfg.Destination.Admin()
 	destConn, err := db.NewConnection(&adminConfig)
 	if err != nil {
 		results = append(results, ValidationResult{
@@ -456,42 +431,138 @@ func validateDatabaseConnectivity(cfg *config.ForkConfig) []ValidationResult {
 		Message: "Destination server connection successful",
 	})
 
+	results = append(results, validateProvider(cfg, destConn))
+	if fork.NewPlan(cfg).Method == fork.MethodTemplate {
+		results = append(results, validateClusterIdentity(cfg, sourceConn, destConn))
+	}
+
 	// Check if target database already exists
 	if cfg.TargetDatabase != "" {
-		exists, err := destConn.DatabaseExists(cfg.TargetDatabase)
-		if err != nil {
-			results = append(results, ValidationResult{
-				Check:   "target_database_exists",
-				Status:  "warn",
-				Message: "Cannot check if target database exists",
-				Details: err.Error(),
-			})
-		} else if exists {
-			if cfg.DropIfExists {
-				results = append(results, ValidationResult{
-					Check:   "target_database_exists",
-					Status:  "warn",
-					Message: "Target database exists but will be dropped",
-				})
-			} else {
-				results = append(results, ValidationResult{
-					Check:   "target_database_exists",
-					Status:  "fail",
-					Message: "Target database already exists (use --drop-if-exists to overwrite)",
-				})
-			}
-		} else {
-			results = append(results, ValidationResult{
-				Check:   "target_database_exists",
-				Status:  "pass",
-				Message: "Target database does not exist (ready for creation)",
-			})
-		}
+		results = append(results, validateTargetExists(context.Background(), cfg, destConn))
 	}
 
 	return results
 }
 
+// validateTargetExists checks the target name is free, or that the fork is set to
+// drop the existing target or pick another name
+func validateTargetExists(ctx context.Context, cfg *config.ForkConfig, destConn *db.Connection) ValidationResult {
+	exists, err := destConn.DatabaseExistsContext(ctx, cfg.TargetDatabase)
+	switch {
+	case err != nil:
+		return ValidationResult{
+			Check:   "target_database_exists",
+			Status:  "warn",
+			Message: "Cannot check if target database exists",
+			Details: err.Error(),
+		}
+	case !exists:
+		return ValidationResult{
+			Check:   "target_database_exists",
+			Status:  "pass",
+			Message: "Target database does not exist (ready for creation)",
+		}
+	case cfg.DropIfExists:
+		return ValidationResult{
+			Check:   "target_database_exists",
+			Status:  "warn",
+			Message: "Target database exists but will be dropped",
+		}
+	case cfg.AutoSuffix:
+		return ValidationResult{
+			Check:   "target_database_exists",
+			Status:  "warn",
+			Message: "Target database exists, a suffixed name will be used",
+		}
+	default:
+		return ValidationResult{
+			Check:   "target_database_exists",
+			Status:  "fail",
+			Message: "Target database already exists (use --drop-if-exists to overwrite)",
+		}
+	}
+}
+
+// validateProvider reports the managed service hosting the destination and what its
+// restrictions change about the fork
+func validateProvider(cfg *config.ForkConfig, destConn *db.Connection) ValidationResult {
+	profile, err := provider.Resolve(context.Background(), cfg.Provider, destConn, cfg.Destination.Host)
+	if err != nil {
+		return ValidationResult{
+			Check:   "provider",
+			Status:  "warn",
+			Message: "Cannot detect the destination's provider (assuming self-hosted)",
+			Details: err.Error(),
+		}
+	}
+	if profile.NoCreateDatabase {
+		return ValidationResult{
+			Check:   "provider",
+			Status:  "fail",
+			Message: fmt.Sprintf("Destination is %s, which does not allow creating databases", profile.Title),
+		}
+	}
+
+	plan := fork.NewPlan(cfg)
+	plan.ApplyProvider(cfg, profile)
+	if plan.Method == fork.MethodTemplate && profile.TemplateClone == provider.TemplateOwned {
+		if owner, err := destConn.OwnsDatabaseContext(context.Background(), cfg.Source.Database); err == nil {
+			plan.VerifyTemplateOwner(cfg, profile, owner)
+		}
+	}
+	if len(plan.Downgrades) == 0 {
+		return ValidationResult{
+			Check:   "provider",
+			Status:  "pass",
+			Message: fmt.Sprintf("Destination is %s", profile.Title),
+		}
+	}
+	return ValidationResult{
+		Check:   "provider",
+		Status:  "warn",
+		Message: fmt.Sprintf("Destination is %s (%s)", profile.Title, plan.Reason),
+		Details: strings.Join(plan.Downgrades, "; "),
+	}
+}
+
+// validateClusterIdentity confirms a template-based fork really targets one cluster
+func validateClusterIdentity(cfg *config.ForkConfig, sourceConn, destConn *db.Connection) ValidationResult {
+	sourceID, err := sourceConn.ClusterIdentity()
+	if err != nil {
+		return ValidationResult{
+			Check:   "cluster_identity",
+			Status:  "warn",
+			Message: "Cannot verify source and destination are the same cluster",
+			Details: err.Error(),
+		}
+	}
+	destID, err := destConn.ClusterIdentity()
+	if err != nil {
+		return ValidationResult{
+			Check:   "cluster_identity",
+			Status:  "warn",
+			Message: "Cannot verify source and destination are the same cluster",
+			Details: err.Error(),
+		}
+	}
+
+	plan := fork.NewPlan(cfg)
+	plan.VerifyCluster(cfg, sourceID, destID)
+	if plan.Method != fork.MethodTemplate {
+		return ValidationResult{
+			Check:   "cluster_identity",
+			Status:  "warn",
+			Message: "Source and destination are different clusters (data transfer will be used)",
+			Details: plan.Reason,
+		}
+	}
+	return ValidationResult{
+		Check:   "cluster_identity",
+		Status:  "pass",
+		Message: "Source and destination are the same cluster",
+	}
+}
+
 // validatePermissions checks database permissions
 func validatePermissions(cfg *config.ForkConfig) []ValidationResult {
 	var results []ValidationResult
@@ -525,8 +596,7 @@ func validatePermissions(cfg *config.ForkConfig) []ValidationResult {
 	}
 
 	// Check destination permissions (should be able to create databases)
-	adminConfig := cfg.Destination
-	adminConfig.Database = "postgres"
+	adminConfig := cfg.Destination.Admin()
 	destConn, err := db.NewConnection(&adminConfig)
 	if err != nil {
 		return results // Connection already tested
@@ -537,36 +607,119 @@ func validatePermissions(cfg *config.ForkConfig) []ValidationResult {
 		}
 	}()
 
-	// Test CREATEDB permission by checking user attributes
-	query := "SELECT rolcreatedb FROM pg_roles WHERE rolname = CURRENT_USER"
+	return append(results, validateCreateDB(context.Background(), destConn))
+}
+
+// validateCreateDB checks the destination user may create databases, as superusers
+// may without the CREATEDB attribute
+func validateCreateDB(ctx context.Context, destConn *db.Connection) ValidationResult {
+	query := "SELECT rolcreatedb OR rolsuper FROM pg_roles WHERE rolname = CURRENT_USER"
 	var canCreateDB bool
-	err = destConn.DB.QueryRow(query).Scan(&canCreateDB)
-	if err != nil {
-		results = append(results, ValidationResult{
+	if err := destConn.DB.QueryRowContext(ctx, query).Scan(&canCreateDB); err != nil {
+		return ValidationResult{
 			Check:   "destination_createdb_permission",
 			Status:  "warn",
 			Message: "Cannot verify CREATEDB permission",
 			Details: err.Error(),
-		})
-	} else if !canCreateDB {
-		results = append(results, ValidationResult{
+		}
+	}
+	if !canCreateDB {
+		return ValidationResult{
 			Check:   "destination_createdb_permission",
 			Status:  "fail",
 			Message: "User does not have CREATEDB permission",
+		}
+	}
+	return ValidationResult{
+		Check:   "destination_createdb_permission",
+		Status:  "pass",
+		Message: "User has CREATEDB permission",
+	}
+}
+
+// preflightError is a fork turned away by its preflight checks, with the result of
+// every check
+type preflightError struct {
+	results []ValidationResult
+}
+
+// Error names the failed checks
+func (e *preflightError) Error() string {
+	var failed []string
+	for _, result := range e.results {
+		if result.Status == "fail" {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.Check, result.Message))
+		}
+	}
+	return fmt.Sprintf("preflight checks failed (%s); fix them or fork with --skip-validate", strings.Join(failed, "; "))
+}
+
+// preflight returns the checks every fork runs before it changes anything, unless
+// skip_validate is set: the fast subset of validate that connects to the source and
+// destination, and checks the CREATEDB permission and the target name. The
+// configuration and templates are checked before the fork starts.
+func preflight(cfg *config.ForkConfig) func(context.Context) error {
+	return func(ctx context.Context) error {
+		results := preflightChecks(ctx, cfg)
+		for _, result := range results {
+			if result.Status == "fail" {
+				return &preflightError{results: results}
+			}
+		}
+		return nil
+	}
+}
+
+// preflightChecks runs the preflight checks with one connection to each server
+func preflightChecks(ctx context.Context, cfg *config.ForkConfig) []ValidationResult {
+	var results []ValidationResult
+
+	sourceConn, err := db.NewConnectionContext(ctx, &cfg.Source)
+	if err != nil {
+		results = append(results, ValidationResult{
+			Check:   "source_connectivity",
+			Status:  "fail",
+			Message: "Cannot connect to source database",
+			Details: err.Error(),
 		})
 	} else {
+		if err := sourceConn.Close(); err != nil {
+			logrus.Warnf("Failed to close source connection: %v", err)
+		}
 		results = append(results, ValidationResult{
-			Check:   "destination_createdb_permission",
+			Check:   "source_connectivity",
 			Status:  "pass",
-			Message: "User has CREATEDB permission",
+			Message: "Source database connection successful",
 		})
 	}
 
-	return results
+	adminConfig := cfg.Destination.Admin()
+	destConn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return append(results, ValidationResult{
+			Check:   "destination_connectivity",
+			Status:  "fail",
+			Message: "Cannot connect to destination server",
+			Details: err.Error(),
+		})
+	}
+	defer func() {
+		if err := destConn.Close(); err != nil {
+			logrus.Warnf("Failed to close destination connection: %v", err)
+		}
+	}()
+	results = append(results, ValidationResult{
+		Check:   "destination_connectivity",
+		Status:  "pass",
+		Message: "Destination server connection successful",
+	})
+
+	return append(results, validateCreateDB(ctx, destConn), validateTargetExists(ctx, cfg, destConn))
 }
 
-// validateResources checks available resources
-func validateResources(cfg *config.ForkConfig) []ValidationResult {
+// validateResources checks available resources, reading sizes through the metadata
+// cache when one is configured
+func validateResources(cfg *config.ForkConfig, builder *config.OptionsBuilder) []ValidationResult {
 	var results []ValidationResult
 
 	// Get source database size
@@ -579,24 +732,44 @@ func validateResources(cfg *config.ForkConfig) []ValidationResult {
 			fmt.Printf("Warning: Failed to close source connection: %v\n", err)
 		}
 	}()
+	if err := attachMetadataCache(builder, sourceConn); err != nil {
+		return append(results, ValidationResult{
+			Check:   "metadata_cache",
+			Status:  "warn",
+			Message: "Cannot use the metadata cache",
+			Details: err.Error(),
+		})
+	}
 
-	sourceSize, err := sourceConn.GetDatabaseSize(cfg.Source.Database)
+	plan := fork.NewPlan(cfg)
+	estimate, err := plan.EstimateBytes(sourceConn, cfg.Source.Database)
 	if err != nil {
 		results = append(results, ValidationResult{
 			Check:   "source_database_size",
 			Status:  "warn",
-			Message: "Cannot determine source database size",
+			Message: "Cannot estimate the data to copy",
 			Details: err.Error(),
 		})
 	} else {
+		var message string
+		switch {
+		case plan.SchemaOnly:
+			message = "Schema-only fork, no table data will be copied"
+		case plan.Method == fork.MethodTemplate:
+			message = fmt.Sprintf("Source database size: %s (cloned on the server)", output.FormatBytes(estimate))
+		case len(plan.IncludeTables) > 0 || len(plan.ExcludeTables) > 0:
+			message = fmt.Sprintf("Estimated data to transfer: %s (selected tables only)", output.FormatBytes(estimate))
+		default:
+			message = fmt.Sprintf("Estimated data to transfer: %s", output.FormatBytes(estimate))
+		}
 		results = append(results, ValidationResult{
 			Check:   "source_database_size",
 			Status:  "pass",
-			Message: fmt.Sprintf("Source database size: %s", formatBytes(sourceSize)),
+			Message: message,
 		})
 
-		// Warn if database is very large
-		if sourceSize > 100*1024*1024*1024 { // 100GB
+		// Warn if a transfer is very large; template clones are copied file by file
+		if plan.Method == fork.MethodTransfer && estimate > 100*1024*1024*1024 { // 100GB
 			results = append(results, ValidationResult{
 				Check:   "large_database_warning",
 				Status:  "warn",
@@ -608,56 +781,50 @@ func validateResources(cfg *config.ForkConfig) []ValidationResult {
 	return results
 }
 
-// outputValidationResult outputs the validation result in the specified format
-func outputValidationResult(output *ValidateOutput, quiet bool) error {
-	if output.Format == "json" {
-		jsonOutput, err := json.MarshalIndent(output, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal JSON output: %w", err)
+// validateView renders a validation result, with the quiet flag that text output needs.
+// Its JSON encoding is the ValidateOutput.
+type validateView struct {
+	*ValidateOutput
+	quiet bool
+}
+
+// WriteText writes every check with its status, or only PASS or FAIL in quiet mode
+func (v validateView) WriteText(w io.Writer) error {
+	if v.quiet {
+		if v.Success {
+			fmt.Fprintln(w, "PASS")
+		} else {
+			fmt.Fprintf(w, "FAIL: %s\n", v.Error)
 		}
-		fmt.Println(string(jsonOutput))
-	} else {
-		// Text output
-		if !quiet {
-			if output.Success {
-				fmt.Printf("✅ %s\n", output.Message)
-			} else {
-				fmt.Printf("❌ %s\n", output.Error)
-			}
+		return nil
+	}
 
-			fmt.Println("\nValidation Results:")
-			for _, result := range output.Results {
-				var icon string
-				switch result.Status {
-				case "pass":
-					icon = "✅"
-				case "warn":
-					icon = "⚠️"
-				case "fail":
-					icon = "❌"
-				default:
-					icon = "ℹ️"
-				}
-
-				fmt.Printf("  %s %s: %s\n", icon, result.Check, result.Message)
-				if result.Details != "" && result.Status != "pass" {
-					fmt.Printf("      Details: %s\n", result.Details)
-				}
-			}
+	if v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("pass"), v.Message)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("fail"), v.Error)
+	}
 
-			fmt.Printf("\nValidation completed in %s\n", output.Duration)
-		} else {
-			// Quiet mode - only output final status
-			if output.Success {
-				fmt.Println("PASS")
-			} else {
-				fmt.Printf("FAIL: %s\n", output.Error)
-			}
+	fmt.Fprintln(w, "\nValidation Results:")
+	for _, result := range v.Results {
+		fmt.Fprintf(w, "  %s %s: %s\n", output.StatusIcon(result.Status), result.Check, result.Message)
+		if result.Details != "" && result.Status != "pass" {
+			fmt.Fprintf(w, "      Details: %s\n", result.Details)
 		}
 	}
 
+	fmt.Fprintf(w, "\nValidation completed in %s\n", v.Duration)
+	return nil
+}
+
+// outputValidationResult outputs the validation result in the specified format
+func outputValidationResult(result *ValidateOutput, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, validateView{ValidateOutput: result, quiet: quiet}); err != nil {
+		return err
+	}
+
 	// Set exit code
-	if !output.Success {
+	if !result.Success {
 		os.Exit(1)
 	}
 
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+
 	"github.com/spf13/cobra"
 )
 
@@ -53,6 +55,9 @@ func init() {
 	rootCmd.AddCommand(versionCmd)
 
 	versionCmd.Flags().String("output-format", "text", "Output format: text or json")
+
+	// Forks record the version that made them in their lineage
+	fork.ToolVersion = Version
 }
 
 func runVersion(cmd *cobra.Command, args []string) error {
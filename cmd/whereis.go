@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+
+	"github.com/spf13/cobra"
+)
+
+// WhereisResult represents the result of resolving a fork name
+type WhereisResult struct {
+	Format    string      `json:"format"`
+	Success   bool        `json:"success"`
+	Error     string      `json:"error,omitempty"`
+	Name      string      `json:"name"`
+	Database  string      `json:"database,omitempty"`
+	MatchedBy string      `json:"matched_by,omitempty"`
+	URI       string      `json:"uri,omitempty"`
+	Lineage   *db.Lineage `json:"lineage,omitempty"`
+	Duration  string      `json:"duration"`
+}
+
+// whereisCmd represents the whereis command
+var whereisCmd = &cobra.Command{
+	Use:   "whereis <name>",
+	Short: "Print the connection URI of a fork by database, pull request, job or branch",
+	Long: `Resolve a name into the connection URI of a database on the server, using the
+catalog and the lineage recorded by each fork.
+
+The name is tried, in order, as:
+  1. a database name
+  2. a pull request, written pr-123, pr_123 or #123, found by the pull request
+     number recorded by 'pr create'
+  3. a job ID recorded in a fork's lineage (--job-id, or generated for background forks)
+  4. a branch name, sanitized the same way as the {{.BRANCH}} template variable
+
+The URI carries the server's user, host, port and SSL mode but not the password,
+unless --show-password is given.
+
+Examples:
+  # Connect to the database of pull request 123
+  psql "$(postgres-db-fork whereis pr-123 --user admin --quiet)"
+
+  # Resolve a background job
+  postgres-db-fork whereis fork-1700000000 --output-format json
+
+  # Resolve a branch
+  postgres-db-fork whereis feature/login --porcelain`,
+	Args: cobra.ExactArgs(1),
+	RunE: runWhereis,
+}
+
+func init() {
+	rootCmd.AddCommand(whereisCmd)
+
+	// Database connection flags
+	whereisCmd.Flags().String("host", "localhost", "Database server host")
+	whereisCmd.Flags().Int("port", 5432, "Database server port")
+	whereisCmd.Flags().String("user", "", "Database username (required)")
+	whereisCmd.Flags().String("password", "", "Database password")
+	whereisCmd.Flags().Bool("password-stdin", false, "Read the database password from standard input")
+	whereisCmd.Flags().String("sslmode", "prefer", "SSL mode")
+	whereisCmd.Flags().String("admin-db", "", "Maintenance database for admin connections (default: postgres)")
+	whereisCmd.Flags().Bool("show-password", false, "Include the password in the printed URI")
+	whereisCmd.Flags().Duration("timeout", time.Minute, "Timeout for the catalog queries")
+
+	// Output options
+	whereisCmd.Flags().String("output-format", "text", "Output format: text, json, yaml or porcelain")
+	addPorcelainFlag(whereisCmd)
+	whereisCmd.Flags().Bool("quiet", false, "Print only the URI")
+
+	// Keys this command reads from config files
+	config.RegisterConnection("whereis")
+	config.RegisterOptions(whereisShowPasswordOpt, whereisTimeoutOpt)
+}
+
+// Whereis options, resolved through the shared options builder
+var (
+	whereisShowPasswordOpt = config.Option{Key: "whereis.show_password", Flag: "show-password"}
+	whereisTimeoutOpt      = config.Option{Key: "whereis.timeout", Env: []string{"PGFORK_WHEREIS_TIMEOUT"}, Flag: "timeout"}
+)
+
+// pullRequestName matches the ways a pull request is named on the command line
+var pullRequestName = regexp.MustCompile(`^(?:pr[-_]?|#)(\d+)$`)
+
+func runWhereis(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	builder, err := newOptionsBuilder(cmd)
+	if err != nil {
+		return err
+	}
+
+	outputFormat, _ := builder.GetString(config.OptOutputFormat, "text")
+	outputFormat = resolveOutputFormat(cmd, outputFormat)
+	quiet, _ := builder.GetBool(config.OptQuiet, false)
+	result := &WhereisResult{
+		Format:  outputFormat,
+		Success: true,
+		Name:    args[0],
+	}
+	fail := func(err error) error {
+		result.Success = false
+		result.Error = err.Error()
+		result.Duration = time.Since(start).String()
+		return outputWhereisResult(result, quiet)
+	}
+
+	dbConfig, err := builder.BuildConnection(config.ServerConnection("whereis"), config.DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return fail(err)
+	}
+	*dbConfig = dbConfig.Admin()
+	if err := newPasswordInput(cmd).resolve(dbConfig, "password-stdin", "Database"); err != nil {
+		return fail(err)
+	}
+	if dbConfig.Username == "" {
+		return fail(fmt.Errorf("database user is required (use --user or PGFORK_WHEREIS_USER)"))
+	}
+	showPassword, _ := builder.GetBool(whereisShowPasswordOpt, false)
+	timeout, err := builder.GetDuration(whereisTimeoutOpt, time.Minute)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := db.NewConnectionContext(ctx, dbConfig)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close connection: %v\n", err)
+		}
+	}()
+
+	databases, err := findMatchingDatabases(ctx, conn, "*", nil)
+	if err != nil {
+		return fail(fmt.Errorf("failed to list databases: %w", err))
+	}
+	lineages, err := conn.LineagesContext(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	database, matchedBy, err := resolveWhereis(args[0], databases, lineages)
+	if err != nil {
+		return fail(err)
+	}
+	result.Database = database
+	result.MatchedBy = matchedBy
+	if lineage, ok := lineages[database]; ok {
+		result.Lineage = &lineage
+	}
+
+	target := *dbConfig
+	target.Database = database
+	result.URI = connectionURI(&target, showPassword)
+	result.Duration = time.Since(start).String()
+	return outputWhereisResult(result, quiet)
+}
+
+// resolveWhereis finds the database a name refers to, returning it and how it was
+// matched: "database", "pull request", "job" or "branch"
+func resolveWhereis(name string, databases []string, lineages map[string]db.Lineage) (string, string, error) {
+	exists := make(map[string]bool, len(databases))
+	for _, database := range databases {
+		exists[database] = true
+	}
+	if exists[name] {
+		return name, "database", nil
+	}
+
+	if m := pullRequestName.FindStringSubmatch(strings.ToLower(name)); m != nil {
+		number, _ := strconv.Atoi(m[1])
+		matches := lineageMatches(lineages, exists, func(l db.Lineage) bool { return l.PullRequest == number })
+		if len(matches) == 1 {
+			return matches[0], "pull request", nil
+		}
+		if len(matches) > 1 {
+			return "", "", fmt.Errorf("pull request %d has several databases: %s", number, strings.Join(matches, ", "))
+		}
+	}
+
+	matches := lineageMatches(lineages, exists, func(l db.Lineage) bool { return l.JobID == name })
+	if len(matches) == 1 {
+		return matches[0], "job", nil
+	}
+	if len(matches) > 1 {
+		return "", "", fmt.Errorf("job %s made several databases: %s", name, strings.Join(matches, ", "))
+	}
+
+	if branch := config.SanitizeBranchName(name); exists[branch] {
+		return branch, "branch", nil
+	}
+
+	return "", "", fmt.Errorf("no database, pull request, job or branch named %q on this server", name)
+}
+
+// lineageMatches returns the existing databases whose lineage satisfies match, sorted
+func lineageMatches(lineages map[string]db.Lineage, exists map[string]bool, match func(db.Lineage) bool) []string {
+	var matches []string
+	for database, lineage := range lineages {
+		if exists[database] && match(lineage) {
+			matches = append(matches, database)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// connectionURI returns a postgresql:// URI for the connection, with the password
+// only when asked for
+func connectionURI(cfg *config.DatabaseConfig, withPassword bool) string {
+	u := &url.URL{
+		Scheme: "postgresql",
+		Host:   cfg.Address(),
+		Path:   "/" + cfg.Database,
+	}
+	if withPassword && cfg.Password != "" {
+		u.User = url.UserPassword(cfg.Username, cfg.Password)
+	} else if cfg.Username != "" {
+		u.User = url.User(cfg.Username)
+	}
+	if cfg.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+	return u.String()
+}
+
+// whereisView renders a whereis result, with the quiet flag that text output needs.
+// Its JSON encoding is the WhereisResult.
+type whereisView struct {
+	*WhereisResult
+	quiet bool
+}
+
+// WriteText writes the database the name resolved to, or only its URI in quiet mode
+func (v whereisView) WriteText(w io.Writer) error {
+	if v.quiet {
+		// Only the URI, for use in scripts
+		if v.Success {
+			fmt.Fprintln(w, v.URI)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", v.Error)
+		}
+		return nil
+	}
+	if !v.Success {
+		fmt.Fprintf(w, "%s %s\n", output.StatusIcon("failed"), v.Error)
+		return nil
+	}
+	fmt.Fprintf(w, "%s %s is database %s (matched by %s)\n", output.StatusIcon("ok"), v.Name, v.Database, v.MatchedBy)
+	if v.Lineage != nil {
+		fmt.Fprintf(w, "Lineage: %s\n", formatLineage(v.Lineage))
+	}
+	fmt.Fprintf(w, "URI: %s\n", v.URI)
+	return nil
+}
+
+// WritePorcelain writes the whereis result as porcelain records:
+//
+//	database	<name>	<matched by>
+//	uri	<uri>
+func (v whereisView) WritePorcelain(w io.Writer) {
+	if v.Success {
+		output.WritePorcelain(w, "database", v.Database, v.MatchedBy)
+		output.WritePorcelain(w, "uri", v.URI)
+	}
+}
+
+// Outcome reports whether the name resolved
+func (v whereisView) Outcome() (bool, string) {
+	return v.Success, v.Error
+}
+
+// outputWhereisResult outputs the whereis result in the specified format
+func outputWhereisResult(result *WhereisResult, quiet bool) error {
+	if err := output.Render(os.Stdout, result.Format, whereisView{WhereisResult: result, quiet: quiet}); err != nil {
+		return err
+	}
+
+	// Set exit code
+	if !result.Success {
+		os.Exit(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// CIProvenance records the CI pipeline that ran a command, so a database or job can be
+// traced back to the repository, run and commit that made it
+type CIProvenance struct {
+	Provider   string `json:"provider" yaml:"provider"`
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	RunURL     string `json:"run_url,omitempty" yaml:"run_url,omitempty"`
+	Commit     string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Actor      string `json:"actor,omitempty" yaml:"actor,omitempty"`
+}
+
+// DetectCI reads the provenance of the current CI run from the environment variables
+// of GitHub Actions, GitLab CI, CircleCI, Buildkite and Jenkins. It returns nil
+// outside CI.
+func DetectCI() *CIProvenance {
+	return detectCI(os.Getenv)
+}
+
+// detectCI reads the provenance of the current CI run through getenv
+func detectCI(getenv func(string) string) *CIProvenance {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		ci := &CIProvenance{
+			Provider:   "github",
+			Repository: getenv("GITHUB_REPOSITORY"),
+			Commit:     getenv("GITHUB_SHA"),
+			Actor:      getenv("GITHUB_ACTOR"),
+		}
+		if runID := getenv("GITHUB_RUN_ID"); runID != "" && ci.Repository != "" {
+			server := getenv("GITHUB_SERVER_URL")
+			if server == "" {
+				server = "https://github.com"
+			}
+			ci.RunURL = strings.TrimSuffix(server, "/") + "/" + ci.Repository + "/actions/runs/" + runID
+		}
+		return ci
+	case getenv("GITLAB_CI") != "":
+		return &CIProvenance{
+			Provider:   "gitlab",
+			Repository: getenv("CI_PROJECT_PATH"),
+			RunURL:     firstNonEmpty(getenv("CI_PIPELINE_URL"), getenv("CI_JOB_URL")),
+			Commit:     getenv("CI_COMMIT_SHA"),
+			Actor:      getenv("GITLAB_USER_LOGIN"),
+		}
+	case getenv("CIRCLECI") != "":
+		ci := &CIProvenance{
+			Provider: "circleci",
+			RunURL:   getenv("CIRCLE_BUILD_URL"),
+			Commit:   getenv("CIRCLE_SHA1"),
+			Actor:    getenv("CIRCLE_USERNAME"),
+		}
+		if owner, repo := getenv("CIRCLE_PROJECT_USERNAME"), getenv("CIRCLE_PROJECT_REPONAME"); owner != "" && repo != "" {
+			ci.Repository = owner + "/" + repo
+		}
+		return ci
+	case getenv("BUILDKITE") != "":
+		return &CIProvenance{
+			Provider:   "buildkite",
+			Repository: getenv("BUILDKITE_REPO"),
+			RunURL:     getenv("BUILDKITE_BUILD_URL"),
+			Commit:     getenv("BUILDKITE_COMMIT"),
+			Actor:      firstNonEmpty(getenv("BUILDKITE_BUILD_CREATOR_EMAIL"), getenv("BUILDKITE_BUILD_CREATOR")),
+		}
+	case getenv("JENKINS_URL") != "":
+		return &CIProvenance{
+			Provider:   "jenkins",
+			Repository: getenv("GIT_URL"),
+			RunURL:     getenv("BUILD_URL"),
+			Commit:     getenv("GIT_COMMIT"),
+			Actor:      getenv("BUILD_USER_ID"),
+		}
+	}
+	return nil
+}
+
+// String describes the run in one line: its URL, or the repository and commit
+func (c *CIProvenance) String() string {
+	if c.RunURL != "" {
+		return c.RunURL
+	}
+	text := c.Provider
+	if c.Repository != "" {
+		text += " " + c.Repository
+	}
+	if c.Commit != "" {
+		text += "@" + shortCommit(c.Commit)
+	}
+	return text
+}
+
+// shortCommit abbreviates a commit SHA the way COMMIT_SHORT does
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+// firstNonEmpty returns the first of values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCI(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected *CIProvenance
+	}{
+		{
+			name:     "outside CI",
+			env:      map[string]string{"GITHUB_SHA": "0123456789abcdef"},
+			expected: nil,
+		},
+		{
+			name: "github actions",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_REPOSITORY": "acme/app",
+				"GITHUB_RUN_ID":     "42",
+				"GITHUB_SHA":        "0123456789abcdef",
+				"GITHUB_ACTOR":      "octocat",
+			},
+			expected: &CIProvenance{
+				Provider:   "github",
+				Repository: "acme/app",
+				RunURL:     "https://github.com/acme/app/actions/runs/42",
+				Commit:     "0123456789abcdef",
+				Actor:      "octocat",
+			},
+		},
+		{
+			name: "github enterprise",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_SERVER_URL": "https://git.example.com/",
+				"GITHUB_REPOSITORY": "acme/app",
+				"GITHUB_RUN_ID":     "42",
+			},
+			expected: &CIProvenance{
+				Provider:   "github",
+				Repository: "acme/app",
+				RunURL:     "https://git.example.com/acme/app/actions/runs/42",
+			},
+		},
+		{
+			name: "gitlab",
+			env: map[string]string{
+				"GITLAB_CI":         "true",
+				"CI_PROJECT_PATH":   "acme/app",
+				"CI_JOB_URL":        "https://gitlab.com/acme/app/-/jobs/9",
+				"CI_COMMIT_SHA":     "fedcba9876543210",
+				"GITLAB_USER_LOGIN": "dev",
+			},
+			expected: &CIProvenance{
+				Provider:   "gitlab",
+				Repository: "acme/app",
+				RunURL:     "https://gitlab.com/acme/app/-/jobs/9",
+				Commit:     "fedcba9876543210",
+				Actor:      "dev",
+			},
+		},
+		{
+			name: "circleci",
+			env: map[string]string{
+				"CIRCLECI":                "true",
+				"CIRCLE_PROJECT_USERNAME": "acme",
+				"CIRCLE_PROJECT_REPONAME": "app",
+				"CIRCLE_SHA1":             "abc",
+			},
+			expected: &CIProvenance{Provider: "circleci", Repository: "acme/app", Commit: "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci := detectCI(func(key string) string { return tt.env[key] })
+			assert.Equal(t, tt.expected, ci)
+		})
+	}
+}
+
+func TestCIProvenanceString(t *testing.T) {
+	assert.Equal(t, "https://ci.example.com/builds/7", (&CIProvenance{Provider: "buildkite", RunURL: "https://ci.example.com/builds/7"}).String())
+	assert.Equal(t, "jenkins acme/app@01234567", (&CIProvenance{Provider: "jenkins", Repository: "acme/app", Commit: "0123456789abcdef"}).String())
+}
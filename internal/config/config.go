@@ -9,22 +9,37 @@ import (
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
 )
 
 // DatabaseConfig represents a PostgreSQL database connection configuration
 type DatabaseConfig struct {
 	// URI takes precedence over individual parameters if provided
-	URI      string `mapstructure:"uri" yaml:"uri" validate:"omitempty,uri"`
-	Host     string `mapstructure:"host" yaml:"host" validate:"required_without=URI,hostname_rfc1123|ip"`
+	URI string `mapstructure:"uri" yaml:"uri" validate:"omitempty,uri"`
+	// Host may list several servers for multi-host failover, see Hosts
+	Host     string `mapstructure:"host" yaml:"host" validate:"required_without=URI,hostlist"`
 	Port     int    `mapstructure:"port" yaml:"port" validate:"required_without=URI,min=1,max=65535"`
 	Username string `mapstructure:"username" yaml:"username" validate:"required_without=URI,min=1"`
 	Password string `mapstructure:"password" yaml:"password" validate:"omitempty"`
 	Database string `mapstructure:"database" yaml:"database" validate:"required,min=1,max=63"`
 	SSLMode  string `mapstructure:"sslmode" yaml:"sslmode" validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+	// AdminDatabase is the maintenance database admin connections use to create, drop
+	// and list databases, for servers without an accessible "postgres" database
+	AdminDatabase string `mapstructure:"admin_database" yaml:"admin_database" validate:"omitempty,max=63"`
+	// TargetSessionAttrs picks which server of a multi-host list to use, as libpq's
+	// target_session_attrs: read-write or primary skips standbys, for HA clusters
+	TargetSessionAttrs string `mapstructure:"target_session_attrs" yaml:"target_session_attrs" validate:"omitempty,oneof=any read-write read-only primary standby prefer-standby"`
 }
 
+// DefaultAdminDatabase is the maintenance database used unless one is configured
+const DefaultAdminDatabase = "postgres"
+
+// BenchBuiltin selects the built-in load for Bench instead of a pgbench command
+const BenchBuiltin = "builtin"
+
 // ForkConfig represents the complete configuration for a database fork operation
 type ForkConfig struct {
 	Source         DatabaseConfig `mapstructure:"source" yaml:"source" validate:"required"`
@@ -32,26 +47,167 @@ type ForkConfig struct {
 	TargetDatabase string         `mapstructure:"target_database" yaml:"target_database" validate:"required,min=1,max=63"`
 
 	// Fork options
-	DropIfExists   bool          `mapstructure:"drop_if_exists" yaml:"drop_if_exists"`
-	MaxConnections int           `mapstructure:"max_connections" yaml:"max_connections" validate:"min=1,max=100"`
-	ChunkSize      int           `mapstructure:"chunk_size" yaml:"chunk_size" validate:"min=100,max=100000"`
-	Timeout        time.Duration `mapstructure:"timeout" yaml:"timeout" validate:"min=1m,max=24h"`
-	SchemaOnly     bool          `mapstructure:"schema_only" yaml:"schema_only"`
-	DataOnly       bool          `mapstructure:"data_only" yaml:"data_only"`
+	DropIfExists     bool          `mapstructure:"drop_if_exists" yaml:"drop_if_exists"`
+	AutoSuffix       bool          `mapstructure:"auto_suffix" yaml:"auto_suffix"`
+	UseTemplateCache bool          `mapstructure:"use_template_cache" yaml:"use_template_cache"`
+	MaxConnections   int           `mapstructure:"max_connections" yaml:"max_connections" validate:"min=1,max=100"`
+	ChunkSize        int           `mapstructure:"chunk_size" yaml:"chunk_size" validate:"min=100,max=100000"`
+	Timeout          time.Duration `mapstructure:"timeout" yaml:"timeout" validate:"min=1m,max=24h"`
+	SchemaOnly       bool          `mapstructure:"schema_only" yaml:"schema_only"`
+	DataOnly         bool          `mapstructure:"data_only" yaml:"data_only"`
+	// TargetOwner, TargetConnectionLimit and TargetIsTemplate are set on the target
+	// once it is populated, instead of the defaults of the admin user; a connection
+	// limit of zero leaves connections uncapped
+	TargetOwner           string `mapstructure:"target_owner" yaml:"target_owner" validate:"omitempty,max=63"`
+	TargetConnectionLimit int    `mapstructure:"target_connection_limit" yaml:"target_connection_limit" validate:"min=0"`
+	TargetIsTemplate      bool   `mapstructure:"target_is_template" yaml:"target_is_template"`
+	// WaitForSourceIdle keeps retrying a template clone turned away because other
+	// sessions are connected to the source, with backoff, for up to this long; zero
+	// gives up after CREATE DATABASE's own few seconds of retries
+	WaitForSourceIdle time.Duration `mapstructure:"wait_for_source_idle" yaml:"wait_for_source_idle" validate:"min=0"`
+	// WaitForTarget keeps retrying the first connection to the destination server
+	// while it is starting up or refusing connections, for up to this long; zero
+	// fails at once
+	WaitForTarget time.Duration `mapstructure:"wait_for_target" yaml:"wait_for_target" validate:"min=0"`
+	// SkipValidate skips the preflight checks of connectivity, permissions and the
+	// target name a fork otherwise runs before changing anything
+	SkipValidate bool `mapstructure:"skip_validate" yaml:"skip_validate"`
+	// OnTableError is what a failed table copy does: abort fails the fork, continue
+	// copies the other tables and reports the failures, and retry copies the table
+	// again a few times before failing the fork
+	OnTableError string `mapstructure:"on_table_error" yaml:"on_table_error" validate:"omitempty,oneof=abort continue retry"`
+	// MinimalSchema copies only schemas, types, tables, views and sequences, with the
+	// functions those call, skipping triggers, indexes and constraints; it implies
+	// SchemaOnly
+	MinimalSchema bool `mapstructure:"minimal_schema" yaml:"minimal_schema"`
+	// ForceTransfer copies with dump and restore even where template cloning would do,
+	// as selftest does to exercise both methods on one server
+	ForceTransfer bool `mapstructure:"-" yaml:"-"`
+	// SchemaCache reuses the schema dump of a source whose schema fingerprint has not
+	// changed since it was dumped, kept in the schema directory of CacheDir
+	SchemaCache bool   `mapstructure:"schema_cache" yaml:"schema_cache"`
+	CacheDir    string `mapstructure:"cache_dir" yaml:"cache_dir"`
 
 	// Table filtering
 	IncludeTables []string `mapstructure:"include_tables" yaml:"include_tables" validate:"dive,min=1"`
 	ExcludeTables []string `mapstructure:"exclude_tables" yaml:"exclude_tables" validate:"dive,min=1"`
+	// TablePatternMode reads include and exclude entries as pg_dump-style globs, such as
+	// audit_* or analytics.*, or as regular expressions over schema.table names
+	TablePatternMode string `mapstructure:"table_pattern_mode" yaml:"table_pattern_mode" validate:"omitempty,oneof=glob regex"`
+
+	// Tables overrides the copy settings of single tables, named as in include_tables
+	Tables map[string]TableConfig `mapstructure:"tables" yaml:"tables" validate:"dive"`
+
+	// TableGroups names sets of related tables, such as orders and order_items, whose
+	// rows are read in one snapshot even when copied on their own or in chunks
+	TableGroups map[string][]string `mapstructure:"table_groups" yaml:"table_groups" validate:"dive,min=1,dive,min=1"`
+
+	// Synthetic data generated after a schema-only fork, per table unless overridden
+	SynthesizeData      bool           `mapstructure:"synthesize_data" yaml:"synthesize_data"`
+	SynthesizeRows      int            `mapstructure:"synthesize_rows" yaml:"synthesize_rows" validate:"min=0,max=1000000"`
+	SynthesizeTableRows map[string]int `mapstructure:"synthesize_table_rows" yaml:"synthesize_table_rows"`
+
+	// Post-fork maintenance: report vacuum debt, and VACUUM FREEZE the N largest tables
+	VacuumReport       bool `mapstructure:"vacuum_report" yaml:"vacuum_report"`
+	VacuumFreezeTables int  `mapstructure:"vacuum_freeze_tables" yaml:"vacuum_freeze_tables" validate:"min=0,max=1000"`
+
+	// Deterministic orders every table by its primary key and resets column-owned
+	// sequences from the data, so forks of the same data dump identically
+	Deterministic bool `mapstructure:"deterministic" yaml:"deterministic"`
+
+	// StandbyChunking copies the data of a source in recovery in short queries sized to
+	// finish within the standby's max_standby_streaming_delay, instead of one long dump
+	StandbyChunking bool `mapstructure:"standby_chunking" yaml:"standby_chunking"`
+
+	// VerifySample compares this many randomly sampled rows of every copied table with
+	// the source each VerifyInterval while a transfer loads data, failing it on the
+	// first mismatch; zero disables sampling
+	VerifySample   int           `mapstructure:"verify_sample" yaml:"verify_sample" validate:"min=0,max=10000"`
+	VerifyInterval time.Duration `mapstructure:"verify_interval" yaml:"verify_interval" validate:"min=0"`
+
+	// Bench runs a load against the target after the fork and reports its throughput
+	// and latency: "builtin" for random primary-key reads over BenchDuration, or a
+	// pgbench command line run with the target's libpq environment; empty disables it
+	Bench         string        `mapstructure:"bench" yaml:"bench"`
+	BenchDuration time.Duration `mapstructure:"bench_duration" yaml:"bench_duration" validate:"min=0"`
+
+	// Provider names the managed service hosting the destination server, such as rds,
+	// whose restrictions forks work around; auto detects it and none is self-hosted
+	Provider string `mapstructure:"provider" yaml:"provider" validate:"omitempty,oneof=auto none rds aurora cloudsql azure heroku supabase neon"`
+
+	// WorkDir holds files spooled during a fork, such as dump archives, in a directory
+	// removed when the fork ends; empty uses the system temporary directory
+	WorkDir string `mapstructure:"work_dir" yaml:"work_dir"`
+	// WorkDirMinFreeMB is the free space, in MiB, the work directory needs before a
+	// fork spools files to it
+	WorkDirMinFreeMB int `mapstructure:"work_dir_min_free_mb" yaml:"work_dir_min_free_mb" validate:"min=0"`
+
+	// BackupBeforeDrop dumps a non-empty target into the backup directory before
+	// DropIfExists drops it: "schema" dumps the schema with the data of tables up to
+	// BackupSmallTablesMB, "full" everything; empty turns backups off
+	BackupBeforeDrop    string `mapstructure:"backup_before_drop" yaml:"backup_before_drop" validate:"omitempty,oneof=schema full"`
+	BackupSmallTablesMB int    `mapstructure:"backup_small_tables_mb" yaml:"backup_small_tables_mb" validate:"min=0"`
+	// BackupDir holds the backups, one directory per database; empty uses
+	// ~/.postgres-db-fork/backups
+	BackupDir string `mapstructure:"backup_dir" yaml:"backup_dir"`
+	// BackupKeep and BackupMaxAge prune a database's older backups after each new one,
+	// keeping the newest BackupKeep of those younger than BackupMaxAge; zero turns
+	// either limit off
+	BackupKeep   int           `mapstructure:"backup_keep" yaml:"backup_keep" validate:"min=0"`
+	BackupMaxAge time.Duration `mapstructure:"backup_max_age" yaml:"backup_max_age" validate:"min=0"`
+
+	// MetricsTableLimit caps the tables with per-table series in the metrics file,
+	// the slowest first with the rest summed; zero leaves per-table series out
+	MetricsTableLimit int `mapstructure:"metrics_table_limit" yaml:"metrics_table_limit" validate:"min=0"`
+
+	// Seed lists SQL files or directories of *.sql files run against the target after the data load
+	Seed []string `mapstructure:"seed" yaml:"seed" validate:"dive,min=1"`
 
 	// CI/CD Integration features
-	OutputFormat string `mapstructure:"output_format" yaml:"output_format" validate:"oneof=text json"`
+	OutputFormat string `mapstructure:"output_format" yaml:"output_format" validate:"oneof=text json yaml porcelain"`
 	Quiet        bool   `mapstructure:"quiet" yaml:"quiet"`
 	DryRun       bool   `mapstructure:"dry_run" yaml:"dry_run"`
 	LogLevel     string `mapstructure:"log_level" yaml:"log_level" validate:"oneof=debug info warn error"`
+	// Confirm shows the resolved fork and asks before running it, as interactive forks do
+	Confirm bool `mapstructure:"confirm" yaml:"confirm"`
+	// Privacy replaces database and host names in logs and text output, for shared CI
+	// logs: "hash" with short hashes, "alias" with their roles such as source-db;
+	// empty or "none" leaves them intact
+	Privacy string `mapstructure:"privacy" yaml:"privacy" validate:"omitempty,oneof=none hash alias"`
+	// ReportFile receives the fork result as JSON, with names intact, readable only by
+	// the user running the fork
+	ReportFile string `mapstructure:"report_file" yaml:"report_file"`
+	// SchemaPlanOut receives the DDL the fork would run on the target, as a SQL script,
+	// instead of forking
+	SchemaPlanOut string `mapstructure:"schema_plan_out" yaml:"schema_plan_out"`
 
 	// Template variables for dynamic naming
 	TemplateVars map[string]string `mapstructure:"template_vars" yaml:"template_vars"`
 
+	// NamingStrategy names the entry of NamingStrategies that derives the target
+	// database name, instead of a target database given directly
+	NamingStrategy   string                          `mapstructure:"naming_strategy" yaml:"naming_strategy"`
+	NamingStrategies map[string]NamingStrategyConfig `mapstructure:"naming_strategies" yaml:"naming_strategies"`
+
+	// JobID identifies the CI job or background run in the fork's recorded lineage
+	JobID string `mapstructure:"job_id" yaml:"job_id"`
+	// CIMetadata records the CI run that made the fork (see DetectCI) in its lineage
+	CIMetadata bool `mapstructure:"ci_metadata" yaml:"ci_metadata"`
+
+	// Team owns the fork, for per-team quotas; it is recorded in the lineage
+	Team string `mapstructure:"team" yaml:"team"`
+	// Quota limits the space forks may take on the destination server
+	Quota QuotaConfig `mapstructure:"quota" yaml:"quota"`
+	// Teams restricts the sources and destination servers of each team; when set,
+	// every fork must name one of them and present its token
+	Teams     map[string]TeamAccess `mapstructure:"teams" yaml:"teams"`
+	TeamToken string                `mapstructure:"team_token" yaml:"team_token"`
+
+	// PullRequest and TTL are recorded in the lineage of forks made for a pull request,
+	// so they can be found and expired later
+	PullRequest int           `mapstructure:"pull_request" yaml:"pull_request" validate:"min=0"`
+	TTL         time.Duration `mapstructure:"ttl" yaml:"ttl" validate:"min=0"`
+
 	// Hooks for custom actions
 	Hooks HooksConfig `mapstructure:"hooks" yaml:"hooks"`
 }
@@ -64,10 +220,98 @@ type HooksConfig struct {
 	// PostFork commands are executed after a successful fork operation
 	PostFork []string `mapstructure:"post_fork" yaml:"post_fork"`
 
+	// Seed commands are executed after the data load and seed files, before PostFork
+	Seed []string `mapstructure:"seed" yaml:"seed"`
+
 	// OnError commands are executed if the fork operation fails
 	OnError []string `mapstructure:"on_error" yaml:"on_error"`
 }
 
+// QuotaConfig limits the space forks may take on the destination server. Usage is the
+// live size of the server's databases; a fork is admitted when its estimated size
+// fits. Zero limits are not enforced.
+type QuotaConfig struct {
+	// MaxTotalSizeMB caps the size of all databases on the destination server
+	MaxTotalSizeMB int `mapstructure:"max_total_size_mb" yaml:"max_total_size_mb" validate:"min=0"`
+	// Teams caps the forks of each team, by team name
+	Teams map[string]TeamQuota `mapstructure:"teams" yaml:"teams"`
+	// Wait queues a fork that does not fit for up to this long, until space is freed
+	Wait time.Duration `mapstructure:"wait" yaml:"wait" validate:"min=0"`
+}
+
+// TeamQuota limits the forks recorded for one team in their lineage
+type TeamQuota struct {
+	MaxSizeMB    int `mapstructure:"max_size_mb" yaml:"max_size_mb"`
+	MaxDatabases int `mapstructure:"max_databases" yaml:"max_databases"`
+}
+
+// Enabled reports whether any quota applies to a fork owned by team
+func (q QuotaConfig) Enabled(team string) bool {
+	teamQuota := q.Teams[team]
+	return q.MaxTotalSizeMB > 0 || (team != "" && (teamQuota.MaxSizeMB > 0 || teamQuota.MaxDatabases > 0))
+}
+
+// NamingStrategyConfig configures one named strategy for deriving database names
+type NamingStrategyConfig struct {
+	// Type selects the registered strategy implementation, e.g. template, hash or regex
+	Type string `mapstructure:"type" yaml:"type"`
+	// Template renders the name; strategies add their own variables to the template data
+	Template string `mapstructure:"template" yaml:"template"`
+	// Input is the template variable a strategy derives the name from (default: BRANCH_NAME)
+	Input string `mapstructure:"input" yaml:"input"`
+	// Pattern is the regular expression of the regex strategy
+	Pattern string `mapstructure:"pattern" yaml:"pattern"`
+	// Length is the number of hex digits the hash strategy keeps
+	Length int `mapstructure:"length" yaml:"length"`
+	// Fallback names the strategy tried when this one cannot produce a name
+	Fallback string `mapstructure:"fallback" yaml:"fallback"`
+}
+
+// TableConfig overrides the fork settings for one table; zero values keep the
+// fork-wide settings
+type TableConfig struct {
+	// ChunkSize is the number of rows copied per transaction
+	ChunkSize int `mapstructure:"chunk_size" yaml:"chunk_size" validate:"min=0,max=100000"`
+	// Where copies only the rows matching this SQL condition
+	Where string `mapstructure:"where" yaml:"where"`
+	// MaskingProfile names the entry of masking_profiles masking the rows as they are copied
+	MaskingProfile string `mapstructure:"masking_profile" yaml:"masking_profile"`
+	// Masking holds the rules of MaskingProfile for this table, as resolved by the options builder
+	Masking []masking.Rule `mapstructure:"-" yaml:"-"`
+	// Parallelism is the number of connections copying the table at once
+	Parallelism int `mapstructure:"parallelism" yaml:"parallelism" validate:"min=0,max=100"`
+	// SchemaOnly creates the table without copying its rows
+	SchemaOnly bool `mapstructure:"schema_only" yaml:"schema_only"`
+	// Transform is a program and its arguments that each copied row passes through: it
+	// reads the rows as COPY text on stdin and writes the rows to load on stdout
+	Transform []string `mapstructure:"transform" yaml:"transform"`
+}
+
+// TableGroup returns the name of the group a table belongs to, matching the table
+// with or without the public schema
+func (c *ForkConfig) TableGroup(table string) (string, bool) {
+	for name, tables := range c.TableGroups {
+		for _, member := range tables {
+			if strings.TrimPrefix(member, "public.") == strings.TrimPrefix(table, "public.") {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Copied reports whether a Tables entry has the table's rows copied on their own,
+// with its settings, rather than as part of the bulk data load
+func (t TableConfig) Copied() bool {
+	return !t.SchemaOnly && (t.ChunkSize > 0 || t.Where != "" || len(t.Masking) > 0 || t.Parallelism > 0 || len(t.Transform) > 0)
+}
+
+// Selective reports whether the settings change which rows or values the target gets,
+// which template cloning cannot do
+func (t TableConfig) Selective() bool {
+	return t.SchemaOnly || t.Where != "" || len(t.Masking) > 0 || len(t.Transform) > 0
+}
+
 // OutputConfig represents the output configuration for CI/CD integration
 type OutputConfig struct {
 	Format   string `json:"format"`
@@ -89,6 +333,11 @@ func init() {
 	if err := validate.RegisterValidation("required_without", requiredWithoutValidator); err != nil {
 		panic(fmt.Sprintf("failed to register custom validation: %v", err))
 	}
+	if err := validate.RegisterValidation("hostlist", func(fl validator.FieldLevel) bool {
+		return fl.Field().String() == "" || validHostList(fl.Field().String())
+	}); err != nil {
+		panic(fmt.Sprintf("failed to register custom validation: %v", err))
+	}
 }
 
 // requiredWithoutValidator is a custom validator that requires a field when another field is empty
@@ -108,9 +357,20 @@ func requiredWithoutValidator(fl validator.FieldLevel) bool {
 	return true
 }
 
-// parsePostgreSQLURI parses a PostgreSQL URI using the standard library's url.Parse
+// ParseURI parses a postgres:// or postgresql:// connection URI into its settings
+func ParseURI(uri string) (*DatabaseConfig, error) {
+	return parsePostgreSQLURI(uri)
+}
+
+// parsePostgreSQLURI parses a PostgreSQL URI using the standard library's url.Parse.
+// A URI listing several servers keeps them in Host, each with its own port.
 func parsePostgreSQLURI(uri string) (*DatabaseConfig, error) {
-	u, err := url.Parse(uri)
+	prefix, hostList, rest, ok := splitURIHosts(uri)
+	if !ok {
+		return nil, fmt.Errorf("invalid PostgreSQL URI: missing ://")
+	}
+	// net/url cannot parse host lists, so it sees a placeholder in their place
+	u, err := url.Parse(prefix + "localhost" + rest)
 	if err != nil {
 		return nil, fmt.Errorf("invalid PostgreSQL URI: %w", err)
 	}
@@ -120,7 +380,8 @@ func parsePostgreSQLURI(uri string) (*DatabaseConfig, error) {
 	}
 
 	config := &DatabaseConfig{
-		URI: uri,
+		URI:  uri,
+		Port: 5432, // Default PostgreSQL port
 	}
 
 	if u.User != nil {
@@ -130,16 +391,16 @@ func parsePostgreSQLURI(uri string) (*DatabaseConfig, error) {
 		}
 	}
 
-	config.Host = u.Hostname()
-
-	if portStr := u.Port(); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err == nil {
-			config.Port = port
+	if hostList != "" {
+		hosts, err := parseHostList(hostList, config.Port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host in URI: %w", err)
+		}
+		if len(hosts) == 1 {
+			config.Host, config.Port = hosts[0].Host, hosts[0].Port
 		} else {
-			return nil, fmt.Errorf("invalid port in URI: %q", portStr)
+			config.Host = hostList
 		}
-	} else {
-		config.Port = 5432 // Default PostgreSQL port
 	}
 
 	if u.Path != "" {
@@ -150,11 +411,13 @@ func parsePostgreSQLURI(uri string) (*DatabaseConfig, error) {
 	if sslmode := q.Get("sslmode"); sslmode != "" {
 		config.SSLMode = sslmode
 	}
+	config.TargetSessionAttrs = q.Get("target_session_attrs")
 
 	return config, nil
 }
 
-// ConnectionString builds a PostgreSQL connection string from the config
+// ConnectionString builds a PostgreSQL connection string from the config. Host lists
+// become libpq's host=h1,h2 port=p1,p2.
 func (c *DatabaseConfig) ConnectionString() string {
 	// If URI is provided, use it directly (pq library supports URIs natively)
 	if c.URI != "" {
@@ -167,17 +430,135 @@ func (c *DatabaseConfig) ConnectionString() string {
 		sslMode = "prefer"
 	}
 
-	return fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", // pragma: allowlist secret
-		c.Host, c.Port, c.Username, c.Password, c.Database, sslMode,
+	host, port := c.Host, strconv.Itoa(c.Port)
+	if hosts, err := parseHostList(c.Host, c.Port); err == nil && c.Host != "" {
+		names := make([]string, len(hosts))
+		ports := make([]string, len(hosts))
+		for i, h := range hosts {
+			names[i], ports[i] = h.Host, strconv.Itoa(h.Port)
+		}
+		host, port = strings.Join(names, ","), strings.Join(ports, ",")
+	}
+
+	conn := fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", // pragma: allowlist secret
+		host, port, c.Username, c.Password, c.Database, sslMode,
 	)
+	if c.TargetSessionAttrs != "" {
+		conn += " target_session_attrs=" + c.TargetSessionAttrs
+	}
+	return conn
+}
+
+// Admin returns the connection to the server's maintenance database, which admin
+// operations such as creating, dropping and listing databases go through
+func (c DatabaseConfig) Admin() DatabaseConfig {
+	if c.AdminDatabase != "" {
+		return c.WithDatabase(c.AdminDatabase)
+	}
+	return c.WithDatabase(DefaultAdminDatabase)
+}
+
+// WithDatabase returns the connection to another database of the same server. A URI
+// names its own database, so it is replaced by its individual settings.
+func (c DatabaseConfig) WithDatabase(name string) DatabaseConfig {
+	target := c.resolved()
+	target.URI = ""
+	target.Database = name
+	target.AdminDatabase = c.AdminDatabase
+	return target
+}
+
+// Redacted returns a human-readable description of the connection with the password masked
+func (c *DatabaseConfig) Redacted() string {
+	if c.URI != "" {
+		prefix, hosts, rest, ok := splitURIHosts(c.URI)
+		if !ok {
+			return "(invalid URI)"
+		}
+		u, err := url.Parse(prefix + "localhost" + rest)
+		if err != nil {
+			return "(invalid URI)"
+		}
+		u.Host = hosts
+		return u.Redacted()
+	}
+
+	target := c.Address() + "/" + c.Database
+	if c.Username != "" {
+		target = c.Username + "@" + target
+	}
+	if c.SSLMode != "" {
+		target += "?sslmode=" + c.SSLMode
+	}
+	return target
 }
 
-// IsSameServer checks if source and destination are on the same PostgreSQL server
+// SetPassword sets the connection password, updating the URI when one is in use so
+// that ConnectionString picks it up
+func (c *DatabaseConfig) SetPassword(password string) {
+	c.Password = password // pragma: allowlist secret
+	if c.URI == "" {
+		return
+	}
+	prefix, hosts, rest, ok := splitURIHosts(c.URI)
+	if !ok {
+		return
+	}
+	u, err := url.Parse(prefix + "localhost" + rest)
+	if err != nil {
+		return
+	}
+	u.Host = hosts
+	username := c.Username
+	if u.User != nil {
+		username = u.User.Username()
+	}
+	u.User = url.UserPassword(username, password)
+	c.URI = u.String()
+}
+
+// withoutPassword returns the connection with its password removed, from the URI too
+func (c DatabaseConfig) withoutPassword() DatabaseConfig {
+	c.Password = ""
+	if c.URI == "" {
+		return c
+	}
+	prefix, hosts, rest, ok := splitURIHosts(c.URI)
+	if !ok {
+		return c
+	}
+	u, err := url.Parse(prefix + "localhost" + rest)
+	if err != nil {
+		return c
+	}
+	u.Host = hosts
+	if u.User != nil {
+		u.User = url.User(u.User.Username())
+	}
+	query := u.Query()
+	if query.Has("password") {
+		query.Del("password")
+		u.RawQuery = query.Encode()
+	}
+	c.URI = u.String()
+	return c
+}
+
+// WithoutSecrets returns a copy of the configuration without its passwords and team
+// token, as recorded in job state so the fork can be repeated later
+func (c ForkConfig) WithoutSecrets() ForkConfig {
+	c.Source = c.Source.withoutPassword()
+	c.Destination = c.Destination.withoutPassword()
+	c.TeamToken = ""
+	return c
+}
+
+// IsSameServer checks if source and destination are on the same PostgreSQL server.
+// Hosts are resolved to their addresses, so "localhost", "127.0.0.1" and the
+// machine's own name match, and URI-only configs are parsed before comparing.
 func (c *ForkConfig) IsSameServer() bool {
-	return c.Source.Host == c.Destination.Host &&
-		c.Source.Port == c.Destination.Port &&
-		c.Source.Username == c.Destination.Username
+	return c.Source.endpoint().sameServer(c.Destination.endpoint())
 }
 
 // LoadFromEnvironment loads configuration from environment variables with PGFORK_ prefix
@@ -297,41 +678,112 @@ func (c *ForkConfig) LoadFromEnvironment() {
 	}
 }
 
-// ProcessTemplates processes template variables in configuration strings
+// ProcessTemplates processes template variables in the database names. Rendered
+// names must be valid PostgreSQL identifiers, so a missing variable or a value that
+// cannot be used as a name fails here instead of when the database is created.
 func (c *ForkConfig) ProcessTemplates() error {
-	// Process target database name
-	if strings.Contains(c.TargetDatabase, "{{") {
-		processed, err := c.processTemplate(c.TargetDatabase)
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"target database", &c.TargetDatabase},
+		{"source database", &c.Source.Database},
+		{"destination database", &c.Destination.Database},
+	}
+
+	for _, field := range fields {
+		if !strings.Contains(*field.value, "{{") {
+			continue
+		}
+		processed, err := c.processTemplate(*field.value)
 		if err != nil {
-			return fmt.Errorf("failed to process target database template: %w", err)
+			return fmt.Errorf("failed to process %s template: %w", field.name, err)
+		}
+		if err := ValidateIdentifier(processed); err != nil {
+			return fmt.Errorf("%s template %q rendered an invalid name: %w", field.name, *field.value, err)
 		}
-		c.TargetDatabase = processed
+		*field.value = processed
 	}
 
-	// Process source database name if it contains templates
-	if strings.Contains(c.Source.Database, "{{") {
-		processed, err := c.processTemplate(c.Source.Database)
-		if err != nil {
-			return fmt.Errorf("failed to process source database template: %w", err)
-		}
-		c.Source.Database = processed
+	return nil
+}
+
+// DefaultPullRequestDatabase names a pull request's database after its source
+const DefaultPullRequestDatabase = "{{.SOURCE_DB}}_pr_{{.PR_NUMBER}}"
+
+// PullRequestDatabase renders the name of a pull request's database from a template
+// using the given variables plus PR_NUMBER and SOURCE_DB. Unlike ProcessTemplates
+// it ignores CI environment variables, so the name always follows the number asked for.
+func PullRequestDatabase(templateStr string, number int, source string, vars map[string]string) (string, error) {
+	tmpl, err := template.New("pr").Option("missingkey=error").Parse(templateStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse name template: %w", err)
+	}
+
+	data := make(map[string]string, len(vars)+2)
+	for k, v := range vars {
+		data[k] = v
 	}
+	data["PR_NUMBER"] = strconv.Itoa(number)
+	data["SOURCE_DB"] = source
 
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("failed to render name template: %w", err)
+	}
+	if err := ValidateIdentifier(name.String()); err != nil {
+		return "", fmt.Errorf("name template %q rendered an invalid name: %w", templateStr, err)
+	}
+	return name.String(), nil
+}
+
+// ValidateIdentifier checks a name against PostgreSQL's rules for unquoted
+// identifiers: a letter or underscore followed by letters, digits, underscores or
+// dollar signs, at most 63 bytes
+func ValidateIdentifier(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if len(name) > 63 {
+		return fmt.Errorf("%q is %d bytes, PostgreSQL identifiers are limited to 63", name, len(name))
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '$' || unicode.IsDigit(r)):
+		default:
+			return fmt.Errorf("%q contains %q at position %d; use letters, digits, underscores or dollar signs, starting with a letter or underscore", name, r, i)
+		}
+	}
 	return nil
 }
 
 // processTemplate processes a single template string
 func (c *ForkConfig) processTemplate(templateStr string) (string, error) {
-	tmpl, err := template.New("config").Parse(templateStr)
+	tmpl, err := template.New("config").Option("missingkey=error").Parse(templateStr)
 	if err != nil {
 		return "", err
 	}
 
-	// Merge template variables with common CI/CD variables
+	var result strings.Builder
+	if err := tmpl.Execute(&result, c.TemplateData()); err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// TemplateData returns the variables available to name templates: the configured
+// template variables, overridden by common CI/CD environment variables. BRANCH is
+// the sanitized branch name from CI and BRANCH_NAME the branch as CI reports it.
+func (c *ForkConfig) TemplateData() map[string]string {
 	vars := make(map[string]string)
 	for k, v := range c.TemplateVars {
 		vars[k] = v
 	}
+	if _, ok := vars["BRANCH_NAME"]; !ok && vars["BRANCH"] != "" {
+		vars["BRANCH_NAME"] = vars["BRANCH"]
+	}
 
 	// Add common CI/CD environment variables
 	if prNumber := os.Getenv("GITHUB_PR_NUMBER"); prNumber != "" {
@@ -341,10 +793,12 @@ func (c *ForkConfig) processTemplate(templateStr string) (string, error) {
 		vars["PR_NUMBER"] = prNumber
 	}
 	if branch := os.Getenv("GITHUB_HEAD_REF"); branch != "" {
-		vars["BRANCH"] = sanitizeBranchName(branch)
+		vars["BRANCH"] = SanitizeBranchName(branch)
+		vars["BRANCH_NAME"] = branch
 	}
 	if branch := os.Getenv("CI_COMMIT_REF_NAME"); branch != "" {
-		vars["BRANCH"] = sanitizeBranchName(branch)
+		vars["BRANCH"] = SanitizeBranchName(branch)
+		vars["BRANCH_NAME"] = branch
 	}
 	if commit := os.Getenv("GITHUB_SHA"); commit != "" && len(commit) >= 8 {
 		vars["COMMIT_SHORT"] = commit[:8]
@@ -352,18 +806,11 @@ func (c *ForkConfig) processTemplate(templateStr string) (string, error) {
 	if commit := os.Getenv("CI_COMMIT_SHA"); commit != "" && len(commit) >= 8 {
 		vars["COMMIT_SHORT"] = commit[:8]
 	}
-
-	var result strings.Builder
-	err = tmpl.Execute(&result, vars)
-	if err != nil {
-		return "", err
-	}
-
-	return result.String(), nil
+	return vars
 }
 
-// sanitizeBranchName converts branch names to valid database identifiers
-func sanitizeBranchName(branch string) string {
+// SanitizeBranchName converts branch names to valid database identifiers
+func SanitizeBranchName(branch string) string {
 	// Replace invalid characters with underscores
 	result := strings.ReplaceAll(branch, "/", "_")
 	result = strings.ReplaceAll(result, "-", "_")
@@ -401,18 +848,68 @@ func (c *ForkConfig) Validate() error {
 	return nil
 }
 
+// TableSettings returns the settings of one table: its entry in Tables over the
+// fork-wide chunk size and a single connection. Tables in the public schema match
+// with or without the schema.
+func (c *ForkConfig) TableSettings(table string) TableConfig {
+	var settings TableConfig
+	for name, entry := range c.Tables {
+		if strings.TrimPrefix(name, "public.") == strings.TrimPrefix(table, "public.") {
+			settings = entry
+			break
+		}
+	}
+	if settings.ChunkSize == 0 {
+		settings.ChunkSize = c.ChunkSize
+	}
+	if settings.Parallelism == 0 {
+		settings.Parallelism = 1
+	}
+	return settings
+}
+
+// TableFilter compiles the include and exclude lists
+func (c *ForkConfig) TableFilter() (*TableFilter, error) {
+	return NewTableFilter(c.IncludeTables, c.ExcludeTables, c.TablePatternMode)
+}
+
 // validateBusinessLogic performs custom validation that can't be expressed with struct tags
 func (c *ForkConfig) validateBusinessLogic() error {
 	// Validate conflicting options
 	if c.SchemaOnly && c.DataOnly {
 		return fmt.Errorf("cannot specify both schema-only and data-only options")
 	}
+	if c.SchemaPlanOut != "" && c.DataOnly {
+		return fmt.Errorf("schema-plan-out cannot be used with data-only, which runs no DDL")
+	}
+	if c.DropIfExists && c.AutoSuffix {
+		return fmt.Errorf("cannot specify both drop-if-exists and auto-suffix options")
+	}
+	if c.SynthesizeData && !c.SchemaOnly {
+		return fmt.Errorf("synthesize-data requires schema-only, generated rows would mix with copied data")
+	}
+	if c.Deterministic && c.SynthesizeData {
+		return fmt.Errorf("cannot specify both deterministic and synthesize-data options, generated rows differ between forks")
+	}
+	if c.VerifySample > 0 && c.VerifyInterval <= 0 {
+		return fmt.Errorf("verify-sample needs a positive verify-interval")
+	}
+	if c.Bench == BenchBuiltin && c.BenchDuration <= 0 {
+		return fmt.Errorf("the builtin bench needs a positive bench-duration")
+	}
+	if c.BackupBeforeDrop != "" && !c.DropIfExists {
+		return fmt.Errorf("backup-before-drop requires drop-if-exists")
+	}
 
 	// Validate same database on same server
 	if c.Source.Database == c.TargetDatabase && c.IsSameServer() {
 		return fmt.Errorf("source and target databases cannot be the same on the same server")
 	}
 
+	if _, err := c.TableFilter(); err != nil {
+		return err
+	}
+
 	// Validate table filtering conflicts
 	if len(c.IncludeTables) > 0 && len(c.ExcludeTables) > 0 {
 		// Check for overlapping tables
@@ -428,6 +925,26 @@ func (c *ForkConfig) validateBusinessLogic() error {
 		}
 	}
 
+	for name, table := range c.Tables {
+		if table.SchemaOnly && (table.Where != "" || table.MaskingProfile != "") {
+			return fmt.Errorf("table '%s': schema_only cannot be combined with where or masking_profile", name)
+		}
+	}
+
+	grouped := make(map[string]string)
+	for name, tables := range c.TableGroups {
+		for _, table := range tables {
+			key := strings.TrimPrefix(table, "public.")
+			if other, ok := grouped[key]; ok && other != name {
+				return fmt.Errorf("table '%s' cannot be in both table groups '%s' and '%s'", table, other, name)
+			}
+			grouped[key] = name
+			if c.TableSettings(table).SchemaOnly {
+				return fmt.Errorf("table group '%s': table '%s' is schema_only", name, table)
+			}
+		}
+	}
+
 	// Validate URI vs individual parameters
 	if err := c.Source.validateURIConsistency(); err != nil {
 		return fmt.Errorf("source configuration: %w", err)
@@ -437,7 +954,7 @@ func (c *ForkConfig) validateBusinessLogic() error {
 		return fmt.Errorf("destination configuration: %w", err)
 	}
 
-	return nil
+	return c.authorizeTeam()
 }
 
 // validateURIConsistency ensures URI and individual parameters are not conflicting
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HostPort is one server of a connection's host list
+type HostPort struct {
+	Host string
+	Port int
+}
+
+// Address returns the server as host:port, with IPv6 addresses bracketed, or the
+// socket directory
+func (h HostPort) Address() string {
+	if strings.HasPrefix(h.Host, "/") {
+		return h.Host
+	}
+	return net.JoinHostPort(h.Host, strconv.Itoa(h.Port))
+}
+
+// Hosts returns the servers of the connection in the order libpq tries them. Host
+// may list several servers separated by commas, for multi-host failover, each with
+// an optional port of its own; IPv6 addresses are bracketed when a port follows,
+// as in "db1:5432,[2001:db8::2]:5433". Servers without a port use Port.
+func (c DatabaseConfig) Hosts() ([]HostPort, error) {
+	cfg := c.resolved()
+	port := cfg.Port
+	if port == 0 {
+		port = 5432
+	}
+	return parseHostList(cfg.Host, port)
+}
+
+// Address returns the connection's servers as host:port, separated by commas
+func (c DatabaseConfig) Address() string {
+	hosts, err := c.Hosts()
+	if err != nil {
+		return fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	addresses := make([]string, len(hosts))
+	for i, host := range hosts {
+		addresses[i] = host.Address()
+	}
+	return strings.Join(addresses, ",")
+}
+
+// ForHost returns the connection to one of its servers, for clients without libpq's
+// multi-host failover. A URI keeps its other parameters; target_session_attrs is
+// left to the caller to check.
+func (c DatabaseConfig) ForHost(host HostPort) DatabaseConfig {
+	single := c
+	single.TargetSessionAttrs = ""
+	if c.URI == "" {
+		single.Host = host.Host
+		single.Port = host.Port
+		return single
+	}
+
+	prefix, _, rest, ok := splitURIHosts(c.URI)
+	if !ok {
+		return single
+	}
+	if i := strings.IndexAny(rest, "?"); i >= 0 {
+		query, err := url.ParseQuery(rest[i+1:])
+		if err == nil {
+			query.Del("target_session_attrs")
+			rest = rest[:i]
+			if len(query) > 0 {
+				rest += "?" + query.Encode()
+			}
+		}
+	}
+	single.URI = prefix + host.Address() + rest
+	single.Host = host.Host
+	single.Port = host.Port
+	return single
+}
+
+// parseHostList splits a comma-separated host list into servers, giving those
+// without a port of their own the default port
+func parseHostList(list string, port int) ([]HostPort, error) {
+	if strings.TrimSpace(list) == "" {
+		return []HostPort{{Host: "localhost", Port: port}}, nil
+	}
+	var hosts []HostPort
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		host, entryPort, err := splitHostPort(entry, port)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, HostPort{Host: host, Port: entryPort})
+	}
+	return hosts, nil
+}
+
+// splitHostPort splits one server of a host list into its host and port. An
+// unbracketed IPv6 address has no port.
+func splitHostPort(entry string, port int) (string, int, error) {
+	switch {
+	case entry == "":
+		return "", 0, fmt.Errorf("empty host in host list")
+	case strings.HasPrefix(entry, "/"):
+		return entry, port, nil
+	case strings.HasPrefix(entry, "["):
+		end := strings.Index(entry, "]")
+		if end < 0 {
+			return "", 0, fmt.Errorf("invalid host %q: missing ]", entry)
+		}
+		host, rest := entry[1:end], entry[end+1:]
+		if net.ParseIP(host) == nil {
+			return "", 0, fmt.Errorf("invalid IPv6 address %q", host)
+		}
+		if rest == "" {
+			return host, port, nil
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", 0, fmt.Errorf("invalid host %q", entry)
+		}
+		p, err := parsePort(rest[1:])
+		return host, p, err
+	case strings.Count(entry, ":") > 1:
+		if net.ParseIP(entry) == nil {
+			return "", 0, fmt.Errorf("invalid IPv6 address %q", entry)
+		}
+		return entry, port, nil
+	}
+	host, portStr, ok := strings.Cut(entry, ":")
+	if !ok {
+		return host, port, nil
+	}
+	p, err := parsePort(portStr)
+	return host, p, err
+}
+
+// parsePort parses a TCP port
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+// splitURIHosts splits a postgres:// URI around its host list, which net/url cannot
+// parse when it names several servers or bracketed IPv6 addresses with ports
+func splitURIHosts(uri string) (prefix, hosts, rest string, ok bool) {
+	scheme, after, found := strings.Cut(uri, "://")
+	if !found {
+		return "", "", "", false
+	}
+	end := strings.IndexAny(after, "/?#")
+	if end < 0 {
+		end = len(after)
+	}
+	authority := after[:end]
+	start := strings.LastIndex(authority, "@") + 1
+	return scheme + "://" + authority[:start], authority[start:], after[end:], true
+}
+
+// validHostList reports whether every server of a host list is a host name, IP
+// address or socket directory
+func validHostList(list string) bool {
+	hosts, err := parseHostList(list, 5432)
+	if err != nil {
+		return false
+	}
+	for _, host := range hosts {
+		if strings.HasPrefix(host.Host, "/") || net.ParseIP(host.Host) != nil {
+			continue
+		}
+		if validate.Var(host.Host, "hostname_rfc1123") != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keyNode is a tree of the keys config files and profiles may contain. A node without
+// children accepts any value, including a nested map; a "*" child matches any key.
+type keyNode map[string]keyNode
+
+var (
+	knownKeysMu sync.RWMutex
+	knownKeys   = keyNode{}
+)
+
+// connectionKeys are the keys of a connection section, including the "user" alias
+// written by profiles
+var connectionKeys = append([]string{"uri", "username", "admin_database"}, connectionFields...)
+
+func init() {
+	registerStruct("", reflect.TypeOf(ForkConfig{}))
+	// The destination section may also be called target
+	RegisterConnection("target")
+	// Shared options that are not part of ForkConfig
+	RegisterOptions(OptCacheTTL)
+}
+
+// RegisterKeys declares dotted config keys that a command reads, so that CheckKeys
+// accepts them. A "*" segment matches any key.
+func RegisterKeys(keys ...string) {
+	knownKeysMu.Lock()
+	defer knownKeysMu.Unlock()
+	for _, key := range keys {
+		node := knownKeys
+		for _, part := range strings.Split(key, ".") {
+			child, ok := node[part]
+			if !ok {
+				child = keyNode{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+}
+
+// RegisterOptions declares the config keys of options
+func RegisterOptions(opts ...Option) {
+	for _, opt := range opts {
+		if opt.Key != "" {
+			RegisterKeys(opt.Key)
+		}
+	}
+}
+
+// RegisterConnection declares connection sections, such as the section of a
+// ServerConnection
+func RegisterConnection(sections ...string) {
+	for _, section := range sections {
+		for _, key := range connectionKeys {
+			RegisterKeys(section + "." + key)
+		}
+	}
+}
+
+// registerStruct declares the mapstructure keys of a configuration struct
+func registerStruct(prefix string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		switch {
+		case field.Type == reflect.TypeOf(DatabaseConfig{}):
+			RegisterConnection(key)
+		case field.Type.Kind() == reflect.Struct:
+			registerStruct(key+".", field.Type)
+		case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.Struct:
+			registerStruct(key+".*.", field.Type.Elem())
+		default:
+			RegisterKeys(key)
+		}
+	}
+}
+
+// CheckKeys rejects keys of a config file or profile that no command reads, which
+// would otherwise be ignored silently. Each unknown key comes with the closest known
+// key when it looks like a typo of one, e.g. drop_if_exist for drop_if_exists.
+func CheckKeys(settings map[string]interface{}) error {
+	knownKeysMu.RLock()
+	defer knownKeysMu.RUnlock()
+
+	var unknown []string
+	checkKeys(knownKeys, "", settings, &unknown)
+	switch len(unknown) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("unknown config key %s", unknown[0])
+	default:
+		return fmt.Errorf("unknown config keys %s", strings.Join(unknown, ", "))
+	}
+}
+
+// CheckKey rejects a single dotted key that CheckKeys would reject
+func CheckKey(key string) error {
+	parts := strings.Split(strings.ToLower(key), ".")
+	var settings interface{} = ""
+	for i := len(parts) - 1; i >= 0; i-- {
+		settings = map[string]interface{}{parts[i]: settings}
+	}
+	return CheckKeys(settings.(map[string]interface{}))
+}
+
+// checkKeys appends the keys of value that known does not accept to unknown
+func checkKeys(known keyNode, prefix string, value interface{}, unknown *[]string) {
+	if len(known) == 0 {
+		return
+	}
+	entries := stringMap(value)
+	if entries == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child, ok := known[key]
+		if !ok {
+			child, ok = known["*"]
+		}
+		if !ok {
+			problem := prefix + key
+			if suggestion := suggestKey(key, known); suggestion != "" {
+				problem += fmt.Sprintf(" (did you mean %s%s?)", prefix, suggestion)
+			}
+			*unknown = append(*unknown, problem)
+			continue
+		}
+		checkKeys(child, prefix+key+".", entries[key], unknown)
+	}
+}
+
+// stringMap returns a nested mapping with string keys, or nil if value is not a mapping
+func stringMap(value interface{}) map[string]interface{} {
+	switch node := value.(type) {
+	case map[string]interface{}:
+		return node
+	case map[interface{}]interface{}:
+		// yaml.v2 decodes nested mappings with interface{} keys
+		entries := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			entries[fmt.Sprint(k)] = v
+		}
+		return entries
+	default:
+		return nil
+	}
+}
+
+// suggestKey returns the known key closest to key, if it is close enough to be a typo
+func suggestKey(key string, known keyNode) string {
+	best, bestDistance := "", 0
+	for candidate := range known {
+		if candidate == "*" {
+			continue
+		}
+		distance := editDistance(key, candidate)
+		// Allow two edits, or one in four characters for long keys
+		if distance > 2 && distance*4 > len(candidate) {
+			continue
+		}
+		if best == "" || distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
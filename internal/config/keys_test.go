@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCheckKeys(t *testing.T) {
+	RegisterConnection("cleanup")
+	RegisterOptions(Option{Key: "cleanup.pattern"}, Option{Key: "cleanup.older_than"})
+
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "known keys",
+			yaml: `
+source: {host: prod, username: app, database: app}
+target: {uri: "postgresql://dev/"}
+drop_if_exists: true
+template_vars: {APP_NAME: app}
+hooks: {pre_fork: [echo]}
+naming_strategies:
+  short: {type: hash, length: 6}
+cleanup: {user: ci, pattern: "app_*"}
+cache_ttl: 5m
+`,
+		},
+		{
+			name: "typo",
+			yaml: "drop_if_exist: true",
+			err:  "unknown config key drop_if_exist (did you mean drop_if_exists?)",
+		},
+		{
+			name: "nested typos",
+			yaml: `
+source: {hots: prod}
+cleanup: {pattren: "app_*"}
+naming_strategies:
+  short: {type: hash, lenght: 6}
+`,
+			err: "unknown config keys cleanup.pattren (did you mean cleanup.pattern?), " +
+				"naming_strategies.short.lenght (did you mean naming_strategies.short.length?), " +
+				"source.hots (did you mean source.host?)",
+		},
+		{
+			name: "no suggestion",
+			yaml: "workers: 8",
+			err:  "unknown config key workers",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var settings map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &settings); err != nil {
+				t.Fatal(err)
+			}
+			err := CheckKeys(settings)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	assert.NoError(t, CheckKey("Source.Host"))
+	assert.NoError(t, CheckKey("template_vars.app_name"))
+	assert.EqualError(t, CheckKey("chunk_sise"), "unknown config key chunk_sise (did you mean chunk_size?)")
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("host", "host"))
+	assert.Equal(t, 1, editDistance("drop_if_exist", "drop_if_exists"))
+	assert.Equal(t, 2, editDistance("pattren", "pattern"))
+	assert.Equal(t, 4, editDistance("", "port"))
+}
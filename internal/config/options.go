@@ -0,0 +1,1153 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Settings is a read-only view of a configuration layer such as a config file or profile
+type Settings interface {
+	IsSet(key string) bool
+	Get(key string) interface{}
+}
+
+// MapSettings adapts a nested map (as decoded from YAML or JSON) to the Settings interface.
+// Keys are dot-separated paths, e.g. "source.host".
+type MapSettings map[string]interface{}
+
+// IsSet reports whether the dotted key is present in the map
+func (m MapSettings) IsSet(key string) bool {
+	_, ok := m.lookup(key)
+	return ok
+}
+
+// Get returns the value stored under the dotted key, or nil
+func (m MapSettings) Get(key string) interface{} {
+	value, _ := m.lookup(key)
+	return value
+}
+
+func (m MapSettings) lookup(key string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(m)
+	for _, part := range strings.Split(key, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case map[interface{}]interface{}:
+			// yaml.v2 decodes nested mappings with interface{} keys
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		default:
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+// runSettings are the keys of how a single run reports and identifies itself, which
+// a repeated fork does not take over from the one it repeats
+var runSettings = []string{"job_id", "output_format", "quiet", "dry_run", "log_level", "confirm", "report_file", "schema_plan_out"}
+
+// Settings returns the configuration as a settings layer, so a recorded fork can be
+// repeated with the layers above it overriding its settings. Connections given as a
+// URI keep only the URI and the settings kept next to one.
+func (c ForkConfig) Settings() (MapSettings, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var settings MapSettings
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	for _, key := range runSettings {
+		delete(settings, key)
+	}
+	for section, conn := range map[string]DatabaseConfig{"source": c.Source, "destination": c.Destination} {
+		if conn.URI == "" {
+			continue
+		}
+		settings[section] = map[string]interface{}{
+			"uri":                  conn.URI,
+			"admin_database":       conn.AdminDatabase,
+			"target_session_attrs": conn.TargetSessionAttrs,
+		}
+	}
+	return settings, nil
+}
+
+// Option identifies a single setting across every configuration layer
+type Option struct {
+	// Key is the config file / profile key, e.g. "cleanup.pattern"
+	Key string
+	// Env lists environment variables, lowest precedence first
+	Env []string
+	// Flag is the command-line flag name
+	Flag string
+}
+
+// ConnectionFlags names the flags carrying one connection's settings.
+// Empty names mean the command has no such flag.
+type ConnectionFlags struct {
+	URI string
+	// URIAliases are alternative flags holding a connection URI, e.g. --target-uri
+	URIAliases []string
+	Host       string
+	Port       string
+	User       string
+	Password   string
+	Database   string
+	SSLMode    string
+	// AdminDatabase is the flag naming the maintenance database, e.g. --admin-db
+	AdminDatabase string
+}
+
+// ConnectionSource describes where the settings for one database connection are read from
+type ConnectionSource struct {
+	// Sections are config file sections, lowest precedence first
+	Sections []string
+	// EnvPrefixes are environment variable prefixes, lowest precedence first
+	EnvPrefixes []string
+	// URIEnv lists additional environment variables holding a connection URI
+	URIEnv []string
+	Flags  ConnectionFlags
+}
+
+var (
+	// SourceConnection is the source database as configured for fork-style commands
+	SourceConnection = ConnectionSource{
+		Sections:    []string{"source"},
+		EnvPrefixes: []string{"PGFORK_SOURCE_"},
+		Flags: ConnectionFlags{
+			URI:        "source-uri",
+			URIAliases: []string{"source"},
+			Host:       "source-host",
+			Port:       "source-port",
+			User:       "source-user",
+			Password:   "source-password",
+			Database:   "source-db",
+			SSLMode:    "source-sslmode",
+		},
+	}
+
+	// DestinationConnection is the destination server as configured for fork-style commands
+	DestinationConnection = ConnectionSource{
+		Sections:    []string{"target", "destination"},
+		EnvPrefixes: []string{"PGFORK_DEST_"},
+		URIEnv:      []string{"PGFORK_TARGET_URI"},
+		Flags: ConnectionFlags{
+			URI:           "dest-uri",
+			URIAliases:    []string{"target-uri"},
+			Host:          "dest-host",
+			Port:          "dest-port",
+			User:          "dest-user",
+			Password:      "dest-password",
+			SSLMode:       "dest-sslmode",
+			AdminDatabase: "admin-db",
+		},
+	}
+)
+
+// ServerConnection returns the connection source for server-level commands such as
+// list and cleanup. The destination settings act as a fallback for the command's own
+// section and PGFORK_<COMMAND>_* variables.
+func ServerConnection(command string) ConnectionSource {
+	return ConnectionSource{
+		Sections:    []string{"destination", command},
+		EnvPrefixes: []string{"PGFORK_DEST_", "PGFORK_" + strings.ToUpper(command) + "_"},
+		Flags: ConnectionFlags{
+			Host:          "host",
+			Port:          "port",
+			User:          "user",
+			Password:      "password",
+			SSLMode:       "sslmode",
+			AdminDatabase: "admin-db",
+		},
+	}
+}
+
+// Fork-level options shared by every command that builds a ForkConfig
+var (
+	OptTargetDatabase     = Option{Key: "target_database", Env: []string{"PGFORK_TARGET_DATABASE"}, Flag: "target-db"}
+	OptDropIfExists       = Option{Key: "drop_if_exists", Env: []string{"PGFORK_DROP_IF_EXISTS"}, Flag: "drop-if-exists"}
+	OptTargetOwner        = Option{Key: "target_owner", Env: []string{"PGFORK_TARGET_OWNER"}, Flag: "target-owner"}
+	OptTargetConnLimit    = Option{Key: "target_connection_limit", Env: []string{"PGFORK_TARGET_CONNECTION_LIMIT"}, Flag: "target-connection-limit"}
+	OptTargetIsTemplate   = Option{Key: "target_is_template", Env: []string{"PGFORK_TARGET_IS_TEMPLATE"}, Flag: "target-is-template"}
+	OptWaitForSourceIdle  = Option{Key: "wait_for_source_idle", Env: []string{"PGFORK_WAIT_FOR_SOURCE_IDLE"}, Flag: "wait-for-source-idle"}
+	OptWaitForTarget      = Option{Key: "wait_for_target", Env: []string{"PGFORK_WAIT_FOR_TARGET"}, Flag: "wait-for-target"}
+	OptSkipValidate       = Option{Key: "skip_validate", Env: []string{"PGFORK_SKIP_VALIDATE"}, Flag: "skip-validate"}
+	OptOnTableError       = Option{Key: "on_table_error", Env: []string{"PGFORK_ON_TABLE_ERROR"}, Flag: "on-table-error"}
+	OptAutoSuffix         = Option{Key: "auto_suffix", Env: []string{"PGFORK_AUTO_SUFFIX"}, Flag: "auto-suffix"}
+	OptUseTemplateCache   = Option{Key: "use_template_cache", Env: []string{"PGFORK_USE_TEMPLATE_CACHE"}, Flag: "use-template-cache"}
+	OptSchemaCache        = Option{Key: "schema_cache", Env: []string{"PGFORK_SCHEMA_CACHE"}, Flag: "schema-cache"}
+	OptMaxConnections     = Option{Key: "max_connections", Env: []string{"PGFORK_MAX_CONNECTIONS"}, Flag: "max-connections"}
+	OptChunkSize          = Option{Key: "chunk_size", Env: []string{"PGFORK_CHUNK_SIZE"}, Flag: "chunk-size"}
+	OptTimeout            = Option{Key: "timeout", Env: []string{"PGFORK_TIMEOUT"}, Flag: "timeout"}
+	OptIncludeTables      = Option{Key: "include_tables", Env: []string{"PGFORK_INCLUDE_TABLES"}, Flag: "include-tables"}
+	OptExcludeTables      = Option{Key: "exclude_tables", Env: []string{"PGFORK_EXCLUDE_TABLES"}, Flag: "exclude-tables"}
+	OptTablePatternMode   = Option{Key: "table_pattern_mode", Env: []string{"PGFORK_TABLE_PATTERN_MODE"}, Flag: "table-pattern-mode"}
+	OptSchemaOnly         = Option{Key: "schema_only", Env: []string{"PGFORK_SCHEMA_ONLY"}, Flag: "schema-only"}
+	OptDataOnly           = Option{Key: "data_only", Env: []string{"PGFORK_DATA_ONLY"}, Flag: "data-only"}
+	OptMinimalSchema      = Option{Key: "minimal_schema", Env: []string{"PGFORK_MINIMAL_SCHEMA"}, Flag: "minimal-schema"}
+	OptSeed               = Option{Key: "seed", Env: []string{"PGFORK_SEED"}, Flag: "seed"}
+	OptSynthesizeData     = Option{Key: "synthesize_data", Env: []string{"PGFORK_SYNTHESIZE_DATA"}, Flag: "synthesize-data"}
+	OptSynthesizeRows     = Option{Key: "synthesize_rows", Env: []string{"PGFORK_SYNTHESIZE_ROWS"}, Flag: "synthesize-rows"}
+	OptVacuumReport       = Option{Key: "vacuum_report", Env: []string{"PGFORK_VACUUM_REPORT"}, Flag: "vacuum-report"}
+	OptVacuumFreezeTables = Option{Key: "vacuum_freeze_tables", Env: []string{"PGFORK_VACUUM_FREEZE_TABLES"}, Flag: "vacuum-freeze-tables"}
+	OptNamingStrategy     = Option{Key: "naming_strategy", Env: []string{"PGFORK_NAMING_STRATEGY"}, Flag: "naming-strategy"}
+	OptDeterministic      = Option{Key: "deterministic", Env: []string{"PGFORK_DETERMINISTIC"}, Flag: "deterministic"}
+	OptStandbyChunking    = Option{Key: "standby_chunking", Env: []string{"PGFORK_STANDBY_CHUNKING"}, Flag: "standby-chunking"}
+	OptVerifySample       = Option{Key: "verify_sample", Env: []string{"PGFORK_VERIFY_SAMPLE"}, Flag: "verify-sample"}
+	OptVerifyInterval     = Option{Key: "verify_interval", Env: []string{"PGFORK_VERIFY_INTERVAL"}, Flag: "verify-interval"}
+	OptBench              = Option{Key: "bench", Env: []string{"PGFORK_BENCH"}, Flag: "bench"}
+	OptBenchDuration      = Option{Key: "bench_duration", Env: []string{"PGFORK_BENCH_DURATION"}, Flag: "bench-duration"}
+	OptMetricsTableLimit  = Option{Key: "metrics_table_limit", Env: []string{"PGFORK_METRICS_TABLE_LIMIT"}, Flag: "metrics-table-limit"}
+	OptBackupBeforeDrop   = Option{Key: "backup_before_drop", Env: []string{"PGFORK_BACKUP_BEFORE_DROP"}, Flag: "backup-before-drop"}
+	OptBackupSmallTables  = Option{Key: "backup_small_tables_mb", Env: []string{"PGFORK_BACKUP_SMALL_TABLES_MB"}, Flag: "backup-small-tables-mb"}
+	OptBackupDir          = Option{Key: "backup_dir", Env: []string{"PGFORK_BACKUP_DIR"}, Flag: "backup-dir"}
+	OptBackupKeep         = Option{Key: "backup_keep", Env: []string{"PGFORK_BACKUP_KEEP"}, Flag: "backup-keep"}
+	OptBackupMaxAge       = Option{Key: "backup_max_age", Env: []string{"PGFORK_BACKUP_MAX_AGE"}, Flag: "backup-max-age"}
+	OptProvider           = Option{Key: "provider", Env: []string{"PGFORK_PROVIDER"}, Flag: "provider"}
+	OptWorkDir            = Option{Key: "work_dir", Env: []string{"PGFORK_WORK_DIR"}, Flag: "work-dir"}
+	OptWorkDirMinFree     = Option{Key: "work_dir_min_free_mb", Env: []string{"PGFORK_WORK_DIR_MIN_FREE_MB"}, Flag: "work-dir-min-free-mb"}
+	OptOutputFormat       = Option{Key: "output_format", Env: []string{"PGFORK_OUTPUT_FORMAT"}, Flag: "output-format"}
+	OptQuiet              = Option{Key: "quiet", Env: []string{"PGFORK_QUIET"}, Flag: "quiet"}
+	OptDryRun             = Option{Key: "dry_run", Env: []string{"PGFORK_DRY_RUN"}, Flag: "dry-run"}
+	OptConfirm            = Option{Key: "confirm", Env: []string{"PGFORK_CONFIRM"}, Flag: "confirm"}
+	OptPrivacy            = Option{Key: "privacy", Env: []string{"PGFORK_PRIVACY"}, Flag: "privacy"}
+	OptReportFile         = Option{Key: "report_file", Env: []string{"PGFORK_REPORT_FILE"}, Flag: "report-file"}
+	OptSchemaPlanOut      = Option{Key: "schema_plan_out", Env: []string{"PGFORK_SCHEMA_PLAN_OUT"}, Flag: "schema-plan-out"}
+	OptLogLevel           = Option{Key: "log_level", Env: []string{"PGFORK_LOG_LEVEL"}, Flag: "log-level"}
+	OptJobID              = Option{Key: "job_id", Env: []string{"PGFORK_JOB_ID"}, Flag: "job-id"}
+	OptCIMetadata         = Option{Key: "ci_metadata", Env: []string{"PGFORK_CI_METADATA"}, Flag: "ci-metadata"}
+	OptTeam               = Option{Key: "team", Env: []string{"PGFORK_TEAM"}, Flag: "team"}
+	OptTeamToken          = Option{Key: "team_token", Env: []string{"PGFORK_TEAM_TOKEN"}, Flag: "team-token"}
+	OptQuotaMaxTotalSize  = Option{Key: "quota.max_total_size_mb", Env: []string{"PGFORK_QUOTA_MAX_TOTAL_SIZE_MB"}, Flag: "quota-max-total-size-mb"}
+	OptQuotaWait          = Option{Key: "quota.wait", Env: []string{"PGFORK_QUOTA_WAIT"}, Flag: "quota-wait"}
+	OptCacheTTL           = Option{Key: "cache_ttl", Env: []string{"PGFORK_CACHE_TTL"}, Flag: "cache-ttl"}
+	OptCacheDir           = Option{Key: "cache_dir", Env: []string{"PGFORK_CACHE_DIR"}, Flag: "cache-dir"}
+)
+
+// OptionsBuilder resolves command configuration from flags, environment variables,
+// profiles and config files. Precedence, highest first:
+//
+//	flags > PGFORK_* environment variables > profile > config file > defaults
+//
+// Every command that talks to a database should use it so that all of them accept
+// the same sources in the same order.
+type OptionsBuilder struct {
+	flags    *pflag.FlagSet
+	settings []Settings // lowest precedence first
+	useEnv   bool
+	// resolvers turn connection references into URIs, by the scheme of the reference
+	resolvers map[string]URIResolver
+}
+
+// URIResolver returns the connection URI a reference such as heroku:myapp points to
+type URIResolver func(ref string) (string, error)
+
+// NewOptionsBuilder creates a builder reading flags from the given flag set.
+// Environment variables are enabled by default.
+func NewOptionsBuilder(flags *pflag.FlagSet) *OptionsBuilder {
+	return &OptionsBuilder{
+		flags:  flags,
+		useEnv: true,
+	}
+}
+
+// WithSettings adds a settings layer. Layers added later take precedence,
+// so add the config file before the profile.
+func (b *OptionsBuilder) WithSettings(s Settings) *OptionsBuilder {
+	if s != nil {
+		b.settings = append(b.settings, s)
+	}
+	return b
+}
+
+// WithEnvironment enables or disables reading PGFORK_* environment variables
+func (b *OptionsBuilder) WithEnvironment(enabled bool) *OptionsBuilder {
+	b.useEnv = enabled
+	return b
+}
+
+// WithURIResolver accepts references of the form <scheme>:<name> wherever a connection
+// URI is accepted, resolving the one that takes effect with resolve
+func (b *OptionsBuilder) WithURIResolver(scheme string, resolve URIResolver) *OptionsBuilder {
+	if b.resolvers == nil {
+		b.resolvers = make(map[string]URIResolver)
+	}
+	b.resolvers[scheme] = resolve
+	return b
+}
+
+// Value returns the highest-precedence value set for the option
+func (b *OptionsBuilder) Value(opt Option) (interface{}, bool) {
+	if value, ok := b.flagValue(opt.Flag); ok {
+		return value, true
+	}
+	if value, ok := b.envValue(opt.Env...); ok {
+		return value, true
+	}
+	return b.settingsValue(opt.Key)
+}
+
+// GetString resolves a string option, returning def when it is not set anywhere
+func (b *OptionsBuilder) GetString(opt Option, def string) (string, error) {
+	value, ok := b.Value(opt)
+	if !ok {
+		return def, nil
+	}
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid value for %s: %w", opt.describe(), err)
+	}
+	return s, nil
+}
+
+// GetInt resolves an integer option, returning def when it is not set anywhere
+func (b *OptionsBuilder) GetInt(opt Option, def int) (int, error) {
+	value, ok := b.Value(opt)
+	if !ok {
+		return def, nil
+	}
+	i, err := cast.ToIntE(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid value for %s: %w", opt.describe(), err)
+	}
+	return i, nil
+}
+
+// GetBool resolves a boolean option, returning def when it is not set anywhere
+func (b *OptionsBuilder) GetBool(opt Option, def bool) (bool, error) {
+	value, ok := b.Value(opt)
+	if !ok {
+		return def, nil
+	}
+	v, err := cast.ToBoolE(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid value for %s: %w", opt.describe(), err)
+	}
+	return v, nil
+}
+
+// GetDuration resolves a duration option, returning def when it is not set anywhere
+func (b *OptionsBuilder) GetDuration(opt Option, def time.Duration) (time.Duration, error) {
+	value, ok := b.Value(opt)
+	if !ok {
+		return def, nil
+	}
+	d, err := cast.ToDurationE(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid value for %s: %w", opt.describe(), err)
+	}
+	return d, nil
+}
+
+// GetStringSlice resolves a list option. Environment variables hold comma-separated lists.
+func (b *OptionsBuilder) GetStringSlice(opt Option, def []string) ([]string, error) {
+	value, ok := b.Value(opt)
+	if !ok {
+		return def, nil
+	}
+	if s, isString := value.(string); isString {
+		return splitList(s), nil
+	}
+	list, err := cast.ToStringSliceE(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid value for %s: %w", opt.describe(), err)
+	}
+	return list, nil
+}
+
+// BuildConnection resolves a single database connection on top of the given defaults
+func (b *OptionsBuilder) BuildConnection(src ConnectionSource, defaults DatabaseConfig) (*DatabaseConfig, error) {
+	cfg := defaults
+
+	for _, s := range b.settings {
+		for _, section := range src.Sections {
+			if err := applyConnectionLayer(&cfg, func(field string) (interface{}, bool) {
+				return settingsConnectionValue(s, section, field)
+			}, func(field string) string {
+				return section + "." + field
+			}, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if b.useEnv {
+		// Alternative URI variables rank below the prefixed ones
+		for _, name := range src.URIEnv {
+			if uri, ok := b.envValue(name); ok {
+				if err := applyURI(&cfg, uri.(string), name); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, prefix := range src.EnvPrefixes {
+			if err := applyConnectionLayer(&cfg, func(field string) (interface{}, bool) {
+				return b.envValue(prefix + strings.ToUpper(field))
+			}, func(field string) string {
+				return prefix + strings.ToUpper(field)
+			}, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	uriFlag := src.Flags.URI
+	for _, alias := range src.Flags.URIAliases {
+		if _, ok := b.flagValue(alias); !ok {
+			continue
+		}
+		if _, ok := b.flagValue(uriFlag); ok {
+			return nil, fmt.Errorf("--%s cannot be combined with --%s", uriFlag, alias)
+		}
+		uriFlag = alias
+	}
+
+	flagNames := map[string]string{
+		"uri":            uriFlag,
+		"host":           src.Flags.Host,
+		"port":           src.Flags.Port,
+		"user":           src.Flags.User,
+		"password":       src.Flags.Password,
+		"database":       src.Flags.Database,
+		"sslmode":        src.Flags.SSLMode,
+		"admin_database": src.Flags.AdminDatabase,
+	}
+	// A URI flag next to individual connection flags is almost certainly a mistake,
+	// so flags are strict where the other layers let the URI win silently
+	if err := applyConnectionLayer(&cfg, func(field string) (interface{}, bool) {
+		return b.flagValue(flagNames[field])
+	}, func(field string) string {
+		return "--" + flagNames[field]
+	}, true); err != nil {
+		return nil, err
+	}
+
+	// References are resolved once the layers have settled on one, as resolving may
+	// need the network
+	if scheme, ok := uriReference(cfg.URI); ok {
+		resolve, ok := b.resolvers[scheme]
+		if !ok {
+			return nil, fmt.Errorf("unsupported connection reference %s", cfg.URI)
+		}
+		ref := cfg.URI
+		uri, err := resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyURI(&cfg, uri, ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cfg, nil
+}
+
+// BuildForkConfig resolves a complete ForkConfig. Destination settings that are not
+// configured anywhere default to the corresponding source settings.
+func (b *OptionsBuilder) BuildForkConfig() (*ForkConfig, error) {
+	source, err := b.BuildConnection(SourceConnection, DatabaseConfig{
+		Host:    "localhost",
+		Port:    5432,
+		SSLMode: "prefer",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("source configuration: %w", err)
+	}
+
+	dest, err := b.BuildConnection(DestinationConnection, DatabaseConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("destination configuration: %w", err)
+	}
+	if dest.URI == "" {
+		if dest.Host == "" {
+			dest.Host = source.Host
+		}
+		if dest.Port == 0 {
+			dest.Port = source.Port
+		}
+		if dest.Username == "" {
+			dest.Username = source.Username
+		}
+		if dest.Password == "" {
+			dest.Password = source.Password // pragma: allowlist secret
+		}
+		if dest.SSLMode == "" {
+			dest.SSLMode = source.SSLMode
+		}
+	}
+	if dest.AdminDatabase == "" && dest.Host == source.Host && dest.Port == source.Port {
+		dest.AdminDatabase = source.AdminDatabase
+	}
+
+	cfg := &ForkConfig{
+		Source:      *source,
+		Destination: *dest,
+	}
+
+	if cfg.TargetDatabase, err = b.GetString(OptTargetDatabase, ""); err != nil {
+		return nil, err
+	}
+	if cfg.DropIfExists, err = b.GetBool(OptDropIfExists, false); err != nil {
+		return nil, err
+	}
+	if cfg.TargetOwner, err = b.GetString(OptTargetOwner, ""); err != nil {
+		return nil, err
+	}
+	if cfg.TargetConnectionLimit, err = b.GetInt(OptTargetConnLimit, 0); err != nil {
+		return nil, err
+	}
+	if cfg.TargetIsTemplate, err = b.GetBool(OptTargetIsTemplate, false); err != nil {
+		return nil, err
+	}
+	if cfg.WaitForSourceIdle, err = b.GetDuration(OptWaitForSourceIdle, 0); err != nil {
+		return nil, err
+	}
+	if cfg.WaitForTarget, err = b.GetDuration(OptWaitForTarget, 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.SkipValidate, err = b.GetBool(OptSkipValidate, false); err != nil {
+		return nil, err
+	}
+	if cfg.OnTableError, err = b.GetString(OptOnTableError, "abort"); err != nil {
+		return nil, err
+	}
+	if cfg.AutoSuffix, err = b.GetBool(OptAutoSuffix, false); err != nil {
+		return nil, err
+	}
+	if cfg.UseTemplateCache, err = b.GetBool(OptUseTemplateCache, false); err != nil {
+		return nil, err
+	}
+	if cfg.SchemaCache, err = b.GetBool(OptSchemaCache, false); err != nil {
+		return nil, err
+	}
+	if cfg.CacheDir, err = b.GetString(OptCacheDir, ""); err != nil {
+		return nil, err
+	}
+	if cfg.MaxConnections, err = b.GetInt(OptMaxConnections, 4); err != nil {
+		return nil, err
+	}
+	if cfg.ChunkSize, err = b.GetInt(OptChunkSize, 1000); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout, err = b.GetDuration(OptTimeout, 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.IncludeTables, err = b.GetStringSlice(OptIncludeTables, nil); err != nil {
+		return nil, err
+	}
+	if cfg.ExcludeTables, err = b.GetStringSlice(OptExcludeTables, nil); err != nil {
+		return nil, err
+	}
+	if cfg.TablePatternMode, err = b.GetString(OptTablePatternMode, ""); err != nil {
+		return nil, err
+	}
+	if cfg.Tables, err = b.tables(); err != nil {
+		return nil, err
+	}
+	if cfg.TableGroups, err = b.tableGroups(); err != nil {
+		return nil, err
+	}
+	if cfg.SchemaOnly, err = b.GetBool(OptSchemaOnly, false); err != nil {
+		return nil, err
+	}
+	if cfg.DataOnly, err = b.GetBool(OptDataOnly, false); err != nil {
+		return nil, err
+	}
+	if cfg.MinimalSchema, err = b.GetBool(OptMinimalSchema, false); err != nil {
+		return nil, err
+	}
+	if cfg.MinimalSchema {
+		cfg.SchemaOnly = true
+	}
+	if cfg.Seed, err = b.GetStringSlice(OptSeed, nil); err != nil {
+		return nil, err
+	}
+	if cfg.SynthesizeData, err = b.GetBool(OptSynthesizeData, false); err != nil {
+		return nil, err
+	}
+	if cfg.SynthesizeRows, err = b.GetInt(OptSynthesizeRows, 100); err != nil {
+		return nil, err
+	}
+	if cfg.SynthesizeTableRows, err = b.synthesizeTableRows(); err != nil {
+		return nil, err
+	}
+	if cfg.VacuumReport, err = b.GetBool(OptVacuumReport, true); err != nil {
+		return nil, err
+	}
+	if cfg.VacuumFreezeTables, err = b.GetInt(OptVacuumFreezeTables, 0); err != nil {
+		return nil, err
+	}
+	if cfg.Deterministic, err = b.GetBool(OptDeterministic, false); err != nil {
+		return nil, err
+	}
+	if cfg.StandbyChunking, err = b.GetBool(OptStandbyChunking, false); err != nil {
+		return nil, err
+	}
+	if cfg.VerifySample, err = b.GetInt(OptVerifySample, 0); err != nil {
+		return nil, err
+	}
+	if cfg.VerifyInterval, err = b.GetDuration(OptVerifyInterval, time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Bench, err = b.GetString(OptBench, ""); err != nil {
+		return nil, err
+	}
+	if cfg.BenchDuration, err = b.GetDuration(OptBenchDuration, 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.MetricsTableLimit, err = b.GetInt(OptMetricsTableLimit, 50); err != nil {
+		return nil, err
+	}
+	if cfg.BackupBeforeDrop, err = b.GetString(OptBackupBeforeDrop, ""); err != nil {
+		return nil, err
+	}
+	if cfg.BackupSmallTablesMB, err = b.GetInt(OptBackupSmallTables, 10); err != nil {
+		return nil, err
+	}
+	if cfg.BackupDir, err = b.GetString(OptBackupDir, ""); err != nil {
+		return nil, err
+	}
+	if cfg.BackupKeep, err = b.GetInt(OptBackupKeep, 3); err != nil {
+		return nil, err
+	}
+	if cfg.BackupMaxAge, err = b.GetDuration(OptBackupMaxAge, 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Provider, err = b.GetString(OptProvider, "auto"); err != nil {
+		return nil, err
+	}
+	if cfg.WorkDir, err = b.GetString(OptWorkDir, ""); err != nil {
+		return nil, err
+	}
+	if cfg.WorkDirMinFreeMB, err = b.GetInt(OptWorkDirMinFree, 512); err != nil {
+		return nil, err
+	}
+	if cfg.OutputFormat, err = b.GetString(OptOutputFormat, "text"); err != nil {
+		return nil, err
+	}
+	if cfg.Quiet, err = b.GetBool(OptQuiet, false); err != nil {
+		return nil, err
+	}
+	if cfg.DryRun, err = b.GetBool(OptDryRun, false); err != nil {
+		return nil, err
+	}
+	if cfg.Confirm, err = b.GetBool(OptConfirm, false); err != nil {
+		return nil, err
+	}
+	if cfg.Privacy, err = b.GetString(OptPrivacy, ""); err != nil {
+		return nil, err
+	}
+	if cfg.ReportFile, err = b.GetString(OptReportFile, ""); err != nil {
+		return nil, err
+	}
+	if cfg.SchemaPlanOut, err = b.GetString(OptSchemaPlanOut, ""); err != nil {
+		return nil, err
+	}
+	if cfg.LogLevel, err = b.GetString(OptLogLevel, "info"); err != nil {
+		return nil, err
+	}
+	if cfg.JobID, err = b.GetString(OptJobID, ""); err != nil {
+		return nil, err
+	}
+	if cfg.CIMetadata, err = b.GetBool(OptCIMetadata, true); err != nil {
+		return nil, err
+	}
+	if cfg.Team, err = b.GetString(OptTeam, ""); err != nil {
+		return nil, err
+	}
+	if cfg.Quota.MaxTotalSizeMB, err = b.GetInt(OptQuotaMaxTotalSize, 0); err != nil {
+		return nil, err
+	}
+	if cfg.Quota.Wait, err = b.GetDuration(OptQuotaWait, 0); err != nil {
+		return nil, err
+	}
+	if cfg.Quota.Teams, err = b.teamQuotas(); err != nil {
+		return nil, err
+	}
+	if cfg.TeamToken, err = b.GetString(OptTeamToken, ""); err != nil {
+		return nil, err
+	}
+	if cfg.Teams, err = b.teamAccess(); err != nil {
+		return nil, err
+	}
+
+	cfg.TemplateVars = b.templateVars()
+	if cfg.NamingStrategy, err = b.GetString(OptNamingStrategy, ""); err != nil {
+		return nil, err
+	}
+	if cfg.NamingStrategies, err = b.namingStrategies(); err != nil {
+		return nil, err
+	}
+	cfg.Hooks = b.hooks()
+
+	// The destination database is required for validation; the fork itself
+	// connects to the target database explicitly.
+	if cfg.Destination.Database == "" {
+		cfg.Destination.Database = cfg.TargetDatabase
+	}
+
+	return cfg, nil
+}
+
+// templateVars merges template variables from every layer
+func (b *OptionsBuilder) templateVars() map[string]string {
+	vars := make(map[string]string)
+
+	for _, s := range b.settings {
+		if s.IsSet("template_vars") {
+			for k, v := range cast.ToStringMapString(s.Get("template_vars")) {
+				vars[strings.ToUpper(k)] = v
+			}
+		}
+	}
+
+	if b.useEnv {
+		for _, env := range os.Environ() {
+			if strings.HasPrefix(env, "PGFORK_VAR_") {
+				parts := strings.SplitN(env, "=", 2)
+				if len(parts) == 2 {
+					vars[strings.TrimPrefix(parts[0], "PGFORK_VAR_")] = parts[1]
+				}
+			}
+		}
+	}
+
+	if flag := b.lookupFlag("template-var"); flag != nil && flag.Changed {
+		if flagVars, err := b.flags.GetStringToString("template-var"); err == nil {
+			for k, v := range flagVars {
+				vars[k] = v
+			}
+		}
+	}
+
+	return vars
+}
+
+// synthesizeTableRows merges per-table synthetic row counts from every layer
+func (b *OptionsBuilder) synthesizeTableRows() (map[string]int, error) {
+	rows := make(map[string]int)
+
+	for _, s := range b.settings {
+		if s.IsSet("synthesize_table_rows") {
+			values, err := cast.ToStringMapIntE(s.Get("synthesize_table_rows"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for synthesize_table_rows: %w", err)
+			}
+			for table, count := range values {
+				rows[table] = count
+			}
+		}
+	}
+
+	if flag := b.lookupFlag("synthesize-table-rows"); flag != nil && flag.Changed {
+		flagRows, err := b.flags.GetStringToInt("synthesize-table-rows")
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --synthesize-table-rows: %w", err)
+		}
+		for table, count := range flagRows {
+			rows[table] = count
+		}
+	}
+
+	return rows, nil
+}
+
+// namingStrategies reads the naming strategies from the settings layers; a strategy
+// defined in a higher layer replaces one of the same name
+func (b *OptionsBuilder) namingStrategies() (map[string]NamingStrategyConfig, error) {
+	strategies := make(map[string]NamingStrategyConfig)
+	for _, s := range b.settings {
+		if !s.IsSet("naming_strategies") {
+			continue
+		}
+		entries, err := cast.ToStringMapE(s.Get("naming_strategies"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for naming_strategies: %w", err)
+		}
+		for name, entry := range entries {
+			fields, err := cast.ToStringMapE(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid naming strategy %s: %w", name, err)
+			}
+			length, err := cast.ToIntE(fields["length"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid length of naming strategy %s: %w", name, err)
+			}
+			strategies[name] = NamingStrategyConfig{
+				Type:     cast.ToString(fields["type"]),
+				Template: cast.ToString(fields["template"]),
+				Input:    cast.ToString(fields["input"]),
+				Pattern:  cast.ToString(fields["pattern"]),
+				Length:   length,
+				Fallback: cast.ToString(fields["fallback"]),
+			}
+		}
+	}
+	return strategies, nil
+}
+
+// tables reads the per-table settings from the settings layers; a table configured in a
+// higher layer replaces its entry from lower ones. Masking profiles are resolved to
+// their rules for the table.
+func (b *OptionsBuilder) tables() (map[string]TableConfig, error) {
+	tables := make(map[string]TableConfig)
+	for _, s := range b.settings {
+		if !s.IsSet("tables") {
+			continue
+		}
+		entries, err := cast.ToStringMapE(s.Get("tables"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for tables: %w", err)
+		}
+		for name, entry := range entries {
+			fields, err := cast.ToStringMapE(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid settings for table %s: %w", name, err)
+			}
+			var table TableConfig
+			if table.ChunkSize, err = cast.ToIntE(fields["chunk_size"]); err != nil {
+				return nil, fmt.Errorf("invalid chunk_size of table %s: %w", name, err)
+			}
+			if table.Parallelism, err = cast.ToIntE(fields["parallelism"]); err != nil {
+				return nil, fmt.Errorf("invalid parallelism of table %s: %w", name, err)
+			}
+			if table.SchemaOnly, err = cast.ToBoolE(fields["schema_only"]); err != nil {
+				return nil, fmt.Errorf("invalid schema_only of table %s: %w", name, err)
+			}
+			if transform, ok := fields["transform"]; ok {
+				if table.Transform, err = cast.ToStringSliceE(transform); err != nil {
+					return nil, fmt.Errorf("invalid transform of table %s: %w", name, err)
+				}
+			}
+			table.Where = cast.ToString(fields["where"])
+			table.MaskingProfile = cast.ToString(fields["masking_profile"])
+			tables[name] = table
+		}
+	}
+
+	for name, table := range tables {
+		if table.MaskingProfile == "" {
+			continue
+		}
+		value, ok := b.settingsValue("masking_profiles." + table.MaskingProfile)
+		if !ok {
+			return nil, fmt.Errorf("table %s: masking profile '%s' not found in configuration", name, table.MaskingProfile)
+		}
+		rules, err := masking.ParseRules(value)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: masking profile '%s': %w", name, table.MaskingProfile, err)
+		}
+		for _, rule := range rules {
+			if strings.TrimPrefix(rule.Table, "public.") == strings.TrimPrefix(name, "public.") {
+				table.Masking = append(table.Masking, rule)
+			}
+		}
+		if len(table.Masking) == 0 {
+			return nil, fmt.Errorf("table %s: masking profile '%s' has no rules for the table", name, table.MaskingProfile)
+		}
+		tables[name] = table
+	}
+	return tables, nil
+}
+
+// tableGroups reads the table groups of every layer and the --table-group flag,
+// written name=table,table; a group defined again replaces the earlier one
+func (b *OptionsBuilder) tableGroups() (map[string][]string, error) {
+	groups := make(map[string][]string)
+	for _, s := range b.settings {
+		if !s.IsSet("table_groups") {
+			continue
+		}
+		entries, err := cast.ToStringMapStringSliceE(s.Get("table_groups"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for table_groups: %w", err)
+		}
+		for name, tables := range entries {
+			groups[name] = tables
+		}
+	}
+
+	if flag := b.lookupFlag("table-group"); flag != nil && flag.Changed {
+		values, err := b.flags.GetStringArray("table-group")
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for --table-group: %w", err)
+		}
+		for _, value := range values {
+			name, list, ok := strings.Cut(value, "=")
+			if !ok || name == "" || list == "" {
+				return nil, fmt.Errorf("invalid value for --table-group %q (expected name=table,table)", value)
+			}
+			groups[name] = strings.Split(list, ",")
+		}
+	}
+	return groups, nil
+}
+
+// teamQuotas merges the per-team quotas of every layer
+func (b *OptionsBuilder) teamQuotas() (map[string]TeamQuota, error) {
+	quotas := make(map[string]TeamQuota)
+	for _, s := range b.settings {
+		if !s.IsSet("quota.teams") {
+			continue
+		}
+		entries, err := cast.ToStringMapE(s.Get("quota.teams"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for quota.teams: %w", err)
+		}
+		for team, entry := range entries {
+			fields, err := cast.ToStringMapE(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quota of team %s: %w", team, err)
+			}
+			maxSize, err := cast.ToIntE(fields["max_size_mb"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_size_mb of team %s: %w", team, err)
+			}
+			maxDatabases, err := cast.ToIntE(fields["max_databases"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_databases of team %s: %w", team, err)
+			}
+			quotas[team] = TeamQuota{MaxSizeMB: maxSize, MaxDatabases: maxDatabases}
+		}
+	}
+	return quotas, nil
+}
+
+// teamAccess merges the team allow-lists of every layer
+func (b *OptionsBuilder) teamAccess() (map[string]TeamAccess, error) {
+	teams := make(map[string]TeamAccess)
+	for _, s := range b.settings {
+		if !s.IsSet("teams") {
+			continue
+		}
+		entries, err := cast.ToStringMapE(s.Get("teams"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for teams: %w", err)
+		}
+		for team, entry := range entries {
+			fields, err := cast.ToStringMapE(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid settings of team %s: %w", team, err)
+			}
+			access := TeamAccess{TokenSHA256: cast.ToString(fields["token_sha256"])}
+			if value, ok := fields["sources"]; ok && value != nil {
+				if access.Sources, err = cast.ToStringSliceE(value); err != nil {
+					return nil, fmt.Errorf("invalid sources of team %s: %w", team, err)
+				}
+			}
+			if value, ok := fields["destinations"]; ok && value != nil {
+				if access.Destinations, err = cast.ToStringSliceE(value); err != nil {
+					return nil, fmt.Errorf("invalid destinations of team %s: %w", team, err)
+				}
+			}
+			teams[team] = access
+		}
+	}
+	return teams, nil
+}
+
+// hooks reads hook commands from the settings layers; the highest layer defining a stage wins
+func (b *OptionsBuilder) hooks() HooksConfig {
+	var hooks HooksConfig
+	for _, s := range b.settings {
+		if s.IsSet("hooks.pre_fork") {
+			hooks.PreFork = cast.ToStringSlice(s.Get("hooks.pre_fork"))
+		}
+		if s.IsSet("hooks.post_fork") {
+			hooks.PostFork = cast.ToStringSlice(s.Get("hooks.post_fork"))
+		}
+		if s.IsSet("hooks.seed") {
+			hooks.Seed = cast.ToStringSlice(s.Get("hooks.seed"))
+		}
+		if s.IsSet("hooks.on_error") {
+			hooks.OnError = cast.ToStringSlice(s.Get("hooks.on_error"))
+		}
+	}
+	return hooks
+}
+
+// lookupFlag returns the named flag, or nil if the command does not define it
+func (b *OptionsBuilder) lookupFlag(name string) *pflag.Flag {
+	if b.flags == nil || name == "" {
+		return nil
+	}
+	return b.flags.Lookup(name)
+}
+
+// flagValue returns the value of a flag only when it was explicitly set
+func (b *OptionsBuilder) flagValue(name string) (interface{}, bool) {
+	flag := b.lookupFlag(name)
+	if flag == nil || !flag.Changed {
+		return nil, false
+	}
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		return slice.GetSlice(), true
+	}
+	return flag.Value.String(), true
+}
+
+// envValue returns the value of the highest-precedence environment variable that is set
+func (b *OptionsBuilder) envValue(names ...string) (interface{}, bool) {
+	if !b.useEnv {
+		return nil, false
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		if value := os.Getenv(names[i]); value != "" {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// settingsValue returns the value from the highest-precedence settings layer
+func (b *OptionsBuilder) settingsValue(key string) (interface{}, bool) {
+	if key == "" {
+		return nil, false
+	}
+	for i := len(b.settings) - 1; i >= 0; i-- {
+		if b.settings[i].IsSet(key) {
+			return b.settings[i].Get(key), true
+		}
+	}
+	return nil, false
+}
+
+// describe names the option for error messages
+func (o Option) describe() string {
+	switch {
+	case o.Flag != "":
+		return "--" + o.Flag
+	case len(o.Env) > 0:
+		return o.Env[len(o.Env)-1]
+	default:
+		return o.Key
+	}
+}
+
+// settingsConnectionValue reads a connection field from a settings section,
+// accepting "user" as an alias for "username" as written by profiles
+func settingsConnectionValue(s Settings, section, field string) (interface{}, bool) {
+	keys := []string{section + "." + field}
+	if field == "user" {
+		keys = []string{section + ".username", section + ".user"}
+	}
+	for _, key := range keys {
+		if s.IsSet(key) {
+			if value := s.Get(key); value != nil && value != "" {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// connectionFields lists the individual connection fields a URI replaces
+var connectionFields = []string{"host", "port", "user", "password", "database", "sslmode"}
+
+// applyConnectionLayer applies one configuration layer to cfg. When the layer provides
+// a URI it replaces the connection settings and the layer's individual fields are
+// ignored, or rejected when strict is set.
+func applyConnectionLayer(cfg *DatabaseConfig, get func(field string) (interface{}, bool), name func(field string) string, strict bool) error {
+	// URIs have no maintenance database, so it is read next to one
+	if value, ok := get("admin_database"); ok {
+		cfg.AdminDatabase = cast.ToString(value)
+	}
+	if value, ok := get("target_session_attrs"); ok {
+		cfg.TargetSessionAttrs = cast.ToString(value)
+	}
+	if value, ok := get("uri"); ok {
+		if strict {
+			for _, field := range connectionFields {
+				if _, set := get(field); set {
+					return fmt.Errorf("%s cannot be combined with %s", name("uri"), name(field))
+				}
+			}
+		}
+		return applyURI(cfg, cast.ToString(value), name("uri"))
+	}
+
+	if value, ok := get("host"); ok {
+		cfg.Host = cast.ToString(value)
+	}
+	if value, ok := get("port"); ok {
+		port, err := cast.ToIntE(value)
+		if err != nil {
+			return fmt.Errorf("invalid port %v (give each host of a list its own port as host:port): %w", value, err)
+		}
+		cfg.Port = port
+	}
+	if value, ok := get("user"); ok {
+		cfg.Username = cast.ToString(value)
+	}
+	if value, ok := get("password"); ok {
+		cfg.Password = cast.ToString(value) // pragma: allowlist secret
+	}
+	if value, ok := get("database"); ok {
+		cfg.Database = cast.ToString(value)
+	}
+	if value, ok := get("sslmode"); ok {
+		cfg.SSLMode = cast.ToString(value)
+	}
+	return nil
+}
+
+// applyURI replaces the connection settings with those parsed from uri. A reference
+// to a URI held elsewhere is kept for BuildConnection to resolve.
+func applyURI(cfg *DatabaseConfig, uri, origin string) error {
+	if _, ok := uriReference(uri); ok {
+		*cfg = DatabaseConfig{URI: uri, SSLMode: cfg.SSLMode, AdminDatabase: cfg.AdminDatabase, TargetSessionAttrs: cfg.TargetSessionAttrs}
+		return nil
+	}
+	parsed, err := parsePostgreSQLURI(uri)
+	if err != nil {
+		return fmt.Errorf("%s: %w", origin, err)
+	}
+	if parsed.SSLMode == "" {
+		parsed.SSLMode = cfg.SSLMode
+	}
+	parsed.AdminDatabase = cfg.AdminDatabase
+	if parsed.TargetSessionAttrs == "" {
+		parsed.TargetSessionAttrs = cfg.TargetSessionAttrs
+	}
+	*cfg = *parsed
+	return nil
+}
+
+// uriReference returns the scheme of a connection reference such as heroku:myapp,
+// which unlike a URI has no // after its scheme
+func uriReference(uri string) (string, bool) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok || scheme == "" || strings.HasPrefix(rest, "//") || strings.ContainsAny(scheme, "/@?") {
+		return "", false
+	}
+	return scheme, true
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Modes of TablePatternMode
+const (
+	// TablePatternGlob reads include and exclude entries as pg_dump --table patterns
+	TablePatternGlob = "glob"
+	// TablePatternRegex reads them as regular expressions over schema.table names
+	TablePatternRegex = "regex"
+)
+
+// TablePattern is a compiled include_tables or exclude_tables entry. Glob patterns
+// follow pg_dump's --table: * and ? are wildcards, a pattern without a schema matches
+// tables in public, unquoted names are folded to lower case and double-quoted names
+// are matched as written. Regex patterns must match the whole
+// schema-qualified name, such as public.orders.
+type TablePattern struct {
+	schema, table *namePattern
+	regex         *regexp.Regexp
+}
+
+// namePattern matches one part of a qualified name
+type namePattern struct {
+	glob    string
+	literal bool
+}
+
+// CompileTablePattern compiles pattern in mode, glob when empty
+func CompileTablePattern(pattern, mode string) (TablePattern, error) {
+	if mode == TablePatternRegex {
+		regex, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return TablePattern{}, fmt.Errorf("invalid table pattern '%s': %w", pattern, err)
+		}
+		return TablePattern{regex: regex}, nil
+	}
+
+	parts := splitQualified(pattern)
+	if len(parts) > 2 {
+		return TablePattern{}, fmt.Errorf("invalid table pattern '%s': more than a schema and a table", pattern)
+	}
+	var p TablePattern
+	for i, part := range parts {
+		name := &namePattern{glob: strings.ToLower(part)}
+		if len(part) >= 2 && strings.HasPrefix(part, `"`) && strings.HasSuffix(part, `"`) {
+			name = &namePattern{glob: strings.ReplaceAll(part[1:len(part)-1], `""`, `"`), literal: true}
+		} else if _, err := path.Match(name.glob, ""); err != nil {
+			return TablePattern{}, fmt.Errorf("invalid table pattern '%s': %w", pattern, err)
+		}
+		if i == len(parts)-1 {
+			p.table = name
+		} else {
+			p.schema = name
+		}
+	}
+	return p, nil
+}
+
+// Match reports whether the pattern matches table, named as in the fork's table
+// lists: without a schema for public tables, or as schema.table
+func (p TablePattern) Match(table string) bool {
+	schema, name := SplitTableName(table)
+	if p.regex != nil {
+		return p.regex.MatchString(schema + "." + name)
+	}
+	if p.schema == nil {
+		return schema == "public" && p.table.match(name)
+	}
+	return p.schema.match(schema) && p.table.match(name)
+}
+
+func (n *namePattern) match(name string) bool {
+	if n.literal {
+		return n.glob == name
+	}
+	matched, _ := path.Match(n.glob, name)
+	return matched
+}
+
+// SplitTableName returns the schema and name of a table named as in the fork's table
+// lists, where a name without a schema is in public
+func SplitTableName(table string) (schema, name string) {
+	if i := strings.Index(table, "."); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "public", table
+}
+
+// splitQualified splits a pattern at the dots outside double quotes
+func splitQualified(pattern string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, c := range pattern {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			parts = append(parts, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, pattern[start:])
+}
+
+// TableFilter selects tables by include_tables and exclude_tables; an include list
+// wins over an exclude list
+type TableFilter struct {
+	include, exclude []TablePattern
+}
+
+// NewTableFilter compiles the include and exclude patterns in mode
+func NewTableFilter(include, exclude []string, mode string) (*TableFilter, error) {
+	f := &TableFilter{}
+	for _, list := range []struct {
+		patterns []string
+		compiled *[]TablePattern
+	}{{include, &f.include}, {exclude, &f.exclude}} {
+		for _, pattern := range list.patterns {
+			compiled, err := CompileTablePattern(pattern, mode)
+			if err != nil {
+				return nil, err
+			}
+			*list.compiled = append(*list.compiled, compiled)
+		}
+	}
+	return f, nil
+}
+
+// Includes reports whether the filter keeps table
+func (f *TableFilter) Includes(table string) bool {
+	if len(f.include) > 0 {
+		return matchesPattern(f.include, table)
+	}
+	return !matchesPattern(f.exclude, table)
+}
+
+func matchesPattern(patterns []TablePattern, table string) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// LiteralTablePatterns reports whether every pattern names a single table, so
+// publications can take them as they are
+func LiteralTablePatterns(patterns []string, mode string) bool {
+	if mode == TablePatternRegex {
+		return false
+	}
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			return false
+		}
+	}
+	return true
+}
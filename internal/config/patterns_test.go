@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTablePattern_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		mode    string
+		table   string
+		want    bool
+	}{
+		{"orders", "", "orders", true},
+		{"orders", "", "public.orders", true},
+		{"orders", "", "billing.orders", false},
+		{"audit_*", "", "audit_log", true},
+		{"audit_*", "", "users", false},
+		{"Orders", "", "orders", true},
+		{`"Orders"`, "", "orders", false},
+		{`"Orders"`, "", "Orders", true},
+		{"analytics.*", "", "analytics.events", true},
+		{"analytics.*", "", "events", false},
+		{"*.events", "", "events", true},
+		{"*.events", "", "analytics.events", true},
+		{`"Audit".log?`, "", "Audit.logs", true},
+		{`public\.orders`, TablePatternRegex, "orders", true},
+		{`orders`, TablePatternRegex, "orders", false},
+		{`analytics\..*_2024`, TablePatternRegex, "analytics.events_2024", true},
+		{`analytics\..*_2024`, TablePatternRegex, "analytics.events_2024_old", false},
+	}
+
+	for _, tt := range tests {
+		pattern, err := CompileTablePattern(tt.pattern, tt.mode)
+		require.NoError(t, err, tt.pattern)
+		assert.Equal(t, tt.want, pattern.Match(tt.table), "%s %s", tt.pattern, tt.table)
+	}
+}
+
+func TestCompileTablePattern_Invalid(t *testing.T) {
+	_, err := CompileTablePattern("db.schema.table", TablePatternGlob)
+	assert.ErrorContains(t, err, "more than a schema and a table")
+
+	_, err = CompileTablePattern("audit_[", TablePatternGlob)
+	assert.Error(t, err)
+
+	_, err = CompileTablePattern("audit_(", TablePatternRegex)
+	assert.ErrorContains(t, err, "invalid table pattern 'audit_('")
+}
+
+func TestTableFilter_Includes(t *testing.T) {
+	filter, err := NewTableFilter([]string{"orders*"}, []string{"orders_archive"}, "")
+	require.NoError(t, err)
+	assert.True(t, filter.Includes("orders_archive"))
+	assert.False(t, filter.Includes("users"))
+
+	filter, err = NewTableFilter(nil, []string{"audit.*"}, "")
+	require.NoError(t, err)
+	assert.True(t, filter.Includes("users"))
+	assert.False(t, filter.Includes("audit.events"))
+}
+
+func TestLiteralTablePatterns(t *testing.T) {
+	assert.True(t, LiteralTablePatterns([]string{"orders", "billing.invoices"}, TablePatternGlob))
+	assert.False(t, LiteralTablePatterns([]string{"orders", "audit_*"}, TablePatternGlob))
+	assert.False(t, LiteralTablePatterns([]string{"orders"}, TablePatternRegex))
+}
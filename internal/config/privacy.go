@@ -0,0 +1,31 @@
+package config
+
+import (
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+)
+
+// Redactor returns the redactor of the fork's database and host names for its
+// Privacy mode, or nil when names are left intact
+func (c *ForkConfig) Redactor() *logging.Redactor {
+	source := c.Source.resolved()
+	destination := c.Destination.resolved()
+
+	identifiers := []logging.Identifier{
+		{Name: c.TargetDatabase, Kind: "db", Alias: "target-db"},
+		{Name: source.Database, Kind: "db", Alias: "source-db"},
+		{Name: destination.Database, Kind: "db", Alias: "destination-db"},
+	}
+	for _, server := range []struct {
+		role string
+		conn DatabaseConfig
+	}{{"source", c.Source}, {"destination", c.Destination}} {
+		hosts, err := server.conn.Hosts()
+		if err != nil {
+			continue
+		}
+		for _, host := range hosts {
+			identifiers = append(identifiers, logging.Identifier{Name: host.Host, Kind: "host", Alias: server.role + "-host"})
+		}
+	}
+	return logging.NewRedactor(c.Privacy, identifiers)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hostResolveTimeout bounds each DNS lookup made while comparing servers
+const hostResolveTimeout = 2 * time.Second
+
+// lookupHost resolves a host name to its addresses; replaced in tests
+var lookupHost = func(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), hostResolveTimeout)
+	defer cancel()
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// localAddrs returns the addresses of this machine's interfaces; replaced in tests
+var localAddrs = func() ([]string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips, nil
+}
+
+// localHost stands in for every address of this machine, so "localhost",
+// "127.0.0.1", "::1" and the machine's own DNS name compare equal
+const localHost = "local"
+
+// serverEndpoint is a connection's servers reduced to comparable parts
+type serverEndpoint struct {
+	// servers are the canonical addresses of every host with its port, or the socket
+	// directories
+	servers  map[string]bool
+	username string
+}
+
+// endpoint resolves the servers a connection points at. URI-only configs are parsed
+// first; hosts that cannot be resolved fall back to their lower-cased name.
+func (c DatabaseConfig) endpoint() serverEndpoint {
+	cfg := c.resolved()
+	hosts, err := cfg.Hosts()
+	if err != nil {
+		hosts = []HostPort{{Host: cfg.Host, Port: cfg.Port}}
+	}
+
+	servers := make(map[string]bool)
+	for _, host := range hosts {
+		port := host.Port
+		if port == 0 {
+			port = 5432
+		}
+		for addr := range canonicalAddrs(host.Host) {
+			servers[net.JoinHostPort(addr, strconv.Itoa(port))] = true
+		}
+	}
+	return serverEndpoint{servers: servers, username: cfg.Username}
+}
+
+// canonicalAddrs returns the addresses a host resolves to, with local addresses
+// collapsed into localHost
+func canonicalAddrs(host string) map[string]bool {
+	host = strings.ToLower(strings.TrimSpace(host))
+	// libpq treats an empty host as the local socket
+	if host == "" || host == "localhost" {
+		return map[string]bool{localHost: true}
+	}
+	// Unix socket directories are compared as paths
+	if strings.HasPrefix(host, "/") {
+		return map[string]bool{strings.TrimSuffix(host, "/"): true}
+	}
+
+	var resolved []string
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		resolved = []string{ip.String()}
+	} else if ips, err := lookupHost(host); err == nil && len(ips) > 0 {
+		resolved = ips
+	} else {
+		return map[string]bool{host: true}
+	}
+
+	local := make(map[string]bool)
+	if ips, err := localAddrs(); err == nil {
+		for _, ip := range ips {
+			local[ip] = true
+		}
+	}
+
+	addrs := make(map[string]bool, len(resolved))
+	for _, addr := range resolved {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			addrs[addr] = true
+		case ip.IsLoopback() || ip.IsUnspecified() || local[ip.String()]:
+			addrs[localHost] = true
+		default:
+			addrs[ip.String()] = true
+		}
+	}
+	return addrs
+}
+
+// sameServer reports whether two endpoints reach the same server as the same user.
+// Server sets must match exactly: names that only share some addresses may be
+// balanced across different servers, and multi-host lists that only overlap may
+// fail over to different ones, and guessing wrong picks template cloning.
+func (e serverEndpoint) sameServer(other serverEndpoint) bool {
+	if e.username != other.username || len(e.servers) != len(other.servers) {
+		return false
+	}
+	for server := range e.servers {
+		if !other.servers[server] {
+			return false
+		}
+	}
+	return true
+}
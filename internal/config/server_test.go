@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubResolver replaces DNS and interface lookups for the duration of the test
+func stubResolver(t *testing.T, hosts map[string][]string, local []string) {
+	t.Helper()
+	origLookup, origLocal := lookupHost, localAddrs
+	t.Cleanup(func() { lookupHost, localAddrs = origLookup, origLocal })
+
+	lookupHost = func(host string) ([]string, error) {
+		if addrs, ok := hosts[host]; ok {
+			return addrs, nil
+		}
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	localAddrs = func() ([]string, error) { return local, nil }
+}
+
+func TestForkConfig_IsSameServerResolution(t *testing.T) {
+	stubResolver(t, map[string][]string{
+		"devbox.internal":  {"10.0.0.5"},
+		"db.example.com":   {"10.0.0.20"},
+		"db-alias.example": {"10.0.0.20"},
+		"pool.example.com": {"10.0.0.20", "10.0.0.21"},
+	}, []string{"127.0.0.1", "10.0.0.5"})
+
+	tests := []struct {
+		name     string
+		source   DatabaseConfig
+		dest     DatabaseConfig
+		expected bool
+	}{
+		{
+			name:     "localhost and loopback address",
+			source:   DatabaseConfig{Host: "localhost", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "127.0.0.1", Port: 5432, Username: "app"},
+			expected: true,
+		},
+		{
+			name:     "IPv6 loopback and machine name",
+			source:   DatabaseConfig{Host: "::1", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "devbox.internal", Port: 5432, Username: "app"},
+			expected: true,
+		},
+		{
+			name:     "aliases of one address",
+			source:   DatabaseConfig{Host: "db.example.com", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "DB-Alias.example", Port: 5432, Username: "app"},
+			expected: true,
+		},
+		{
+			name:     "name balanced across servers",
+			source:   DatabaseConfig{Host: "db.example.com", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "pool.example.com", Port: 5432, Username: "app"},
+			expected: false,
+		},
+		{
+			name:     "different port",
+			source:   DatabaseConfig{Host: "localhost", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "127.0.0.1", Port: 5433, Username: "app"},
+			expected: false,
+		},
+		{
+			name:     "unresolvable names compare by name",
+			source:   DatabaseConfig{Host: "Unknown.Host", Port: 5432, Username: "app"},
+			dest:     DatabaseConfig{Host: "unknown.host", Port: 5432, Username: "app"},
+			expected: true,
+		},
+		{
+			name:     "URI only",
+			source:   DatabaseConfig{URI: "postgresql://app@127.0.0.1:5432/source"},
+			dest:     DatabaseConfig{Host: "localhost", Port: 5432, Username: "app"},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ForkConfig{Source: tt.source, Destination: tt.dest}
+			assert.Equal(t, tt.expected, cfg.IsSameServer())
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TeamAccess limits what one team may fork when a shared configuration serves many
+// teams. Patterns use shell wildcards: sources match the database name, or
+// host/database when they contain a slash; destinations match the server host.
+type TeamAccess struct {
+	// TokenSHA256 is the hex SHA-256 of the token the team must present, if any
+	TokenSHA256  string   `mapstructure:"token_sha256" yaml:"token_sha256"`
+	Sources      []string `mapstructure:"sources" yaml:"sources"`
+	Destinations []string `mapstructure:"destinations" yaml:"destinations"`
+}
+
+// authorizeTeam checks that the fork's team is configured, presents its token and may
+// fork from the source to the destination server. Without Teams every fork is allowed.
+func (c *ForkConfig) authorizeTeam() error {
+	if len(c.Teams) == 0 {
+		return nil
+	}
+	if c.Team == "" {
+		return fmt.Errorf("a team is required, this configuration only allows forks by the teams %s (use --team or PGFORK_TEAM)", strings.Join(c.teamNames(), ", "))
+	}
+	access, ok := c.Teams[c.Team]
+	if !ok {
+		return fmt.Errorf("unknown team %q, this configuration only allows forks by the teams %s", c.Team, strings.Join(c.teamNames(), ", "))
+	}
+	if access.TokenSHA256 != "" && !validTeamToken(access.TokenSHA256, c.TeamToken) {
+		return fmt.Errorf("invalid token for team %s (use --team-token or PGFORK_TEAM_TOKEN)", c.Team)
+	}
+
+	source := c.Source.resolved()
+	if !matchesAny(access.Sources, func(pattern string) string {
+		if strings.Contains(pattern, "/") {
+			return source.Host + "/" + source.Database
+		}
+		return source.Database
+	}) {
+		return fmt.Errorf("team %s may not fork %s/%s", c.Team, source.Host, source.Database)
+	}
+	destination := c.Destination.resolved()
+	if !matchesAny(access.Destinations, func(string) string { return destination.Host }) {
+		return fmt.Errorf("team %s may not fork to server %s", c.Team, destination.Host)
+	}
+	return nil
+}
+
+// teamNames lists the configured teams in order
+func (c *ForkConfig) teamNames() []string {
+	names := make([]string, 0, len(c.Teams))
+	for name := range c.Teams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolved returns the connection with a URI-only config parsed into its parts
+func (c DatabaseConfig) resolved() DatabaseConfig {
+	if c.URI != "" && c.Host == "" {
+		if parsed, err := parsePostgreSQLURI(c.URI); err == nil {
+			return *parsed
+		}
+	}
+	return c
+}
+
+// matchesAny reports whether any pattern matches the value subject returns for it
+func matchesAny(patterns []string, subject func(pattern string) string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, subject(pattern)); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validTeamToken compares the SHA-256 of token with the configured hex digest
+func validTeamToken(digest, token string) bool {
+	if token == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(sum[:], expected) == 1
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkConfig_AuthorizeTeam(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	teams := map[string]TeamAccess{
+		"payments": {
+			TokenSHA256:  hex.EncodeToString(sum[:]),
+			Sources:      []string{"payments_*", "replica.internal/ledger"},
+			Destinations: []string{"preview-*.internal"},
+		},
+		"search": {Sources: []string{"search"}, Destinations: []string{"*"}},
+	}
+	newConfig := func(team, token, sourceHost, source, destHost string) *ForkConfig {
+		return &ForkConfig{
+			Source:      DatabaseConfig{Host: sourceHost, Port: 5432, Database: source},
+			Destination: DatabaseConfig{Host: destHost, Port: 5432},
+			Teams:       teams,
+			Team:        team,
+			TeamToken:   token,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     *ForkConfig
+		wantErr string
+	}{
+		{"allowed source", newConfig("payments", "s3cret", "db.internal", "payments_main", "preview-1.internal"), ""},
+		{"allowed host and source", newConfig("payments", "s3cret", "replica.internal", "ledger", "preview-1.internal"), ""},
+		{"team without token", newConfig("search", "", "db.internal", "search", "anywhere"), ""},
+		{"no team", newConfig("", "", "db.internal", "search", "anywhere"), "a team is required, this configuration only allows forks by the teams payments, search"},
+		{"unknown team", newConfig("ops", "", "db.internal", "search", "anywhere"), `unknown team "ops"`},
+		{"missing token", newConfig("payments", "", "db.internal", "payments_main", "preview-1.internal"), "invalid token for team payments"},
+		{"wrong token", newConfig("payments", "guess", "db.internal", "payments_main", "preview-1.internal"), "invalid token for team payments"},
+		{"source on other host", newConfig("payments", "s3cret", "db.internal", "ledger", "preview-1.internal"), "team payments may not fork db.internal/ledger"},
+		{"other source", newConfig("search", "", "db.internal", "payments_main", "anywhere"), "team search may not fork db.internal/payments_main"},
+		{"other destination", newConfig("payments", "s3cret", "db.internal", "payments_main", "prod.internal"), "team payments may not fork to server prod.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.authorizeTeam()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without teams every fork is allowed
+	assert.NoError(t, (&ForkConfig{Source: DatabaseConfig{Database: "prod"}}).authorizeTeam())
+
+	// URI-only connections are matched on their parsed host
+	cfg := newConfig("payments", "s3cret", "", "", "")
+	cfg.Source.URI = "postgresql://user@replica.internal/ledger"
+	cfg.Destination.URI = "postgresql://user@preview-2.internal/postgres"
+	assert.NoError(t, cfg.authorizeTeam())
+}
+
+func TestOptionsBuilder_Teams(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("PGFORK_TEAM_TOKEN", "s3cret")
+
+	settings := MapSettings{
+		"teams": map[interface{}]interface{}{
+			"payments": map[interface{}]interface{}{
+				"token_sha256": "abc",
+				"sources":      []interface{}{"payments_*"},
+				"destinations": []interface{}{"preview.internal"},
+			},
+			"search": map[string]interface{}{"sources": "search"},
+		},
+	}
+	cfg, err := NewOptionsBuilder(newForkFlagSet()).WithSettings(settings).BuildForkConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", cfg.TeamToken)
+	assert.Equal(t, map[string]TeamAccess{
+		"payments": {TokenSHA256: "abc", Sources: []string{"payments_*"}, Destinations: []string{"preview.internal"}},
+		"search":   {Sources: []string{"search"}},
+	}, cfg.Teams)
+}
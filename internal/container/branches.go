@@ -0,0 +1,110 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+// BranchTarget records the local container provisioned for a branch, so repeated
+// forks of the branch land in the same container on the same port
+type BranchTarget struct {
+	Branch    string    `yaml:"branch" json:"branch"`
+	Container string    `yaml:"container" json:"container"`
+	Image     string    `yaml:"image" json:"image"`
+	Port      int       `yaml:"port" json:"port"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at" json:"updated_at"`
+	// CI is the pipeline run that last forked into the branch's container
+	CI *config.CIProvenance `yaml:"ci,omitempty" json:"ci,omitempty"`
+}
+
+// BranchStore persists branch targets as one YAML file per branch
+type BranchStore struct {
+	Dir string
+}
+
+// NewBranchStore opens the store in dir, defaulting to ~/.postgres-db-fork/branches
+func NewBranchStore(dir string) (*BranchStore, error) {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".postgres-db-fork", "branches")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create branches directory: %w", err)
+	}
+	return &BranchStore{Dir: dir}, nil
+}
+
+// Load returns the target recorded for the branch, or nil if there is none
+func (s *BranchStore) Load(branch string) (*BranchTarget, error) {
+	data, err := os.ReadFile(s.path(branch))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read branch metadata: %w", err)
+	}
+
+	var target BranchTarget
+	if err := yaml.Unmarshal(data, &target); err != nil {
+		return nil, fmt.Errorf("failed to parse branch metadata for %s: %w", branch, err)
+	}
+	return &target, nil
+}
+
+// Save records the target, keeping the original creation time
+func (s *BranchStore) Save(target *BranchTarget) error {
+	now := time.Now()
+	if target.CreatedAt.IsZero() {
+		target.CreatedAt = now
+	}
+	target.UpdatedAt = now
+
+	data, err := yaml.Marshal(target)
+	if err != nil {
+		return fmt.Errorf("failed to marshal branch metadata: %w", err)
+	}
+	if err := os.WriteFile(s.path(target.Branch), data, 0644); err != nil {
+		return fmt.Errorf("failed to write branch metadata: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the metadata for the branch
+func (s *BranchStore) Delete(branch string) error {
+	if err := os.Remove(s.path(branch)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete branch metadata: %w", err)
+	}
+	return nil
+}
+
+func (s *BranchStore) path(branch string) string {
+	return filepath.Join(s.Dir, sanitizeName(branch)+".yaml")
+}
+
+// ContainerName returns the container name used for a branch
+func ContainerName(branch string) string {
+	return "postgres-db-fork-" + sanitizeName(branch)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// sanitizeName turns a branch name into something valid as a container or file name
+func sanitizeName(branch string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(branch), "-")
+	name = strings.Trim(name, "-.")
+	if name == "" {
+		return "default"
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranchStore(t *testing.T) {
+	store, err := NewBranchStore(t.TempDir())
+	require.NoError(t, err)
+
+	missing, err := store.Load("feature/login")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	target := &BranchTarget{Branch: "feature/login", Container: ContainerName("feature/login"), Image: "postgres:16", Port: 54321}
+	require.NoError(t, store.Save(target))
+	created := target.CreatedAt
+
+	loaded, err := store.Load("feature/login")
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, "postgres-db-fork-feature-login", loaded.Container)
+	assert.Equal(t, 54321, loaded.Port)
+
+	loaded.Port = 54322
+	require.NoError(t, store.Save(loaded))
+	reloaded, err := store.Load("feature/login")
+	require.NoError(t, err)
+	assert.Equal(t, 54322, reloaded.Port)
+	assert.True(t, reloaded.CreatedAt.Equal(created), "creation time is kept")
+
+	require.NoError(t, store.Delete("feature/login"))
+	gone, err := store.Load("feature/login")
+	require.NoError(t, err)
+	assert.Nil(t, gone)
+}
+
+func TestContainerName(t *testing.T) {
+	assert.Equal(t, "postgres-db-fork-myapp_pr_12", ContainerName("myapp_pr_12"))
+	assert.Equal(t, "postgres-db-fork-feature-new-api", ContainerName("Feature/New API"))
+	assert.Equal(t, "postgres-db-fork-default", ContainerName("///"))
+}
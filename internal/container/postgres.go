@@ -0,0 +1,243 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/sirupsen/logrus"
+)
+
+// PostgresOptions describes a long-lived PostgreSQL container used as a fork target
+type PostgresOptions struct {
+	// Name is the container name; an existing container with this name is reused
+	Name string
+	// Image is the PostgreSQL image, e.g. "postgres:16"
+	Image string
+	// Port is the preferred host port for a new container; 0 picks a free port.
+	// A busy preferred port is replaced with a free one unless StrictPort is set.
+	Port       int
+	StrictPort bool
+	Username   string
+	Password   string
+	// Volume is the named volume holding the data directory, so forks survive restarts
+	Volume string
+	// StartTimeout bounds how long to wait for the server to accept connections
+	StartTimeout time.Duration
+	// Recreate removes an existing container and its volume before starting
+	Recreate bool
+}
+
+// DefaultPostgresOptions returns the options used for local developer targets
+func DefaultPostgresOptions() PostgresOptions {
+	return PostgresOptions{
+		Name:         "postgres-db-fork-local",
+		Image:        "postgres:16",
+		Port:         0,
+		Username:     "postgres",
+		Password:     "postgres", // pragma: allowlist secret
+		Volume:       "postgres-db-fork-local-data",
+		StartTimeout: time.Minute,
+	}
+}
+
+// Postgres is a running PostgreSQL container
+type Postgres struct {
+	Options PostgresOptions
+	// Created reports whether the container was created by this call rather than reused
+	Created bool
+}
+
+// EnsurePostgres starts the named PostgreSQL container, creating it if it does not exist,
+// and waits until the server accepts connections
+func EnsurePostgres(opts PostgresOptions) (*Postgres, error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	if err := pool.Client.Ping(); err != nil {
+		return nil, fmt.Errorf("docker is not available: %w", err)
+	}
+	pool.MaxWait = opts.StartTimeout
+
+	pg := &Postgres{Options: opts}
+	nameFilter := "^/" + opts.Name + "$"
+
+	if opts.Recreate {
+		if err := removePostgres(pool, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if resource, found := pool.ContainerByName(nameFilter); found {
+		logrus.Infof("Reusing Docker container %s", opts.Name)
+		if !resource.Container.State.Running {
+			if err := pool.Client.StartContainer(resource.Container.ID, nil); err != nil {
+				return nil, fmt.Errorf("failed to start container %s: %w", opts.Name, err)
+			}
+			if resource, found = pool.ContainerByName(nameFilter); !found {
+				return nil, fmt.Errorf("container %s disappeared after starting", opts.Name)
+			}
+		}
+		port, err := strconv.Atoi(resource.GetPort("5432/tcp"))
+		if err != nil {
+			return nil, fmt.Errorf("container %s does not publish port 5432", opts.Name)
+		}
+		pg.Options.Port = port
+	} else {
+		port, err := createPostgres(pool, opts)
+		if err != nil {
+			return nil, err
+		}
+		pg.Options.Port = port
+		pg.Created = true
+	}
+
+	admin := pg.Config("postgres")
+	if err := pool.Retry(func() error {
+		conn, err := db.NewConnection(&admin)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}); err != nil {
+		return nil, fmt.Errorf("postgres in container %s did not become ready: %w", opts.Name, err)
+	}
+
+	return pg, nil
+}
+
+// maxPortAttempts bounds retries when another process grabs a port between choosing
+// it and Docker binding it
+const maxPortAttempts = 3
+
+// createPostgres creates and starts the container, returning the host port it publishes
+func createPostgres(pool *dockertest.Pool, opts PostgresOptions) (int, error) {
+	for attempt := 1; ; attempt++ {
+		port, err := choosePort(opts.Port, opts.StrictPort)
+		if err != nil {
+			return 0, err
+		}
+		opts.Port = port
+
+		logrus.Infof("Creating Docker container %s from %s on port %d", opts.Name, opts.Image, port)
+		_, err = pool.RunWithOptions(runOptions(opts), func(hc *docker.HostConfig) {
+			hc.RestartPolicy = docker.RestartPolicy{Name: "unless-stopped"}
+		})
+		if err == nil {
+			return port, nil
+		}
+
+		// A failed start leaves the created container behind, blocking its name
+		if rmErr := pool.RemoveContainerByName(opts.Name); rmErr != nil {
+			logrus.Warnf("Failed to remove container %s after failed start: %v", opts.Name, rmErr)
+		}
+		if opts.StrictPort || attempt >= maxPortAttempts || !isPortConflict(err) {
+			return 0, fmt.Errorf("failed to create container %s: %w", opts.Name, err)
+		}
+		logrus.Warnf("Port %d was taken while creating %s, choosing another", port, opts.Name)
+		opts.Port = 0
+	}
+}
+
+// removePostgres removes the container and its data volume if they exist
+func removePostgres(pool *dockertest.Pool, opts PostgresOptions) error {
+	logrus.Infof("Removing Docker container %s", opts.Name)
+	if err := pool.RemoveContainerByName(opts.Name); err != nil {
+		return fmt.Errorf("failed to remove container %s: %w", opts.Name, err)
+	}
+	if opts.Volume == "" {
+		return nil
+	}
+	if err := pool.Client.RemoveVolumeWithOptions(docker.RemoveVolumeOptions{Name: opts.Volume, Force: true}); err != nil && !errors.Is(err, docker.ErrNoSuchVolume) {
+		return fmt.Errorf("failed to remove volume %s: %w", opts.Volume, err)
+	}
+	return nil
+}
+
+// choosePort returns the preferred port when it is free, or any free port otherwise
+func choosePort(preferred int, strict bool) (int, error) {
+	if preferred != 0 {
+		if PortAvailable(preferred) {
+			return preferred, nil
+		}
+		if strict {
+			return 0, fmt.Errorf("port %d is already in use", preferred)
+		}
+		logrus.Warnf("Port %d is already in use, choosing a free port", preferred)
+	}
+	return FreePort()
+}
+
+// FreePort asks the kernel for a free TCP port on the loopback interface
+func FreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer func() { _ = listener.Close() }()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// PortAvailable reports whether the TCP port can be bound on the loopback interface
+func PortAvailable(port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+// isPortConflict reports whether Docker failed because the host port is in use
+func isPortConflict(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "port is already allocated") || strings.Contains(msg, "address already in use")
+}
+
+// Config returns the connection settings for a database in the container
+func (p *Postgres) Config(database string) config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Host:     "localhost",
+		Port:     p.Options.Port,
+		Username: p.Options.Username,
+		Password: p.Options.Password, // pragma: allowlist secret
+		Database: database,
+		SSLMode:  "disable",
+	}
+}
+
+// runOptions translates the options into a dockertest run configuration
+func runOptions(opts PostgresOptions) *dockertest.RunOptions {
+	repository, tag := opts.Image, "latest"
+	if i := strings.LastIndex(opts.Image, ":"); i > strings.LastIndex(opts.Image, "/") {
+		repository, tag = opts.Image[:i], opts.Image[i+1:]
+	}
+
+	run := &dockertest.RunOptions{
+		Name:       opts.Name,
+		Repository: repository,
+		Tag:        tag,
+		Env: []string{
+			"POSTGRES_USER=" + opts.Username,
+			"POSTGRES_PASSWORD=" + opts.Password, // pragma: allowlist secret
+		},
+		ExposedPorts: []string{"5432/tcp"},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"5432/tcp": {{HostIP: "127.0.0.1", HostPort: strconv.Itoa(opts.Port)}},
+		},
+		Labels: map[string]string{"managed-by": "postgres-db-fork"},
+	}
+	if opts.Volume != "" {
+		run.Mounts = []string{opts.Volume + ":/var/lib/postgresql/data"}
+	}
+	return run
+}
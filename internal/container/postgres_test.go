@@ -0,0 +1,78 @@
+package container
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ory/dockertest/v3/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOptions(t *testing.T) {
+	opts := DefaultPostgresOptions()
+	opts.Image = "registry.example.com:5000/postgres:15-alpine"
+	opts.Port = 5433
+
+	run := runOptions(opts)
+
+	assert.Equal(t, "postgres-db-fork-local", run.Name)
+	assert.Equal(t, "registry.example.com:5000/postgres", run.Repository)
+	assert.Equal(t, "15-alpine", run.Tag)
+	assert.Contains(t, run.Env, "POSTGRES_USER=postgres")
+	assert.Equal(t, []docker.PortBinding{{HostIP: "127.0.0.1", HostPort: "5433"}}, run.PortBindings["5432/tcp"])
+	assert.Equal(t, []string{"postgres-db-fork-local-data:/var/lib/postgresql/data"}, run.Mounts)
+}
+
+func TestRunOptions_ImageWithoutTag(t *testing.T) {
+	opts := DefaultPostgresOptions()
+	opts.Image = "localhost:5000/postgres"
+	opts.Volume = ""
+
+	run := runOptions(opts)
+
+	assert.Equal(t, "localhost:5000/postgres", run.Repository)
+	assert.Equal(t, "latest", run.Tag)
+	assert.Empty(t, run.Mounts)
+}
+
+func TestPostgres_Config(t *testing.T) {
+	pg := &Postgres{Options: DefaultPostgresOptions()}
+	pg.Options.Port = 55432
+
+	cfg := pg.Config("app")
+
+	assert.Equal(t, "localhost", cfg.Host)
+	assert.Equal(t, 55432, cfg.Port)
+	assert.Equal(t, "app", cfg.Database)
+	assert.Equal(t, "disable", cfg.SSLMode)
+}
+
+func TestChoosePort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	busy := listener.Addr().(*net.TCPAddr).Port
+
+	assert.False(t, PortAvailable(busy))
+
+	port, err := choosePort(busy, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, busy, port, "a busy preferred port is replaced")
+
+	_, err = choosePort(busy, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in use")
+
+	free, err := FreePort()
+	require.NoError(t, err)
+	port, err = choosePort(free, true)
+	require.NoError(t, err)
+	assert.Equal(t, free, port, "a free preferred port is kept")
+}
+
+func TestIsPortConflict(t *testing.T) {
+	assert.True(t, isPortConflict(errors.New("Bind for 127.0.0.1:5433 failed: port is already allocated")))
+	assert.False(t, isPortConflict(errors.New("no such image")))
+}
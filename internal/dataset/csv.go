@@ -0,0 +1,142 @@
+package dataset
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvWriter writes rows in the CSV dialect of PostgreSQL's COPY ... CSV HEADER:
+// NULL is an empty unquoted field and an empty string is "", so files load back
+// with COPY without losing the difference
+type csvWriter struct {
+	w *bufio.Writer
+}
+
+// newCSVWriter writes the header line and returns the writer
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	c := &csvWriter{w: bufio.NewWriter(w)}
+	header := make([]sql.NullString, len(columns))
+	for i, column := range columns {
+		header[i] = sql.NullString{String: column, Valid: true}
+	}
+	if err := c.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write writes one row
+func (c *csvWriter) Write(values []sql.NullString) error {
+	for i, value := range values {
+		if i > 0 {
+			if err := c.w.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if !value.Valid {
+			continue
+		}
+		if _, err := c.w.WriteString(csvField(value.String)); err != nil {
+			return err
+		}
+	}
+	return c.w.WriteByte('\n')
+}
+
+// Close flushes buffered rows
+func (c *csvWriter) Close() error {
+	return c.w.Flush()
+}
+
+// csvField quotes a value when it would otherwise be read back differently
+func csvField(value string) string {
+	// COPY reads a lone \. as end-of-data
+	if value != "" && value != `\.` && !strings.ContainsAny(value, ",\"\r\n") {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// csvReader reads the CSV dialect csvWriter writes, keeping an empty unquoted field
+// (NULL) apart from a quoted empty one (an empty string)
+type csvReader struct {
+	r       *bufio.Reader
+	columns []string
+}
+
+// newCSVReader reads the header line
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	c := &csvReader{r: bufio.NewReader(r)}
+	header, err := c.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty; a header line is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, field := range header {
+		if field.String == "" {
+			return nil, fmt.Errorf("header column %d has no name", i+1)
+		}
+		c.columns = append(c.columns, field.String)
+	}
+	return c, nil
+}
+
+// Columns returns the header's column names
+func (c *csvReader) Columns() []string {
+	return c.columns
+}
+
+// Read returns the next record, or io.EOF after the last one
+func (c *csvReader) Read() ([]sql.NullString, error) {
+	if _, err := c.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	var record []sql.NullString
+	var field strings.Builder
+	quoted, inQuotes := false, false
+	for {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, fmt.Errorf("unterminated quoted field")
+			}
+			b = '\n'
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case inQuotes && b == '"':
+			if next, err := c.r.Peek(1); err == nil && next[0] == '"' {
+				_, _ = c.r.ReadByte()
+				field.WriteByte('"')
+			} else {
+				inQuotes = false
+			}
+		case inQuotes:
+			field.WriteByte(b)
+		case b == '"':
+			quoted, inQuotes = true, true
+		case b == ',' || b == '\n' || b == '\r':
+			if b == '\r' {
+				if next, err := c.r.Peek(1); err == nil && next[0] == '\n' {
+					_, _ = c.r.ReadByte()
+				}
+			}
+			record = append(record, sql.NullString{String: field.String(), Valid: quoted || field.Len() > 0})
+			if b != ',' {
+				return record, nil
+			}
+			field.Reset()
+			quoted = false
+		default:
+			field.WriteByte(b)
+		}
+	}
+}
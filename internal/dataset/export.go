@@ -0,0 +1,215 @@
+// Package dataset moves table data between databases and local files
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/lib/pq"
+)
+
+// Format is a file format tables are exported to
+type Format string
+
+// Supported export formats
+const (
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat parses a format name
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatParquet:
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("unsupported format '%s' (use csv or parquet)", name)
+	}
+}
+
+// ExportOptions configures an export
+type ExportOptions struct {
+	// Dir is the directory the files are written to; it is created if missing
+	Dir    string
+	Format Format
+	// Tables are the tables to export, schema-qualified or in public; all user
+	// tables when empty
+	Tables []string
+	// Rules mask the matching columns as they are read
+	Rules []masking.Rule
+}
+
+// TableExport describes one exported table
+type TableExport struct {
+	Table  string `json:"table"`
+	File   string `json:"file"`
+	Rows   int64  `json:"rows"`
+	Masked int    `json:"masked_columns,omitempty"`
+}
+
+// rowWriter writes the rows of one table file
+type rowWriter interface {
+	Write(values []sql.NullString) error
+	Close() error
+}
+
+// Export writes each table to <schema>.<table>.<format> in the output directory.
+// Tables are read in a single repeatable-read transaction, so the files are
+// consistent with each other. Values are written in their PostgreSQL text form,
+// with masking rules applied in the query so unmasked values never leave the server.
+func Export(ctx context.Context, db *sql.DB, opts ExportOptions) ([]TableExport, error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	tables := opts.Tables
+	if len(tables) == 0 {
+		if tables, err = listTables(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]TableExport, 0, len(tables))
+	for _, table := range tables {
+		result, err := exportTable(ctx, tx, qualify(table), opts)
+		if err != nil {
+			return results, fmt.Errorf("failed to export %s: %w", table, err)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// exportTable writes one table's rows, removing the file again if anything fails
+func exportTable(ctx context.Context, tx *sql.Tx, table string, opts ExportOptions) (_ *TableExport, err error) {
+	columns, err := tableColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	selectList, err := masking.SelectList(table, columns, opts.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TableExport{
+		Table: table,
+		File:  filepath.Join(opts.Dir, fmt.Sprintf("%s.%s", table, opts.Format)),
+	}
+	for _, rule := range opts.Rules {
+		if strings.TrimPrefix(rule.Table, "public.") == strings.TrimPrefix(table, "public.") {
+			result.Masked++
+		}
+	}
+
+	file, err := os.Create(result.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", result.File, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(result.File)
+		}
+	}()
+
+	var writer rowWriter
+	switch opts.Format {
+	case FormatParquet:
+		writer, err = newParquetWriter(file, columns)
+	default:
+		writer, err = newCSVWriter(file, columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", selectList, quoteTable(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if err := writer.Write(values); err != nil {
+			return nil, err
+		}
+		result.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, writer.Close()
+}
+
+// listTables returns every user table as schema.table
+func listTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT schemaname || '.' || tablename
+		FROM pg_tables
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY schemaname, tablename`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// tableColumns returns the table's column names in order
+func tableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", quoteTable(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	return rows.Columns()
+}
+
+// qualify puts unqualified table names in the public schema
+func qualify(table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	return "public." + table
+}
+
+// quoteTable quotes a schema-qualified table name
+func quoteTable(table string) string {
+	parts := strings.SplitN(table, ".", 2)
+	for i := range parts {
+		parts[i] = pq.QuoteIdentifier(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,138 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("Parquet")
+	require.NoError(t, err)
+	assert.Equal(t, FormatParquet, format)
+
+	_, err = ParseFormat("xlsx")
+	assert.Error(t, err)
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newCSVWriter(&buf, []string{"id", "note"})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Write([]sql.NullString{{String: "1", Valid: true}, {String: "plain", Valid: true}}))
+	require.NoError(t, w.Write([]sql.NullString{{String: "2", Valid: true}, {}}))
+	require.NoError(t, w.Write([]sql.NullString{{String: "3", Valid: true}, {String: "", Valid: true}}))
+	require.NoError(t, w.Write([]sql.NullString{{String: "4", Valid: true}, {String: "say \"hi\",\nbye", Valid: true}}))
+	require.NoError(t, w.Write([]sql.NullString{{String: "5", Valid: true}, {String: `\.`, Valid: true}}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "id,note\n1,plain\n2,\n3,\"\"\n4,\"say \"\"hi\"\",\nbye\"\n5,\"\\.\"\n", buf.String())
+}
+
+func TestParquetWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newParquetWriter(&buf, []string{"id", "email"})
+	require.NoError(t, err)
+	require.NoError(t, w.Write([]sql.NullString{{String: "1", Valid: true}, {String: "a@example.com", Valid: true}}))
+	require.NoError(t, w.Write([]sql.NullString{{String: "2", Valid: true}, {}}))
+	require.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	require.True(t, len(data) > 12)
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4]))
+	footer := data[len(data)-8-footerLen : len(data)-8]
+	assert.Contains(t, string(footer), "email")
+	assert.Contains(t, string(footer), parquetCreatedBy)
+	assert.Contains(t, string(data), "a@example.com")
+
+	// Two column chunks, both recorded with two values
+	require.Len(t, w.rowGroups, 1)
+	assert.Equal(t, int64(2), w.rowGroups[0].rows)
+	assert.Equal(t, int64(4), w.rowGroups[0].columns[0].offset)
+}
+
+func TestEncodePageDefinitionLevels(t *testing.T) {
+	page := encodePage([]sql.NullString{{String: "x", Valid: true}, {}, {}})
+
+	// Levels: a run of one 1 then a run of two 0s, after the 4-byte length
+	levels := []byte{4, 0, 0, 0, 1 << 1, 1, 2 << 1, 0}
+	assert.True(t, bytes.Contains(page, levels))
+	assert.True(t, bytes.HasSuffix(page, []byte{1, 0, 0, 0, 'x'}))
+}
+
+func TestExport(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close mock database: %v", err)
+		}
+	}()
+
+	dir := t.TempDir()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM pg_tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"table"}).AddRow("public.users"))
+	mock.ExpectQuery(`SELECT \* FROM "public"\."users" LIMIT 0`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}))
+	mock.ExpectQuery(`SELECT "id"::text, \(md5\("email"::text\)\)::text AS "email" FROM "public"\."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow("1", "0cc175b9").AddRow("2", nil))
+	mock.ExpectRollback()
+
+	results, err := Export(context.Background(), mockDB, ExportOptions{
+		Dir:    dir,
+		Format: FormatCSV,
+		Rules:  []masking.Rule{{Table: "users", Column: "email", Strategy: masking.StrategyHash}},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, TableExport{
+		Table:  "public.users",
+		File:   filepath.Join(dir, "public.users.csv"),
+		Rows:   2,
+		Masked: 1,
+	}, results[0])
+
+	data, err := os.ReadFile(results[0].File)
+	require.NoError(t, err)
+	assert.Equal(t, "id,email\n1,0cc175b9\n2,\n", string(data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportRemovesPartialFile(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close mock database: %v", err)
+		}
+	}()
+
+	dir := t.TempDir()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "public"\."orders" LIMIT 0`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT "id"::text FROM "public"\."orders"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").RowError(0, assert.AnError))
+	mock.ExpectRollback()
+
+	_, err = Export(context.Background(), mockDB, ExportOptions{Dir: dir, Format: FormatParquet, Tables: []string{"orders"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to export orders")
+
+	_, statErr := os.Stat(filepath.Join(dir, "public.orders.parquet"))
+	assert.True(t, os.IsNotExist(statErr))
+}
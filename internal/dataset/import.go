@@ -0,0 +1,451 @@
+package dataset
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultImportBatchSize is how many rows are sent in one COPY
+const DefaultImportBatchSize = 10000
+
+// ImportOptions configures an import
+type ImportOptions struct {
+	// Table is the table every file is loaded into; when empty it comes from each
+	// file's name, as written by Export (<schema>.<table>.csv or <table>.csv)
+	Table string
+	// Format overrides the format implied by each file's extension
+	Format Format
+	// Mapping renames file columns to table columns; a column mapped to "" is skipped
+	Mapping map[string]string
+	// Truncate empties each table before loading it
+	Truncate bool
+	// BatchSize is how many rows are sent in one COPY
+	BatchSize int
+	// MaxErrors is how many rows of a file may be rejected before its import is
+	// abandoned and rolled back; negative means no limit
+	MaxErrors int
+	// QuarantineDir is where rejected rows are written, <file>.rejected.csv; defaults
+	// to the directory of each file
+	QuarantineDir string
+	// Freeze loads tables emptied by Truncate with COPY FREEZE, so their rows need no
+	// later vacuum freezing
+	Freeze bool
+}
+
+// TableImport describes one imported file
+type TableImport struct {
+	File       string `json:"file"`
+	Table      string `json:"table"`
+	Rows       int64  `json:"rows"`
+	Rejected   int64  `json:"rejected"`
+	Quarantine string `json:"quarantine,omitempty"`
+	// Frozen is set when the rows were loaded with COPY FREEZE
+	Frozen bool `json:"frozen,omitempty"`
+}
+
+// rowReader reads the rows of one file
+type rowReader interface {
+	Columns() []string
+	Read() ([]sql.NullString, error)
+}
+
+// Import bulk-loads each file into its table with COPY, one transaction per file.
+// Rows the table rejects (bad values, constraint violations, wrong column counts) are
+// written to a quarantine file with the error instead of failing the load, until
+// MaxErrors is exceeded. Other failures roll the file's load back.
+func Import(ctx context.Context, db *sql.DB, files []string, opts ImportOptions) ([]TableImport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	results := make([]TableImport, 0, len(files))
+	for _, file := range files {
+		result, err := importFile(ctx, db, file, opts)
+		if err != nil {
+			return results, fmt.Errorf("failed to import %s: %w", file, err)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// errFreezeFailed marks a COPY FREEZE load that has to be redone without FREEZE
+var errFreezeFailed = errors.New("COPY FREEZE failed")
+
+// importFile loads one file in a transaction. COPY FREEZE is only allowed when the
+// table was truncated in the same (sub)transaction, which rules out the savepoints
+// that let rejected rows be quarantined. A truncated table is therefore first loaded
+// with FREEZE and no savepoints; if the server refuses FREEZE (a partitioned table,
+// say) or rejects a row, the load is rolled back and redone the usual way.
+func importFile(ctx context.Context, db *sql.DB, file string, opts ImportOptions) (*TableImport, error) {
+	if opts.Freeze && opts.Truncate {
+		result, err := loadFile(ctx, db, file, opts, true)
+		if !errors.Is(err, errFreezeFailed) {
+			return result, err
+		}
+		logrus.Debugf("Loading %s without COPY FREEZE: %v", file, err)
+	}
+	return loadFile(ctx, db, file, opts, false)
+}
+
+// loadFile loads one file in a transaction, with COPY FREEZE when freeze is set
+func loadFile(ctx context.Context, db *sql.DB, file string, opts ImportOptions, freeze bool) (*TableImport, error) {
+	table, format, err := importTarget(file, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &TableImport{File: file, Table: table, Frozen: freeze}
+
+	reader, closeFile, err := openRows(file, format)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile()
+
+	fileColumns := reader.Columns()
+	columns, indexes, err := mapColumns(fileColumns, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &quarantine{
+		path:    quarantinePath(file, opts.QuarantineDir),
+		columns: fileColumns,
+	}
+	defer func() { _ = q.Close() }()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if opts.Truncate {
+		if _, err := tx.ExecContext(ctx, "TRUNCATE "+quoteTable(table)); err != nil {
+			return nil, fmt.Errorf("failed to truncate %s: %w", table, err)
+		}
+	}
+
+	loader := &batchLoader{tx: tx, table: table, columns: columns, freeze: freeze}
+	var raw [][]sql.NullString
+	var batch [][]interface{}
+	flush := func() error {
+		loaded, rejected, err := loader.load(ctx, batch)
+		if err != nil {
+			return err
+		}
+		result.Rows += loaded
+		for _, r := range rejected {
+			if err := q.Write(raw[r.index], r.err); err != nil {
+				return err
+			}
+		}
+		result.Rejected += int64(len(rejected))
+		raw, batch = raw[:0], batch[:0]
+		return nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) != len(fileColumns) {
+			if err := q.Write(row, fmt.Errorf("expected %d columns, got %d", len(fileColumns), len(row))); err != nil {
+				return nil, err
+			}
+			result.Rejected++
+		} else {
+			values := make([]interface{}, len(indexes))
+			for i, index := range indexes {
+				if row[index].Valid {
+					values[i] = row[index].String
+				}
+			}
+			raw = append(raw, row)
+			batch = append(batch, values)
+			if len(batch) >= opts.BatchSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if opts.MaxErrors >= 0 && result.Rejected > int64(opts.MaxErrors) {
+			return nil, fmt.Errorf("more than %d rows rejected (see %s)", opts.MaxErrors, q.path)
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxErrors >= 0 && result.Rejected > int64(opts.MaxErrors) {
+		return nil, fmt.Errorf("more than %d rows rejected (see %s)", opts.MaxErrors, q.path)
+	}
+
+	if err := q.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	if result.Rejected > 0 {
+		result.Quarantine = q.path
+	}
+	return result, nil
+}
+
+// importTarget works out the table and format of a file
+func importTarget(file string, opts ImportOptions) (string, Format, error) {
+	ext := filepath.Ext(file)
+	format := opts.Format
+	if format == "" {
+		var err error
+		if format, err = ParseFormat(strings.TrimPrefix(ext, ".")); err != nil {
+			return "", "", fmt.Errorf("cannot tell the format from the file name: %w", err)
+		}
+	}
+
+	table := opts.Table
+	if table == "" {
+		table = strings.TrimSuffix(filepath.Base(file), ext)
+	}
+	if table == "" || strings.Count(table, ".") > 1 {
+		return "", "", fmt.Errorf("cannot tell the table from the file name (use --table)")
+	}
+	return qualify(table), format, nil
+}
+
+// openRows opens a file for reading rows
+func openRows(path string, format Format) (rowReader, func(), error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeFile := func() { _ = file.Close() }
+
+	var reader rowReader
+	switch format {
+	case FormatParquet:
+		info, statErr := file.Stat()
+		if statErr != nil {
+			closeFile()
+			return nil, nil, statErr
+		}
+		reader, err = newParquetReader(file, info.Size())
+	default:
+		reader, err = newCSVReader(file)
+	}
+	if err != nil {
+		closeFile()
+		return nil, nil, err
+	}
+	return reader, closeFile, nil
+}
+
+// mapColumns applies the column mapping, returning the table columns to load and
+// the index of the file column each one reads
+func mapColumns(fileColumns []string, mapping map[string]string) ([]string, []int, error) {
+	for from := range mapping {
+		found := false
+		for _, column := range fileColumns {
+			found = found || column == from
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("mapped column '%s' is not in the file", from)
+		}
+	}
+
+	var columns []string
+	var indexes []int
+	seen := make(map[string]bool)
+	for i, column := range fileColumns {
+		target := column
+		if mapped, ok := mapping[column]; ok {
+			target = mapped
+		}
+		if target == "" {
+			continue
+		}
+		if seen[target] {
+			return nil, nil, fmt.Errorf("column '%s' is loaded more than once", target)
+		}
+		seen[target] = true
+		columns = append(columns, target)
+		indexes = append(indexes, i)
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("no columns left to load")
+	}
+	return columns, indexes, nil
+}
+
+// rejectedRow is a batch row the table refused
+type rejectedRow struct {
+	index int
+	err   error
+}
+
+// batchLoader sends batches of rows to one table with COPY
+type batchLoader struct {
+	tx      *sql.Tx
+	table   string
+	columns []string
+	// freeze copies with FREEZE and without savepoints, so any failure ends the load
+	freeze bool
+}
+
+// load copies a batch under a savepoint. When the table rejects the batch, each row
+// is copied on its own so the good rows still load and the bad ones are returned.
+func (l *batchLoader) load(ctx context.Context, batch [][]interface{}) (int64, []rejectedRow, error) {
+	if l.freeze {
+		if err := l.copyRows(ctx, batch); err != nil {
+			if isRowError(err) || isFreezeRefused(err) {
+				return 0, nil, fmt.Errorf("%w: %v", errFreezeFailed, err)
+			}
+			return 0, nil, err
+		}
+		return int64(len(batch)), nil, nil
+	}
+
+	err := l.copyUnderSavepoint(ctx, batch)
+	if err == nil {
+		return int64(len(batch)), nil, nil
+	}
+	if !isRowError(err) {
+		return 0, nil, err
+	}
+	if len(batch) == 1 {
+		return 0, []rejectedRow{{index: 0, err: err}}, nil
+	}
+
+	var loaded int64
+	var rejected []rejectedRow
+	for i, row := range batch {
+		if err := l.copyUnderSavepoint(ctx, [][]interface{}{row}); err != nil {
+			if !isRowError(err) {
+				return 0, nil, err
+			}
+			rejected = append(rejected, rejectedRow{index: i, err: err})
+			continue
+		}
+		loaded++
+	}
+	return loaded, rejected, nil
+}
+
+// copyUnderSavepoint copies rows, rolling back to a savepoint when COPY fails so the
+// transaction can carry on
+func (l *batchLoader) copyUnderSavepoint(ctx context.Context, rows [][]interface{}) error {
+	if _, err := l.tx.ExecContext(ctx, "SAVEPOINT pgfork_import"); err != nil {
+		return err
+	}
+	if err := l.copyRows(ctx, rows); err != nil {
+		if _, rbErr := l.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT pgfork_import"); rbErr != nil {
+			return fmt.Errorf("%v (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	_, err := l.tx.ExecContext(ctx, "RELEASE SAVEPOINT pgfork_import")
+	return err
+}
+
+// copyRows sends rows with COPY FROM STDIN
+func (l *batchLoader) copyRows(ctx context.Context, rows [][]interface{}) error {
+	parts := strings.SplitN(l.table, ".", 2)
+	query := pq.CopyInSchema(parts[0], parts[1], l.columns...)
+	if l.freeze {
+		query += " WITH (FREEZE)"
+	}
+	stmt, err := l.tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			_ = stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		return err
+	}
+	return stmt.Close()
+}
+
+// isRowError reports whether an error is about the data of a row (SQLSTATE classes
+// 22 data exception and 23 integrity constraint violation) rather than the load
+func isRowError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	class := pqErr.Code.Class()
+	return class == "22" || class == "23"
+}
+
+// isFreezeRefused reports whether the server refused COPY FREEZE for the table, as it
+// does for partitioned tables (feature not supported) and tables not truncated in the
+// current subtransaction (object not in prerequisite state)
+func isFreezeRefused(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "0A000" || pqErr.Code == "55000")
+}
+
+// quarantine writes rejected rows, with the reason, to a CSV file created on first use
+type quarantine struct {
+	path    string
+	columns []string
+	file    *os.File
+	writer  *csvWriter
+}
+
+// Write records a rejected row
+func (q *quarantine) Write(row []sql.NullString, reason error) error {
+	if q.writer == nil {
+		file, err := os.Create(q.path)
+		if err != nil {
+			return fmt.Errorf("failed to create quarantine file: %w", err)
+		}
+		q.file = file
+		if q.writer, err = newCSVWriter(file, append(append([]string{}, q.columns...), "error")); err != nil {
+			return err
+		}
+	}
+	record := append(append([]sql.NullString{}, row...), sql.NullString{String: reason.Error(), Valid: true})
+	return q.writer.Write(record)
+}
+
+// Close flushes and closes the quarantine file, if one is open
+func (q *quarantine) Close() error {
+	if q.writer == nil {
+		return nil
+	}
+	err := q.writer.Close()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	q.writer, q.file = nil, nil
+	return err
+}
+
+// quarantinePath returns where a file's rejected rows go
+func quarantinePath(file, dir string) string {
+	if dir == "" {
+		dir = filepath.Dir(file)
+	}
+	return filepath.Join(dir, filepath.Base(file)+".rejected.csv")
+}
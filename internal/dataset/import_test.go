@@ -0,0 +1,273 @@
+package dataset
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVReader(t *testing.T) {
+	input := "id,note\r\n1,plain\r\n2,\n3,\"\"\n4,\"say \"\"hi\"\",\nbye\"\n5"
+	r, err := newCSVReader(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "note"}, r.Columns())
+
+	var notes []sql.NullString
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if len(row) == 2 {
+			notes = append(notes, row[1])
+		}
+	}
+	assert.Equal(t, []sql.NullString{
+		{String: "plain", Valid: true},
+		{},
+		{String: "", Valid: true},
+		{String: "say \"hi\",\nbye", Valid: true},
+	}, notes)
+
+	_, err = newCSVReader(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	rows := [][]sql.NullString{
+		{{String: "1", Valid: true}, {String: "a@example.com", Valid: true}},
+		{{String: "2", Valid: true}, {}},
+		{{String: "3", Valid: true}, {String: "", Valid: true}},
+	}
+	var buf bytes.Buffer
+	w, err := newParquetWriter(&buf, []string{"id", "email"})
+	require.NoError(t, err)
+	for _, row := range rows {
+		require.NoError(t, w.Write(row))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := newParquetReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "email"}, r.Columns())
+
+	var read [][]sql.NullString
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		read = append(read, row)
+	}
+	assert.Equal(t, rows, read)
+}
+
+func TestParquetValueFormatting(t *testing.T) {
+	assert.Equal(t, "2024-03-01", formatInt32(parquetColumn{converted: parquetConvertedDate}, 19783))
+	assert.Equal(t, "-1.05", formatInt32(parquetColumn{converted: parquetConvertedDecimal, scale: 2}, -105))
+	assert.Equal(t, "0.007", formatInt64(parquetColumn{converted: parquetConvertedDecimal, scale: 3}, 7))
+	assert.Equal(t, "2024-03-01 12:00:00.5+00", formatInt64(parquetColumn{
+		converted: parquetConvertedTimestampMillis, timeUnit: 1000000, utc: true,
+	}, 1709294400500))
+	assert.Equal(t, `\x0aff`, formatBytes(parquetColumn{converted: -1}, []byte{0x0a, 0xff}))
+	assert.Equal(t, "-2", formatBytes(parquetColumn{converted: parquetConvertedDecimal}, []byte{0xff, 0xfe}))
+	assert.Equal(t, "Infinity", formatFloat(math.Inf(1), 64))
+}
+
+func TestDecodeHybrid(t *testing.T) {
+	// A bit-packed group of eight 3-bit values 0..7, then a run of four 5s
+	values, err := decodeHybrid([]byte{0x03, 0x88, 0xc6, 0xfa, 0x08, 0x05}, 3, 12)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4, 5, 6, 7, 5, 5, 5, 5}, values)
+
+	_, err = decodeHybrid([]byte{0x03, 0x88}, 3, 8)
+	assert.Error(t, err)
+}
+
+func TestSnappyDecode(t *testing.T) {
+	// "hello " as a literal, then an overlapping copy of 11 bytes from 6 back
+	out, err := snappyDecode([]byte{0x11, 0x14, 'h', 'e', 'l', 'l', 'o', ' ', 0x2a, 0x06, 0x00})
+	require.NoError(t, err)
+	assert.Equal(t, "hello hello hello", string(out))
+
+	_, err = snappyDecode([]byte{0x05, 0x2a, 0x06, 0x00})
+	assert.Error(t, err)
+}
+
+func TestMapColumns(t *testing.T) {
+	columns, indexes, err := mapColumns([]string{"id", "mail", "legacy"}, map[string]string{"mail": "email", "legacy": ""})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "email"}, columns)
+	assert.Equal(t, []int{0, 1}, indexes)
+
+	_, _, err = mapColumns([]string{"id"}, map[string]string{"missing": "x"})
+	assert.Error(t, err)
+
+	_, _, err = mapColumns([]string{"id", "uid"}, map[string]string{"uid": "id"})
+	assert.Error(t, err)
+}
+
+func TestImportTarget(t *testing.T) {
+	table, format, err := importTarget("/data/billing.invoices.parquet", ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "billing.invoices", table)
+	assert.Equal(t, FormatParquet, format)
+
+	table, format, err = importTarget("users.txt", ImportOptions{Table: "people", Format: FormatCSV})
+	require.NoError(t, err)
+	assert.Equal(t, "public.people", table)
+	assert.Equal(t, FormatCSV, format)
+
+	_, _, err = importTarget("users.txt", ImportOptions{})
+	assert.Error(t, err)
+}
+
+// expectCopy expects one COPY of the given rows into public.users (id, email)
+func expectCopy(mock sqlmock.Sqlmock, failure error, rows ...[]interface{}) {
+	prepare := mock.ExpectPrepare(`COPY "public"."users" \("id", "email"\) FROM STDIN`)
+	for _, row := range rows {
+		args := make([]driver.Value, len(row))
+		for i, v := range row {
+			args[i] = v
+		}
+		prepare.ExpectExec().WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	flush := prepare.ExpectExec()
+	if failure != nil {
+		flush.WillReturnError(failure)
+	} else {
+		flush.WillReturnResult(sqlmock.NewResult(0, int64(len(rows))))
+	}
+}
+
+func TestImportQuarantinesRejectedRows(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close mock database: %v", err)
+		}
+	}()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "users.csv")
+	require.NoError(t, os.WriteFile(file, []byte("id,mail\n1,a@example.com\nx,b@example.com\n3\n"), 0o600))
+
+	badInput := &pq.Error{Code: "22P02", Message: `invalid input syntax for type integer: "x"`}
+	good := []interface{}{"1", "a@example.com"}
+	bad := []interface{}{"x", "b@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, badInput, good, bad)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, nil, good)
+	mock.ExpectExec(`RELEASE SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, badInput, bad)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	results, err := Import(context.Background(), mockDB, []string{file}, ImportOptions{
+		Mapping:   map[string]string{"mail": "email"},
+		MaxErrors: 5,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, TableImport{
+		File:       file,
+		Table:      "public.users",
+		Rows:       1,
+		Rejected:   2,
+		Quarantine: file + ".rejected.csv",
+	}, results[0])
+
+	quarantined, err := os.ReadFile(results[0].Quarantine)
+	require.NoError(t, err)
+	assert.Equal(t, "id,mail,error\n3,\"expected 2 columns, got 1\"\nx,b@example.com,\"pq: invalid input syntax for type integer: \"\"x\"\"\"\n",
+		string(quarantined))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportAbortsOverMaxErrors(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close mock database: %v", err)
+		}
+	}()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "users.csv")
+	require.NoError(t, os.WriteFile(file, []byte("id,email\n1\n"), 0o600))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err = Import(context.Background(), mockDB, []string{file}, ImportOptions{MaxErrors: 0})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "more than 0 rows rejected")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImportFreezeFallsBack(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close mock database: %v", err)
+		}
+	}()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "users.csv")
+	require.NoError(t, os.WriteFile(file, []byte("id,email\n1,a@example.com\n"), 0o600))
+	row := []interface{}{"1", "a@example.com"}
+
+	// The first file loads frozen; the second table is partitioned, so FREEZE is
+	// refused and the file is loaded again without it
+	mock.ExpectBegin()
+	mock.ExpectExec(`TRUNCATE "public"."users"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	frozen := mock.ExpectPrepare(`COPY "public"."users" \("id", "email"\) FROM STDIN WITH \(FREEZE\)`)
+	frozen.ExpectExec().WithArgs("1", "a@example.com").WillReturnResult(sqlmock.NewResult(0, 0))
+	frozen.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`TRUNCATE "public"."users"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, &pq.Error{Code: "0A000", Message: "cannot perform COPY FREEZE on a partitioned table"}, row)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`TRUNCATE "public"."users"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCopy(mock, nil, row)
+	mock.ExpectExec(`RELEASE SAVEPOINT pgfork_import`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	results, err := Import(context.Background(), mockDB, []string{file, file}, ImportOptions{
+		Truncate:  true,
+		Freeze:    true,
+		MaxErrors: 5,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.True(t, results[0].Frozen)
+	assert.False(t, results[1].Frozen)
+	assert.Equal(t, int64(1), results[1].Rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
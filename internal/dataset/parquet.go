@@ -0,0 +1,327 @@
+package dataset
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"io"
+)
+
+// parquetRowGroupRows is how many rows are buffered before a row group is written
+const parquetRowGroupRows = 50000
+
+// parquetMagic starts and ends every Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet and Thrift constants used by the writer
+const (
+	parquetTypeByteArray   = 6
+	parquetOptional        = 1
+	parquetConvertedUTF8   = 0
+	parquetEncodingPlain   = 0
+	parquetEncodingRLE     = 3
+	parquetCodecNone       = 0
+	parquetPageTypeData    = 0
+	parquetFormatVersion   = 1
+	parquetCreatedBy       = "postgres-db-fork"
+	thriftTypeI32          = 5
+	thriftTypeI64          = 6
+	thriftTypeBinary       = 8
+	thriftTypeList         = 9
+	thriftTypeStruct       = 12
+	thriftShortListMaxSize = 14
+)
+
+// parquetWriter writes rows as a Parquet file with one optional UTF8 column per
+// table column, holding the value's PostgreSQL text representation. Pages are
+// PLAIN encoded and uncompressed, which every Parquet reader supports.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []string
+	// values holds the buffered row group, one slice per column
+	values    [][]sql.NullString
+	rows      int
+	totalRows int64
+	rowGroups []parquetRowGroup
+}
+
+// parquetRowGroup records where a written row group's column chunks are
+type parquetRowGroup struct {
+	rows    int64
+	size    int64
+	columns []parquetColumnChunk
+}
+
+// parquetColumnChunk records a column chunk holding a single data page
+type parquetColumnChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+// newParquetWriter writes the leading magic and returns the writer
+func newParquetWriter(w io.Writer, columns []string) (*parquetWriter, error) {
+	p := &parquetWriter{
+		w:       w,
+		columns: columns,
+		values:  make([][]sql.NullString, len(columns)),
+	}
+	if err := p.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Write buffers one row, writing a row group once enough rows are buffered
+func (p *parquetWriter) Write(values []sql.NullString) error {
+	for i := range p.columns {
+		p.values[i] = append(p.values[i], values[i])
+	}
+	p.rows++
+	if p.rows >= parquetRowGroupRows {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// Close writes the buffered rows and the file footer
+func (p *parquetWriter) Close() error {
+	if p.rows > 0 {
+		if err := p.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	footer := p.fileMetaData()
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(footer)))
+	if err := p.write(length); err != nil {
+		return err
+	}
+	return p.write([]byte(parquetMagic))
+}
+
+// flushRowGroup writes each buffered column as one data page
+func (p *parquetWriter) flushRowGroup() error {
+	group := parquetRowGroup{rows: int64(p.rows)}
+	for i := range p.columns {
+		page := encodePage(p.values[i])
+		chunk := parquetColumnChunk{offset: p.offset, size: int64(len(page)), numValues: int64(p.rows)}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+		group.size += chunk.size
+		p.values[i] = p.values[i][:0]
+	}
+	p.rowGroups = append(p.rowGroups, group)
+	p.totalRows += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// write writes to the file, tracking the offset column chunks are recorded at
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// encodePage returns a page header followed by a DataPage v1 body: definition levels
+// (1 for values, 0 for NULL) in the RLE hybrid encoding with a length prefix, then
+// the non-NULL values as length-prefixed byte arrays
+func encodePage(values []sql.NullString) []byte {
+	var levels bytes.Buffer
+	for start := 0; start < len(values); {
+		end := start
+		for end < len(values) && values[end].Valid == values[start].Valid {
+			end++
+		}
+		writeUvarint(&levels, uint64(end-start)<<1)
+		if values[start].Valid {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		start = end
+	}
+
+	var body bytes.Buffer
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(levels.Len()))
+	body.Write(length)
+	body.Write(levels.Bytes())
+	for _, value := range values {
+		if !value.Valid {
+			continue
+		}
+		binary.LittleEndian.PutUint32(length, uint32(len(value.String)))
+		body.Write(length)
+		body.WriteString(value.String)
+	}
+
+	header := &thriftWriter{}
+	header.i32(1, parquetPageTypeData)
+	header.i32(2, int32(body.Len()))
+	header.i32(3, int32(body.Len()))
+	header.structBegin(5)
+	header.i32(1, int32(len(values)))
+	header.i32(2, parquetEncodingPlain)
+	header.i32(3, parquetEncodingRLE)
+	header.i32(4, parquetEncodingRLE)
+	header.structEnd()
+	header.stop()
+
+	return append(header.buf.Bytes(), body.Bytes()...)
+}
+
+// fileMetaData encodes the footer describing the schema and every row group
+func (p *parquetWriter) fileMetaData() []byte {
+	t := &thriftWriter{}
+	t.i32(1, parquetFormatVersion)
+
+	t.listBegin(2, thriftTypeStruct, len(p.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.elemEnd()
+	for _, column := range p.columns {
+		t.elemBegin()
+		t.i32(1, parquetTypeByteArray)
+		t.i32(3, parquetOptional)
+		t.binary(4, column)
+		t.i32(6, parquetConvertedUTF8)
+		t.elemEnd()
+	}
+
+	t.i64(3, p.totalRows)
+
+	t.listBegin(4, thriftTypeStruct, len(p.rowGroups))
+	for _, group := range p.rowGroups {
+		t.elemBegin()
+		t.listBegin(1, thriftTypeStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, parquetTypeByteArray)
+			t.listBegin(2, thriftTypeI32, 2)
+			t.listI32(parquetEncodingPlain)
+			t.listI32(parquetEncodingRLE)
+			t.listBegin(3, thriftTypeBinary, 1)
+			t.listBinary(p.columns[i])
+			t.i32(4, parquetCodecNone)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.elemEnd()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.elemEnd()
+	}
+
+	t.binary(6, parquetCreatedBy)
+	t.stop()
+	return t.buf.Bytes()
+}
+
+// thriftWriter encodes the subset of the Thrift compact protocol Parquet metadata needs
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last holds the previous field ID of each open struct, innermost last
+	last []int16
+}
+
+// field writes a field header, using the short delta form when possible
+func (t *thriftWriter) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = append(t.last, 0)
+	}
+	top := len(t.last) - 1
+	if delta := id - t.last[top]; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		writeUvarint(&t.buf, zigzag(int64(id)))
+	}
+	t.last[top] = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftTypeI32)
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftTypeI64)
+	writeUvarint(&t.buf, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftTypeBinary)
+	t.listBinary(v)
+}
+
+// structBegin starts a struct-valued field
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftTypeStruct)
+	t.last = append(t.last, 0)
+}
+
+// structEnd ends the innermost struct
+func (t *thriftWriter) structEnd() {
+	t.stop()
+	t.last = t.last[:len(t.last)-1]
+}
+
+// stop ends the top-level struct
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
+
+// listBegin starts a list-valued field; its elements follow
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftTypeList)
+	if size <= thriftShortListMaxSize {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xF0 | elemType)
+		writeUvarint(&t.buf, uint64(size))
+	}
+}
+
+// elemBegin starts a struct element of a list
+func (t *thriftWriter) elemBegin() {
+	t.last = append(t.last, 0)
+}
+
+// elemEnd ends a struct element of a list
+func (t *thriftWriter) elemEnd() {
+	t.structEnd()
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listBinary(v string) {
+	writeUvarint(&t.buf, uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
@@ -0,0 +1,640 @@
+package dataset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parquet physical types, converted types, encodings and codecs the reader handles
+const (
+	parquetTypeBoolean       = 0
+	parquetTypeInt32         = 1
+	parquetTypeInt64         = 2
+	parquetTypeInt96         = 3
+	parquetTypeFloat         = 4
+	parquetTypeDouble        = 5
+	parquetTypeFixedLenBytes = 7
+
+	parquetConvertedEnum            = 4
+	parquetConvertedDecimal         = 5
+	parquetConvertedDate            = 6
+	parquetConvertedTimeMillis      = 7
+	parquetConvertedTimeMicros      = 8
+	parquetConvertedTimestampMillis = 9
+	parquetConvertedTimestampMicros = 10
+	parquetConvertedUint32          = 13
+	parquetConvertedUint64          = 14
+	parquetConvertedJSON            = 19
+
+	parquetEncodingPlainDictionary = 2
+	parquetEncodingRLEDictionary   = 8
+
+	parquetCodecSnappy = 1
+	parquetCodecGzip   = 2
+
+	parquetPageTypeDictionary = 2
+	parquetPageTypeDataV2     = 3
+
+	parquetRepeated = 2
+)
+
+// parquetColumn describes a flat column and how its values map to text
+type parquetColumn struct {
+	name       string
+	typ        int64
+	converted  int64
+	optional   bool
+	scale      int
+	typeLength int
+	// timeUnit is the nanoseconds per unit of a timestamp or time; zero otherwise
+	timeUnit int64
+	// utc marks timestamps stored as UTC instants
+	utc  bool
+	uuid bool
+	text bool
+}
+
+// parquetReader reads the rows of a Parquet file with flat columns, returning each
+// value in a text form PostgreSQL accepts. It handles PLAIN and dictionary encodings,
+// data page versions 1 and 2, and uncompressed, snappy and gzip pages.
+type parquetReader struct {
+	r         io.ReaderAt
+	columns   []parquetColumn
+	rowGroups []interface{}
+	group     int
+	values    [][]sql.NullString
+	row       int
+}
+
+// newParquetReader reads the file footer
+func newParquetReader(r io.ReaderAt, size int64) (*parquetReader, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("file is too small to be Parquet")
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != parquetMagic {
+		return nil, fmt.Errorf("not a Parquet file")
+	}
+	footerLen := int64(binary.LittleEndian.Uint32(tail))
+	if footerLen > size-12 {
+		return nil, fmt.Errorf("invalid Parquet footer length")
+	}
+	footer := make([]byte, footerLen)
+	if _, err := r.ReadAt(footer, size-8-footerLen); err != nil {
+		return nil, err
+	}
+	meta, err := (&thriftReader{data: footer}).readStruct()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Parquet footer: %w", err)
+	}
+
+	p := &parquetReader{r: r, rowGroups: meta.list(4)}
+	schema := meta.list(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("parquet file has no schema")
+	}
+	for _, item := range schema[1:] {
+		element, _ := item.(thriftStruct)
+		column, err := parseParquetColumn(element)
+		if err != nil {
+			return nil, err
+		}
+		p.columns = append(p.columns, column)
+	}
+	return p, nil
+}
+
+// parseParquetColumn reads a schema element, rejecting nested and repeated columns
+func parseParquetColumn(element thriftStruct) (parquetColumn, error) {
+	name := string(element.bytes(4))
+	if _, nested := element.i64(5); nested {
+		return parquetColumn{}, fmt.Errorf("column %s: nested Parquet columns are not supported", name)
+	}
+	repetition, _ := element.i64(3)
+	if repetition == parquetRepeated {
+		return parquetColumn{}, fmt.Errorf("column %s: repeated Parquet columns are not supported", name)
+	}
+
+	column := parquetColumn{name: name, optional: repetition == parquetOptional, converted: -1}
+	column.typ, _ = element.i64(1)
+	if converted, ok := element.i64(6); ok {
+		column.converted = converted
+	}
+	scale, _ := element.i64(7)
+	column.scale = int(scale)
+	length, _ := element.i64(2)
+	column.typeLength = int(length)
+
+	switch column.converted {
+	case parquetConvertedUTF8, parquetConvertedEnum, parquetConvertedJSON:
+		column.text = true
+	case parquetConvertedTimestampMillis, parquetConvertedTimeMillis:
+		column.timeUnit, column.utc = int64(time.Millisecond), true
+	case parquetConvertedTimestampMicros, parquetConvertedTimeMicros:
+		column.timeUnit, column.utc = int64(time.Microsecond), true
+	}
+
+	// Logical types refine the converted type and cover types it cannot express
+	logical := element.strct(10)
+	switch {
+	case logical.strct(1) != nil, logical.strct(4) != nil, logical.strct(12) != nil:
+		column.text = true
+	case logical.strct(5) != nil:
+		column.converted = parquetConvertedDecimal
+		if scale, ok := logical.strct(5).i64(1); ok {
+			column.scale = int(scale)
+		}
+	case logical.strct(7) != nil || logical.strct(8) != nil:
+		timeType := logical.strct(8)
+		column.converted = parquetConvertedTimestampMicros
+		if timeType == nil {
+			timeType = logical.strct(7)
+			column.converted = parquetConvertedTimeMicros
+		}
+		column.utc = timeType.bool(1, true)
+		unit := timeType.strct(2)
+		switch {
+		case unit.strct(1) != nil:
+			column.timeUnit = int64(time.Millisecond)
+			if column.converted == parquetConvertedTimeMicros {
+				column.converted = parquetConvertedTimeMillis
+			}
+		case unit.strct(3) != nil:
+			column.timeUnit = int64(time.Nanosecond)
+		default:
+			column.timeUnit = int64(time.Microsecond)
+		}
+	case logical.strct(14) != nil:
+		column.uuid = true
+	}
+	return column, nil
+}
+
+// Columns returns the file's column names
+func (p *parquetReader) Columns() []string {
+	names := make([]string, len(p.columns))
+	for i, column := range p.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// Read returns the next row, or io.EOF after the last one
+func (p *parquetReader) Read() ([]sql.NullString, error) {
+	for p.values == nil || p.row >= len(p.values[0]) {
+		if p.group >= len(p.rowGroups) || len(p.columns) == 0 {
+			return nil, io.EOF
+		}
+		group, _ := p.rowGroups[p.group].(thriftStruct)
+		p.group++
+		if err := p.readRowGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	row := make([]sql.NullString, len(p.columns))
+	for i := range p.columns {
+		row[i] = p.values[i][p.row]
+	}
+	p.row++
+	return row, nil
+}
+
+// readRowGroup decodes every column chunk of a row group
+func (p *parquetReader) readRowGroup(group thriftStruct) error {
+	chunks := group.list(1)
+	if len(chunks) != len(p.columns) {
+		return fmt.Errorf("row group has %d columns, schema has %d", len(chunks), len(p.columns))
+	}
+	rows, _ := group.i64(3)
+
+	p.values = make([][]sql.NullString, len(p.columns))
+	p.row = 0
+	for i, item := range chunks {
+		chunk, _ := item.(thriftStruct)
+		values, err := p.readColumnChunk(p.columns[i], chunk.strct(3))
+		if err != nil {
+			return fmt.Errorf("column %s: %w", p.columns[i].name, err)
+		}
+		if int64(len(values)) != rows {
+			return fmt.Errorf("column %s: has %d values for %d rows", p.columns[i].name, len(values), rows)
+		}
+		p.values[i] = values
+	}
+	return nil
+}
+
+// readColumnChunk decodes the pages of one column chunk
+func (p *parquetReader) readColumnChunk(column parquetColumn, meta thriftStruct) ([]sql.NullString, error) {
+	if meta == nil {
+		return nil, fmt.Errorf("column chunk has no metadata")
+	}
+	codec, _ := meta.i64(4)
+	numValues, _ := meta.i64(5)
+	size, _ := meta.i64(7)
+	start, _ := meta.i64(9)
+	if dictionary, ok := meta.i64(11); ok && dictionary > 0 && dictionary < start {
+		start = dictionary
+	}
+	data := make([]byte, size)
+	if _, err := p.r.ReadAt(data, start); err != nil {
+		return nil, fmt.Errorf("failed to read column chunk: %w", err)
+	}
+
+	values := make([]sql.NullString, 0, numValues)
+	var dictionary []string
+	for pos := 0; int64(len(values)) < numValues; {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("column chunk ended after %d of %d values", len(values), numValues)
+		}
+		reader := &thriftReader{data: data[pos:]}
+		header, err := reader.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("invalid page header: %w", err)
+		}
+		pos += reader.pos
+		pageType, _ := header.i64(1)
+		uncompressed, _ := header.i64(2)
+		compressed, _ := header.i64(3)
+		if compressed < 0 || compressed > int64(len(data)-pos) {
+			return nil, fmt.Errorf("page is larger than its column chunk")
+		}
+		page := data[pos : pos+int(compressed)]
+		pos += int(compressed)
+
+		switch pageType {
+		case parquetPageTypeDictionary:
+			body, err := decompress(codec, page, uncompressed)
+			if err != nil {
+				return nil, err
+			}
+			count, _ := header.strct(7).i64(1)
+			if dictionary, err = decodePlain(column, body, int(count)); err != nil {
+				return nil, fmt.Errorf("invalid dictionary page: %w", err)
+			}
+		case parquetPageTypeData:
+			body, err := decompress(codec, page, uncompressed)
+			if err != nil {
+				return nil, err
+			}
+			pageHeader := header.strct(5)
+			count, _ := pageHeader.i64(1)
+			encoding, _ := pageHeader.i64(2)
+			var levels []uint32
+			if column.optional {
+				if len(body) < 4 {
+					return nil, fmt.Errorf("truncated definition levels")
+				}
+				n := int(binary.LittleEndian.Uint32(body))
+				if n > len(body)-4 {
+					return nil, fmt.Errorf("truncated definition levels")
+				}
+				if levels, err = decodeHybrid(body[4:4+n], 1, int(count)); err != nil {
+					return nil, err
+				}
+				body = body[4+n:]
+			}
+			if values, err = appendPage(values, column, encoding, body, levels, int(count), dictionary); err != nil {
+				return nil, err
+			}
+		case parquetPageTypeDataV2:
+			pageHeader := header.strct(8)
+			count, _ := pageHeader.i64(1)
+			encoding, _ := pageHeader.i64(4)
+			defLen, _ := pageHeader.i64(5)
+			repLen, _ := pageHeader.i64(6)
+			if defLen+repLen > int64(len(page)) {
+				return nil, fmt.Errorf("truncated page levels")
+			}
+			var levels []uint32
+			if column.optional {
+				if levels, err = decodeHybrid(page[repLen:repLen+defLen], 1, int(count)); err != nil {
+					return nil, err
+				}
+			}
+			body := page[repLen+defLen:]
+			if pageHeader.bool(7, true) {
+				if body, err = decompress(codec, body, uncompressed-defLen-repLen); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = appendPage(values, column, encoding, body, levels, int(count), dictionary); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// appendPage decodes a data page's values, placing NULLs where the definition level is 0
+func appendPage(values []sql.NullString, column parquetColumn, encoding int64, body []byte, levels []uint32, count int, dictionary []string) ([]sql.NullString, error) {
+	present := count
+	if levels != nil {
+		present = 0
+		for _, level := range levels {
+			if level == 1 {
+				present++
+			}
+		}
+	}
+
+	var decoded []string
+	var err error
+	switch encoding {
+	case parquetEncodingPlain:
+		decoded, err = decodePlain(column, body, present)
+	case parquetEncodingPlainDictionary, parquetEncodingRLEDictionary:
+		if len(body) == 0 {
+			return nil, fmt.Errorf("missing dictionary bit width")
+		}
+		var indexes []uint32
+		if indexes, err = decodeHybrid(body[1:], int(body[0]), present); err == nil {
+			decoded = make([]string, len(indexes))
+			for i, index := range indexes {
+				if int(index) >= len(dictionary) {
+					return nil, fmt.Errorf("dictionary index %d out of range", index)
+				}
+				decoded[i] = dictionary[index]
+			}
+		}
+	case parquetEncodingRLE:
+		if column.typ != parquetTypeBoolean || len(body) < 4 {
+			return nil, fmt.Errorf("unsupported RLE-encoded column")
+		}
+		var bits []uint32
+		if bits, err = decodeHybrid(body[4:], 1, present); err == nil {
+			decoded = make([]string, len(bits))
+			for i, bit := range bits {
+				decoded[i] = strconv.FormatBool(bit == 1)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Parquet encoding %d", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	next := 0
+	for i := 0; i < count; i++ {
+		if levels != nil && levels[i] == 0 {
+			values = append(values, sql.NullString{})
+			continue
+		}
+		values = append(values, sql.NullString{String: decoded[next], Valid: true})
+		next++
+	}
+	return values, nil
+}
+
+// decodePlain decodes PLAIN-encoded values to text
+func decodePlain(column parquetColumn, data []byte, count int) ([]string, error) {
+	values := make([]string, 0, count)
+	pos := 0
+	need := func(n int) error {
+		if n < 0 || pos+n > len(data) {
+			return fmt.Errorf("truncated PLAIN values")
+		}
+		return nil
+	}
+	for i := 0; i < count; i++ {
+		switch column.typ {
+		case parquetTypeBoolean:
+			if err := need((i+8)/8 - pos); err != nil {
+				return nil, err
+			}
+			values = append(values, strconv.FormatBool(data[i/8]>>(i%8)&1 == 1))
+		case parquetTypeInt32:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			v := int32(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			values = append(values, formatInt32(column, v))
+		case parquetTypeInt64:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			v := int64(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+			values = append(values, formatInt64(column, v))
+		case parquetTypeInt96:
+			if err := need(12); err != nil {
+				return nil, err
+			}
+			nanos := int64(binary.LittleEndian.Uint64(data[pos:]))
+			julianDay := int64(binary.LittleEndian.Uint32(data[pos+8:]))
+			pos += 12
+			t := time.Unix((julianDay-2440588)*86400, nanos).UTC()
+			values = append(values, t.Format("2006-01-02 15:04:05.999999999")+"+00")
+		case parquetTypeFloat:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			v := math.Float32frombits(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			values = append(values, formatFloat(float64(v), 32))
+		case parquetTypeDouble:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			v := math.Float64frombits(binary.LittleEndian.Uint64(data[pos:]))
+			pos += 8
+			values = append(values, formatFloat(v, 64))
+		case parquetTypeByteArray:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			n := int(binary.LittleEndian.Uint32(data[pos:]))
+			pos += 4
+			if err := need(n); err != nil {
+				return nil, err
+			}
+			values = append(values, formatBytes(column, data[pos:pos+n]))
+			pos += n
+		case parquetTypeFixedLenBytes:
+			if err := need(column.typeLength); err != nil {
+				return nil, err
+			}
+			values = append(values, formatBytes(column, data[pos:pos+column.typeLength]))
+			pos += column.typeLength
+		default:
+			return nil, fmt.Errorf("unsupported Parquet type %d", column.typ)
+		}
+	}
+	return values, nil
+}
+
+func formatInt32(column parquetColumn, v int32) string {
+	switch column.converted {
+	case parquetConvertedDate:
+		return time.Unix(int64(v)*86400, 0).UTC().Format("2006-01-02")
+	case parquetConvertedDecimal:
+		return formatDecimal(big.NewInt(int64(v)), column.scale)
+	case parquetConvertedTimeMillis:
+		return formatTime(int64(v) * int64(time.Millisecond))
+	case parquetConvertedUint32:
+		return strconv.FormatUint(uint64(uint32(v)), 10)
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+func formatInt64(column parquetColumn, v int64) string {
+	switch column.converted {
+	case parquetConvertedDecimal:
+		return formatDecimal(big.NewInt(v), column.scale)
+	case parquetConvertedTimeMicros:
+		return formatTime(v * column.timeUnit)
+	case parquetConvertedTimestampMillis, parquetConvertedTimestampMicros:
+		per := int64(time.Second) / column.timeUnit
+		formatted := time.Unix(v/per, (v%per)*column.timeUnit).UTC().Format("2006-01-02 15:04:05.999999999")
+		if column.utc {
+			formatted += "+00"
+		}
+		return formatted
+	case parquetConvertedUint64:
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func formatBytes(column parquetColumn, b []byte) string {
+	switch {
+	case column.converted == parquetConvertedDecimal:
+		unscaled := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			// Two's complement: subtract 2^(8*len)
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+		}
+		return formatDecimal(unscaled, column.scale)
+	case column.uuid && len(b) == 16:
+		h := hex.EncodeToString(b)
+		return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+	case column.text:
+		return string(b)
+	}
+	// Unannotated byte arrays are binary; \x hex is bytea's input format
+	return `\x` + hex.EncodeToString(b)
+}
+
+// formatDecimal places the decimal point scale digits from the right
+func formatDecimal(unscaled *big.Int, scale int) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// formatTime formats nanoseconds since midnight
+func formatTime(nanos int64) string {
+	return time.Unix(0, nanos).UTC().Format("15:04:05.999999999")
+}
+
+// formatFloat uses the spellings PostgreSQL accepts for special values
+func formatFloat(v float64, bits int) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(v, 'g', -1, bits)
+}
+
+// decompress decompresses a page body
+func decompress(codec int64, data []byte, size int64) ([]byte, error) {
+	switch codec {
+	case parquetCodecNone:
+		return data, nil
+	case parquetCodecSnappy:
+		return snappyDecode(data)
+	case parquetCodecGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = reader.Close() }()
+		out := bytes.NewBuffer(make([]byte, 0, size))
+		if _, err := io.Copy(out, reader); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported Parquet compression codec %d (use uncompressed, snappy or gzip)", codec)
+	}
+}
+
+// decodeHybrid decodes count values of the RLE/bit-packing hybrid encoding
+func decodeHybrid(data []byte, bitWidth, count int) ([]uint32, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("invalid bit width %d", bitWidth)
+	}
+	values := make([]uint32, 0, count)
+	byteWidth := (bitWidth + 7) / 8
+	pos := 0
+	for len(values) < count {
+		header, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, fmt.Errorf("truncated RLE data")
+		}
+		pos += n
+
+		if header&1 == 0 {
+			if pos+byteWidth > len(data) {
+				return nil, fmt.Errorf("truncated RLE run")
+			}
+			var v uint32
+			for i := 0; i < byteWidth; i++ {
+				v |= uint32(data[pos+i]) << (8 * i)
+			}
+			pos += byteWidth
+			for run := header >> 1; run > 0 && len(values) < count; run-- {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		groups := int(header >> 1)
+		packed := groups * bitWidth
+		if packed > len(data)-pos {
+			// Writers may drop the padding of a final partial group
+			packed = len(data) - pos
+		}
+		for i := 0; i < groups*8 && len(values) < count; i++ {
+			var v uint32
+			for b := 0; b < bitWidth; b++ {
+				bit := i*bitWidth + b
+				if bit/8 >= packed {
+					return nil, fmt.Errorf("truncated bit-packed run")
+				}
+				v |= uint32(data[pos+bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, v)
+		}
+		pos += packed
+	}
+	return values, nil
+}
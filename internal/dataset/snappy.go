@@ -0,0 +1,76 @@
+package dataset
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// snappyDecode decodes a snappy block, the default Parquet page compression
+func snappyDecode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > uint64(len(src))*256 {
+		return nil, fmt.Errorf("invalid snappy header")
+	}
+	dst := make([]byte, 0, length)
+
+	for s := n; s < len(src); {
+		tag := src[s]
+		var size, offset int
+		switch tag & 3 {
+		case 0:
+			size = int(tag >> 2)
+			s++
+			if size >= 60 {
+				extra := size - 59
+				if s+extra > len(src) {
+					return nil, fmt.Errorf("truncated snappy literal")
+				}
+				size = 0
+				for i := 0; i < extra; i++ {
+					size |= int(src[s+i]) << (8 * i)
+				}
+				s += extra
+			}
+			size++
+			if size > len(src)-s {
+				return nil, fmt.Errorf("truncated snappy literal")
+			}
+			dst = append(dst, src[s:s+size]...)
+			s += size
+			continue
+		case 1:
+			if s+2 > len(src) {
+				return nil, fmt.Errorf("truncated snappy copy")
+			}
+			size = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[s+1])
+			s += 2
+		case 2:
+			if s+3 > len(src) {
+				return nil, fmt.Errorf("truncated snappy copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case 3:
+			if s+5 > len(src) {
+				return nil, fmt.Errorf("truncated snappy copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, fmt.Errorf("invalid snappy copy offset")
+		}
+		// Copies may overlap their own output, so go byte by byte
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, fmt.Errorf("snappy block decoded to %d bytes, expected %d", len(dst), length)
+	}
+	return dst, nil
+}
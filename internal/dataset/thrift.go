@@ -0,0 +1,173 @@
+package dataset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// thriftStruct is a decoded Thrift struct, keyed by field ID. Values are int64,
+// bool, float64, []byte, []interface{} or thriftStruct.
+type thriftStruct map[int16]interface{}
+
+// i64 returns an integer field
+func (s thriftStruct) i64(id int16) (int64, bool) {
+	v, ok := s[id].(int64)
+	return v, ok
+}
+
+// bytes returns a binary field
+func (s thriftStruct) bytes(id int16) []byte {
+	v, _ := s[id].([]byte)
+	return v
+}
+
+// bool returns a boolean field, or def when it is not set
+func (s thriftStruct) bool(id int16, def bool) bool {
+	if v, ok := s[id].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// strct returns a struct field
+func (s thriftStruct) strct(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+// list returns a list field
+func (s thriftStruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// thriftReader decodes the Thrift compact protocol Parquet metadata is written in
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+// readStruct decodes a struct up to its stop field
+func (r *thriftReader) readStruct() (thriftStruct, error) {
+	s := thriftStruct{}
+	var last int16
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return s, nil
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, err := r.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(unzigzag(v))
+		}
+		last = id
+		if s[id], err = r.value(b & 0x0f); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// value decodes a value of the given compact type
+func (r *thriftReader) value(typ byte) (interface{}, error) {
+	switch typ {
+	case 1:
+		return true, nil
+	case 2:
+		return false, nil
+	case 3:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case 4, thriftTypeI32, thriftTypeI64:
+		v, err := r.uvarint()
+		return unzigzag(v), err
+	case 7:
+		if r.pos+8 > len(r.data) {
+			return nil, fmt.Errorf("truncated thrift double")
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.data[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case thriftTypeBinary:
+		n, err := r.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(r.data)-r.pos) {
+			return nil, fmt.Errorf("truncated thrift binary")
+		}
+		v := r.data[r.pos : r.pos+int(n)]
+		r.pos += int(n)
+		return v, nil
+	case thriftTypeList, 10:
+		return r.readList()
+	case thriftTypeStruct:
+		return r.readStruct()
+	default:
+		return nil, fmt.Errorf("unsupported thrift type %d", typ)
+	}
+}
+
+// readList decodes a list or set
+func (r *thriftReader) readList() ([]interface{}, error) {
+	header, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(header >> 4)
+	if size == 15 {
+		if size, err = r.uvarint(); err != nil {
+			return nil, err
+		}
+	}
+	if size > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("thrift list larger than its data")
+	}
+
+	elemType := header & 0x0f
+	items := make([]interface{}, 0, size)
+	for i := uint64(0); i < size; i++ {
+		var item interface{}
+		if elemType == 1 || elemType == 2 {
+			// Booleans in lists take a byte each rather than living in the type
+			b, err := r.byte()
+			if err != nil {
+				return nil, err
+			}
+			item = b == 1
+		} else if item, err = r.value(elemType); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, fmt.Errorf("truncated thrift data")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid thrift varint")
+	}
+	r.pos += n
+	return v, nil
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
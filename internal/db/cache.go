@@ -0,0 +1,148 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// unsafeFileChars matches characters left out of cache file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// MetadataCache keeps catalog results of one server on disk for a TTL, so repeated
+// size and table lookups against large catalogs skip pg_database_size and pg_class
+// scans. A connection with a cache set reads through it; the results may be as old
+// as the TTL.
+type MetadataCache struct {
+	path    string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is one cached result and when it was read from the server
+type cacheEntry struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// DefaultMetadataCacheDir returns the directory used when no cache directory is configured
+func DefaultMetadataCacheDir() string {
+	return filepath.Join(os.TempDir(), "postgres-db-fork", "cache")
+}
+
+// OpenMetadataCache opens the cache file of the server cfg points at. A missing or
+// unreadable file starts an empty cache.
+func OpenMetadataCache(dir string, cfg *config.DatabaseConfig, ttl time.Duration) *MetadataCache {
+	if dir == "" {
+		dir = DefaultMetadataCacheDir()
+	}
+	name := unsafeFileChars.ReplaceAllString(fmt.Sprintf("%s_%d_%s", cfg.Host, cfg.Port, cfg.Username), "_")
+	cache := &MetadataCache{
+		path:    filepath.Join(dir, name+".json"),
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Failed to read metadata cache %s: %v", cache.path, err)
+		}
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		logrus.Warnf("Ignoring corrupt metadata cache %s: %v", cache.path, err)
+		cache.entries = make(map[string]cacheEntry)
+	}
+	return cache
+}
+
+// Path returns the file the cache is kept in
+func (m *MetadataCache) Path() string {
+	return m.path
+}
+
+// get decodes the cached value for key into v, reporting whether a fresh one was found
+func (m *MetadataCache) get(key string, v interface{}) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || time.Since(entry.StoredAt) > m.ttl {
+		return false
+	}
+	if err := json.Unmarshal(entry.Value, v); err != nil {
+		logrus.Debugf("Ignoring unreadable metadata cache entry %s: %v", key, err)
+		return false
+	}
+	logrus.Debugf("Using cached %s from %s", key, entry.StoredAt.Format(time.RFC3339))
+	return true
+}
+
+// put stores v under key and saves the cache. Saving is best effort: a cache that
+// cannot be written only costs the next run a catalog query.
+func (m *MetadataCache) put(key string, v interface{}) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		logrus.Debugf("Not caching %s: %v", key, err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.entries[key] = cacheEntry{StoredAt: now, Value: value}
+	for k, entry := range m.entries {
+		if now.Sub(entry.StoredAt) > m.ttl {
+			delete(m.entries, k)
+		}
+	}
+	if err := m.save(); err != nil {
+		logrus.Warnf("Failed to save metadata cache %s: %v", m.path, err)
+	}
+}
+
+// save writes the cache through a temporary file, so concurrent runs never read a
+// partly written cache
+func (m *MetadataCache) save() error {
+	data, err := json.Marshal(m.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// cachedDatabase returns the name cached results of the connected database are kept under
+func (c *Connection) cachedDatabase() string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Database
+}
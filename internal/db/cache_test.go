@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCache_Persists(t *testing.T) {
+	dir := t.TempDir()
+	server := &config.DatabaseConfig{Host: "db.internal", Port: 5432, Username: "admin"}
+
+	cache := OpenMetadataCache(dir, server, time.Hour)
+	assert.Equal(t, filepath.Join(dir, "db.internal_5432_admin.json"), cache.Path())
+	cache.put("tables/app/public", []string{"orders", "users"})
+
+	var tables []string
+	require.True(t, OpenMetadataCache(dir, server, time.Hour).get("tables/app/public", &tables))
+	assert.Equal(t, []string{"orders", "users"}, tables)
+
+	other := &config.DatabaseConfig{Host: "db.internal", Port: 6543, Username: "admin"}
+	assert.False(t, OpenMetadataCache(dir, other, time.Hour).get("tables/app/public", &tables))
+}
+
+func TestMetadataCache_Expires(t *testing.T) {
+	cache := OpenMetadataCache(t.TempDir(), &config.DatabaseConfig{Host: "localhost", Port: 5432}, time.Hour)
+	cache.entries["database_size/app"] = cacheEntry{StoredAt: time.Now().Add(-2 * time.Hour), Value: []byte("42")}
+
+	var size int64
+	assert.False(t, cache.get("database_size/app", &size))
+}
+
+func TestConnection_GetDatabaseSizeContextCached(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	// Only the first lookup reaches the server
+	mock.ExpectQuery(`SELECT pg_database_size\(\$1\)`).
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(int64(4096)))
+
+	cfg := &config.DatabaseConfig{Host: "localhost", Port: 5432, Database: "postgres"}
+	conn := &Connection{DB: db, Config: cfg, Cache: OpenMetadataCache(t.TempDir(), cfg, time.Hour)}
+	for i := 0; i < 2; i++ {
+		size, err := conn.GetDatabaseSizeContext(context.Background(), "app")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4096), size)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
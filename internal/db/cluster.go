@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClusterIdentity identifies the PostgreSQL cluster behind a connection
+type ClusterIdentity struct {
+	// SystemIdentifier comes from pg_control and is unique per initdb
+	SystemIdentifier string `json:"system_identifier,omitempty"`
+	// The fallback fields identify a cluster when pg_control_system() is not readable
+	StartTime     string `json:"start_time"`
+	Version       string `json:"version"`
+	DataDirectory string `json:"data_directory,omitempty"`
+}
+
+// ClusterIdentity reads the identity of the connected cluster. The system identifier
+// and data directory need elevated privileges, so they are left empty when denied.
+func (c *Connection) ClusterIdentity() (ClusterIdentity, error) {
+	return c.ClusterIdentityContext(context.Background())
+}
+
+// ClusterIdentityContext reads the identity of the connected cluster
+func (c *Connection) ClusterIdentityContext(ctx context.Context) (ClusterIdentity, error) {
+	var id ClusterIdentity
+	if err := c.DB.QueryRowContext(ctx, "SELECT pg_postmaster_start_time()::text, version()").Scan(&id.StartTime, &id.Version); err != nil {
+		return id, fmt.Errorf("failed to read server identity: %w", err)
+	}
+	if err := c.DB.QueryRowContext(ctx, "SELECT system_identifier::text FROM pg_control_system()").Scan(&id.SystemIdentifier); err != nil {
+		logrus.Debugf("System identifier not readable, falling back to start time and version: %v", err)
+	}
+	if err := c.DB.QueryRowContext(ctx, "SELECT current_setting('data_directory', true)").Scan(&id.DataDirectory); err != nil {
+		logrus.Debugf("Data directory not readable: %v", err)
+	}
+	return id, nil
+}
+
+// SameCluster reports whether both identities belong to one cluster, comparing system
+// identifiers when both are known and start time, version and data directory otherwise
+func (id ClusterIdentity) SameCluster(other ClusterIdentity) bool {
+	if id.SystemIdentifier != "" && other.SystemIdentifier != "" {
+		return id.SystemIdentifier == other.SystemIdentifier
+	}
+	if id.StartTime != other.StartTime || id.Version != other.Version {
+		return false
+	}
+	if id.DataDirectory != "" && other.DataDirectory != "" {
+		return id.DataDirectory == other.DataDirectory
+	}
+	return true
+}
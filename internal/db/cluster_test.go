@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterIdentity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+
+	mock.ExpectQuery(`SELECT pg_postmaster_start_time\(\)::text, version\(\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"start", "version"}).AddRow("2026-10-01 09:00:00+00", "PostgreSQL 16.4"))
+	mock.ExpectQuery("SELECT system_identifier::text FROM pg_control_system").
+		WillReturnError(errors.New("permission denied for function pg_control_system"))
+	mock.ExpectQuery("SELECT current_setting").
+		WillReturnRows(sqlmock.NewRows([]string{"data_directory"}).AddRow("/var/lib/postgresql/data"))
+
+	id, err := conn.ClusterIdentity()
+	require.NoError(t, err)
+	assert.Equal(t, ClusterIdentity{
+		StartTime:     "2026-10-01 09:00:00+00",
+		Version:       "PostgreSQL 16.4",
+		DataDirectory: "/var/lib/postgresql/data",
+	}, id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClusterIdentity_SameCluster(t *testing.T) {
+	base := ClusterIdentity{SystemIdentifier: "7301", StartTime: "t1", Version: "16.4", DataDirectory: "/data"}
+
+	other := base
+	other.StartTime = "t2"
+	assert.True(t, base.SameCluster(other), "system identifiers decide when both are known")
+
+	other = base
+	other.SystemIdentifier = "7302"
+	assert.False(t, base.SameCluster(other))
+
+	// Without a system identifier on one side the fallback fields decide
+	other = base
+	other.SystemIdentifier = ""
+	assert.True(t, base.SameCluster(other))
+	other.DataDirectory = "/other"
+	assert.False(t, base.SameCluster(other))
+	other.DataDirectory = ""
+	assert.True(t, base.SameCluster(other))
+	other.StartTime = "t2"
+	assert.False(t, base.SameCluster(other))
+}
@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"syscall"
 	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
@@ -15,11 +18,48 @@ import (
 type Connection struct {
 	DB     *sql.DB
 	Config *config.DatabaseConfig
+	// Cache, when set, serves database sizes, table lists and table sizes from disk
+	Cache *MetadataCache
 }
 
 // NewConnection creates a new database connection
 func NewConnection(cfg *config.DatabaseConfig) (*Connection, error) {
-	db, err := sql.Open("postgres", cfg.ConnectionString())
+	return NewConnectionContext(context.Background(), cfg)
+}
+
+// NewConnectionContext creates a new database connection, bounding the initial ping by ctx.
+// The servers of a multi-host list are tried in order, as libpq does, and the first
+// that accepts the connection and matches target_session_attrs is used.
+func NewConnectionContext(ctx context.Context, cfg *config.DatabaseConfig) (*Connection, error) {
+	hosts, err := cfg.Hosts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+	passes := []string{cfg.TargetSessionAttrs}
+	if cfg.TargetSessionAttrs == "prefer-standby" {
+		passes = []string{"standby", "any"}
+	}
+
+	var errs []error
+	for _, attrs := range passes {
+		for _, host := range hosts {
+			conn, err := openHost(ctx, cfg, host, attrs)
+			if err == nil {
+				return conn, nil
+			}
+			if len(hosts) == 1 && len(passes) == 1 {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", host.Address(), err))
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to any of %s: %w", cfg.Address(), errors.Join(errs...))
+}
+
+// openHost connects to one server of the connection, checking it matches attrs
+func openHost(ctx context.Context, cfg *config.DatabaseConfig, host config.HostPort, attrs string) (*Connection, error) {
+	single := cfg.ForHost(host)
+	db, err := sql.Open("postgres", single.ConnectionString())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
@@ -29,15 +69,23 @@ func NewConnection(cfg *config.DatabaseConfig) (*Connection, error) {
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	// Test the connection
-	if err := db.Ping(); err != nil {
+	closeDB := func() {
 		if closeErr := db.Close(); closeErr != nil {
-			logrus.WithError(closeErr).Error("Failed to close database connection after ping failure")
+			logrus.WithError(closeErr).Error("Failed to close database connection")
 		}
+	}
+
+	// Test the connection
+	if err := db.PingContext(ctx); err != nil {
+		closeDB()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	if err := checkSessionAttrs(ctx, db, attrs); err != nil {
+		closeDB()
+		return nil, err
+	}
 
-	logrus.Debugf("Connected to PostgreSQL at %s:%d", cfg.Host, cfg.Port)
+	logrus.Debugf("Connected to PostgreSQL at %s", host.Address())
 
 	return &Connection{
 		DB:     db,
@@ -45,6 +93,33 @@ func NewConnection(cfg *config.DatabaseConfig) (*Connection, error) {
 	}, nil
 }
 
+// checkSessionAttrs reports whether the server suits target_session_attrs
+func checkSessionAttrs(ctx context.Context, db *sql.DB, attrs string) error {
+	if attrs == "" || attrs == "any" {
+		return nil
+	}
+	var inRecovery, readOnly bool
+	if err := db.QueryRowContext(ctx,
+		"SELECT pg_is_in_recovery(), current_setting('transaction_read_only') = 'on'").Scan(&inRecovery, &readOnly); err != nil {
+		return fmt.Errorf("failed to check server role: %w", err)
+	}
+	var ok bool
+	switch attrs {
+	case "read-write":
+		ok = !readOnly
+	case "read-only":
+		ok = readOnly
+	case "primary":
+		ok = !inRecovery
+	case "standby":
+		ok = inRecovery
+	}
+	if !ok {
+		return fmt.Errorf("server does not match target_session_attrs=%s", attrs)
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (c *Connection) Close() error {
 	if c.DB != nil {
@@ -55,9 +130,14 @@ func (c *Connection) Close() error {
 
 // DatabaseExists checks if a database exists
 func (c *Connection) DatabaseExists(dbName string) (bool, error) {
+	return c.DatabaseExistsContext(context.Background(), dbName)
+}
+
+// DatabaseExistsContext checks if a database exists
+func (c *Connection) DatabaseExistsContext(ctx context.Context, dbName string) (bool, error) {
 	query := "SELECT 1 FROM pg_database WHERE datname = $1"
 	var exists int
-	err := c.DB.QueryRow(query, dbName).Scan(&exists)
+	err := c.DB.QueryRowContext(ctx, query, dbName).Scan(&exists)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
@@ -69,8 +149,14 @@ func (c *Connection) DatabaseExists(dbName string) (bool, error) {
 
 // CreateDatabase creates a new database using template-based cloning
 func (c *Connection) CreateDatabase(targetDB, sourceDB string, dropIfExists bool) error {
+	return c.CreateDatabaseContext(context.Background(), targetDB, sourceDB, dropIfExists)
+}
+
+// CreateDatabaseContext creates a new database using template-based cloning. ctx bounds
+// every statement and the waits between retries.
+func (c *Connection) CreateDatabaseContext(ctx context.Context, targetDB, sourceDB string, dropIfExists bool) error {
 	if dropIfExists {
-		if err := c.DropDatabase(targetDB); err != nil {
+		if err := c.DropDatabaseContext(ctx, targetDB); err != nil {
 			logrus.WithError(err).Warnf("Could not drop existing database %s (may not exist)", targetDB)
 		}
 	}
@@ -82,20 +168,16 @@ func (c *Connection) CreateDatabase(targetDB, sourceDB string, dropIfExists bool
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		if attempt > 1 {
 			logrus.Debugf("Retry attempt %d/%d for creating database %s", attempt, maxRetries, targetDB)
-			time.Sleep(retryDelay)
+			if err := sleepContext(ctx, retryDelay); err != nil {
+				return fmt.Errorf("failed to create database %s: %w", targetDB, err)
+			}
 			retryDelay *= 2 // exponential backoff
 		}
 
-		query := fmt.Sprintf(
-			"CREATE DATABASE %s WITH TEMPLATE %s",
-			pq.QuoteIdentifier(targetDB),
-			pq.QuoteIdentifier(sourceDB),
-		)
-
-		_, err := c.DB.Exec(query)
+		err := c.CreateDatabaseOnceContext(ctx, targetDB, sourceDB)
 		if err != nil {
 			// Check if it's a "being accessed by other users" error
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "55006" {
+			if IsObjectInUse(err) {
 				if attempt < maxRetries {
 					logrus.Debugf("Source database %s is being accessed by other users, retrying... (attempt %d/%d)", sourceDB, attempt, maxRetries)
 					continue
@@ -111,8 +193,75 @@ func (c *Connection) CreateDatabase(targetDB, sourceDB string, dropIfExists bool
 	return fmt.Errorf("failed to create database %s after %d attempts: max retries exceeded", targetDB, maxRetries)
 }
 
+// CreateDatabaseOnceContext clones sourceDB into targetDB without retrying, for
+// callers that retry a source other sessions are connected to on their own
+func (c *Connection) CreateDatabaseOnceContext(ctx context.Context, targetDB, sourceDB string) error {
+	query := fmt.Sprintf(
+		"CREATE DATABASE %s WITH TEMPLATE %s",
+		pq.QuoteIdentifier(targetDB),
+		pq.QuoteIdentifier(sourceDB),
+	)
+	_, err := c.DB.ExecContext(ctx, query)
+	return err
+}
+
+// IsDuplicateDatabase reports whether err is PostgreSQL's duplicate_database error,
+// returned when CREATE DATABASE loses a race for the name
+func IsDuplicateDatabase(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P04"
+}
+
+// IsObjectInUse reports whether err is PostgreSQL's object_in_use error, returned
+// when CREATE DATABASE clones a template other sessions are connected to
+func IsObjectInUse(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "55006"
+}
+
+// IsNotReady reports whether err means the server does not accept connections yet:
+// it is starting up or recovering (cannot_connect_now), or nothing listens on its
+// port, as while a container or new instance boots
+func IsNotReady(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "57P03"
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// SessionsContext describes the other sessions connected to database, as their
+// application names and users
+func (c *Connection) SessionsContext(ctx context.Context, database string) ([]string, error) {
+	rows, err := c.DB.QueryContext(ctx, `
+		SELECT coalesce(nullif(application_name, ''), 'unnamed') || ' (' || coalesce(usename, 'unknown') || ')'
+		FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid()
+		ORDER BY backend_start`, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions of %s: %w", database, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sessions []string
+	for rows.Next() {
+		var session string
+		if err := rows.Scan(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
 // DropDatabase drops a database if it exists
 func (c *Connection) DropDatabase(dbName string) error {
+	return c.DropDatabaseContext(context.Background(), dbName)
+}
+
+// DropDatabaseContext drops a database if it exists. ctx bounds every statement and
+// the waits between retries.
+func (c *Connection) DropDatabaseContext(ctx context.Context, dbName string) error {
 	// Retry logic for database drops (handle concurrent connections)
 	maxRetries := 5
 	retryDelay := time.Millisecond * 500
@@ -120,7 +269,9 @@ func (c *Connection) DropDatabase(dbName string) error {
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		if attempt > 1 {
 			logrus.Debugf("Retry attempt %d/%d for dropping database %s", attempt, maxRetries, dbName)
-			time.Sleep(retryDelay)
+			if err := sleepContext(ctx, retryDelay); err != nil {
+				return fmt.Errorf("failed to drop database %s: %w", dbName, err)
+			}
 			retryDelay *= 2 // exponential backoff
 		}
 
@@ -130,23 +281,25 @@ func (c *Connection) DropDatabase(dbName string) error {
 			FROM pg_stat_activity
 			WHERE datname = $1 AND pid <> pg_backend_pid() AND state = 'active'`
 
-		result, err := c.DB.Exec(terminateQuery, dbName)
+		result, err := c.DB.ExecContext(ctx, terminateQuery, dbName)
 		if err != nil {
 			logrus.WithError(err).Debugf("Could not terminate connections to database %s (attempt %d)", dbName, attempt)
 		} else {
 			if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
 				logrus.Debugf("Terminated %d connections to database %s", rowsAffected, dbName)
 				// Give a moment for connections to actually terminate
-				time.Sleep(time.Millisecond * 100)
+				if err := sleepContext(ctx, time.Millisecond*100); err != nil {
+					return fmt.Errorf("failed to drop database %s: %w", dbName, err)
+				}
 			}
 		}
 
 		// Try to drop the database
 		query := fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName))
-		_, err = c.DB.Exec(query)
+		_, err = c.DB.ExecContext(ctx, query)
 		if err != nil {
 			// Check if it's a "being accessed by other users" error
-			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "55006" {
+			if IsObjectInUse(err) {
 				if attempt < maxRetries {
 					logrus.Debugf("Database %s is being accessed by other users, retrying... (attempt %d/%d)", dbName, attempt, maxRetries)
 					continue
@@ -162,18 +315,77 @@ func (c *Connection) DropDatabase(dbName string) error {
 	return fmt.Errorf("failed to drop database %s after %d attempts: max retries exceeded", dbName, maxRetries)
 }
 
+// sleepContext waits for d, returning early with ctx's error when it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // GetDatabaseSize returns the size of a database in bytes
 func (c *Connection) GetDatabaseSize(dbName string) (int64, error) {
+	return c.GetDatabaseSizeContext(context.Background(), dbName)
+}
+
+// GetDatabaseSizeContext returns the size of a database in bytes
+func (c *Connection) GetDatabaseSizeContext(ctx context.Context, dbName string) (int64, error) {
 	var size int64
+	key := "database_size/" + dbName
+	if c.Cache != nil && c.Cache.get(key, &size) {
+		return size, nil
+	}
 	query := "SELECT pg_database_size($1)"
-	err := c.DB.QueryRow(query, dbName).Scan(&size)
-	return size, err
+	if err := c.DB.QueryRowContext(ctx, query, dbName).Scan(&size); err != nil {
+		return 0, err
+	}
+	if c.Cache != nil {
+		c.Cache.put(key, size)
+	}
+	return size, nil
+}
+
+// DatabaseSizesContext returns the live size in bytes of every database on the server,
+// by name. Sizes are never served from the metadata cache, as quotas depend on them.
+func (c *Connection) DatabaseSizesContext(ctx context.Context) (map[string]int64, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT datname, pg_database_size(oid) FROM pg_database WHERE datallowconn")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database sizes: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan database size: %w", err)
+		}
+		sizes[name] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read database sizes: %w", err)
+	}
+	return sizes, nil
 }
 
 // GetVersion returns the PostgreSQL server version string
 func (c *Connection) GetVersion() (string, error) {
+	return c.GetVersionContext(context.Background())
+}
+
+// GetVersionContext returns the PostgreSQL server version string
+func (c *Connection) GetVersionContext(ctx context.Context) (string, error) {
 	var version string
-	err := c.DB.QueryRow("SHOW server_version").Scan(&version)
+	err := c.DB.QueryRowContext(ctx, "SHOW server_version").Scan(&version)
 	if err != nil {
 		return "", fmt.Errorf("failed to get server version: %w", err)
 	}
@@ -182,17 +394,28 @@ func (c *Connection) GetVersion() (string, error) {
 
 // GetTableList returns a list of tables in the database
 func (c *Connection) GetTableList(schemaName string) ([]string, error) {
+	return c.GetTableListContext(context.Background(), schemaName)
+}
+
+// GetTableListContext returns a list of tables in the database
+func (c *Connection) GetTableListContext(ctx context.Context, schemaName string) ([]string, error) {
 	if schemaName == "" {
 		schemaName = "public"
 	}
 
+	var tables []string
+	key := "tables/" + c.cachedDatabase() + "/" + schemaName
+	if c.Cache != nil && c.Cache.get(key, &tables) {
+		return tables, nil
+	}
+
 	query := `
 		SELECT tablename
 		FROM pg_tables
 		WHERE schemaname = $1
 		ORDER BY tablename`
 
-	rows, err := c.DB.Query(query, schemaName)
+	rows, err := c.DB.QueryContext(ctx, query, schemaName)
 	if err != nil {
 		return nil, err
 	}
@@ -202,7 +425,6 @@ func (c *Connection) GetTableList(schemaName string) ([]string, error) {
 		}
 	}()
 
-	var tables []string
 	for rows.Next() {
 		var tableName string
 		if err := rows.Scan(&tableName); err != nil {
@@ -210,19 +432,128 @@ func (c *Connection) GetTableList(schemaName string) ([]string, error) {
 		}
 		tables = append(tables, tableName)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return tables, rows.Err()
+	if c.Cache != nil {
+		c.Cache.put(key, tables)
+	}
+	return tables, nil
+}
+
+// GetTableSizes returns the total size in bytes of each table in the schema, indexes and TOAST included
+func (c *Connection) GetTableSizes(schemaName string) (map[string]int64, error) {
+	return c.GetTableSizesContext(context.Background(), schemaName)
+}
+
+// GetTableSizesContext returns the total size in bytes of each table in the schema,
+// indexes and TOAST included
+func (c *Connection) GetTableSizesContext(ctx context.Context, schemaName string) (map[string]int64, error) {
+	if schemaName == "" {
+		schemaName = "public"
+	}
+
+	sizes := make(map[string]int64)
+	key := "table_sizes/" + c.cachedDatabase() + "/" + schemaName
+	if c.Cache != nil && c.Cache.get(key, &sizes) {
+		return sizes, nil
+	}
+
+	query := `
+		SELECT tablename, pg_total_relation_size(format('%I.%I', schemaname, tablename)::regclass)
+		FROM pg_tables
+		WHERE schemaname = $1`
+
+	rows, err := c.DB.QueryContext(ctx, query, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var tableName string
+		var size int64
+		if err := rows.Scan(&tableName, &size); err != nil {
+			return nil, err
+		}
+		sizes[tableName] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.Cache != nil {
+		c.Cache.put(key, sizes)
+	}
+	return sizes, nil
+}
+
+// GetTableDataSizesContext returns the size in bytes of each user table's rows, heap
+// and TOAST without indexes, which is what a data dump reads. Tables in public are
+// keyed by name and those in other schemas by schema.table.
+func (c *Connection) GetTableDataSizesContext(ctx context.Context) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	key := "table_data_sizes/" + c.cachedDatabase()
+	if c.Cache != nil && c.Cache.get(key, &sizes) {
+		return sizes, nil
+	}
+
+	query := `
+		SELECT schemaname, tablename, pg_table_size(format('%I.%I', schemaname, tablename)::regclass)
+		FROM pg_tables
+		WHERE schemaname NOT IN ('pg_catalog', 'information_schema')`
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close rows")
+		}
+	}()
+
+	for rows.Next() {
+		var schemaName, tableName string
+		var size int64
+		if err := rows.Scan(&schemaName, &tableName, &size); err != nil {
+			return nil, err
+		}
+		if schemaName != "public" {
+			tableName = schemaName + "." + tableName
+		}
+		sizes[tableName] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.Cache != nil {
+		c.Cache.put(key, sizes)
+	}
+	return sizes, nil
 }
 
 // TerminateAllConnections terminates all connections to the specified database except for the current one
 func (c *Connection) TerminateAllConnections(dbName string) error {
+	return c.TerminateAllConnectionsContext(context.Background(), dbName)
+}
+
+// TerminateAllConnectionsContext terminates all connections to the specified database
+// except for the current one
+func (c *Connection) TerminateAllConnectionsContext(ctx context.Context, dbName string) error {
 	terminateSQL := `
 		SELECT pg_terminate_backend(pg_stat_activity.pid)
 		FROM pg_stat_activity
 		WHERE pg_stat_activity.datname = $1
 		  AND pid <> pg_backend_pid();
 	`
-	_, err := c.DB.Exec(terminateSQL, dbName)
+	_, err := c.DB.ExecContext(ctx, terminateSQL, dbName)
 	if err != nil {
 		return fmt.Errorf("failed to terminate connections for database %s: %w", dbName, err)
 	}
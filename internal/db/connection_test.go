@@ -1,12 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -211,6 +216,34 @@ func TestConnection_CreateDatabase(t *testing.T) {
 	}
 }
 
+func TestIsObjectInUse(t *testing.T) {
+	assert.True(t, IsObjectInUse(fmt.Errorf("create: %w", &pq.Error{Code: "55006"})))
+	assert.False(t, IsObjectInUse(&pq.Error{Code: "42P04"}))
+	assert.False(t, IsObjectInUse(nil))
+}
+
+func TestIsNotReady(t *testing.T) {
+	assert.True(t, IsNotReady(fmt.Errorf("ping: %w", &pq.Error{Code: "57P03", Message: "the database system is starting up"})))
+	assert.True(t, IsNotReady(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	assert.False(t, IsNotReady(&pq.Error{Code: "28P01"}))
+	assert.False(t, IsNotReady(nil))
+}
+
+func TestConnection_SessionsContext(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	mock.ExpectQuery("FROM pg_stat_activity").WithArgs("myapp").
+		WillReturnRows(sqlmock.NewRows([]string{"session"}).AddRow("datadog-agent (monitor)"))
+
+	conn := &Connection{DB: mockDB}
+	sessions, err := conn.SessionsContext(context.Background(), "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"datadog-agent (monitor)"}, sessions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestConnection_DropDatabase(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -283,6 +316,35 @@ func TestConnection_DropDatabase(t *testing.T) {
 	}
 }
 
+func TestConnection_DropDatabaseContextCancelled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+
+	// The database is busy, so the drop would be retried after a backoff
+	mock.ExpectExec("SELECT pg_terminate_backend\\(pid\\)").
+		WithArgs("busy_db").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP DATABASE IF EXISTS "busy_db"`).
+		WillReturnError(&pq.Error{Code: "55006"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = conn.DropDatabaseContext(ctx, "busy_db")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "the retry backoff should stop at the deadline")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestConnection_GetDatabaseSize(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -351,6 +413,25 @@ func TestConnection_GetDatabaseSize(t *testing.T) {
 	}
 }
 
+func TestConnection_DatabaseSizes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	mock.ExpectQuery("SELECT datname, pg_database_size\\(oid\\) FROM pg_database").
+		WillReturnRows(sqlmock.NewRows([]string{"datname", "size"}).AddRow("app", 2048).AddRow("app_pr_1", 1024))
+
+	conn := &Connection{DB: db, Config: &config.DatabaseConfig{Database: "postgres"}}
+	sizes, err := conn.DatabaseSizesContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"app": 2048, "app_pr_1": 1024}, sizes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestConnection_GetTableList(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// CurrentWALLSN returns the primary's current write-ahead log position
+func (c *Connection) CurrentWALLSN(ctx context.Context) (string, error) {
+	var lsn string
+	if err := c.DB.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&lsn); err != nil {
+		return "", fmt.Errorf("failed to read the current WAL position: %w", err)
+	}
+	return lsn, nil
+}
+
+// SlotLagContext returns how many bytes of WAL up to lsn the subscriber of a logical
+// replication slot has yet to confirm; zero or less means it has caught up
+func (c *Connection) SlotLagContext(ctx context.Context, slot, lsn string) (int64, error) {
+	var lag sql.NullInt64
+	query := "SELECT pg_wal_lsn_diff($2::pg_lsn, confirmed_flush_lsn)::bigint FROM pg_replication_slots WHERE slot_name = $1"
+	err := c.DB.QueryRowContext(ctx, query, slot, lsn).Scan(&lag)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("replication slot %s does not exist", slot)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the lag of replication slot %s: %w", slot, err)
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("replication slot %s has not confirmed any changes yet", slot)
+	}
+	return lag.Int64, nil
+}
+
+// ReplayLagContext returns how many bytes of WAL up to lsn a standby has yet to
+// replay; zero or less means it has caught up
+func (c *Connection) ReplayLagContext(ctx context.Context, lsn string) (int64, error) {
+	var lag sql.NullInt64
+	query := "SELECT pg_wal_lsn_diff($1::pg_lsn, pg_last_wal_replay_lsn())::bigint"
+	if err := c.DB.QueryRowContext(ctx, query, lsn).Scan(&lag); err != nil {
+		return 0, fmt.Errorf("failed to read the replay lag: %w", err)
+	}
+	if !lag.Valid {
+		return 0, fmt.Errorf("the server is not replaying WAL")
+	}
+	return lag.Int64, nil
+}
+
+// SubscriptionPendingTablesContext returns how many tables of a subscription have
+// not finished their initial copy
+func (c *Connection) SubscriptionPendingTablesContext(ctx context.Context, name string) (int, error) {
+	var exists bool
+	if err := c.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_subscription WHERE subname = $1)", name).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to look up subscription %s: %w", name, err)
+	}
+	if !exists {
+		return 0, fmt.Errorf("subscription %s does not exist", name)
+	}
+
+	var pending int
+	query := `
+		SELECT count(*)
+		FROM pg_subscription_rel r
+		JOIN pg_subscription s ON s.oid = r.srsubid
+		WHERE s.subname = $1 AND r.srsubstate <> 'r'`
+	if err := c.DB.QueryRowContext(ctx, query, name).Scan(&pending); err != nil {
+		return 0, fmt.Errorf("failed to read the state of subscription %s: %w", name, err)
+	}
+	return pending, nil
+}
+
+// DetachSubscriptionContext stops and drops a subscription, leaving its slot on the
+// publisher to be dropped there
+func (c *Connection) DetachSubscriptionContext(ctx context.Context, name string) error {
+	quoted := pq.QuoteIdentifier(name)
+	for _, statement := range []string{
+		"ALTER SUBSCRIPTION " + quoted + " DISABLE",
+		"ALTER SUBSCRIPTION " + quoted + " SET (slot_name = NONE)",
+		"DROP SUBSCRIPTION " + quoted,
+	} {
+		if _, err := c.DB.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to detach subscription %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// PromoteContext promotes a standby to a primary, waiting up to a minute for it to
+// accept writes
+func (c *Connection) PromoteContext(ctx context.Context) error {
+	var promoted bool
+	if err := c.DB.QueryRowContext(ctx, "SELECT pg_promote(true, 60)").Scan(&promoted); err != nil {
+		return fmt.Errorf("failed to promote the standby: %w", err)
+	}
+	if !promoted {
+		return fmt.Errorf("the standby did not finish promotion within 60 seconds")
+	}
+	return nil
+}
+
+// SetRoleLoginContext allows or bars a role from logging in
+func (c *Connection) SetRoleLoginContext(ctx context.Context, role string, login bool) error {
+	attribute := "NOLOGIN"
+	if login {
+		attribute = "LOGIN"
+	}
+	if _, err := c.DB.ExecContext(ctx, "ALTER ROLE "+pq.QuoteIdentifier(role)+" "+attribute); err != nil {
+		return fmt.Errorf("failed to set %s on role %s: %w", attribute, role, err)
+	}
+	return nil
+}
+
+// TerminateRoleSessionsContext ends the sessions of role connected to database and
+// returns how many it ended
+func (c *Connection) TerminateRoleSessionsContext(ctx context.Context, role, database string) (int, error) {
+	var terminated int
+	query := `
+		SELECT count(*) FILTER (WHERE pg_terminate_backend(pid))
+		FROM pg_stat_activity
+		WHERE usename = $1 AND datname = $2 AND pid <> pg_backend_pid()`
+	if err := c.DB.QueryRowContext(ctx, query, role, database).Scan(&terminated); err != nil {
+		return 0, fmt.Errorf("failed to end the sessions of role %s: %w", role, err)
+	}
+	return terminated, nil
+}
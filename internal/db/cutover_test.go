@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_Cutover(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT pg_wal_lsn_diff\(\$2::pg_lsn, confirmed_flush_lsn\)::bigint FROM pg_replication_slots`).
+		WithArgs("pgfork_live", "0/16B3748").
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(512))
+	lag, err := conn.SlotLagContext(ctx, "pgfork_live", "0/16B3748")
+	require.NoError(t, err)
+	assert.Equal(t, int64(512), lag)
+
+	mock.ExpectQuery(`FROM pg_replication_slots`).
+		WithArgs("pgfork_gone", "0/16B3748").
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}))
+	_, err = conn.SlotLagContext(ctx, "pgfork_gone", "0/16B3748")
+	assert.EqualError(t, err, "replication slot pgfork_gone does not exist")
+
+	mock.ExpectExec(`ALTER SUBSCRIPTION "pgfork_live" DISABLE`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER SUBSCRIPTION "pgfork_live" SET \(slot_name = NONE\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP SUBSCRIPTION "pgfork_live"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.DetachSubscriptionContext(ctx, "pgfork_live"))
+
+	mock.ExpectExec(`ALTER ROLE "app_rw" NOLOGIN`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.SetRoleLoginContext(ctx, "app_rw", false))
+
+	mock.ExpectQuery(`FROM pg_stat_activity`).
+		WithArgs("app_rw", "app").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	terminated, err := conn.TerminateRoleSessionsContext(ctx, "app_rw", "app")
+	require.NoError(t, err)
+	assert.Equal(t, 3, terminated)
+
+	mock.ExpectQuery(`SELECT pg_promote\(true, 60\)`).WillReturnRows(sqlmock.NewRows([]string{"pg_promote"}).AddRow(false))
+	assert.Error(t, conn.PromoteContext(ctx))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnection_SubscriptionPendingTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery(`FROM pg_subscription WHERE subname`).
+		WithArgs("pgfork_live").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`FROM pg_subscription_rel`).
+		WithArgs("pgfork_live").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	pending, err := conn.SubscriptionPendingTablesContext(ctx, "pgfork_live")
+	require.NoError(t, err)
+	assert.Equal(t, 2, pending)
+
+	mock.ExpectQuery(`FROM pg_subscription WHERE subname`).
+		WithArgs("pgfork_gone").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	_, err = conn.SubscriptionPendingTablesContext(ctx, "pgfork_gone")
+	assert.EqualError(t, err, "subscription pgfork_gone does not exist")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
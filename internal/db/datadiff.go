@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// TableDataDiff counts the rows that differ between two copies of a table, matched
+// by primary key
+type TableDataDiff struct {
+	Table string `json:"table"`
+	RowsA int64  `json:"rows_a"`
+	RowsB int64  `json:"rows_b"`
+	// Added rows are only in the second table, removed rows only in the first, and
+	// changed rows in both with different values
+	Added   int64 `json:"added"`
+	Removed int64 `json:"removed"`
+	Changed int64 `json:"changed"`
+	// Buckets is how many key hash buckets the rows were split into; only buckets
+	// whose checksums differ are compared row by row
+	Buckets          int `json:"buckets"`
+	DifferingBuckets int `json:"differing_buckets"`
+}
+
+// Identical reports whether the two tables hold the same rows
+func (d *TableDataDiff) Identical() bool {
+	return d.Added == 0 && d.Removed == 0 && d.Changed == 0
+}
+
+// rowBucket is the row count and checksum of one key hash bucket
+type rowBucket struct {
+	rows     int64
+	checksum string
+}
+
+// PrimaryKeyColumnsContext returns the primary key columns of a table, in key order
+func (c *Connection) PrimaryKeyColumnsContext(ctx context.Context, k PrimaryKey) ([]string, error) {
+	query := `
+		SELECT a.attname
+		FROM pg_index x
+		JOIN pg_attribute a ON a.attrelid = x.indrelid AND a.attnum = ANY (x.indkey)
+		WHERE x.indrelid = $1::regclass AND x.indisprimary
+		ORDER BY array_position(x.indkey::int2[], a.attnum)`
+
+	rows, err := c.DB.QueryContext(ctx, query, k.QualifiedName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read primary key of %s: %w", k.QualifiedName(), err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key column: %w", err)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read primary key of %s: %w", k.QualifiedName(), err)
+	}
+	return columns, nil
+}
+
+// rowDigest holds the SQL expressions that identify and checksum the rows of a table
+type rowDigest struct {
+	table   string
+	key     string
+	orderBy string
+	bucket  string
+}
+
+// newRowDigest builds the expressions for a table keyed by columns, with rows split
+// into the given number of buckets by a hash of their key
+func newRowDigest(k PrimaryKey, columns []string, buckets int) rowDigest {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "t." + pq.QuoteIdentifier(column)
+	}
+	key := fmt.Sprintf("ROW(%s)::text", strings.Join(quoted, ", "))
+	return rowDigest{
+		table:   k.QualifiedName(),
+		key:     key,
+		orderBy: strings.Join(quoted, ", "),
+		// hashtext is a signed 32-bit hash; shift it to be non-negative
+		bucket: fmt.Sprintf("mod(hashtext(%s)::bigint + 2147483648, %d)", key, buckets),
+	}
+}
+
+// bucketsContext returns the row count and checksum of every non-empty bucket
+func (c *Connection) bucketsContext(ctx context.Context, d rowDigest) (map[int64]rowBucket, error) {
+	query := fmt.Sprintf("SELECT %s, count(*), md5(string_agg(md5(t::text), '' ORDER BY %s)) FROM %s t GROUP BY 1",
+		d.bucket, d.orderBy, d.table)
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum %s: %w", d.table, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	buckets := make(map[int64]rowBucket)
+	for rows.Next() {
+		var id int64
+		var b rowBucket
+		if err := rows.Scan(&id, &b.rows, &b.checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan checksum of %s: %w", d.table, err)
+		}
+		buckets[id] = b
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to checksum %s: %w", d.table, err)
+	}
+	return buckets, nil
+}
+
+// rowHashesContext returns the hash of every row in the given buckets, by key
+func (c *Connection) rowHashesContext(ctx context.Context, d rowDigest, buckets []int64) (map[string]string, error) {
+	query := fmt.Sprintf("SELECT %s, md5(t::text) FROM %s t WHERE %s = ANY ($1)", d.key, d.table, d.bucket)
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(buckets))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rows of %s: %w", d.table, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var key, hash string
+		if err := rows.Scan(&key, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan row of %s: %w", d.table, err)
+		}
+		hashes[key] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows of %s: %w", d.table, err)
+	}
+	return hashes, nil
+}
+
+// DiffTableDataContext compares the rows of a table in two databases by primary key.
+// Both sides are first checksummed per key hash bucket, so identical tables cost one
+// aggregate query each and only the rows of differing buckets are read back.
+func DiffTableDataContext(ctx context.Context, a, b *Connection, k PrimaryKey, buckets int) (*TableDataDiff, error) {
+	columnsA, err := a.PrimaryKeyColumnsContext(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	columnsB, err := b.PrimaryKeyColumnsContext(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	if len(columnsA) == 0 {
+		return nil, fmt.Errorf("%s has no primary key", k.QualifiedName())
+	}
+	if strings.Join(columnsA, ",") != strings.Join(columnsB, ",") {
+		return nil, fmt.Errorf("primary key of %s differs: (%s) and (%s)", k.QualifiedName(),
+			strings.Join(columnsA, ", "), strings.Join(columnsB, ", "))
+	}
+
+	d := newRowDigest(k, columnsA, buckets)
+	bucketsA, err := a.bucketsContext(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	bucketsB, err := b.bucketsContext(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &TableDataDiff{Table: k.Schema + "." + k.Table, Buckets: buckets}
+	for _, bucket := range bucketsA {
+		diff.RowsA += bucket.rows
+	}
+	for _, bucket := range bucketsB {
+		diff.RowsB += bucket.rows
+	}
+	differing := differingBuckets(bucketsA, bucketsB)
+	diff.DifferingBuckets = len(differing)
+	if len(differing) == 0 {
+		return diff, nil
+	}
+
+	rowsA, err := a.rowHashesContext(ctx, d, differing)
+	if err != nil {
+		return nil, err
+	}
+	rowsB, err := b.rowHashesContext(ctx, d, differing)
+	if err != nil {
+		return nil, err
+	}
+	diff.Added, diff.Removed, diff.Changed = compareRows(rowsA, rowsB)
+	return diff, nil
+}
+
+// differingBuckets returns the buckets whose row count or checksum differ, or that
+// exist on one side only, sorted
+func differingBuckets(a, b map[int64]rowBucket) []int64 {
+	var differing []int64
+	for id, bucket := range a {
+		if other, ok := b[id]; !ok || other != bucket {
+			differing = append(differing, id)
+		}
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			differing = append(differing, id)
+		}
+	}
+	sort.Slice(differing, func(i, j int) bool { return differing[i] < differing[j] })
+	return differing
+}
+
+// compareRows counts the keys only in b, only in a, and in both with different hashes
+func compareRows(a, b map[string]string) (added, removed, changed int64) {
+	for key, hash := range a {
+		other, ok := b[key]
+		switch {
+		case !ok:
+			removed++
+		case other != hash:
+			changed++
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			added++
+		}
+	}
+	return added, removed, changed
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockConnection returns a connection backed by sqlmock, closed with the test
+func newMockConnection(t *testing.T) (*Connection, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	})
+	return &Connection{DB: db}, mock
+}
+
+func TestDiffTableDataContext(t *testing.T) {
+	a, mockA := newMockConnection(t)
+	b, mockB := newMockConnection(t)
+	key := PrimaryKey{Schema: "public", Table: "order_items", Index: "order_items_pkey"}
+
+	for _, mock := range []sqlmock.Sqlmock{mockA, mockB} {
+		mock.ExpectQuery("FROM pg_index x").WithArgs(`"public"."order_items"`).
+			WillReturnRows(sqlmock.NewRows([]string{"attname"}).AddRow("order_id").AddRow("line"))
+	}
+	bucketQuery := `SELECT mod\(hashtext\(ROW\(t."order_id", t."line"\)::text\)::bigint \+ 2147483648, 4\), count\(\*\), ` +
+		`md5\(string_agg\(md5\(t::text\), '' ORDER BY t."order_id", t."line"\)\) FROM "public"."order_items" t GROUP BY 1`
+	mockA.ExpectQuery(bucketQuery).WillReturnRows(sqlmock.NewRows([]string{"bucket", "count", "md5"}).
+		AddRow(0, 10, "aaa").AddRow(1, 5, "bbb").AddRow(3, 2, "ddd"))
+	mockB.ExpectQuery(bucketQuery).WillReturnRows(sqlmock.NewRows([]string{"bucket", "count", "md5"}).
+		AddRow(0, 10, "aaa").AddRow(1, 5, "xxx").AddRow(2, 1, "ccc"))
+
+	rowQuery := `SELECT ROW\(t."order_id", t."line"\)::text, md5\(t::text\) FROM "public"."order_items" t WHERE mod\(.*, 4\) = ANY \(\$1\)`
+	mockA.ExpectQuery(rowQuery).WithArgs(pq.Array([]int64{1, 2, 3})).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "md5"}).
+			AddRow("(1,1)", "h1").AddRow("(1,2)", "h2").AddRow("(2,1)", "h3").AddRow("(3,1)", "h4").
+			AddRow("(3,2)", "h5").AddRow("(4,1)", "h6").AddRow("(4,2)", "h7"))
+	mockB.ExpectQuery(rowQuery).WithArgs(pq.Array([]int64{1, 2, 3})).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "md5"}).
+			AddRow("(1,1)", "h1").AddRow("(1,2)", "changed").AddRow("(2,1)", "h3").AddRow("(3,1)", "h4").
+			AddRow("(3,2)", "h5").AddRow("(5,1)", "h8"))
+
+	diff, err := DiffTableDataContext(context.Background(), a, b, key, 4)
+	require.NoError(t, err)
+	assert.Equal(t, &TableDataDiff{
+		Table:            "public.order_items",
+		RowsA:            17,
+		RowsB:            16,
+		Added:            1,
+		Removed:          2,
+		Changed:          1,
+		Buckets:          4,
+		DifferingBuckets: 3,
+	}, diff)
+	assert.False(t, diff.Identical())
+
+	assert.NoError(t, mockA.ExpectationsWereMet())
+	assert.NoError(t, mockB.ExpectationsWereMet())
+}
+
+func TestDiffTableDataContext_PrimaryKeyMismatch(t *testing.T) {
+	a, mockA := newMockConnection(t)
+	b, mockB := newMockConnection(t)
+
+	mockA.ExpectQuery("FROM pg_index x").WillReturnRows(sqlmock.NewRows([]string{"attname"}).AddRow("id"))
+	mockB.ExpectQuery("FROM pg_index x").WillReturnRows(sqlmock.NewRows([]string{"attname"}).AddRow("uuid"))
+
+	_, err := DiffTableDataContext(context.Background(), a, b, PrimaryKey{Schema: "public", Table: "users"}, 16)
+	assert.ErrorContains(t, err, "primary key of \"public\".\"users\" differs: (id) and (uuid)")
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// GradualDropOptions controls how a large database is emptied before it is dropped
+type GradualDropOptions struct {
+	// MinTableSize is the size in bytes from which a table is emptied on its own;
+	// smaller tables are left to DROP DATABASE
+	MinTableSize int64
+	// Pause is the wait between tables, giving the server time to absorb the I/O
+	Pause time.Duration
+	// Progress, when set, is called after each table is emptied
+	Progress func(DropProgress)
+}
+
+// DropProgress reports one emptied table during a gradual drop
+type DropProgress struct {
+	Database string
+	Table    string
+	Size     int64
+	Done     int
+	Total    int
+}
+
+// largeTable is a table or leaf partition that a gradual drop empties on its own
+type largeTable struct {
+	schema    string
+	name      string
+	size      int64
+	partition bool
+}
+
+// GradualDropDatabaseContext drops a database after emptying its large tables one at
+// a time, largest first. Dropping a multi-terabyte database unlinks all of its files
+// at once, which can stall the whole cluster; emptying tables separately, with a
+// pause between them, spreads that work out. Leaf partitions are dropped and other
+// tables truncated. Each table is emptied in its own statement, so an interrupted
+// drop resumes where it stopped when run again.
+func (c *Connection) GradualDropDatabaseContext(ctx context.Context, name string, opts GradualDropOptions) error {
+	exists, err := c.DatabaseExistsContext(ctx, name)
+	if err != nil || !exists {
+		return err
+	}
+
+	targetConfig := c.Config.WithDatabase(name)
+	target, err := NewConnectionContext(ctx, &targetConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", name, err)
+	}
+	err = target.emptyLargeTables(ctx, name, opts)
+	// Close before dropping, as the connection would block the drop
+	if closeErr := target.Close(); closeErr != nil {
+		logrus.Warnf("Failed to close connection to %s: %v", name, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	return c.DropDatabaseContext(ctx, name)
+}
+
+// emptyLargeTables empties the connected database's tables of at least
+// opts.MinTableSize bytes, largest first
+func (c *Connection) emptyLargeTables(ctx context.Context, database string, opts GradualDropOptions) error {
+	tables, err := c.largeTables(ctx, opts.MinTableSize)
+	if err != nil {
+		return err
+	}
+
+	for i, table := range tables {
+		if i > 0 {
+			if err := sleepContext(ctx, opts.Pause); err != nil {
+				return fmt.Errorf("gradual drop of %s interrupted: %w", database, err)
+			}
+		}
+
+		qualified := pq.QuoteIdentifier(table.schema) + "." + pq.QuoteIdentifier(table.name)
+		statement := "TRUNCATE " + qualified + " CASCADE"
+		if table.partition {
+			statement = "DROP TABLE IF EXISTS " + qualified + " CASCADE"
+		}
+		if _, err := c.DB.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to empty %s.%s: %w", table.schema, table.name, err)
+		}
+		logrus.Debugf("Emptied %s.%s (%d bytes) in %s", table.schema, table.name, table.size, database)
+
+		if opts.Progress != nil {
+			opts.Progress(DropProgress{
+				Database: database,
+				Table:    table.schema + "." + table.name,
+				Size:     table.size,
+				Done:     i + 1,
+				Total:    len(tables),
+			})
+		}
+	}
+	return nil
+}
+
+// largeTables returns the tables and leaf partitions of at least minSize bytes,
+// including their indexes and TOAST data, largest first
+func (c *Connection) largeTables(ctx context.Context, minSize int64) ([]largeTable, error) {
+	query := `
+		SELECT n.nspname, c.relname, pg_total_relation_size(c.oid), c.relispartition
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND pg_total_relation_size(c.oid) >= $1
+		ORDER BY pg_total_relation_size(c.oid) DESC`
+
+	rows, err := c.DB.QueryContext(ctx, query, minSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list large tables: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var tables []largeTable
+	for rows.Next() {
+		var t largeTable
+		if err := rows.Scan(&t.schema, &t.name, &t.size, &t.partition); err != nil {
+			return nil, fmt.Errorf("failed to scan large table: %w", err)
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
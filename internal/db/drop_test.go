@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_EmptyLargeTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	mock.ExpectQuery(`pg_total_relation_size\(c.oid\) >= \$1`).
+		WithArgs(int64(1 << 30)).
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname", "size", "relispartition"}).
+			AddRow("public", "events_2024", int64(5<<30), true).
+			AddRow("public", "orders", int64(2<<30), false))
+	mock.ExpectExec(`DROP TABLE IF EXISTS "public"."events_2024" CASCADE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`TRUNCATE "public"."orders" CASCADE`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var progress []DropProgress
+	conn := &Connection{DB: db}
+	err = conn.emptyLargeTables(context.Background(), "big", GradualDropOptions{
+		MinTableSize: 1 << 30,
+		Progress:     func(p DropProgress) { progress = append(progress, p) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []DropProgress{
+		{Database: "big", Table: "public.events_2024", Size: 5 << 30, Done: 1, Total: 2},
+		{Database: "big", Table: "public.orders", Size: 2 << 30, Done: 2, Total: 2},
+	}, progress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExtensionsContext returns the extensions installed in the connected database and
+// their versions, by name
+func (c *Connection) ExtensionsContext(ctx context.Context) (map[string]string, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT extname, extversion FROM pg_extension")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	extensions := make(map[string]string)
+	for rows.Next() {
+		var name, version string
+		if err := rows.Scan(&name, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan extension: %w", err)
+		}
+		extensions[name] = version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w", err)
+	}
+	return extensions, nil
+}
+
+// ExtensionAvailableContext reports whether the server can install the given version
+// of an extension
+func (c *Connection) ExtensionAvailableContext(ctx context.Context, name, version string) (bool, error) {
+	var available bool
+	query := "SELECT EXISTS (SELECT 1 FROM pg_available_extension_versions WHERE name = $1 AND version = $2)"
+	if err := c.DB.QueryRowContext(ctx, query, name, version).Scan(&available); err != nil {
+		return false, fmt.Errorf("failed to check availability of extension %s: %w", name, err)
+	}
+	return available, nil
+}
+
+// CitusTablesContext counts the distributed and reference tables in the Citus metadata
+// of the connected database
+func (c *Connection) CitusTablesContext(ctx context.Context) (distributed, reference int, err error) {
+	query := `
+		SELECT count(*) FILTER (WHERE partmethod <> 'n'),
+		       count(*) FILTER (WHERE partmethod = 'n')
+		FROM pg_dist_partition`
+	if err := c.DB.QueryRowContext(ctx, query).Scan(&distributed, &reference); err != nil {
+		return 0, 0, fmt.Errorf("failed to read Citus metadata: %w", err)
+	}
+	return distributed, reference, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_Extensions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery("SELECT extname, extversion FROM pg_extension").
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"}).
+			AddRow("plpgsql", "1.0").
+			AddRow("timescaledb", "2.14.2"))
+	extensions, err := conn.ExtensionsContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"plpgsql": "1.0", "timescaledb": "2.14.2"}, extensions)
+
+	mock.ExpectQuery("FROM pg_available_extension_versions").
+		WithArgs("timescaledb", "2.14.2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	available, err := conn.ExtensionAvailableContext(ctx, "timescaledb", "2.14.2")
+	require.NoError(t, err)
+	assert.False(t, available)
+
+	mock.ExpectQuery("FROM pg_dist_partition").
+		WillReturnRows(sqlmock.NewRows([]string{"distributed", "reference"}).AddRow(3, 2))
+	distributed, reference, err := conn.CitusTablesContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, distributed)
+	assert.Equal(t, 2, reference)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// schemaFingerprintQuery hashes the definitions a schema-only dump is made of: schemas,
+// relations, columns, constraints, indexes, views, functions, triggers, types,
+// policies, sequences and extensions outside the system schemas. Any DDL that changes
+// one of them changes the hash.
+const schemaFingerprintQuery = `
+	WITH ns AS (
+		SELECT oid FROM pg_namespace
+		WHERE nspname <> 'information_schema' AND nspname !~ '^pg_'
+	)
+	SELECT md5(COALESCE(string_agg(def, E'\n' ORDER BY def), '')) FROM (
+		SELECT 'schema ' || n.nspname AS def
+		FROM pg_namespace n WHERE n.oid IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'relation ' || c.oid::regclass || ' ' || c.relkind || ' ' || c.relpersistence || ' ' || c.relrowsecurity
+		FROM pg_class c WHERE c.relnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'column ' || a.attrelid::regclass || ' ' || a.attnum || ' ' || a.attname || ' ' ||
+		       format_type(a.atttypid, a.atttypmod) || ' ' || a.attnotnull || ' ' ||
+		       COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attnum > 0 AND NOT a.attisdropped AND c.relnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'constraint ' || co.conrelid::regclass || ' ' || co.contypid::regtype || ' ' || co.conname || ' ' ||
+		       pg_get_constraintdef(co.oid)
+		FROM pg_constraint co WHERE co.connamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'index ' || pg_get_indexdef(i.indexrelid)
+		FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE c.relnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'view ' || c.oid::regclass || ' ' || md5(pg_get_viewdef(c.oid))
+		FROM pg_class c WHERE c.relkind IN ('v', 'm') AND c.relnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'function ' || p.oid::regprocedure || ' ' || p.prorettype::regtype || ' ' ||
+		       p.provolatile || ' ' || md5(COALESCE(p.prosrc, ''))
+		FROM pg_proc p WHERE p.pronamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'trigger ' || pg_get_triggerdef(t.oid)
+		FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid
+		WHERE NOT t.tgisinternal AND c.relnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'type ' || t.oid::regtype || ' ' || t.typtype || ' ' || format_type(t.typbasetype, t.typtypmod) || ' ' ||
+		       COALESCE((SELECT string_agg(e.enumlabel, ',' ORDER BY e.enumsortorder)
+		                 FROM pg_enum e WHERE e.enumtypid = t.oid), '')
+		FROM pg_type t WHERE t.typtype IN ('d', 'e', 'r') AND t.typnamespace IN (SELECT oid FROM ns)
+		UNION ALL
+		SELECT 'policy ' || pol.polrelid::regclass || ' ' || pol.polname || ' ' || pol.polcmd || ' ' ||
+		       COALESCE(pg_get_expr(pol.polqual, pol.polrelid), '') || ' ' ||
+		       COALESCE(pg_get_expr(pol.polwithcheck, pol.polrelid), '')
+		FROM pg_policy pol
+		UNION ALL
+		SELECT 'sequence ' || s.seqrelid::regclass || ' ' || s.seqtypid::regtype || ' ' || s.seqstart || ' ' ||
+		       s.seqincrement || ' ' || s.seqmin || ' ' || s.seqmax || ' ' || s.seqcycle
+		FROM pg_sequence s
+		UNION ALL
+		SELECT 'extension ' || x.extname || ' ' || x.extversion
+		FROM pg_extension x
+	) defs`
+
+// SchemaFingerprintContext returns a hash of the connected database's schema, which
+// changes with any DDL that a schema-only dump would capture. It is never served from
+// the metadata cache, as it decides whether cached schema dumps are still current.
+func (c *Connection) SchemaFingerprintContext(ctx context.Context) (string, error) {
+	var fingerprint string
+	if err := c.DB.QueryRowContext(ctx, schemaFingerprintQuery).Scan(&fingerprint); err != nil {
+		return "", fmt.Errorf("failed to fingerprint schema: %w", err)
+	}
+	return fingerprint, nil
+}
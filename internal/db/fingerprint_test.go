@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_SchemaFingerprint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+
+	mock.ExpectQuery(`SELECT md5\(COALESCE\(string_agg\(def`).
+		WillReturnRows(sqlmock.NewRows([]string{"md5"}).AddRow("0cc175b9c0f1b6a831c399e269772661"))
+	fingerprint, err := conn.SchemaFingerprintContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "0cc175b9c0f1b6a831c399e269772661", fingerprint)
+
+	mock.ExpectQuery(`SELECT md5`).WillReturnError(errors.New("permission denied"))
+	_, err = conn.SchemaFingerprintContext(context.Background())
+	assert.ErrorContains(t, err, "failed to fingerprint schema: permission denied")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
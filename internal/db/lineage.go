@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// lineageCommentPrefix starts the COMMENT ON DATABASE that records where a fork came
+// from; the rest of the comment is the lineage as JSON
+const lineageCommentPrefix = "pgfork lineage: "
+
+// Lineage records how a database was forked, so that an unknown database on a shared
+// server can be traced back to its source and the job that made it
+type Lineage struct {
+	Source      string    `json:"source"`
+	SourceHost  string    `json:"source_host,omitempty"`
+	ToolVersion string    `json:"tool_version,omitempty"`
+	JobID       string    `json:"job_id,omitempty"`
+	ForkedAt    time.Time `json:"forked_at"`
+	// PullRequest is the pull request a PR fork was made for
+	PullRequest int `json:"pull_request,omitempty"`
+	// ExpiresAt is when a fork with a TTL may be dropped
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// CI is the pipeline run that made the fork
+	CI *config.CIProvenance `json:"ci,omitempty"`
+	// Team owns the fork, and its size counts against the team's quota
+	Team string `json:"team,omitempty"`
+}
+
+// Expired reports whether the fork had a TTL that has passed
+func (l Lineage) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && now.After(*l.ExpiresAt)
+}
+
+// SetLineageContext records the lineage of a database in its comment, replacing any
+// existing comment
+func (c *Connection) SetLineageContext(ctx context.Context, database string, lineage Lineage) error {
+	data, err := json.Marshal(lineage)
+	if err != nil {
+		return fmt.Errorf("failed to encode lineage: %w", err)
+	}
+	query := fmt.Sprintf("COMMENT ON DATABASE %s IS %s",
+		pq.QuoteIdentifier(database), pq.QuoteLiteral(lineageCommentPrefix+string(data)))
+	if _, err := c.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to record lineage of %s: %w", database, err)
+	}
+	return nil
+}
+
+// LineagesContext returns the recorded lineage of every database that has one, by name
+func (c *Connection) LineagesContext(ctx context.Context) (map[string]Lineage, error) {
+	query := `
+		SELECT d.datname, shobj_description(d.oid, 'pg_database')
+		FROM pg_database d
+		WHERE shobj_description(d.oid, 'pg_database') LIKE $1`
+
+	rows, err := c.DB.QueryContext(ctx, query, lineageCommentPrefix+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database lineage: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	lineages := make(map[string]Lineage)
+	for rows.Next() {
+		var name, comment string
+		if err := rows.Scan(&name, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan database lineage: %w", err)
+		}
+		lineage, ok := parseLineage(comment)
+		if !ok {
+			logrus.Debugf("Ignoring unreadable lineage comment on %s", name)
+			continue
+		}
+		lineages[name] = lineage
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read database lineage: %w", err)
+	}
+	return lineages, nil
+}
+
+// parseLineage reads back the comment written by SetLineageContext
+func parseLineage(comment string) (Lineage, bool) {
+	data, ok := strings.CutPrefix(comment, lineageCommentPrefix)
+	if !ok {
+		return Lineage{}, false
+	}
+	var lineage Lineage
+	if err := json.Unmarshal([]byte(data), &lineage); err != nil {
+		return Lineage{}, false
+	}
+	return lineage, true
+}
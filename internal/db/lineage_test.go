@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_SetLineageContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	lineage := Lineage{
+		Source:      "myapp",
+		SourceHost:  "prod:5432",
+		ToolVersion: "1.2.0",
+		JobID:       "fork-1700000000",
+		ForkedAt:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	mock.ExpectExec(`COMMENT ON DATABASE "myapp_pr_1" IS 'pgfork lineage: \{"source":"myapp","source_host":"prod:5432","tool_version":"1.2.0","job_id":"fork-1700000000","forked_at":"2024-03-01T12:00:00Z"\}'`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	conn := &Connection{DB: db}
+	require.NoError(t, conn.SetLineageContext(context.Background(), "myapp_pr_1", lineage))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnection_LineagesContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	mock.ExpectQuery(`SELECT d.datname, shobj_description`).
+		WithArgs(`pgfork lineage: %`).
+		WillReturnRows(sqlmock.NewRows([]string{"datname", "comment"}).
+			AddRow("myapp_pr_1", `pgfork lineage: {"source":"myapp","job_id":"ci-42","forked_at":"2024-03-01T12:00:00Z"}`).
+			AddRow("myapp_pr_2", "pgfork lineage: not json"))
+
+	conn := &Connection{DB: db}
+	lineages, err := conn.LineagesContext(context.Background())
+	require.NoError(t, err)
+	require.Len(t, lineages, 1)
+	assert.Equal(t, "myapp", lineages["myapp_pr_1"].Source)
+	assert.Equal(t, "ci-42", lineages["myapp_pr_1"].JobID)
+	assert.True(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Equal(lineages["myapp_pr_1"].ForkedAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLineage_Expired(t *testing.T) {
+	now := time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.False(t, Lineage{}.Expired(now))
+	assert.True(t, Lineage{ExpiresAt: &past}.Expired(now))
+	assert.False(t, Lineage{ExpiresAt: &future}.Expired(now))
+}
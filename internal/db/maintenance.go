@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// TableHealth holds the vacuum-related statistics of a table
+type TableHealth struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	SizeBytes  int64  `json:"size_bytes"`
+	LiveTuples int64  `json:"live_tuples"`
+	DeadTuples int64  `json:"dead_tuples"`
+	// XIDAge is the age of the table's oldest unfrozen transaction ID
+	XIDAge int64 `json:"xid_age"`
+	// NeverVacuumed is set when no manual or automatic vacuum has run since the load,
+	// so every loaded row still has to be frozen
+	NeverVacuumed bool `json:"never_vacuumed"`
+}
+
+// QualifiedName returns the quoted schema-qualified table name
+func (t TableHealth) QualifiedName() string {
+	return pq.QuoteIdentifier(t.Schema) + "." + pq.QuoteIdentifier(t.Table)
+}
+
+// TableHealthReport returns the statistics of the largest tables, largest first
+func (c *Connection) TableHealthReport(limit int) ([]TableHealth, error) {
+	query := `
+		SELECT n.nspname, c.relname, pg_total_relation_size(c.oid),
+		       COALESCE(s.n_live_tup, 0), COALESCE(s.n_dead_tup, 0), age(c.relfrozenxid),
+		       s.last_vacuum IS NULL AND s.last_autovacuum IS NULL
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+		WHERE c.relkind IN ('r', 'm')
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		ORDER BY pg_total_relation_size(c.oid) DESC
+		LIMIT $1`
+
+	rows, err := c.DB.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close rows")
+		}
+	}()
+
+	var tables []TableHealth
+	for rows.Next() {
+		var t TableHealth
+		if err := rows.Scan(&t.Schema, &t.Table, &t.SizeBytes, &t.LiveTuples, &t.DeadTuples, &t.XIDAge, &t.NeverVacuumed); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// DatabaseXIDAge returns the age of the connected database's oldest unfrozen transaction ID
+func (c *Connection) DatabaseXIDAge() (int64, error) {
+	var age int64
+	if err := c.DB.QueryRow("SELECT age(datfrozenxid) FROM pg_database WHERE datname = current_database()").Scan(&age); err != nil {
+		return 0, fmt.Errorf("failed to read database age: %w", err)
+	}
+	return age, nil
+}
+
+// FreezeMaxAge returns autovacuum_freeze_max_age, the table age at which PostgreSQL
+// forces an anti-wraparound vacuum
+func (c *Connection) FreezeMaxAge() (int64, error) {
+	var value string
+	if err := c.DB.QueryRow("SHOW autovacuum_freeze_max_age").Scan(&value); err != nil {
+		return 0, fmt.Errorf("failed to read autovacuum_freeze_max_age: %w", err)
+	}
+	age, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid autovacuum_freeze_max_age %q: %w", value, err)
+	}
+	return age, nil
+}
+
+// VacuumFreeze freezes and analyzes the table; it cannot run inside a transaction
+func (c *Connection) VacuumFreeze(table TableHealth) error {
+	if _, err := c.DB.Exec("VACUUM (FREEZE, ANALYZE) " + table.QualifiedName()); err != nil {
+		return fmt.Errorf("failed to vacuum %s.%s: %w", table.Schema, table.Table, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableHealthReport(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+
+	mock.ExpectQuery("SELECT n.nspname, c.relname, pg_total_relation_size").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"schema", "table", "size", "live", "dead", "age", "never"}).
+			AddRow("public", "events", 1<<30, 5000000, 0, 1200, true).
+			AddRow("public", "users", 1<<20, 1000, 400, 900, false))
+
+	tables, err := conn.TableHealthReport(2)
+	require.NoError(t, err)
+	require.Len(t, tables, 2)
+	assert.Equal(t, TableHealth{
+		Schema: "public", Table: "events", SizeBytes: 1 << 30, LiveTuples: 5000000, XIDAge: 1200, NeverVacuumed: true,
+	}, tables[0])
+	assert.Equal(t, int64(400), tables[1].DeadTuples)
+
+	mock.ExpectQuery("SHOW autovacuum_freeze_max_age").
+		WillReturnRows(sqlmock.NewRows([]string{"autovacuum_freeze_max_age"}).AddRow("200000000"))
+	freezeMaxAge, err := conn.FreezeMaxAge()
+	require.NoError(t, err)
+	assert.Equal(t, int64(200000000), freezeMaxAge)
+
+	mock.ExpectExec(`VACUUM \(FREEZE, ANALYZE\) "public"."events"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.VacuumFreeze(tables[0]))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// PrimaryKey is a table and the index of its primary key
+type PrimaryKey struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Index is empty when the table has no primary key
+	Index string `json:"index,omitempty"`
+}
+
+// QualifiedName returns the quoted schema-qualified table name
+func (k PrimaryKey) QualifiedName() string {
+	return pq.QuoteIdentifier(k.Schema) + "." + pq.QuoteIdentifier(k.Table)
+}
+
+// PrimaryKeysContext lists the user tables of the connected database with their
+// primary key index, sorted by name. Tables belonging to extensions are left out.
+func (c *Connection) PrimaryKeysContext(ctx context.Context) ([]PrimaryKey, error) {
+	query := `
+		SELECT n.nspname, c.relname, COALESCE(i.relname, '')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_index x ON x.indrelid = c.oid AND x.indisprimary
+		LEFT JOIN pg_class i ON i.oid = x.indexrelid
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e')
+		ORDER BY n.nspname, c.relname`
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var keys []PrimaryKey
+	for rows.Next() {
+		var k PrimaryKey
+		if err := rows.Scan(&k.Schema, &k.Table, &k.Index); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list primary keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ClusterContext rewrites the table in primary key order. The index is then unmarked
+// as the table's clustering index, so the schema still matches the source's.
+func (c *Connection) ClusterContext(ctx context.Context, k PrimaryKey) error {
+	table := k.QualifiedName()
+	statement := fmt.Sprintf("CLUSTER %s USING %s", table, pq.QuoteIdentifier(k.Index))
+	if _, err := c.DB.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("failed to order %s by its primary key: %w", table, err)
+	}
+	if _, err := c.DB.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s SET WITHOUT CLUSTER", table)); err != nil {
+		return fmt.Errorf("failed to unmark clustering index of %s: %w", table, err)
+	}
+	return nil
+}
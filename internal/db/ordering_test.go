@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_PrimaryKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery("LEFT JOIN pg_index x ON x.indrelid = c.oid AND x.indisprimary").
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname", "index"}).
+			AddRow("public", "audit_log", "").
+			AddRow("public", "Orders", "Orders_pkey"))
+	keys, err := conn.PrimaryKeysContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []PrimaryKey{
+		{Schema: "public", Table: "audit_log"},
+		{Schema: "public", Table: "Orders", Index: "Orders_pkey"},
+	}, keys)
+
+	mock.ExpectExec(`CLUSTER "public"."Orders" USING "Orders_pkey"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "public"."Orders" SET WITHOUT CLUSTER`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.ClusterContext(ctx, keys[1]))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// WALLevel returns the server's wal_level; logical replication needs "logical"
+func (c *Connection) WALLevel(ctx context.Context) (string, error) {
+	var level string
+	if err := c.DB.QueryRowContext(ctx, "SHOW wal_level").Scan(&level); err != nil {
+		return "", fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	return level, nil
+}
+
+// CreatePublication publishes the given tables, or every table when none are given
+func (c *Connection) CreatePublication(ctx context.Context, name string, tables []string) error {
+	if _, err := c.DB.ExecContext(ctx, publicationSQL(name, tables)); err != nil {
+		return fmt.Errorf("failed to create publication %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropPublication drops a publication if it exists
+func (c *Connection) DropPublication(ctx context.Context, name string) error {
+	if _, err := c.DB.ExecContext(ctx, "DROP PUBLICATION IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to drop publication %s: %w", name, err)
+	}
+	return nil
+}
+
+// CreateReplicationSlot creates a logical replication slot using the pgoutput plugin
+// and returns the LSN it starts from
+func (c *Connection) CreateReplicationSlot(ctx context.Context, name string) (string, error) {
+	var lsn string
+	query := "SELECT lsn::text FROM pg_create_logical_replication_slot($1, 'pgoutput')"
+	if err := c.DB.QueryRowContext(ctx, query, name).Scan(&lsn); err != nil {
+		return "", fmt.Errorf("failed to create replication slot %s: %w", name, err)
+	}
+	return lsn, nil
+}
+
+// DropReplicationSlot drops a replication slot if it exists
+func (c *Connection) DropReplicationSlot(ctx context.Context, name string) error {
+	query := "SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = $1"
+	if _, err := c.DB.ExecContext(ctx, query, name); err != nil {
+		return fmt.Errorf("failed to drop replication slot %s: %w", name, err)
+	}
+	return nil
+}
+
+// CreateSubscription subscribes the connected database to a publication through an
+// existing slot. conninfo is how this server reaches the publisher. The initial
+// table copy starts in the background once the subscription exists.
+func (c *Connection) CreateSubscription(ctx context.Context, name, conninfo, publication, slot string) error {
+	query := fmt.Sprintf(
+		"CREATE SUBSCRIPTION %s CONNECTION %s PUBLICATION %s WITH (create_slot = false, slot_name = %s, copy_data = true)",
+		pq.QuoteIdentifier(name),
+		pq.QuoteLiteral(conninfo),
+		pq.QuoteIdentifier(publication),
+		pq.QuoteLiteral(slot),
+	)
+	if _, err := c.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create subscription %s: %w", name, err)
+	}
+	return nil
+}
+
+// publicationSQL builds CREATE PUBLICATION for schema-qualified or plain table names
+func publicationSQL(name string, tables []string) string {
+	if len(tables) == 0 {
+		return fmt.Sprintf("CREATE PUBLICATION %s FOR ALL TABLES", pq.QuoteIdentifier(name))
+	}
+	quoted := make([]string, 0, len(tables))
+	for _, table := range tables {
+		parts := strings.SplitN(table, ".", 2)
+		for i := range parts {
+			parts[i] = pq.QuoteIdentifier(parts[i])
+		}
+		quoted = append(quoted, strings.Join(parts, "."))
+	}
+	return fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", pq.QuoteIdentifier(name), strings.Join(quoted, ", "))
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicationSQL(t *testing.T) {
+	assert.Equal(t, `CREATE PUBLICATION "pgfork_live" FOR ALL TABLES`, publicationSQL("pgfork_live", nil))
+	assert.Equal(t,
+		`CREATE PUBLICATION "pgfork_live" FOR TABLE "orders", "billing"."Invoices"`,
+		publicationSQL("pgfork_live", []string{"orders", "billing.Invoices"}))
+}
+
+func TestConnection_Replication(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery("SHOW wal_level").WillReturnRows(sqlmock.NewRows([]string{"wal_level"}).AddRow("logical"))
+	level, err := conn.WALLevel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "logical", level)
+
+	mock.ExpectQuery(`SELECT lsn::text FROM pg_create_logical_replication_slot\(\$1, 'pgoutput'\)`).
+		WithArgs("pgfork_live").
+		WillReturnRows(sqlmock.NewRows([]string{"lsn"}).AddRow("0/16B3748"))
+	lsn, err := conn.CreateReplicationSlot(ctx, "pgfork_live")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3748", lsn)
+
+	mock.ExpectExec(`CREATE SUBSCRIPTION "pgfork_live" CONNECTION 'host=prod dbname=app' PUBLICATION "pgfork_live" WITH \(create_slot = false, slot_name = 'pgfork_live', copy_data = true\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.CreateSubscription(ctx, "pgfork_live", "host=prod dbname=app", "pgfork_live", "pgfork_live"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// SequenceStatus compares a sequence with the column it feeds
+type SequenceStatus struct {
+	Sequence string `json:"sequence"`
+	Table    string `json:"table"`
+	Column   string `json:"column"`
+	// NextValue is the value nextval() will return
+	NextValue int64 `json:"next_value"`
+	// DataValue is the largest value in the column, or the smallest for descending sequences
+	DataValue int64 `json:"data_value"`
+	Increment int64 `json:"increment"`
+	// AtRisk is set when nextval() would return a value already in use
+	AtRisk bool `json:"at_risk"`
+	Fixed  bool `json:"fixed,omitempty"`
+
+	// empty is set when the column holds no values
+	empty                        bool
+	sequenceSchema, sequenceName string
+	tableSchema, tableName       string
+}
+
+// ownedSequencesQuery lists sequences owned by a column: serial columns ('a') and
+// identity columns ('i'). last_value is NULL until nextval() is first called.
+const ownedSequencesQuery = `
+	SELECT seq_ns.nspname, seq.relname, tbl_ns.nspname, tbl.relname, a.attname,
+	       COALESCE(ps.last_value + ps.increment_by, ps.start_value), ps.increment_by
+	FROM pg_class seq
+	JOIN pg_namespace seq_ns ON seq_ns.oid = seq.relnamespace
+	JOIN pg_depend d ON d.objid = seq.oid
+	     AND d.classid = 'pg_class'::regclass
+	     AND d.refclassid = 'pg_class'::regclass
+	     AND d.deptype IN ('a', 'i')
+	JOIN pg_class tbl ON tbl.oid = d.refobjid
+	JOIN pg_namespace tbl_ns ON tbl_ns.oid = tbl.relnamespace
+	JOIN pg_attribute a ON a.attrelid = tbl.oid AND a.attnum = d.refobjsubid
+	JOIN pg_sequences ps ON ps.schemaname = seq_ns.nspname AND ps.sequencename = seq.relname
+	WHERE seq.relkind = 'S'
+	ORDER BY seq_ns.nspname, seq.relname`
+
+// CheckSequences compares every column-owned sequence with the data in its column.
+// A sequence is at risk when its next value is not beyond the column's maximum (or
+// minimum, for descending sequences), as happens after partial or data-only restores.
+func (c *Connection) CheckSequences() ([]SequenceStatus, error) {
+	rows, err := c.DB.Query(ownedSequencesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to close rows")
+		}
+	}()
+
+	var sequences []SequenceStatus
+	for rows.Next() {
+		var s SequenceStatus
+		if err := rows.Scan(&s.sequenceSchema, &s.sequenceName, &s.tableSchema, &s.tableName, &s.Column,
+			&s.NextValue, &s.Increment); err != nil {
+			return nil, err
+		}
+		s.Sequence = s.sequenceSchema + "." + s.sequenceName
+		s.Table = s.tableSchema + "." + s.tableName
+		sequences = append(sequences, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range sequences {
+		if err := c.checkSequence(&sequences[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sequences, nil
+}
+
+// checkSequence reads the column's extreme value and flags the sequence if it collides
+func (c *Connection) checkSequence(s *SequenceStatus) error {
+	aggregate := "max"
+	if s.Increment < 0 {
+		aggregate = "min"
+	}
+	query := fmt.Sprintf("SELECT %s(%s)::bigint FROM %s.%s", aggregate,
+		pq.QuoteIdentifier(s.Column), pq.QuoteIdentifier(s.tableSchema), pq.QuoteIdentifier(s.tableName))
+
+	var value *int64
+	if err := c.DB.QueryRow(query).Scan(&value); err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", s.Table, s.Column, err)
+	}
+	if value == nil {
+		// An empty table cannot collide
+		s.empty = true
+		return nil
+	}
+
+	s.DataValue = *value
+	if s.Increment > 0 {
+		s.AtRisk = s.NextValue <= s.DataValue
+	} else {
+		s.AtRisk = s.NextValue >= s.DataValue
+	}
+	return nil
+}
+
+// FixSequence moves the sequence past the column's data, so the next value is the
+// data value plus one increment
+func (c *Connection) FixSequence(s *SequenceStatus) error {
+	name := pq.QuoteIdentifier(s.sequenceSchema) + "." + pq.QuoteIdentifier(s.sequenceName)
+	if _, err := c.DB.Exec("SELECT setval($1::regclass, $2, true)", name, s.DataValue); err != nil {
+		return fmt.Errorf("failed to fix sequence %s: %w", s.Sequence, err)
+	}
+
+	logrus.Infof("Sequence %s now continues after %d", s.Sequence, s.DataValue)
+	s.NextValue = s.DataValue + s.Increment
+	s.AtRisk = false
+	s.Fixed = true
+	return nil
+}
+
+// ResetSequence sets the sequence from its column alone, discarding values the
+// source used up without keeping: past the column's data, or back to its start
+// value when the column is empty. Forks of the same data then agree on every
+// sequence.
+func (c *Connection) ResetSequence(s *SequenceStatus) error {
+	if !s.empty {
+		return c.FixSequence(s)
+	}
+	name := pq.QuoteIdentifier(s.sequenceSchema) + "." + pq.QuoteIdentifier(s.sequenceName)
+	if _, err := c.DB.Exec("SELECT setval(seqrelid, seqstart, false) FROM pg_sequence WHERE seqrelid = $1::regclass", name); err != nil {
+		return fmt.Errorf("failed to reset sequence %s: %w", s.Sequence, err)
+	}
+	s.AtRisk = false
+	s.Fixed = true
+	return nil
+}
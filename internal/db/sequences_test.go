@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSequences(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+
+	mock.ExpectQuery("SELECT seq_ns.nspname, seq.relname").
+		WillReturnRows(sqlmock.NewRows([]string{"seq_schema", "seq", "tbl_schema", "tbl", "column", "next", "increment"}).
+			AddRow("public", "orders_id_seq", "public", "orders", "id", 5, 1).
+			AddRow("public", "users_id_seq", "public", "users", "id", 101, 1).
+			AddRow("public", "events_id_seq", "public", "events", "id", 1, 1).
+			AddRow("public", "countdown_seq", "public", "countdown", "n", -10, -1))
+	mock.ExpectQuery(`SELECT max\("id"\)::bigint FROM "public"."orders"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(40))
+	mock.ExpectQuery(`SELECT max\("id"\)::bigint FROM "public"."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(100))
+	mock.ExpectQuery(`SELECT max\("id"\)::bigint FROM "public"."events"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectQuery(`SELECT min\("n"\)::bigint FROM "public"."countdown"`).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(-12))
+
+	sequences, err := conn.CheckSequences()
+	require.NoError(t, err)
+	require.Len(t, sequences, 4)
+
+	assert.Equal(t, "public.orders_id_seq", sequences[0].Sequence)
+	assert.Equal(t, "public.orders", sequences[0].Table)
+	assert.Equal(t, int64(40), sequences[0].DataValue)
+	assert.True(t, sequences[0].AtRisk)
+	assert.False(t, sequences[1].AtRisk)
+	assert.False(t, sequences[2].AtRisk)
+	assert.True(t, sequences[3].AtRisk)
+
+	mock.ExpectExec(`SELECT setval\(\$1::regclass, \$2, true\)`).
+		WithArgs(`"public"."orders_id_seq"`, int64(40)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, conn.FixSequence(&sequences[0]))
+	assert.Equal(t, int64(41), sequences[0].NextValue)
+	assert.True(t, sequences[0].Fixed)
+	assert.False(t, sequences[0].AtRisk)
+
+	mock.ExpectExec(`SELECT setval\(seqrelid, seqstart, false\) FROM pg_sequence`).
+		WithArgs(`"public"."events_id_seq"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, conn.ResetSequence(&sequences[2]))
+	assert.True(t, sequences[2].Fixed)
+
+	mock.ExpectExec(`SELECT setval\(\$1::regclass, \$2, true\)`).
+		WithArgs(`"public"."users_id_seq"`, int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, conn.ResetSequence(&sequences[1]))
+	assert.Equal(t, int64(101), sequences[1].NextValue)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DatabaseSettings are properties of a database set with ALTER DATABASE. Unset
+// fields leave a property as it is.
+type DatabaseSettings struct {
+	Owner string
+	// ConnectionLimit caps concurrent connections, -1 for no cap
+	ConnectionLimit *int
+	// IsTemplate lets any user with CREATEDB clone the database, and stops it from
+	// being dropped until it is unset
+	IsTemplate *bool
+}
+
+// Empty reports whether the settings change nothing
+func (s DatabaseSettings) Empty() bool {
+	return s.Owner == "" && s.ConnectionLimit == nil && s.IsTemplate == nil
+}
+
+// Describe lists the settings for people
+func (s DatabaseSettings) Describe() string {
+	var parts []string
+	if s.Owner != "" {
+		parts = append(parts, "owner "+s.Owner)
+	}
+	if s.ConnectionLimit != nil {
+		parts = append(parts, fmt.Sprintf("connection limit %d", *s.ConnectionLimit))
+	}
+	if s.IsTemplate != nil {
+		parts = append(parts, fmt.Sprintf("is_template %t", *s.IsTemplate))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AlterDatabaseContext applies settings to database. The owner is changed first, in
+// a statement of its own, as it needs membership in the new owner's role.
+func (c *Connection) AlterDatabaseContext(ctx context.Context, database string, settings DatabaseSettings) error {
+	name := pq.QuoteIdentifier(database)
+	if settings.Owner != "" {
+		if _, err := c.DB.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", name, pq.QuoteIdentifier(settings.Owner))); err != nil {
+			return fmt.Errorf("failed to change owner of %s to %s: %w", database, settings.Owner, err)
+		}
+	}
+
+	var options []string
+	if settings.ConnectionLimit != nil {
+		options = append(options, fmt.Sprintf("CONNECTION LIMIT %d", *settings.ConnectionLimit))
+	}
+	if settings.IsTemplate != nil {
+		options = append(options, fmt.Sprintf("IS_TEMPLATE %t", *settings.IsTemplate))
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	if _, err := c.DB.ExecContext(ctx, fmt.Sprintf("ALTER DATABASE %s WITH %s", name, strings.Join(options, " "))); err != nil {
+		return fmt.Errorf("failed to alter database %s: %w", database, err)
+	}
+	return nil
+}
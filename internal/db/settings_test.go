@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_AlterDatabaseContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+	conn := &Connection{DB: db}
+
+	limit, template := 10, true
+	mock.ExpectExec(`ALTER DATABASE "app_pr_1" OWNER TO "app_owner"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER DATABASE "app_pr_1" WITH CONNECTION LIMIT 10 IS_TEMPLATE true`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, conn.AlterDatabaseContext(context.Background(), "app_pr_1", DatabaseSettings{
+		Owner: "app_owner", ConnectionLimit: &limit, IsTemplate: &template,
+	}))
+
+	// Nothing to change runs nothing
+	require.NoError(t, conn.AlterDatabaseContext(context.Background(), "app_pr_1", DatabaseSettings{}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDatabaseSettings_Describe(t *testing.T) {
+	limit := 0
+	settings := DatabaseSettings{Owner: "app_owner", ConnectionLimit: &limit}
+	assert.False(t, settings.Empty())
+	assert.Equal(t, "owner app_owner, connection limit 0", settings.Describe())
+	assert.True(t, DatabaseSettings{}.Empty())
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StandbyStatus describes whether the connected server is a read-only standby, and
+// the settings deciding when its queries are cancelled by recovery conflicts
+type StandbyStatus struct {
+	InRecovery bool `json:"in_recovery"`
+	// HotStandbyFeedback makes the primary keep the rows standby queries still need,
+	// which avoids most cancellations at the cost of bloat on the primary
+	HotStandbyFeedback bool `json:"hot_standby_feedback"`
+	// MaxStandbyStreamingDelay is how long replay waits for conflicting queries
+	// before cancelling them; negative means it waits forever
+	MaxStandbyStreamingDelay time.Duration `json:"max_standby_streaming_delay"`
+}
+
+// CancelsQueries reports whether long queries risk being cancelled by recovery
+// conflicts with replay
+func (s StandbyStatus) CancelsQueries() bool {
+	return s.InRecovery && s.MaxStandbyStreamingDelay >= 0
+}
+
+// StandbyStatusContext reads whether the server is in recovery and its standby settings
+func (c *Connection) StandbyStatusContext(ctx context.Context) (StandbyStatus, error) {
+	var status StandbyStatus
+	var feedback string
+	var delay int64
+	query := `
+		SELECT pg_is_in_recovery(),
+		       current_setting('hot_standby_feedback'),
+		       (SELECT setting::bigint FROM pg_settings WHERE name = 'max_standby_streaming_delay')`
+	if err := c.DB.QueryRowContext(ctx, query).Scan(&status.InRecovery, &feedback, &delay); err != nil {
+		return status, fmt.Errorf("failed to read recovery status: %w", err)
+	}
+	status.HotStandbyFeedback = feedback == "on"
+	// The setting is in milliseconds, with -1 for waiting forever
+	status.MaxStandbyStreamingDelay = time.Duration(delay) * time.Millisecond
+	if delay < 0 {
+		status.MaxStandbyStreamingDelay = -1
+	}
+	return status, nil
+}
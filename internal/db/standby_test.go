@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection_StandbyStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	conn := &Connection{DB: db}
+	ctx := context.Background()
+	columns := []string{"pg_is_in_recovery", "hot_standby_feedback", "max_standby_streaming_delay"}
+
+	mock.ExpectQuery(`SELECT pg_is_in_recovery\(\)`).WillReturnRows(sqlmock.NewRows(columns).AddRow(true, "off", 30000))
+	status, err := conn.StandbyStatusContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, StandbyStatus{InRecovery: true, MaxStandbyStreamingDelay: 30 * time.Second}, status)
+	assert.True(t, status.CancelsQueries())
+
+	mock.ExpectQuery(`SELECT pg_is_in_recovery\(\)`).WillReturnRows(sqlmock.NewRows(columns).AddRow(true, "on", -1))
+	status, err = conn.StandbyStatusContext(ctx)
+	require.NoError(t, err)
+	assert.True(t, status.HotStandbyFeedback)
+	assert.False(t, status.CancelsQueries())
+
+	mock.ExpectQuery(`SELECT pg_is_in_recovery\(\)`).WillReturnRows(sqlmock.NewRows(columns).AddRow(false, "off", 30000))
+	status, err = conn.StandbyStatusContext(ctx)
+	require.NoError(t, err)
+	assert.False(t, status.CancelsQueries())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
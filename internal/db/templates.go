@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// TemplateCachePrefix starts the name of every cached template database
+const TemplateCachePrefix = "pgfork_tpl_"
+
+// templateCommentPrefix starts the COMMENT ON DATABASE that records a cached
+// template's source and build time; databases without it are not treated as caches
+const templateCommentPrefix = "pgfork template cache:"
+
+// CachedTemplate is a template database holding a copy of a source database, so
+// branches can be cloned from it without disconnecting the source's sessions. Caches
+// do not accept connections, so nothing can block a clone from them.
+type CachedTemplate struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// Age returns how long ago the template was built
+func (t CachedTemplate) Age() time.Duration {
+	return time.Since(t.CreatedAt)
+}
+
+// TemplateCacheName returns the name of the cached template for a source database
+func TemplateCacheName(source string) string {
+	return truncateName(TemplateCachePrefix+source, 63)
+}
+
+// truncateName shortens a name to at most n bytes without splitting a character
+func truncateName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	name = name[:n]
+	for !utf8.ValidString(name) {
+		name = name[:len(name)-1]
+	}
+	return name
+}
+
+// ListCachedTemplates returns the cached templates on the server, oldest first
+func (c *Connection) ListCachedTemplates(ctx context.Context) ([]CachedTemplate, error) {
+	query := `
+		SELECT d.datname,
+		       COALESCE(shobj_description(d.oid, 'pg_database'), ''),
+		       pg_database_size(d.datname)
+		FROM pg_database d
+		WHERE d.datistemplate AND d.datname LIKE $1
+		ORDER BY d.datname`
+
+	rows, err := c.DB.QueryContext(ctx, query, strings.ReplaceAll(TemplateCachePrefix, "_", `\_`)+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached templates: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			logrus.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var templates []CachedTemplate
+	for rows.Next() {
+		var t CachedTemplate
+		var comment string
+		if err := rows.Scan(&t.Name, &comment, &t.Size); err != nil {
+			return nil, fmt.Errorf("failed to scan cached template: %w", err)
+		}
+		var ok bool
+		if t.Source, t.CreatedAt, ok = parseTemplateComment(comment); !ok {
+			logrus.Debugf("Skipping template database %s without a cache comment", t.Name)
+			continue
+		}
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list cached templates: %w", err)
+	}
+
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].CreatedAt.Before(templates[j].CreatedAt)
+	})
+	return templates, nil
+}
+
+// OwnsDatabaseContext reports whether the connected user has the privileges of the
+// owner of a database, which managed services require to clone it as a template.
+// A database that does not exist is not owned.
+func (c *Connection) OwnsDatabaseContext(ctx context.Context, name string) (bool, error) {
+	var owner bool
+	err := c.DB.QueryRowContext(ctx, "SELECT pg_has_role(datdba, 'USAGE') FROM pg_database WHERE datname = $1", name).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check the owner of database %s: %w", name, err)
+	}
+	return owner, nil
+}
+
+// CachedTemplate returns the cached template for a source database, or nil when
+// there is none
+func (c *Connection) CachedTemplate(ctx context.Context, source string) (*CachedTemplate, error) {
+	templates, err := c.ListCachedTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := TemplateCacheName(source)
+	for i := range templates {
+		if templates[i].Name == name && templates[i].Source == source {
+			return &templates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// RefreshCachedTemplate builds a fresh copy of the source database and swaps it in
+// as the source's cached template. The copy is built under a temporary name, so the
+// previous template stays usable until the new one is ready. Building needs the
+// source to be free of other sessions for a moment, like any template clone.
+func (c *Connection) RefreshCachedTemplate(ctx context.Context, source string) (*CachedTemplate, error) {
+	name := TemplateCacheName(source)
+	building := truncateName(name, 57) + "_build"
+
+	if err := c.DropDatabaseContext(ctx, building); err != nil {
+		return nil, err
+	}
+	if err := c.CreateDatabaseContext(ctx, building, source, false); err != nil {
+		return nil, err
+	}
+
+	if err := c.DropCachedTemplate(ctx, name); err != nil {
+		c.dropQuietly(building)
+		return nil, err
+	}
+	statements := []string{
+		fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(building), pq.QuoteIdentifier(name)),
+		fmt.Sprintf("ALTER DATABASE %s WITH IS_TEMPLATE true ALLOW_CONNECTIONS false", pq.QuoteIdentifier(name)),
+		fmt.Sprintf("COMMENT ON DATABASE %s IS %s", pq.QuoteIdentifier(name),
+			pq.QuoteLiteral(templateComment(source, time.Now()))),
+	}
+	for _, statement := range statements {
+		if _, err := c.DB.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to install cached template %s: %w", name, err)
+		}
+	}
+
+	template, err := c.CachedTemplate(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, fmt.Errorf("cached template %s was not found after refreshing it", name)
+	}
+	return template, nil
+}
+
+// DropCachedTemplate drops a cached template if it exists. Template databases cannot
+// be dropped, so the template flag is cleared first.
+func (c *Connection) DropCachedTemplate(ctx context.Context, name string) error {
+	exists, err := c.DatabaseExistsContext(ctx, name)
+	if err != nil || !exists {
+		return err
+	}
+	query := fmt.Sprintf("ALTER DATABASE %s WITH IS_TEMPLATE false", pq.QuoteIdentifier(name))
+	if _, err := c.DB.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to unmark template %s: %w", name, err)
+	}
+	return c.DropDatabaseContext(ctx, name)
+}
+
+// dropQuietly drops a half-built database, logging rather than returning failures
+func (c *Connection) dropQuietly(name string) {
+	if err := c.DropDatabaseContext(context.Background(), name); err != nil {
+		logrus.Warnf("Failed to drop %s: %v", name, err)
+	}
+}
+
+// templateComment records a cached template's source and build time
+func templateComment(source string, created time.Time) string {
+	return fmt.Sprintf("%s source=%s created=%s", templateCommentPrefix, source, created.UTC().Format(time.RFC3339))
+}
+
+// parseTemplateComment reads back what templateComment wrote
+func parseTemplateComment(comment string) (string, time.Time, bool) {
+	rest, ok := strings.CutPrefix(comment, templateCommentPrefix+" source=")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	i := strings.LastIndex(rest, " created=")
+	if i < 0 {
+		return "", time.Time{}, false
+	}
+	created, err := time.Parse(time.RFC3339, rest[i+len(" created="):])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return rest[:i], created, true
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateCacheName(t *testing.T) {
+	assert.Equal(t, "pgfork_tpl_myapp", TemplateCacheName("myapp"))
+
+	long := TemplateCacheName(strings.Repeat("é", 40))
+	assert.LessOrEqual(t, len(long), 63)
+	assert.True(t, strings.HasPrefix(long, TemplateCachePrefix))
+	assert.Equal(t, "pgfork_tpl_"+strings.Repeat("é", 26), long)
+}
+
+func TestTemplateComment(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	source, parsed, ok := parseTemplateComment(templateComment("my app", created))
+	require.True(t, ok)
+	assert.Equal(t, "my app", source)
+	assert.True(t, created.Equal(parsed))
+
+	_, _, ok = parseTemplateComment("a template someone else made")
+	assert.False(t, ok)
+}
+
+func TestConnection_ListCachedTemplates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	older := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	newer := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	mock.ExpectQuery(`FROM pg_database d\s+WHERE d.datistemplate AND d.datname LIKE \$1`).
+		WithArgs(`pgfork\_tpl\_%`).
+		WillReturnRows(sqlmock.NewRows([]string{"datname", "comment", "size"}).
+			AddRow("pgfork_tpl_billing", templateComment("billing", newer), 2048).
+			AddRow("pgfork_tpl_manual", "", 1024).
+			AddRow("pgfork_tpl_myapp", templateComment("myapp", older), 4096))
+
+	conn := &Connection{DB: db}
+	templates, err := conn.ListCachedTemplates(context.Background())
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+	assert.Equal(t, "pgfork_tpl_myapp", templates[0].Name)
+	assert.Equal(t, "myapp", templates[0].Source)
+	assert.Equal(t, int64(4096), templates[0].Size)
+	assert.Equal(t, "billing", templates[1].Source)
+	assert.InDelta(t, time.Hour.Seconds(), templates[1].Age().Seconds(), 5)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnection_DropCachedTemplate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	mock.ExpectQuery("SELECT 1 FROM pg_database WHERE datname = \\$1").
+		WithArgs("pgfork_tpl_myapp").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+	mock.ExpectExec(`ALTER DATABASE "pgfork_tpl_myapp" WITH IS_TEMPLATE false`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT pg_terminate_backend").
+		WithArgs("pgfork_tpl_myapp").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP DATABASE IF EXISTS "pgfork_tpl_myapp"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	conn := &Connection{DB: db}
+	require.NoError(t, conn.DropCachedTemplate(context.Background(), "pgfork_tpl_myapp"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConnection_OwnsDatabaseContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	mock.ExpectQuery(`SELECT pg_has_role\(datdba, 'USAGE'\) FROM pg_database WHERE datname = \$1`).
+		WithArgs("myapp").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_has_role"}).AddRow(true))
+	mock.ExpectQuery(`SELECT pg_has_role\(datdba, 'USAGE'\) FROM pg_database WHERE datname = \$1`).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_has_role"}))
+
+	conn := &Connection{DB: db}
+	owner, err := conn.OwnsDatabaseContext(context.Background(), "myapp")
+	require.NoError(t, err)
+	assert.True(t, owner)
+
+	owner, err = conn.OwnsDatabaseContext(context.Background(), "missing")
+	require.NoError(t, err)
+	assert.False(t, owner)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
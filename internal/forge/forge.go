@@ -0,0 +1,200 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// CommentMarker is hidden in every comment posted by the tool, so that later runs
+	// edit the same comment instead of adding another one
+	CommentMarker = "<!-- postgres-db-fork -->"
+
+	// maxResponseSize bounds any one API response
+	maxResponseSize = 8 << 20
+)
+
+// Commenter posts the comment that describes a pull request's database
+type Commenter interface {
+	// Name identifies the forge in output, e.g. "github"
+	Name() string
+	// UpsertComment edits the tool's comment on the pull request, or adds one when
+	// there is none yet, and returns its URL
+	UpsertComment(ctx context.Context, number int, body string) (string, error)
+}
+
+// FromEnvironment returns a commenter for the forge the CI job runs on, or nil when
+// the job has no forge credentials. GitHub needs GITHUB_TOKEN and GITHUB_REPOSITORY;
+// GitLab needs GITLAB_TOKEN and CI_PROJECT_ID, as job tokens cannot write notes.
+func FromEnvironment() Commenter {
+	if token, repo := os.Getenv("GITHUB_TOKEN"), os.Getenv("GITHUB_REPOSITORY"); token != "" && repo != "" {
+		apiURL := os.Getenv("GITHUB_API_URL")
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+		}
+		return &GitHub{APIURL: apiURL, Repository: repo, Token: token, HTTPClient: http.DefaultClient}
+	}
+	if token, project := os.Getenv("GITLAB_TOKEN"), os.Getenv("CI_PROJECT_ID"); token != "" && project != "" {
+		apiURL := os.Getenv("CI_API_V4_URL")
+		if apiURL == "" {
+			apiURL = "https://gitlab.com/api/v4"
+		}
+		return &GitLab{
+			APIURL:     apiURL,
+			ProjectID:  project,
+			Token:      token,
+			ProjectURL: os.Getenv("CI_PROJECT_URL"),
+			HTTPClient: http.DefaultClient,
+		}
+	}
+	return nil
+}
+
+// GitHub comments on pull requests through the GitHub REST API
+type GitHub struct {
+	APIURL     string
+	Repository string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Name returns "github"
+func (g *GitHub) Name() string { return "github" }
+
+// UpsertComment edits or adds the tool's comment on a pull request
+func (g *GitHub) UpsertComment(ctx context.Context, number int, body string) (string, error) {
+	base := strings.TrimRight(g.APIURL, "/") + "/repos/" + g.Repository
+	headers := map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Authorization": "Bearer " + g.Token,
+	}
+
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	listURL := fmt.Sprintf("%s/issues/%d/comments?per_page=100", base, number)
+	if err := send(ctx, g.HTTPClient, http.MethodGet, listURL, headers, nil, &comments); err != nil {
+		return "", err
+	}
+
+	method, target := http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", base, number)
+	for _, comment := range comments {
+		if strings.Contains(comment.Body, CommentMarker) {
+			method, target = http.MethodPatch, fmt.Sprintf("%s/issues/comments/%d", base, comment.ID)
+			break
+		}
+	}
+
+	var posted struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := send(ctx, g.HTTPClient, method, target, headers, map[string]string{"body": body}, &posted); err != nil {
+		return "", err
+	}
+	return posted.HTMLURL, nil
+}
+
+// GitLab comments on merge requests through the GitLab REST API
+type GitLab struct {
+	APIURL    string
+	ProjectID string
+	Token     string
+	// ProjectURL is the project's web address, used to link to the note; the API
+	// does not return one
+	ProjectURL string
+	HTTPClient *http.Client
+}
+
+// Name returns "gitlab"
+func (g *GitLab) Name() string { return "gitlab" }
+
+// UpsertComment edits or adds the tool's note on a merge request
+func (g *GitLab) UpsertComment(ctx context.Context, number int, body string) (string, error) {
+	base := fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes",
+		strings.TrimRight(g.APIURL, "/"), url.PathEscape(g.ProjectID), number)
+	headers := map[string]string{"PRIVATE-TOKEN": g.Token}
+
+	var notes []struct {
+		ID     int64  `json:"id"`
+		Body   string `json:"body"`
+		System bool   `json:"system"`
+	}
+	if err := send(ctx, g.HTTPClient, http.MethodGet, base+"?per_page=100", headers, nil, &notes); err != nil {
+		return "", err
+	}
+
+	method, target := http.MethodPost, base
+	for _, note := range notes {
+		if !note.System && strings.Contains(note.Body, CommentMarker) {
+			method, target = http.MethodPut, fmt.Sprintf("%s/%d", base, note.ID)
+			break
+		}
+	}
+
+	var posted struct {
+		ID int64 `json:"id"`
+	}
+	if err := send(ctx, g.HTTPClient, method, target, headers, map[string]string{"body": body}, &posted); err != nil {
+		return "", err
+	}
+	if g.ProjectURL == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("%s/-/merge_requests/%d#note_%d", strings.TrimRight(g.ProjectURL, "/"), number, posted.ID), nil
+}
+
+// send makes an API request with an optional JSON body and decodes the JSON response
+// into out, when given
+func send(ctx context.Context, client *http.Client, method, target string, headers map[string]string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "postgres-db-fork")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, target, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s %s: %w", method, target, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s failed: %s", method, target, resp.Status)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse response of %s %s: %w", method, target, err)
+		}
+	}
+	return nil
+}
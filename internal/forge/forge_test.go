@@ -0,0 +1,81 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commentServer records the requests made to it and serves the given comments
+// from listPath
+func commentServer(t *testing.T, listPath string, comments interface{}) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet && r.URL.Path == listPath {
+			_ = json.NewEncoder(w).Encode(comments)
+			return
+		}
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Contains(t, body["body"], CommentMarker)
+		_, _ = fmt.Fprintf(w, `{"id": 9, "html_url": "https://github.example/pr/7#comment-9"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestGitHub_UpsertComment(t *testing.T) {
+	body := CommentMarker + "\ndatabase app_pr_7"
+
+	server, requests := commentServer(t, "/repos/owner/repo/issues/7/comments", []map[string]interface{}{
+		{"id": 1, "body": "looks good"},
+	})
+	github := &GitHub{APIURL: server.URL, Repository: "owner/repo", Token: "token", HTTPClient: server.Client()}
+	url, err := github.UpsertComment(context.Background(), 7, body)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.example/pr/7#comment-9", url)
+	assert.Equal(t, []string{"GET /repos/owner/repo/issues/7/comments", "POST /repos/owner/repo/issues/7/comments"}, *requests)
+
+	server, requests = commentServer(t, "/repos/owner/repo/issues/7/comments", []map[string]interface{}{
+		{"id": 1, "body": "looks good"},
+		{"id": 5, "body": CommentMarker + "\nold"},
+	})
+	github.APIURL, github.HTTPClient = server.URL, server.Client()
+	_, err = github.UpsertComment(context.Background(), 7, body)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /repos/owner/repo/issues/7/comments", "PATCH /repos/owner/repo/issues/comments/5"}, *requests)
+}
+
+func TestGitLab_UpsertComment(t *testing.T) {
+	server, requests := commentServer(t, "/projects/group/app/merge_requests/7/notes", []map[string]interface{}{
+		{"id": 3, "body": "added 1 commit " + CommentMarker, "system": true},
+		{"id": 4, "body": CommentMarker + "\nold"},
+	})
+	gitlab := &GitLab{APIURL: server.URL, ProjectID: "group/app", Token: "token", ProjectURL: "https://gitlab.example/group/app", HTTPClient: server.Client()}
+	url, err := gitlab.UpsertComment(context.Background(), 7, CommentMarker+"\nnew")
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.example/group/app/-/merge_requests/7#note_9", url)
+	assert.Equal(t, []string{"GET /projects/group/app/merge_requests/7/notes", "PUT /projects/group/app/merge_requests/7/notes/4"}, *requests)
+}
+
+func TestFromEnvironment(t *testing.T) {
+	for _, name := range []string{"GITHUB_TOKEN", "GITHUB_REPOSITORY", "GITHUB_API_URL", "GITLAB_TOKEN", "CI_PROJECT_ID", "CI_API_V4_URL"} {
+		t.Setenv(name, "")
+	}
+	assert.Nil(t, FromEnvironment())
+
+	t.Setenv("GITLAB_TOKEN", "token")
+	t.Setenv("CI_PROJECT_ID", "42")
+	assert.Equal(t, "gitlab", FromEnvironment().Name())
+
+	t.Setenv("GITHUB_TOKEN", "token")
+	t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+	assert.Equal(t, "github", FromEnvironment().Name())
+}
@@ -0,0 +1,120 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrWebhookUnauthorized is returned for a webhook whose signature or token does not
+// match the secret
+var ErrWebhookUnauthorized = errors.New("webhook signature does not match the secret")
+
+// WebhookEvent is a pull request event delivered by a forge webhook
+type WebhookEvent struct {
+	// Forge is "github" or "gitlab"
+	Forge string `json:"forge"`
+	// Repository is the full path of the repository, e.g. owner/repo
+	Repository string `json:"repository"`
+	Number     int    `json:"number"`
+	// Closed reports a pull request that was closed or merged
+	Closed bool `json:"closed"`
+	Merged bool `json:"merged"`
+}
+
+// ParseWebhook verifies a webhook delivery against secret and reads the pull request
+// event in it. GitHub deliveries are signed with X-Hub-Signature-256; GitLab sends the
+// secret in X-Gitlab-Token. Deliveries of other events return a nil event.
+func ParseWebhook(header http.Header, body []byte, secret string) (*WebhookEvent, error) {
+	if secret == "" {
+		return nil, ErrWebhookUnauthorized
+	}
+	switch {
+	case header.Get("X-GitHub-Event") != "":
+		if !validGitHubSignature(header.Get("X-Hub-Signature-256"), body, secret) {
+			return nil, ErrWebhookUnauthorized
+		}
+		if header.Get("X-GitHub-Event") != "pull_request" {
+			return nil, nil
+		}
+		return parseGitHubPullRequest(body)
+	case header.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return nil, ErrWebhookUnauthorized
+		}
+		if header.Get("X-Gitlab-Event") != "Merge Request Hook" {
+			return nil, nil
+		}
+		return parseGitLabMergeRequest(body)
+	}
+	return nil, fmt.Errorf("not a GitHub or GitLab webhook delivery")
+}
+
+// validGitHubSignature checks the HMAC-SHA256 signature GitHub sends as "sha256=<hex>"
+func validGitHubSignature(signature string, body []byte, secret string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// parseGitHubPullRequest reads a pull_request event
+func parseGitHubPullRequest(body []byte) (*WebhookEvent, error) {
+	var payload struct {
+		Action      string `json:"action"`
+		PullRequest struct {
+			Number int  `json:"number"`
+			Merged bool `json:"merged"`
+		} `json:"pull_request"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode GitHub webhook: %w", err)
+	}
+	return &WebhookEvent{
+		Forge:      "github",
+		Repository: payload.Repository.FullName,
+		Number:     payload.PullRequest.Number,
+		Closed:     payload.Action == "closed",
+		Merged:     payload.Action == "closed" && payload.PullRequest.Merged,
+	}, nil
+}
+
+// parseGitLabMergeRequest reads a merge request event
+func parseGitLabMergeRequest(body []byte) (*WebhookEvent, error) {
+	var payload struct {
+		ObjectAttributes struct {
+			IID    int    `json:"iid"`
+			Action string `json:"action"`
+		} `json:"object_attributes"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode GitLab webhook: %w", err)
+	}
+	action := payload.ObjectAttributes.Action
+	return &WebhookEvent{
+		Forge:      "gitlab",
+		Repository: payload.Project.PathWithNamespace,
+		Number:     payload.ObjectAttributes.IID,
+		Closed:     action == "close" || action == "merge",
+		Merged:     action == "merge",
+	}, nil
+}
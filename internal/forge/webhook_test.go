@@ -0,0 +1,65 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func githubSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseWebhook_GitHub(t *testing.T) {
+	body := []byte(`{"action": "closed", "pull_request": {"number": 7, "merged": true}, "repository": {"full_name": "owner/repo"}}`)
+	header := http.Header{}
+	header.Set("X-GitHub-Event", "pull_request")
+	header.Set("X-Hub-Signature-256", githubSignature("secret", body))
+
+	event, err := ParseWebhook(header, body, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, &WebhookEvent{Forge: "github", Repository: "owner/repo", Number: 7, Closed: true, Merged: true}, event)
+
+	_, err = ParseWebhook(header, body, "other")
+	assert.ErrorIs(t, err, ErrWebhookUnauthorized)
+
+	header.Set("X-Hub-Signature-256", "sha1=abc")
+	_, err = ParseWebhook(header, body, "secret")
+	assert.ErrorIs(t, err, ErrWebhookUnauthorized)
+
+	opened := []byte(`{"action": "opened", "pull_request": {"number": 8}}`)
+	header.Set("X-Hub-Signature-256", githubSignature("secret", opened))
+	event, err = ParseWebhook(header, opened, "secret")
+	require.NoError(t, err)
+	assert.False(t, event.Closed)
+
+	header.Set("X-GitHub-Event", "ping")
+	event, err = ParseWebhook(header, opened, "secret")
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+func TestParseWebhook_GitLab(t *testing.T) {
+	body := []byte(`{"object_kind": "merge_request", "object_attributes": {"iid": 12, "action": "close"}, "project": {"path_with_namespace": "group/app"}}`)
+	header := http.Header{}
+	header.Set("X-Gitlab-Event", "Merge Request Hook")
+	header.Set("X-Gitlab-Token", "secret")
+
+	event, err := ParseWebhook(header, body, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, &WebhookEvent{Forge: "gitlab", Repository: "group/app", Number: 12, Closed: true}, event)
+
+	header.Set("X-Gitlab-Token", "wrong")
+	_, err = ParseWebhook(header, body, "secret")
+	assert.ErrorIs(t, err, ErrWebhookUnauthorized)
+
+	_, err = ParseWebhook(http.Header{}, body, "secret")
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package fork
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+)
+
+// backupTimeFormat names backups by when they were taken, so they sort by age
+const backupTimeFormat = "20060102T150405Z"
+
+// backupDir returns the directory the backups of database are kept in
+func backupDir(dir, database string) (string, error) {
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".postgres-db-fork", "backups")
+	}
+	return filepath.Join(dir, unsafeCacheChars.ReplaceAllString(database, "_")), nil
+}
+
+// backupBeforeDrop dumps the existing target database name before DropIfExists drops
+// it, unless it holds no tables, and prunes its older backups. The connection used
+// to inspect the target is closed before returning, so the drop is not blocked.
+func (f *Forker) backupBeforeDrop(ctx context.Context, name string) error {
+	target := f.config.Destination.WithDatabase(name)
+
+	conn, err := db.NewConnectionContext(ctx, &target)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the existing target: %w", err)
+	}
+	tables, large, err := backupTablesOf(ctx, conn.DB, int64(f.config.BackupSmallTablesMB)*1024*1024)
+	_ = conn.Close()
+	if err != nil {
+		return err
+	}
+	if tables == 0 {
+		f.logger.Infof("Existing target database '%s' has no tables, not backing it up", name)
+		return nil
+	}
+
+	dir, err := backupDir(f.config.BackupDir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	path := filepath.Join(dir, time.Now().UTC().Format(backupTimeFormat)+".dump")
+
+	args := []string{"--format=custom", "--file=" + path + ".tmp"}
+	if f.config.BackupBeforeDrop != "full" {
+		for _, table := range large {
+			args = append(args, "--exclude-table-data="+table)
+		}
+	}
+	env, err := targetEnv(&target)
+	if err != nil {
+		return err
+	}
+	f.logger.Infof("Backing up existing target database '%s' (%s) before dropping it...", name, f.config.BackupBeforeDrop)
+	dumpCmd := exec.CommandContext(ctx, "pg_dump", args...)
+	dumpStderr := subprocessStderr(f.logger)
+	defer dumpStderr.Close()
+	dumpCmd.Stderr = dumpStderr
+	dumpCmd.Env = append(os.Environ(), env...)
+	if err := dumpCmd.Run(); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return fmt.Errorf("pg_dump failed: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to store backup: %w", err)
+	}
+	f.report.backedUp(path)
+	f.logger.Infof("Backed up '%s' to %s (restore with: pg_restore -d <database> %s)", name, path, path)
+
+	for _, pruned := range pruneBackups(dir, path, f.config.BackupKeep, f.config.BackupMaxAge, time.Now()) {
+		f.logger.Infof("Removed old backup %s", pruned)
+	}
+	return nil
+}
+
+// backupTablesOf counts the user tables of a database and lists, as pg_dump
+// patterns, those larger than smallBytes, whose data a schema backup leaves out
+func backupTablesOf(ctx context.Context, conn *sql.DB, smallBytes int64) (int, []string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT format('%I.%I', n.nspname, c.relname), pg_total_relation_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		ORDER BY 1`)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list tables of the existing target: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var count int
+	var large []string
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return 0, nil, err
+		}
+		count++
+		if size > smallBytes {
+			large = append(large, name)
+		}
+	}
+	return count, large, rows.Err()
+}
+
+// pruneBackups removes the backups in dir beyond the newest keep and those older
+// than maxAge, never current, and returns the removed paths. Zero turns either
+// limit off.
+func pruneBackups(dir, current string, keep int, maxAge time.Duration, now time.Time) []string {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.dump"))
+	if err != nil {
+		return nil
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	var removed []string
+	for i, path := range paths {
+		if path == current {
+			continue
+		}
+		expired := false
+		if taken, err := time.Parse(backupTimeFormat, strings.TrimSuffix(filepath.Base(path), ".dump")); err == nil {
+			expired = maxAge > 0 && now.Sub(taken) > maxAge
+		}
+		if (keep > 0 && i >= keep) || expired {
+			if err := os.Remove(path); err == nil {
+				removed = append(removed, path)
+			}
+		}
+	}
+	return removed
+}
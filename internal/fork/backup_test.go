@@ -0,0 +1,57 @@
+package fork
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupDir(t *testing.T) {
+	dir, err := backupDir("/backups", "app/pr 42")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/backups", "app_pr_42"), dir)
+}
+
+func TestBackupTablesOf(t *testing.T) {
+	conn, mock := newMockConnection(t)
+
+	mock.ExpectQuery("pg_total_relation_size").WillReturnRows(sqlmock.NewRows([]string{"name", "size"}).
+		AddRow("public.events", 50<<20).
+		AddRow("public.users", 1<<20))
+
+	count, large, err := backupTablesOf(context.Background(), conn.DB, 10<<20)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"public.events"}, large)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	var paths []string
+	for _, taken := range []time.Time{
+		now.Add(-30 * 24 * time.Hour),
+		now.Add(-3 * time.Hour),
+		now.Add(-2 * time.Hour),
+		now.Add(-time.Hour),
+		now,
+	} {
+		path := filepath.Join(dir, taken.Format(backupTimeFormat)+".dump")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		paths = append(paths, path)
+	}
+
+	// The three newest are kept; the month-old one is also past the age limit
+	removed := pruneBackups(dir, paths[4], 3, 7*24*time.Hour, now)
+	assert.ElementsMatch(t, []string{paths[0], paths[1]}, removed)
+
+	// Without limits nothing is removed
+	assert.Empty(t, pruneBackups(dir, paths[4], 0, 0, now))
+}
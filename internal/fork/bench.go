@@ -0,0 +1,260 @@
+package fork
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/lib/pq"
+)
+
+// benchTables is how many of the largest tables the built-in load reads from
+const benchTables = 20
+
+// BenchResult is the throughput and latency of the load run against the target after
+// the fork, to compare targets across fork strategies and instance sizes
+type BenchResult struct {
+	// Tool is "builtin" or "pgbench"
+	Tool         string  `json:"tool"`
+	Clients      int     `json:"clients"`
+	Duration     string  `json:"duration"`
+	Transactions int64   `json:"transactions"`
+	TPS          float64 `json:"tps"`
+	LatencyMs    float64 `json:"latency_ms"`
+}
+
+// runBench runs the configured load against the target and records its results.
+// Problems are logged as warnings; the fork itself has already succeeded.
+func (f *Forker) runBench(ctx context.Context) {
+	target := f.targetConfig()
+
+	var result *BenchResult
+	var err error
+	if f.config.Bench == config.BenchBuiltin {
+		f.logger.Infof("Running the built-in load against %s for %s...", f.config.TargetDatabase, f.config.BenchDuration)
+		result, err = builtinBench(ctx, &target, f.config.MaxConnections, f.config.BenchDuration)
+	} else {
+		f.logger.Infof("Running %s against %s...", f.config.Bench, f.config.TargetDatabase)
+		result, err = f.commandBench(ctx, &target)
+	}
+	if err != nil {
+		f.logger.Warnf("Warning: Benchmark failed: %v", err)
+		return
+	}
+	f.report.benchResult(result)
+	f.logger.Infof("Benchmark: %.1f tps, %.3f ms average latency, %d transactions with %d clients",
+		result.TPS, result.LatencyMs, result.Transactions, result.Clients)
+}
+
+// commandBench runs the pgbench command line of Bench with the target's libpq
+// environment and reads its summary
+func (f *Forker) commandBench(ctx context.Context, target *config.DatabaseConfig) (*BenchResult, error) {
+	env, err := targetEnv(target)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", f.config.Bench)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("'%s' failed: %w", f.config.Bench, err)
+	}
+	f.logger.Debugf("Benchmark output:\n%s", stdout.String())
+	return parsePgbench(stdout.String())
+}
+
+var (
+	pgbenchClients      = regexp.MustCompile(`(?m)^number of clients: (\d+)`)
+	pgbenchDuration     = regexp.MustCompile(`(?m)^duration: (\d+) s`)
+	pgbenchTransactions = regexp.MustCompile(`(?m)^number of transactions actually processed: (\d+)`)
+	pgbenchLatency      = regexp.MustCompile(`(?m)^latency average = ([\d.]+) ms`)
+	pgbenchTPS          = regexp.MustCompile(`(?m)^tps = ([\d.]+)`)
+)
+
+// parsePgbench reads the summary pgbench prints. Older versions print tps including
+// and then excluding connection time; the last one is used.
+func parsePgbench(out string) (*BenchResult, error) {
+	tps := pgbenchTPS.FindAllStringSubmatch(out, -1)
+	if len(tps) == 0 {
+		return nil, fmt.Errorf("no tps in pgbench output")
+	}
+	result := &BenchResult{Tool: "pgbench"}
+	result.TPS, _ = strconv.ParseFloat(tps[len(tps)-1][1], 64)
+	if m := pgbenchClients.FindStringSubmatch(out); m != nil {
+		result.Clients, _ = strconv.Atoi(m[1])
+	}
+	if m := pgbenchDuration.FindStringSubmatch(out); m != nil {
+		seconds, _ := strconv.Atoi(m[1])
+		result.Duration = (time.Duration(seconds) * time.Second).String()
+	}
+	if m := pgbenchTransactions.FindStringSubmatch(out); m != nil {
+		result.Transactions, _ = strconv.ParseInt(m[1], 10, 64)
+	}
+	if m := pgbenchLatency.FindStringSubmatch(out); m != nil {
+		result.LatencyMs, _ = strconv.ParseFloat(m[1], 64)
+	}
+	return result, nil
+}
+
+// benchTable is a table the built-in load reads by its integer primary key
+type benchTable struct {
+	quoted   string
+	key      string
+	min, max int64
+}
+
+// builtinBench reads random rows of the largest tables by primary key from clients
+// connections for duration, like pgbench's select-only script over the forked data.
+// A target without such tables is read with SELECT 1.
+func builtinBench(ctx context.Context, target *config.DatabaseConfig, clients int, duration time.Duration) (*BenchResult, error) {
+	conn, err := db.NewConnectionContext(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	conn.DB.SetMaxOpenConns(clients)
+	conn.DB.SetMaxIdleConns(clients)
+
+	tables, err := benchTablesOf(ctx, conn.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu           sync.Mutex
+		transactions int64
+		latency      time.Duration
+		firstErr     error
+		wg           sync.WaitGroup
+	)
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(seed))
+			var count int64
+			var spent time.Duration
+			var clientErr error
+			for time.Now().Before(deadline) && ctx.Err() == nil {
+				began := time.Now()
+				if clientErr = benchTransaction(ctx, conn.DB, tables, random); clientErr != nil {
+					break
+				}
+				spent += time.Since(began)
+				count++
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			transactions += count
+			latency += spent
+			if firstErr == nil && clientErr != nil && ctx.Err() == nil {
+				firstErr = clientErr
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	elapsed := time.Since(start)
+	result := &BenchResult{
+		Tool:         config.BenchBuiltin,
+		Clients:      clients,
+		Duration:     elapsed.Round(time.Millisecond).String(),
+		Transactions: transactions,
+	}
+	if transactions > 0 {
+		result.TPS = float64(transactions) / elapsed.Seconds()
+		result.LatencyMs = float64(latency.Microseconds()) / float64(transactions) / 1000
+	}
+	return result, nil
+}
+
+// benchTablesOf lists the largest non-empty tables with a single-column integer
+// primary key, with the range of their keys
+func benchTablesOf(ctx context.Context, conn *sql.DB) ([]benchTable, error) {
+	query := fmt.Sprintf(`
+		SELECT format('%%I.%%I', n.nspname, c.relname), a.attname
+		FROM pg_index x
+		JOIN pg_class c ON c.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = x.indrelid AND a.attnum = x.indkey[0]
+		WHERE x.indisprimary
+		  AND array_length(x.indkey::int2[], 1) = 1
+		  AND a.atttypid IN ('int2'::regtype, 'int4'::regtype, 'int8'::regtype)
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY c.relpages DESC, 1
+		LIMIT %d`, benchTables)
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables to read: %w", err)
+	}
+	var tables []benchTable
+	for rows.Next() {
+		var table benchTable
+		if err := rows.Scan(&table.quoted, &table.key); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ranged := tables[:0]
+	for _, table := range tables {
+		var min, max sql.NullInt64
+		key := pq.QuoteIdentifier(table.key)
+		if err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT min(%s), max(%s) FROM %s", key, key, table.quoted)).Scan(&min, &max); err != nil {
+			return nil, fmt.Errorf("failed to read key range of %s: %w", table.quoted, err)
+		}
+		if min.Valid {
+			table.min, table.max = min.Int64, max.Int64
+			ranged = append(ranged, table)
+		}
+	}
+	return ranged, nil
+}
+
+// benchTransaction reads one random row of a random table, or runs SELECT 1 without
+// tables
+func benchTransaction(ctx context.Context, conn *sql.DB, tables []benchTable, random *rand.Rand) error {
+	if len(tables) == 0 {
+		_, err := conn.ExecContext(ctx, "SELECT 1")
+		return err
+	}
+	table := tables[random.Intn(len(tables))]
+	id := table.min + random.Int63n(table.max-table.min+1)
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s = $1", table.quoted, pq.QuoteIdentifier(table.key)), id)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		// Fetching the row is the load
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,76 @@
+package fork
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePgbench(t *testing.T) {
+	out := `pgbench (16.4)
+transaction type: <builtin: select only>
+scaling factor: 1
+query mode: simple
+number of clients: 4
+number of threads: 1
+maximum number of tries: 1
+duration: 30 s
+number of transactions actually processed: 123456
+number of failed transactions: 0 (0.000%)
+latency average = 0.972 ms
+initial connection time = 12.345 ms
+tps = 4115.200000 (without initial connection time)
+`
+	result, err := parsePgbench(out)
+	require.NoError(t, err)
+	assert.Equal(t, &BenchResult{
+		Tool:         "pgbench",
+		Clients:      4,
+		Duration:     "30s",
+		Transactions: 123456,
+		TPS:          4115.2,
+		LatencyMs:    0.972,
+	}, result)
+
+	// Before PostgreSQL 14, tps excluding connection time comes last
+	result, err = parsePgbench("number of clients: 2\ntps = 900.5 (including connections establishing)\ntps = 950.25 (excluding connections establishing)\n")
+	require.NoError(t, err)
+	assert.Equal(t, 950.25, result.TPS)
+
+	_, err = parsePgbench("pgbench: error: connection to server failed")
+	assert.EqualError(t, err, "no tps in pgbench output")
+}
+
+func TestBenchTablesOf(t *testing.T) {
+	conn, mock := newMockConnection(t)
+
+	mock.ExpectQuery("FROM pg_index x").WillReturnRows(sqlmock.NewRows([]string{"name", "key"}).
+		AddRow(`public.orders`, "id").
+		AddRow(`public.empty`, "id"))
+	mock.ExpectQuery(`SELECT min\("id"\), max\("id"\) FROM public.orders`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(10, 500))
+	mock.ExpectQuery(`SELECT min\("id"\), max\("id"\) FROM public.empty`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+
+	tables, err := benchTablesOf(context.Background(), conn.DB)
+	require.NoError(t, err)
+	assert.Equal(t, []benchTable{{quoted: "public.orders", key: "id", min: 10, max: 500}}, tables)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBenchTransaction(t *testing.T) {
+	conn, mock := newMockConnection(t)
+	random := rand.New(rand.NewSource(1))
+
+	mock.ExpectQuery(`SELECT \* FROM public.orders WHERE "id" = \$1`).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	require.NoError(t, benchTransaction(context.Background(), conn.DB, []benchTable{{quoted: "public.orders", key: "id", min: 7, max: 7}}, random))
+
+	mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, benchTransaction(context.Background(), conn.DB, nil, random))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
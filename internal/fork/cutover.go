@@ -0,0 +1,223 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+)
+
+// Cutover modes, by how the target follows the source
+const (
+	// CutoverLogical detaches a target subscribed to the source with replicate
+	CutoverLogical = "logical"
+	// CutoverStandby promotes a destination server that is a warm standby of the source
+	CutoverStandby = "standby"
+)
+
+// cutoverPollInterval is how often the lag is measured while waiting for the target
+const cutoverPollInterval = time.Second
+
+// CutoverOptions configures the switch from the source to a target that follows it
+type CutoverOptions struct {
+	// Publication, Slot and Subscription are the names replicate used, defaulting to
+	// pgfork_<target database>
+	Publication  string
+	Slot         string
+	Subscription string
+	// PauseRoles are the source roles applications connect as. They are barred from
+	// logging in and their sessions to the source ended, so no write lands on the
+	// source after the target's last change. They stay paused once the target is
+	// promoted, and are allowed back in if the cutover fails before.
+	PauseRoles []string
+}
+
+// CutoverResult describes a completed cutover
+type CutoverResult struct {
+	Mode string `json:"mode"`
+	// LSN is the source WAL position the target caught up with before promotion
+	LSN         string   `json:"lsn"`
+	PausedRoles []string `json:"paused_roles,omitempty"`
+	// TerminatedSessions is how many sessions of the paused roles were ended
+	TerminatedSessions int `json:"terminated_sessions,omitempty"`
+	// SequencesFixed counts the target sequences moved past the replicated rows, as
+	// logical replication does not carry sequences
+	SequencesFixed int `json:"sequences_fixed,omitempty"`
+	// Target is how applications reach the promoted target, without the password
+	Target string `json:"target"`
+	// WaitedFor is how long the target took to catch up
+	WaitedFor string `json:"waited_for"`
+}
+
+// Cutover finishes a migration onto a target that follows the source: it pauses the
+// application roles on the source, waits until the target has every change the
+// source made up to then, and promotes the target. A destination server in recovery
+// is a warm standby and is promoted with pg_promote; otherwise the target database's
+// subscription is detached, its slot and publication dropped on the source, and its
+// sequences moved past the replicated rows. ctx bounds the wait.
+func Cutover(ctx context.Context, cfg *config.ForkConfig, opts CutoverOptions, logger *logging.Logger) (*CutoverResult, error) {
+	name := DefaultReplicationName(cfg.TargetDatabase)
+	for _, field := range []*string{&opts.Publication, &opts.Slot, &opts.Subscription} {
+		if *field == "" {
+			*field = name
+		}
+	}
+
+	sourceConn, err := db.NewConnectionContext(ctx, &cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer func() {
+		if err := sourceConn.Close(); err != nil {
+			logger.Warnf("Warning: Source connection cleanup failed: %v", err)
+		}
+	}()
+
+	adminConfig := cfg.Destination.Admin()
+	adminConn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to destination server: %w", err)
+	}
+	defer func() {
+		if err := adminConn.Close(); err != nil {
+			logger.Warnf("Warning: Destination admin connection cleanup failed: %v", err)
+		}
+	}()
+
+	status, err := adminConn.StandbyStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	targetConfig := cfg.Destination.WithDatabase(cfg.TargetDatabase)
+	result := &CutoverResult{Mode: CutoverLogical, Target: "postgresql://" + targetConfig.Redacted()}
+	if status.InRecovery {
+		result.Mode = CutoverStandby
+	}
+
+	var targetConn *db.Connection
+	if result.Mode == CutoverLogical {
+		if targetConn, err = db.NewConnectionContext(ctx, &targetConfig); err != nil {
+			return nil, fmt.Errorf("failed to connect to target database: %w", err)
+		}
+		defer func() {
+			if err := targetConn.Close(); err != nil {
+				logger.Warnf("Warning: Target connection cleanup failed: %v", err)
+			}
+		}()
+		// A subscription still copying its tables is far from caught up, so refuse
+		// before locking anyone out
+		pending, err := targetConn.SubscriptionPendingTablesContext(ctx, opts.Subscription)
+		if err != nil {
+			return nil, err
+		}
+		if pending > 0 {
+			return nil, fmt.Errorf("subscription %s is still copying %d tables; cut over once pg_subscription_rel shows them ready", opts.Subscription, pending)
+		}
+	}
+
+	// Roles paused so far are let back in unless the target was promoted
+	promoted := false
+	defer func() {
+		if promoted {
+			return
+		}
+		for _, role := range result.PausedRoles {
+			if err := sourceConn.SetRoleLoginContext(context.Background(), role, true); err != nil {
+				logger.Warnf("Warning: %v", err)
+			}
+		}
+	}()
+	for _, role := range opts.PauseRoles {
+		logger.Infof("Pausing role %s on the source...", role)
+		if err := sourceConn.SetRoleLoginContext(ctx, role, false); err != nil {
+			return nil, err
+		}
+		result.PausedRoles = append(result.PausedRoles, role)
+		terminated, err := sourceConn.TerminateRoleSessionsContext(ctx, role, cfg.Source.Database)
+		if err != nil {
+			return nil, err
+		}
+		result.TerminatedSessions += terminated
+	}
+
+	if result.LSN, err = sourceConn.CurrentWALLSN(ctx); err != nil {
+		return nil, err
+	}
+	lag := func(ctx context.Context) (int64, error) {
+		return sourceConn.SlotLagContext(ctx, opts.Slot, result.LSN)
+	}
+	if result.Mode == CutoverStandby {
+		lag = func(ctx context.Context) (int64, error) {
+			return adminConn.ReplayLagContext(ctx, result.LSN)
+		}
+	}
+	start := time.Now()
+	if err := waitForZeroLag(ctx, lag, logger); err != nil {
+		return nil, err
+	}
+	result.WaitedFor = time.Since(start).Round(time.Millisecond).String()
+
+	if result.Mode == CutoverStandby {
+		logger.Info("Promoting the standby...")
+		if err := adminConn.PromoteContext(ctx); err != nil {
+			return nil, err
+		}
+		promoted = true
+		return result, nil
+	}
+
+	logger.Infof("Detaching subscription %s...", opts.Subscription)
+	if err := targetConn.DetachSubscriptionContext(ctx, opts.Subscription); err != nil {
+		return nil, err
+	}
+	promoted = true
+
+	// The target no longer depends on the source, so cleaning up is best effort
+	if err := sourceConn.DropReplicationSlot(ctx, opts.Slot); err != nil {
+		logger.Warnf("Warning: %v", err)
+	}
+	if err := sourceConn.DropPublication(ctx, opts.Publication); err != nil {
+		logger.Warnf("Warning: %v", err)
+	}
+	sequences, err := targetConn.CheckSequences()
+	if err != nil {
+		return nil, fmt.Errorf("target promoted, but its sequences could not be checked: %w", err)
+	}
+	for i := range sequences {
+		if !sequences[i].AtRisk {
+			continue
+		}
+		if err := targetConn.FixSequence(&sequences[i]); err != nil {
+			return nil, fmt.Errorf("target promoted, but %w", err)
+		}
+		result.SequencesFixed++
+	}
+	return result, nil
+}
+
+// waitForZeroLag measures lag every cutoverPollInterval until it reaches zero or ctx
+// is done
+func waitForZeroLag(ctx context.Context, lag func(context.Context) (int64, error), logger *logging.Logger) error {
+	ticker := time.NewTicker(cutoverPollInterval)
+	defer ticker.Stop()
+
+	for {
+		behind, err := lag(ctx)
+		if err != nil {
+			return err
+		}
+		if behind <= 0 {
+			return nil
+		}
+		logger.Infof("Target is %d bytes of WAL behind, waiting...", behind)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("target did not catch up with the source: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+)
+
+// makeDeterministic removes what differs between two forks of the same data: the
+// physical row order, which follows the source's update history and the order of
+// the load, and sequence values the source used up without keeping. Every table
+// with a primary key is rewritten in key order, and every column-owned sequence,
+// serial or identity, continues from its column's data, so a plain dump of two
+// such forks is byte-for-byte the same.
+func (f *Forker) makeDeterministic(ctx context.Context) error {
+	target := f.targetConfig()
+
+	conn, err := db.NewConnectionContext(ctx, &target)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Target connection cleanup failed: %v", err)
+		}
+	}()
+
+	return f.orderTarget(ctx, conn)
+}
+
+// orderTarget orders the tables and resets the sequences of the connected target
+func (f *Forker) orderTarget(ctx context.Context, conn *db.Connection) error {
+	keys, err := conn.PrimaryKeysContext(ctx)
+	if err != nil {
+		return err
+	}
+	var unordered []string
+	for _, key := range keys {
+		if key.Index == "" {
+			unordered = append(unordered, key.Schema+"."+key.Table)
+			continue
+		}
+		if err := conn.ClusterContext(ctx, key); err != nil {
+			return err
+		}
+	}
+	f.logger.Infof("Ordered %d tables by primary key", len(keys)-len(unordered))
+	if len(unordered) > 0 {
+		f.logger.Warnf("Warning: %d tables have no primary key and keep their load order: %v", len(unordered), unordered)
+	}
+
+	sequences, err := conn.CheckSequences()
+	if err != nil {
+		return err
+	}
+	for i := range sequences {
+		if err := conn.ResetSequence(&sequences[i]); err != nil {
+			return err
+		}
+	}
+	f.logger.Infof("Reset %d sequences from their data", len(sequences))
+	return nil
+}
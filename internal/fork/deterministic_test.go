@@ -0,0 +1,41 @@
+package fork
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderTarget(t *testing.T) {
+	conn, mock := newMockConnection(t)
+	forker := NewForker(&config.ForkConfig{Deterministic: true})
+
+	mock.ExpectQuery("LEFT JOIN pg_index x ON x.indrelid = c.oid AND x.indisprimary").
+		WillReturnRows(sqlmock.NewRows([]string{"nspname", "relname", "index"}).
+			AddRow("public", "audit_log", "").
+			AddRow("public", "orders", "orders_pkey"))
+	mock.ExpectExec(`CLUSTER "public"."orders" USING "orders_pkey"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`ALTER TABLE "public"."orders" SET WITHOUT CLUSTER`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery("SELECT seq_ns.nspname, seq.relname").
+		WillReturnRows(sqlmock.NewRows([]string{"seq_schema", "seq", "tbl_schema", "tbl", "column", "next", "increment"}).
+			AddRow("public", "orders_id_seq", "public", "orders", "id", 90, 1).
+			AddRow("public", "audit_log_id_seq", "public", "audit_log", "id", 7, 1))
+	mock.ExpectQuery(`SELECT max\("id"\)::bigint FROM "public"."orders"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(40))
+	mock.ExpectQuery(`SELECT max\("id"\)::bigint FROM "public"."audit_log"`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec(`SELECT setval\(\$1::regclass, \$2, true\)`).
+		WithArgs(`"public"."orders_id_seq"`, int64(40)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT setval\(seqrelid, seqstart, false\) FROM pg_sequence`).
+		WithArgs(`"public"."audit_log_id_seq"`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, forker.orderTarget(context.Background(), conn))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
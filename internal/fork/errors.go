@@ -234,6 +234,12 @@ func (eh *ErrorHandler) classifyError(err error) (ErrorType, ErrorSeverity, bool
 		return eh.classifyPostgreSQLError(pqErr)
 	}
 
+	// Copied rows that differ from the source
+	var mismatch *SampleMismatchError
+	if errors.As(err, &mismatch) {
+		return ErrorTypeDataIntegrity, SeverityFatal, false, 0
+	}
+
 	// Connection errors
 	if strings.Contains(errStr, "connection") {
 		if strings.Contains(errStr, "refused") || strings.Contains(errStr, "timeout") {
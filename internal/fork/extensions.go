@@ -0,0 +1,147 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// extensionStrategy adapts a dump and restore to an extension that keeps its own
+// metadata in the database
+type extensionStrategy struct {
+	// name is the extension's name in pg_extension, label how it is reported
+	name  string
+	label string
+	// required fails the fork when the destination cannot install the source's version,
+	// because the data cannot be restored without it
+	required bool
+	// internalSchemas hold the extension's own metadata and are left out of the dump
+	internalSchemas []string
+	// preRestore and postRestore return SQL run on the target around the restore
+	preRestore  func(version string) []string
+	postRestore func(version string) []string
+	// report describes the source's use of the extension, if there is more to say
+	report func(ctx context.Context, dtm *DataTransferManager) string
+}
+
+// extensionStrategies lists the extensions that need more than a plain dump and restore
+var extensionStrategies = []extensionStrategy{
+	{
+		// Hypertable chunks live in _timescaledb_internal and must be copied with the
+		// catalog in _timescaledb_catalog; TimescaleDB's restore mode keeps its
+		// triggers from firing while both are loaded, as its documentation prescribes
+		name:     "timescaledb",
+		label:    "TimescaleDB",
+		required: true,
+		preRestore: func(version string) []string {
+			return []string{
+				"CREATE EXTENSION IF NOT EXISTS timescaledb VERSION " + pq.QuoteLiteral(version),
+				"SELECT timescaledb_pre_restore()",
+			}
+		},
+		postRestore: func(string) []string {
+			return []string{"SELECT timescaledb_post_restore()"}
+		},
+	},
+	{
+		// The Citus metadata describes the source cluster's nodes and shards, which mean
+		// nothing to the destination, so distributed tables arrive as regular tables
+		name:            "citus",
+		label:           "Citus",
+		internalSchemas: []string{"citus", "citus_internal"},
+		report: func(ctx context.Context, dtm *DataTransferManager) string {
+			distributed, reference, err := dtm.source.CitusTablesContext(ctx)
+			if err != nil {
+				dtm.logger.Debugf("Could not read Citus metadata: %v", err)
+				return ""
+			}
+			return fmt.Sprintf("%d distributed and %d reference tables are restored as regular tables; "+
+				"run create_distributed_table or create_reference_table on the target to distribute them again",
+				distributed, reference)
+		},
+	},
+}
+
+// detectedExtension is an extension of the source with a strategy, and its version
+type detectedExtension struct {
+	*extensionStrategy
+	version string
+}
+
+// detectExtensions finds the source's extensions that need a strategy, checks that the
+// destination can install the ones the data needs, and reports each of them
+func (dtm *DataTransferManager) detectExtensions(ctx context.Context) ([]detectedExtension, error) {
+	installed, err := dtm.source.ExtensionsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var detected []detectedExtension
+	for i := range extensionStrategies {
+		strategy := &extensionStrategies[i]
+		version, ok := installed[strategy.name]
+		if !ok {
+			continue
+		}
+		detected = append(detected, detectedExtension{extensionStrategy: strategy, version: version})
+
+		available, err := dtm.dest.ExtensionAvailableContext(ctx, strategy.name, version)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !available && strategy.required:
+			return nil, fmt.Errorf("the source uses %s %s, which the destination server cannot install; install the same version there first",
+				strategy.label, version)
+		case !available:
+			dtm.logger.Warnf("The source uses %s %s, which the destination server cannot install; objects that need it will fail to restore",
+				strategy.label, version)
+		default:
+			dtm.logger.Infof("Detected %s %s on the source", strategy.label, version)
+		}
+		if len(strategy.internalSchemas) > 0 {
+			dtm.logger.Infof("%s: skipping internal schemas %v", strategy.label, strategy.internalSchemas)
+		}
+		if strategy.preRestore != nil || strategy.postRestore != nil {
+			dtm.logger.Infof("%s: restoring in the extension's restore mode", strategy.label)
+		}
+		if strategy.report != nil {
+			if text := strategy.report(ctx, dtm); text != "" {
+				dtm.logger.Infof("%s: %s", strategy.label, text)
+			}
+		}
+	}
+	return detected, nil
+}
+
+// excludedSchemas returns the internal schemas of the detected extensions, sorted
+func excludedSchemas(detected []detectedExtension) []string {
+	var schemas []string
+	for _, extension := range detected {
+		schemas = append(schemas, extension.internalSchemas...)
+	}
+	sort.Strings(schemas)
+	return schemas
+}
+
+// runExtensionHooks runs the pre- or post-restore SQL of the detected extensions on
+// the target
+func (dtm *DataTransferManager) runExtensionHooks(ctx context.Context, detected []detectedExtension, post bool) error {
+	for _, extension := range detected {
+		hook := extension.preRestore
+		if post {
+			hook = extension.postRestore
+		}
+		if hook == nil {
+			continue
+		}
+		for _, statement := range hook(extension.version) {
+			if _, err := dtm.dest.DB.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("%s: %s failed: %w", extension.label, statement, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package fork
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockConnection returns a connection backed by sqlmock, closed with the test
+func newMockConnection(t *testing.T) (*db.Connection, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	})
+	return &db.Connection{DB: mockDB}, mock
+}
+
+// newExtensionsTransfer returns a transfer manager for cfg with mocked connections
+func newExtensionsTransfer(t *testing.T, cfg *config.ForkConfig) (*DataTransferManager, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	source, sourceMock := newMockConnection(t)
+	dest, destMock := newMockConnection(t)
+	return NewDataTransferManager(source, dest, &cfg.Source, &cfg.Destination, cfg, NewForker(cfg).logger), sourceMock, destMock
+}
+
+func TestResolveTables_Regex(t *testing.T) {
+	cfg := &config.ForkConfig{ExcludeTables: []string{`public\.audit_.*`}, TablePatternMode: config.TablePatternRegex}
+	dtm, source, _ := newExtensionsTransfer(t, cfg)
+
+	source.ExpectQuery("SELECT schemaname, tablename, pg_table_size").
+		WillReturnRows(sqlmock.NewRows([]string{"schemaname", "tablename", "size"}).
+			AddRow("public", "users", 100).
+			AddRow("public", "audit_log", 70).
+			AddRow("archive", "audit_log", 50))
+
+	require.NoError(t, dtm.resolveTables(context.Background()))
+	assert.Equal(t, []string{`--exclude-table="public"."audit_log"`}, dtm.filterArgs())
+	assert.NoError(t, source.ExpectationsWereMet())
+}
+
+func TestDetectExtensions(t *testing.T) {
+	cfg := &config.ForkConfig{ExcludeTables: []string{"audit_log"}}
+	dtm, source, dest := newExtensionsTransfer(t, cfg)
+
+	source.ExpectQuery("SELECT extname, extversion FROM pg_extension").
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"}).
+			AddRow("plpgsql", "1.0").
+			AddRow("citus", "12.1-1").
+			AddRow("timescaledb", "2.14.2"))
+	dest.ExpectQuery("FROM pg_available_extension_versions").WithArgs("timescaledb", "2.14.2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dest.ExpectQuery("FROM pg_available_extension_versions").WithArgs("citus", "12.1-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	source.ExpectQuery("FROM pg_dist_partition").
+		WillReturnRows(sqlmock.NewRows([]string{"distributed", "reference"}).AddRow(4, 1))
+
+	detected, err := dtm.detectExtensions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, detected, 2)
+	assert.Equal(t, "timescaledb", detected[0].name)
+	assert.Equal(t, "citus", detected[1].name)
+
+	dtm.excludeSchemas = excludedSchemas(detected)
+	assert.Equal(t, []string{"--exclude-table=audit_log", "--exclude-schema=citus", "--exclude-schema=citus_internal"}, dtm.filterArgs())
+
+	dest.ExpectExec(`CREATE EXTENSION IF NOT EXISTS timescaledb VERSION '2.14.2'`).WillReturnResult(sqlmock.NewResult(0, 0))
+	dest.ExpectExec(`SELECT timescaledb_pre_restore\(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, dtm.runExtensionHooks(context.Background(), detected, false))
+	dest.ExpectExec(`SELECT timescaledb_post_restore\(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, dtm.runExtensionHooks(context.Background(), detected, true))
+
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, dest.ExpectationsWereMet())
+}
+
+func TestDetectExtensions_RequiredMissing(t *testing.T) {
+	dtm, source, dest := newExtensionsTransfer(t, &config.ForkConfig{})
+
+	source.ExpectQuery("SELECT extname, extversion FROM pg_extension").
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"}).AddRow("timescaledb", "2.14.2"))
+	dest.ExpectQuery("FROM pg_available_extension_versions").WithArgs("timescaledb", "2.14.2").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err := dtm.detectExtensions(context.Background())
+	assert.ErrorContains(t, err, "TimescaleDB 2.14.2")
+}
+
+func TestDetectExtensions_None(t *testing.T) {
+	dtm, source, _ := newExtensionsTransfer(t, &config.ForkConfig{})
+
+	source.ExpectQuery("SELECT extname, extversion FROM pg_extension").
+		WillReturnRows(sqlmock.NewRows([]string{"extname", "extversion"}).AddRow("plpgsql", "1.0"))
+
+	detected, err := dtm.detectExtensions(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, detected)
+	assert.Empty(t, excludedSchemas(detected))
+}
@@ -3,9 +3,11 @@ package fork
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -13,12 +15,18 @@ import (
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/synthetic"
 
 	"github.com/oklog/run"
 	"github.com/schollz/progressbar/v3"
 	"github.com/sirupsen/logrus"
 )
 
+// ToolVersion is the version recorded in the lineage of every fork
+var ToolVersion = "dev"
+
 // HookRunner executes custom user-defined hooks
 type HookRunner struct {
 	logger *logging.Logger
@@ -31,6 +39,11 @@ func NewHookRunner(logger *logging.Logger) *HookRunner {
 
 // Run executes a list of shell commands
 func (hr *HookRunner) Run(hooks []string, stage string) error {
+	return hr.RunWithEnv(hooks, stage, nil)
+}
+
+// RunWithEnv executes a list of shell commands with extra environment variables
+func (hr *HookRunner) RunWithEnv(hooks []string, stage string, env []string) error {
 	if len(hooks) == 0 {
 		return nil
 	}
@@ -47,6 +60,9 @@ func (hr *HookRunner) Run(hooks []string, stage string) error {
 		cmd := exec.Command("sh", "-c", command)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+		if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
 
 		if err := cmd.Run(); err != nil {
 			hr.logger.Errorf("Hook command failed: %s", command)
@@ -58,6 +74,13 @@ func (hr *HookRunner) Run(hooks []string, stage string) error {
 	return nil
 }
 
+// subprocessStderr returns where pg_dump and pg_restore write their errors: standard
+// error, with the fork's names redacted under --privacy. Close it once the tool has
+// exited.
+func subprocessStderr(logger *logging.Logger) io.WriteCloser {
+	return logger.Redactor().Writer(os.Stderr)
+}
+
 // Forker handles database forking operations with enhanced robustness
 type Forker struct {
 	config       *config.ForkConfig
@@ -66,6 +89,14 @@ type Forker struct {
 	runGroup     *run.Group
 	shutdownChan chan os.Signal
 	metrics      *MetricsCollector
+	// workDir holds the files this fork spools, while it runs
+	workDir string
+	// report records how the last fork ran
+	report *Report
+	// profile is the managed service hosting the destination, once resolved
+	profile provider.Profile
+	// preflight checks the fork can run before it changes anything, when set
+	preflight func(context.Context) error
 }
 
 // MetricsCollector handles metrics collection and export
@@ -73,10 +104,13 @@ type MetricsCollector struct {
 	startTime        time.Time
 	transferredBytes int64
 	transferredRows  int64
+	expectedBytes    int64
 	errorCount       int64
 	tablesProcessed  int64
 	metricsFile      string
-	mu               sync.RWMutex
+	// tables holds the per-table series of tables copied with COPY
+	tables map[string]*tableMetrics
+	mu     sync.RWMutex
 }
 
 // NewForker creates a new database forker with enhanced features
@@ -90,11 +124,14 @@ func NewForker(cfg *config.ForkConfig) *Forker {
 		logrus.Warnf("Failed to initialize logger, falling back to default: %v", err)
 		logger = &logging.Logger{Logger: logrus.New()}
 	}
+	if redactor := cfg.Redactor(); redactor != nil {
+		logger.AddHook(redactor)
+	}
 
 	// Create metrics collector
 	metrics := &MetricsCollector{
 		startTime:   time.Now(),
-		metricsFile: "/tmp/postgres-fork-metrics.txt",
+		metricsFile: metricsPath(cfg.WorkDir),
 	}
 
 	// Create run group for graceful shutdown
@@ -170,13 +207,47 @@ func (f *Forker) Fork(ctx context.Context) error {
 	return nil
 }
 
+// SetPreflight runs check as the validate phase of every fork, after the destination
+// is up and before anything changes, failing the fork with its error
+func (f *Forker) SetPreflight(check func(context.Context) error) {
+	f.preflight = check
+}
+
+// Report returns how the last fork ran: its method, engines, workers and phase
+// durations, or nil before a fork ran
+func (f *Forker) Report() *Report {
+	return f.report
+}
+
 // executeFork performs the actual fork operation
 func (f *Forker) executeFork(ctx context.Context) error {
 	f.logger.Info("Starting database fork operation...")
-	f.logger.Infof("Source: %s:%d/%s", f.config.Source.Host, f.config.Source.Port, f.config.Source.Database)
-	f.logger.Infof("Target: %s:%d/%s", f.config.Destination.Host, f.config.Destination.Port, f.config.TargetDatabase)
+	f.logger.Infof("Source: %s/%s", f.config.Source.Address(), f.config.Source.Database)
+	f.logger.Infof("Target: %s/%s", f.config.Destination.Address(), f.config.TargetDatabase)
 
 	hookRunner := NewHookRunner(f.logger)
+	plan := NewPlan(f.config)
+	f.report = newReport(plan)
+
+	// A destination that was just provisioned may still be starting up
+	if f.config.WaitForTarget > 0 {
+		if err := f.report.time("wait_for_target", func() error { return f.waitForTarget(ctx) }); err != nil {
+			return fmt.Errorf("failed to connect to destination server: %w", err)
+		}
+	}
+
+	if f.preflight != nil {
+		if err := f.report.time("validate", func() error { return f.preflight(ctx) }); err != nil {
+			return err
+		}
+	}
+
+	// Forks that do not fit a quota are turned away before anything runs
+	if f.config.Quota.Enabled(f.config.Team) {
+		if err := f.report.time("admission", func() error { return f.admit(ctx, plan) }); err != nil {
+			return err
+		}
+	}
 
 	// Run PreFork hooks
 	if err := hookRunner.Run(f.config.Hooks.PreFork, "PreFork"); err != nil {
@@ -184,14 +255,81 @@ func (f *Forker) executeFork(ctx context.Context) error {
 	}
 
 	var forkErr error
-	if f.config.IsSameServer() {
-		f.logger.Info("Detected same-server fork, using efficient template-based cloning")
-		forkErr = f.forkSameServer(ctx)
+	removeWorkDir, err := f.prepareWorkDir(plan)
+	if err != nil {
+		forkErr = err
 	} else {
-		f.logger.Info("Detected cross-server fork, using dump and restore")
+		// Spooled files go whether the fork succeeds or fails
+		defer removeWorkDir()
+	}
+	// Managed services restrict what the admin user may do, which can rule out cloning
+	if forkErr == nil && f.config.Provider != provider.SelfHosted.Name {
+		forkErr = f.report.time("provider", func() error { return f.resolveProvider(ctx, plan) })
+	}
+	// Matching addresses are not proof of one cluster, so confirm before cloning
+	if forkErr == nil && plan.Method == MethodTemplate {
+		if err := f.report.time("verify_cluster", func() error { return f.verifyCluster(ctx, plan) }); err != nil {
+			forkErr = fmt.Errorf("failed to verify source and destination are the same cluster: %w", err)
+		}
+	}
+	f.report.replan(plan)
+
+	switch {
+	case forkErr != nil:
+	case plan.Method == MethodTemplate:
+		f.logger.Infof("Using efficient template-based cloning: %s", plan.Reason)
+		f.report.useEngine(EngineTemplate)
+		forkErr = f.report.time("clone", func() error { return f.forkSameServer(ctx) })
+	default:
+		f.logger.Infof("Using dump and restore: %s", plan.Reason)
 		forkErr = f.forkCrossServer(ctx)
 	}
 
+	if forkErr == nil && f.config.SynthesizeData {
+		if err := f.report.time("synthesize", func() error { return f.synthesizeData(ctx) }); err != nil {
+			forkErr = fmt.Errorf("synthetic data generation failed: %w", err)
+		}
+	}
+
+	// Seed fixture data before PostFork hooks see the database
+	if forkErr == nil {
+		if err := f.report.time("seed", func() error { return f.runSeed(ctx) }); err != nil {
+			forkErr = fmt.Errorf("seeding failed: %w", err)
+		}
+	}
+
+	if forkErr == nil && f.config.Deterministic {
+		if err := f.report.time("deterministic", func() error { return f.makeDeterministic(ctx) }); err != nil {
+			forkErr = fmt.Errorf("deterministic ordering failed: %w", err)
+		}
+	}
+
+	if forkErr == nil {
+		f.recordLineage(ctx)
+	}
+
+	if forkErr == nil && (f.config.VacuumReport || f.config.VacuumFreezeTables > 0) {
+		_ = f.report.time("maintenance", func() error {
+			f.reportMaintenance(ctx)
+			return nil
+		})
+	}
+
+	if forkErr == nil && f.config.Bench != "" {
+		_ = f.report.time("bench", func() error {
+			f.runBench(ctx)
+			return nil
+		})
+	}
+
+	// The owner, connection limit and template flag come last, so a low limit or a
+	// new owner does not get in the way of the fork's own connections
+	if forkErr == nil && !targetSettings(f.config).Empty() {
+		if err := f.report.time("target_settings", func() error { return f.applyTargetSettings(ctx) }); err != nil {
+			forkErr = fmt.Errorf("failed to apply target settings: %w", err)
+		}
+	}
+
 	// Run PostFork or OnError hooks
 	if forkErr != nil {
 		f.logger.Errorf("Fork operation failed: %v", forkErr)
@@ -209,20 +347,112 @@ func (f *Forker) executeFork(ctx context.Context) error {
 	return nil
 }
 
-// forkSameServer handles same-server forking using PostgreSQL templates
-func (f *Forker) forkSameServer(ctx context.Context) error {
-	// If we need selective features (schema-only, table filtering), use cross-server method
-	// even on same server, as template-based cloning copies everything
-	if f.config.SchemaOnly || len(f.config.IncludeTables) > 0 || len(f.config.ExcludeTables) > 0 {
-		f.logger.Info("Schema-only or table filtering requested, using selective transfer method")
-		return f.forkCrossServer(ctx)
+// recordLineage records the source, tool version, job ID, CI run, time and expiry of
+// the fork in the target's comment. The fork itself has succeeded, so failures are only logged.
+func (f *Forker) recordLineage(ctx context.Context) {
+	adminConfig := f.config.Destination.Admin()
+
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		f.logger.Warnf("Warning: Could not record lineage: %v", err)
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Lineage connection cleanup failed: %v", err)
+		}
+	}()
+
+	lineage := db.Lineage{
+		Source:      f.config.Source.Database,
+		ToolVersion: ToolVersion,
+		JobID:       f.config.JobID,
+		ForkedAt:    time.Now().UTC(),
+		PullRequest: f.config.PullRequest,
+		Team:        f.config.Team,
+	}
+	if f.config.TTL > 0 {
+		expiresAt := lineage.ForkedAt.Add(f.config.TTL)
+		lineage.ExpiresAt = &expiresAt
+	}
+	if f.config.CIMetadata {
+		lineage.CI = config.DetectCI()
+	}
+	if f.config.Source.Host != "" {
+		lineage.SourceHost = f.config.Source.Address()
+	}
+	if err := conn.SetLineageContext(ctx, f.config.TargetDatabase, lineage); err != nil {
+		f.logger.Warnf("Warning: Could not record lineage: %v", err)
+	}
+}
+
+// synthesizeData fills the freshly forked schema with generated rows
+func (f *Forker) synthesizeData(ctx context.Context) error {
+	target := f.targetConfig()
+
+	conn, err := db.NewConnectionContext(ctx, &target)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Synthetic data connection cleanup failed: %v", err)
+		}
+	}()
+
+	f.logger.Infof("Generating synthetic data in %s...", f.config.TargetDatabase)
+	results, err := synthetic.Generate(ctx, conn.DB, synthetic.Options{
+		Rows:      f.config.SynthesizeRows,
+		TableRows: f.config.SynthesizeTableRows,
+	})
+	if err != nil {
+		return err
+	}
+
+	var inserted, skipped int
+	for _, result := range results {
+		inserted += result.Inserted
+		skipped += result.Skipped
+	}
+	f.logger.Infof("Generated %d rows across %d tables (%d skipped)", inserted, len(results), skipped)
+	return nil
+}
+
+// verifyCluster compares the identities of the source and destination servers and
+// switches a template plan to a transfer when they are different clusters
+func (f *Forker) verifyCluster(ctx context.Context, plan *Plan) error {
+	adminConfig := f.config.Destination.Admin()
+
+	identities := make([]db.ClusterIdentity, 0, 2)
+	for _, cfg := range []*config.DatabaseConfig{&f.config.Source, &adminConfig} {
+		conn, err := db.NewConnectionContext(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		identity, err := conn.ClusterIdentityContext(ctx)
+		if closeErr := conn.Close(); closeErr != nil {
+			f.logger.Warnf("Warning: Connection cleanup failed: %v", closeErr)
+		}
+		if err != nil {
+			return err
+		}
+		identities = append(identities, identity)
 	}
 
-	// Connect to the destination server (using postgres database for admin operations)
-	adminConfig := f.config.Destination
-	adminConfig.Database = "postgres"
+	plan.VerifyCluster(f.config, identities[0], identities[1])
+	if plan.Method != MethodTemplate {
+		f.logger.Warnf("Warning: %s; falling back to dump and restore", plan.Reason)
+	}
+	return nil
+}
+
+// resolveProvider detects or looks up the managed service hosting the destination
+// and adapts the plan to its restrictions. A server whose service cannot be detected
+// is treated as self-hosted.
+func (f *Forker) resolveProvider(ctx context.Context, plan *Plan) error {
+	adminConfig := f.config.Destination.Admin()
 
-	conn, err := db.NewConnection(&adminConfig)
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to destination server: %w", err)
 	}
@@ -232,55 +462,108 @@ func (f *Forker) forkSameServer(ctx context.Context) error {
 		}
 	}()
 
-	// Check if source database exists
-	exists, err := conn.DatabaseExists(f.config.Source.Database)
+	profile, err := provider.Resolve(ctx, f.config.Provider, conn, f.config.Destination.Host)
 	if err != nil {
-		return fmt.Errorf("failed to check source database: %w", err)
+		f.logger.Warnf("Warning: %v; assuming a self-hosted server", err)
+		return nil
 	}
-	if !exists {
-		return fmt.Errorf("source database '%s' does not exist", f.config.Source.Database)
+	if profile.NoCreateDatabase {
+		return fmt.Errorf("%s does not allow creating databases; fork to another server with --dest-host", profile.Title)
+	}
+	f.profile = profile
+	plan.ApplyProvider(f.config, profile)
+	if plan.Method == MethodTemplate && profile.TemplateClone == provider.TemplateOwned {
+		owner, err := conn.OwnsDatabaseContext(ctx, f.config.Source.Database)
+		if err != nil {
+			return err
+		}
+		plan.VerifyTemplateOwner(f.config, profile, owner)
 	}
 
-	// Check if target database exists
-	targetExists, err := conn.DatabaseExists(f.config.TargetDatabase)
-	if err != nil {
-		return fmt.Errorf("failed to check target database: %w", err)
+	if profile.Managed() {
+		f.logger.Infof("Destination server is %s", profile.Title)
+		for _, downgrade := range plan.Downgrades {
+			f.logger.Warnf("Downgrade: %s", downgrade)
+		}
 	}
+	return nil
+}
 
-	if targetExists {
-		if f.config.DropIfExists {
-			if err := conn.DropDatabase(f.config.TargetDatabase); err != nil {
-				return fmt.Errorf("failed to drop existing target database: %w", err)
-			}
-		} else {
-			return fmt.Errorf("target database '%s' already exists (use --drop-if-exists to overwrite)", f.config.TargetDatabase)
+// forkSameServer handles same-server forking using PostgreSQL templates
+func (f *Forker) forkSameServer(ctx context.Context) error {
+	// Connect to the destination server's maintenance database for admin operations
+	adminConfig := f.config.Destination.Admin()
+
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to destination server: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Connection cleanup failed: %v", err)
 		}
+	}()
+
+	// Template cloning writes to the source's server, which a standby cannot take
+	status, err := conn.StandbyStatusContext(ctx)
+	if err != nil {
+		return err
+	}
+	if status.InRecovery {
+		return fmt.Errorf("the server is a read-only standby and cannot hold the fork; fork to a primary with --dest-host")
+	}
+
+	// Check if source database exists
+	exists, err := conn.DatabaseExistsContext(ctx, f.config.Source.Database)
+	if err != nil {
+		return fmt.Errorf("failed to check source database: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("source database '%s' does not exist", f.config.Source.Database)
 	}
 
 	// Get source database size for progress reporting
-	sourceSize, err := conn.GetDatabaseSize(f.config.Source.Database)
+	sourceSize, err := conn.GetDatabaseSizeContext(ctx, f.config.Source.Database)
 	if err != nil {
 		f.logger.Warnf("Could not get source database size: %v", err)
 	} else {
-		f.logger.Infof("Source database size: %s", formatBytes(sourceSize))
+		f.logger.Infof("Source database size: %s", output.FormatBytes(sourceSize))
+	}
+
+	// Create the target database using the source, or its cached template, as template
+	template := f.config.Source.Database
+	if f.config.UseTemplateCache {
+		cached, err := conn.CachedTemplate(ctx, f.config.Source.Database)
+		switch {
+		case err != nil:
+			f.logger.Warnf("Warning: Could not look up cached template: %v", err)
+		case cached == nil:
+			f.logger.Infof("No cached template for %s, cloning the source directly", f.config.Source.Database)
+		default:
+			f.logger.Infof("Cloning from cached template %s (built %s ago)", cached.Name, cached.Age().Round(time.Second))
+			template = cached.Name
+		}
 	}
-
-	// Create the target database using the source as template
-	if err := conn.CreateDatabase(f.config.TargetDatabase, f.config.Source.Database, false); err != nil {
-		return fmt.Errorf("failed to create target database: %w", err)
+	if err := f.createTarget(ctx, conn, template); err != nil {
+		return err
 	}
 
 	// Verify the fork was successful
-	targetSize, err := conn.GetDatabaseSize(f.config.TargetDatabase)
+	targetSize, err := conn.GetDatabaseSizeContext(ctx, f.config.TargetDatabase)
 	if err != nil {
 		f.logger.Warnf("Could not verify target database size: %v", err)
 	} else {
-		f.logger.Infof("Target database size: %s", formatBytes(targetSize))
+		f.logger.Infof("Target database size: %s", output.FormatBytes(targetSize))
 	}
 
 	return nil
 }
 
+// targetConfig returns the destination settings for the target database
+func (f *Forker) targetConfig() config.DatabaseConfig {
+	return f.config.Destination.WithDatabase(f.config.TargetDatabase)
+}
+
 // forkCrossServer handles cross-server forking using dump and restore
 func (f *Forker) forkCrossServer(ctx context.Context) error {
 	// This is a more complex operation that would involve:
@@ -289,7 +572,7 @@ func (f *Forker) forkCrossServer(ctx context.Context) error {
 	// 3. Or streaming data table by table
 
 	// Connect to source database
-	sourceConn, err := db.NewConnection(&f.config.Source)
+	sourceConn, err := db.NewConnectionContext(ctx, &f.config.Source)
 	if err != nil {
 		return fmt.Errorf("failed to connect to source database: %w", err)
 	}
@@ -299,11 +582,16 @@ func (f *Forker) forkCrossServer(ctx context.Context) error {
 		}
 	}()
 
+	// A standby source is only read, but long reads may be cancelled by replay
+	standbyChunk, err := f.standbyChunkDuration(ctx, sourceConn)
+	if err != nil {
+		return err
+	}
+
 	// Connect to destination server for admin operations
-	adminConfig := f.config.Destination
-	adminConfig.Database = "postgres"
+	adminConfig := f.config.Destination.Admin()
 
-	destAdminConn, err := db.NewConnection(&adminConfig)
+	destAdminConn, err := db.NewConnectionContext(ctx, &adminConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to destination server: %w", err)
 	}
@@ -313,32 +601,15 @@ func (f *Forker) forkCrossServer(ctx context.Context) error {
 		}
 	}()
 
-	// Check if target database exists
-	targetExists, err := destAdminConn.DatabaseExists(f.config.TargetDatabase)
-	if err != nil {
-		return fmt.Errorf("failed to check target database: %w", err)
-	}
-
-	if targetExists {
-		if f.config.DropIfExists {
-			if err := destAdminConn.DropDatabase(f.config.TargetDatabase); err != nil {
-				return fmt.Errorf("failed to drop existing target database: %w", err)
-			}
-		} else {
-			return fmt.Errorf("target database '%s' already exists (use --drop-if-exists to overwrite)", f.config.TargetDatabase)
-		}
-	}
-
 	// Create empty target database
-	if err := destAdminConn.CreateDatabase(f.config.TargetDatabase, "template1", false); err != nil {
-		return fmt.Errorf("failed to create target database: %w", err)
+	if err := f.createTarget(ctx, destAdminConn, "template1"); err != nil {
+		return err
 	}
 
 	// Connect to the target database
-	targetConfig := f.config.Destination
-	targetConfig.Database = f.config.TargetDatabase
+	targetConfig := f.targetConfig()
 
-	destConn, err := db.NewConnection(&targetConfig)
+	destConn, err := db.NewConnectionContext(ctx, &targetConfig)
 	if err != nil {
 		return fmt.Errorf("failed to connect to target database: %w", err)
 	}
@@ -348,14 +619,18 @@ func (f *Forker) forkCrossServer(ctx context.Context) error {
 		}
 	}()
 
-	// Get source database size for progress reporting
-	sourceSize, err := sourceConn.GetDatabaseSize(f.config.Source.Database)
+	// Size the progress bar from the data of the tables being copied, so indexes and
+	// skipped tables do not make it finish early or late
+	transferSize, err := f.transferSize(ctx, sourceConn)
 	if err != nil {
-		f.logger.Warnf("Could not get source database size: %v", err)
-	} else {
-		f.logger.Infof("Source database size: %s", formatBytes(sourceSize))
+		f.logger.Warnf("Could not estimate the data to transfer: %v", err)
+	} else if transferSize > 0 {
+		f.logger.Infof("Data to transfer: %s", output.FormatBytes(transferSize))
+		f.metrics.mu.Lock()
+		f.metrics.expectedBytes = transferSize
+		f.metrics.mu.Unlock()
 		f.progressBar = progressbar.NewOptions64(
-			sourceSize,
+			transferSize,
 			progressbar.OptionSetDescription("Transferring data..."),
 			progressbar.OptionSetWriter(os.Stderr),
 			progressbar.OptionShowBytes(true),
@@ -370,31 +645,39 @@ func (f *Forker) forkCrossServer(ctx context.Context) error {
 	}
 
 	// Create a data transfer manager
-	transferManager := NewDataTransferManager(sourceConn, destConn, &f.config.Source, &f.config.Destination, f.config, f.logger)
+	transferManager := NewDataTransferManager(sourceConn, destConn, &f.config.Source, &targetConfig, f.config, f.logger)
 
 	// Set metrics updater
 	transferManager.SetMetricsUpdater(f)
+	transferManager.SetStandbyChunking(standbyChunk)
+	transferManager.SetWorkDir(f.workDir)
+	transferManager.SetReport(f.report)
+	transferManager.SetProvider(f.profile)
 
 	// Execute the data transfer
 	if err := transferManager.Transfer(ctx); err != nil {
 		return fmt.Errorf("failed to transfer data: %w", err)
 	}
+	if f.progressBar != nil {
+		if err := f.progressBar.Finish(); err != nil {
+			f.logger.Warnf("Failed to finish progress bar: %v", err)
+		}
+	}
 
 	return nil
 }
 
-// formatBytes converts bytes to human readable format
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// transferSize returns the bytes of table data the transfer copies
+func (f *Forker) transferSize(ctx context.Context, source *db.Connection) (int64, error) {
+	sizes, err := NewPlan(f.config).TransferSizes(ctx, source)
+	if err != nil {
+		return 0, err
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	var total int64
+	for _, size := range sizes {
+		total += size
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return total, nil
 }
 
 // saveMetrics saves metrics to file
@@ -429,6 +712,10 @@ postgres_fork_status{status="%s"} 1
 		float64(f.metrics.transferredRows)/duration.Seconds(),
 		status,
 	)
+	var tables strings.Builder
+	f.writeTableMetrics(&tables, f.config.MetricsTableLimit)
+	f.writePhaseMetrics(&tables)
+	metrics += tables.String()
 
 	if err := os.WriteFile(f.metrics.metricsFile, []byte(metrics), 0644); err != nil {
 		f.logger.Warnf("Failed to write metrics file: %v", err)
@@ -451,6 +738,37 @@ func (f *Forker) updateMetrics(bytesTransferred, rowsTransferred int64) {
 	}
 }
 
+// Checkpoint returns the progress of the fork so far
+func (f *Forker) Checkpoint() JobCheckpoint {
+	f.metrics.mu.RLock()
+	defer f.metrics.mu.RUnlock()
+
+	return JobCheckpoint{
+		Time:             time.Now(),
+		BytesTransferred: f.metrics.transferredBytes,
+		RowsTransferred:  f.metrics.transferredRows,
+		BytesTotal:       f.metrics.expectedBytes,
+	}
+}
+
+// RecordHeartbeats records a checkpoint of the fork in the job state every
+// HeartbeatInterval until ctx is done, so running jobs report live rates
+func (f *Forker) RecordHeartbeats(ctx context.Context, rm *ResumptionManager) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rm.Checkpoint(f.Checkpoint()); err != nil {
+				f.logger.Warnf("Failed to record job checkpoint: %v", err)
+			}
+		}
+	}
+}
+
 // incrementTableCount increments the processed table count
 func (f *Forker) incrementTableCount() {
 	f.metrics.mu.Lock()
@@ -46,6 +46,85 @@ func BenchmarkForkSameServer(b *testing.B) {
 	}
 }
 
+// createSchemaHeavyDatabase creates a database whose schema has many tables, each
+// with indexes, a foreign key, a function and a trigger, but no rows
+func createSchemaHeavyDatabase(b *testing.B, env *testutil.TestEnvironment, dbName string, tables int) {
+	env.CreateTestDatabase(b, dbName)
+	conn := env.CreateConnection(b, dbName)
+	defer func() { require.NoError(b, conn.Close()) }()
+
+	_, err := conn.Exec(`CREATE TABLE accounts (id SERIAL PRIMARY KEY, email TEXT NOT NULL UNIQUE)`)
+	require.NoError(b, err)
+	for i := 0; i < tables; i++ {
+		_, err := conn.Exec(fmt.Sprintf(`
+			CREATE TABLE items_%[1]d (
+				id SERIAL PRIMARY KEY,
+				account_id INTEGER NOT NULL REFERENCES accounts(id),
+				name TEXT NOT NULL,
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX items_%[1]d_account_idx ON items_%[1]d (account_id);
+			CREATE INDEX items_%[1]d_name_idx ON items_%[1]d (lower(name));
+			CREATE FUNCTION items_%[1]d_touch() RETURNS trigger AS $$
+			BEGIN
+				NEW.updated_at := NOW();
+				RETURN NEW;
+			END;
+			$$ LANGUAGE plpgsql;
+			CREATE TRIGGER items_%[1]d_touch BEFORE UPDATE ON items_%[1]d
+				FOR EACH ROW EXECUTE FUNCTION items_%[1]d_touch();
+		`, i))
+		require.NoError(b, err)
+	}
+}
+
+// benchmarkSchemaFork benchmarks schema-only forks of a schema-heavy database, with
+// or without the minimal schema
+func benchmarkSchemaFork(b *testing.B, minimal bool) {
+	env, cleanup := testutil.SetupTestEnvironment(b)
+	if env == nil {
+		b.Skip("Skipping benchmark, test environment not available")
+		return
+	}
+	defer cleanup()
+
+	sourceDB := "bench_schema_source"
+	createSchemaHeavyDatabase(b, env, sourceDB, 200)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		targetDB := fmt.Sprintf("bench_schema_target_%d", i)
+		cfg := &config.ForkConfig{
+			Source:         *env.GetDatabaseConfig(sourceDB),
+			Destination:    *env.GetDatabaseConfig("postgres"),
+			TargetDatabase: targetDB,
+			DropIfExists:   true,
+			SchemaOnly:     true,
+			MinimalSchema:  minimal,
+			Timeout:        5 * time.Minute,
+		}
+		forker := fork.NewForker(cfg)
+		b.StartTimer()
+
+		err := forker.Fork(context.Background())
+		require.NoError(b, err)
+	}
+}
+
+// BenchmarkForkSchemaOnly benchmarks a full schema-only fork of a schema-heavy database
+func BenchmarkForkSchemaOnly(b *testing.B) {
+	benchmarkSchemaFork(b, false)
+}
+
+// BenchmarkForkMinimalSchema benchmarks a minimal schema fork of the same database,
+// which skips its indexes, constraints, functions and triggers
+func BenchmarkForkMinimalSchema(b *testing.B) {
+	benchmarkSchemaFork(b, true)
+}
+
 // BenchmarkForkCrossServer benchmarks the performance of cross-server forking
 func BenchmarkForkCrossServer(b *testing.B) {
 	// This benchmark requires two separate database instances.
@@ -0,0 +1,97 @@
+package fork
+
+import (
+	"context"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+)
+
+// maintenanceReportTables is how many of the largest tables the post-fork report covers
+const maintenanceReportTables = 10
+
+// reportMaintenance logs the vacuum debt a bulk load leaves on the target: dead
+// tuples, transaction ID age and tables no vacuum has visited yet. With
+// VacuumFreezeTables set it freezes the largest tables straight away, so autovacuum
+// does not have to freeze every loaded row later in one anti-wraparound pass.
+// Problems are logged as warnings; the fork itself has already succeeded.
+func (f *Forker) reportMaintenance(ctx context.Context) {
+	target := f.targetConfig()
+
+	conn, err := db.NewConnectionContext(ctx, &target)
+	if err != nil {
+		f.logger.Warnf("Warning: Skipping vacuum report, failed to connect to target: %v", err)
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Maintenance connection cleanup failed: %v", err)
+		}
+	}()
+
+	limit := maintenanceReportTables
+	if f.config.VacuumFreezeTables > limit {
+		limit = f.config.VacuumFreezeTables
+	}
+	tables, err := conn.TableHealthReport(limit)
+	if err != nil {
+		f.logger.Warnf("Warning: Skipping vacuum report: %v", err)
+		return
+	}
+
+	if f.config.VacuumReport {
+		f.logMaintenanceReport(conn, tables)
+	}
+
+	if f.config.VacuumFreezeTables > 0 {
+		if len(tables) > f.config.VacuumFreezeTables {
+			tables = tables[:f.config.VacuumFreezeTables]
+		}
+		for _, table := range tables {
+			if ctx.Err() != nil {
+				f.logger.Warnf("Warning: Stopping VACUUM FREEZE: %v", ctx.Err())
+				return
+			}
+			f.logger.Infof("Running VACUUM FREEZE on %s.%s (%s)...", table.Schema, table.Table, output.FormatBytes(table.SizeBytes))
+			if err := conn.VacuumFreeze(table); err != nil {
+				f.logger.Warnf("Warning: %v", err)
+			}
+		}
+	}
+}
+
+// logMaintenanceReport logs the statistics of the largest tables and warns about
+// tables close to a forced anti-wraparound vacuum
+func (f *Forker) logMaintenanceReport(conn *db.Connection, tables []db.TableHealth) {
+	freezeMaxAge, err := conn.FreezeMaxAge()
+	if err != nil {
+		f.logger.Debugf("Could not read autovacuum_freeze_max_age: %v", err)
+		freezeMaxAge = 200000000
+	}
+	if age, err := conn.DatabaseXIDAge(); err == nil {
+		f.logger.Infof("Target transaction ID age: %d (forced vacuum at %d)", age, freezeMaxAge)
+	}
+
+	var unvacuumed int64
+	for _, table := range tables {
+		note := ""
+		if table.NeverVacuumed {
+			note = ", not vacuumed yet"
+			unvacuumed += table.LiveTuples
+		}
+		f.logger.Infof("  %s.%s: %s, %d live / %d dead tuples, xid age %d%s",
+			table.Schema, table.Table, output.FormatBytes(table.SizeBytes), table.LiveTuples, table.DeadTuples, table.XIDAge, note)
+
+		if table.XIDAge > freezeMaxAge/2 {
+			f.logger.Warnf("Warning: %s.%s is at %d%% of autovacuum_freeze_max_age; an anti-wraparound vacuum is due soon",
+				table.Schema, table.Table, table.XIDAge*100/freezeMaxAge)
+		}
+		if table.LiveTuples > 0 && table.DeadTuples > table.LiveTuples/5 {
+			f.logger.Warnf("Warning: %s.%s has %d dead tuples; consider VACUUM before use", table.Schema, table.Table, table.DeadTuples)
+		}
+	}
+
+	if unvacuumed > 0 && f.config.VacuumFreezeTables == 0 {
+		f.logger.Infof("%d loaded rows still need freezing; use --vacuum-freeze-tables N to freeze the largest tables now", unvacuumed)
+	}
+}
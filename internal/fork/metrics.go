@@ -0,0 +1,123 @@
+package fork
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// otherTables labels the summed series of the tables past the metrics table limit
+const otherTables = "_other"
+
+// tableMetrics is what was copied of one table with COPY, and how long it took
+type tableMetrics struct {
+	rows     int64
+	bytes    int64
+	duration time.Duration
+}
+
+// recordTable adds copied rows and bytes, or time spent copying, to a table's series
+func (f *Forker) recordTable(table string, bytesTransferred, rowsTransferred int64, elapsed time.Duration) {
+	f.metrics.mu.Lock()
+	defer f.metrics.mu.Unlock()
+
+	if f.metrics.tables == nil {
+		f.metrics.tables = make(map[string]*tableMetrics)
+	}
+	t := f.metrics.tables[table]
+	if t == nil {
+		t = &tableMetrics{}
+		f.metrics.tables[table] = t
+	}
+	t.rows += rowsTransferred
+	t.bytes += bytesTransferred
+	t.duration += elapsed
+}
+
+// writeTableMetrics writes the per-table series labelled by job, source and target
+// database. To bound their cardinality only the limit tables that took longest get
+// series of their own; the rest are summed under table="_other". The caller holds
+// the metrics lock.
+func (f *Forker) writeTableMetrics(w *strings.Builder, limit int) {
+	if limit <= 0 || len(f.metrics.tables) == 0 {
+		return
+	}
+	names := make([]string, 0, len(f.metrics.tables))
+	for name := range f.metrics.tables {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := f.metrics.tables[names[i]], f.metrics.tables[names[j]]
+		if a.duration != b.duration {
+			return a.duration > b.duration
+		}
+		return names[i] < names[j]
+	})
+
+	series := make(map[string]*tableMetrics, limit+1)
+	labels := make([]string, 0, limit+1)
+	for i, name := range names {
+		t := f.metrics.tables[name]
+		if i >= limit {
+			name = otherTables
+		}
+		s := series[name]
+		if s == nil {
+			s = &tableMetrics{}
+			series[name] = s
+			labels = append(labels, name)
+		}
+		s.rows += t.rows
+		s.bytes += t.bytes
+		s.duration += t.duration
+	}
+
+	for _, metric := range []struct {
+		name, help string
+		value      func(*tableMetrics) string
+	}{
+		{"postgres_fork_table_rows", "Rows copied per table", func(t *tableMetrics) string { return fmt.Sprint(t.rows) }},
+		{"postgres_fork_table_bytes", "Bytes copied per table", func(t *tableMetrics) string { return fmt.Sprint(t.bytes) }},
+		{"postgres_fork_table_duration_seconds", "Time spent copying per table", func(t *tableMetrics) string { return fmt.Sprintf("%f", t.duration.Seconds()) }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for _, table := range labels {
+			fmt.Fprintf(w, "%s%s %s\n", metric.name, promLabels(
+				"job", f.config.JobID,
+				"source", f.config.Source.Database,
+				"target", f.config.TargetDatabase,
+				"table", table,
+			), metric.value(series[table]))
+		}
+	}
+}
+
+// writePhaseMetrics writes the time spent in each phase of the fork, labelled by job,
+// source and target database and phase
+func (f *Forker) writePhaseMetrics(w *strings.Builder) {
+	phases := f.report.PhaseTotals()
+	if len(phases) == 0 {
+		return
+	}
+	const name = "postgres_fork_phase_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time spent per fork phase\n# TYPE %s gauge\n", name, name)
+	for _, phase := range phases {
+		fmt.Fprintf(w, "%s%s %f\n", name, promLabels(
+			"job", f.config.JobID,
+			"source", f.config.Source.Database,
+			"target", f.config.TargetDatabase,
+			"phase", phase.Name,
+		), float64(phase.DurationMs)/1000)
+	}
+}
+
+// promLabels formats label name and value pairs in the Prometheus text format
+func promLabels(pairs ...string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escape.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
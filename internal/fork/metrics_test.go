@@ -0,0 +1,63 @@
+package fork
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTableMetrics(t *testing.T) {
+	f := &Forker{
+		config: &config.ForkConfig{
+			JobID:          "nightly",
+			Source:         config.DatabaseConfig{Database: "app"},
+			TargetDatabase: "app_copy",
+		},
+		metrics: &MetricsCollector{},
+	}
+	f.recordTable("public.orders", 4000, 100, 0)
+	f.recordTable("public.orders", 0, 0, 3*time.Second)
+	f.recordTable("public.users", 500, 10, time.Second)
+	f.recordTable("audit.events", 200, 5, 2*time.Second)
+
+	var w strings.Builder
+	f.writeTableMetrics(&w, 2)
+	out := w.String()
+	assert.Contains(t, out, "# TYPE postgres_fork_table_rows gauge\n")
+	assert.Contains(t, out, `postgres_fork_table_rows{job="nightly",source="app",target="app_copy",table="public.orders"} 100`+"\n")
+	assert.Contains(t, out, `postgres_fork_table_bytes{job="nightly",source="app",target="app_copy",table="audit.events"} 200`+"\n")
+	assert.Contains(t, out, `postgres_fork_table_duration_seconds{job="nightly",source="app",target="app_copy",table="_other"} 1.000000`+"\n")
+	assert.NotContains(t, out, "public.users")
+
+	w.Reset()
+	f.writeTableMetrics(&w, 0)
+	assert.Empty(t, w.String())
+}
+
+func TestWritePhaseMetrics(t *testing.T) {
+	f := &Forker{
+		config: &config.ForkConfig{
+			JobID:          "nightly",
+			Source:         config.DatabaseConfig{Database: "app"},
+			TargetDatabase: "app_copy",
+		},
+		metrics: &MetricsCollector{},
+	}
+	var w strings.Builder
+	f.writePhaseMetrics(&w)
+	assert.Empty(t, w.String())
+
+	f.report = &Report{Phases: []Phase{{Name: "data", DurationMs: 2500}, {Name: "indexes", DurationMs: 41302}}}
+	f.writePhaseMetrics(&w)
+	out := w.String()
+	assert.Contains(t, out, "# TYPE postgres_fork_phase_duration_seconds gauge\n")
+	assert.Contains(t, out, `postgres_fork_phase_duration_seconds{job="nightly",source="app",target="app_copy",phase="data"} 2.500000`+"\n")
+	assert.Contains(t, out, `postgres_fork_phase_duration_seconds{job="nightly",source="app",target="app_copy",phase="indexes"} 41.302000`+"\n")
+}
+
+func TestPromLabels(t *testing.T) {
+	assert.Equal(t, `{job="a\"b",table="x\\y\nz"}`, promLabels("job", `a"b`, "table", "x\\y\nz"))
+}
@@ -0,0 +1,178 @@
+package fork
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// minimalSchemaEntries decides which pg_restore table of contents entries a minimal
+// schema restores, by the entry type that starts their description. The first
+// matching prefix wins, so longer types come before the types they extend.
+var minimalSchemaEntries = []struct {
+	prefix string
+	keep   bool
+}{
+	{"TABLE DATA ", false},
+	{"TABLE ATTACH ", true},
+	{"TABLE ", true},
+	{"VIEW ", true},
+	{"SEQUENCE SET ", false},
+	{"SEQUENCE OWNED BY ", true},
+	{"SEQUENCE ", true},
+	{"DEFAULT ACL ", false},
+	{"DEFAULT ", true},
+	{"TYPE ", true},
+	{"DOMAIN ", true},
+	{"SCHEMA ", true},
+	{"EXTENSION ", true},
+}
+
+// minimalSchemaRoutines are the entry types a minimal schema restores only when a kept
+// object depends on them
+var minimalSchemaRoutines = []string{"FUNCTION ", "AGGREGATE "}
+
+// tocEntry is an entry of a pg_restore --list --verbose
+type tocEntry struct {
+	line string
+	desc string
+	// deps are the dump ids of the entries it depends on
+	deps []string
+	keep bool
+}
+
+// filterMinimalSchema keeps the entries of a pg_restore --list --verbose that a
+// minimal schema restores: schemas, extensions, types, domains, tables, views,
+// sequences and column defaults, and the functions and aggregates those call, say in
+// a view, default or check constraint, with what the functions call in turn.
+// Triggers, indexes, constraints, rules, policies and everything else is dropped, as
+// is every comment line.
+func filterMinimalSchema(toc []byte) []byte {
+	var entries []*tocEntry
+	byID := make(map[string]*tocEntry)
+	scanner := bufio.NewScanner(bytes.NewReader(toc))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ";") {
+			// ;	depends on: <dump id> ...
+			if _, deps, ok := strings.Cut(line, "depends on:"); ok && len(entries) > 0 {
+				last := entries[len(entries)-1]
+				last.deps = append(last.deps, strings.Fields(deps)...)
+			}
+			continue
+		}
+		// <dump id>; <catalog oid> <object oid> <type> <schema> <name> <owner>
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		entry := &tocEntry{line: line, desc: strings.Join(fields[3:], " ") + " "}
+		for _, kind := range minimalSchemaEntries {
+			if strings.HasPrefix(entry.desc, kind.prefix) {
+				entry.keep = kind.keep
+				break
+			}
+		}
+		entries = append(entries, entry)
+		byID[strings.TrimSuffix(fields[0], ";")] = entry
+	}
+
+	// Routines the kept entries depend on are kept, and so on for their dependencies
+	var queue []*tocEntry
+	for _, entry := range entries {
+		if entry.keep {
+			queue = append(queue, entry)
+		}
+	}
+	for len(queue) > 0 {
+		entry := queue[0]
+		queue = queue[1:]
+		for _, id := range entry.deps {
+			dep := byID[id]
+			if dep == nil || dep.keep || !isRoutine(dep.desc) {
+				continue
+			}
+			dep.keep = true
+			queue = append(queue, dep)
+		}
+	}
+
+	var out bytes.Buffer
+	for _, entry := range entries {
+		if entry.keep {
+			out.WriteString(entry.line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// isRoutine reports whether a table of contents entry description is a function or
+// aggregate
+func isRoutine(desc string) bool {
+	for _, prefix := range minimalSchemaRoutines {
+		if strings.HasPrefix(desc, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// transferMinimalSchema restores only the objects a unit test needs to read and write
+// rows: tables, views and the types, sequences, defaults and functions they use.
+// Skipping other functions, triggers, indexes and constraints makes the restore much
+// faster on large schemas. The dump goes to a file, as pg_restore needs a seekable archive to
+// restore from a filtered list.
+func (dtm *DataTransferManager) transferMinimalSchema(ctx context.Context) error {
+	dtm.logger.Info("Transferring minimal schema (tables, views and types) using pg_dump and pg_restore...")
+
+	dir, err := os.MkdirTemp(dtm.spoolDir(), "pgfork-schema-")
+	if err != nil {
+		return fmt.Errorf("failed to create schema dump directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			dtm.logger.Warnf("Failed to remove schema dump directory %s: %v", dir, err)
+		}
+	}()
+	list := filepath.Join(dir, "schema.list")
+	archive, err := dtm.schemaArchive(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	// The verbose list holds the dependencies of every entry
+	listCmd := exec.CommandContext(ctx, "pg_restore", "--list", "--verbose", archive)
+	listStderr := subprocessStderr(dtm.logger)
+	defer listStderr.Close()
+	listCmd.Stderr = listStderr
+	toc, err := listCmd.Output()
+	if err != nil {
+		return fmt.Errorf("pg_restore (list) failed: %w", err)
+	}
+	if err := os.WriteFile(list, filterMinimalSchema(toc), 0o600); err != nil {
+		return fmt.Errorf("failed to write restore list: %w", err)
+	}
+
+	restoreCmd := exec.CommandContext(ctx, "pg_restore",
+		"--use-list="+list,
+		"-d", dtm.destCfg.ConnectionString(),
+		archive,
+	)
+	restoreCmd.Stdout = os.Stdout
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = restoreStderr
+	restoreCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.destCfg.Password)
+	if err := dtm.checkRestore(restoreCmd.Run(), "schema"); err != nil {
+		return err
+	}
+
+	dtm.logger.Info("Minimal schema transfer completed successfully")
+	return nil
+}
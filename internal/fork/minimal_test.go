@@ -0,0 +1,69 @@
+package fork
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMinimalSchema(t *testing.T) {
+	toc := `;
+; Archive created at 2024-01-01 00:00:00 UTC
+;
+2; 3079 16385 EXTENSION - citext
+3; 2615 2200 SCHEMA - public postgres
+600; 1247 16400 TYPE public mood postgres
+215; 1255 16401 FUNCTION public touch() postgres
+216; 1259 16402 TABLE public users postgres
+217; 1259 16403 SEQUENCE public users_id_seq postgres
+3300; 0 0 SEQUENCE OWNED BY public users_id_seq postgres
+3301; 2604 16404 DEFAULT public users id postgres
+218; 1259 16405 VIEW public active_users postgres
+3302; 0 16406 TABLE ATTACH public events_2024 postgres
+3303; 2606 16407 CONSTRAINT public users users_pkey postgres
+3304; 1259 16408 INDEX public users_email_idx postgres
+3305; 2620 16409 TRIGGER public users users_touch postgres
+3306; 2606 16410 FK CONSTRAINT public orders orders_user_id_fkey postgres
+3307; 0 0 SEQUENCE SET public users_id_seq postgres
+3308; 0 16402 TABLE DATA public users postgres
+3309; 826 16411 DEFAULT ACL - DEFAULT PRIVILEGES FOR TABLES postgres
+`
+
+	assert.Equal(t, `2; 3079 16385 EXTENSION - citext
+3; 2615 2200 SCHEMA - public postgres
+600; 1247 16400 TYPE public mood postgres
+216; 1259 16402 TABLE public users postgres
+217; 1259 16403 SEQUENCE public users_id_seq postgres
+3300; 0 0 SEQUENCE OWNED BY public users_id_seq postgres
+3301; 2604 16404 DEFAULT public users id postgres
+218; 1259 16405 VIEW public active_users postgres
+3302; 0 16406 TABLE ATTACH public events_2024 postgres
+`, string(filterMinimalSchema([]byte(toc))))
+}
+
+func TestFilterMinimalSchema_Dependencies(t *testing.T) {
+	// pg_restore --list --verbose follows each entry with its dependencies
+	toc := `3; 2615 2200 SCHEMA - public postgres
+214; 1255 16400 FUNCTION public slugify(text) postgres
+215; 1255 16401 FUNCTION public new_id() postgres
+;	depends on: 214
+216; 1255 16402 FUNCTION public touch() postgres
+217; 1259 16403 TABLE public users postgres
+3301; 2604 16404 DEFAULT public users id postgres
+;	depends on: 215 217
+218; 1259 16405 VIEW public user_slugs postgres
+;	depends on: 214 217
+3305; 2620 16406 TRIGGER public users users_touch postgres
+;	depends on: 216 217
+`
+
+	// The view and the default keep the functions they call, and new_id what it calls;
+	// the trigger and its function are dropped
+	assert.Equal(t, `3; 2615 2200 SCHEMA - public postgres
+214; 1255 16400 FUNCTION public slugify(text) postgres
+215; 1255 16401 FUNCTION public new_id() postgres
+217; 1259 16403 TABLE public users postgres
+3301; 2604 16404 DEFAULT public users id postgres
+218; 1259 16405 VIEW public user_slugs postgres
+`, string(filterMinimalSchema([]byte(toc))))
+}
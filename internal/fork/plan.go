@@ -0,0 +1,476 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
+)
+
+// Method is how the target database gets its contents
+type Method string
+
+const (
+	// MethodTemplate clones the source with CREATE DATABASE ... TEMPLATE on the same server
+	MethodTemplate Method = "template"
+	// MethodTransfer copies schema and data with pg_dump/pg_restore and COPY
+	MethodTransfer Method = "transfer"
+)
+
+// Plan is the decision of how a fork will run. Dry runs, validation and the forker
+// all work from the same plan, so what is previewed is what runs.
+type Plan struct {
+	Method     Method `json:"method"`
+	SameServer bool   `json:"same_server"`
+	// Reason explains why the method was chosen
+	Reason string `json:"reason"`
+	// Provider is the managed service hosting the destination, when it is one, and
+	// Downgrades what its restrictions change about the fork
+	Provider   string   `json:"provider,omitempty"`
+	Downgrades []string `json:"downgrades,omitempty"`
+
+	SchemaOnly    bool     `json:"schema_only,omitempty"`
+	MinimalSchema bool     `json:"minimal_schema,omitempty"`
+	DataOnly      bool     `json:"data_only,omitempty"`
+	IncludeTables []string `json:"include_tables,omitempty"`
+	ExcludeTables []string `json:"exclude_tables,omitempty"`
+	// TablePatternMode is regex when the table lists are regular expressions
+	TablePatternMode string `json:"table_pattern_mode,omitempty"`
+	// Tables lists the tables with their own settings, merged over the fork-wide ones
+	Tables []TablePlan `json:"tables,omitempty"`
+	// TableGroups lists the selected tables of each table group, read in one snapshot
+	TableGroups map[string][]string `json:"table_groups,omitempty"`
+
+	MaxConnections int `json:"max_connections,omitempty"`
+	ChunkSize      int `json:"chunk_size,omitempty"`
+	// WorkDir is where files are spooled, when the fork spools any
+	WorkDir string `json:"work_dir,omitempty"`
+	// StandbyChunking copies the data of a standby source in short reads
+	StandbyChunking bool `json:"standby_chunking,omitempty"`
+	// VerifySample is how many copied rows of each table are compared with the source
+	// every VerifyInterval while the data loads
+	VerifySample   int    `json:"verify_sample,omitempty"`
+	VerifyInterval string `json:"verify_interval,omitempty"`
+
+	// WaitForSourceIdle is how long a template clone waits for other sessions to
+	// leave the source
+	WaitForSourceIdle string `json:"wait_for_source_idle,omitempty"`
+	// BackupBeforeDrop is the kind of dump taken of an existing target before it is
+	// dropped
+	BackupBeforeDrop string `json:"backup_before_drop,omitempty"`
+	// OnTableError is continue or retry when a failed table copy does not fail the
+	// fork outright
+	OnTableError string `json:"on_table_error,omitempty"`
+
+	// Steps lists what runs on the target after it is populated, in order
+	Steps []string `json:"steps,omitempty"`
+}
+
+// TablePlan is how one table with its own settings is forked
+type TablePlan struct {
+	Table          string   `json:"table"`
+	SchemaOnly     bool     `json:"schema_only,omitempty"`
+	Where          string   `json:"where,omitempty"`
+	MaskingProfile string   `json:"masking_profile,omitempty"`
+	MaskedColumns  []string `json:"masked_columns,omitempty"`
+	Transform      []string `json:"transform,omitempty"`
+	ChunkSize      int      `json:"chunk_size,omitempty"`
+	Parallelism    int      `json:"parallelism,omitempty"`
+}
+
+// NewPlan decides how the configured fork will run
+func NewPlan(cfg *config.ForkConfig) *Plan {
+	p := &Plan{
+		SameServer:    cfg.IsSameServer(),
+		SchemaOnly:    cfg.SchemaOnly,
+		MinimalSchema: cfg.MinimalSchema,
+		DataOnly:      cfg.DataOnly,
+		IncludeTables: cfg.IncludeTables,
+		ExcludeTables: cfg.ExcludeTables,
+	}
+	if cfg.TablePatternMode == config.TablePatternRegex {
+		p.TablePatternMode = cfg.TablePatternMode
+	}
+
+	// Template cloning copies everything, so selective forks need a transfer even on
+	// the same server
+	var selective []string
+	if cfg.SchemaOnly {
+		selective = append(selective, "schema-only")
+	}
+	if len(cfg.IncludeTables) > 0 {
+		selective = append(selective, "include-tables")
+	}
+	if len(cfg.ExcludeTables) > 0 {
+		selective = append(selective, "exclude-tables")
+	}
+	names := make([]string, 0, len(cfg.Tables))
+	for name := range cfg.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	overridden := false
+	for _, name := range names {
+		settings := cfg.TableSettings(name)
+		table := TablePlan{
+			Table:          name,
+			SchemaOnly:     settings.SchemaOnly,
+			Where:          settings.Where,
+			MaskingProfile: settings.MaskingProfile,
+			Transform:      settings.Transform,
+		}
+		for _, rule := range settings.Masking {
+			table.MaskedColumns = append(table.MaskedColumns, rule.Column)
+		}
+		if cfg.Tables[name].Copied() {
+			table.ChunkSize = settings.ChunkSize
+			table.Parallelism = settings.Parallelism
+		}
+		p.Tables = append(p.Tables, table)
+		overridden = overridden || settings.Selective()
+	}
+	if overridden {
+		selective = append(selective, "per-table settings")
+	}
+
+	switch {
+	case p.SameServer && cfg.ForceTransfer:
+		p.Method = MethodTransfer
+		p.Reason = "same server, but a transfer was requested"
+	case p.SameServer && len(selective) == 0:
+		p.Method = MethodTemplate
+		p.Reason = "source and destination are on the same server"
+	case p.SameServer:
+		p.Method = MethodTransfer
+		p.Reason = fmt.Sprintf("same server, but %s needs a selective copy that template cloning cannot do",
+			strings.Join(selective, " and "))
+	default:
+		p.Method = MethodTransfer
+		p.Reason = "source and destination are on different servers"
+	}
+	// A named provider is known before connecting; auto is detected by the forker
+	if profile, ok := provider.Lookup(cfg.Provider); ok {
+		p.ApplyProvider(cfg, profile)
+	}
+
+	if p.Method == MethodTransfer {
+		p.MaxConnections = cfg.MaxConnections
+		p.ChunkSize = cfg.ChunkSize
+		p.StandbyChunking = cfg.StandbyChunking && !cfg.SchemaOnly
+		for name, tables := range cfg.TableGroups {
+			if tables = p.FilterTables(tables); len(tables) > 0 && !cfg.SchemaOnly {
+				if p.TableGroups == nil {
+					p.TableGroups = make(map[string][]string)
+				}
+				p.TableGroups[name] = tables
+			}
+		}
+		if cfg.VerifySample > 0 && !cfg.SchemaOnly {
+			p.VerifySample = cfg.VerifySample
+			p.VerifyInterval = cfg.VerifyInterval.String()
+		}
+		if cfg.MinimalSchema && !cfg.DataOnly {
+			p.WorkDir = workDirBase(cfg.WorkDir)
+		}
+	}
+
+	if cfg.DropIfExists {
+		p.BackupBeforeDrop = cfg.BackupBeforeDrop
+	}
+	if cfg.WaitForSourceIdle > 0 {
+		p.WaitForSourceIdle = cfg.WaitForSourceIdle.String()
+	}
+	if cfg.OnTableError != "abort" {
+		p.OnTableError = cfg.OnTableError
+	}
+
+	if cfg.SynthesizeData {
+		step := fmt.Sprintf("generate synthetic data (%d rows per table", cfg.SynthesizeRows)
+		if len(cfg.SynthesizeTableRows) > 0 {
+			step += fmt.Sprintf(", overrides: %v", cfg.SynthesizeTableRows)
+		}
+		p.Steps = append(p.Steps, step+")")
+	}
+	if seed := DescribeSeed(cfg.Seed, cfg.Hooks.Seed); seed != "" {
+		p.Steps = append(p.Steps, "seed: "+seed)
+	}
+	if cfg.Deterministic {
+		p.Steps = append(p.Steps, "order rows by primary key and reset sequences from the data (deterministic)")
+	}
+	if cfg.VacuumFreezeTables > 0 {
+		p.Steps = append(p.Steps, fmt.Sprintf("VACUUM FREEZE on the %d largest tables", cfg.VacuumFreezeTables))
+	}
+	switch cfg.Bench {
+	case "":
+	case config.BenchBuiltin:
+		p.Steps = append(p.Steps, fmt.Sprintf("benchmark random primary-key reads with %d clients for %s", cfg.MaxConnections, cfg.BenchDuration))
+	default:
+		p.Steps = append(p.Steps, "benchmark: "+cfg.Bench)
+	}
+	if settings := targetSettings(cfg); !settings.Empty() {
+		p.Steps = append(p.Steps, "set "+settings.Describe())
+	}
+
+	return p
+}
+
+// VerifyCluster confirms a template plan against the identities of the source and
+// destination servers. Host names can match while pointing at different clusters,
+// and cloning would then copy whatever database has the source's name on the
+// destination, so a mismatch switches the plan to a transfer.
+func (p *Plan) VerifyCluster(cfg *config.ForkConfig, source, destination db.ClusterIdentity) {
+	if p.Method != MethodTemplate || source.SameCluster(destination) {
+		return
+	}
+	p.SameServer = false
+	p.useTransfer(cfg, "source and destination addresses match, but they are different clusters")
+}
+
+// ApplyProvider adapts the plan to the managed service hosting the destination,
+// recording its downgrades and switching a template plan to a transfer where the
+// service cannot clone databases
+func (p *Plan) ApplyProvider(cfg *config.ForkConfig, profile provider.Profile) {
+	p.Provider = ""
+	p.Downgrades = nil
+	if !profile.Managed() {
+		return
+	}
+	p.Provider = profile.Name
+	p.Downgrades = profile.Downgrades()
+	if p.Method == MethodTemplate && profile.TemplateClone == provider.TemplateNone {
+		p.useTransfer(cfg, fmt.Sprintf("same server, but %s does not support template cloning", profile.Title))
+	}
+}
+
+// VerifyTemplateOwner confirms a template plan on a service that only lets the owner
+// of a database clone it, switching to a transfer when the destination user does not
+// own the source
+func (p *Plan) VerifyTemplateOwner(cfg *config.ForkConfig, profile provider.Profile, owner bool) {
+	if p.Method != MethodTemplate || profile.TemplateClone != provider.TemplateOwned || owner {
+		return
+	}
+	p.useTransfer(cfg, fmt.Sprintf("same server, but %s only lets the owner of the source clone it", profile.Title))
+}
+
+// useTransfer switches the plan to a transfer with the configured transfer settings
+func (p *Plan) useTransfer(cfg *config.ForkConfig, reason string) {
+	p.Method = MethodTransfer
+	p.Reason = reason
+	p.MaxConnections = cfg.MaxConnections
+	p.ChunkSize = cfg.ChunkSize
+}
+
+// Spools reports whether the fork writes files to its work directory, which only the
+// minimal schema dump does as pg_restore needs a seekable archive to filter
+func (p *Plan) Spools() bool {
+	return p.WorkDir != ""
+}
+
+// Describe returns the plan as human-readable lines
+func (p *Plan) Describe() []string {
+	var lines []string
+	if p.Method == MethodTemplate {
+		lines = append(lines, "Method: Same-server template-based cloning (fast)")
+	} else {
+		lines = append(lines, "Method: Cross-server data transfer with COPY operations")
+		lines = append(lines, fmt.Sprintf("Settings: %d max connections, %d chunk size", p.MaxConnections, p.ChunkSize))
+	}
+	lines = append(lines, "Reason: "+p.Reason)
+	if p.Method == MethodTemplate && p.WaitForSourceIdle != "" {
+		lines = append(lines, "Waiting up to "+p.WaitForSourceIdle+" for other sessions to leave the source")
+	}
+	if p.Provider != "" {
+		lines = append(lines, "Provider: "+p.Provider)
+		for _, downgrade := range p.Downgrades {
+			lines = append(lines, "Downgrade: "+downgrade)
+		}
+	}
+
+	patterns := ""
+	if p.TablePatternMode == config.TablePatternRegex {
+		patterns = " matching"
+	}
+	if len(p.IncludeTables) > 0 {
+		lines = append(lines, fmt.Sprintf("Including only tables%s: %v", patterns, p.IncludeTables))
+	} else if len(p.ExcludeTables) > 0 {
+		lines = append(lines, fmt.Sprintf("Excluding tables%s: %v", patterns, p.ExcludeTables))
+	}
+	if p.MinimalSchema {
+		lines = append(lines, "Transferring minimal schema only: schemas, types, tables, views and sequences (no functions, triggers, indexes, constraints or data)")
+	} else if p.SchemaOnly {
+		lines = append(lines, "Transferring schema only (no data)")
+	}
+	switch p.BackupBeforeDrop {
+	case "schema":
+		lines = append(lines, "Backing up the schema and small tables of an existing target before dropping it")
+	case "full":
+		lines = append(lines, "Backing up an existing target in full before dropping it")
+	}
+	if p.DataOnly {
+		lines = append(lines, "Transferring data only (no schema)")
+	}
+	if p.Spools() {
+		lines = append(lines, "Spooling the schema dump to "+p.WorkDir)
+	}
+	if p.StandbyChunking {
+		lines = append(lines, "Copying data in short reads if the source is a standby that cancels long queries")
+	}
+	switch p.OnTableError {
+	case "continue":
+		lines = append(lines, "Continuing with the other tables when a table copy fails, and reporting it")
+	case "retry":
+		lines = append(lines, fmt.Sprintf("Retrying a failed table copy up to %d times before failing", tableCopyAttempts-1))
+	}
+	if p.VerifySample > 0 {
+		lines = append(lines, fmt.Sprintf("Comparing %d sampled rows per table with the source every %s while copying", p.VerifySample, p.VerifyInterval))
+	}
+	for _, table := range p.Tables {
+		lines = append(lines, fmt.Sprintf("Table %s: %s", table.Table, table.describe()))
+	}
+	groups := make([]string, 0, len(p.TableGroups))
+	for name := range p.TableGroups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, name := range groups {
+		lines = append(lines, fmt.Sprintf("Table group %s: %s read in one snapshot", name, strings.Join(p.TableGroups[name], ", ")))
+	}
+	for _, step := range p.Steps {
+		lines = append(lines, "Then: "+step)
+	}
+	return lines
+}
+
+// describe summarises the table's settings
+func (t TablePlan) describe() string {
+	if t.SchemaOnly {
+		return "schema only (no data)"
+	}
+	var parts []string
+	if t.Where != "" {
+		parts = append(parts, "rows where "+t.Where)
+	}
+	if t.MaskingProfile != "" {
+		parts = append(parts, fmt.Sprintf("masked with profile %s (%s)", t.MaskingProfile, strings.Join(t.MaskedColumns, ", ")))
+	}
+	if len(t.Transform) > 0 {
+		parts = append(parts, "transformed by "+strings.Join(t.Transform, " "))
+	}
+	if t.ChunkSize > 0 {
+		parts = append(parts, fmt.Sprintf("%d rows per chunk", t.ChunkSize))
+	}
+	if t.Parallelism > 1 {
+		parts = append(parts, fmt.Sprintf("%d connections", t.Parallelism))
+	}
+	if len(parts) == 0 {
+		return "fork-wide settings"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FilterTables applies the include and exclude patterns to tables named as in the
+// fork's table lists; an include list wins over an exclude list. Invalid patterns,
+// which validation rejects, match nothing.
+func (p *Plan) FilterTables(tables []string) []string {
+	if len(p.IncludeTables) == 0 && len(p.ExcludeTables) == 0 {
+		return tables
+	}
+	filter, err := config.NewTableFilter(p.IncludeTables, p.ExcludeTables, p.TablePatternMode)
+	if err != nil {
+		return nil
+	}
+	var filtered []string
+	for _, table := range tables {
+		if filter.Includes(table) {
+			filtered = append(filtered, table)
+		}
+	}
+	return filtered
+}
+
+// ResolveTables returns the source tables the table filters keep, sorted, for the
+// steps that need exact names rather than patterns. An include list matching no
+// table is an error.
+func (p *Plan) ResolveTables(ctx context.Context, source *db.Connection) ([]string, error) {
+	sizes, err := source.GetTableDataSizesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source tables: %w", err)
+	}
+	tables := make([]string, 0, len(sizes))
+	for table := range sizes {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	selected := p.FilterTables(tables)
+	if len(p.IncludeTables) > 0 && len(selected) == 0 {
+		return nil, fmt.Errorf("no source table matches the include list %v", p.IncludeTables)
+	}
+	return selected, nil
+}
+
+// TransferSizes returns the data size of each table a transfer copies: heap and TOAST,
+// without indexes, which are not part of the dumped data. Schema-only forks copy no
+// data.
+func (p *Plan) TransferSizes(ctx context.Context, source *db.Connection) (map[string]int64, error) {
+	if p.SchemaOnly {
+		return map[string]int64{}, nil
+	}
+
+	sizes, err := source.GetTableDataSizesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]string, 0, len(sizes))
+	for table := range sizes {
+		tables = append(tables, table)
+	}
+	selected := make(map[string]int64)
+	for _, table := range p.FilterTables(tables) {
+		if !p.schemaOnlyTable(table) {
+			selected[table] = sizes[table]
+		}
+	}
+	return selected, nil
+}
+
+// schemaOnlyTable reports whether the table's settings leave out its rows
+func (p *Plan) schemaOnlyTable(table string) bool {
+	for _, t := range p.Tables {
+		if t.SchemaOnly && strings.TrimPrefix(t.Table, "public.") == strings.TrimPrefix(table, "public.") {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateBytes estimates how much data the fork copies, using a connection to the
+// source database: the whole database for unfiltered forks, the selected tables for
+// filtered ones and nothing for schema-only forks
+func (p *Plan) EstimateBytes(source *db.Connection, database string) (int64, error) {
+	if p.SchemaOnly {
+		return 0, nil
+	}
+	if len(p.IncludeTables) == 0 && len(p.ExcludeTables) == 0 && len(p.Tables) == 0 {
+		return source.GetDatabaseSize(database)
+	}
+
+	sizes, err := source.GetTableSizes("public")
+	if err != nil {
+		return 0, err
+	}
+	tables := make([]string, 0, len(sizes))
+	for table := range sizes {
+		tables = append(tables, table)
+	}
+	var total int64
+	for _, table := range p.FilterTables(tables) {
+		if !p.schemaOnlyTable(table) {
+			total += sizes[table]
+		}
+	}
+	return total, nil
+}
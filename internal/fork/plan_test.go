@@ -0,0 +1,316 @@
+package fork
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func planConfig() *config.ForkConfig {
+	server := config.DatabaseConfig{Host: "localhost", Port: 5432, Username: "user"}
+	cfg := &config.ForkConfig{
+		Source:         server,
+		Destination:    server,
+		TargetDatabase: "target",
+		MaxConnections: 4,
+		ChunkSize:      1000,
+	}
+	cfg.Source.Database = "source"
+	return cfg
+}
+
+func TestNewPlan(t *testing.T) {
+	cfg := planConfig()
+	plan := NewPlan(cfg)
+	assert.Equal(t, MethodTemplate, plan.Method)
+	assert.True(t, plan.SameServer)
+	assert.Zero(t, plan.MaxConnections)
+
+	cfg.ExcludeTables = []string{"audit_log"}
+	cfg.SchemaOnly = true
+	plan = NewPlan(cfg)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.True(t, plan.SameServer)
+	assert.Contains(t, plan.Reason, "schema-only and exclude-tables")
+	assert.Equal(t, 4, plan.MaxConnections)
+
+	cfg = planConfig()
+	cfg.ForceTransfer = true
+	plan = NewPlan(cfg)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.Equal(t, "same server, but a transfer was requested", plan.Reason)
+
+	cfg = planConfig()
+	cfg.Destination.Host = "replica.example.com"
+	cfg.VacuumFreezeTables = 3
+	plan = NewPlan(cfg)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.False(t, plan.SameServer)
+	assert.Equal(t, []string{"VACUUM FREEZE on the 3 largest tables"}, plan.Steps)
+	assert.Contains(t, plan.Describe(), "Reason: source and destination are on different servers")
+
+	cfg.Deterministic = true
+	plan = NewPlan(cfg)
+	assert.Equal(t, []string{
+		"order rows by primary key and reset sequences from the data (deterministic)",
+		"VACUUM FREEZE on the 3 largest tables",
+	}, plan.Steps)
+
+	cfg.StandbyChunking = true
+	plan = NewPlan(cfg)
+	assert.True(t, plan.StandbyChunking)
+	cfg.VerifySample = 100
+	cfg.VerifyInterval = 30 * time.Second
+	plan = NewPlan(cfg)
+	assert.Equal(t, 100, plan.VerifySample)
+	assert.Contains(t, plan.Describe(), "Comparing 100 sampled rows per table with the source every 30s while copying")
+	cfg.SchemaOnly = true
+	assert.False(t, NewPlan(cfg).StandbyChunking)
+	assert.Zero(t, NewPlan(cfg).VerifySample)
+
+	cfg.Deterministic = false
+	cfg.VacuumFreezeTables = 0
+	cfg.Bench = config.BenchBuiltin
+	cfg.BenchDuration = time.Minute
+	assert.Equal(t, []string{"benchmark random primary-key reads with 4 clients for 1m0s"}, NewPlan(cfg).Steps)
+	cfg.Bench = "pgbench -c 4 -T 30 -S"
+	assert.Contains(t, NewPlan(cfg).Describe(), "Then: benchmark: pgbench -c 4 -T 30 -S")
+}
+
+func TestNewPlan_WaitForSourceIdle(t *testing.T) {
+	cfg := planConfig()
+	cfg.WaitForSourceIdle = 2 * time.Minute
+	assert.Contains(t, NewPlan(cfg).Describe(), "Waiting up to 2m0s for other sessions to leave the source")
+
+	// Transfers read the source without cloning it
+	cfg.SchemaOnly = true
+	assert.NotContains(t, NewPlan(cfg).Describe(), "Waiting up to 2m0s for other sessions to leave the source")
+}
+
+func TestNewPlan_OnTableError(t *testing.T) {
+	cfg := planConfig()
+	cfg.OnTableError = "abort"
+	assert.Empty(t, NewPlan(cfg).OnTableError)
+
+	cfg.OnTableError = "retry"
+	assert.Contains(t, NewPlan(cfg).Describe(), "Retrying a failed table copy up to 2 times before failing")
+}
+
+func TestNewPlan_TargetSettings(t *testing.T) {
+	cfg := planConfig()
+	assert.Empty(t, NewPlan(cfg).Steps)
+
+	cfg.TargetOwner = "app_owner"
+	cfg.TargetConnectionLimit = 20
+	cfg.TargetIsTemplate = true
+	assert.Equal(t, []string{"set owner app_owner, connection limit 20, is_template true"}, NewPlan(cfg).Steps)
+}
+
+func TestNewPlan_BackupBeforeDrop(t *testing.T) {
+	cfg := planConfig()
+	cfg.BackupBeforeDrop = "schema"
+	assert.Empty(t, NewPlan(cfg).BackupBeforeDrop, "nothing is dropped without drop-if-exists")
+
+	cfg.DropIfExists = true
+	assert.Contains(t, NewPlan(cfg).Describe(), "Backing up the schema and small tables of an existing target before dropping it")
+	cfg.BackupBeforeDrop = "full"
+	assert.Contains(t, NewPlan(cfg).Describe(), "Backing up an existing target in full before dropping it")
+}
+
+func TestPlan_VerifyCluster(t *testing.T) {
+	cfg := planConfig()
+	source := db.ClusterIdentity{SystemIdentifier: "7301", StartTime: "t1", Version: "16.4"}
+
+	plan := NewPlan(cfg)
+	plan.VerifyCluster(cfg, source, source)
+	assert.Equal(t, MethodTemplate, plan.Method)
+
+	destination := source
+	destination.SystemIdentifier = "7302"
+	plan.VerifyCluster(cfg, source, destination)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.False(t, plan.SameServer)
+	assert.Contains(t, plan.Reason, "different clusters")
+	assert.Equal(t, 4, plan.MaxConnections)
+	assert.Equal(t, 1000, plan.ChunkSize)
+}
+
+func TestNewPlan_Provider(t *testing.T) {
+	cfg := planConfig()
+	cfg.Provider = "neon"
+	plan := NewPlan(cfg)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.Contains(t, plan.Reason, "Neon does not support template cloning")
+	assert.Equal(t, "neon", plan.Provider)
+	assert.Equal(t, 4, plan.MaxConnections)
+	assert.Contains(t, plan.Describe(), "Provider: neon")
+	assert.Contains(t, plan.Describe(), "Downgrade: subscriptions are left out of the schema dump")
+
+	// Auto is resolved by the forker, so the plan is unchanged until then
+	cfg.Provider = "auto"
+	plan = NewPlan(cfg)
+	assert.Equal(t, MethodTemplate, plan.Method)
+	assert.Empty(t, plan.Provider)
+}
+
+func TestPlan_VerifyTemplateOwner(t *testing.T) {
+	cfg := planConfig()
+	rds, _ := provider.Lookup("rds")
+
+	plan := NewPlan(cfg)
+	plan.ApplyProvider(cfg, rds)
+	assert.Equal(t, MethodTemplate, plan.Method)
+	assert.NotEmpty(t, plan.Downgrades)
+
+	plan.VerifyTemplateOwner(cfg, rds, true)
+	assert.Equal(t, MethodTemplate, plan.Method)
+
+	plan.VerifyTemplateOwner(cfg, rds, false)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.Contains(t, plan.Reason, "Amazon RDS only lets the owner of the source clone it")
+
+	plan.ApplyProvider(cfg, provider.SelfHosted)
+	assert.Empty(t, plan.Provider)
+	assert.Empty(t, plan.Downgrades)
+}
+
+func TestPlan_FilterTables(t *testing.T) {
+	tables := []string{"users", "orders", "audit_log"}
+
+	plan := &Plan{IncludeTables: []string{"orders", "missing"}, ExcludeTables: []string{"orders"}}
+	assert.Equal(t, []string{"orders"}, plan.FilterTables(tables))
+
+	plan = &Plan{ExcludeTables: []string{"audit_log"}}
+	assert.Equal(t, []string{"users", "orders"}, plan.FilterTables(tables))
+
+	assert.Equal(t, tables, (&Plan{}).FilterTables(tables))
+
+	tables = []string{"users", "audit_log", "audit_events", "analytics.events", "billing.invoices"}
+	plan = &Plan{ExcludeTables: []string{"audit_*", "analytics.*"}}
+	assert.Equal(t, []string{"users", "billing.invoices"}, plan.FilterTables(tables))
+
+	plan = &Plan{IncludeTables: []string{"events", "public.users", "billing.invoices"}}
+	assert.Equal(t, []string{"users", "billing.invoices"}, plan.FilterTables(tables))
+
+	plan = &Plan{IncludeTables: []string{`public\.audit_.*|analytics\..*`}, TablePatternMode: config.TablePatternRegex}
+	assert.Equal(t, []string{"audit_log", "audit_events", "analytics.events"}, plan.FilterTables(tables))
+}
+
+func TestPlan_ResolveTables(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = sqlDB.Close() }()
+	conn := &db.Connection{DB: sqlDB}
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"schemaname", "tablename", "size"}).
+			AddRow("public", "orders", 100).
+			AddRow("billing", "invoices", 70).
+			AddRow("public", "order_items", 50)
+	}
+	mock.ExpectQuery("SELECT schemaname, tablename, pg_table_size").WillReturnRows(rows())
+	tables, err := (&Plan{IncludeTables: []string{"order*"}}).ResolveTables(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order_items", "orders"}, tables)
+
+	mock.ExpectQuery("SELECT schemaname, tablename, pg_table_size").WillReturnRows(rows())
+	_, err = (&Plan{IncludeTables: []string{"missing_*"}}).ResolveTables(context.Background(), conn)
+	assert.ErrorContains(t, err, "no source table matches")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewPlan_Tables(t *testing.T) {
+	cfg := planConfig()
+	cfg.Tables = map[string]config.TableConfig{
+		"orders":    {Parallelism: 4, Where: "created_at > now() - interval '90 days'"},
+		"users":     {Masking: []masking.Rule{{Table: "users", Column: "email", Strategy: masking.StrategyEmail}}, MaskingProfile: "dev"},
+		"audit_log": {SchemaOnly: true},
+	}
+	cfg.TableGroups = map[string][]string{"orders": {"orders", "order_items"}}
+
+	plan := NewPlan(cfg)
+	assert.Equal(t, MethodTransfer, plan.Method)
+	assert.Contains(t, plan.Reason, "per-table settings")
+	assert.Equal(t, []TablePlan{
+		{Table: "audit_log", SchemaOnly: true},
+		{Table: "orders", Where: "created_at > now() - interval '90 days'", ChunkSize: 1000, Parallelism: 4},
+		{Table: "users", MaskingProfile: "dev", MaskedColumns: []string{"email"}, ChunkSize: 1000, Parallelism: 1},
+	}, plan.Tables)
+	assert.Subset(t, plan.Describe(), []string{
+		"Table audit_log: schema only (no data)",
+		"Table orders: rows where created_at > now() - interval '90 days', 1000 rows per chunk, 4 connections",
+		"Table users: masked with profile dev (email), 1000 rows per chunk",
+		"Table group orders: orders, order_items read in one snapshot",
+	})
+
+	// Tuning alone does not stop a template clone
+	cfg.Tables = map[string]config.TableConfig{"orders": {ChunkSize: 200}}
+	assert.Equal(t, MethodTemplate, NewPlan(cfg).Method)
+}
+
+func TestPlan_EstimateBytes(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = sqlDB.Close() }()
+	conn := &db.Connection{DB: sqlDB}
+
+	cfg := planConfig()
+	cfg.ExcludeTables = []string{"audit_log"}
+	mock.ExpectQuery("SELECT tablename, pg_total_relation_size").WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"tablename", "size"}).
+			AddRow("users", 100).AddRow("orders", 50).AddRow("audit_log", 5000))
+
+	estimate, err := NewPlan(cfg).EstimateBytes(conn, "source")
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), estimate)
+
+	cfg.ExcludeTables = nil
+	mock.ExpectQuery(`SELECT pg_database_size\(\$1\)`).WithArgs("source").
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(9000))
+	estimate, err = NewPlan(cfg).EstimateBytes(conn, "source")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9000), estimate)
+
+	cfg.SchemaOnly = true
+	estimate, err = NewPlan(cfg).EstimateBytes(conn, "source")
+	require.NoError(t, err)
+	assert.Zero(t, estimate)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlan_TransferSizes(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = sqlDB.Close() }()
+	conn := &db.Connection{DB: sqlDB}
+
+	cfg := planConfig()
+	cfg.ExcludeTables = []string{"audit_log"}
+	mock.ExpectQuery("SELECT schemaname, tablename, pg_table_size").
+		WillReturnRows(sqlmock.NewRows([]string{"schemaname", "tablename", "size"}).
+			AddRow("public", "users", 100).
+			AddRow("billing", "invoices", 70).
+			AddRow("public", "audit_log", 5000))
+
+	sizes, err := NewPlan(cfg).TransferSizes(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"users": 100, "billing.invoices": 70}, sizes)
+
+	cfg.SchemaOnly = true
+	sizes, err = NewPlan(cfg).TransferSizes(context.Background(), conn)
+	require.NoError(t, err)
+	assert.Empty(t, sizes)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
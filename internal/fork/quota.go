@@ -0,0 +1,171 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+)
+
+// quotaPollInterval is how often a queued fork checks whether it fits its quotas
+var quotaPollInterval = 30 * time.Second
+
+// QuotaUsage is the space counted against quotas on the destination server
+type QuotaUsage struct {
+	TotalBytes    int64  `json:"total_bytes"`
+	Team          string `json:"team,omitempty"`
+	TeamBytes     int64  `json:"team_bytes,omitempty"`
+	TeamDatabases int    `json:"team_databases,omitempty"`
+}
+
+// QuotaExceededError rejects a fork that does not fit a quota, with the usage it was
+// measured against
+type QuotaExceededError struct {
+	// Quota is "total" for the server-wide quota and "team" for the team's
+	Quota          string     `json:"quota"`
+	Team           string     `json:"team,omitempty"`
+	LimitBytes     int64      `json:"limit_bytes,omitempty"`
+	LimitDatabases int        `json:"limit_databases,omitempty"`
+	RequestedBytes int64      `json:"requested_bytes"`
+	Usage          QuotaUsage `json:"usage"`
+}
+
+// Error describes which quota the fork exceeds and by how much
+func (e *QuotaExceededError) Error() string {
+	switch {
+	case e.Quota == "total":
+		return fmt.Sprintf("quota exceeded: the fork needs about %s, and the destination server uses %s of its %s quota",
+			output.FormatBytes(e.RequestedBytes), output.FormatBytes(e.Usage.TotalBytes), output.FormatBytes(e.LimitBytes))
+	case e.LimitDatabases > 0:
+		return fmt.Sprintf("quota exceeded: team %s already has %d of its %d databases",
+			e.Team, e.Usage.TeamDatabases, e.LimitDatabases)
+	default:
+		return fmt.Sprintf("quota exceeded: the fork needs about %s, and team %s uses %s of its %s quota",
+			output.FormatBytes(e.RequestedBytes), e.Team, output.FormatBytes(e.Usage.TeamBytes), output.FormatBytes(e.LimitBytes))
+	}
+}
+
+// checkQuota returns the first quota a fork of requested bytes owned by team does not
+// fit, or nil when it fits all of them
+func checkQuota(quota config.QuotaConfig, team string, usage QuotaUsage, requested int64) *QuotaExceededError {
+	exceeded := func(kind string) *QuotaExceededError {
+		return &QuotaExceededError{Quota: kind, RequestedBytes: requested, Usage: usage}
+	}
+	if limit := int64(quota.MaxTotalSizeMB) << 20; limit > 0 && usage.TotalBytes+requested > limit {
+		e := exceeded("total")
+		e.LimitBytes = limit
+		return e
+	}
+	if team == "" {
+		return nil
+	}
+	teamQuota := quota.Teams[team]
+	if teamQuota.MaxDatabases > 0 && usage.TeamDatabases+1 > teamQuota.MaxDatabases {
+		e := exceeded("team")
+		e.Team, e.LimitDatabases = team, teamQuota.MaxDatabases
+		return e
+	}
+	if limit := int64(teamQuota.MaxSizeMB) << 20; limit > 0 && usage.TeamBytes+requested > limit {
+		e := exceeded("team")
+		e.Team, e.LimitBytes = team, limit
+		return e
+	}
+	return nil
+}
+
+// measureQuotaUsage adds up the live sizes of the databases on the server, and of those
+// whose lineage names team. The target is left out when the fork replaces it.
+func measureQuotaUsage(sizes map[string]int64, lineages map[string]db.Lineage, team, replaced string) QuotaUsage {
+	usage := QuotaUsage{Team: team}
+	for name, size := range sizes {
+		if name == replaced {
+			continue
+		}
+		usage.TotalBytes += size
+		if lineage, ok := lineages[name]; ok && team != "" && lineage.Team == team {
+			usage.TeamBytes += size
+			usage.TeamDatabases++
+		}
+	}
+	return usage
+}
+
+// admit checks that the fork fits the configured quotas. With a quota wait, a fork that
+// does not fit is queued until enough space is freed or the wait runs out.
+func (f *Forker) admit(ctx context.Context, plan *Plan) error {
+	requested, err := f.estimateForkSize(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("failed to estimate the size of the fork: %w", err)
+	}
+
+	deadline := time.Now().Add(f.config.Quota.Wait)
+	for {
+		usage, err := f.quotaUsage(ctx)
+		if err != nil {
+			return err
+		}
+		exceeded := checkQuota(f.config.Quota, f.config.Team, usage, requested)
+		if exceeded == nil {
+			f.logger.Infof("Quota check passed: the fork needs about %s, the destination server uses %s",
+				output.FormatBytes(requested), output.FormatBytes(usage.TotalBytes))
+			return nil
+		}
+		if time.Now().Add(quotaPollInterval).After(deadline) {
+			return exceeded
+		}
+		f.logger.Infof("Waiting for space: %v; checking again in %s", exceeded, quotaPollInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(quotaPollInterval):
+		}
+	}
+}
+
+// estimateForkSize estimates the bytes the fork adds to the destination server
+func (f *Forker) estimateForkSize(ctx context.Context, plan *Plan) (int64, error) {
+	source, err := db.NewConnectionContext(ctx, &f.config.Source)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := source.Close(); err != nil {
+			f.logger.Warnf("Warning: Source connection cleanup failed: %v", err)
+		}
+	}()
+	if plan.Method == MethodTemplate {
+		return source.GetDatabaseSizeContext(ctx, f.config.Source.Database)
+	}
+	return plan.EstimateBytes(source, f.config.Source.Database)
+}
+
+// quotaUsage measures the space counted against quotas on the destination server
+func (f *Forker) quotaUsage(ctx context.Context) (QuotaUsage, error) {
+	adminConfig := f.config.Destination.Admin()
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return QuotaUsage{}, fmt.Errorf("failed to connect to destination server: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Quota connection cleanup failed: %v", err)
+		}
+	}()
+
+	sizes, err := conn.DatabaseSizesContext(ctx)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	lineages, err := conn.LineagesContext(ctx)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	var replaced string
+	if f.config.DropIfExists {
+		replaced = f.config.TargetDatabase
+	}
+	return measureQuotaUsage(sizes, lineages, f.config.Team, replaced), nil
+}
@@ -0,0 +1,58 @@
+package fork
+
+import (
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureQuotaUsage(t *testing.T) {
+	sizes := map[string]int64{"postgres": 10, "app": 100, "pr_1": 40, "pr_2": 60}
+	lineages := map[string]db.Lineage{
+		"pr_1": {Source: "app", Team: "payments"},
+		"pr_2": {Source: "app", Team: "search"},
+	}
+
+	usage := measureQuotaUsage(sizes, lineages, "payments", "")
+	assert.Equal(t, QuotaUsage{TotalBytes: 210, Team: "payments", TeamBytes: 40, TeamDatabases: 1}, usage)
+
+	// A target the fork replaces no longer counts
+	usage = measureQuotaUsage(sizes, lineages, "payments", "pr_1")
+	assert.Equal(t, QuotaUsage{TotalBytes: 170, Team: "payments"}, usage)
+
+	usage = measureQuotaUsage(sizes, lineages, "", "")
+	assert.Equal(t, QuotaUsage{TotalBytes: 210}, usage)
+}
+
+func TestCheckQuota(t *testing.T) {
+	const mb = 1 << 20
+	quota := config.QuotaConfig{
+		MaxTotalSizeMB: 100,
+		Teams:          map[string]config.TeamQuota{"payments": {MaxSizeMB: 20, MaxDatabases: 2}},
+	}
+
+	assert.Nil(t, checkQuota(quota, "payments", QuotaUsage{TotalBytes: 50 * mb}, 10*mb))
+	assert.Nil(t, checkQuota(quota, "search", QuotaUsage{TotalBytes: 50 * mb}, 40*mb))
+
+	exceeded := checkQuota(quota, "", QuotaUsage{TotalBytes: 95 * mb}, 10*mb)
+	require.NotNil(t, exceeded)
+	assert.Equal(t, "total", exceeded.Quota)
+	assert.Equal(t, int64(100*mb), exceeded.LimitBytes)
+	assert.Equal(t, "quota exceeded: the fork needs about 10.0 MB, and the destination server uses 95.0 MB of its 100.0 MB quota", exceeded.Error())
+
+	exceeded = checkQuota(quota, "payments", QuotaUsage{TotalBytes: 50 * mb, Team: "payments", TeamBytes: 5 * mb, TeamDatabases: 2}, mb)
+	require.NotNil(t, exceeded)
+	assert.Equal(t, "team", exceeded.Quota)
+	assert.Equal(t, 2, exceeded.LimitDatabases)
+	assert.Equal(t, "quota exceeded: team payments already has 2 of its 2 databases", exceeded.Error())
+
+	exceeded = checkQuota(quota, "payments", QuotaUsage{TotalBytes: 50 * mb, Team: "payments", TeamBytes: 15 * mb, TeamDatabases: 1}, 10*mb)
+	require.NotNil(t, exceeded)
+	assert.Equal(t, "team", exceeded.Quota)
+	assert.Equal(t, int64(20*mb), exceeded.LimitBytes)
+	assert.Equal(t, "quota exceeded: the fork needs about 10.0 MB, and team payments uses 15.0 MB of its 20.0 MB quota", exceeded.Error())
+}
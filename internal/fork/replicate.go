@@ -0,0 +1,195 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+)
+
+// ReplicationOptions configures a continuously-updated fork
+type ReplicationOptions struct {
+	// Publication, Slot and Subscription default to pgfork_<target database>
+	Publication  string
+	Slot         string
+	Subscription string
+	// SkipSchema leaves the target's schema alone, for targets created beforehand
+	SkipSchema bool
+	// SourceConnInfo is how the destination server reaches the source, when that
+	// differs from how this machine does; defaults to the source connection
+	SourceConnInfo string
+}
+
+// ReplicationResult describes the replication that was set up
+type ReplicationResult struct {
+	Publication  string   `json:"publication"`
+	Slot         string   `json:"slot"`
+	SlotLSN      string   `json:"slot_lsn"`
+	Subscription string   `json:"subscription"`
+	Tables       []string `json:"tables,omitempty"`
+	SchemaCopied bool     `json:"schema_copied"`
+}
+
+// DefaultReplicationName returns the name used for the publication, slot and
+// subscription of a target. Slot names only allow lower-case letters, digits and
+// underscores, so the target name is folded to fit.
+func DefaultReplicationName(target string) string {
+	name := []byte("pgfork_")
+	for _, ch := range []byte(target) {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9', ch == '_':
+			name = append(name, ch)
+		case ch >= 'A' && ch <= 'Z':
+			name = append(name, ch+'a'-'A')
+		default:
+			name = append(name, '_')
+		}
+	}
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return string(name)
+}
+
+// Replicate sets up logical replication from the source database into the target
+// database on the destination server: the schema of the chosen tables (IncludeTables,
+// or every table) is copied with pg_dump, then a publication and slot are created on
+// the source and a subscription on the target. The subscription copies the existing
+// rows and then streams changes, so the target keeps following the source. Objects
+// created before a failing step are dropped again.
+func Replicate(ctx context.Context, cfg *config.ForkConfig, opts ReplicationOptions, logger *logging.Logger) (*ReplicationResult, error) {
+	name := DefaultReplicationName(cfg.TargetDatabase)
+	result := &ReplicationResult{
+		Publication:  opts.Publication,
+		Slot:         opts.Slot,
+		Subscription: opts.Subscription,
+		Tables:       cfg.IncludeTables,
+	}
+	for _, field := range []*string{&result.Publication, &result.Slot, &result.Subscription} {
+		if *field == "" {
+			*field = name
+		}
+	}
+
+	sourceConn, err := db.NewConnectionContext(ctx, &cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer func() {
+		if err := sourceConn.Close(); err != nil {
+			logger.Warnf("Warning: Source connection cleanup failed: %v", err)
+		}
+	}()
+
+	status, err := sourceConn.StandbyStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.InRecovery {
+		return nil, fmt.Errorf("source is a read-only standby; replication needs a publication on the primary")
+	}
+
+	level, err := sourceConn.WALLevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if level != "logical" {
+		return nil, fmt.Errorf("source wal_level is '%s'; logical replication needs wal_level = logical (requires a restart)", level)
+	}
+
+	// Publications name exact tables, so wildcard and regex include lists are resolved
+	if len(cfg.IncludeTables) > 0 && !config.LiteralTablePatterns(cfg.IncludeTables, cfg.TablePatternMode) {
+		if result.Tables, err = NewPlan(cfg).ResolveTables(ctx, sourceConn); err != nil {
+			return nil, err
+		}
+	}
+
+	adminConfig := cfg.Destination.Admin()
+	adminConn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to destination server: %w", err)
+	}
+	defer func() {
+		if err := adminConn.Close(); err != nil {
+			logger.Warnf("Warning: Destination admin connection cleanup failed: %v", err)
+		}
+	}()
+
+	exists, err := adminConn.DatabaseExistsContext(ctx, cfg.TargetDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check target database: %w", err)
+	}
+	switch {
+	case !exists:
+		if err := adminConn.CreateDatabaseContext(ctx, cfg.TargetDatabase, "template1", false); err != nil {
+			return nil, fmt.Errorf("failed to create target database: %w", err)
+		}
+	case !opts.SkipSchema:
+		return nil, fmt.Errorf("target database '%s' already exists (use --skip-schema if its schema is already in place)", cfg.TargetDatabase)
+	}
+
+	targetConfig := cfg.Destination.WithDatabase(cfg.TargetDatabase)
+	targetConn, err := db.NewConnectionContext(ctx, &targetConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer func() {
+		if err := targetConn.Close(); err != nil {
+			logger.Warnf("Warning: Target connection cleanup failed: %v", err)
+		}
+	}()
+
+	if !opts.SkipSchema {
+		// Subscriptions only carry rows, so the tables must exist on the target first
+		dtm := NewDataTransferManager(sourceConn, targetConn, &cfg.Source, &targetConfig, cfg, logger)
+		if err := dtm.resolveTables(ctx); err != nil {
+			return nil, err
+		}
+		if err := dtm.transferSchema(ctx); err != nil {
+			return nil, fmt.Errorf("failed to copy schema: %w", err)
+		}
+		result.SchemaCopied = true
+	}
+
+	var rollback []func()
+	undo := func() {
+		for i := len(rollback) - 1; i >= 0; i-- {
+			rollback[i]()
+		}
+	}
+
+	logger.Infof("Creating publication %s on the source...", result.Publication)
+	if err := sourceConn.CreatePublication(ctx, result.Publication, result.Tables); err != nil {
+		return nil, err
+	}
+	rollback = append(rollback, func() {
+		if err := sourceConn.DropPublication(context.Background(), result.Publication); err != nil {
+			logger.Warnf("Warning: %v", err)
+		}
+	})
+
+	logger.Infof("Creating replication slot %s on the source...", result.Slot)
+	if result.SlotLSN, err = sourceConn.CreateReplicationSlot(ctx, result.Slot); err != nil {
+		undo()
+		return nil, err
+	}
+	rollback = append(rollback, func() {
+		if err := sourceConn.DropReplicationSlot(context.Background(), result.Slot); err != nil {
+			logger.Warnf("Warning: %v", err)
+		}
+	})
+
+	conninfo := opts.SourceConnInfo
+	if conninfo == "" {
+		conninfo = cfg.Source.ConnectionString()
+	}
+	logger.Infof("Creating subscription %s on %s...", result.Subscription, cfg.TargetDatabase)
+	if err := targetConn.CreateSubscription(ctx, result.Subscription, conninfo, result.Publication, result.Slot); err != nil {
+		undo()
+		return nil, err
+	}
+
+	return result, nil
+}
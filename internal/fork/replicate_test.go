@@ -0,0 +1,14 @@
+package fork
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultReplicationName(t *testing.T) {
+	assert.Equal(t, "pgfork_myapp_pr_123", DefaultReplicationName("myapp_pr_123"))
+	assert.Equal(t, "pgfork_reporting_live", DefaultReplicationName("Reporting-Live"))
+	assert.Len(t, DefaultReplicationName(strings.Repeat("a", 63)), 63)
+}
@@ -0,0 +1,218 @@
+package fork
+
+import (
+	"sync"
+	"time"
+)
+
+// Engine names a mechanism that copies database contents
+type Engine string
+
+const (
+	// EngineTemplate clones the source on its own server with CREATE DATABASE ... TEMPLATE
+	EngineTemplate Engine = "template"
+	// EnginePgDump streams pg_dump into pg_restore
+	EnginePgDump Engine = "pgdump"
+	// EngineCopy copies single tables with COPY, for per-table settings and standby chunking
+	EngineCopy Engine = "copy"
+)
+
+// Report describes how a fork ran, so slower paths than expected show up in results
+type Report struct {
+	Method Method `json:"method"`
+	// Reason explains why the method was chosen
+	Reason string `json:"reason"`
+	// Provider is the managed service hosting the destination, and Downgrades what its
+	// restrictions changed about the fork
+	Provider   string   `json:"provider,omitempty"`
+	Downgrades []string `json:"downgrades,omitempty"`
+	// Engines lists the engines that copied contents, in the order they first ran
+	Engines []Engine `json:"engines"`
+	// Workers is the number of parallel connections a transfer may use
+	Workers int     `json:"workers"`
+	Phases  []Phase `json:"phases"`
+	// SchemaCache is "hit" when the schema came from the schema cache and "miss" when
+	// it was dumped and cached; empty without the cache
+	SchemaCache string `json:"schema_cache,omitempty"`
+	// SampledRows is how many copied rows were compared with the source while the
+	// data loaded, with verify_sample set
+	SampledRows int64 `json:"sampled_rows,omitempty"`
+	// Bench is the result of the load run against the target, with bench set
+	Bench *BenchResult `json:"bench,omitempty"`
+	// Backup is the dump of the existing target taken before it was dropped, with
+	// backup_before_drop set
+	Backup string `json:"backup,omitempty"`
+	// OnTableError is what a failed table copy does, and FailedTables the tables
+	// left out of the target when it is continue
+	OnTableError string         `json:"on_table_error,omitempty"`
+	FailedTables []TableFailure `json:"failed_tables,omitempty"`
+	// TableRetries counts the table copies repeated when OnTableError is retry
+	TableRetries int `json:"table_retries,omitempty"`
+
+	mu sync.Mutex
+}
+
+// Phase is one timed step of a fork
+type Phase struct {
+	Name       string `json:"name"`
+	Duration   string `json:"duration"`
+	DurationMs int64  `json:"duration_ms"`
+	Failed     bool   `json:"failed,omitempty"`
+}
+
+// TableFailure is a table whose copy failed
+type TableFailure struct {
+	Table string `json:"table"`
+	Error string `json:"error"`
+}
+
+// newReport starts the report of a fork following plan
+func newReport(plan *Plan) *Report {
+	report := &Report{Engines: []Engine{}}
+	report.replan(plan)
+	return report
+}
+
+// replan records the method of plan after checks against the servers changed it
+func (r *Report) replan(plan *Plan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Method = plan.Method
+	r.Reason = plan.Reason
+	r.Provider = plan.Provider
+	r.Downgrades = plan.Downgrades
+	r.OnTableError = plan.OnTableError
+	r.Workers = 1
+	if plan.Method == MethodTransfer {
+		r.Workers = plan.MaxConnections
+	}
+}
+
+// useEngine records that engine copied contents. A nil report records nothing.
+func (r *Report) useEngine(engine Engine) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, used := range r.Engines {
+		if used == engine {
+			return
+		}
+	}
+	r.Engines = append(r.Engines, engine)
+}
+
+// time runs fn as the named phase and records how long it took, and whether it
+// failed. A nil report only runs fn.
+func (r *Report) time(name string, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Phases = append(r.Phases, Phase{
+		Name:       name,
+		Duration:   elapsed.Round(time.Millisecond).String(),
+		DurationMs: elapsed.Milliseconds(),
+		Failed:     err != nil,
+	})
+	return err
+}
+
+// PhaseTotals returns the time spent in each phase, summing phases that ran more than
+// once, in the order they first ran. A phase failed if any of its runs did. A nil
+// report has no phases.
+func (r *Report) PhaseTotals() []Phase {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals := make([]Phase, 0, len(r.Phases))
+	index := make(map[string]int, len(r.Phases))
+	for _, phase := range r.Phases {
+		i, ok := index[phase.Name]
+		if !ok {
+			i = len(totals)
+			index[phase.Name] = i
+			totals = append(totals, Phase{Name: phase.Name})
+		}
+		totals[i].DurationMs += phase.DurationMs
+		totals[i].Failed = totals[i].Failed || phase.Failed
+	}
+	for i := range totals {
+		totals[i].Duration = (time.Duration(totals[i].DurationMs) * time.Millisecond).String()
+	}
+	return totals
+}
+
+// schemaCacheResult records whether the schema cache had the schema. A nil report
+// records nothing.
+func (r *Report) schemaCacheResult(result string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SchemaCache = result
+}
+
+// sampledRows records how many copied rows were compared with the source. A nil
+// report records nothing.
+func (r *Report) sampledRows(n int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SampledRows = n
+}
+
+// benchResult records the result of the load run against the target. A nil report
+// records nothing.
+func (r *Report) benchResult(result *BenchResult) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Bench = result
+}
+
+// backedUp records the dump of the existing target taken before it was dropped. A nil
+// report records nothing.
+func (r *Report) backedUp(path string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Backup = path
+}
+
+// tableFailed records a table left out after its copy failed. A nil report records
+// nothing.
+func (r *Report) tableFailed(table string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FailedTables = append(r.FailedTables, TableFailure{Table: table, Error: err.Error()})
+}
+
+// tableRetried counts a repeated table copy. A nil report records nothing.
+func (r *Report) tableRetried() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.TableRetries++
+}
@@ -0,0 +1,52 @@
+package fork
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	cfg := planConfig()
+	cfg.Destination.Host = "replica.example.com"
+	report := newReport(NewPlan(cfg))
+	assert.Equal(t, MethodTransfer, report.Method)
+	assert.Equal(t, 4, report.Workers)
+
+	report.useEngine(EnginePgDump)
+	report.useEngine(EngineCopy)
+	report.useEngine(EnginePgDump)
+	assert.Equal(t, []Engine{EnginePgDump, EngineCopy}, report.Engines)
+
+	require.NoError(t, report.time("schema", func() error { return nil }))
+	failure := errors.New("pg_restore failed")
+	assert.Equal(t, failure, report.time("data", func() error { return failure }))
+	require.Len(t, report.Phases, 2)
+	assert.Equal(t, "schema", report.Phases[0].Name)
+	assert.False(t, report.Phases[0].Failed)
+	assert.True(t, report.Phases[1].Failed)
+
+	// A transfer without a report, as replicate runs one, records nothing
+	var none *Report
+	assert.Nil(t, none.PhaseTotals())
+	none.useEngine(EngineCopy)
+	assert.NoError(t, none.time("data", func() error { return nil }))
+
+	assert.Equal(t, 1, newReport(NewPlan(planConfig())).Workers)
+}
+
+func TestReportPhaseTotals(t *testing.T) {
+	report := &Report{Phases: []Phase{
+		{Name: "schema", DurationMs: 1500},
+		{Name: "verify_sample", DurationMs: 200},
+		{Name: "data", DurationMs: 60000},
+		{Name: "verify_sample", DurationMs: 300, Failed: true},
+	}}
+	assert.Equal(t, []Phase{
+		{Name: "schema", Duration: "1.5s", DurationMs: 1500},
+		{Name: "verify_sample", Duration: "500ms", DurationMs: 500, Failed: true},
+		{Name: "data", Duration: "1m0s", DurationMs: 60000},
+	}, report.PhaseTotals())
+}
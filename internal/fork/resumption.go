@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,6 +28,31 @@ type JobState struct {
 	IndexesCompleted bool                   `json:"indexes_completed"`
 	Status           string                 `json:"status"` // "running", "paused", "completed", "failed"
 	Error            string                 `json:"error,omitempty"`
+	Checkpoint       *JobCheckpoint         `json:"checkpoint,omitempty"`
+	// CI is the pipeline run that started the job
+	CI *config.CIProvenance `json:"ci,omitempty"`
+	// Config is the job's resolved configuration without its secrets (see
+	// config.ForkConfig.WithoutSecrets), to show or repeat the run
+	Config *config.ForkConfig `json:"config,omitempty"`
+	// Phases is the time the job spent in each phase of the fork, so a slower fork
+	// shows which phase slowed down
+	Phases []Phase `json:"phases,omitempty"`
+}
+
+// HeartbeatInterval is how often a running job records a checkpoint
+const HeartbeatInterval = 10 * time.Second
+
+// JobCheckpoint is the progress of a running job as of its last heartbeat
+type JobCheckpoint struct {
+	Time             time.Time `json:"time"`
+	BytesTransferred int64     `json:"bytes_transferred"`
+	RowsTransferred  int64     `json:"rows_transferred"`
+	BytesTotal       int64     `json:"bytes_total,omitempty"`
+}
+
+// Stale reports whether the heartbeat is too old for the job to still be running
+func (c *JobCheckpoint) Stale(now time.Time) bool {
+	return now.Sub(c.Time) > 3*HeartbeatInterval
 }
 
 // DatabaseConfigSnapshot stores essential database connection info for resumption
@@ -37,6 +64,18 @@ type DatabaseConfigSnapshot struct {
 	SSLMode  string `json:"sslmode"`
 }
 
+// NewDatabaseConfigSnapshot captures the resumption-relevant parts of a connection,
+// leaving out the password
+func NewDatabaseConfigSnapshot(cfg config.DatabaseConfig) DatabaseConfigSnapshot {
+	return DatabaseConfigSnapshot{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Username: cfg.Username,
+		Database: cfg.Database,
+		SSLMode:  cfg.SSLMode,
+	}
+}
+
 // ResumptionManager handles job state persistence and resumption
 type ResumptionManager struct {
 	stateDir  string
@@ -114,6 +153,7 @@ func (rm *ResumptionManager) InitializeJob(sourceConfig, destConfig DatabaseConf
 		DestConfig:      destConfig,
 		TargetDatabase:  targetDB,
 		Status:          "running",
+		CI:              config.DetectCI(),
 	}
 
 	if err := rm.saveJobState(); err != nil {
@@ -233,6 +273,43 @@ func (rm *ResumptionManager) SetError(err error) error {
 	return rm.saveJobState()
 }
 
+// RecordConfig records the job's resolved configuration, without its secrets
+func (rm *ResumptionManager) RecordConfig(cfg *config.ForkConfig) error {
+	if rm.state == nil {
+		return fmt.Errorf("job state not initialized")
+	}
+
+	recorded := cfg.WithoutSecrets()
+	rm.state.Config = &recorded
+	rm.state.LastUpdated = time.Now()
+
+	return rm.saveJobState()
+}
+
+// RecordPhases records the time the job spent in each phase so far
+func (rm *ResumptionManager) RecordPhases(phases []Phase) error {
+	if rm.state == nil {
+		return fmt.Errorf("job state not initialized")
+	}
+
+	rm.state.Phases = phases
+	rm.state.LastUpdated = time.Now()
+
+	return rm.saveJobState()
+}
+
+// Checkpoint records the live progress of the running job
+func (rm *ResumptionManager) Checkpoint(checkpoint JobCheckpoint) error {
+	if rm.state == nil {
+		return fmt.Errorf("job state not initialized")
+	}
+
+	rm.state.Checkpoint = &checkpoint
+	rm.state.LastUpdated = checkpoint.Time
+
+	return rm.saveJobState()
+}
+
 // PauseJob pauses the current job
 func (rm *ResumptionManager) PauseJob() error {
 	if rm.state == nil {
@@ -269,6 +346,11 @@ func (rm *ResumptionManager) CompleteJob(cleanup bool) error {
 	return nil
 }
 
+// LoadState returns the persisted state of the job, or nil if it has never run
+func (rm *ResumptionManager) LoadState() (*JobState, error) {
+	return rm.loadJobState()
+}
+
 // GetJobState returns the current job state
 func (rm *ResumptionManager) GetJobState() *JobState {
 	return rm.state
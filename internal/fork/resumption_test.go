@@ -0,0 +1,52 @@
+package fork
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumptionManager_RecordConfig(t *testing.T) {
+	stateDir := t.TempDir()
+	cfg := &config.ForkConfig{
+		Source:         config.DatabaseConfig{Host: "prod", Port: 5432, Username: "app", Password: "secret", Database: "app"}, // pragma: allowlist secret
+		Destination:    config.DatabaseConfig{Host: "staging", Port: 5432, Username: "app", Password: "secret"},               // pragma: allowlist secret
+		TargetDatabase: "app_copy",
+		IncludeTables:  []string{"users"},
+		Timeout:        30 * time.Minute,
+	}
+
+	rm := NewResumptionManager(stateDir, "job-1")
+	assert.Error(t, rm.RecordConfig(cfg))
+	_, _, err := rm.InitializeJob(NewDatabaseConfigSnapshot(cfg.Source), NewDatabaseConfigSnapshot(cfg.Destination), cfg.TargetDatabase, map[string]int64{})
+	require.NoError(t, err)
+	require.NoError(t, rm.RecordConfig(cfg))
+
+	jobs, err := ListJobs(stateDir)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	recorded := jobs[0].Config
+	require.NotNil(t, recorded)
+	assert.Equal(t, "prod", recorded.Source.Host)
+	assert.Empty(t, recorded.Source.Password)
+	assert.Empty(t, recorded.Destination.Password)
+	assert.Equal(t, []string{"users"}, recorded.IncludeTables)
+	assert.Equal(t, 30*time.Minute, recorded.Timeout)
+}
+
+func TestResumptionManager_RecordPhases(t *testing.T) {
+	stateDir := t.TempDir()
+	rm := NewResumptionManager(stateDir, "job-1")
+	assert.Error(t, rm.RecordPhases(nil))
+	_, _, err := rm.InitializeJob(DatabaseConfigSnapshot{}, DatabaseConfigSnapshot{}, "app_copy", map[string]int64{})
+	require.NoError(t, err)
+	require.NoError(t, rm.RecordPhases([]Phase{{Name: "indexes", Duration: "41s", DurationMs: 41000}}))
+
+	jobs, err := ListJobs(stateDir)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, []Phase{{Name: "indexes", Duration: "41s", DurationMs: 41000}}, jobs[0].Phases)
+}
@@ -0,0 +1,195 @@
+package fork
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+)
+
+// unsafeCacheChars matches characters left out of schema cache file names
+var unsafeCacheChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// schemaCacheDir returns the directory schema dumps are cached in
+func schemaCacheDir(cacheDir string) string {
+	if cacheDir == "" {
+		cacheDir = db.DefaultMetadataCacheDir()
+	}
+	return filepath.Join(cacheDir, "schema")
+}
+
+// schemaCachePrefix starts the names of every cached schema dump of a source database
+func schemaCachePrefix(source *config.DatabaseConfig) string {
+	return unsafeCacheChars.ReplaceAllString(source.Host+"_"+strconv.Itoa(source.Port)+"_"+source.Database, "_") + "-"
+}
+
+// schemaCacheName names the cached dump of a source schema. The hash covers the schema
+// fingerprint, the pg_dump version and the dump options, so a change to any of them
+// misses the cache.
+func schemaCacheName(source *config.DatabaseConfig, fingerprint, dumpVersion string, options []string) string {
+	key := sha256.Sum256([]byte(strings.Join(append([]string{fingerprint, dumpVersion}, options...), "\x00")))
+	return schemaCachePrefix(source) + hex.EncodeToString(key[:16]) + ".dump"
+}
+
+// transferCachedSchema restores the schema from an archive that comes from the schema
+// cache while the source's schema is unchanged
+func (dtm *DataTransferManager) transferCachedSchema(ctx context.Context) error {
+	dir, err := os.MkdirTemp(dtm.spoolDir(), "pgfork-schema-")
+	if err != nil {
+		return fmt.Errorf("failed to create schema dump directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			dtm.logger.Warnf("Failed to remove schema dump directory %s: %v", dir, err)
+		}
+	}()
+	archive, err := dtm.schemaArchive(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	restoreCmd := exec.CommandContext(ctx, "pg_restore", "-d", dtm.destCfg.ConnectionString(), archive)
+	restoreCmd.Stdout = os.Stdout
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = restoreStderr
+	restoreCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.destCfg.Password)
+	if err := dtm.checkRestore(restoreCmd.Run(), "schema"); err != nil {
+		return err
+	}
+
+	dtm.logger.Info("Schema transfer completed successfully")
+	return nil
+}
+
+// schemaArchive writes a schema-only archive of the source to dir and returns its
+// path. With the schema cache on, the archive cached for the source's current schema
+// is used instead of running pg_dump, and fresh dumps are cached for the next fork.
+func (dtm *DataTransferManager) schemaArchive(ctx context.Context, dir string) (string, error) {
+	archive := filepath.Join(dir, "schema.dump")
+
+	var cached string
+	if dtm.config.SchemaCache {
+		name, err := dtm.schemaCacheName(ctx)
+		if err != nil {
+			dtm.logger.Warnf("Not using the schema cache: %v", err)
+		} else {
+			cached = filepath.Join(schemaCacheDir(dtm.config.CacheDir), name)
+		}
+	}
+	if cached != "" {
+		err := linkOrCopy(cached, archive)
+		if err == nil {
+			dtm.logger.Infof("Schema unchanged, using the cached dump %s", cached)
+			dtm.report.schemaCacheResult("hit")
+			return archive, nil
+		}
+		if !os.IsNotExist(err) {
+			dtm.logger.Warnf("Failed to read the cached schema dump %s: %v", cached, err)
+		}
+	}
+
+	dumpCmd := exec.CommandContext(ctx, "pg_dump", append(dtm.schemaDumpArgs(), "--file="+archive)...)
+	dumpStderr := subprocessStderr(dtm.logger)
+	defer dumpStderr.Close()
+	dumpCmd.Stderr = dumpStderr
+	dumpCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.sourceCfg.Password)
+	if err := dumpCmd.Run(); err != nil {
+		return "", fmt.Errorf("pg_dump (schema) failed: %w", err)
+	}
+
+	if cached != "" {
+		dtm.report.schemaCacheResult("miss")
+		// Caching is best effort: a dump that cannot be stored only costs the next fork
+		// another pg_dump
+		if err := storeSchemaArchive(archive, cached); err != nil {
+			dtm.logger.Warnf("Failed to cache the schema dump: %v", err)
+		} else {
+			dtm.logger.Infof("Cached the schema dump as %s", cached)
+			dtm.pruneSchemaCache(cached)
+		}
+	}
+	return archive, nil
+}
+
+// schemaCacheName fingerprints the source's schema and names its cached dump
+func (dtm *DataTransferManager) schemaCacheName(ctx context.Context) (string, error) {
+	fingerprint, err := dtm.source.SchemaFingerprintContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	version, err := exec.CommandContext(ctx, "pg_dump", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the pg_dump version: %w", err)
+	}
+	return schemaCacheName(dtm.sourceCfg, fingerprint, strings.TrimSpace(string(version)), dtm.schemaDumpOptions()), nil
+}
+
+// pruneSchemaCache removes the other cached dumps of the source, which are of schemas
+// it no longer has
+func (dtm *DataTransferManager) pruneSchemaCache(current string) {
+	stale, err := filepath.Glob(filepath.Join(filepath.Dir(current), schemaCachePrefix(dtm.sourceCfg)+"*.dump"))
+	if err != nil {
+		return
+	}
+	for _, path := range stale {
+		if path == current {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			dtm.logger.Debugf("Failed to remove stale schema dump %s: %v", path, err)
+		}
+	}
+}
+
+// storeSchemaArchive puts archive into the cache as cached, through a temporary file so
+// concurrent forks never read a partly written dump
+func storeSchemaArchive(archive, cached string) error {
+	if err := os.MkdirAll(filepath.Dir(cached), 0o700); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", cached, os.Getpid())
+	_ = os.Remove(tmp)
+	if err := linkOrCopy(archive, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, cached); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// linkOrCopy hard-links src to dst, copying it where the two are on different file
+// systems. A pruned cache entry then cannot disappear from under a running restore.
+// dst must not exist yet.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil || os.IsNotExist(err) || os.IsExist(err) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,119 @@
+package fork
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCacheName(t *testing.T) {
+	source := &config.DatabaseConfig{Host: "db.internal", Port: 5432, Database: "app"}
+	options := []string{"--schema-only", "--exclude-table=audit_log"}
+
+	name := schemaCacheName(source, "abc", "pg_dump (PostgreSQL) 16.2", options)
+	assert.Regexp(t, `^db.internal_5432_app-[0-9a-f]{32}\.dump$`, name)
+	assert.Equal(t, name, schemaCacheName(source, "abc", "pg_dump (PostgreSQL) 16.2", options))
+
+	// Schema drift, a new pg_dump and other filters each miss the cache
+	assert.NotEqual(t, name, schemaCacheName(source, "abd", "pg_dump (PostgreSQL) 16.2", options))
+	assert.NotEqual(t, name, schemaCacheName(source, "abc", "pg_dump (PostgreSQL) 17.0", options))
+	assert.NotEqual(t, name, schemaCacheName(source, "abc", "pg_dump (PostgreSQL) 16.2", options[:1]))
+
+	assert.Equal(t, "db_1_5433_my_app-", schemaCachePrefix(&config.DatabaseConfig{Host: "db/1", Port: 5433, Database: "my app"}))
+}
+
+// fakePgDump puts a pg_dump on PATH that reports version 16.2 and writes "schema" to
+// the archive it is asked for
+func fakePgDump(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pg_dump is a shell script")
+	}
+	bin := t.TempDir()
+	script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+	--version) echo "pg_dump (PostgreSQL) 16.2"; exit 0 ;;
+	--file=*) printf schema > "${arg#--file=}" ;;
+	esac
+done
+`
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pg_dump"), []byte(script), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSchemaArchive_Cache(t *testing.T) {
+	fakePgDump(t)
+	cacheDir := t.TempDir()
+	cfg := &config.ForkConfig{
+		Source:      config.DatabaseConfig{Host: "db.internal", Port: 5432, Database: "app"},
+		SchemaCache: true,
+		CacheDir:    cacheDir,
+	}
+	dtm, source, _ := newExtensionsTransfer(t, cfg)
+	dtm.report = &Report{}
+
+	// A dump of an older schema of the source is replaced
+	stale := filepath.Join(schemaCacheDir(cacheDir), schemaCachePrefix(&cfg.Source)+"0123.dump")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0o700))
+	require.NoError(t, os.WriteFile(stale, []byte("old"), 0o600))
+
+	source.ExpectQuery("SELECT md5").WillReturnRows(sqlmock.NewRows([]string{"md5"}).AddRow("abc"))
+	archive, err := dtm.schemaArchive(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "miss", dtm.report.SchemaCache)
+	data, err := os.ReadFile(archive)
+	require.NoError(t, err)
+	assert.Equal(t, "schema", string(data))
+	assert.NoFileExists(t, stale)
+
+	cached, err := filepath.Glob(filepath.Join(schemaCacheDir(cacheDir), "*.dump"))
+	require.NoError(t, err)
+	require.Len(t, cached, 1)
+
+	// An unchanged schema is served from the cache
+	require.NoError(t, os.WriteFile(cached[0], []byte("cached schema"), 0o600))
+	source.ExpectQuery("SELECT md5").WillReturnRows(sqlmock.NewRows([]string{"md5"}).AddRow("abc"))
+	archive, err = dtm.schemaArchive(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "hit", dtm.report.SchemaCache)
+	data, err = os.ReadFile(archive)
+	require.NoError(t, err)
+	assert.Equal(t, "cached schema", string(data))
+
+	// A changed schema is dumped again
+	source.ExpectQuery("SELECT md5").WillReturnRows(sqlmock.NewRows([]string{"md5"}).AddRow("def"))
+	_, err = dtm.schemaArchive(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "miss", dtm.report.SchemaCache)
+	assert.NoFileExists(t, cached[0])
+	assert.NoError(t, source.ExpectationsWereMet())
+}
+
+func TestLinkOrCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.WriteFile(src, []byte("dump"), 0o600))
+
+	require.NoError(t, linkOrCopy(src, filepath.Join(dir, "dst")))
+	data, err := os.ReadFile(filepath.Join(dir, "dst"))
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(data))
+
+	// An existing destination is left alone, as it may be a link to src
+	err = linkOrCopy(src, filepath.Join(dir, "dst"))
+	assert.True(t, os.IsExist(err))
+	data, err = os.ReadFile(src)
+	require.NoError(t, err)
+	assert.Equal(t, "dump", string(data))
+
+	err = linkOrCopy(filepath.Join(dir, "missing"), filepath.Join(dir, "other"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,75 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+)
+
+// WriteSchemaPlan writes the DDL the fork would run on the target to path as a SQL
+// script, without touching the destination. The script comes from the same filtered
+// schema dump the fork restores, cut down as for minimal_schema, so it is what a
+// fork would apply. Extension-managed schemas are detected against the destination
+// during a fork, so they are left in.
+func (f *Forker) WriteSchemaPlan(ctx context.Context, path string) error {
+	source, err := db.NewConnectionContext(ctx, &f.config.Source)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer func() {
+		if err := source.Close(); err != nil {
+			f.logger.Warnf("Warning: Source connection cleanup failed: %v", err)
+		}
+	}()
+
+	dtm := NewDataTransferManager(source, nil, &f.config.Source, nil, f.config, f.logger)
+	if err := dtm.resolveTables(ctx); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp(dtm.spoolDir(), "pgfork-schema-plan-")
+	if err != nil {
+		return fmt.Errorf("failed to create schema dump directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			f.logger.Warnf("Failed to remove schema dump directory %s: %v", dir, err)
+		}
+	}()
+	archive, err := dtm.schemaArchive(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--file=" + path}
+	if f.config.MinimalSchema {
+		listCmd := exec.CommandContext(ctx, "pg_restore", "--list", archive)
+		listStderr := subprocessStderr(f.logger)
+		defer listStderr.Close()
+		listCmd.Stderr = listStderr
+		toc, err := listCmd.Output()
+		if err != nil {
+			return fmt.Errorf("pg_restore (list) failed: %w", err)
+		}
+		list := filepath.Join(dir, "schema.list")
+		if err := os.WriteFile(list, filterMinimalSchema(toc), 0o600); err != nil {
+			return fmt.Errorf("failed to write restore list: %w", err)
+		}
+		args = append(args, "--use-list="+list)
+	}
+
+	// Without a database to restore into, pg_restore writes the script it would run
+	scriptCmd := exec.CommandContext(ctx, "pg_restore", append(args, archive)...)
+	scriptStderr := subprocessStderr(f.logger)
+	defer scriptStderr.Close()
+	scriptCmd.Stderr = scriptStderr
+	if err := scriptCmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore (script) failed: %w", err)
+	}
+	f.logger.Infof("Wrote schema plan to %s", path)
+	return nil
+}
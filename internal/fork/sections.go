@@ -0,0 +1,275 @@
+package fork
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+
+	"github.com/lib/pq"
+)
+
+// sectionedSchema is a schema-only archive of the source restored in the sections
+// around the data load: its pre-data objects before the data, and its indexes and
+// constraints after, so they are built once instead of maintained row by row
+type sectionedSchema struct {
+	archive string
+	// indexes and constraints are pg_restore lists of the archive's post-data
+	// entries, empty when it has none; constraints also holds the triggers, rules,
+	// policies and other post-data objects
+	indexes, constraints string
+	// matviews are the populated materialized views the schema creates, in the
+	// order they depend on each other
+	matviews []string
+}
+
+// sectioned reports whether the transfer restores the schema in sections around the
+// data. A schema-only, data-only or minimal schema transfer restores the schema in
+// one go, if at all.
+func (dtm *DataTransferManager) sectioned() bool {
+	return !dtm.config.DataOnly && !dtm.config.SchemaOnly && !dtm.config.MinimalSchema
+}
+
+// transferSections restores the pre-data schema, loads the data, then creates the
+// indexes and constraints, refreshes the materialized views and analyzes the target,
+// each as a phase of its own
+func (dtm *DataTransferManager) transferSections(ctx context.Context) error {
+	dir, err := os.MkdirTemp(dtm.spoolDir(), "pgfork-schema-")
+	if err != nil {
+		return fmt.Errorf("failed to create schema dump directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			dtm.logger.Warnf("Failed to remove schema dump directory %s: %v", dir, err)
+		}
+	}()
+
+	dtm.report.useEngine(EnginePgDump)
+	var schema *sectionedSchema
+	if err := dtm.report.time("schema", func() error {
+		schema, err = dtm.restorePreData(ctx, dir)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to transfer schema: %w", err)
+	}
+
+	// The views are refreshed once their tables are loaded and indexed
+	dtm.matviews = schema.matviews
+	if err := dtm.sampleWhile(ctx, dtm.transferData); err != nil {
+		return err
+	}
+
+	if err := dtm.report.time("indexes", func() error {
+		return dtm.restoreList(ctx, schema.archive, schema.indexes, "indexes")
+	}); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	if err := dtm.report.time("constraints", func() error {
+		return dtm.restoreList(ctx, schema.archive, schema.constraints, "constraints")
+	}); err != nil {
+		return fmt.Errorf("failed to create constraints: %w", err)
+	}
+	if len(schema.matviews) > 0 {
+		if err := dtm.report.time("matviews", func() error { return dtm.refreshMatviews(ctx, schema.matviews) }); err != nil {
+			return fmt.Errorf("failed to refresh materialized views: %w", err)
+		}
+	}
+	// Statistics only help the planner, so the fork does not fail without them
+	if err := dtm.report.time("analyze", func() error { return dtm.analyze(ctx) }); err != nil {
+		dtm.logger.Warnf("Warning: %v", err)
+	}
+	return nil
+}
+
+// restorePreData writes a schema-only archive of the source to dir, lists its
+// post-data entries and restores its pre-data section
+func (dtm *DataTransferManager) restorePreData(ctx context.Context, dir string) (*sectionedSchema, error) {
+	dtm.logger.Info("Transferring database schema, without indexes and constraints, using pg_dump and pg_restore...")
+
+	archive, err := dtm.schemaArchive(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	schema := &sectionedSchema{archive: archive}
+
+	postData, err := dtm.listSection(ctx, archive, "post-data")
+	if err != nil {
+		return nil, err
+	}
+	indexes, constraints := splitPostData(postData)
+	for _, list := range []struct {
+		entries []byte
+		path    *string
+		name    string
+	}{
+		{indexes, &schema.indexes, "indexes.list"},
+		{constraints, &schema.constraints, "constraints.list"},
+	} {
+		if len(list.entries) == 0 {
+			continue
+		}
+		*list.path = filepath.Join(dir, list.name)
+		if err := os.WriteFile(*list.path, list.entries, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write restore list: %w", err)
+		}
+	}
+
+	preData, err := dtm.listSection(ctx, archive, "pre-data")
+	if err != nil {
+		return nil, err
+	}
+	if views := materializedViews(preData); len(views) > 0 {
+		if schema.matviews, err = dtm.populatedMatviews(ctx, views); err != nil {
+			return nil, err
+		}
+	}
+
+	restoreCmd := exec.CommandContext(ctx, "pg_restore",
+		"--section=pre-data",
+		"-d", dtm.destCfg.ConnectionString(),
+		archive,
+	)
+	restoreCmd.Stdout = os.Stdout
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = restoreStderr
+	restoreCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.destCfg.Password)
+	if err := dtm.checkRestore(restoreCmd.Run(), "schema"); err != nil {
+		return nil, err
+	}
+
+	dtm.logger.Info("Schema transfer completed successfully")
+	return schema, nil
+}
+
+// restoreList restores the entries of archive in list, which is empty when there are
+// none to restore
+func (dtm *DataTransferManager) restoreList(ctx context.Context, archive, list, what string) error {
+	if list == "" {
+		return nil
+	}
+	dtm.logger.Infof("Creating %s...", what)
+
+	restoreCmd := exec.CommandContext(ctx, "pg_restore",
+		"--use-list="+list,
+		"-d", dtm.destCfg.ConnectionString(),
+		archive,
+	)
+	restoreCmd.Stdout = os.Stdout
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = restoreStderr
+	restoreCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.destCfg.Password)
+	return dtm.checkRestore(restoreCmd.Run(), what)
+}
+
+// listSection returns the pg_restore --list of the entries of one section of archive
+func (dtm *DataTransferManager) listSection(ctx context.Context, archive, section string) ([]byte, error) {
+	listCmd := exec.CommandContext(ctx, "pg_restore", "--list", "--section="+section, archive)
+	listStderr := subprocessStderr(dtm.logger)
+	defer listStderr.Close()
+	listCmd.Stderr = listStderr
+	toc, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pg_restore (list %s) failed: %w", section, err)
+	}
+	return toc, nil
+}
+
+// splitPostData splits the entries of a post-data pg_restore --list into the indexes
+// and everything else, dropping comment lines
+func splitPostData(toc []byte) (indexes, constraints []byte) {
+	var idx, rest bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(toc))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// <dump id>; <catalog oid> <object oid> <type> <schema> <name> <owner>
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, ";") || len(fields) < 4 {
+			continue
+		}
+		out := &rest
+		if fields[3] == "INDEX" {
+			out = &idx
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return idx.Bytes(), rest.Bytes()
+}
+
+// materializedViews returns the materialized views a pre-data pg_restore --list
+// creates as schema.name, in the order of the list, which creates views after the
+// views they read
+func materializedViews(toc []byte) []string {
+	var views []string
+	scanner := bufio.NewScanner(bytes.NewReader(toc))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, ";") || len(fields) < 7 || fields[3] != "MATERIALIZED" || fields[4] != "VIEW" {
+			continue
+		}
+		views = append(views, fields[5]+"."+fields[6])
+	}
+	return views
+}
+
+// populatedMatviews keeps the views that hold data on the source, as pg_dump does, so
+// views created WITH NO DATA stay empty on the target
+func (dtm *DataTransferManager) populatedMatviews(ctx context.Context, views []string) ([]string, error) {
+	rows, err := dtm.source.DB.QueryContext(ctx, "SELECT schemaname, matviewname FROM pg_matviews WHERE ispopulated")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list materialized views: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	populated := make(map[string]bool)
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			return nil, fmt.Errorf("failed to list materialized views: %w", err)
+		}
+		populated[schema+"."+name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list materialized views: %w", err)
+	}
+
+	var kept []string
+	for _, view := range views {
+		if populated[view] {
+			kept = append(kept, view)
+		}
+	}
+	return kept, nil
+}
+
+// refreshMatviews fills the materialized views on the target, in order
+func (dtm *DataTransferManager) refreshMatviews(ctx context.Context, views []string) error {
+	dtm.logger.Infof("Refreshing %d materialized views...", len(views))
+	for _, view := range views {
+		schema, name := config.SplitTableName(view)
+		statement := "REFRESH MATERIALIZED VIEW " + pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+		if _, err := dtm.dest.DB.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%s: %w", view, err)
+		}
+	}
+	return nil
+}
+
+// analyze collects the planner statistics of the freshly loaded target, which
+// pg_restore leaves to autovacuum
+func (dtm *DataTransferManager) analyze(ctx context.Context) error {
+	dtm.logger.Info("Analyzing the target database...")
+	if _, err := dtm.dest.DB.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("failed to analyze the target database: %w", err)
+	}
+	return nil
+}
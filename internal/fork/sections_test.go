@@ -0,0 +1,52 @@
+package fork
+
+import (
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPostData(t *testing.T) {
+	toc := `;
+; Selected TOC Entries:
+;
+3303; 2606 16407 CONSTRAINT public users users_pkey postgres
+3304; 1259 16408 INDEX public users_email_idx postgres
+3310; 0 0 INDEX ATTACH public events_2024_at_idx postgres
+3305; 2620 16409 TRIGGER public users users_touch postgres
+3306; 2606 16410 FK CONSTRAINT public orders orders_user_id_fkey postgres
+`
+	indexes, constraints := splitPostData([]byte(toc))
+	assert.Equal(t, `3304; 1259 16408 INDEX public users_email_idx postgres
+3310; 0 0 INDEX ATTACH public events_2024_at_idx postgres
+`, string(indexes))
+	assert.Equal(t, `3303; 2606 16407 CONSTRAINT public users users_pkey postgres
+3305; 2620 16409 TRIGGER public users users_touch postgres
+3306; 2606 16410 FK CONSTRAINT public orders orders_user_id_fkey postgres
+`, string(constraints))
+
+	indexes, constraints = splitPostData([]byte(";\n"))
+	assert.Empty(t, indexes)
+	assert.Empty(t, constraints)
+}
+
+func TestMaterializedViews(t *testing.T) {
+	toc := `;
+216; 1259 16402 TABLE public users postgres
+218; 1259 16405 VIEW public active_users postgres
+219; 1259 16412 MATERIALIZED VIEW public daily_signups postgres
+220; 1259 16413 MATERIALIZED VIEW reports weekly_signups postgres
+`
+	assert.Equal(t, []string{"public.daily_signups", "reports.weekly_signups"}, materializedViews([]byte(toc)))
+	assert.Empty(t, materializedViews([]byte(";\n")))
+}
+
+func TestSectioned(t *testing.T) {
+	dtm := &DataTransferManager{config: &config.ForkConfig{}}
+	assert.True(t, dtm.sectioned())
+	for _, cfg := range []*config.ForkConfig{{DataOnly: true}, {SchemaOnly: true}, {MinimalSchema: true}} {
+		dtm.config = cfg
+		assert.False(t, dtm.sectioned())
+	}
+}
@@ -0,0 +1,125 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+)
+
+// SeedFiles expands the configured seed paths into the SQL files to run, in order.
+// Directories contribute their *.sql files sorted by name; files are used as given.
+func SeedFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("seed path %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.sql"))
+		if err != nil {
+			return nil, fmt.Errorf("seed path %s: %w", path, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// runSeed loads fixture data into the target after the fork and before the PostFork
+// hooks: SQL files first, then seed commands
+func (f *Forker) runSeed(ctx context.Context) error {
+	files, err := SeedFiles(f.config.Seed)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && len(f.config.Hooks.Seed) == 0 {
+		return nil
+	}
+
+	// The URI names the destination's database, so connect through the parsed fields
+	target := f.targetConfig()
+
+	if len(files) > 0 {
+		f.logger.Infof("Seeding %s from %d SQL file(s)...", f.config.TargetDatabase, len(files))
+		conn, err := db.NewConnectionContext(ctx, &target)
+		if err != nil {
+			return fmt.Errorf("failed to connect to target database for seeding: %w", err)
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				f.logger.Warnf("Warning: Seed connection cleanup failed: %v", err)
+			}
+		}()
+
+		for _, file := range files {
+			script, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read seed file %s: %w", file, err)
+			}
+			f.logger.Debugf("Running seed file %s", file)
+			if _, err := conn.DB.ExecContext(ctx, string(script)); err != nil {
+				return fmt.Errorf("seed file %s failed: %w", file, err)
+			}
+		}
+	}
+
+	// Seed commands get libpq variables pointing at the new database
+	env, err := targetEnv(&target)
+	if err != nil {
+		return err
+	}
+	return NewHookRunner(f.logger).RunWithEnv(f.config.Hooks.Seed, "Seed", env)
+}
+
+// DescribeSeed summarises the seed stage for dry runs
+func DescribeSeed(paths, commands []string) string {
+	var parts []string
+	if len(paths) > 0 {
+		parts = append(parts, fmt.Sprintf("SQL from %s", strings.Join(paths, ", ")))
+	}
+	if len(commands) > 0 {
+		parts = append(parts, fmt.Sprintf("%d command(s)", len(commands)))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// targetEnv returns the libpq environment variables connecting to target, so psql,
+// pgbench and most framework tooling work without extra arguments
+func targetEnv(target *config.DatabaseConfig) ([]string, error) {
+	hosts, err := target.Hosts()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(hosts))
+	ports := make([]string, len(hosts))
+	for i, host := range hosts {
+		names[i], ports[i] = host.Host, strconv.Itoa(host.Port)
+	}
+	env := []string{
+		"PGHOST=" + strings.Join(names, ","),
+		"PGPORT=" + strings.Join(ports, ","),
+		"PGUSER=" + target.Username,
+		"PGPASSWORD=" + target.Password, // pragma: allowlist secret
+		"PGDATABASE=" + target.Database,
+		"PGFORK_TARGET_DATABASE=" + target.Database,
+	}
+	if target.SSLMode != "" {
+		env = append(env, "PGSSLMODE="+target.SSLMode)
+	}
+	if target.TargetSessionAttrs != "" {
+		env = append(env, "PGTARGETSESSIONATTRS="+target.TargetSessionAttrs)
+	}
+	return env, nil
+}
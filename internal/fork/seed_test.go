@@ -0,0 +1,36 @@
+package fork
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"02_orders.sql", "01_users.sql", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0644))
+	}
+	extra := filepath.Join(t.TempDir(), "extra.sql")
+	require.NoError(t, os.WriteFile(extra, []byte("SELECT 2;"), 0644))
+
+	files, err := SeedFiles([]string{dir, extra})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "01_users.sql"),
+		filepath.Join(dir, "02_orders.sql"),
+		extra,
+	}, files)
+
+	_, err = SeedFiles([]string{filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestDescribeSeed(t *testing.T) {
+	assert.Equal(t, "", DescribeSeed(nil, nil))
+	assert.Equal(t, "SQL from seeds/", DescribeSeed([]string{"seeds/"}, nil))
+	assert.Equal(t, "SQL from a.sql, b.sql and 1 command(s)", DescribeSeed([]string{"a.sql", "b.sql"}, []string{"make seed"}))
+}
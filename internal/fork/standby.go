@@ -0,0 +1,189 @@
+package fork
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/synthetic"
+	"github.com/lib/pq"
+)
+
+const (
+	// standbyFirstChunkPages is the size of the first chunk read from a standby, before
+	// the copy speed is known
+	standbyFirstChunkPages = 128
+	// standbyMinChunk is the shortest time a chunked read aims for, when the standby
+	// cancels conflicting queries at once
+	standbyMinChunk = time.Second
+	// standbyRetries is how often a chunk cancelled by a recovery conflict is retried
+	standbyRetries = 3
+)
+
+// standbyChunkDuration reports the risks of copying from a source in recovery and
+// returns how long one chunked read may take, or zero to copy with one dump. Chunks
+// aim for half of max_standby_streaming_delay, as replay may already have waited for
+// part of it when a chunk starts.
+func (f *Forker) standbyChunkDuration(ctx context.Context, source *db.Connection) (time.Duration, error) {
+	status, err := source.StandbyStatusContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !status.InRecovery {
+		if f.config.StandbyChunking {
+			f.logger.Infof("Source is not a standby, copying without standby chunking")
+		}
+		return 0, nil
+	}
+
+	f.logger.Infof("Source is a read-only standby (in recovery)")
+	if status.HotStandbyFeedback {
+		f.logger.Infof("hot_standby_feedback is on: the primary keeps the rows this copy still reads, so expect bloat on the primary during a long transfer")
+	}
+	if !status.CancelsQueries() {
+		if f.config.StandbyChunking {
+			f.logger.Infof("max_standby_streaming_delay is -1, so replay waits for the copy and standby chunking is not needed")
+		}
+		return 0, nil
+	}
+	if !f.config.StandbyChunking {
+		if !status.HotStandbyFeedback {
+			f.logger.Warnf("Warning: the standby cancels queries that hold up replay for more than %s (max_standby_streaming_delay), "+
+				"so a long transfer may fail with \"canceling statement due to conflict with recovery\"; "+
+				"set hot_standby_feedback = on on the standby, raise max_standby_streaming_delay, or use --standby-chunking",
+				status.MaxStandbyStreamingDelay)
+		}
+		return 0, nil
+	}
+
+	chunk := max(status.MaxStandbyStreamingDelay/2, standbyMinChunk)
+	f.logger.Infof("Copying data in queries of up to %s to stay under max_standby_streaming_delay (%s); "+
+		"the copy is not one consistent snapshot", chunk, status.MaxStandbyStreamingDelay)
+	return chunk, nil
+}
+
+// copyStandbyTables copies the data of every selected table in chunked reads, with
+// referenced tables before the tables referencing them, as the target already has its
+// foreign keys. Table groups are read whole, each from one snapshot.
+func (dtm *DataTransferManager) copyStandbyTables(ctx context.Context) error {
+	sizes, err := NewPlan(dtm.config).TransferSizes(ctx, dtm.source)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	tables := make([]string, 0, len(sizes))
+	for table := range sizes {
+		tables = append(tables, table)
+	}
+	tables, err = dtm.referenceOrder(ctx, tables)
+	if err != nil {
+		return err
+	}
+
+	// A table group is copied from its own snapshot where its first table comes
+	groups := dtm.snapshotGroups()
+	copiedGroups := make(map[string]bool)
+	for _, table := range tables {
+		if group, ok := dtm.config.TableGroup(table); ok && groups[group] != nil {
+			if !copiedGroups[group] {
+				copiedGroups[group] = true
+				if err := dtm.copyGroup(ctx, group, groups[group]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := dtm.copyTable(ctx, table, dtm.config.TableSettings(table), ""); err != nil {
+			return fmt.Errorf("failed to copy table %s: %w", table, err)
+		}
+		if dtm.metrics != nil {
+			dtm.metrics.incrementTableCount()
+		}
+	}
+	return nil
+}
+
+// referenceOrder sorts tables, named as in include_tables, so referenced tables come
+// first according to the target's foreign keys; others keep name order
+func (dtm *DataTransferManager) referenceOrder(ctx context.Context, tables []string) ([]string, error) {
+	schema, err := synthetic.LoadSchema(ctx, dtm.dest.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys of the target: %w", err)
+	}
+	position := make(map[string]int)
+	for i, table := range synthetic.Order(schema) {
+		position[strings.TrimPrefix(table.QualifiedName(), "public.")] = i
+	}
+	rank := func(table string) int {
+		if i, ok := position[table]; ok {
+			return i
+		}
+		return len(position)
+	}
+
+	sort.Strings(tables)
+	sort.SliceStable(tables, func(i, j int) bool { return rank(tables[i]) < rank(tables[j]) })
+	return tables, nil
+}
+
+// copyRangeInChunks copies a page range of a standby source in consecutive queries,
+// each into one target transaction, sizing every chunk from how long the previous one
+// took so it finishes within dtm.standbyChunk. A chunk cancelled by a recovery
+// conflict is rolled back and retried with fewer pages.
+func (dtm *DataTransferManager) copyRangeInChunks(ctx context.Context, r pageRange, pages int64, query func(pageRange) string, schema, table string, columns, transform []string) error {
+	step, retries := int64(standbyFirstChunkPages), 0
+	for start := r.start; ; {
+		chunk, last := nextChunk(r, start, step, pages)
+		began := time.Now()
+		err := dtm.copyRows(ctx, "", query(chunk), schema, table, columns, 0, transform)
+		if isRecoveryConflict(err) && retries < standbyRetries {
+			retries++
+			step = max(step/4, 1)
+			dtm.logger.Warnf("Chunk of %s cancelled by a recovery conflict, retrying with %d pages", table, step)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		start, retries = chunk.end, 0
+		step = nextChunkPages(step, time.Since(began), dtm.standbyChunk)
+	}
+}
+
+// nextChunk returns the chunk of up to step pages from start within r, and whether it
+// is the last one. The last chunk of an open-ended range is open-ended too.
+func nextChunk(r pageRange, start, step, pages int64) (pageRange, bool) {
+	chunk := pageRange{start: start, end: start + step}
+	switch {
+	case r.end > 0 && chunk.end >= r.end:
+		chunk.end = r.end
+		return chunk, true
+	case r.end == 0 && chunk.end >= pages:
+		chunk.end = 0
+		return chunk, true
+	}
+	return chunk, false
+}
+
+// nextChunkPages scales the pages of the next chunk so it takes about target, growing
+// at most fourfold at a time
+func nextChunkPages(pages int64, elapsed, target time.Duration) int64 {
+	next := pages * 4
+	if elapsed > 0 {
+		next = min(next, int64(float64(pages)*float64(target)/float64(elapsed)))
+	}
+	return max(next, 1)
+}
+
+// isRecoveryConflict reports whether err is a query cancelled by a standby to let
+// replay continue
+func isRecoveryConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "40001" && strings.Contains(pqErr.Message, "conflict with recovery")
+}
@@ -0,0 +1,41 @@
+package fork
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextChunk(t *testing.T) {
+	chunk, last := nextChunk(pageRange{0, 100}, 0, 40, 300)
+	assert.Equal(t, pageRange{0, 40}, chunk)
+	assert.False(t, last)
+
+	chunk, last = nextChunk(pageRange{0, 100}, 80, 40, 300)
+	assert.Equal(t, pageRange{80, 100}, chunk)
+	assert.True(t, last)
+
+	// The last chunk of an open-ended range stays open-ended for pages added since
+	chunk, last = nextChunk(pageRange{200, 0}, 280, 40, 300)
+	assert.Equal(t, pageRange{280, 0}, chunk)
+	assert.True(t, last)
+}
+
+func TestNextChunkPages(t *testing.T) {
+	assert.Equal(t, int64(200), nextChunkPages(100, 5*time.Second, 10*time.Second))
+	assert.Equal(t, int64(50), nextChunkPages(100, 20*time.Second, 10*time.Second))
+	assert.Equal(t, int64(400), nextChunkPages(100, time.Millisecond, 10*time.Second))
+	assert.Equal(t, int64(400), nextChunkPages(100, 0, 10*time.Second))
+	assert.Equal(t, int64(1), nextChunkPages(1, time.Minute, time.Second))
+}
+
+func TestIsRecoveryConflict(t *testing.T) {
+	conflict := &pq.Error{Code: "40001", Message: "canceling statement due to conflict with recovery"}
+	assert.True(t, isRecoveryConflict(conflict))
+	assert.False(t, isRecoveryConflict(&pq.Error{Code: "40001", Message: "could not serialize access"}))
+	assert.False(t, isRecoveryConflict(errors.New("conflict with recovery")))
+	assert.False(t, isRecoveryConflict(nil))
+}
@@ -0,0 +1,485 @@
+package fork
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/lib/pq"
+)
+
+// separateTables returns the configured tables whose rows are left out of the bulk
+// data load, because they are schema-only, copied with their own settings, or in a
+// table group read in a snapshot of its own
+func (dtm *DataTransferManager) separateTables() []string {
+	var tables []string
+	seen := make(map[string]bool)
+	for name, table := range dtm.config.Tables {
+		if table.SchemaOnly || table.Copied() {
+			tables = append(tables, name)
+			seen[strings.TrimPrefix(name, "public.")] = true
+		}
+	}
+	for _, group := range dtm.snapshotGroups() {
+		for _, table := range group {
+			if !seen[strings.TrimPrefix(table, "public.")] {
+				tables = append(tables, table)
+				seen[strings.TrimPrefix(table, "public.")] = true
+			}
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// snapshotGroups returns the selected tables of the table groups copied with COPY,
+// because a member has its own settings or the source is read in chunks. Those are
+// read from a snapshot of their own; the other groups are in pg_dump's snapshot.
+func (dtm *DataTransferManager) snapshotGroups() map[string][]string {
+	plan := NewPlan(dtm.config)
+	groups := make(map[string][]string)
+	for name, tables := range dtm.config.TableGroups {
+		tables = plan.FilterTables(tables)
+		copied := dtm.standbyChunk > 0
+		for _, table := range tables {
+			copied = copied || dtm.ownSettings(table).Copied()
+		}
+		if copied && len(tables) > 0 {
+			groups[name] = tables
+		}
+	}
+	return groups
+}
+
+// ownSettings returns the Tables entry of a table, without the fork-wide defaults
+func (dtm *DataTransferManager) ownSettings(table string) config.TableConfig {
+	for name, settings := range dtm.config.Tables {
+		if strings.TrimPrefix(name, "public.") == strings.TrimPrefix(table, "public.") {
+			return settings
+		}
+	}
+	return config.TableConfig{}
+}
+
+// tableCopyAttempts is how many times a table is copied, with on_table_error set to
+// retry, before its failure fails the fork
+const tableCopyAttempts = 3
+
+// copyTables copies the tables with their own settings and the table groups, after
+// the bulk data load
+func (dtm *DataTransferManager) copyTables(ctx context.Context) error {
+	plan := NewPlan(dtm.config)
+	groups := dtm.snapshotGroups()
+	for _, name := range dtm.separateTables() {
+		if group, ok := dtm.config.TableGroup(name); ok && groups[group] != nil {
+			continue
+		}
+		if !dtm.config.Tables[name].Copied() || len(plan.FilterTables([]string{name})) == 0 {
+			continue
+		}
+		if err := dtm.copyTableWithPolicy(ctx, name, dtm.config.TableSettings(name), ""); err != nil {
+			if err := dtm.tableFailed(ctx, name, err); err != nil {
+				return fmt.Errorf("failed to copy table %s: %w", name, err)
+			}
+			continue
+		}
+		if dtm.metrics != nil {
+			dtm.metrics.incrementTableCount()
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := dtm.copyGroup(ctx, name, groups[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyGroup copies the tables of a table group from one snapshot of the source,
+// exported by a transaction held open until every table is copied, so rows related
+// across the tables match. Referenced tables are copied first.
+func (dtm *DataTransferManager) copyGroup(ctx context.Context, group string, tables []string) error {
+	tables, err := dtm.referenceOrder(ctx, tables)
+	if err != nil {
+		return err
+	}
+	tx, err := dtm.source.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin snapshot of table group %s: %w", group, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var snapshot string
+	if err := tx.QueryRowContext(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		return fmt.Errorf("failed to export snapshot of table group %s: %w", group, err)
+	}
+
+	dtm.logger.Infof("Copying table group %s (%s) from one snapshot", group, strings.Join(tables, ", "))
+	for _, table := range tables {
+		if err := dtm.copyTableWithPolicy(ctx, table, dtm.config.TableSettings(table), snapshot); err != nil {
+			if err := dtm.tableFailed(ctx, table, err); err != nil {
+				return fmt.Errorf("failed to copy table %s of group %s: %w", table, group, err)
+			}
+			continue
+		}
+		if dtm.metrics != nil {
+			dtm.metrics.incrementTableCount()
+		}
+	}
+	return nil
+}
+
+// copyTableWithPolicy copies a table as copyTable does. With on_table_error set to
+// retry, a failed copy is repeated up to tableCopyAttempts times in all, after the
+// rows it committed are deleted.
+func (dtm *DataTransferManager) copyTableWithPolicy(ctx context.Context, table string, settings config.TableConfig, snapshot string) error {
+	err := dtm.copyTable(ctx, table, settings, snapshot)
+	if dtm.config.OnTableError != "retry" {
+		return err
+	}
+	for attempt := 2; err != nil && attempt <= tableCopyAttempts && ctx.Err() == nil; attempt++ {
+		dtm.logger.Warnf("Copy of table %s failed, retrying (attempt %d of %d): %v", table, attempt, tableCopyAttempts, err)
+		dtm.report.tableRetried()
+		schema, name := splitTable(table)
+		if _, err = dtm.dest.DB.ExecContext(ctx, "DELETE FROM "+pq.QuoteIdentifier(schema)+"."+pq.QuoteIdentifier(name)); err != nil {
+			return fmt.Errorf("failed to clear table before retrying: %w", err)
+		}
+		err = dtm.copyTable(ctx, table, settings, snapshot)
+	}
+	return err
+}
+
+// tableFailed returns err when a failed table copy fails the fork. With
+// on_table_error set to continue it records the table in the report instead, unless
+// the fork itself was cancelled.
+func (dtm *DataTransferManager) tableFailed(ctx context.Context, table string, err error) error {
+	if dtm.config.OnTableError != "continue" || ctx.Err() != nil {
+		return err
+	}
+	dtm.logger.Warnf("Failed to copy table %s, continuing with the other tables: %v", table, err)
+	dtm.report.tableFailed(table, err)
+	return nil
+}
+
+// copyTable copies one table's rows, split into page ranges copied by parallel
+// connections in chunks of the configured number of rows. Given the snapshot of a
+// table group, every range reads in it, and a standby source is not read in chunks.
+func (dtm *DataTransferManager) copyTable(ctx context.Context, table string, settings config.TableConfig, snapshot string) error {
+	dtm.report.useEngine(EngineCopy)
+	schema, name := splitTable(table)
+	if dtm.metrics != nil {
+		start := time.Now()
+		defer func() { dtm.metrics.recordTable(schema+"."+name, 0, 0, time.Since(start)) }()
+	}
+	columns, err := copyColumns(ctx, dtm.source.DB, schema, name)
+	if err != nil {
+		return err
+	}
+	selectList, err := masking.SelectList(table, columns, settings.Masking)
+	if err != nil {
+		return err
+	}
+
+	var pages int64
+	quoted := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	if err := dtm.source.DB.QueryRowContext(ctx,
+		"SELECT pg_relation_size($1::regclass) / current_setting('block_size')::bigint", quoted).Scan(&pages); err != nil {
+		return fmt.Errorf("failed to read table size: %w", err)
+	}
+
+	ranges := pageRanges(pages, settings.Parallelism)
+	chunked := dtm.standbyChunk > 0 && snapshot == ""
+	if chunked {
+		dtm.logger.Infof("Copying table %s with %d connections, in queries of up to %s", table, len(ranges), dtm.standbyChunk)
+	} else {
+		dtm.logger.Infof("Copying table %s with %d connections, %d rows per chunk", table, len(ranges), settings.ChunkSize)
+	}
+
+	query := func(r pageRange) string {
+		conditions := r.conditions()
+		if settings.Where != "" {
+			conditions = append(conditions, "("+settings.Where+")")
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s", selectList, quoted)
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+		return query
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(ranges))
+	var wg sync.WaitGroup
+	for _, r := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if chunked {
+				err = dtm.copyRangeInChunks(ctx, r, pages, query, schema, name, columns, settings.Transform)
+			} else {
+				err = dtm.copyRows(ctx, snapshot, query(r), schema, name, columns, settings.ChunkSize, settings.Transform)
+			}
+			if err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// copyRows copies the rows of a query into the target table, committing every chunk
+// of chunkSize rows, or all rows at once when chunkSize is zero. The query reads in
+// the exported snapshot when one is given. With a transform program, the rows loaded
+// are those the program writes.
+func (dtm *DataTransferManager) copyRows(ctx context.Context, snapshot, query, schema, table string, columns []string, chunkSize int, transform []string) error {
+	queried, release, err := dtm.queryRows(ctx, snapshot, query)
+	if err != nil {
+		return fmt.Errorf("failed to read rows: %w", err)
+	}
+	defer release()
+	defer func() {
+		if err := queried.Close(); err != nil {
+			dtm.logger.Warnf("Failed to close rows: %v", err)
+		}
+	}()
+
+	var rows rowSource = queried
+	if len(transform) > 0 {
+		transformed, err := startTransform(ctx, transform, queried, schema+"."+table, columns)
+		if err != nil {
+			return err
+		}
+		// Stops the program before the rows it reads are closed
+		defer transformed.Close()
+		rows = transformed
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	// An unfinished chunk is rolled back
+	var chunk *copyChunk
+	defer func() {
+		if chunk != nil {
+			chunk.abort(dtm)
+		}
+	}()
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if chunk == nil {
+			if chunk, err = dtm.beginChunk(ctx, schema, table, columns); err != nil {
+				return err
+			}
+		}
+		if err := chunk.add(values); err != nil {
+			return err
+		}
+		if chunkSize > 0 && chunk.rows >= int64(chunkSize) {
+			full := chunk
+			chunk = nil
+			if err := full.commit(dtm); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if chunk != nil {
+		last := chunk
+		chunk = nil
+		return last.commit(dtm)
+	}
+	return nil
+}
+
+// queryRows runs a query on the source, in a transaction using the exported snapshot
+// when one is given; release ends the transaction once the rows are closed
+func (dtm *DataTransferManager) queryRows(ctx context.Context, snapshot, query string) (*sql.Rows, func(), error) {
+	if snapshot == "" {
+		rows, err := dtm.source.DB.QueryContext(ctx, query)
+		return rows, func() {}, err
+	}
+	tx, err := dtm.source.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "SET TRANSACTION SNAPSHOT "+pq.QuoteLiteral(snapshot)); err != nil {
+		_ = tx.Rollback()
+		return nil, nil, fmt.Errorf("failed to use snapshot %s: %w", snapshot, err)
+	}
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, nil, err
+	}
+	return rows, func() { _ = tx.Rollback() }, nil
+}
+
+// copyChunk is one transaction of a table copy
+type copyChunk struct {
+	tx *sql.Tx
+	// table is the schema-qualified name of the target table
+	table string
+	stmt  *sql.Stmt
+	rows  int64
+	bytes int64
+}
+
+// beginChunk starts a COPY into the target table
+func (dtm *DataTransferManager) beginChunk(ctx context.Context, schema, table string, columns []string) (*copyChunk, error) {
+	tx, err := dtm.dest.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(schema, table, columns...))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("failed to start COPY: %w", err)
+	}
+	return &copyChunk{tx: tx, table: schema + "." + table, stmt: stmt}, nil
+}
+
+// add sends one row
+func (c *copyChunk) add(values []sql.NullString) error {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		if value.Valid {
+			args[i] = value.String
+			c.bytes += int64(len(value.String))
+		}
+	}
+	if _, err := c.stmt.Exec(args...); err != nil {
+		return fmt.Errorf("failed to copy row: %w", err)
+	}
+	c.rows++
+	return nil
+}
+
+// commit finishes the COPY and reports the chunk as transferred; the chunk is rolled
+// back if it cannot be finished
+func (c *copyChunk) commit(dtm *DataTransferManager) error {
+	if _, err := c.stmt.Exec(); err != nil {
+		c.abort(dtm)
+		return fmt.Errorf("failed to finish COPY: %w", err)
+	}
+	if err := c.stmt.Close(); err != nil {
+		c.abort(dtm)
+		return fmt.Errorf("failed to finish COPY: %w", err)
+	}
+	if err := c.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit chunk: %w", err)
+	}
+	if dtm.metrics != nil {
+		dtm.metrics.updateMetrics(c.bytes, c.rows)
+		dtm.metrics.recordTable(c.table, c.bytes, c.rows, 0)
+	}
+	return nil
+}
+
+// abort rolls the chunk back
+func (c *copyChunk) abort(dtm *DataTransferManager) {
+	if err := c.tx.Rollback(); err != nil {
+		dtm.logger.Warnf("Failed to roll back chunk: %v", err)
+	}
+}
+
+// pageRange is a range of heap pages, open-ended when end is zero
+type pageRange struct {
+	start, end int64
+}
+
+// conditions returns the ctid conditions selecting the range's rows
+func (r pageRange) conditions() []string {
+	var conditions []string
+	if r.start > 0 {
+		conditions = append(conditions, fmt.Sprintf("ctid >= '(%d,0)'::tid", r.start))
+	}
+	if r.end > 0 {
+		conditions = append(conditions, fmt.Sprintf("ctid < '(%d,0)'::tid", r.end))
+	}
+	return conditions
+}
+
+// pageRanges splits a table of the given number of pages into up to n ranges. The
+// last range is open-ended, so rows added to new pages while copying are not lost.
+func pageRanges(pages int64, n int) []pageRange {
+	if int64(n) > pages {
+		n = int(pages)
+	}
+	if n < 1 {
+		n = 1
+	}
+	ranges := make([]pageRange, n)
+	for i := range ranges {
+		ranges[i].start = pages * int64(i) / int64(n)
+		if i < n-1 {
+			ranges[i].end = pages * int64(i+1) / int64(n)
+		}
+	}
+	return ranges
+}
+
+// copyColumns returns the columns of a table that COPY can write, in order:
+// generated columns are computed by the target
+func copyColumns(ctx context.Context, db *sql.DB, schema, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.attname
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2
+		  AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = ''
+		ORDER BY a.attnum`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	return columns, nil
+}
+
+// splitTable splits a table name as written in the config into schema and name,
+// defaulting to the public schema
+func splitTable(table string) (string, string) {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return schema, name
+	}
+	return "public", table
+}
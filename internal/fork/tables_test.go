@@ -0,0 +1,129 @@
+package fork
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageRanges(t *testing.T) {
+	assert.Equal(t, []pageRange{{0, 0}}, pageRanges(0, 4))
+	assert.Equal(t, []pageRange{{0, 0}}, pageRanges(100, 1))
+	assert.Equal(t, []pageRange{{0, 33}, {33, 66}, {66, 0}}, pageRanges(100, 3))
+	assert.Equal(t, []pageRange{{0, 1}, {1, 0}}, pageRanges(2, 8))
+
+	assert.Empty(t, pageRange{0, 0}.conditions())
+	assert.Equal(t, []string{"ctid >= '(33,0)'::tid", "ctid < '(66,0)'::tid"}, pageRange{33, 66}.conditions())
+}
+
+func TestSnapshotGroups(t *testing.T) {
+	cfg := &config.ForkConfig{
+		ChunkSize:     1000,
+		ExcludeTables: []string{"refunds"},
+		Tables:        map[string]config.TableConfig{"public.orders": {Where: "created_at > now() - interval '30 days'"}},
+		TableGroups: map[string][]string{
+			"orders":  {"orders", "order_items", "refunds"},
+			"billing": {"invoices", "payments"},
+		},
+	}
+	dtm, _, _ := newExtensionsTransfer(t, cfg)
+
+	// Only the group with a table copied on its own leaves the bulk data load
+	assert.Equal(t, map[string][]string{"orders": {"orders", "order_items"}}, dtm.snapshotGroups())
+	assert.Equal(t, []string{"order_items", "public.orders"}, dtm.separateTables())
+
+	// Reading a standby in chunks would split every group
+	dtm.SetStandbyChunking(time.Second)
+	assert.Len(t, dtm.snapshotGroups(), 2)
+}
+
+func TestQueryRows_Snapshot(t *testing.T) {
+	dtm, source, _ := newExtensionsTransfer(t, &config.ForkConfig{})
+
+	source.ExpectBegin()
+	source.ExpectExec("SET TRANSACTION SNAPSHOT '00000003-0000001B-1'").WillReturnResult(sqlmock.NewResult(0, 0))
+	source.ExpectQuery("SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	source.ExpectRollback()
+
+	rows, release, err := dtm.queryRows(context.Background(), "00000003-0000001B-1", "SELECT id FROM orders")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+	release()
+	assert.NoError(t, source.ExpectationsWereMet())
+}
+
+func TestCopyTables_OnTableError(t *testing.T) {
+	cfg := &config.ForkConfig{
+		ChunkSize:    1000,
+		OnTableError: "continue",
+		Tables:       map[string]config.TableConfig{"orders": {Where: "id > 10"}},
+	}
+	dtm, source, dest := newExtensionsTransfer(t, cfg)
+	report := newReport(NewPlan(cfg))
+	dtm.SetReport(report)
+
+	source.ExpectQuery("FROM pg_attribute").WillReturnError(errors.New("permission denied"))
+	require.NoError(t, dtm.copyTables(context.Background()))
+	assert.Equal(t, []TableFailure{{Table: "orders", Error: "failed to read columns: permission denied"}}, report.FailedTables)
+	assert.Equal(t, "continue", report.OnTableError)
+
+	cfg.OnTableError = "retry"
+	for attempt := 1; attempt <= tableCopyAttempts; attempt++ {
+		source.ExpectQuery("FROM pg_attribute").WillReturnError(errors.New("permission denied"))
+		if attempt < tableCopyAttempts {
+			dest.ExpectExec(`DELETE FROM "public"."orders"`).WillReturnResult(sqlmock.NewResult(0, 5))
+		}
+	}
+	assert.ErrorContains(t, dtm.copyTables(context.Background()), "failed to copy table orders")
+	assert.Equal(t, tableCopyAttempts-1, report.TableRetries)
+
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, dest.ExpectationsWereMet())
+}
+
+func TestCopyTables_CountsTables(t *testing.T) {
+	cfg := &config.ForkConfig{
+		Tables: map[string]config.TableConfig{
+			"orders":   {Where: "id > 10"},
+			"invoices": {Where: "id > 10"},
+		},
+		TableGroups: map[string][]string{"billing": {"invoices", "payments"}},
+	}
+	dtm, source, dest := newExtensionsTransfer(t, cfg)
+	forker := NewForker(cfg)
+	dtm.SetMetricsUpdater(forker)
+
+	expectEmptyCopy := func(table string, snapshot bool) {
+		source.ExpectQuery("FROM pg_attribute").WillReturnRows(sqlmock.NewRows([]string{"attname"}).AddRow("id"))
+		source.ExpectQuery("SELECT pg_relation_size").WillReturnRows(sqlmock.NewRows([]string{"pages"}).AddRow(0))
+		if snapshot {
+			source.ExpectBegin()
+			source.ExpectExec("SET TRANSACTION SNAPSHOT").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		source.ExpectQuery(`FROM "public"."` + table + `"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		if snapshot {
+			source.ExpectRollback()
+		}
+	}
+
+	// orders is copied on its own, invoices and payments from one snapshot
+	expectEmptyCopy("orders", false)
+	dest.ExpectQuery("FROM pg_class").WillReturnRows(sqlmock.NewRows([]string{"oid", "nspname", "relname"}))
+	source.ExpectBegin()
+	source.ExpectQuery("SELECT pg_export_snapshot").WillReturnRows(sqlmock.NewRows([]string{"snapshot"}).AddRow("00000003-0000001B-1"))
+	expectEmptyCopy("invoices", true)
+	expectEmptyCopy("payments", true)
+	source.ExpectRollback()
+
+	require.NoError(t, dtm.copyTables(context.Background()))
+	assert.Equal(t, int64(3), forker.metrics.tablesProcessed)
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, dest.ExpectationsWereMet())
+}
@@ -0,0 +1,198 @@
+package fork
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// maxSuffixAttempts bounds the names tried with AutoSuffix
+const maxSuffixAttempts = 100
+
+// createTarget creates the target database from the given template. An existing
+// target is dropped with DropIfExists, after a backup with BackupBeforeDrop; with AutoSuffix the next free suffixed name
+// is used instead, and TargetDatabase is updated so outputs report the final name.
+// The create itself decides who owns a name, so concurrent CI jobs forking to the
+// same name each end up with their own database.
+func (f *Forker) createTarget(ctx context.Context, conn *db.Connection, template string) error {
+	base := f.config.TargetDatabase
+	for attempt := 1; attempt <= maxSuffixAttempts; attempt++ {
+		name := suffixedName(base, attempt)
+
+		exists, err := conn.DatabaseExistsContext(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to check target database: %w", err)
+		}
+		if exists {
+			switch {
+			case f.config.DropIfExists:
+				if f.config.BackupBeforeDrop != "" {
+					if err := f.backupBeforeDrop(ctx, name); err != nil {
+						return fmt.Errorf("not dropping existing target database, backup failed: %w", err)
+					}
+				}
+				// A target left a template by an earlier fork cannot be dropped as it is
+				if f.config.TargetIsTemplate {
+					notTemplate := false
+					if err := conn.AlterDatabaseContext(ctx, name, db.DatabaseSettings{IsTemplate: &notTemplate}); err != nil {
+						return fmt.Errorf("failed to unmark existing target database as a template: %w", err)
+					}
+				}
+				if err := conn.DropDatabaseContext(ctx, name); err != nil {
+					return fmt.Errorf("failed to drop existing target database: %w", err)
+				}
+			case f.config.AutoSuffix:
+				continue
+			default:
+				return fmt.Errorf("target database '%s' already exists (use --drop-if-exists to overwrite or --auto-suffix to pick a free name)", name)
+			}
+		}
+
+		err = f.createDatabase(ctx, conn, name, template)
+		if f.config.AutoSuffix && db.IsDuplicateDatabase(err) {
+			// Another fork claimed the name between the check and the create
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create target database: %w", err)
+		}
+
+		if name != base {
+			// The suffixed name is as sensitive as the one asked for
+			f.logger.Redactor().Add(logging.Identifier{Name: name, Kind: "db", Alias: "target-db"})
+			f.logger.Infof("Target database '%s' already exists, using '%s'", base, name)
+			f.config.TargetDatabase = name
+		}
+		return nil
+	}
+	return fmt.Errorf("no free name for target database '%s' after %d attempts", base, maxSuffixAttempts)
+}
+
+// sourceIdleRetryInterval is how long the first wait for a busy source lasts, before
+// backing off
+var sourceIdleRetryInterval = time.Second
+
+// createDatabase creates name from template. CreateDatabaseContext retries a template
+// that other sessions are connected to for a few seconds; with WaitForSourceIdle the
+// clone is instead retried with backoff for that long, so brief connections such as
+// monitoring agents do not fail the fork.
+func (f *Forker) createDatabase(ctx context.Context, conn *db.Connection, name, template string) error {
+	if f.config.WaitForSourceIdle <= 0 {
+		return conn.CreateDatabaseContext(ctx, name, template, false)
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = sourceIdleRetryInterval
+	b.MaxInterval = 15 * time.Second
+	b.MaxElapsedTime = f.config.WaitForSourceIdle
+	err := backoff.Retry(func() error {
+		err := conn.CreateDatabaseOnceContext(ctx, name, template)
+		if err != nil && !db.IsObjectInUse(err) {
+			return backoff.Permanent(err)
+		}
+		if err != nil {
+			if sessions, err := conn.SessionsContext(ctx, template); err == nil && len(sessions) > 0 {
+				f.logger.Infof("Waiting for %s to be idle, connected: %s", template, strings.Join(sessions, ", "))
+			}
+		}
+		return err
+	}, backoff.WithContext(b, ctx))
+	if db.IsObjectInUse(err) {
+		return fmt.Errorf("source database %s still had other sessions after waiting %s: %w", template, f.config.WaitForSourceIdle, err)
+	}
+	return err
+}
+
+// waitForTarget connects to the destination server until it accepts connections,
+// retrying with backoff for up to WaitForTarget while it is starting up or refuses
+// connections. Other connection errors are returned at once.
+func (f *Forker) waitForTarget(ctx context.Context) error {
+	adminConfig := f.config.Destination.Admin()
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = 500 * time.Millisecond
+	b.MaxInterval = 5 * time.Second
+	b.MaxElapsedTime = f.config.WaitForTarget
+	waited := false
+	err := backoff.Retry(func() error {
+		conn, err := db.NewConnectionContext(ctx, &adminConfig)
+		if err != nil {
+			if !db.IsNotReady(err) {
+				return backoff.Permanent(err)
+			}
+			if !waited {
+				f.logger.Infof("Destination server %s is not ready yet, waiting up to %s: %v", adminConfig.Address(), f.config.WaitForTarget, err)
+				waited = true
+			}
+			return err
+		}
+		_ = conn.Close()
+		return nil
+	}, backoff.WithContext(b, ctx))
+	if err != nil && waited {
+		return fmt.Errorf("destination server did not become ready within %s: %w", f.config.WaitForTarget, err)
+	}
+	if err == nil && waited {
+		f.logger.Info("Destination server is ready")
+	}
+	return err
+}
+
+// targetSettings returns the configured owner, connection limit and template flag of
+// the target
+func targetSettings(cfg *config.ForkConfig) db.DatabaseSettings {
+	settings := db.DatabaseSettings{Owner: cfg.TargetOwner}
+	if cfg.TargetConnectionLimit > 0 {
+		limit := cfg.TargetConnectionLimit
+		settings.ConnectionLimit = &limit
+	}
+	if cfg.TargetIsTemplate {
+		isTemplate := true
+		settings.IsTemplate = &isTemplate
+	}
+	return settings
+}
+
+// applyTargetSettings sets the configured owner, connection limit and template flag
+// on the populated target
+func (f *Forker) applyTargetSettings(ctx context.Context) error {
+	adminConfig := f.config.Destination.Admin()
+
+	conn, err := db.NewConnectionContext(ctx, &adminConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			f.logger.Warnf("Warning: Connection cleanup failed: %v", err)
+		}
+	}()
+
+	settings := targetSettings(f.config)
+	f.logger.Infof("Setting %s on %s", settings.Describe(), f.config.TargetDatabase)
+	return conn.AlterDatabaseContext(ctx, f.config.TargetDatabase, settings)
+}
+
+// suffixedName returns the name for the given attempt: the base name first, then
+// base_2, base_3 and so on, shortening the base to stay within 63 bytes
+func suffixedName(base string, attempt int) string {
+	if attempt <= 1 {
+		return base
+	}
+	suffix := fmt.Sprintf("_%d", attempt)
+	if len(base)+len(suffix) > 63 {
+		base = base[:63-len(suffix)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+	}
+	return base + suffix
+}
@@ -0,0 +1,219 @@
+package fork
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuffixedName(t *testing.T) {
+	assert.Equal(t, "myapp_pr_123", suffixedName("myapp_pr_123", 1))
+	assert.Equal(t, "myapp_pr_123_2", suffixedName("myapp_pr_123", 2))
+
+	long := strings.Repeat("a", 63)
+	name := suffixedName(long, 12)
+	assert.Len(t, name, 63)
+	assert.True(t, strings.HasSuffix(name, "_12"))
+}
+
+func TestForker_CreateTargetAutoSuffix(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_pr_123", AutoSuffix: true}
+	forker := NewForker(cfg)
+	conn := &db.Connection{DB: mockDB}
+
+	exists := func(name string, found bool) {
+		rows := sqlmock.NewRows([]string{"exists"})
+		if found {
+			rows.AddRow(1)
+		}
+		mock.ExpectQuery("SELECT 1 FROM pg_database").WithArgs(name).WillReturnRows(rows)
+	}
+
+	// The base name is taken, and another job claims _2 between the check and the create
+	exists("myapp_pr_123", true)
+	exists("myapp_pr_123_2", false)
+	mock.ExpectExec(`CREATE DATABASE "myapp_pr_123_2"`).WillReturnError(&pq.Error{Code: "42P04"})
+	exists("myapp_pr_123_3", false)
+	mock.ExpectExec(`CREATE DATABASE "myapp_pr_123_3" WITH TEMPLATE "template1"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, forker.createTarget(context.Background(), conn, "template1"))
+	assert.Equal(t, "myapp_pr_123_3", cfg.TargetDatabase)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Without AutoSuffix an existing target is an error
+	cfg.TargetDatabase = "myapp_pr_123"
+	cfg.AutoSuffix = false
+	exists("myapp_pr_123", true)
+	err = forker.createTarget(context.Background(), conn, "template1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForker_CreateTargetAutoSuffixRedacted(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_pr_123", AutoSuffix: true, Privacy: logging.PrivacyAlias}
+	forker := NewForker(cfg)
+	var logs bytes.Buffer
+	forker.logger.SetOutput(&logs)
+	conn := &db.Connection{DB: mockDB}
+
+	mock.ExpectQuery("SELECT 1 FROM pg_database").WithArgs("myapp_pr_123").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+	mock.ExpectQuery("SELECT 1 FROM pg_database").WithArgs("myapp_pr_123_2").WillReturnRows(sqlmock.NewRows([]string{"exists"}))
+	mock.ExpectExec(`CREATE DATABASE "myapp_pr_123_2"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, forker.createTarget(context.Background(), conn, "template1"))
+	assert.Equal(t, "myapp_pr_123_2", cfg.TargetDatabase)
+	// The name picked is redacted like the one asked for, here and in later output
+	assert.Contains(t, logs.String(), "Target database 'target-db' already exists, using 'target-db'")
+	assert.NotContains(t, logs.String(), "myapp_pr_123")
+	assert.Equal(t, "target-db", forker.logger.Redactor().Redact("myapp_pr_123_2"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForker_CreateTargetDropsTemplate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if err := mockDB.Close(); err != nil {
+			t.Logf("Failed to close database connection: %v", err)
+		}
+	}()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_golden", DropIfExists: true, TargetIsTemplate: true}
+	forker := NewForker(cfg)
+	conn := &db.Connection{DB: mockDB}
+
+	// A target an earlier fork marked as a template is unmarked before it is dropped
+	mock.ExpectQuery("SELECT 1 FROM pg_database").WithArgs("myapp_golden").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+	mock.ExpectExec(`ALTER DATABASE "myapp_golden" WITH IS_TEMPLATE false`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("pg_terminate_backend").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP DATABASE IF EXISTS "myapp_golden"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE DATABASE "myapp_golden" WITH TEMPLATE "template1"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, forker.createTarget(context.Background(), conn, "template1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForker_CreateDatabaseNotInUse(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_pr_1", WaitForSourceIdle: time.Minute}
+	forker := NewForker(cfg)
+	conn := &db.Connection{DB: mockDB}
+
+	// Errors other than a source in use are not waited on
+	mock.ExpectExec(`CREATE DATABASE "myapp_pr_1" WITH TEMPLATE "myapp"`).WillReturnError(&pq.Error{Code: "42501"})
+	err = forker.createDatabase(context.Background(), conn, "myapp_pr_1", "myapp")
+	require.Error(t, err)
+	assert.False(t, db.IsObjectInUse(err))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForker_CreateDatabaseWaitsForSourceIdle(t *testing.T) {
+	interval := sourceIdleRetryInterval
+	sourceIdleRetryInterval = 10 * time.Millisecond
+	defer func() { sourceIdleRetryInterval = interval }()
+
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_pr_1", WaitForSourceIdle: time.Minute}
+	forker := NewForker(cfg)
+	var logs bytes.Buffer
+	forker.logger.SetOutput(&logs)
+	conn := &db.Connection{DB: mockDB}
+
+	// The source is in use twice, then the clone goes through
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(`CREATE DATABASE "myapp_pr_1" WITH TEMPLATE "myapp"`).WillReturnError(&pq.Error{Code: "55006"})
+		mock.ExpectQuery("FROM pg_stat_activity").WithArgs("myapp").WillReturnRows(sqlmock.NewRows([]string{"session"}).AddRow("datadog (monitor)"))
+	}
+	mock.ExpectExec(`CREATE DATABASE "myapp_pr_1" WITH TEMPLATE "myapp"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, forker.createDatabase(context.Background(), conn, "myapp_pr_1", "myapp"))
+	assert.Contains(t, logs.String(), "Waiting for myapp to be idle, connected: datadog (monitor)")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForker_CreateDatabaseSourceIdleTimeout(t *testing.T) {
+	interval := sourceIdleRetryInterval
+	sourceIdleRetryInterval = 10 * time.Millisecond
+	defer func() { sourceIdleRetryInterval = interval }()
+
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+
+	cfg := &config.ForkConfig{TargetDatabase: "myapp_pr_1", WaitForSourceIdle: 50 * time.Millisecond}
+	forker := NewForker(cfg)
+	conn := &db.Connection{DB: mockDB}
+
+	// The source stays in use for longer than the fork waits
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 20; i++ {
+		mock.ExpectExec(`CREATE DATABASE "myapp_pr_1" WITH TEMPLATE "myapp"`).WillReturnError(&pq.Error{Code: "55006"})
+		mock.ExpectQuery("FROM pg_stat_activity").WithArgs("myapp").WillReturnRows(sqlmock.NewRows([]string{"session"}))
+	}
+
+	start := time.Now()
+	err = forker.createDatabase(context.Background(), conn, "myapp_pr_1", "myapp")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source database myapp still had other sessions after waiting 50ms")
+	assert.True(t, db.IsObjectInUse(err))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestForker_WaitForTarget(t *testing.T) {
+	// Nothing listens on a port just released
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+
+	cfg := &config.ForkConfig{
+		Destination:   config.DatabaseConfig{Host: "127.0.0.1", Port: port, Username: "postgres", Database: "postgres", SSLMode: "disable"},
+		WaitForTarget: time.Second,
+	}
+	err = NewForker(cfg).waitForTarget(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "destination server did not become ready within 1s")
+	assert.True(t, db.IsNotReady(err))
+}
+
+func TestTargetSettings(t *testing.T) {
+	assert.True(t, targetSettings(&config.ForkConfig{}).Empty())
+
+	settings := targetSettings(&config.ForkConfig{TargetOwner: "app_owner", TargetConnectionLimit: 5, TargetIsTemplate: true})
+	require.NotNil(t, settings.ConnectionLimit)
+	require.NotNil(t, settings.IsTemplate)
+	assert.Equal(t, "app_owner", settings.Owner)
+	assert.Equal(t, 5, *settings.ConnectionLimit)
+	assert.True(t, *settings.IsTemplate)
+}
@@ -1,35 +1,59 @@
 package fork
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
 	"github.com/hongkongkiwi/postgres-db-fork/internal/logging"
-
-	"github.com/schollz/progressbar/v3"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/provider"
 )
 
 // DataTransferManager handles cross-server data transfer with optimizations
 type DataTransferManager struct {
-	source      *db.Connection
-	dest        *db.Connection
-	sourceCfg   *config.DatabaseConfig
-	destCfg     *config.DatabaseConfig
-	config      *config.ForkConfig
-	progressBar *progressbar.ProgressBar
-	metrics     MetricsUpdater
-	logger      *logging.Logger
+	source    *db.Connection
+	dest      *db.Connection
+	sourceCfg *config.DatabaseConfig
+	destCfg   *config.DatabaseConfig
+	config    *config.ForkConfig
+	metrics   MetricsUpdater
+	logger    *logging.Logger
+
+	// excludeSchemas are left out of both dumps, as set by detected extensions
+	excludeSchemas []string
+	// includeTables and excludeTables are the exact tables regex table filters
+	// resolved to, which pg_dump cannot match itself
+	includeTables, excludeTables []string
+	// standbyChunk is how long one read of a standby source may take when its data is
+	// copied in chunks; zero copies with one dump
+	standbyChunk time.Duration
+	// workDir is where dump archives are spooled; empty uses the configured work_dir
+	workDir string
+	// report records the engines used and how long each phase took, when set
+	report *Report
+	// provider is the managed service hosting the destination, whose restrictions the
+	// restore works around
+	provider provider.Profile
+	// matviews are the materialized views refreshed after the indexes are created,
+	// whose data the data dump leaves out
+	matviews []string
 }
 
 // MetricsUpdater interface for updating metrics
 type MetricsUpdater interface {
 	updateMetrics(bytesTransferred, rowsTransferred int64)
 	incrementTableCount()
+	// recordTable adds to the per-table series of a table copied with COPY
+	recordTable(table string, bytesTransferred, rowsTransferred int64, elapsed time.Duration)
 }
 
 // NewDataTransferManager creates a new data transfer manager
@@ -49,55 +73,66 @@ func (dtm *DataTransferManager) SetMetricsUpdater(updater MetricsUpdater) {
 	dtm.metrics = updater
 }
 
+// SetStandbyChunking copies the data in reads that each take at most d, as set for a
+// standby source that cancels long queries
+func (dtm *DataTransferManager) SetStandbyChunking(d time.Duration) {
+	dtm.standbyChunk = d
+}
+
+// SetReport records the engines and phase durations of the transfer in report
+func (dtm *DataTransferManager) SetReport(report *Report) {
+	dtm.report = report
+}
+
+// SetProvider restores to a destination hosted by the managed service of profile
+func (dtm *DataTransferManager) SetProvider(profile provider.Profile) {
+	dtm.provider = profile
+}
+
+// SetWorkDir spools dump archives to dir, which the caller removes afterwards
+func (dtm *DataTransferManager) SetWorkDir(dir string) {
+	dtm.workDir = dir
+}
+
+// spoolDir returns the directory dump archives are spooled to
+func (dtm *DataTransferManager) spoolDir() string {
+	if dtm.workDir != "" {
+		return dtm.workDir
+	}
+	return workDirBase(dtm.config.WorkDir)
+}
+
 // Transfer executes the complete data transfer with optimizations
 func (dtm *DataTransferManager) Transfer(ctx context.Context) error {
 	dtm.logger.Info("Starting optimized cross-server data transfer...")
 
-	// Get list of tables for progress bar setup
-	tables, err := dtm.source.GetTableList("public")
-	if err != nil {
-		return fmt.Errorf("failed to get table list: %w", err)
-	}
-
-	// Filter tables based on include/exclude lists
-	tables = dtm.filterTables(tables)
-
-	// Create progress bar if not in quiet mode
-	if !dtm.config.Quiet && len(tables) > 0 {
-		dtm.progressBar = progressbar.NewOptions(len(tables),
-			progressbar.OptionSetDescription("Transferring tables..."),
-			progressbar.OptionSetWidth(50),
-			progressbar.OptionShowCount(),
-			progressbar.OptionShowIts(),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "█",
-				SaucerHead:    "█",
-				SaucerPadding: "░",
-				BarStart:      "│",
-				BarEnd:        "│",
-			}),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionSetPredictTime(true),
-		)
-	}
-
 	// Optimize destination database for bulk loading
 	if err := dtm.optimizeDestination(); err != nil {
 		return fmt.Errorf("failed to optimize destination: %w", err)
 	}
 
-	// First, transfer schema if not data-only
-	if !dtm.config.DataOnly {
-		if err := dtm.transferSchema(ctx); err != nil {
-			return fmt.Errorf("failed to transfer schema: %w", err)
-		}
+	// Extensions with their own metadata need their own restore procedure
+	extensions, err := dtm.detectExtensions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to prepare extensions: %w", err)
+	}
+	dtm.excludeSchemas = excludedSchemas(extensions)
+	if err := dtm.resolveTables(ctx); err != nil {
+		return err
+	}
+	if err := dtm.runExtensionHooks(ctx, extensions, false); err != nil {
+		return err
 	}
 
-	// Then, transfer data if not schema-only
-	if !dtm.config.SchemaOnly {
-		if err := dtm.transferDataOptimized(ctx); err != nil {
-			return fmt.Errorf("failed to transfer data: %w", err)
+	if err := dtm.transferContents(ctx); err != nil {
+		// Leave the extensions' restore mode even though the target is incomplete
+		if hookErr := dtm.runExtensionHooks(ctx, extensions, true); hookErr != nil {
+			dtm.logger.Warnf("Failed to end extension restore mode: %v", hookErr)
 		}
+		return err
+	}
+	if err := dtm.runExtensionHooks(ctx, extensions, true); err != nil {
+		return err
 	}
 
 	// Restore normal database settings
@@ -109,6 +144,48 @@ func (dtm *DataTransferManager) Transfer(ctx context.Context) error {
 	return nil
 }
 
+// transferContents transfers the schema unless data-only, then the data unless
+// schema-only, restoring a full schema in sections around the data
+func (dtm *DataTransferManager) transferContents(ctx context.Context) error {
+	if dtm.sectioned() {
+		return dtm.transferSections(ctx)
+	}
+	if !dtm.config.DataOnly {
+		dtm.report.useEngine(EnginePgDump)
+		if err := dtm.report.time("schema", func() error { return dtm.transferSchema(ctx) }); err != nil {
+			return fmt.Errorf("failed to transfer schema: %w", err)
+		}
+	}
+	if dtm.config.SchemaOnly {
+		return nil
+	}
+	if err := dtm.sampleWhile(ctx, dtm.transferData); err != nil {
+		return err
+	}
+	if err := dtm.report.time("analyze", func() error { return dtm.analyze(ctx) }); err != nil {
+		dtm.logger.Warnf("Warning: %v", err)
+	}
+	return nil
+}
+
+// transferData loads the data, in chunked reads from a standby source or with
+// pg_dump followed by the tables copied with their own settings
+func (dtm *DataTransferManager) transferData(ctx context.Context) error {
+	if dtm.standbyChunk > 0 {
+		return dtm.report.time("data", func() error { return dtm.copyStandbyTables(ctx) })
+	}
+	dtm.report.useEngine(EnginePgDump)
+	if err := dtm.report.time("data", func() error { return dtm.transferDataOptimized(ctx) }); err != nil {
+		return fmt.Errorf("failed to transfer data: %w", err)
+	}
+	if len(dtm.separateTables()) > 0 {
+		if err := dtm.report.time("table_copies", func() error { return dtm.copyTables(ctx) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // optimizeDestination configures the destination database for maximum write performance
 func (dtm *DataTransferManager) optimizeDestination() error {
 	dtm.logger.Info("Optimizing destination database for bulk loading...")
@@ -152,40 +229,23 @@ func (dtm *DataTransferManager) restoreDestination() error {
 
 // transferSchema transfers the database schema using a pg_dump pipeline for reliability
 func (dtm *DataTransferManager) transferSchema(ctx context.Context) error {
+	if dtm.config.MinimalSchema {
+		return dtm.transferMinimalSchema(ctx)
+	}
+	if dtm.config.SchemaCache {
+		return dtm.transferCachedSchema(ctx)
+	}
 	dtm.logger.Info("Transferring database schema using pg_dump | pg_restore...")
 
 	reader, writer := io.Pipe()
 	defer dtm.closePipe(reader, "schema reader")
 	defer dtm.closePipe(writer, "schema writer")
 
-	// Configure pg_dump for schema only
-	dumpArgs := []string{
-		"--schema-only",
-		"--format=custom",
-		"--no-comments",
-		"--no-security-labels",
-		"--no-tablespaces",
-		"--no-owner",
-		"--no-privileges",
-		"-d", dtm.sourceCfg.ConnectionString(),
-	}
-
-	// Add table filtering if specified
-	if len(dtm.config.IncludeTables) > 0 {
-		// If include list is specified, only include those tables (ignore exclude list)
-		for _, table := range dtm.config.IncludeTables {
-			dumpArgs = append(dumpArgs, "--table="+table)
-		}
-	} else if len(dtm.config.ExcludeTables) > 0 {
-		// Only apply exclude list if no include list is specified
-		for _, table := range dtm.config.ExcludeTables {
-			dumpArgs = append(dumpArgs, "--exclude-table="+table)
-		}
-	}
-
-	dumpCmd := exec.CommandContext(ctx, "pg_dump", dumpArgs...)
+	dumpCmd := exec.CommandContext(ctx, "pg_dump", dtm.schemaDumpArgs()...)
 	dumpCmd.Stdout = writer
-	dumpCmd.Stderr = os.Stderr // Forward errors for visibility
+	dumpStderr := subprocessStderr(dtm.logger)
+	defer dumpStderr.Close()
+	dumpCmd.Stderr = dumpStderr
 
 	// Configure pg_restore
 	restoreCmd := exec.CommandContext(ctx, "pg_restore",
@@ -193,7 +253,9 @@ func (dtm *DataTransferManager) transferSchema(ctx context.Context) error {
 	)
 	restoreCmd.Stdin = reader
 	restoreCmd.Stdout = os.Stdout
-	restoreCmd.Stderr = os.Stderr
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = restoreStderr
 
 	// Set environment variables for authentication
 	dumpCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.sourceCfg.Password)
@@ -221,19 +283,121 @@ func (dtm *DataTransferManager) transferSchema(ctx context.Context) error {
 	if dumpErr != nil {
 		return fmt.Errorf("pg_dump (schema) failed: %w", dumpErr)
 	}
-	if restoreErr != nil {
-		// Check if this is just a warning about ignored errors (common with version mismatches)
-		if exitErr, ok := restoreErr.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			dtm.logger.Warnf("pg_restore completed with warnings (exit code 1), continuing...")
-		} else {
-			return fmt.Errorf("pg_restore (schema) failed: %w", restoreErr)
-		}
+	if err := dtm.checkRestore(restoreErr, "schema"); err != nil {
+		return err
 	}
 
 	dtm.logger.Info("Schema transfer completed successfully")
 	return nil
 }
 
+// checkRestore turns a pg_restore failure into an error. Exit code 1 means pg_restore
+// skipped statements that failed, which is common with version mismatches, so it is
+// only logged.
+func (dtm *DataTransferManager) checkRestore(err error, what string) error {
+	if err == nil {
+		return nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		dtm.logger.Warnf("pg_restore completed with warnings (exit code 1), continuing...")
+		return nil
+	}
+	return fmt.Errorf("pg_restore (%s) failed: %w", what, err)
+}
+
+// schemaDumpArgs returns the pg_dump arguments of a schema-only custom-format dump of
+// the source, with the configured table filters
+func (dtm *DataTransferManager) schemaDumpArgs() []string {
+	return append(dtm.schemaDumpOptions(), "-d", dtm.sourceCfg.ConnectionString())
+}
+
+// schemaDumpOptions returns the pg_dump options of the schema dump, without the
+// connection
+func (dtm *DataTransferManager) schemaDumpOptions() []string {
+	options := []string{
+		"--schema-only",
+		"--format=custom",
+		"--no-comments",
+		"--no-security-labels",
+		"--no-tablespaces",
+		"--no-owner",
+		"--no-privileges",
+	}
+	// Only superusers may create subscriptions on the services that restrict them
+	if dtm.provider.NoSubscriptions {
+		options = append(options, "--no-subscriptions")
+	}
+	return append(options, dtm.filterArgs()...)
+}
+
+// filterArgs returns the pg_dump arguments selecting the configured tables and
+// leaving out the internal schemas of detected extensions
+func (dtm *DataTransferManager) filterArgs() []string {
+	var args []string
+	switch {
+	case len(dtm.includeTables) > 0:
+		for _, table := range dtm.includeTables {
+			args = append(args, "--table="+exactTablePattern(table))
+		}
+	case len(dtm.excludeTables) > 0:
+		for _, table := range dtm.excludeTables {
+			args = append(args, "--exclude-table="+exactTablePattern(table))
+		}
+	case len(dtm.config.IncludeTables) > 0 && dtm.config.TablePatternMode != config.TablePatternRegex:
+		// If include list is specified, only include those tables (ignore exclude list)
+		for _, table := range dtm.config.IncludeTables {
+			args = append(args, "--table="+table)
+		}
+	case len(dtm.config.ExcludeTables) > 0 && dtm.config.TablePatternMode != config.TablePatternRegex:
+		// Only apply exclude list if no include list is specified
+		for _, table := range dtm.config.ExcludeTables {
+			args = append(args, "--exclude-table="+table)
+		}
+	}
+	for _, schema := range dtm.excludeSchemas {
+		args = append(args, "--exclude-schema="+schema)
+	}
+	return args
+}
+
+// resolveTables turns regex table filters into the exact tables they select on the
+// source; glob filters are passed to pg_dump, which matches them the same way
+func (dtm *DataTransferManager) resolveTables(ctx context.Context) error {
+	cfg := dtm.config
+	if cfg.TablePatternMode != config.TablePatternRegex || (len(cfg.IncludeTables) == 0 && len(cfg.ExcludeTables) == 0) {
+		return nil
+	}
+	plan := NewPlan(cfg)
+	if len(cfg.IncludeTables) > 0 {
+		selected, err := plan.ResolveTables(ctx, dtm.source)
+		dtm.includeTables = selected
+		return err
+	}
+
+	all, err := (&Plan{}).ResolveTables(ctx, dtm.source)
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool)
+	for _, table := range plan.FilterTables(all) {
+		kept[table] = true
+	}
+	for _, table := range all {
+		if !kept[table] {
+			dtm.excludeTables = append(dtm.excludeTables, table)
+		}
+	}
+	return nil
+}
+
+// exactTablePattern returns the pg_dump pattern matching only table, named as in the
+// fork's table lists
+func exactTablePattern(table string) string {
+	schema, name := config.SplitTableName(table)
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` }
+	return quote(schema) + "." + quote(name)
+}
+
 // transferDataOptimized transfers data using pg_dump and pg_restore for maximum performance
 func (dtm *DataTransferManager) transferDataOptimized(ctx context.Context) error {
 	dtm.logger.Info("Transferring database data using optimized pg_dump | pg_restore pipeline...")
@@ -243,10 +407,13 @@ func (dtm *DataTransferManager) transferDataOptimized(ctx context.Context) error
 	defer dtm.closePipe(reader, "data reader")
 	defer dtm.closePipe(writer, "data writer")
 
-	// Configure pg_dump command
+	// Configure pg_dump command. The dump only crosses a local pipe, so compressing it
+	// saves nothing, and uncompressed bytes track the table data sizes progress is
+	// measured against.
 	dumpArgs := []string{
 		"--data-only",
 		"--format=custom", // Use custom format for pg_restore
+		"--compress=0",
 		"--no-comments",
 		"--no-security-labels",
 		"--no-tablespaces",
@@ -254,32 +421,33 @@ func (dtm *DataTransferManager) transferDataOptimized(ctx context.Context) error
 		"--no-privileges",
 		"-d", dtm.sourceCfg.ConnectionString(),
 	}
-
-	// Add table filtering if specified
-	if len(dtm.config.IncludeTables) > 0 {
-		// If include list is specified, only include those tables (ignore exclude list)
-		for _, table := range dtm.config.IncludeTables {
-			dumpArgs = append(dumpArgs, "--table="+table)
-		}
-	} else if len(dtm.config.ExcludeTables) > 0 {
-		// Only apply exclude list if no include list is specified
-		for _, table := range dtm.config.ExcludeTables {
-			dumpArgs = append(dumpArgs, "--exclude-table="+table)
-		}
+	dumpArgs = append(dumpArgs, dtm.filterArgs()...)
+	// Tables with their own settings are copied afterwards, or not at all
+	for _, table := range dtm.separateTables() {
+		dumpArgs = append(dumpArgs, "--exclude-table-data="+table)
+	}
+	for _, view := range dtm.matviews {
+		dumpArgs = append(dumpArgs, "--exclude-table-data="+exactTablePattern(view))
 	}
 
 	dumpCmd := exec.CommandContext(ctx, "pg_dump", dumpArgs...)
-	dumpCmd.Stdout = writer
-	dumpCmd.Stderr = os.Stderr // Forward errors to stderr for visibility
+	dumpCmd.Stdout = &progressWriter{w: writer, metrics: dtm.metrics}
+	dumpStderr := subprocessStderr(dtm.logger)
+	defer dumpStderr.Close()
+	dumpCmd.Stderr = dumpStderr
 
 	// Configure pg_restore command
 	restoreCmd := exec.CommandContext(ctx, "pg_restore",
 		"--data-only",
 		"-d", dtm.destCfg.ConnectionString(),
 	)
+	// The errors are kept to tell which tables failed to load
+	var restoreErrors bytes.Buffer
 	restoreCmd.Stdin = reader
 	restoreCmd.Stdout = os.Stdout
-	restoreCmd.Stderr = os.Stderr
+	restoreStderr := subprocessStderr(dtm.logger)
+	defer restoreStderr.Close()
+	restoreCmd.Stderr = io.MultiWriter(restoreStderr, &restoreErrors)
 
 	// Set environment variables for authentication
 	dumpCmd.Env = append(os.Environ(), "PGPASSWORD="+dtm.sourceCfg.Password)
@@ -307,57 +475,99 @@ func (dtm *DataTransferManager) transferDataOptimized(ctx context.Context) error
 	if dumpErr != nil {
 		return fmt.Errorf("pg_dump failed: %w", dumpErr)
 	}
+	failures := copyFailures(restoreErrors.Bytes())
 	if restoreErr != nil {
 		// Check if this is just a warning about ignored errors (common with version mismatches)
-		if exitErr, ok := restoreErr.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			dtm.logger.Warnf("pg_restore completed with warnings (exit code 1), continuing...")
-		} else {
+		if exitErr, ok := restoreErr.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
 			return fmt.Errorf("pg_restore failed: %w", restoreErr)
 		}
+		if len(failures) == 0 {
+			dtm.logger.Warnf("pg_restore completed with warnings (exit code 1), continuing...")
+		}
+	}
+	for _, failure := range failures {
+		if err := dtm.bulkTableFailed(ctx, failure.table, failure.err); err != nil {
+			return err
+		}
 	}
 
 	dtm.logger.Info("Optimized data transfer completed successfully")
 	return nil
 }
 
-// closePipe is a helper to close an io.Closer and log any error
-func (dtm *DataTransferManager) closePipe(closer io.Closer, name string) {
-	if err := closer.Close(); err != nil {
-		dtm.logger.Warnf("Failed to close %s: %v", name, err)
-	}
+// copyFailedPattern matches pg_restore's report of a table whose COPY failed, and
+// tableDataEntryPattern the TOC entry it names before it, which holds the schema
+var (
+	copyFailedPattern     = regexp.MustCompile(`COPY failed for table "(.+?)": (.*)`)
+	tableDataEntryPattern = regexp.MustCompile(`from TOC entry \d+; \d+ \d+ TABLE DATA (\S+) (\S+)`)
+)
+
+// copyFailure is a table whose data pg_restore failed to load
+type copyFailure struct {
+	table string
+	err   error
 }
 
-// filterTables filters tables based on include/exclude configuration
-func (dtm *DataTransferManager) filterTables(tables []string) []string {
-	if len(dtm.config.IncludeTables) > 0 {
-		// If include list is specified, only include those tables (ignore exclude list)
-		var filtered []string
-		includeMap := make(map[string]bool)
-		for _, table := range dtm.config.IncludeTables {
-			includeMap[table] = true
+// copyFailures returns the tables whose COPY failed according to pg_restore's
+// errors, schema-qualified when it named their TOC entry
+func copyFailures(stderr []byte) []copyFailure {
+	var failures []copyFailure
+	var schema, name string
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := tableDataEntryPattern.FindStringSubmatch(line); m != nil {
+			schema, name = m[1], m[2]
+			continue
 		}
-		for _, table := range tables {
-			if includeMap[table] {
-				filtered = append(filtered, table)
-			}
+		m := copyFailedPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
 		}
-		return filtered
+		table := m[1]
+		if table == name {
+			table = schema + "." + name
+		}
+		failures = append(failures, copyFailure{table: table, err: fmt.Errorf("COPY failed: %s", strings.TrimSpace(m[2]))})
 	}
+	return failures
+}
 
-	if len(dtm.config.ExcludeTables) > 0 {
-		// Only apply exclude list if no include list is specified
-		excludeMap := make(map[string]bool)
-		for _, table := range dtm.config.ExcludeTables {
-			excludeMap[table] = true
-		}
-		var filtered []string
-		for _, table := range tables {
-			if !excludeMap[table] {
-				filtered = append(filtered, table)
-			}
+// bulkTableFailed applies on_table_error to a table whose COPY failed in the bulk
+// restore, which leaves the table empty: retry copies it again on its own, continue
+// reports it, and abort fails the transfer
+func (dtm *DataTransferManager) bulkTableFailed(ctx context.Context, table string, err error) error {
+	if dtm.config.OnTableError == "retry" && ctx.Err() == nil {
+		dtm.logger.Warnf("Failed to load table %s, copying it again on its own: %v", table, err)
+		dtm.report.tableRetried()
+		if err = dtm.copyTableWithPolicy(ctx, table, dtm.config.TableSettings(table), ""); err == nil {
+			return nil
 		}
-		return filtered
 	}
+	if err := dtm.tableFailed(ctx, table, err); err != nil {
+		return fmt.Errorf("failed to copy table %s: %w", table, err)
+	}
+	return nil
+}
+
+// progressWriter reports the bytes written through it as transferred
+type progressWriter struct {
+	w       io.Writer
+	metrics MetricsUpdater
+}
+
+// Write passes p on and reports what was written
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	if n > 0 && pw.metrics != nil {
+		pw.metrics.updateMetrics(int64(n), 0)
+	}
+	return n, err
+}
 
-	return tables
+// closePipe is a helper to close an io.Closer and log any error
+func (dtm *DataTransferManager) closePipe(closer io.Closer, name string) {
+	if err := closer.Close(); err != nil {
+		dtm.logger.Warnf("Failed to close %s: %v", name, err)
+	}
 }
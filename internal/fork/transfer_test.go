@@ -0,0 +1,107 @@
+package fork
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingMetrics records the bytes reported to it
+type countingMetrics struct {
+	bytes int64
+}
+
+func (m *countingMetrics) updateMetrics(bytesTransferred, rowsTransferred int64) {
+	m.bytes += bytesTransferred
+}
+
+func (m *countingMetrics) incrementTableCount() {}
+
+func (m *countingMetrics) recordTable(string, int64, int64, time.Duration) {}
+
+func TestProgressWriter(t *testing.T) {
+	var out bytes.Buffer
+	metrics := &countingMetrics{}
+	w := &progressWriter{w: &out, metrics: metrics}
+
+	_, err := w.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello world", out.String())
+	assert.Equal(t, int64(11), metrics.bytes)
+}
+
+// restoreCopyFailure is what pg_restore writes when the COPY of a table fails
+const restoreCopyFailure = `pg_restore: while PROCESSING TOC:
+pg_restore: from TOC entry 3371; 0 16403 TABLE DATA public orders postgres
+pg_restore: error: COPY failed for table "orders": ERROR:  duplicate key value violates unique constraint "orders_pkey"
+DETAIL:  Key (id)=(1) already exists.
+CONTEXT:  COPY orders, line 2
+pg_restore: warning: errors ignored on restore: 1
+`
+
+// fakeBulkRestore puts a pg_dump on PATH that dumps nothing and a pg_restore that
+// fails the COPY of public.orders, as a duplicate key would
+func fakeBulkRestore(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pg_dump and pg_restore are shell scripts")
+	}
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pg_dump"), []byte("#!/bin/sh\nexit 0\n"), 0o755))
+	restore := "#!/bin/sh\ncat > /dev/null\ncat >&2 <<'EOF'\n" + restoreCopyFailure + "EOF\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "pg_restore"), []byte(restore), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCopyFailures(t *testing.T) {
+	failures := copyFailures([]byte(restoreCopyFailure))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "public.orders", failures[0].table)
+	assert.EqualError(t, failures[0].err, `COPY failed: ERROR:  duplicate key value violates unique constraint "orders_pkey"`)
+
+	assert.Empty(t, copyFailures([]byte("pg_restore: warning: errors ignored on restore: 1\n")))
+}
+
+func TestTransferDataOptimized_OnTableError(t *testing.T) {
+	fakeBulkRestore(t)
+
+	// abort fails the transfer
+	cfg := &config.ForkConfig{OnTableError: "abort"}
+	dtm, _, _ := newExtensionsTransfer(t, cfg)
+	err := dtm.transferDataOptimized(context.Background())
+	assert.ErrorContains(t, err, "failed to copy table public.orders")
+
+	// continue reports the table
+	cfg = &config.ForkConfig{OnTableError: "continue"}
+	dtm, _, _ = newExtensionsTransfer(t, cfg)
+	report := newReport(NewPlan(cfg))
+	dtm.SetReport(report)
+	require.NoError(t, dtm.transferDataOptimized(context.Background()))
+	require.Len(t, report.FailedTables, 1)
+	assert.Equal(t, "public.orders", report.FailedTables[0].Table)
+
+	// retry copies the table again on its own
+	cfg = &config.ForkConfig{OnTableError: "retry"}
+	dtm, source, _ := newExtensionsTransfer(t, cfg)
+	report = newReport(NewPlan(cfg))
+	dtm.SetReport(report)
+	source.ExpectQuery("FROM pg_attribute").WillReturnRows(sqlmock.NewRows([]string{"attname"}).AddRow("id"))
+	source.ExpectQuery("SELECT pg_relation_size").WillReturnRows(sqlmock.NewRows([]string{"pages"}).AddRow(0))
+	source.ExpectQuery(`FROM "public"."orders"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	require.NoError(t, dtm.transferDataOptimized(context.Background()))
+	assert.Empty(t, report.FailedTables)
+	assert.Equal(t, 1, report.TableRetries)
+	assert.NoError(t, source.ExpectationsWereMet())
+}
@@ -0,0 +1,196 @@
+package fork
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// rowSource is what copyRows reads rows from: a query's rows, or the output of a
+// transform program
+type rowSource interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// transformedRows are the rows a transform program writes, as COPY text, for the rows
+// of a query fed to it
+type transformedRows struct {
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	out     *bufio.Reader
+	columns int
+	fields  []string
+	// fed receives the result of writing the query's rows to the program
+	fed  chan error
+	done bool
+	err  error
+}
+
+// startTransform starts program and feeds it the rows of query, which it must not be
+// closed before the transformed rows are. The program learns the table and its
+// columns from PGFORK_TABLE and PGFORK_COLUMNS.
+func startTransform(ctx context.Context, program []string, query *sql.Rows, table string, columns []string) (*transformedRows, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, program[0], program[1:]...)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PGFORK_TABLE="+table, "PGFORK_COLUMNS="+strings.Join(columns, ","))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start transform: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start transform: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start transform %s: %w", program[0], err)
+	}
+
+	t := &transformedRows{cmd: cmd, cancel: cancel, out: bufio.NewReader(stdout), columns: len(columns), fed: make(chan error, 1)}
+	go func() {
+		w := bufio.NewWriter(stdin)
+		err := writeCopyText(w, query, len(columns))
+		if err == nil {
+			err = w.Flush()
+		}
+		if closeErr := stdin.Close(); err == nil {
+			err = closeErr
+		}
+		// A program may stop reading once it has written all it wants to load
+		if errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) {
+			err = nil
+		}
+		t.fed <- err
+	}()
+	return t, nil
+}
+
+// writeCopyText writes rows in COPY's text format
+func writeCopyText(w io.Writer, rows *sql.Rows, columns int) error {
+	values := make([]sql.NullString, columns)
+	dest := make([]interface{}, columns)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	fields := make([]string, columns)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, value := range values {
+			fields[i] = `\N`
+			if value.Valid {
+				fields[i] = copyTextEscaper.Replace(value.String)
+			}
+		}
+		if _, err := io.WriteString(w, strings.Join(fields, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// copyTextEscaper escapes a value for COPY's text format
+var copyTextEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// copyTextEscapes are the backslash sequences of COPY's text format; any other
+// backslashed character stands for itself
+var copyTextEscapes = map[byte]byte{'t': '\t', 'n': '\n', 'r': '\r', 'b': '\b', 'f': '\f', 'v': '\v'}
+
+// unescapeCopyText reads a value written in COPY's text format
+func unescapeCopyText(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c == '\\' && i+1 < len(field) {
+			i++
+			c = field[i]
+			if escaped, ok := copyTextEscapes[c]; ok {
+				c = escaped
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// Next reads the next row the program wrote
+func (t *transformedRows) Next() bool {
+	if t.done || t.err != nil {
+		return false
+	}
+	line, err := t.out.ReadString('\n')
+	if err == io.EOF && line == "" || strings.TrimRight(line, "\r\n") == `\.` {
+		t.done = true
+		t.err = t.wait()
+		return false
+	}
+	if err != nil && err != io.EOF {
+		t.err = fmt.Errorf("failed to read transform output: %w", err)
+		return false
+	}
+	t.fields = strings.Split(strings.TrimRight(line, "\r\n"), "\t")
+	if len(t.fields) != t.columns {
+		t.err = fmt.Errorf("transform wrote a row of %d columns, expected %d", len(t.fields), t.columns)
+		return false
+	}
+	return true
+}
+
+// Scan copies the fields of the current row into dest, which are *sql.NullString
+func (t *transformedRows) Scan(dest ...interface{}) error {
+	for i, field := range t.fields {
+		value, ok := dest[i].(*sql.NullString)
+		if !ok {
+			return fmt.Errorf("transformed rows scan into *sql.NullString, not %T", dest[i])
+		}
+		*value = sql.NullString{}
+		if field != `\N` {
+			*value = sql.NullString{String: unescapeCopyText(field), Valid: true}
+		}
+	}
+	return nil
+}
+
+// Err returns the error that ended the rows, including a failed program
+func (t *transformedRows) Err() error {
+	return t.err
+}
+
+// wait waits for the program to exit once its output is read
+func (t *transformedRows) wait() error {
+	fedErr := <-t.fed
+	if err := t.cmd.Wait(); err != nil {
+		return fmt.Errorf("transform %s failed: %w", t.cmd.Path, err)
+	}
+	if fedErr != nil {
+		return fmt.Errorf("failed to feed rows to transform: %w", fedErr)
+	}
+	return nil
+}
+
+// Close stops a program whose output was not read to the end
+func (t *transformedRows) Close() {
+	if !t.done {
+		t.done = true
+		t.cancel()
+		<-t.fed
+		_ = t.cmd.Wait()
+	}
+	t.cancel()
+}
@@ -0,0 +1,70 @@
+package fork
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryMockRows returns the rows of a mocked query
+func queryMockRows(t *testing.T, rows *sqlmock.Rows) *sql.Rows {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mockDB.Close() })
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	queried, err := mockDB.Query("SELECT id, email FROM users")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = queried.Close() })
+	return queried
+}
+
+func TestStartTransform(t *testing.T) {
+	queried := queryMockRows(t, sqlmock.NewRows([]string{"id", "email"}).
+		AddRow("1", "alice@example.com").
+		AddRow("2", nil).
+		AddRow("3", "tab\there\nnewline"))
+
+	rows, err := startTransform(context.Background(), []string{"sed", "s/[a-z]*@example.com/user@example.invalid/"}, queried, "public.users", []string{"id", "email"})
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var got [][]sql.NullString
+	values := make([]sql.NullString, 2)
+	for rows.Next() {
+		require.NoError(t, rows.Scan(&values[0], &values[1]))
+		got = append(got, append([]sql.NullString(nil), values...))
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, [][]sql.NullString{
+		{{String: "1", Valid: true}, {String: "user@example.invalid", Valid: true}},
+		{{String: "2", Valid: true}, {}},
+		{{String: "3", Valid: true}, {String: "tab\there\nnewline", Valid: true}},
+	}, got)
+}
+
+func TestStartTransform_Failures(t *testing.T) {
+	queried := queryMockRows(t, sqlmock.NewRows([]string{"id", "email"}).AddRow("1", "alice@example.com"))
+	rows, err := startTransform(context.Background(), []string{"false"}, queried, "public.users", []string{"id", "email"})
+	require.NoError(t, err)
+	assert.False(t, rows.Next())
+	assert.ErrorContains(t, rows.Err(), "transform")
+	rows.Close()
+
+	queried = queryMockRows(t, sqlmock.NewRows([]string{"id", "email"}).AddRow("1", "alice@example.com"))
+	rows, err = startTransform(context.Background(), []string{"cut", "-f1"}, queried, "public.users", []string{"id", "email"})
+	require.NoError(t, err)
+	assert.False(t, rows.Next())
+	assert.ErrorContains(t, rows.Err(), "transform wrote a row of 1 columns, expected 2")
+	rows.Close()
+}
+
+func TestUnescapeCopyText(t *testing.T) {
+	for _, value := range []string{"plain", `back\slash`, "tab\tnew\nline\rreturn", ""} {
+		assert.Equal(t, value, unescapeCopyText(copyTextEscaper.Replace(value)))
+	}
+	assert.Equal(t, "a\vb.", unescapeCopyText(`a\vb\.`))
+}
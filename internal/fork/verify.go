@@ -0,0 +1,349 @@
+package fork
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/masking"
+	"github.com/lib/pq"
+)
+
+// sampleLockTimeout bounds how long sampling waits for a target table the restore
+// holds locked, such as while it adds constraints; the table is sampled next round
+const sampleLockTimeout = "1s"
+
+// SampleMismatchError reports a copied row that differs from its source row
+type SampleMismatchError struct {
+	Table  string
+	Key    string
+	Column string
+}
+
+// Error implements the error interface
+func (e *SampleMismatchError) Error() string {
+	return fmt.Sprintf("sampled row (%s) of %s differs from the source in column %s", e.Key, e.Table, e.Column)
+}
+
+// rowSampler compares random samples of the rows already copied to the target with
+// the source while the data loads, so a copy that corrupts or mistransforms rows
+// fails early instead of after hours of loading
+type rowSampler struct {
+	dtm  *DataTransferManager
+	rows int
+	// horizon is the source's next transaction ID when the transfer started; rows
+	// written after it may have changed since they were copied and are not compared
+	horizon int64
+	tables  []sampledTable
+	// compared counts the rows compared so far
+	compared atomic.Int64
+}
+
+// sampledTable is a source table with a primary key to look sampled rows up by
+type sampledTable struct {
+	name    string
+	quoted  string
+	columns []string
+	key     []string
+	// percent is the share of pages a sample reads, sized from the source row count
+	percent float64
+	masking string
+}
+
+// sampleWhile runs transfer while comparing samples of the copied rows with the
+// source every verify_interval, then once more over the finished copy. A mismatch
+// cancels the transfer and is returned in place of its error.
+func (dtm *DataTransferManager) sampleWhile(ctx context.Context, transfer func(context.Context) error) error {
+	if dtm.config.VerifySample <= 0 {
+		return transfer(ctx)
+	}
+	sampler, err := dtm.newRowSampler(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to prepare verification sampling: %w", err)
+	}
+	defer func() { dtm.report.sampledRows(sampler.compared.Load()) }()
+	dtm.logger.Infof("Verifying %d sampled rows of %d tables every %s while copying",
+		sampler.rows, len(sampler.tables), dtm.config.VerifyInterval)
+
+	transferCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	mismatch := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(dtm.config.VerifyInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-transferCtx.Done():
+				return
+			case <-ticker.C:
+				if err := sampler.round(transferCtx); err != nil {
+					if transferCtx.Err() == nil {
+						mismatch <- err
+						cancel()
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	err = transfer(transferCtx)
+	cancel()
+	<-done
+	select {
+	case m := <-mismatch:
+		return m
+	default:
+	}
+	if err != nil {
+		return err
+	}
+
+	// The last round covers the rows copied since the previous one
+	if err := dtm.report.time("verify_sample", func() error { return sampler.round(ctx) }); err != nil {
+		return err
+	}
+	dtm.logger.Infof("Verified %d sampled rows against the source", sampler.compared.Load())
+	return nil
+}
+
+// newRowSampler records the source's transaction horizon and the tables to sample:
+// those with a primary key whose rows are copied
+func (dtm *DataTransferManager) newRowSampler(ctx context.Context) (*rowSampler, error) {
+	s := &rowSampler{dtm: dtm, rows: dtm.config.VerifySample}
+	if err := dtm.source.DB.QueryRowContext(ctx,
+		"SELECT txid_snapshot_xmax(txid_current_snapshot())").Scan(&s.horizon); err != nil {
+		return nil, fmt.Errorf("failed to read the source transaction horizon: %w", err)
+	}
+
+	keys, err := dtm.source.PrimaryKeysContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := NewPlan(dtm.config)
+	for _, k := range keys {
+		name := k.Schema + "." + k.Table
+		if k.Index == "" || dtm.excludesSchema(k.Schema) || !plan.copiesRows(k) || dtm.config.TableSettings(name).SchemaOnly {
+			continue
+		}
+		table, err := dtm.newSampledTable(ctx, k, s.rows)
+		if err != nil {
+			return nil, err
+		}
+		s.tables = append(s.tables, table)
+	}
+	return s, nil
+}
+
+// copiesRows reports whether the table filters leave a table in
+func (p *Plan) copiesRows(k db.PrimaryKey) bool {
+	name := k.Schema + "." + k.Table
+	if k.Schema == "public" {
+		name = k.Table
+	}
+	return len(p.FilterTables([]string{name})) > 0
+}
+
+// excludesSchema reports whether a schema is left out of the dumps
+func (dtm *DataTransferManager) excludesSchema(schema string) bool {
+	for _, excluded := range dtm.excludeSchemas {
+		if excluded == schema {
+			return true
+		}
+	}
+	return false
+}
+
+// newSampledTable reads the columns and key of a table, and how much of it a sample
+// of rows reads
+func (dtm *DataTransferManager) newSampledTable(ctx context.Context, k db.PrimaryKey, rows int) (sampledTable, error) {
+	name := k.Schema + "." + k.Table
+	table := sampledTable{name: name, quoted: k.QualifiedName()}
+	var err error
+	if table.columns, err = copyColumns(ctx, dtm.source.DB, k.Schema, k.Table); err != nil {
+		return table, fmt.Errorf("failed to read columns of %s: %w", name, err)
+	}
+	if table.key, err = dtm.source.PrimaryKeyColumnsContext(ctx, k); err != nil {
+		return table, err
+	}
+	if table.masking, err = masking.SelectList(name, table.columns, dtm.config.TableSettings(name).Masking); err != nil {
+		return table, err
+	}
+
+	var tuples float64
+	if err := dtm.source.DB.QueryRowContext(ctx,
+		"SELECT reltuples FROM pg_class WHERE oid = $1::regclass", table.quoted).Scan(&tuples); err != nil {
+		return table, fmt.Errorf("failed to read row count of %s: %w", name, err)
+	}
+	table.percent = samplePercent(rows, tuples)
+	return table, nil
+}
+
+// samplePercent is the share of a table's pages to read for a sample of rows, read
+// ten times over so sparse pages still fill it. Tables of unknown size are read whole.
+func samplePercent(rows int, tuples float64) float64 {
+	if tuples <= 0 {
+		return 100
+	}
+	return math.Min(100, math.Ceil(float64(rows)*10*100/tuples*1000)/1000)
+}
+
+// round compares a sample of every table, returning the first mismatch. Tables
+// that cannot be sampled right now, such as ones the restore has not created yet,
+// are left for the next round.
+func (s *rowSampler) round(ctx context.Context) error {
+	for _, table := range s.tables {
+		compared, err := s.compare(ctx, table)
+		s.compared.Add(int64(compared))
+		if err == nil {
+			continue
+		}
+		var mismatch *SampleMismatchError
+		if errors.As(err, &mismatch) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.dtm.logger.Debugf("Skipped sampling %s this round: %v", table.name, err)
+	}
+	return nil
+}
+
+// sampledRow is a row read from the target, with its key as SQL literals
+type sampledRow struct {
+	key    string
+	values []sql.NullString
+}
+
+// compare checks a sample of the table's target rows against the source, returning
+// how many rows it compared. Rows deleted or written on the source since the
+// transfer started are not compared.
+func (s *rowSampler) compare(ctx context.Context, table sampledTable) (int, error) {
+	sample, err := s.targetSample(ctx, table)
+	if err != nil || len(sample) == 0 {
+		return 0, err
+	}
+
+	tuples := make([]string, len(sample))
+	for i, row := range sample {
+		tuples[i] = "(" + row.key + ")"
+	}
+	query := fmt.Sprintf("SELECT %s, txid_snapshot_xmax(txid_current_snapshot()) - age(t.xmin) >= $1, %s FROM %s t WHERE (%s) IN (%s)",
+		keyLiterals(table.key), table.masking, table.quoted, qualifiedColumns(table.key), strings.Join(tuples, ", "))
+	rows, err := s.dtm.source.DB.QueryContext(ctx, query, s.horizon)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read source rows: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	source := make(map[string][]sql.NullString, len(sample))
+	for rows.Next() {
+		var key string
+		var changed bool
+		values := make([]sql.NullString, len(table.columns))
+		dest := []interface{}{&key, &changed}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return 0, err
+		}
+		if !changed {
+			source[key] = values
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	compared := 0
+	for _, row := range sample {
+		values, ok := source[row.key]
+		if !ok {
+			continue
+		}
+		if column := differingColumn(table.columns, values, row.values); column != "" {
+			return compared, &SampleMismatchError{Table: table.name, Key: row.key, Column: column}
+		}
+		compared++
+	}
+	return compared, nil
+}
+
+// targetSample reads random rows of the table from the target. It gives up on a
+// table the restore holds locked rather than holding up the restore behind it.
+func (s *rowSampler) targetSample(ctx context.Context, table sampledTable) ([]sampledRow, error) {
+	tx, err := s.dtm.dest.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, "SET LOCAL lock_timeout = '"+sampleLockTimeout+"'"); err != nil {
+		return nil, err
+	}
+
+	selectList, err := masking.SelectList(table.name, table.columns, nil)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s, %s FROM %s t TABLESAMPLE SYSTEM (%g) ORDER BY random() LIMIT %d",
+		keyLiterals(table.key), selectList, table.quoted, table.percent, s.rows)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample target rows: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sample []sampledRow
+	for rows.Next() {
+		row := sampledRow{values: make([]sql.NullString, len(table.columns))}
+		dest := []interface{}{&row.key}
+		for i := range row.values {
+			dest = append(dest, &row.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		sample = append(sample, row)
+	}
+	return sample, rows.Err()
+}
+
+// keyLiterals is the expression writing a row's key columns as comma-separated SQL
+// literals, which compare against the columns whatever their types
+func keyLiterals(key []string) string {
+	literals := make([]string, len(key))
+	for i, column := range key {
+		literals[i] = "quote_literal(t." + pq.QuoteIdentifier(column) + ")"
+	}
+	return "concat_ws(', ', " + strings.Join(literals, ", ") + ")"
+}
+
+// qualifiedColumns lists columns of the table aliased t
+func qualifiedColumns(columns []string) string {
+	qualified := make([]string, len(columns))
+	for i, column := range columns {
+		qualified[i] = "t." + pq.QuoteIdentifier(column)
+	}
+	return strings.Join(qualified, ", ")
+}
+
+// differingColumn returns the first column whose values differ, or "" when the rows
+// are the same
+func differingColumn(columns []string, a, b []sql.NullString) string {
+	for i, column := range columns {
+		if a[i] != b[i] {
+			return column
+		}
+	}
+	return ""
+}
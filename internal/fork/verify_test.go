@@ -0,0 +1,126 @@
+package fork
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplePercent(t *testing.T) {
+	assert.Equal(t, 100.0, samplePercent(100, 0))
+	assert.Equal(t, 100.0, samplePercent(100, 500))
+	assert.Equal(t, 1.0, samplePercent(100, 100000))
+	assert.Equal(t, 0.001, samplePercent(1, 1e9))
+}
+
+func TestKeyLiterals(t *testing.T) {
+	assert.Equal(t, `concat_ws(', ', quote_literal(t."tenant"), quote_literal(t."id"))`, keyLiterals([]string{"tenant", "id"}))
+	assert.Equal(t, `t."tenant", t."id"`, qualifiedColumns([]string{"tenant", "id"}))
+}
+
+func TestPlan_CopiesRows(t *testing.T) {
+	users := db.PrimaryKey{Schema: "public", Table: "users"}
+	audit := db.PrimaryKey{Schema: "audit", Table: "events"}
+
+	plan := NewPlan(&config.ForkConfig{IncludeTables: []string{"users"}})
+	assert.True(t, plan.copiesRows(users))
+	assert.False(t, plan.copiesRows(audit))
+
+	plan = NewPlan(&config.ForkConfig{ExcludeTables: []string{"audit.events"}})
+	assert.True(t, plan.copiesRows(users))
+	assert.False(t, plan.copiesRows(audit))
+}
+
+// newSampler returns a sampler of the users table with mocked connections
+func newSampler(t *testing.T) (*rowSampler, sampledTable, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	dtm, source, dest := newExtensionsTransfer(t, &config.ForkConfig{VerifySample: 2})
+	sampler := &rowSampler{dtm: dtm, rows: 2, horizon: 1000}
+	table := sampledTable{
+		name:    "public.users",
+		quoted:  `"public"."users"`,
+		columns: []string{"id", "email"},
+		key:     []string{"id"},
+		percent: 100,
+		masking: `"id"::text, "email"::text`,
+	}
+	sampler.tables = []sampledTable{table}
+	return sampler, table, source, dest
+}
+
+// expectTargetSample expects the target rows of a sample
+func expectTargetSample(dest sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	dest.ExpectBegin()
+	dest.ExpectExec("SET LOCAL lock_timeout = '1s'").WillReturnResult(sqlmock.NewResult(0, 0))
+	dest.ExpectQuery(`FROM "public"."users" t TABLESAMPLE SYSTEM \(100\) ORDER BY random\(\) LIMIT 2`).WillReturnRows(rows)
+	dest.ExpectRollback()
+}
+
+func TestRowSampler_Compare(t *testing.T) {
+	sampler, table, source, dest := newSampler(t)
+
+	expectTargetSample(dest, sqlmock.NewRows([]string{"key", "id", "email"}).
+		AddRow("'1'", "1", "a@example.com").
+		AddRow("'2'", "2", "b@example.com"))
+	// Row 2 was written on the source after the transfer started
+	source.ExpectQuery(`WHERE \(t."id"\) IN \(\('1'\), \('2'\)\)`).WithArgs(int64(1000)).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "changed", "id", "email"}).
+			AddRow("'1'", false, "1", "a@example.com").
+			AddRow("'2'", true, "2", "new@example.com"))
+
+	compared, err := sampler.compare(context.Background(), table)
+	require.NoError(t, err)
+	assert.Equal(t, 1, compared)
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, dest.ExpectationsWereMet())
+}
+
+func TestRowSampler_Mismatch(t *testing.T) {
+	sampler, _, source, dest := newSampler(t)
+
+	expectTargetSample(dest, sqlmock.NewRows([]string{"key", "id", "email"}).
+		AddRow("'1'", "1", nil))
+	source.ExpectQuery(`WHERE \(t."id"\) IN \(\('1'\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "changed", "id", "email"}).
+			AddRow("'1'", false, "1", "a@example.com"))
+
+	err := sampler.round(context.Background())
+	var mismatch *SampleMismatchError
+	require.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, &SampleMismatchError{Table: "public.users", Key: "'1'", Column: "email"}, mismatch)
+	assert.EqualError(t, err, "sampled row ('1') of public.users differs from the source in column email")
+
+	errorType, severity, retryable, _ := NewErrorHandler(DefaultRetryConfig(), "transfer").classifyError(err)
+	assert.Equal(t, ErrorTypeDataIntegrity, errorType)
+	assert.Equal(t, SeverityFatal, severity)
+	assert.False(t, retryable)
+}
+
+func TestRowSampler_SkipsUnavailableTables(t *testing.T) {
+	sampler, _, _, dest := newSampler(t)
+
+	dest.ExpectBegin()
+	dest.ExpectExec("SET LOCAL lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	dest.ExpectQuery("TABLESAMPLE").WillReturnError(errors.New(`relation "public.users" does not exist`))
+	dest.ExpectRollback()
+
+	assert.NoError(t, sampler.round(context.Background()))
+	assert.Zero(t, sampler.compared.Load())
+}
+
+func TestSampleWhile_Disabled(t *testing.T) {
+	dtm, source, dest := newExtensionsTransfer(t, &config.ForkConfig{})
+	called := false
+	require.NoError(t, dtm.sampleWhile(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	}))
+	assert.True(t, called)
+	assert.NoError(t, source.ExpectationsWereMet())
+	assert.NoError(t, dest.ExpectationsWereMet())
+}
@@ -0,0 +1,65 @@
+package fork
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/output"
+)
+
+// workDirBase returns the directory spooled files and the metrics file go to
+func workDirBase(dir string) string {
+	if dir == "" {
+		return os.TempDir()
+	}
+	return dir
+}
+
+// createWorkDir creates a directory for one fork's spooled files in base, after
+// checking base has at least minFreeMB MiB free, so a full disk fails the fork
+// before pg_dump starts writing rather than part way through
+func createWorkDir(base string, minFreeMB int) (string, error) {
+	if err := os.MkdirAll(base, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create work directory %s: %w", base, err)
+	}
+	free, err := freeSpace(base)
+	if err != nil {
+		return "", fmt.Errorf("failed to check free space in work directory %s: %w", base, err)
+	}
+	if need := int64(minFreeMB) * 1024 * 1024; free < need {
+		return "", fmt.Errorf("work directory %s has %s free, less than the %s required; "+
+			"free up space, point --work-dir at a larger disk or lower --work-dir-min-free-mb",
+			base, output.FormatBytes(free), output.FormatBytes(need))
+	}
+	dir, err := os.MkdirTemp(base, "pgfork-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create work directory in %s: %w", base, err)
+	}
+	return dir, nil
+}
+
+// prepareWorkDir creates the fork's work directory when the plan spools files, and
+// returns a function removing it again
+func (f *Forker) prepareWorkDir(plan *Plan) (func(), error) {
+	if !plan.Spools() {
+		return func() {}, nil
+	}
+	dir, err := createWorkDir(workDirBase(f.config.WorkDir), f.config.WorkDirMinFreeMB)
+	if err != nil {
+		return nil, err
+	}
+	f.workDir = dir
+	f.logger.Debugf("Spooling files to %s", dir)
+	return func() {
+		if err := os.RemoveAll(dir); err != nil {
+			f.logger.Warnf("Failed to remove work directory %s: %v", dir, err)
+		}
+		f.workDir = ""
+	}, nil
+}
+
+// metricsPath returns where the metrics of a fork are saved
+func metricsPath(workDir string) string {
+	return filepath.Join(workDirBase(workDir), "postgres-fork-metrics.txt")
+}
@@ -0,0 +1,35 @@
+package fork
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWorkDir(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "spool")
+	dir, err := createWorkDir(base, 0)
+	require.NoError(t, err)
+	assert.Equal(t, base, filepath.Dir(dir))
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	_, err = createWorkDir(base, 1<<30)
+	assert.ErrorContains(t, err, "less than the 1.0 PB required")
+}
+
+func TestPlan_Spools(t *testing.T) {
+	cfg := planConfig()
+	cfg.WorkDir = "/mnt/scratch"
+	assert.False(t, NewPlan(cfg).Spools())
+
+	cfg.SchemaOnly = true
+	cfg.MinimalSchema = true
+	plan := NewPlan(cfg)
+	assert.True(t, plan.Spools())
+	assert.Contains(t, plan.Describe(), "Spooling the schema dump to /mnt/scratch")
+}
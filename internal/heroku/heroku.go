@@ -0,0 +1,171 @@
+package heroku
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// Scheme starts the references to Heroku config vars accepted as connection URIs
+	Scheme = "heroku"
+	// DefaultConfigVar holds the URL of an app's primary database
+	DefaultConfigVar = "DATABASE_URL"
+
+	// maxResponseSize bounds the config vars response
+	maxResponseSize = 1 << 20
+	// resolveTimeout bounds reading a config var, which the CLI may take a while over
+	resolveTimeout = 30 * time.Second
+)
+
+// Reference names the config var of a Heroku app that holds a database URL, written
+// heroku:<app>::<config var>. Without a config var it is DATABASE_URL.
+type Reference struct {
+	App       string
+	ConfigVar string
+}
+
+// ParseReference parses a heroku:<app>[::<config var>] reference
+func ParseReference(ref string) (Reference, error) {
+	rest, ok := strings.CutPrefix(ref, Scheme+":")
+	if !ok {
+		return Reference{}, fmt.Errorf("not a Heroku reference: %s", ref)
+	}
+	app, configVar, _ := strings.Cut(rest, "::")
+	if configVar == "" {
+		configVar = DefaultConfigVar
+	}
+	if app == "" || strings.ContainsAny(app, ":/") {
+		return Reference{}, fmt.Errorf("invalid Heroku reference %q (expected heroku:<app>::<config var>)", ref)
+	}
+	return Reference{App: app, ConfigVar: configVar}, nil
+}
+
+// String returns the reference as written
+func (r Reference) String() string {
+	return Scheme + ":" + r.App + "::" + r.ConfigVar
+}
+
+// Client reads the config vars of Heroku apps, through the Platform API when it has
+// an API key and through the heroku CLI, which has its own login, otherwise
+type Client struct {
+	APIURL     string
+	APIKey     string
+	HTTPClient *http.Client
+	// CLI runs the heroku CLI with args and returns its output
+	CLI func(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// FromEnvironment returns a client using HEROKU_API_KEY when it is set
+func FromEnvironment() *Client {
+	return &Client{
+		APIURL:     "https://api.heroku.com",
+		APIKey:     os.Getenv("HEROKU_API_KEY"),
+		HTTPClient: http.DefaultClient,
+		CLI:        runCLI,
+	}
+}
+
+// ResolveURI returns the database URL of a heroku:<app>::<config var> reference, as
+// a connection URI resolver
+func (c *Client) ResolveURI(ref string) (string, error) {
+	reference, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return c.DatabaseURL(ctx, reference)
+}
+
+// DatabaseURL returns the database URL held by the referenced config var. Heroku
+// Postgres only accepts encrypted connections, so a URL without an sslmode gets
+// sslmode=require.
+func (c *Client) DatabaseURL(ctx context.Context, ref Reference) (string, error) {
+	var value string
+	var err error
+	if c.APIKey != "" {
+		value, err = c.apiConfigVar(ctx, ref)
+	} else {
+		value, err = c.cliConfigVar(ctx, ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("app %s has no Heroku config var %s", ref.App, ref.ConfigVar)
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", fmt.Errorf("config var %s of Heroku app %s is not a PostgreSQL URL", ref.ConfigVar, ref.App)
+	}
+	query := u.Query()
+	if query.Get("sslmode") == "" {
+		query.Set("sslmode", "require")
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// apiConfigVar reads a config var through the Platform API
+func (c *Client) apiConfigVar(ctx context.Context, ref Reference) (string, error) {
+	target := fmt.Sprintf("%s/apps/%s/config-vars", strings.TrimRight(c.APIURL, "/"), url.PathEscape(ref.App))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("User-Agent", "postgres-db-fork")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config vars of Heroku app %s: %w", ref.App, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read config vars of Heroku app %s: %w", ref.App, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("failed to read config vars of Heroku app %s: %s", ref.App, resp.Status)
+	}
+	var vars map[string]string
+	if err := json.Unmarshal(data, &vars); err != nil {
+		return "", fmt.Errorf("failed to parse config vars of Heroku app %s: %w", ref.App, err)
+	}
+	return vars[ref.ConfigVar], nil
+}
+
+// cliConfigVar reads a config var with heroku config:get
+func (c *Client) cliConfigVar(ctx context.Context, ref Reference) (string, error) {
+	cli := c.CLI
+	if cli == nil {
+		cli = runCLI
+	}
+	out, err := cli(ctx, "config:get", ref.ConfigVar, "--app", ref.App)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config var %s of Heroku app %s (set HEROKU_API_KEY or log in with heroku login): %w", ref.ConfigVar, ref.App, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// runCLI runs the heroku CLI, returning its standard output
+func runCLI(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "heroku", args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
@@ -0,0 +1,67 @@
+package heroku
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("heroku:myapp::HEROKU_POSTGRESQL_RED_URL")
+	require.NoError(t, err)
+	assert.Equal(t, Reference{App: "myapp", ConfigVar: "HEROKU_POSTGRESQL_RED_URL"}, ref)
+
+	ref, err = ParseReference("heroku:myapp")
+	require.NoError(t, err)
+	assert.Equal(t, "heroku:myapp::DATABASE_URL", ref.String())
+
+	for _, invalid := range []string{"heroku:", "heroku:::DATABASE_URL", "heroku://myapp", "postgres://host/db"} {
+		_, err := ParseReference(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClient_DatabaseURL_API(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apps/myapp/config-vars", r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/vnd.heroku+json; version=3", r.Header.Get("Accept"))
+		_, _ = w.Write([]byte(`{"DATABASE_URL": "postgres://u:p@ec2-1-2-3-4.compute-1.amazonaws.com:5432/d8abc", "RAILS_ENV": "production"}`))
+	}))
+	defer server.Close()
+
+	client := &Client{APIURL: server.URL, APIKey: "key", HTTPClient: server.Client()}
+	url, err := client.DatabaseURL(context.Background(), Reference{App: "myapp", ConfigVar: DefaultConfigVar})
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://u:p@ec2-1-2-3-4.compute-1.amazonaws.com:5432/d8abc?sslmode=require", url)
+
+	_, err = client.DatabaseURL(context.Background(), Reference{App: "myapp", ConfigVar: "RAILS_ENV"})
+	assert.ErrorContains(t, err, "not a PostgreSQL URL")
+
+	_, err = client.DatabaseURL(context.Background(), Reference{App: "myapp", ConfigVar: "MISSING_URL"})
+	assert.ErrorContains(t, err, "app myapp has no Heroku config var MISSING_URL")
+}
+
+func TestClient_DatabaseURL_CLI(t *testing.T) {
+	var args []string
+	client := &Client{CLI: func(ctx context.Context, a ...string) ([]byte, error) {
+		args = a
+		return []byte("postgres://u:p@host:5432/db?sslmode=verify-full\n"), nil
+	}}
+
+	url, err := client.ResolveURI("heroku:myapp::DATABASE_URL")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://u:p@host:5432/db?sslmode=verify-full", url)
+	assert.Equal(t, []string{"config:get", "DATABASE_URL", "--app", "myapp"}, args)
+
+	client.CLI = func(ctx context.Context, a ...string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}
+	_, err = client.ResolveURI("heroku:myapp")
+	assert.ErrorContains(t, err, "heroku login")
+}
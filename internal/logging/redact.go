@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Privacy modes of a Redactor
+const (
+	PrivacyNone  = "none"
+	PrivacyHash  = "hash"
+	PrivacyAlias = "alias"
+)
+
+// Identifier is a sensitive name, such as a database or host name, with the kind
+// and alias that replace it
+type Identifier struct {
+	Name string
+	// Kind prefixes the hash of the name in hash mode, such as "db" or "host"
+	Kind string
+	// Alias replaces the name in alias mode, such as "source-db"
+	Alias string
+}
+
+// Redactor replaces identifiers in human-readable output, by their hashes or
+// aliases. It is a logrus hook redacting messages and string fields, and is safe for
+// concurrent use.
+type Redactor struct {
+	mode string
+
+	mu           sync.RWMutex
+	names        []string
+	replacements map[string]string
+}
+
+// NewRedactor returns a Redactor for the privacy mode, or nil when the mode leaves
+// names intact. The first of identifiers sharing a name picks its alias.
+func NewRedactor(mode string, identifiers []Identifier) *Redactor {
+	if mode != PrivacyHash && mode != PrivacyAlias {
+		return nil
+	}
+	r := &Redactor{mode: mode, replacements: make(map[string]string)}
+	r.Add(identifiers...)
+	return r
+}
+
+// Add redacts more identifiers, such as a name picked once the fork is running.
+// Names already redacted keep their replacement.
+func (r *Redactor) Add(identifiers ...Identifier) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range identifiers {
+		if id.Name == "" {
+			continue
+		}
+		if _, ok := r.replacements[id.Name]; ok {
+			continue
+		}
+		replacement := id.Alias
+		if r.mode == PrivacyHash {
+			sum := sha256.Sum256([]byte(id.Name))
+			replacement = id.Kind + "-" + hex.EncodeToString(sum[:4])
+		}
+		r.replacements[id.Name] = replacement
+		r.names = append(r.names, id.Name)
+	}
+	// Longer names first, so a name containing another is replaced whole
+	sort.SliceStable(r.names, func(i, j int) bool { return len(r.names[i]) > len(r.names[j]) })
+}
+
+// Redact replaces the identifiers in s. Only whole names are replaced: "app" is
+// left alone inside "app_test" or "app.internal", but not before a trailing period.
+func (r *Redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range r.names {
+		s = replaceWhole(s, name, r.replacements[name])
+	}
+	return s
+}
+
+// replaceWhole replaces the occurrences of name in s not adjoining other name characters
+func replaceWhole(s, name, replacement string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, name)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(name)
+		if (i > 0 && isNameByte(s[i-1])) || continuesName(s[end:]) {
+			b.WriteString(s[:end])
+		} else {
+			b.WriteString(s[:i])
+			b.WriteString(replacement)
+		}
+		s = s[end:]
+	}
+}
+
+// continuesName reports whether rest, following a match, continues the name, as a
+// name character or a period followed by one
+func continuesName(rest string) bool {
+	if rest == "" {
+		return false
+	}
+	if rest[0] == '.' {
+		return len(rest) > 1 && isNameByte(rest[1])
+	}
+	return isNameByte(rest[0])
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '-' || c == '$' || c >= 0x80 ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Writer returns a writer redacting what it writes to w, such as the error output of
+// a subprocess. Lines are written whole, so a name is not split between writes;
+// Close writes out a last line without a newline. A nil Redactor writes to w as is.
+func (r *Redactor) Writer(w io.Writer) io.WriteCloser {
+	return &redactWriter{redactor: r, w: w}
+}
+
+// redactWriter redacts the complete lines written to it
+type redactWriter struct {
+	redactor *Redactor
+	w        io.Writer
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.pending = append(rw.pending, p...)
+	end := bytes.LastIndexByte(rw.pending, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+	lines := rw.pending[:end+1]
+	rw.pending = append([]byte(nil), rw.pending[end+1:]...)
+	if _, err := io.WriteString(rw.w, rw.redactor.Redact(string(lines))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes out what is left of the last line
+func (rw *redactWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if len(rw.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, rw.redactor.Redact(string(rw.pending)))
+	rw.pending = nil
+	return err
+}
+
+// Levels redacts entries of every level
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the entry's message and string fields
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = r.Redact(v)
+		case error:
+			entry.Data[key] = r.Redact(v.Error())
+		}
+	}
+	return nil
+}
+
+// Redactor returns the redactor hooked into the logger, or nil when names are logged
+// as they are
+func (l *Logger) Redactor() *Redactor {
+	if l == nil || l.Logger == nil {
+		return nil
+	}
+	for _, hook := range l.Hooks[logrus.InfoLevel] {
+		if r, ok := hook.(*Redactor); ok {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_Alias(t *testing.T) {
+	r := NewRedactor(PrivacyAlias, []Identifier{
+		{Name: "app_pr_42", Kind: "db", Alias: "target-db"},
+		{Name: "app", Kind: "db", Alias: "source-db"},
+		{Name: "db1.internal", Kind: "host", Alias: "source-host"},
+		{Name: "2001:db8::2", Kind: "host", Alias: "destination-host"},
+		{Name: "app", Kind: "db", Alias: "destination-db"},
+	})
+
+	assert.Equal(t, "Forking source-db to target-db on source-host:5432", r.Redact("Forking app to app_pr_42 on db1.internal:5432"))
+	assert.Equal(t, "Copied source-db.", r.Redact("Copied app."))
+	assert.Equal(t, "[destination-host]:5433", r.Redact("[2001:db8::2]:5433"))
+	// Names within other names are left alone
+	assert.Equal(t, "app_test app.orders myapp", r.Redact("app_test app.orders myapp"))
+}
+
+func TestRedactor_Hash(t *testing.T) {
+	r := NewRedactor(PrivacyHash, []Identifier{{Name: "app", Kind: "db", Alias: "source-db"}})
+	redacted := r.Redact("database app")
+	assert.Regexp(t, `^database db-[0-9a-f]{8}$`, redacted)
+	assert.Equal(t, redacted, r.Redact("database app"), "hashes are stable")
+}
+
+func TestRedactor_None(t *testing.T) {
+	assert.Nil(t, NewRedactor("", []Identifier{{Name: "app"}}))
+	assert.Nil(t, NewRedactor(PrivacyNone, []Identifier{{Name: "app"}}))
+
+	var r *Redactor
+	assert.Equal(t, "app", r.Redact("app"))
+}
+
+func TestRedactor_Hook(t *testing.T) {
+	logger := logrus.New()
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, DisableTimestamp: true})
+	logger.AddHook(NewRedactor(PrivacyAlias, []Identifier{{Name: "app", Kind: "db", Alias: "source-db"}}))
+
+	logger.WithField("database", "app").WithError(errors.New(`database "app" does not exist`)).Error("Failed to fork app")
+
+	out := buf.String()
+	require.NotEmpty(t, out)
+	assert.NotContains(t, out, "app")
+	assert.Contains(t, out, "Failed to fork source-db")
+	assert.Contains(t, out, "database=source-db")
+}
+
+func TestRedactor_Add(t *testing.T) {
+	r := NewRedactor(PrivacyAlias, []Identifier{{Name: "app_pr_1", Kind: "db", Alias: "target-db"}})
+	// A suffix continues the name, so it is not redacted until added
+	assert.Equal(t, "using app_pr_1_2", r.Redact("using app_pr_1_2"))
+
+	r.Add(Identifier{Name: "app_pr_1_2", Kind: "db", Alias: "target-db"}, Identifier{Name: "app_pr_1", Alias: "other"})
+	assert.Equal(t, "target-db already exists, using target-db", r.Redact("app_pr_1 already exists, using app_pr_1_2"))
+
+	var none *Redactor
+	none.Add(Identifier{Name: "app"})
+	assert.Nil(t, none)
+}
+
+func TestRedactor_Writer(t *testing.T) {
+	r := NewRedactor(PrivacyAlias, []Identifier{{Name: "app_pr_1", Kind: "db", Alias: "target-db"}})
+	var buf bytes.Buffer
+	w := r.Writer(&buf)
+
+	// A name split between writes is redacted once its line is complete
+	_, err := w.Write([]byte(`pg_restore: error: database "app_`))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	_, err = w.Write([]byte("pr_1\" does not exist\nconnecting to app_pr_1"))
+	require.NoError(t, err)
+	assert.Equal(t, "pg_restore: error: database \"target-db\" does not exist\n", buf.String())
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, "pg_restore: error: database \"target-db\" does not exist\nconnecting to target-db", buf.String())
+
+	// Without a redactor the output is left alone
+	buf.Reset()
+	var none *Redactor
+	w = none.Writer(&buf)
+	_, err = w.Write([]byte("app_pr_1\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "app_pr_1\n", buf.String())
+}
+
+func TestLogger_Redactor(t *testing.T) {
+	logger := &Logger{Logger: logrus.New()}
+	assert.Nil(t, logger.Redactor())
+
+	r := NewRedactor(PrivacyHash, []Identifier{{Name: "app", Kind: "db"}})
+	logger.AddHook(r)
+	assert.Same(t, r, logger.Redactor())
+}
@@ -0,0 +1,192 @@
+package masking
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+)
+
+// Strategy names how a column's values are replaced
+type Strategy string
+
+const (
+	// StrategyNull replaces values with NULL
+	StrategyNull Strategy = "null"
+	// StrategyHash replaces values with their MD5 hash, keeping equal values equal
+	StrategyHash Strategy = "hash"
+	// StrategyEmail replaces values with a unique address at example.com
+	StrategyEmail Strategy = "email"
+	// StrategyValue replaces values with a fixed value
+	StrategyValue Strategy = "value"
+	// StrategyRedact replaces every character with an asterisk, keeping the length
+	StrategyRedact Strategy = "redact"
+)
+
+// Rule masks one column
+type Rule struct {
+	// Table is the table name, optionally schema-qualified ("public.users")
+	Table    string   `mapstructure:"table" yaml:"table" json:"table"`
+	Column   string   `mapstructure:"column" yaml:"column" json:"column"`
+	Strategy Strategy `mapstructure:"strategy" yaml:"strategy" json:"strategy"`
+	// Value is the replacement for the "value" strategy
+	Value string `mapstructure:"value" yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// Validate checks that the rule names a column and a known strategy
+func (r Rule) Validate() error {
+	if r.Table == "" || r.Column == "" {
+		return fmt.Errorf("masking rule requires a table and a column")
+	}
+	switch r.Strategy {
+	case StrategyNull, StrategyHash, StrategyEmail, StrategyValue, StrategyRedact:
+		return nil
+	default:
+		return fmt.Errorf("unknown masking strategy %q for %s.%s", r.Strategy, r.Table, r.Column)
+	}
+}
+
+// expression returns the SQL expression computing the masked value
+func (r Rule) expression() string {
+	column := pq.QuoteIdentifier(r.Column)
+	switch r.Strategy {
+	case StrategyHash:
+		return fmt.Sprintf("md5(%s::text)", column)
+	case StrategyEmail:
+		return fmt.Sprintf("'user_' || substr(md5(%s::text), 1, 12) || '@example.com'", column)
+	case StrategyValue:
+		return pq.QuoteLiteral(r.Value)
+	case StrategyRedact:
+		return fmt.Sprintf("repeat('*', length(%s::text))", column)
+	default:
+		return "NULL"
+	}
+}
+
+// ParseRules decodes masking rules from a settings value, as read from a config file
+// or profile: a list of maps with table, column, strategy and value keys
+func ParseRules(value interface{}) ([]Rule, error) {
+	items, err := cast.ToSliceE(value)
+	if err != nil {
+		return nil, fmt.Errorf("masking rules must be a list: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(items))
+	for i, item := range items {
+		fields, err := cast.ToStringMapStringE(item)
+		if err != nil {
+			return nil, fmt.Errorf("masking rule %d: %w", i+1, err)
+		}
+		rule := Rule{
+			Table:    fields["table"],
+			Column:   fields["column"],
+			Strategy: Strategy(strings.ToLower(fields["strategy"])),
+			Value:    fields["value"],
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("masking rule %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Statements returns one UPDATE statement per table, masking all of its columns at once
+func Statements(rules []Rule) ([]string, error) {
+	byTable := make(map[string][]Rule)
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		byTable[rule.Table] = append(byTable[rule.Table], rule)
+	}
+
+	tables := make([]string, 0, len(byTable))
+	for table := range byTable {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	statements := make([]string, 0, len(tables))
+	for _, table := range tables {
+		assignments := make([]string, 0, len(byTable[table]))
+		for _, rule := range byTable[table] {
+			assignments = append(assignments, fmt.Sprintf("%s = %s", pq.QuoteIdentifier(rule.Column), rule.expression()))
+		}
+		statements = append(statements, fmt.Sprintf("UPDATE %s SET %s", quoteTable(table), strings.Join(assignments, ", ")))
+	}
+	return statements, nil
+}
+
+// SelectList returns the select list reading the table's columns as text, with the
+// columns that have a rule replaced by their masked value. Rules match the table
+// with or without the public schema.
+func SelectList(table string, columns []string, rules []Rule) (string, error) {
+	masked := make(map[string]Rule)
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return "", err
+		}
+		if unqualified(rule.Table) == unqualified(table) {
+			masked[rule.Column] = rule
+		}
+	}
+
+	items := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted := pq.QuoteIdentifier(column)
+		if rule, ok := masked[column]; ok {
+			items = append(items, fmt.Sprintf("(%s)::text AS %s", rule.expression(), quoted))
+		} else {
+			items = append(items, fmt.Sprintf("%s::text", quoted))
+		}
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// Apply masks the rules' columns in a single transaction
+func Apply(ctx context.Context, db *sql.DB, rules []Rule) error {
+	statements, err := Statements(rules)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin masking transaction: %w", err)
+	}
+	for _, statement := range statements {
+		logrus.Debugf("Masking: %s", statement)
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logrus.WithError(rbErr).Warn("Failed to roll back masking transaction")
+			}
+			return fmt.Errorf("masking failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit masking transaction: %w", err)
+	}
+
+	logrus.Infof("Masked %d columns in %d tables", len(rules), len(statements))
+	return nil
+}
+
+// unqualified strips the public schema, so "public.users" and "users" compare equal
+func unqualified(table string) string {
+	return strings.TrimPrefix(table, "public.")
+}
+
+// quoteTable quotes a possibly schema-qualified table name
+func quoteTable(table string) string {
+	parts := strings.SplitN(table, ".", 2)
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,73 @@
+package masking
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	value := []interface{}{
+		map[interface{}]interface{}{"table": "users", "column": "email", "strategy": "email"},
+		map[string]interface{}{"table": "public.users", "column": "name", "strategy": "VALUE", "value": "Jane"},
+	}
+
+	rules, err := ParseRules(value)
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Table: "users", Column: "email", Strategy: StrategyEmail},
+		{Table: "public.users", Column: "name", Strategy: StrategyValue, Value: "Jane"},
+	}, rules)
+
+	_, err = ParseRules([]interface{}{map[string]interface{}{"table": "users", "column": "ssn", "strategy": "shuffle"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown masking strategy "shuffle"`)
+
+	_, err = ParseRules([]interface{}{map[string]interface{}{"table": "users", "strategy": "null"}})
+	require.Error(t, err)
+}
+
+func TestStatements(t *testing.T) {
+	statements, err := Statements([]Rule{
+		{Table: "users", Column: "email", Strategy: StrategyEmail},
+		{Table: "billing.cards", Column: "number", Strategy: StrategyRedact},
+		{Table: "users", Column: "phone", Strategy: StrategyNull},
+		{Table: "users", Column: "note", Strategy: StrategyValue, Value: "it's masked"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		`UPDATE "billing"."cards" SET "number" = repeat('*', length("number"::text))`,
+		`UPDATE "users" SET "email" = 'user_' || substr(md5("email"::text), 1, 12) || '@example.com', "phone" = NULL, "note" = 'it''s masked'`,
+	}, statements)
+}
+
+func TestSelectList(t *testing.T) {
+	rules := []Rule{
+		{Table: "users", Column: "email", Strategy: StrategyHash},
+		{Table: "orders", Column: "total", Strategy: StrategyNull},
+	}
+
+	list, err := SelectList("public.users", []string{"id", "email"}, rules)
+	require.NoError(t, err)
+	assert.Equal(t, `"id"::text, (md5("email"::text))::text AS "email"`, list)
+
+	_, err = SelectList("users", []string{"id"}, []Rule{{Table: "users", Column: "id", Strategy: "scramble"}})
+	assert.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "users" SET "ssn" = md5\("ssn"::text\)`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	require.NoError(t, Apply(context.Background(), db, []Rule{{Table: "users", Column: "ssn", Strategy: StrategyHash}}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,257 @@
+// Package naming derives target database names through named strategies configured
+// once, so every pipeline of an organisation names its databases the same way.
+// The template, hash and regex strategy types are built in; others can be added
+// with Register.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+)
+
+// DefaultInput is the template variable hash and regex strategies read by default:
+// the branch name as CI reports it
+const DefaultInput = "BRANCH_NAME"
+
+// Strategy derives a database name from the template variables of a fork
+type Strategy interface {
+	Name(vars map[string]string) (string, error)
+}
+
+// Factory builds a strategy from its configuration
+type Factory func(cfg config.NamingStrategyConfig) (Strategy, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a strategy type available to configured strategies. It panics if
+// the type is registered twice.
+func Register(kind string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[kind]; ok {
+		panic("naming: strategy type registered twice: " + kind)
+	}
+	registry[kind] = factory
+}
+
+// Types returns the registered strategy types, sorted
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	kinds := make([]string, 0, len(registry))
+	for kind := range registry {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// New builds a strategy of the configured type
+func New(cfg config.NamingStrategyConfig) (Strategy, error) {
+	registryMu.RLock()
+	factory, ok := registry[cfg.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy type %q (available: %s)", cfg.Type, strings.Join(Types(), ", "))
+	}
+	return factory(cfg)
+}
+
+// Resolve derives a name with the named strategy, trying its fallbacks in turn when
+// a strategy cannot produce one. The name must be a valid PostgreSQL identifier.
+func Resolve(name string, strategies map[string]config.NamingStrategyConfig, vars map[string]string) (string, error) {
+	var failures []string
+	seen := make(map[string]bool)
+	for current := name; current != ""; {
+		if seen[current] {
+			return "", fmt.Errorf("naming strategy %s falls back to itself", current)
+		}
+		seen[current] = true
+
+		cfg, ok := strategies[current]
+		if !ok {
+			return "", fmt.Errorf("naming strategy %s is not configured", current)
+		}
+		strategy, err := New(cfg)
+		if err != nil {
+			return "", fmt.Errorf("naming strategy %s: %w", current, err)
+		}
+		result, err := strategy.Name(vars)
+		if err == nil {
+			err = config.ValidateIdentifier(result)
+		}
+		if err == nil {
+			return result, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", current, err))
+		current = cfg.Fallback
+	}
+	return "", fmt.Errorf("no naming strategy produced a name (%s)", strings.Join(failures, "; "))
+}
+
+// Apply sets the target database of a fork from its naming strategy, if it has one.
+// Besides the fork's template data, strategies see SOURCE_DB, the source database.
+func Apply(cfg *config.ForkConfig) error {
+	if cfg.NamingStrategy == "" {
+		return nil
+	}
+	if cfg.TargetDatabase != "" {
+		return fmt.Errorf("cannot specify both a target database and naming strategy %s", cfg.NamingStrategy)
+	}
+	vars := cfg.TemplateData()
+	vars["SOURCE_DB"] = cfg.Source.Database
+	name, err := Resolve(cfg.NamingStrategy, cfg.NamingStrategies, vars)
+	if err != nil {
+		return err
+	}
+	cfg.TargetDatabase = name
+	// As in BuildForkConfig, validation needs a destination database
+	if cfg.Destination.Database == "" {
+		cfg.Destination.Database = name
+	}
+	return nil
+}
+
+// render executes a name template with missing variables as errors
+func render(text string, vars map[string]string) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var name strings.Builder
+	if err := tmpl.Execute(&name, vars); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return name.String(), nil
+}
+
+// input returns the variable a strategy derives its name from
+func input(cfg config.NamingStrategyConfig, vars map[string]string) (string, error) {
+	key := cfg.Input
+	if key == "" {
+		key = DefaultInput
+	}
+	value := vars[key]
+	if value == "" {
+		return "", fmt.Errorf("input variable %s is not set", key)
+	}
+	return value, nil
+}
+
+// with returns a copy of vars with more variables
+func with(vars map[string]string, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(vars)+len(extra))
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+func init() {
+	Register("template", newTemplateStrategy)
+	Register("hash", newHashStrategy)
+	Register("regex", newRegexStrategy)
+}
+
+// templateStrategy renders its template with the fork's template variables
+type templateStrategy struct {
+	template string
+}
+
+func newTemplateStrategy(cfg config.NamingStrategyConfig) (Strategy, error) {
+	if cfg.Template == "" {
+		return nil, errors.New("template strategy needs a template")
+	}
+	return &templateStrategy{template: cfg.Template}, nil
+}
+
+func (s *templateStrategy) Name(vars map[string]string) (string, error) {
+	return render(s.template, vars)
+}
+
+// hashStrategy names databases by a hash of the input, for branches whose names
+// are too long or too irregular to use; the template sees it as HASH
+type hashStrategy struct {
+	cfg config.NamingStrategyConfig
+}
+
+func newHashStrategy(cfg config.NamingStrategyConfig) (Strategy, error) {
+	if cfg.Length == 0 {
+		cfg.Length = 8
+	}
+	if cfg.Length < 4 || cfg.Length > 64 {
+		return nil, fmt.Errorf("hash length must be between 4 and 64, got %d", cfg.Length)
+	}
+	if cfg.Template == "" {
+		cfg.Template = "{{.SOURCE_DB}}_{{.HASH}}"
+	}
+	return &hashStrategy{cfg: cfg}, nil
+}
+
+func (s *hashStrategy) Name(vars map[string]string) (string, error) {
+	value, err := input(s.cfg, vars)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(value))
+	return render(s.cfg.Template, with(vars, map[string]string{"HASH": hex.EncodeToString(sum[:])[:s.cfg.Length]}))
+}
+
+// regexStrategy extracts part of the input, such as a ticket ID from a branch name.
+// The template sees the first capture group, or the whole match without groups, as
+// MATCH, and named groups under their names, all sanitized like branch names.
+type regexStrategy struct {
+	cfg     config.NamingStrategyConfig
+	pattern *regexp.Regexp
+}
+
+func newRegexStrategy(cfg config.NamingStrategyConfig) (Strategy, error) {
+	if cfg.Pattern == "" {
+		return nil, errors.New("regex strategy needs a pattern")
+	}
+	pattern, err := regexp.Compile(cfg.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	if cfg.Template == "" {
+		cfg.Template = "{{.SOURCE_DB}}_{{.MATCH}}"
+	}
+	return &regexStrategy{cfg: cfg, pattern: pattern}, nil
+}
+
+func (s *regexStrategy) Name(vars map[string]string) (string, error) {
+	value, err := input(s.cfg, vars)
+	if err != nil {
+		return "", err
+	}
+	match := s.pattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", fmt.Errorf("%q does not match %s", value, s.pattern)
+	}
+
+	extra := map[string]string{"MATCH": config.SanitizeBranchName(match[0])}
+	if len(match) > 1 {
+		extra["MATCH"] = config.SanitizeBranchName(match[1])
+	}
+	for i, group := range s.pattern.SubexpNames() {
+		if group != "" {
+			extra[group] = config.SanitizeBranchName(match[i])
+		}
+	}
+	return render(s.cfg.Template, with(vars, extra))
+}
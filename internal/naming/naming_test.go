@@ -0,0 +1,123 @@
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hashOf returns the hex SHA-256 of s
+func hashOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestResolve(t *testing.T) {
+	strategies := map[string]config.NamingStrategyConfig{
+		"ticket": {
+			Type:     "regex",
+			Pattern:  `(?P<TICKET>[A-Z]+-[0-9]+)`,
+			Template: "{{.SOURCE_DB}}_{{.TICKET}}",
+			Fallback: "branch-hash",
+		},
+		"branch-hash": {Type: "hash", Length: 10},
+		"preview":     {Type: "template", Template: "{{.SOURCE_DB}}_pr_{{.PR_NUMBER}}"},
+		"loop-a":      {Type: "regex", Pattern: "^never$", Fallback: "loop-b"},
+		"loop-b":      {Type: "regex", Pattern: "^never$", Fallback: "loop-a"},
+		"broken":      {Type: "regex", Pattern: "("},
+	}
+	vars := map[string]string{"SOURCE_DB": "app", "BRANCH_NAME": "feature/PAY-1234-refunds", "PR_NUMBER": "42"}
+
+	tests := []struct {
+		name     string
+		strategy string
+		vars     map[string]string
+		want     string
+		err      string
+	}{
+		{name: "ticket", strategy: "ticket", vars: vars, want: "app_pay_1234"},
+		{name: "fallback to hash", strategy: "ticket", vars: map[string]string{"SOURCE_DB": "app", "BRANCH_NAME": "main"}, want: "app_" + hashOf("main")[:10]},
+		{name: "template", strategy: "preview", vars: vars, want: "app_pr_42"},
+		{name: "missing variable", strategy: "preview", vars: map[string]string{"SOURCE_DB": "app"}, err: "no naming strategy produced a name (preview: failed to render template"},
+		{name: "unknown", strategy: "nightly", vars: vars, err: "naming strategy nightly is not configured"},
+		{name: "loop", strategy: "loop-a", vars: vars, err: "naming strategy loop-a falls back to itself"},
+		{name: "invalid pattern", strategy: "broken", vars: vars, err: "naming strategy broken: invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := Resolve(tt.strategy, strategies, tt.vars)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, name)
+		})
+	}
+}
+
+func TestHashStrategy_Stable(t *testing.T) {
+	strategy, err := New(config.NamingStrategyConfig{Type: "hash", Input: "BRANCH", Template: "db_{{.HASH}}"})
+	require.NoError(t, err)
+
+	first, err := strategy.Name(map[string]string{"BRANCH": "feature/a"})
+	require.NoError(t, err)
+	second, err := strategy.Name(map[string]string{"BRANCH": "feature/a"})
+	require.NoError(t, err)
+	other, err := strategy.Name(map[string]string{"BRANCH": "feature/b"})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+	assert.Len(t, first, len("db_")+8)
+
+	_, err = strategy.Name(map[string]string{})
+	assert.EqualError(t, err, "input variable BRANCH is not set")
+
+	_, err = New(config.NamingStrategyConfig{Type: "hash", Length: 100})
+	assert.ErrorContains(t, err, "hash length must be between 4 and 64")
+}
+
+type staticStrategy string
+
+func (s staticStrategy) Name(map[string]string) (string, error) { return string(s), nil }
+
+func TestRegister(t *testing.T) {
+	Register("static", func(cfg config.NamingStrategyConfig) (Strategy, error) {
+		return staticStrategy(cfg.Template), nil
+	})
+	assert.Contains(t, Types(), "static")
+	assert.Panics(t, func() { Register("static", nil) })
+
+	name, err := Resolve("fixed", map[string]config.NamingStrategyConfig{"fixed": {Type: "static", Template: "shared_db"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "shared_db", name)
+
+	_, err = New(config.NamingStrategyConfig{Type: "uuid"})
+	assert.ErrorContains(t, err, `unknown strategy type "uuid" (available: hash, regex, static, template)`)
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("GITHUB_HEAD_REF", "")
+	t.Setenv("CI_COMMIT_REF_NAME", "")
+
+	cfg := &config.ForkConfig{
+		Source:         config.DatabaseConfig{Database: "app"},
+		TemplateVars:   map[string]string{"BRANCH": "OPS-77/cleanup"},
+		NamingStrategy: "ticket",
+		NamingStrategies: map[string]config.NamingStrategyConfig{
+			"ticket": {Type: "regex", Pattern: `([A-Z]+-\d+)`},
+		},
+	}
+	require.NoError(t, Apply(cfg))
+	assert.Equal(t, "app_ops_77", cfg.TargetDatabase)
+
+	assert.ErrorContains(t, Apply(cfg), "cannot specify both a target database and naming strategy ticket")
+
+	cfg = &config.ForkConfig{TargetDatabase: "explicit"}
+	require.NoError(t, Apply(cfg))
+	assert.Equal(t, "explicit", cfg.TargetDatabase)
+}
@@ -0,0 +1,75 @@
+package output
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatBytes converts bytes to a human readable size in binary units
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// FormatAge formats a duration as days and hours, hours and minutes, or minutes
+func FormatAge(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh", days, hours)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// Truncate shortens s to at most maxLen bytes, ending it with "..." when cut
+func Truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	if maxLen <= 3 {
+		return s[:maxLen]
+	}
+	return s[:maxLen-3] + "..."
+}
+
+// StatusIcon returns the icon shown next to a check, job or health status
+func StatusIcon(status string) string {
+	switch status {
+	case "pass", "ok", "healthy", "completed":
+		return "✅"
+	case "warn", "degraded":
+		return "⚠️"
+	case "fail", "failed", "error":
+		return "❌"
+	case "running":
+		return "🏃"
+	case "paused":
+		return "⏸️"
+	case "cancelled":
+		return "🛑"
+	case "info":
+		return "ℹ️"
+	default:
+		return "❓"
+	}
+}
+
+// BoolIcon returns a yes or no answer with its icon
+func BoolIcon(value bool) string {
+	if value {
+		return "✅ Yes"
+	}
+	return "❌ No"
+}
@@ -0,0 +1,71 @@
+package output
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		bytes    int64
+		expected string
+	}{
+		{
+			name:     "bytes",
+			bytes:    512,
+			expected: "512 B",
+		},
+		{
+			name:     "kilobytes",
+			bytes:    1536, // 1.5 KB
+			expected: "1.5 KB",
+		},
+		{
+			name:     "megabytes",
+			bytes:    1572864, // 1.5 MB
+			expected: "1.5 MB",
+		},
+		{
+			name:     "gigabytes",
+			bytes:    1610612736, // 1.5 GB
+			expected: "1.5 GB",
+		},
+		{
+			name:     "zero bytes",
+			bytes:    0,
+			expected: "0 B",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FormatBytes(tt.bytes)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	assert.Equal(t, "5m", FormatAge(5*time.Minute))
+	assert.Equal(t, "2h 30m", FormatAge(150*time.Minute))
+	assert.Equal(t, "3d 4h", FormatAge(76*time.Hour))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", Truncate("short", 10))
+	assert.Equal(t, "fork-17...", Truncate("fork-1700000000", 10))
+	assert.Equal(t, "fo", Truncate("fork", 2))
+}
+
+func TestStatusIcon(t *testing.T) {
+	assert.Equal(t, "✅", StatusIcon("pass"))
+	assert.Equal(t, "✅", StatusIcon("completed"))
+	assert.Equal(t, "⚠️", StatusIcon("warn"))
+	assert.Equal(t, "❌", StatusIcon("failed"))
+	assert.Equal(t, "🏃", StatusIcon("running"))
+	assert.Equal(t, "❓", StatusIcon("unknown"))
+	assert.Equal(t, "❌ No", BoolIcon(false))
+}
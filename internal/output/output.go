@@ -0,0 +1,136 @@
+// Package output renders command results as text, JSON, YAML or porcelain records,
+// so every command offers the same formats with the same behaviour
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats accepted by --output-format
+const (
+	Text = "text"
+	JSON = "json"
+	// YAML holds the same fields as JSON, for tools such as Kubernetes operators and Ansible
+	YAML = "yaml"
+	// Porcelain is a line-oriented format for scripts, see WritePorcelain
+	Porcelain = "porcelain"
+)
+
+// Result is the outcome of a command. Its JSON encoding is the JSON and YAML output.
+type Result interface {
+	// WriteText writes the human-readable output
+	WriteText(w io.Writer) error
+}
+
+// PorcelainResult is a Result that can also be written as porcelain records
+type PorcelainResult interface {
+	Result
+	// WritePorcelain writes the result's records, without the closing status record
+	WritePorcelain(w io.Writer)
+	// Outcome reports whether the command succeeded and, if not, why
+	Outcome() (success bool, errorMsg string)
+}
+
+// IsStructured reports whether format is JSON or YAML
+func IsStructured(format string) bool {
+	return format == JSON || format == YAML
+}
+
+// Render writes result in format. Porcelain output ends with the status record, and
+// is rejected for results without porcelain records.
+func Render(w io.Writer, format string, result Result) error {
+	switch {
+	case IsStructured(format):
+		return WriteStructured(w, format, result)
+	case format == Porcelain:
+		records, ok := result.(PorcelainResult)
+		if !ok {
+			return fmt.Errorf("porcelain output is not supported by this command")
+		}
+		records.WritePorcelain(w)
+		success, errorMsg := records.Outcome()
+		WritePorcelainStatus(w, success, errorMsg)
+		return nil
+	default:
+		return result.WriteText(w)
+	}
+}
+
+// WriteStructured writes v as indented JSON or as YAML. YAML keys and their order
+// follow the JSON encoding, so both formats expose the same fields.
+func WriteStructured(w io.Writer, format string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s output: %w", format, err)
+	}
+	if format == YAML {
+		if data, err = jsonToYAML(data); err != nil {
+			return fmt.Errorf("failed to marshal %s output: %w", format, err)
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// jsonToYAML converts a JSON document to YAML, keeping the order of object keys
+func jsonToYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeOrdered(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(value)
+}
+
+// decodeOrdered decodes the next JSON value, with objects as yaml.MapSlice so their
+// keys keep the order they were encoded in
+func decodeOrdered(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '{' {
+			object := yaml.MapSlice{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeOrdered(decoder)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := decoder.Token()
+			return object, err
+		}
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	case json.Number:
+		if n, err := token.Int64(); err == nil {
+			return n, nil
+		}
+		return token.Float64()
+	default:
+		return token, nil
+	}
+}
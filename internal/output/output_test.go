@@ -0,0 +1,98 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStructured(t *testing.T) {
+	result := struct {
+		Success bool              `json:"success"`
+		Count   int64             `json:"count"`
+		Rate    float64           `json:"rate"`
+		Names   []string          `json:"names"`
+		Empty   []string          `json:"empty"`
+		Error   string            `json:"error,omitempty"`
+		Labels  map[string]string `json:"labels"`
+	}{
+		Success: true,
+		Count:   12345678901,
+		Rate:    1.5,
+		Names:   []string{"app_pr_1", "app_pr_2"},
+		Empty:   []string{},
+		Labels:  map[string]string{"b": "2", "a": "1"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteStructured(&out, YAML, result))
+	assert.Equal(t, `success: true
+count: 12345678901
+rate: 1.5
+names:
+- app_pr_1
+- app_pr_2
+empty: []
+labels:
+  a: "1"
+  b: "2"
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, WriteStructured(&out, JSON, result))
+	assert.Contains(t, out.String(), "\"count\": 12345678901,\n")
+
+	assert.True(t, IsStructured("yaml"))
+	assert.False(t, IsStructured(Porcelain))
+}
+
+type textResult struct {
+	Name string `json:"name"`
+}
+
+func (r textResult) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "name is %s\n", r.Name)
+	return err
+}
+
+type recordsResult struct {
+	textResult
+	err string
+}
+
+func (r recordsResult) WritePorcelain(w io.Writer) {
+	WritePorcelain(w, "name", r.Name)
+}
+
+func (r recordsResult) Outcome() (bool, string) {
+	return r.err == "", r.err
+}
+
+func TestRender(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, Text, textResult{Name: "app"}))
+	assert.Equal(t, "name is app\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Render(&out, "", textResult{Name: "app"}))
+	assert.Equal(t, "name is app\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Render(&out, YAML, textResult{Name: "app"}))
+	assert.Equal(t, "name: app\n", out.String())
+
+	out.Reset()
+	assert.Error(t, Render(&out, Porcelain, textResult{Name: "app"}))
+
+	out.Reset()
+	require.NoError(t, Render(&out, Porcelain, recordsResult{textResult: textResult{Name: "app"}}))
+	assert.Equal(t, "name\tapp\nstatus\tok\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Render(&out, Porcelain, recordsResult{textResult: textResult{Name: "app"}, err: "failed"}))
+	assert.Equal(t, "name\tapp\nstatus\terror\tfailed\n", out.String())
+}
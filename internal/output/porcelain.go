@@ -0,0 +1,38 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Porcelain output is a line-oriented format for scripts that, unlike the text output,
+// does not change between minor versions. Each line is one record: a record type
+// followed by tab-separated fields. Later versions may add record types and append
+// fields to a record, so readers should ignore what they do not know; existing fields
+// keep their position and meaning. Tabs, newlines and backslashes inside a field are
+// written as \t, \n and \\. Every command ends with a status record:
+//
+//	status	ok
+//	status	error	<message>
+
+// porcelainEscaper escapes the characters that would break a porcelain record apart
+var porcelainEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// WritePorcelain writes one porcelain record
+func WritePorcelain(w io.Writer, record string, fields ...interface{}) {
+	line := record
+	for _, field := range fields {
+		line += "\t" + porcelainEscaper.Replace(fmt.Sprint(field))
+	}
+	_, _ = fmt.Fprintln(w, line)
+}
+
+// WritePorcelainStatus writes the status record that ends porcelain output
+func WritePorcelainStatus(w io.Writer, success bool, errorMsg string) {
+	if success {
+		WritePorcelain(w, "status", "ok")
+	} else {
+		WritePorcelain(w, "status", "error", errorMsg)
+	}
+}
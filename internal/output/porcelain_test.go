@@ -0,0 +1,14 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePorcelain(t *testing.T) {
+	var buf bytes.Buffer
+	WritePorcelain(&buf, "status", "error", "relation \"a\tb\"\ndoes not exist", 3)
+	assert.Equal(t, "status\terror\trelation \"a\\tb\"\\ndoes not exist\t3\n", buf.String())
+}
@@ -0,0 +1,232 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/lib/pq"
+)
+
+// TemplateAccess is which databases the admin user of a service may clone with
+// CREATE DATABASE ... TEMPLATE
+type TemplateAccess string
+
+const (
+	// TemplateAny clones any database, as superusers can
+	TemplateAny TemplateAccess = ""
+	// TemplateOwned clones only databases owned by a role the user is a member of
+	TemplateOwned TemplateAccess = "owned"
+	// TemplateNone does not support template cloning
+	TemplateNone TemplateAccess = "none"
+)
+
+// Profile describes what the admin user of a PostgreSQL service may do. The zero
+// profile is a self-hosted server with a superuser, where nothing is restricted.
+type Profile struct {
+	// Name selects the profile with --provider, e.g. "rds"
+	Name string `json:"name"`
+	// Title names the service in messages
+	Title string `json:"title"`
+
+	// TemplateClone is which databases may be cloned as templates
+	TemplateClone TemplateAccess `json:"template_clone,omitempty"`
+	// NoCreateDatabase is set where users cannot run CREATE DATABASE at all
+	NoCreateDatabase bool `json:"no_create_database,omitempty"`
+	// NoEventTriggers is set where only superusers may create event triggers
+	NoEventTriggers bool `json:"no_event_triggers,omitempty"`
+	// NoSubscriptions is set where only superusers may create subscriptions
+	NoSubscriptions bool `json:"no_subscriptions,omitempty"`
+	// NoServerFiles is set where pg_stat_file and the other file functions are denied
+	NoServerFiles bool `json:"no_server_files,omitempty"`
+}
+
+// Managed reports whether the profile is a managed service rather than self-hosted
+func (p Profile) Managed() bool {
+	return p.Name != "" && p.Name != "none"
+}
+
+// Downgrades describes what forks to a server of this profile do differently from
+// forks to a self-hosted server
+func (p Profile) Downgrades() []string {
+	var downgrades []string
+	switch p.TemplateClone {
+	case TemplateOwned:
+		downgrades = append(downgrades, fmt.Sprintf("%s only lets the owner of a database clone it, so same-server forks of other databases use dump and restore", p.Title))
+	case TemplateNone:
+		downgrades = append(downgrades, fmt.Sprintf("%s does not support template cloning, so same-server forks use dump and restore", p.Title))
+	}
+	if p.NoEventTriggers {
+		downgrades = append(downgrades, fmt.Sprintf("event triggers need a superuser on %s and are skipped by pg_restore with a warning", p.Title))
+	}
+	if p.NoSubscriptions {
+		downgrades = append(downgrades, "subscriptions are left out of the schema dump")
+	}
+	if p.NoServerFiles {
+		downgrades = append(downgrades, "database creation times are unknown, as pg_stat_file is denied")
+	}
+	return downgrades
+}
+
+// CreationTime returns the SQL expression of when the database with the OID in
+// oidColumn was created, the modification time of its PG_VERSION file, or NULL
+// where server files cannot be read
+func (p Profile) CreationTime(oidColumn string) string {
+	if p.NoServerFiles {
+		return "NULL::timestamptz"
+	}
+	return "pg_stat_file('base/'||" + oidColumn + "||'/PG_VERSION').modification"
+}
+
+// profiles are the known managed services, by name
+var profiles = map[string]Profile{
+	"rds": {
+		Name: "rds", Title: "Amazon RDS",
+		TemplateClone: TemplateOwned, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"aurora": {
+		Name: "aurora", Title: "Amazon Aurora",
+		TemplateClone: TemplateOwned, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"cloudsql": {
+		Name: "cloudsql", Title: "Google Cloud SQL",
+		TemplateClone: TemplateOwned, NoEventTriggers: true, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"azure": {
+		Name: "azure", Title: "Azure Database for PostgreSQL",
+		TemplateClone: TemplateOwned, NoEventTriggers: true, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"heroku": {
+		Name: "heroku", Title: "Heroku Postgres",
+		TemplateClone: TemplateNone, NoCreateDatabase: true, NoEventTriggers: true, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"supabase": {
+		Name: "supabase", Title: "Supabase",
+		TemplateClone: TemplateOwned, NoEventTriggers: true, NoSubscriptions: true, NoServerFiles: true,
+	},
+	"neon": {
+		Name: "neon", Title: "Neon",
+		TemplateClone: TemplateNone, NoEventTriggers: true, NoSubscriptions: true, NoServerFiles: true,
+	},
+}
+
+// SelfHosted is the profile of a server without managed-service restrictions
+var SelfHosted = Profile{Name: "none", Title: "self-hosted PostgreSQL"}
+
+// Names lists the values --provider accepts
+func Names() []string {
+	names := []string{"auto", "none"}
+	known := make([]string, 0, len(profiles))
+	for name := range profiles {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+	return append(names, known...)
+}
+
+// Lookup returns the profile named by --provider. "none" is the self-hosted profile;
+// "auto" and "" are not profiles, as they ask for detection.
+func Lookup(name string) (Profile, bool) {
+	if name == SelfHosted.Name {
+		return SelfHosted, true
+	}
+	profile, ok := profiles[name]
+	return profile, ok
+}
+
+// hostSuffixes recognise services by the host names of their endpoints
+var hostSuffixes = []struct {
+	suffix  string
+	profile string
+}{
+	{".rds.amazonaws.com", "rds"},
+	{".postgres.database.azure.com", "azure"},
+	{".supabase.co", "supabase"},
+	{".supabase.com", "supabase"},
+	{".neon.tech", "neon"},
+}
+
+// serviceRoles recognise services by the roles they create for their admin users
+var serviceRoles = []struct {
+	role    string
+	profile string
+}{
+	{"rds_superuser", "rds"},
+	{"cloudsqlsuperuser", "cloudsql"},
+	{"azure_pg_admin", "azure"},
+	{"supabase_admin", "supabase"},
+	{"neon_superuser", "neon"},
+}
+
+// detectionQuery lists the service roles present on the server, and whether it is
+// Aurora, which has aurora_version()
+const detectionQuery = `
+	SELECT rolname FROM pg_roles WHERE rolname = ANY($1)
+	UNION ALL
+	SELECT 'aurora' WHERE to_regproc('aurora_version') IS NOT NULL`
+
+// Detect identifies the service behind a connection from its roles, falling back to
+// the host name, and returns the self-hosted profile when neither matches. Heroku
+// has no marker and has to be selected with --provider heroku.
+func Detect(ctx context.Context, conn *db.Connection, host string) (Profile, error) {
+	roles := make([]string, 0, len(serviceRoles))
+	for _, r := range serviceRoles {
+		roles = append(roles, r.role)
+	}
+	rows, err := conn.DB.QueryContext(ctx, detectionQuery, pq.Array(roles))
+	if err != nil {
+		return SelfHosted, fmt.Errorf("failed to detect the database provider: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return SelfHosted, fmt.Errorf("failed to detect the database provider: %w", err)
+		}
+		found[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return SelfHosted, fmt.Errorf("failed to detect the database provider: %w", err)
+	}
+	return detect(found, host), nil
+}
+
+// detect picks the profile matching the roles found on a server, or its host name
+func detect(found map[string]bool, host string) Profile {
+	for _, r := range serviceRoles {
+		if !found[r.role] {
+			continue
+		}
+		if r.profile == "rds" && found["aurora"] {
+			return profiles["aurora"]
+		}
+		return profiles[r.profile]
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range hostSuffixes {
+		if strings.HasSuffix(host, h.suffix) {
+			if h.profile == "rds" && strings.Contains(host, ".cluster-") {
+				return profiles["aurora"]
+			}
+			return profiles[h.profile]
+		}
+	}
+	return SelfHosted
+}
+
+// Resolve returns the profile configured by name, detecting it through conn for
+// "auto" or an empty name
+func Resolve(ctx context.Context, name string, conn *db.Connection, host string) (Profile, error) {
+	if name == "" || name == "auto" {
+		return Detect(ctx, conn, host)
+	}
+	profile, ok := Lookup(name)
+	if !ok {
+		return SelfHosted, fmt.Errorf("unknown provider %q (expected one of %s)", name, strings.Join(Names(), ", "))
+	}
+	return profile, nil
+}
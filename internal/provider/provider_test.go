@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect_Roles(t *testing.T) {
+	assert.Equal(t, "rds", detect(map[string]bool{"rds_superuser": true}, "10.0.0.5").Name)
+	assert.Equal(t, "aurora", detect(map[string]bool{"rds_superuser": true, "aurora": true}, "").Name)
+	assert.Equal(t, "cloudsql", detect(map[string]bool{"cloudsqlsuperuser": true}, "localhost").Name)
+	assert.Equal(t, "neon", detect(map[string]bool{"neon_superuser": true}, "").Name)
+}
+
+func TestDetect_Host(t *testing.T) {
+	assert.Equal(t, "rds", detect(nil, "db.abc123.eu-west-1.rds.amazonaws.com").Name)
+	assert.Equal(t, "aurora", detect(nil, "app.cluster-abc123.eu-west-1.rds.amazonaws.com.").Name)
+	assert.Equal(t, "azure", detect(nil, "app.Postgres.Database.Azure.com").Name)
+	assert.Equal(t, "supabase", detect(nil, "db.abcdef.supabase.co").Name)
+	assert.Equal(t, "neon", detect(nil, "ep-cool-1234.us-east-2.aws.neon.tech").Name)
+	assert.Equal(t, SelfHosted, detect(nil, "localhost"))
+}
+
+func TestDetect_Query(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = sqlDB.Close() }()
+
+	mock.ExpectQuery("SELECT rolname FROM pg_roles").
+		WillReturnRows(sqlmock.NewRows([]string{"rolname"}).AddRow("azure_pg_admin"))
+
+	profile, err := Detect(context.Background(), &db.Connection{DB: sqlDB}, "10.1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "azure", profile.Name)
+	assert.True(t, profile.Managed())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolve(t *testing.T) {
+	profile, err := Resolve(context.Background(), "heroku", nil, "")
+	require.NoError(t, err)
+	assert.True(t, profile.NoCreateDatabase)
+	assert.Equal(t, TemplateNone, profile.TemplateClone)
+
+	profile, err = Resolve(context.Background(), "none", nil, "")
+	require.NoError(t, err)
+	assert.False(t, profile.Managed())
+	assert.Empty(t, profile.Downgrades())
+
+	_, err = Resolve(context.Background(), "oracle", nil, "")
+	assert.ErrorContains(t, err, `unknown provider "oracle"`)
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, []string{"auto", "none", "aurora", "azure", "cloudsql", "heroku", "neon", "rds", "supabase"}, Names())
+}
+
+func TestProfile_CreationTime(t *testing.T) {
+	assert.Equal(t, "pg_stat_file('base/'||d.oid||'/PG_VERSION').modification", SelfHosted.CreationTime("d.oid"))
+
+	rds, _ := Lookup("rds")
+	assert.Equal(t, "NULL::timestamptz", rds.CreationTime("d.oid"))
+	assert.Contains(t, rds.Downgrades(), "database creation times are unknown, as pg_stat_file is denied")
+}
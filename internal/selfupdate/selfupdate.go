@@ -0,0 +1,397 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultRepository is the GitHub repository releases are published to
+	DefaultRepository = "hongkongkiwi/postgres-db-fork"
+	// DefaultAPIURL is the GitHub REST API
+	DefaultAPIURL = "https://api.github.com"
+
+	// checksumsAsset lists the SHA-256 of every archive of a release
+	checksumsAsset = "checksums.txt"
+	// signatureAsset is the Ed25519 signature of checksumsAsset
+	signatureAsset = "checksums.txt.sig"
+	// binaryPrefix starts the name of the binary inside each archive
+	binaryPrefix = "postgres-db-fork"
+	// maxDownloadSize bounds any one download
+	maxDownloadSize = 512 << 20
+)
+
+// Channel selects which releases an update considers
+type Channel string
+
+const (
+	// ChannelStable follows full releases only
+	ChannelStable Channel = "stable"
+	// ChannelEdge also follows prereleases
+	ChannelEdge Channel = "edge"
+)
+
+// ParseChannel returns the channel with the given name
+func ParseChannel(name string) (Channel, error) {
+	switch Channel(strings.ToLower(name)) {
+	case ChannelStable:
+		return ChannelStable, nil
+	case ChannelEdge:
+		return ChannelEdge, nil
+	default:
+		return "", fmt.Errorf("unknown release channel %q (use stable or edge)", name)
+	}
+}
+
+// Release is a GitHub release and its downloadable assets
+type Release struct {
+	Tag        string  `json:"tag_name"`
+	Prerelease bool    `json:"prerelease"`
+	Draft      bool    `json:"draft"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// asset returns the release's asset with the given name
+func (r *Release) asset(name string) (*Asset, bool) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], true
+		}
+	}
+	return nil, false
+}
+
+// ArchiveName returns the name of the release archive for a platform, as built by
+// the release workflow
+func ArchiveName(tag, goos, goarch string) string {
+	ext := "tar.gz"
+	if goos == "windows" {
+		ext = "zip"
+	}
+	return fmt.Sprintf("%s-%s-%s-%s.%s", binaryPrefix, tag, goos, goarch, ext)
+}
+
+// Updater finds, downloads and verifies releases
+type Updater struct {
+	APIURL     string
+	Repository string
+	// Token, when set, authenticates GitHub API requests, raising the rate limit
+	Token string
+	// PublicKey verifies the signature of each release's checksums; without one only
+	// the checksums are checked
+	PublicKey  ed25519.PublicKey
+	HTTPClient *http.Client
+}
+
+// NewUpdater returns an updater for the project's GitHub releases
+func NewUpdater(publicKey ed25519.PublicKey) *Updater {
+	return &Updater{
+		APIURL:     DefaultAPIURL,
+		Repository: DefaultRepository,
+		PublicKey:  publicKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Latest returns the newest release on the channel. The stable channel skips
+// prereleases; both skip drafts.
+func (u *Updater) Latest(ctx context.Context, channel Channel) (*Release, error) {
+	base := strings.TrimRight(u.APIURL, "/") + "/repos/" + u.Repository
+	if channel == ChannelStable {
+		var release Release
+		if err := u.getJSON(ctx, base+"/releases/latest", &release); err != nil {
+			return nil, err
+		}
+		return &release, nil
+	}
+
+	var releases []Release
+	if err := u.getJSON(ctx, base+"/releases?per_page=30", &releases); err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if !releases[i].Draft {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no releases found in %s", u.Repository)
+}
+
+// Download fetches the release's binary for a platform. The archive must match its
+// entry in the release checksums, and the checksums must carry a valid signature
+// unless the updater has no public key.
+func (u *Updater) Download(ctx context.Context, release *Release, goos, goarch string) ([]byte, error) {
+	archiveName := ArchiveName(release.Tag, goos, goarch)
+	archive, ok := release.asset(archiveName)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no build for %s/%s", release.Tag, goos, goarch)
+	}
+	checksumFile, ok := release.asset(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", release.Tag, checksumsAsset)
+	}
+
+	checksums, err := u.get(ctx, checksumFile.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.PublicKey != nil {
+		signatureFile, ok := release.asset(signatureAsset)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed (no %s)", release.Tag, signatureAsset)
+		}
+		signature, err := u.get(ctx, signatureFile.URL)
+		if err != nil {
+			return nil, err
+		}
+		if !ed25519.Verify(u.PublicKey, checksums, signature) {
+			return nil, fmt.Errorf("signature of %s for release %s is invalid", checksumsAsset, release.Tag)
+		}
+	}
+
+	want, err := findChecksum(checksums, archiveName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.get(ctx, archive.URL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archiveName, want, got)
+	}
+
+	if strings.HasSuffix(archiveName, ".zip") {
+		return extractZip(data)
+	}
+	return extractTarGz(data)
+}
+
+// getJSON decodes the JSON response of a GitHub API request into v
+func (u *Updater) getJSON(ctx context.Context, url string, v interface{}) error {
+	data, err := u.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+	return nil
+}
+
+// get returns the body of a successful GET request
+func (u *Updater) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", binaryPrefix)
+	if strings.HasPrefix(url, u.APIURL) {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if u.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+u.Token)
+		}
+	}
+
+	client := u.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, maxDownloadSize)
+	}
+	return data, nil
+}
+
+// findChecksum returns the SHA-256 listed for name in sha256sum output
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		file := strings.TrimPrefix(strings.TrimPrefix(fields[1], "*"), "./")
+		if file == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", name)
+}
+
+// extractTarGz returns the binary from a release tarball
+func extractTarGz(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("archive does not contain the binary")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && strings.HasPrefix(path.Base(header.Name), binaryPrefix) {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// extractZip returns the binary from a release zip file
+func extractZip(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() || !strings.HasPrefix(path.Base(file.Name), binaryPrefix) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		defer func() { _ = rc.Close() }()
+		return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+	}
+	return nil, errors.New("archive does not contain the binary")
+}
+
+// Replace swaps the executable at path for binary, keeping its file mode. The old
+// executable is moved aside first, which also works for a running binary on Windows;
+// it is removed where the platform allows.
+func Replace(executable string, binary []byte) error {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", executable, err)
+	}
+
+	dir, name := filepath.Split(executable)
+	tmp, err := os.CreateTemp(dir, "."+name+".new-*")
+	if err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if _, err := tmp.Write(binary); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to set mode of new binary: %w", err)
+	}
+
+	old := executable + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(executable, old); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to move %s aside: %w", executable, err)
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		_ = os.Rename(old, executable)
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+	_ = os.Remove(old)
+	return nil
+}
+
+// Newer reports whether release version candidate is newer than current. Versions
+// are compared as semantic versions, with a prerelease older than its release. A
+// current version that is not a release, such as a dev build, is older than any
+// release.
+func Newer(candidate, current string) bool {
+	c, ok := parseVersion(candidate)
+	if !ok {
+		return false
+	}
+	cur, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+	for i := range c.parts {
+		if c.parts[i] != cur.parts[i] {
+			return c.parts[i] > cur.parts[i]
+		}
+	}
+	switch {
+	case c.pre == cur.pre:
+		return false
+	case c.pre == "":
+		return true
+	case cur.pre == "":
+		return false
+	default:
+		return c.pre > cur.pre
+	}
+}
+
+// version is a parsed vMAJOR.MINOR.PATCH[-PRERELEASE]
+type version struct {
+	parts [3]int
+	pre   string
+}
+
+// parseVersion parses a release tag, with or without the leading v
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	s, v.pre, _ = strings.Cut(s, "-")
+	fields := strings.Split(s, ".")
+	if len(fields) != 3 {
+		return v, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.parts[i] = n
+	}
+	return v, true
+}
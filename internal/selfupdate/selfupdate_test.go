@@ -0,0 +1,145 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarGz packs one file into a gzipped tarball
+func tarGz(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// releaseServer serves a GitHub-like API with one stable and one prerelease
+func releaseServer(t *testing.T, key ed25519.PrivateKey, tamper bool) *httptest.Server {
+	binary := []byte("new binary")
+	archiveName := ArchiveName("v1.3.0", "linux", "amd64")
+	archive := tarGz(t, "postgres-db-fork-v1.3.0-linux-amd64", binary)
+	sum := sha256.Sum256(archive)
+	checksums := []byte(fmt.Sprintf("%s  ./%s\n", hex.EncodeToString(sum[:]), archiveName))
+	signature := ed25519.Sign(key, checksums)
+	if tamper {
+		archive = append(archive, 0)
+	}
+
+	var server *httptest.Server
+	release := func(tag string, prerelease bool) Release {
+		return Release{Tag: tag, Prerelease: prerelease, Assets: []Asset{
+			{Name: archiveName, URL: server.URL + "/download/" + archiveName},
+			{Name: checksumsAsset, URL: server.URL + "/download/" + checksumsAsset},
+			{Name: signatureAsset, URL: server.URL + "/download/" + signatureAsset},
+		}}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(release("v1.3.0", false))
+	})
+	mux.HandleFunc("/repos/owner/repo/releases", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]Release{{Tag: "v1.5.0", Draft: true}, release("v1.4.0-rc.1", true), release("v1.3.0", false)})
+	})
+	mux.HandleFunc("/download/"+archiveName, func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(archive) })
+	mux.HandleFunc("/download/"+checksumsAsset, func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(checksums) })
+	mux.HandleFunc("/download/"+signatureAsset, func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(signature) })
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpdater_LatestAndDownload(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server := releaseServer(t, private, false)
+	updater := &Updater{APIURL: server.URL, Repository: "owner/repo", PublicKey: public, HTTPClient: server.Client()}
+
+	ctx := context.Background()
+	release, err := updater.Latest(ctx, ChannelStable)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.3.0", release.Tag)
+
+	edge, err := updater.Latest(ctx, ChannelEdge)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.0-rc.1", edge.Tag)
+
+	binary, err := updater.Download(ctx, release, "linux", "amd64")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new binary"), binary)
+
+	_, err = updater.Download(ctx, release, "plan9", "amd64")
+	assert.ErrorContains(t, err, "no build for plan9/amd64")
+
+	// A different key rejects the signature
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	updater.PublicKey = otherKey
+	_, err = updater.Download(ctx, release, "linux", "amd64")
+	assert.ErrorContains(t, err, "signature")
+}
+
+func TestUpdater_DownloadChecksumMismatch(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server := releaseServer(t, private, true)
+	updater := &Updater{APIURL: server.URL, Repository: "owner/repo", PublicKey: public, HTTPClient: server.Client()}
+
+	release, err := updater.Latest(context.Background(), ChannelStable)
+	require.NoError(t, err)
+	_, err = updater.Download(context.Background(), release, "linux", "amd64")
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		candidate, current string
+		newer              bool
+	}{
+		{"v1.3.0", "v1.2.9", true},
+		{"v1.3.0", "1.3.0", false},
+		{"v1.2.0", "v1.10.0", false},
+		{"v1.3.0", "v1.3.0-rc.2", true},
+		{"v1.3.0-rc.2", "v1.3.0-rc.1", true},
+		{"v1.3.0-rc.1", "v1.3.0", false},
+		{"v1.3.0", "dev", true},
+		{"latest", "v1.0.0", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.newer, Newer(tt.candidate, tt.current), "%s vs %s", tt.candidate, tt.current)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "postgres-db-fork")
+	require.NoError(t, os.WriteFile(executable, []byte("old"), 0o750))
+
+	require.NoError(t, Replace(executable, []byte("new")))
+
+	data, err := os.ReadFile(executable)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	info, err := os.Stat(executable)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+	assert.NoFileExists(t, executable+".old")
+}
@@ -0,0 +1,412 @@
+package synthetic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Column describes a table column as far as data generation needs it
+type Column struct {
+	Name string
+	// Type is the base type name from pg_type (int4, varchar, timestamptz, ...)
+	Type string
+	// Category is the pg_type category: N numeric, S string, D date/time, A array, E enum, ...
+	Category string
+	// TypeMod is the raw atttypmod, carrying varchar lengths and numeric precision
+	TypeMod  int
+	Nullable bool
+	// Default is the column default expression, if any
+	Default string
+	// Identity and Generated columns are filled by the server
+	Identity  bool
+	Generated bool
+	// EnumValues are the labels of an enum type
+	EnumValues []string
+}
+
+// serverFilled reports whether the server supplies the value, so the column is left out of inserts
+func (c Column) serverFilled() bool {
+	return c.Identity || c.Generated || strings.HasPrefix(c.Default, "nextval(")
+}
+
+// ForeignKey is a foreign key from Columns to RefColumns of the referenced table
+type ForeignKey struct {
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Hint narrows the values of a column as derived from its check constraints
+type Hint struct {
+	// Values lists the only allowed values (col IN (...) / col = ANY (ARRAY[...]))
+	Values []string
+	Min    *float64
+	Max    *float64
+}
+
+// Table describes a table to fill
+type Table struct {
+	Schema      string
+	Name        string
+	Columns     []Column
+	Uniques     [][]string
+	ForeignKeys []ForeignKey
+	Checks      []string
+	Hints       map[string]Hint
+}
+
+// QualifiedName returns schema.table
+func (t *Table) QualifiedName() string {
+	return t.Schema + "." + t.Name
+}
+
+// quoted returns the quoted schema-qualified name
+func (t *Table) quoted() string {
+	return pq.QuoteIdentifier(t.Schema) + "." + pq.QuoteIdentifier(t.Name)
+}
+
+// unique reports whether the column belongs to a unique or primary key constraint
+func (t *Table) unique(column string) bool {
+	for _, columns := range t.Uniques {
+		for _, c := range columns {
+			if c == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uniqueSet reports whether the columns on their own form a unique key
+func (t *Table) uniqueSet(columns []string) bool {
+	for _, unique := range t.Uniques {
+		if len(unique) > len(columns) {
+			continue
+		}
+		covered := true
+		for _, u := range unique {
+			found := false
+			for _, c := range columns {
+				if c == u {
+					found = true
+					break
+				}
+			}
+			if !found {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+const tablesQuery = `
+	SELECT c.oid, n.nspname, c.relname
+	FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p')
+	  AND NOT c.relispartition
+	  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+	  AND n.nspname NOT LIKE 'pg_toast%'
+	  AND n.nspname NOT LIKE 'pg_temp%'
+	ORDER BY n.nspname, c.relname`
+
+const columnsQuery = `
+	SELECT a.attrelid, a.attname,
+	       COALESCE(bt.typname, t.typname), COALESCE(bt.typcategory, t.typcategory),
+	       COALESCE(bt.oid, t.oid), t.typtype = 'e', a.atttypmod, NOT a.attnotnull,
+	       COALESCE(pg_get_expr(d.adbin, d.adrelid), ''), a.attidentity <> '', a.attgenerated <> ''
+	FROM pg_attribute a
+	JOIN pg_type t ON t.oid = a.atttypid
+	LEFT JOIN pg_type bt ON t.typtype = 'd' AND bt.oid = t.typbasetype
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+	WHERE a.attnum > 0 AND NOT a.attisdropped AND a.attrelid = ANY($1)
+	ORDER BY a.attrelid, a.attnum`
+
+const enumsQuery = `SELECT enumtypid, enumlabel FROM pg_enum ORDER BY enumtypid, enumsortorder`
+
+const uniquesQuery = `
+	SELECT i.indrelid,
+	       ARRAY(SELECT a.attname FROM unnest(i.indkey::int2[]) WITH ORDINALITY k(attnum, ord)
+	             JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum ORDER BY k.ord)
+	FROM pg_index i
+	WHERE i.indisunique AND i.indexprs IS NULL AND i.indpred IS NULL AND i.indrelid = ANY($1)`
+
+const constraintsQuery = `
+	SELECT con.conrelid, con.contype, con.confrelid, pg_get_constraintdef(con.oid),
+	       ARRAY(SELECT a.attname FROM unnest(con.conkey) WITH ORDINALITY k(attnum, ord)
+	             JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum ORDER BY k.ord),
+	       ARRAY(SELECT a.attname FROM unnest(COALESCE(con.confkey, '{}')) WITH ORDINALITY k(attnum, ord)
+	             JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum ORDER BY k.ord)
+	FROM pg_constraint con
+	WHERE con.contype IN ('f', 'c') AND con.conrelid = ANY($1)`
+
+// LoadSchema reads the user tables of the database with their columns and constraints
+func LoadSchema(ctx context.Context, db *sql.DB) ([]*Table, error) {
+	rows, err := db.QueryContext(ctx, tablesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	byOID := make(map[int64]*Table)
+	var oids []int64
+	var tables []*Table
+	for rows.Next() {
+		var oid int64
+		table := &Table{Hints: make(map[string]Hint)}
+		if err := rows.Scan(&oid, &table.Schema, &table.Name); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		byOID[oid] = table
+		oids = append(oids, oid)
+		tables = append(tables, table)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	enums, err := loadEnums(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadColumns(ctx, db, oids, byOID, enums); err != nil {
+		return nil, err
+	}
+	if err := loadUniques(ctx, db, oids, byOID); err != nil {
+		return nil, err
+	}
+	if err := loadConstraints(ctx, db, oids, byOID); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func loadEnums(ctx context.Context, db *sql.DB) (map[int64][]string, error) {
+	rows, err := db.QueryContext(ctx, enumsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enum types: %w", err)
+	}
+	enums := make(map[int64][]string)
+	for rows.Next() {
+		var oid int64
+		var label string
+		if err := rows.Scan(&oid, &label); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan enum label: %w", err)
+		}
+		enums[oid] = append(enums[oid], label)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, fmt.Errorf("failed to load enum types: %w", err)
+	}
+	return enums, nil
+}
+
+func loadColumns(ctx context.Context, db *sql.DB, oids []int64, byOID map[int64]*Table, enums map[int64][]string) error {
+	rows, err := db.QueryContext(ctx, columnsQuery, pq.Array(oids))
+	if err != nil {
+		return fmt.Errorf("failed to load columns: %w", err)
+	}
+	for rows.Next() {
+		var oid, typeOID int64
+		var isEnum bool
+		var column Column
+		if err := rows.Scan(&oid, &column.Name, &column.Type, &column.Category, &typeOID, &isEnum,
+			&column.TypeMod, &column.Nullable, &column.Default, &column.Identity, &column.Generated); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+		if isEnum {
+			column.EnumValues = enums[typeOID]
+		}
+		if table := byOID[oid]; table != nil {
+			table.Columns = append(table.Columns, column)
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return fmt.Errorf("failed to load columns: %w", err)
+	}
+	return nil
+}
+
+func loadUniques(ctx context.Context, db *sql.DB, oids []int64, byOID map[int64]*Table) error {
+	rows, err := db.QueryContext(ctx, uniquesQuery, pq.Array(oids))
+	if err != nil {
+		return fmt.Errorf("failed to load unique indexes: %w", err)
+	}
+	for rows.Next() {
+		var oid int64
+		var columns []string
+		if err := rows.Scan(&oid, pq.Array(&columns)); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan unique index: %w", err)
+		}
+		if table := byOID[oid]; table != nil {
+			table.Uniques = append(table.Uniques, columns)
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return fmt.Errorf("failed to load unique indexes: %w", err)
+	}
+	return nil
+}
+
+func loadConstraints(ctx context.Context, db *sql.DB, oids []int64, byOID map[int64]*Table) error {
+	rows, err := db.QueryContext(ctx, constraintsQuery, pq.Array(oids))
+	if err != nil {
+		return fmt.Errorf("failed to load constraints: %w", err)
+	}
+	for rows.Next() {
+		var oid, refOID int64
+		var kind, definition string
+		var columns, refColumns []string
+		if err := rows.Scan(&oid, &kind, &refOID, &definition, pq.Array(&columns), pq.Array(&refColumns)); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan constraint: %w", err)
+		}
+		table := byOID[oid]
+		if table == nil {
+			continue
+		}
+		switch kind {
+		case "f":
+			// References to tables outside the filled set (e.g. excluded schemas) are skipped
+			if ref := byOID[refOID]; ref != nil {
+				table.ForeignKeys = append(table.ForeignKeys, ForeignKey{
+					Columns:    columns,
+					RefTable:   ref.QualifiedName(),
+					RefColumns: refColumns,
+				})
+			}
+		case "c":
+			table.Checks = append(table.Checks, definition)
+			for column, hint := range parseCheck(definition) {
+				table.Hints[column] = mergeHints(table.Hints[column], hint)
+			}
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return fmt.Errorf("failed to load constraints: %w", err)
+	}
+	return nil
+}
+
+// closeRows closes the rows and reports any iteration error
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	return rows.Close()
+}
+
+var (
+	anyArrayCheck = regexp.MustCompile(`\(*"?(\w+)"?\)*(?:::[\w ]+)?\s*=\s*ANY\s*\(+ARRAY\[([^\]]*)\]`)
+	literal       = regexp.MustCompile(`'((?:[^']|'')*)'`)
+	rangeCheck    = regexp.MustCompile(`\(*"?(\w+)"?\)*(?:::[\w ]+)?\s*(>=|>|<=|<)\s*\(*'?(-?\d+(?:\.\d+)?)`)
+)
+
+// parseCheck extracts value hints from the common check constraint shapes: lists of
+// allowed values and numeric bounds. Anything else is left to retries on insert.
+func parseCheck(definition string) map[string]Hint {
+	hints := make(map[string]Hint)
+
+	for _, match := range anyArrayCheck.FindAllStringSubmatch(definition, -1) {
+		hint := hints[match[1]]
+		for _, value := range literal.FindAllStringSubmatch(match[2], -1) {
+			hint.Values = append(hint.Values, strings.ReplaceAll(value[1], "''", "'"))
+		}
+		hints[match[1]] = hint
+	}
+
+	// OR'd bounds describe alternatives rather than a range, so only AND'd ones are used
+	if strings.Contains(definition, " OR ") {
+		return hints
+	}
+	for _, match := range rangeCheck.FindAllStringSubmatch(definition, -1) {
+		bound, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			continue
+		}
+		hint := hints[match[1]]
+		switch match[2] {
+		case ">":
+			bound++
+			hint.Min = &bound
+		case ">=":
+			hint.Min = &bound
+		case "<":
+			bound--
+			hint.Max = &bound
+		case "<=":
+			hint.Max = &bound
+		}
+		hints[match[1]] = hint
+	}
+	return hints
+}
+
+// mergeHints combines hints from several check constraints on one column
+func mergeHints(a, b Hint) Hint {
+	if len(b.Values) > 0 {
+		a.Values = b.Values
+	}
+	if b.Min != nil && (a.Min == nil || *b.Min > *a.Min) {
+		a.Min = b.Min
+	}
+	if b.Max != nil && (a.Max == nil || *b.Max < *a.Max) {
+		a.Max = b.Max
+	}
+	return a
+}
+
+// Order sorts tables so referenced tables come before the tables referencing them.
+// Tables in a reference cycle keep their relative order; their references to tables
+// not yet filled are set to NULL where allowed.
+func Order(tables []*Table) []*Table {
+	byName := make(map[string]*Table, len(tables))
+	for _, table := range tables {
+		byName[table.QualifiedName()] = table
+	}
+
+	sorted := make([]*Table, 0, len(tables))
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(table *Table)
+	visit = func(table *Table) {
+		name := table.QualifiedName()
+		if state[name] != 0 {
+			return
+		}
+		state[name] = 1
+		refs := make([]string, 0, len(table.ForeignKeys))
+		for _, fk := range table.ForeignKeys {
+			refs = append(refs, fk.RefTable)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			if parent := byName[ref]; parent != nil && ref != name {
+				visit(parent)
+			}
+		}
+		state[name] = 2
+		sorted = append(sorted, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+	return sorted
+}
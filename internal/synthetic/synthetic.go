@@ -0,0 +1,321 @@
+// Package synthetic fills an empty schema with generated data, for forks where
+// production rows cannot leave their environment
+package synthetic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRows is the number of rows generated per table when no count is configured
+const DefaultRows = 100
+
+// maxAttempts bounds how often a row is regenerated after a constraint violation
+const maxAttempts = 5
+
+// maxParentKeys bounds how many referenced keys are loaded for foreign key columns
+const maxParentKeys = 10000
+
+// Options controls how much data is generated
+type Options struct {
+	// Rows is the number of rows per table
+	Rows int
+	// TableRows overrides Rows per table, keyed by "schema.table" or "table"
+	TableRows map[string]int
+	// Seed makes the generated data reproducible; zero picks a random seed
+	Seed int64
+}
+
+// rowsFor returns the row count for the table
+func (o Options) rowsFor(table *Table) int {
+	if rows, ok := o.TableRows[table.QualifiedName()]; ok {
+		return rows
+	}
+	if rows, ok := o.TableRows[table.Name]; ok {
+		return rows
+	}
+	if o.Rows > 0 {
+		return o.Rows
+	}
+	return DefaultRows
+}
+
+// Result reports what was generated for one table
+type Result struct {
+	Table    string `json:"table"`
+	Inserted int    `json:"inserted"`
+	Skipped  int    `json:"skipped"`
+	// Reason explains skipped rows, e.g. the constraint that kept failing
+	Reason string `json:"reason,omitempty"`
+}
+
+// Generate fills every user table of the database, parents before children
+func Generate(ctx context.Context, db *sql.DB, opts Options) ([]Result, error) {
+	tables, err := LoadSchema(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	gen := &valueGenerator{rnd: rand.New(rand.NewSource(seed))}
+	logrus.Debugf("Synthetic data seed: %d", seed)
+
+	filled := make(map[string]bool)
+	results := make([]Result, 0, len(tables))
+	for _, table := range Order(tables) {
+		result, err := fillTable(ctx, db, gen, table, opts.rowsFor(table), filled)
+		if err != nil {
+			return results, fmt.Errorf("failed to generate data for %s: %w", table.QualifiedName(), err)
+		}
+		filled[table.QualifiedName()] = true
+		results = append(results, result)
+		logrus.Infof("Generated %d rows for %s", result.Inserted, table.QualifiedName())
+		if result.Skipped > 0 {
+			logrus.Warnf("Skipped %d rows for %s: %s", result.Skipped, table.QualifiedName(), result.Reason)
+		}
+	}
+	return results, nil
+}
+
+// parentKeys holds the referenced key tuples for one foreign key
+type parentKeys struct {
+	fk     ForeignKey
+	keys   [][]interface{}
+	unique bool
+}
+
+// fillTable inserts the rows for one table in a transaction, using a savepoint per
+// row so a constraint violation only regenerates that row
+func fillTable(ctx context.Context, db *sql.DB, gen *valueGenerator, table *Table, rows int, filled map[string]bool) (Result, error) {
+	result := Result{Table: table.QualifiedName()}
+	if rows <= 0 {
+		return result, nil
+	}
+
+	fkColumns := make(map[string]bool)
+	var parents []parentKeys
+	for _, fk := range table.ForeignKeys {
+		for _, column := range fk.Columns {
+			fkColumns[column] = true
+		}
+		nullable := table.nullable(fk.Columns)
+		// Self references and parents still to be filled (reference cycles) get NULL
+		if fk.RefTable == table.QualifiedName() || !filled[fk.RefTable] {
+			if !nullable {
+				result.Skipped = rows
+				result.Reason = fmt.Sprintf("required reference to %s cannot be satisfied", fk.RefTable)
+				return result, nil
+			}
+			parents = append(parents, parentKeys{fk: fk})
+			continue
+		}
+
+		keys, err := loadParentKeys(ctx, db, fk)
+		if err != nil {
+			return result, err
+		}
+		if len(keys) == 0 && !nullable {
+			result.Skipped = rows
+			result.Reason = fmt.Sprintf("referenced table %s has no rows", fk.RefTable)
+			return result, nil
+		}
+		unique := table.uniqueSet(fk.Columns)
+		// One-to-one references cannot outnumber their parents
+		if unique && len(keys) < rows && !nullable {
+			result.Skipped = rows - len(keys)
+			result.Reason = fmt.Sprintf("only %d rows in %s for a one-to-one reference", len(keys), fk.RefTable)
+			rows = len(keys)
+		}
+		parents = append(parents, parentKeys{fk: fk, keys: keys, unique: unique})
+	}
+
+	var columns []Column
+	for _, column := range table.Columns {
+		if fkColumns[column.Name] {
+			columns = append(columns, column)
+			continue
+		}
+		if column.serverFilled() || (column.Default != "" && !column.generatable() && len(table.Hints[column.Name].Values) == 0) {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	statement := insertStatement(table, columns)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	seq := 0
+	for row := 0; row < rows; row++ {
+		inserted := false
+		var lastErr error
+		for attempt := 0; attempt < maxAttempts && !inserted; attempt++ {
+			values := make(map[string]interface{}, len(columns))
+			for _, column := range columns {
+				values[column.Name] = gen.value(table, column, seq)
+			}
+			for _, parent := range parents {
+				parent.assign(values, gen, row)
+			}
+			seq++
+
+			args := make([]interface{}, len(columns))
+			for i, column := range columns {
+				args[i] = values[column.Name]
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT synthetic_row"); err != nil {
+				_ = tx.Rollback()
+				return result, fmt.Errorf("failed to create savepoint: %w", err)
+			}
+			_, lastErr = tx.ExecContext(ctx, statement, args...)
+			if lastErr == nil {
+				inserted = true
+				if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT synthetic_row"); err != nil {
+					_ = tx.Rollback()
+					return result, fmt.Errorf("failed to release savepoint: %w", err)
+				}
+				break
+			}
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT synthetic_row"); err != nil {
+				_ = tx.Rollback()
+				return result, fmt.Errorf("failed to roll back row: %w", err)
+			}
+			if !isConstraintViolation(lastErr) {
+				_ = tx.Rollback()
+				return result, fmt.Errorf("insert failed: %w", lastErr)
+			}
+		}
+
+		if inserted {
+			result.Inserted++
+		} else {
+			result.Skipped++
+			result.Reason = lastErr.Error()
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit: %w", err)
+	}
+	return result, nil
+}
+
+// assign sets the foreign key columns to a referenced key, or NULL when there is none
+func (p parentKeys) assign(values map[string]interface{}, gen *valueGenerator, row int) {
+	var key []interface{}
+	switch {
+	case len(p.keys) == 0:
+	case p.unique:
+		if row < len(p.keys) {
+			key = p.keys[row]
+		}
+	default:
+		key = p.keys[gen.rnd.Intn(len(p.keys))]
+	}
+	for i, column := range p.fk.Columns {
+		if key == nil {
+			values[column] = nil
+		} else {
+			values[column] = key[i]
+		}
+	}
+}
+
+// nullable reports whether all the columns accept NULL
+func (t *Table) nullable(columns []string) bool {
+	for _, name := range columns {
+		for _, column := range t.Columns {
+			if column.Name == name && !column.Nullable {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// loadParentKeys reads the distinct referenced key tuples of the parent table
+func loadParentKeys(ctx context.Context, db *sql.DB, fk ForeignKey) ([][]interface{}, error) {
+	quoted := make([]string, len(fk.RefColumns))
+	for i, column := range fk.RefColumns {
+		quoted[i] = pq.QuoteIdentifier(column)
+	}
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s LIMIT %d",
+		strings.Join(quoted, ", "), quoteQualified(fk.RefTable),
+		strings.Join(quoted, " IS NOT NULL AND ")+" IS NOT NULL", maxParentKeys)
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keys of %s: %w", fk.RefTable, err)
+	}
+	var keys [][]interface{}
+	for rows.Next() {
+		key := make([]interface{}, len(quoted))
+		dest := make([]interface{}, len(quoted))
+		for i := range key {
+			dest[i] = &key[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan key of %s: %w", fk.RefTable, err)
+		}
+		// Text comes back as []byte, which pq would send as bytea
+		for i, value := range key {
+			if b, ok := value.([]byte); ok {
+				key[i] = string(b)
+			}
+		}
+		keys = append(keys, key)
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, fmt.Errorf("failed to load keys of %s: %w", fk.RefTable, err)
+	}
+	return keys, nil
+}
+
+// insertStatement builds the parameterised INSERT for the columns
+func insertStatement(table *Table, columns []Column) string {
+	if len(columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", table.quoted())
+	}
+	names := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = pq.QuoteIdentifier(column.Name)
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.quoted(), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+// quoteQualified quotes a schema.table name
+func quoteQualified(name string) string {
+	parts := strings.SplitN(name, ".", 2)
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// isConstraintViolation reports integrity and data errors that a different row may avoid
+func isConstraintViolation(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// Class 23 is integrity constraint violations, class 22 data exceptions such as overflow
+	class := string(pqErr.Code.Class())
+	return class == "23" || class == "22"
+}
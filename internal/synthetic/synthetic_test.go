@@ -0,0 +1,154 @@
+package synthetic
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCheck(t *testing.T) {
+	hints := parseCheck(`CHECK (((status)::text = ANY ((ARRAY['new'::character varying, 'it''s done'::character varying])::text[])))`)
+	assert.Equal(t, []string{"new", "it's done"}, hints["status"].Values)
+
+	hints = parseCheck(`CHECK (((quantity > 0) AND (quantity <= 50)))`)
+	require.NotNil(t, hints["quantity"].Min)
+	require.NotNil(t, hints["quantity"].Max)
+	assert.Equal(t, 1.0, *hints["quantity"].Min)
+	assert.Equal(t, 50.0, *hints["quantity"].Max)
+
+	hints = parseCheck(`CHECK ((price >= (0)::numeric))`)
+	require.NotNil(t, hints["price"].Min)
+	assert.Equal(t, 0.0, *hints["price"].Min)
+
+	hints = parseCheck(`CHECK (((discount < 0) OR (discount > 100)))`)
+	assert.Empty(t, hints)
+}
+
+func TestOrder(t *testing.T) {
+	users := &Table{Schema: "public", Name: "users"}
+	orders := &Table{Schema: "public", Name: "orders", ForeignKeys: []ForeignKey{
+		{Columns: []string{"user_id"}, RefTable: "public.users", RefColumns: []string{"id"}},
+	}}
+	items := &Table{Schema: "public", Name: "items", ForeignKeys: []ForeignKey{
+		{Columns: []string{"order_id"}, RefTable: "public.orders", RefColumns: []string{"id"}},
+		{Columns: []string{"parent_id"}, RefTable: "public.items", RefColumns: []string{"id"}},
+	}}
+
+	var names []string
+	for _, table := range Order([]*Table{items, orders, users}) {
+		names = append(names, table.QualifiedName())
+	}
+	assert.Equal(t, []string{"public.users", "public.orders", "public.items"}, names)
+}
+
+func TestValueGenerator(t *testing.T) {
+	gen := &valueGenerator{rnd: rand.New(rand.NewSource(1))}
+	table := &Table{
+		Schema:  "public",
+		Name:    "users",
+		Uniques: [][]string{{"id"}, {"code"}},
+		Hints:   parseCheck(`CHECK ((age >= 18) AND (age <= 30))`),
+	}
+
+	seen := make(map[interface{}]bool)
+	for seq := 0; seq < 50; seq++ {
+		code := gen.value(table, Column{Name: "code", Type: "varchar", Category: "S", TypeMod: 12}, seq)
+		require.IsType(t, "", code)
+		assert.LessOrEqual(t, len(code.(string)), 8)
+		assert.False(t, seen[code], "duplicate unique value %v", code)
+		seen[code] = true
+
+		id := gen.value(table, Column{Name: "id", Type: "int4"}, seq)
+		assert.Equal(t, int64(seq+1), id)
+
+		age := gen.value(table, Column{Name: "age", Type: "int2"}, seq).(int64)
+		assert.GreaterOrEqual(t, age, int64(18))
+		assert.LessOrEqual(t, age, int64(30))
+
+		// numeric(4,2) holds values below 100
+		amount := gen.value(table, Column{Name: "amount", Type: "numeric", TypeMod: 4<<16 | 2 + 4}, seq).(string)
+		assert.Regexp(t, `^\d{1,2}\.\d{2}$`, amount)
+	}
+
+	email := gen.value(table, Column{Name: "email", Type: "text", Category: "S"}, 7)
+	assert.Regexp(t, `^[a-z]+\.[a-z]+7@example\.com$`, email)
+
+	mood := gen.value(table, Column{Name: "mood", Type: "mood", Category: "E", EnumValues: []string{"happy", "sad"}}, 0)
+	assert.Contains(t, []interface{}{"happy", "sad"}, mood)
+
+	assert.False(t, Column{Name: "area", Type: "polygon", Category: "G"}.generatable())
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "alpha-12", truncate("alpha", "-12", 0))
+	assert.Equal(t, "alp-12", truncate("alpha", "-12", 6))
+	assert.Equal(t, "12", truncate("alpha", "-12", 2))
+}
+
+func TestFillTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+
+	table := &Table{
+		Schema: "public",
+		Name:   "orders",
+		Columns: []Column{
+			{Name: "id", Type: "int4", Default: "nextval('orders_id_seq'::regclass)"},
+			{Name: "user_id", Type: "int4"},
+			{Name: "status", Type: "text", Category: "S"},
+		},
+		ForeignKeys: []ForeignKey{{Columns: []string{"user_id"}, RefTable: "public.users", RefColumns: []string{"id"}}},
+		Hints:       map[string]Hint{"status": {Values: []string{"open"}}},
+	}
+
+	mock.ExpectQuery(`SELECT DISTINCT "id" FROM "public"."users" WHERE "id" IS NOT NULL LIMIT 10000`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectBegin()
+	insert := `INSERT INTO "public"."orders" \("user_id", "status"\) VALUES \(\$1, \$2\)`
+
+	// The first row violates a constraint once and is regenerated
+	mock.ExpectExec("SAVEPOINT synthetic_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WithArgs(42, "open").WillReturnError(&pq.Error{Code: "23514"})
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT synthetic_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec("SAVEPOINT synthetic_row").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(insert).WithArgs(42, "open").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("RELEASE SAVEPOINT synthetic_row").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+
+	gen := &valueGenerator{rnd: rand.New(rand.NewSource(1))}
+	result, err := fillTable(context.Background(), db, gen, table, 2, map[string]bool{"public.users": true})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Table: "public.orders", Inserted: 2}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFillTable_MissingParent(t *testing.T) {
+	table := &Table{
+		Schema:      "public",
+		Name:        "orders",
+		Columns:     []Column{{Name: "user_id", Type: "int4"}},
+		ForeignKeys: []ForeignKey{{Columns: []string{"user_id"}, RefTable: "public.users", RefColumns: []string{"id"}}},
+	}
+
+	gen := &valueGenerator{rnd: rand.New(rand.NewSource(1))}
+	result, err := fillTable(context.Background(), nil, gen, table, 10, map[string]bool{})
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Skipped)
+	assert.Contains(t, result.Reason, "public.users")
+}
+
+func TestOptionsRowsFor(t *testing.T) {
+	opts := Options{Rows: 20, TableRows: map[string]int{"public.orders": 5, "items": 0}}
+	assert.Equal(t, 5, opts.rowsFor(&Table{Schema: "public", Name: "orders"}))
+	assert.Equal(t, 0, opts.rowsFor(&Table{Schema: "shop", Name: "items"}))
+	assert.Equal(t, 20, opts.rowsFor(&Table{Schema: "public", Name: "users"}))
+	assert.Equal(t, DefaultRows, Options{}.rowsFor(&Table{Schema: "public", Name: "users"}))
+}
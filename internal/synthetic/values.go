@@ -0,0 +1,264 @@
+package synthetic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = []string{"Alice", "Bruno", "Chen", "Dana", "Emeka", "Farah", "Giulia", "Hiro", "Ines", "Jonas", "Kavya", "Liam", "Maya", "Nikolai", "Olivia", "Priya", "Quentin", "Rosa", "Sami", "Tariq", "Uma", "Victor", "Wen", "Yara", "Zoe"}
+	lastNames  = []string{"Anderson", "Baker", "Costa", "Dubois", "Evans", "Fischer", "Garcia", "Hansen", "Ito", "Jensen", "Kim", "Lopez", "Murphy", "Nakamura", "Okafor", "Patel", "Quinn", "Rossi", "Silva", "Tanaka", "Usman", "Varga", "Wong", "Young", "Zhang"}
+	cities     = []string{"Auckland", "Berlin", "Cape Town", "Denver", "Edinburgh", "Fukuoka", "Geneva", "Hong Kong", "Istanbul", "Jakarta", "Lagos", "Lisbon", "Melbourne", "Nairobi", "Oslo", "Porto", "Seoul", "Toronto", "Valencia", "Warsaw"}
+	countries  = []string{"Australia", "Brazil", "Canada", "Denmark", "France", "Germany", "India", "Japan", "Kenya", "Mexico", "New Zealand", "Portugal", "Singapore", "Spain", "Sweden", "United Kingdom", "United States"}
+	streets    = []string{"Acacia Avenue", "Bridge Street", "Church Road", "Elm Street", "High Street", "Harbour View", "King Street", "Mill Lane", "Park Road", "Queen Street", "Station Road", "Victoria Street"}
+	companies  = []string{"Acme", "Bluebird", "Cobalt", "Driftwood", "Evergreen", "Fjord", "Granite", "Horizon", "Ironbark", "Juniper", "Kestrel", "Lumen", "Meridian", "Northwind", "Orbit", "Pinnacle"}
+	words      = []string{"alpha", "bright", "canvas", "delta", "ember", "forest", "garden", "harbor", "island", "jasper", "kernel", "lantern", "meadow", "nimbus", "orchid", "prairie", "quartz", "river", "summit", "timber", "umber", "valley", "willow", "zenith"}
+	currencies = []string{"AUD", "CAD", "EUR", "GBP", "HKD", "JPY", "NZD", "SGD", "USD"}
+	baseTime   = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// knownTypes lists the base types with a dedicated generator
+var knownTypes = map[string]bool{
+	"int2": true, "int4": true, "int8": true, "numeric": true, "float4": true, "float8": true, "money": true,
+	"bool": true, "date": true, "timestamp": true, "timestamptz": true, "time": true, "timetz": true,
+	"interval": true, "uuid": true, "json": true, "jsonb": true, "bytea": true, "inet": true, "cidr": true,
+	"macaddr": true,
+}
+
+// generatable reports whether values can be generated for the column; other columns
+// are left to their default
+func (c Column) generatable() bool {
+	return len(c.EnumValues) > 0 || knownTypes[c.Type] || c.Category == "S" || c.Category == "A"
+}
+
+// valueGenerator produces column values. seq is unique per generated row within a
+// table, so columns in unique constraints derive their values from it.
+type valueGenerator struct {
+	rnd *rand.Rand
+}
+
+// value returns a value for the column, or nil for NULL
+func (g *valueGenerator) value(table *Table, column Column, seq int) interface{} {
+	unique := table.unique(column.Name)
+	if column.Nullable && !unique && g.rnd.Intn(10) == 0 {
+		return nil
+	}
+
+	hint := table.Hints[column.Name]
+	if len(hint.Values) > 0 {
+		if unique {
+			if seq >= len(hint.Values) {
+				return nil
+			}
+			return hint.Values[seq]
+		}
+		return hint.Values[g.rnd.Intn(len(hint.Values))]
+	}
+	if len(column.EnumValues) > 0 {
+		if unique {
+			return column.EnumValues[seq%len(column.EnumValues)]
+		}
+		return column.EnumValues[g.rnd.Intn(len(column.EnumValues))]
+	}
+
+	switch column.Type {
+	case "int2", "int4", "int8":
+		return g.integer(column, hint, unique, seq)
+	case "numeric", "float4", "float8", "money":
+		return g.decimal(column, hint, unique, seq)
+	case "bool":
+		return g.rnd.Intn(2) == 0
+	case "date":
+		return g.timestamp(unique, seq).Format("2006-01-02")
+	case "timestamp", "timestamptz":
+		return g.timestamp(unique, seq)
+	case "time", "timetz":
+		return fmt.Sprintf("%02d:%02d:%02d", g.rnd.Intn(24), g.rnd.Intn(60), g.rnd.Intn(60))
+	case "interval":
+		return fmt.Sprintf("%d minutes", g.rnd.Intn(10000)+seq)
+	case "uuid":
+		return g.uuid()
+	case "json", "jsonb":
+		return fmt.Sprintf(`{"id": %d, "tag": %q}`, seq, g.pick(words))
+	case "bytea":
+		b := make([]byte, 16)
+		g.rnd.Read(b)
+		return b
+	case "inet", "cidr":
+		return fmt.Sprintf("10.%d.%d.%d", (seq>>16)&255, (seq>>8)&255, seq&255)
+	case "macaddr":
+		return fmt.Sprintf("02:00:00:%02x:%02x:%02x", (seq>>16)&255, (seq>>8)&255, seq&255)
+	}
+
+	switch column.Category {
+	case "S":
+		return g.text(column, unique, seq)
+	case "A":
+		return "{}"
+	}
+
+	// Types without a generator are left to their default, or NULL when allowed
+	return nil
+}
+
+func (g *valueGenerator) integer(column Column, hint Hint, unique bool, seq int) int64 {
+	limit := float64(math.MaxInt32)
+	switch column.Type {
+	case "int2":
+		limit = math.MaxInt16
+	case "int8":
+		limit = math.MaxInt64
+	}
+
+	min, max := float64(1), math.Min(limit, 1000)
+	if hint.Min != nil {
+		min = math.Ceil(*hint.Min)
+		if hint.Max == nil && max < min {
+			max = min + 1000
+		}
+	}
+	if hint.Max != nil {
+		max = math.Floor(*hint.Max)
+		if hint.Min == nil && min > max {
+			min = max - 1000
+		}
+	}
+	if unique {
+		return int64(min) + int64(seq)
+	}
+	if max <= min {
+		return int64(min)
+	}
+	return int64(min) + g.rnd.Int63n(int64(max-min)+1)
+}
+
+func (g *valueGenerator) decimal(column Column, hint Hint, unique bool, seq int) string {
+	scale := 2
+	limit := 10000.0
+	// numeric(p,s) packs precision and scale into the type modifier
+	if column.Type == "numeric" && column.TypeMod >= 4 {
+		precision := ((column.TypeMod - 4) >> 16) & 0xffff
+		scale = (column.TypeMod - 4) & 0xffff
+		limit = math.Min(limit, math.Pow10(precision-scale)-1)
+	}
+
+	min, max := 0.0, limit
+	if hint.Min != nil {
+		min = *hint.Min
+	}
+	if hint.Max != nil {
+		max = math.Min(max, *hint.Max)
+	}
+	value := min + g.rnd.Float64()*(max-min)
+	if unique {
+		value = min + float64(seq)
+	}
+	return strconv.FormatFloat(value, 'f', scale, 64)
+}
+
+func (g *valueGenerator) timestamp(unique bool, seq int) time.Time {
+	if unique {
+		return baseTime.Add(time.Duration(seq) * time.Minute)
+	}
+	return baseTime.Add(time.Duration(g.rnd.Int63n(int64(2 * 365 * 24 * time.Hour))))
+}
+
+func (g *valueGenerator) uuid() string {
+	b := make([]byte, 16)
+	g.rnd.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (g *valueGenerator) pick(list []string) string {
+	return list[g.rnd.Intn(len(list))]
+}
+
+// text generates a string that reads like the column's name suggests, within its length limit
+func (g *valueGenerator) text(column Column, unique bool, seq int) string {
+	name := strings.ToLower(column.Name)
+	first, last := g.pick(firstNames), g.pick(lastNames)
+
+	var value string
+	switch {
+	case strings.Contains(name, "email"):
+		value = fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(last), seq)
+		unique = false
+	case name == "first_name" || name == "firstname" || name == "given_name":
+		value = first
+	case name == "last_name" || name == "lastname" || name == "surname" || name == "family_name":
+		value = last
+	case strings.Contains(name, "username") || name == "login" || name == "handle":
+		value = fmt.Sprintf("%s%d", strings.ToLower(first), seq)
+		unique = false
+	case strings.HasSuffix(name, "name") && (strings.Contains(name, "full") || name == "name" || strings.Contains(name, "display") || strings.Contains(name, "contact")):
+		value = first + " " + last
+	case strings.Contains(name, "phone") || strings.Contains(name, "mobile"):
+		value = fmt.Sprintf("+1-555-%03d-%04d", g.rnd.Intn(1000), seq%10000)
+	case strings.Contains(name, "city"):
+		value = g.pick(cities)
+	case strings.Contains(name, "country"):
+		value = g.pick(countries)
+	case strings.Contains(name, "address") || strings.Contains(name, "street"):
+		value = fmt.Sprintf("%d %s", g.rnd.Intn(400)+1, g.pick(streets))
+	case strings.Contains(name, "zip") || strings.Contains(name, "postal") || strings.Contains(name, "postcode"):
+		value = fmt.Sprintf("%05d", g.rnd.Intn(100000))
+	case strings.Contains(name, "company") || strings.Contains(name, "organization") || strings.Contains(name, "organisation"):
+		value = g.pick(companies) + " Ltd"
+	case strings.Contains(name, "url") || strings.Contains(name, "website"):
+		value = fmt.Sprintf("https://%s.example.com/%d", g.pick(words), seq)
+		unique = false
+	case strings.Contains(name, "slug"):
+		value = fmt.Sprintf("%s-%s-%d", g.pick(words), g.pick(words), seq)
+		unique = false
+	case strings.Contains(name, "currency"):
+		value = g.pick(currencies)
+	case strings.Contains(name, "description") || strings.Contains(name, "bio") || strings.Contains(name, "note") ||
+		strings.Contains(name, "comment") || strings.Contains(name, "body") || strings.Contains(name, "content"):
+		value = g.sentence(8)
+	case strings.Contains(name, "title") || strings.Contains(name, "subject"):
+		value = g.sentence(3)
+	default:
+		value = g.pick(words) + " " + g.pick(words)
+	}
+
+	suffix := ""
+	if unique {
+		suffix = fmt.Sprintf("-%d", seq)
+	}
+	return truncate(value, suffix, column.maxLength())
+}
+
+func (g *valueGenerator) sentence(n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = g.pick(words)
+	}
+	sentence := strings.Join(parts, " ")
+	return strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+}
+
+// maxLength returns the declared length of varchar(n)/char(n) columns, or 0
+func (c Column) maxLength() int {
+	if (c.Type == "varchar" || c.Type == "bpchar") && c.TypeMod > 4 {
+		return c.TypeMod - 4
+	}
+	return 0
+}
+
+// truncate fits value plus suffix into max characters, keeping the suffix intact
+func truncate(value, suffix string, max int) string {
+	if max <= 0 || len([]rune(value))+len(suffix) <= max {
+		return value + suffix
+	}
+	if len(suffix) >= max {
+		return suffix[len(suffix)-max:]
+	}
+	runes := []rune(value)
+	return string(runes[:max-len(suffix)]) + suffix
+}
@@ -0,0 +1,211 @@
+// Package telemetry reports anonymous feature usage of forks, only once the user
+// has turned it on. Events carry no names, hosts, queries or error messages: only
+// the engines and features used, bucketed durations and error classes.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v2"
+)
+
+// Settings is the user's telemetry choice
+type Settings struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// InstallID is a random identifier of the installation, so repeated events of one
+	// user can be told apart from many users without identifying them
+	InstallID string `yaml:"install_id,omitempty" json:"install_id,omitempty"`
+	// Noticed records that the first-run notice about telemetry was shown
+	Noticed   bool      `yaml:"noticed,omitempty" json:"-"`
+	UpdatedAt time.Time `yaml:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// Store persists Settings as a YAML file
+type Store struct {
+	Path string
+}
+
+// NewStore opens the store at path, defaulting to ~/.postgres-db-fork/telemetry.yaml
+func NewStore(path string) (*Store, error) {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, ".postgres-db-fork", "telemetry.yaml")
+	}
+	return &Store{Path: path}, nil
+}
+
+// Load returns the stored settings, which are disabled when none were saved
+func (s *Store) Load() (*Settings, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Settings{}, nil
+		}
+		return nil, fmt.Errorf("failed to read telemetry settings: %w", err)
+	}
+	var settings Settings
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse telemetry settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// Save writes settings, creating the store's directory
+func (s *Store) Save(settings *Settings) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create telemetry settings directory: %w", err)
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry settings: %w", err)
+	}
+	if err := os.WriteFile(s.Path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write telemetry settings: %w", err)
+	}
+	return nil
+}
+
+// SetEnabled turns telemetry on or off, giving the installation an identifier when
+// it is first turned on and dropping it when turned off
+func (s *Store) SetEnabled(enabled bool) (*Settings, error) {
+	settings, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	settings.Enabled = enabled
+	settings.Noticed = true
+	settings.UpdatedAt = time.Now().UTC()
+	if !enabled {
+		settings.InstallID = ""
+	} else if settings.InstallID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("failed to generate install id: %w", err)
+		}
+		settings.InstallID = hex.EncodeToString(id)
+	}
+	return settings, s.Save(settings)
+}
+
+// Disabled reports whether the environment turns telemetry off whatever the stored
+// setting: DO_NOT_TRACK, or PGFORK_TELEMETRY set to off
+func Disabled() bool {
+	if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+		return true
+	}
+	switch os.Getenv("PGFORK_TELEMETRY") {
+	case "0", "false", "off":
+		return true
+	}
+	return false
+}
+
+// Event is the anonymous usage of one fork
+type Event struct {
+	InstallID string `json:"install_id"`
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Command   string `json:"command"`
+	// Method and Engines are how the fork copied, as in the fork report
+	Method   string   `json:"method,omitempty"`
+	Engines  []string `json:"engines,omitempty"`
+	Features []string `json:"features,omitempty"`
+	// Duration is a DurationBucket
+	Duration   string `json:"duration"`
+	Success    bool   `json:"success"`
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// NewEvent returns an event of command for the installation
+func NewEvent(settings *Settings, version, command string) *Event {
+	return &Event{
+		InstallID: settings.InstallID,
+		Version:   version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Command:   command,
+	}
+}
+
+// durationBuckets are the upper bounds of the buckets durations are reported in
+var durationBuckets = []struct {
+	bound time.Duration
+	name  string
+}{
+	{10 * time.Second, "<10s"},
+	{time.Minute, "10s-1m"},
+	{10 * time.Minute, "1m-10m"},
+	{time.Hour, "10m-1h"},
+	{6 * time.Hour, "1h-6h"},
+}
+
+// DurationBucket returns the range d falls in, so events do not reveal how large
+// a database is
+func DurationBucket(d time.Duration) string {
+	for _, bucket := range durationBuckets {
+		if d < bucket.bound {
+			return bucket.name
+		}
+	}
+	return ">6h"
+}
+
+// ErrorClass returns the kind of err without its message: a PostgreSQL SQLSTATE
+// class, timeout, canceled, network or other
+func ErrorClass(err error) string {
+	var pqErr *pq.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &pqErr):
+		return "sqlstate-" + string(pqErr.Code.Class())
+	case errors.As(err, &netErr):
+		return "network"
+	default:
+		return "other"
+	}
+}
+
+// Send posts event as JSON to endpoint
+func Send(ctx context.Context, endpoint string, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
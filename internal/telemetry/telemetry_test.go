@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "telemetry.yaml"))
+	require.NoError(t, err)
+
+	settings, err := store.Load()
+	require.NoError(t, err)
+	assert.False(t, settings.Enabled, "telemetry is off until turned on")
+
+	settings, err = store.SetEnabled(true)
+	require.NoError(t, err)
+	assert.True(t, settings.Enabled)
+	assert.Len(t, settings.InstallID, 32)
+
+	loaded, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, settings.InstallID, loaded.InstallID)
+	assert.True(t, loaded.Noticed)
+
+	settings, err = store.SetEnabled(false)
+	require.NoError(t, err)
+	assert.False(t, settings.Enabled)
+	assert.Empty(t, settings.InstallID)
+}
+
+func TestDisabled(t *testing.T) {
+	t.Setenv("DO_NOT_TRACK", "")
+	t.Setenv("PGFORK_TELEMETRY", "")
+	assert.False(t, Disabled())
+
+	t.Setenv("DO_NOT_TRACK", "1")
+	assert.True(t, Disabled())
+
+	t.Setenv("DO_NOT_TRACK", "0")
+	t.Setenv("PGFORK_TELEMETRY", "off")
+	assert.True(t, Disabled())
+}
+
+func TestDurationBucket(t *testing.T) {
+	assert.Equal(t, "<10s", DurationBucket(3*time.Second))
+	assert.Equal(t, "1m-10m", DurationBucket(5*time.Minute))
+	assert.Equal(t, ">6h", DurationBucket(7*time.Hour))
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "", ErrorClass(nil))
+	assert.Equal(t, "timeout", ErrorClass(fmt.Errorf("copy: %w", context.DeadlineExceeded)))
+	assert.Equal(t, "sqlstate-42", ErrorClass(fmt.Errorf("restore: %w", &pq.Error{Code: "42P01", Message: `relation "orders" does not exist`})))
+	assert.Equal(t, "other", ErrorClass(errors.New("database app_copy already exists")))
+}
+
+func TestSend(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	event := NewEvent(&Settings{InstallID: "abc"}, "1.2.3", "fork")
+	event.Engines = []string{"copy"}
+	require.NoError(t, Send(context.Background(), server.URL, event))
+	assert.Equal(t, *event, received)
+}
@@ -0,0 +1,96 @@
+// Package pgfork exposes the fork engine to Go programs that embed it. Programs
+// depend on the Connector and Engine interfaces rather than on a server, so their
+// orchestration can be tested with the in-memory fakes in pgforktest.
+package pgfork
+
+import (
+	"context"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/db"
+	"github.com/hongkongkiwi/postgres-db-fork/internal/fork"
+)
+
+// Config describes a fork, as read by the fork command from flags, environment and
+// config files
+type Config = config.ForkConfig
+
+// DatabaseConfig describes how to reach a PostgreSQL server and database
+type DatabaseConfig = config.DatabaseConfig
+
+// Report describes how a fork ran
+type Report = fork.Report
+
+// Phase is one timed step of a fork
+type Phase = fork.Phase
+
+// Method is how the target database gets its contents
+type Method = fork.Method
+
+const (
+	// MethodTemplate clones the source with CREATE DATABASE ... TEMPLATE on the same server
+	MethodTemplate = fork.MethodTemplate
+	// MethodTransfer copies schema and data with pg_dump/pg_restore and COPY
+	MethodTransfer = fork.MethodTransfer
+)
+
+// Conn is a connection to a PostgreSQL server, with the operations programs use to
+// manage forks around the engine
+type Conn interface {
+	// DatabaseExistsContext reports whether a database exists
+	DatabaseExistsContext(ctx context.Context, name string) (bool, error)
+	// CreateDatabaseContext clones source into target on the same server, dropping an
+	// existing target first with dropIfExists
+	CreateDatabaseContext(ctx context.Context, target, source string, dropIfExists bool) error
+	// DropDatabaseContext drops a database if it exists
+	DropDatabaseContext(ctx context.Context, name string) error
+	// GetDatabaseSizeContext returns the size of a database in bytes
+	GetDatabaseSizeContext(ctx context.Context, name string) (int64, error)
+	// GetTableListContext returns the tables of a schema
+	GetTableListContext(ctx context.Context, schema string) ([]string, error)
+	// Close closes the connection
+	Close() error
+}
+
+// Connector opens connections
+type Connector interface {
+	Connect(ctx context.Context, cfg *DatabaseConfig) (Conn, error)
+}
+
+// Engine forks databases. Fork may change cfg.TargetDatabase to the name the target
+// was created under, when cfg.AutoSuffix picks a free one.
+type Engine interface {
+	Fork(ctx context.Context, cfg *Config) (*Report, error)
+}
+
+var _ Conn = (*db.Connection)(nil)
+
+// NewConnector returns a Connector for real servers
+func NewConnector() Connector {
+	return postgresConnector{}
+}
+
+type postgresConnector struct{}
+
+func (postgresConnector) Connect(ctx context.Context, cfg *DatabaseConfig) (Conn, error) {
+	conn, err := db.NewConnectionContext(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// NewEngine returns the Engine the fork command runs
+func NewEngine() Engine {
+	return forkEngine{}
+}
+
+type forkEngine struct{}
+
+// Fork runs the fork and returns its report, which describes the phases that ran
+// even when the fork fails
+func (forkEngine) Fork(ctx context.Context, cfg *Config) (*Report, error) {
+	forker := fork.NewForker(cfg)
+	err := forker.Fork(ctx)
+	return forker.Report(), err
+}
@@ -0,0 +1,312 @@
+// Package pgforktest provides in-memory fakes of the pgfork interfaces, so programs
+// embedding the fork engine can test their orchestration without a PostgreSQL
+// server.
+package pgforktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hongkongkiwi/postgres-db-fork/internal/config"
+	"github.com/hongkongkiwi/postgres-db-fork/pgfork"
+)
+
+// maxSuffixAttempts matches the number of names the engine tries with AutoSuffix
+const maxSuffixAttempts = 100
+
+// errClosed is returned by a Conn used after Close
+var errClosed = errors.New("connection is closed")
+
+// Server is an in-memory PostgreSQL server: a set of databases holding tables. It is
+// a pgfork.Connector whose connections all see the same databases, and is safe for
+// concurrent use.
+type Server struct {
+	// ConnectErr, when set, is returned by every Connect
+	ConnectErr error
+
+	mu        sync.Mutex
+	databases map[string]*database
+}
+
+type database struct {
+	size int64
+	// tables are schema.name
+	tables []string
+}
+
+// NewServer returns a server holding only the postgres maintenance database
+func NewServer() *Server {
+	return &Server{databases: map[string]*database{"postgres": {}}}
+}
+
+// AddDatabase creates or replaces a database of size bytes holding tables, which are
+// schema.name or name in the public schema
+func (s *Server) AddDatabase(name string, size int64, tables ...string) {
+	d := &database{size: size}
+	for _, table := range tables {
+		schema, table := config.SplitTableName(table)
+		d.tables = append(d.tables, schema+"."+table)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.databases[name] = d
+}
+
+// Databases returns the names of the server's databases, sorted
+func (s *Server) Databases() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.databases))
+	for name := range s.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasDatabase reports whether the server holds a database
+func (s *Server) HasDatabase(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.databases[name]
+	return ok
+}
+
+// Connect opens a connection to cfg.Database, which must exist
+func (s *Server) Connect(ctx context.Context, cfg *pgfork.DatabaseConfig) (pgfork.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.ConnectErr != nil {
+		return nil, s.ConnectErr
+	}
+	if !s.HasDatabase(cfg.Database) {
+		return nil, fmt.Errorf("database %q does not exist", cfg.Database)
+	}
+	return &Conn{server: s, database: cfg.Database}, nil
+}
+
+// clone copies source to target, replacing target when replace is set
+func (s *Server) clone(source *database, target string, replace bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.databases[target]; ok && !replace {
+		return fmt.Errorf("database %q already exists", target)
+	}
+	s.databases[target] = &database{size: source.size, tables: append([]string(nil), source.tables...)}
+	return nil
+}
+
+// lookup returns a copy of a database, or nil when it does not exist
+func (s *Server) lookup(name string) *database {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.databases[name]
+	if !ok {
+		return nil
+	}
+	return &database{size: d.size, tables: append([]string(nil), d.tables...)}
+}
+
+// Conn is a connection to one database of a Server
+type Conn struct {
+	server   *Server
+	database string
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ pgfork.Conn = (*Conn)(nil)
+
+// check fails once ctx is done or the connection is closed
+func (c *Conn) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	return nil
+}
+
+// DatabaseExistsContext reports whether the server holds a database
+func (c *Conn) DatabaseExistsContext(ctx context.Context, name string) (bool, error) {
+	if err := c.check(ctx); err != nil {
+		return false, err
+	}
+	return c.server.HasDatabase(name), nil
+}
+
+// CreateDatabaseContext clones source into target, dropping an existing target first
+// with dropIfExists
+func (c *Conn) CreateDatabaseContext(ctx context.Context, target, source string, dropIfExists bool) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	d := c.server.lookup(source)
+	if d == nil {
+		return fmt.Errorf("failed to create database %s: template database %q does not exist", target, source)
+	}
+	if err := c.server.clone(d, target, dropIfExists); err != nil {
+		return fmt.Errorf("failed to create database %s: %w", target, err)
+	}
+	return nil
+}
+
+// DropDatabaseContext drops a database if it exists. Like PostgreSQL, it refuses to
+// drop the database the connection is to.
+func (c *Conn) DropDatabaseContext(ctx context.Context, name string) error {
+	if err := c.check(ctx); err != nil {
+		return err
+	}
+	if name == c.database {
+		return fmt.Errorf("failed to drop database %s: cannot drop the currently open database", name)
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	delete(c.server.databases, name)
+	return nil
+}
+
+// GetDatabaseSizeContext returns the size the database was added with
+func (c *Conn) GetDatabaseSizeContext(ctx context.Context, name string) (int64, error) {
+	if err := c.check(ctx); err != nil {
+		return 0, err
+	}
+	d := c.server.lookup(name)
+	if d == nil {
+		return 0, fmt.Errorf("database %q does not exist", name)
+	}
+	return d.size, nil
+}
+
+// GetTableListContext returns the tables of a schema of the connected database,
+// sorted; schema defaults to public
+func (c *Conn) GetTableListContext(ctx context.Context, schema string) ([]string, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	if schema == "" {
+		schema = "public"
+	}
+	d := c.server.lookup(c.database)
+	if d == nil {
+		return nil, fmt.Errorf("database %q does not exist", c.database)
+	}
+
+	var tables []string
+	for _, table := range d.tables {
+		if tableSchema, name := config.SplitTableName(table); tableSchema == schema {
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// Close closes the connection; closing it again is a no-op
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// Fork is a fork an Engine completed
+type Fork struct {
+	Source string
+	// Target is the database created, after AutoSuffix
+	Target string
+	Method pgfork.Method
+}
+
+// Engine is a pgfork.Engine that forks between in-memory servers. A fork between
+// the same server clones with MethodTemplate and one between two servers with
+// MethodTransfer; both copy the source's tables and size. It follows the target
+// rules of the real engine: an existing target fails the fork unless DropIfExists
+// replaces it or AutoSuffix picks a free name.
+type Engine struct {
+	Source, Destination *Server
+	// Err, when set, fails every fork with it
+	Err error
+
+	mu    sync.Mutex
+	forks []Fork
+}
+
+var _ pgfork.Engine = (*Engine)(nil)
+
+// NewEngine returns an engine forking from source to destination, which may be the
+// same server
+func NewEngine(source, destination *Server) *Engine {
+	return &Engine{Source: source, Destination: destination}
+}
+
+// Fork copies cfg.Source.Database on the source server to cfg.TargetDatabase on the
+// destination. It returns a report even when the fork fails, as the real engine does.
+func (e *Engine) Fork(ctx context.Context, cfg *pgfork.Config) (*pgfork.Report, error) {
+	report := &pgfork.Report{Method: pgfork.MethodTransfer, Reason: "forked between in-memory servers"}
+	if e.Source == e.Destination {
+		report.Method = pgfork.MethodTemplate
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	if e.Err != nil {
+		return report, e.Err
+	}
+
+	source := e.Source.lookup(cfg.Source.Database)
+	if source == nil {
+		return report, fmt.Errorf("source database '%s' does not exist", cfg.Source.Database)
+	}
+
+	target, err := e.targetName(cfg)
+	if err != nil {
+		return report, err
+	}
+	if err := e.Destination.clone(source, target, cfg.DropIfExists); err != nil {
+		return report, fmt.Errorf("failed to create target database: %w", err)
+	}
+	cfg.TargetDatabase = target
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.forks = append(e.forks, Fork{Source: cfg.Source.Database, Target: target, Method: report.Method})
+	return report, nil
+}
+
+// targetName returns the name the target is created under
+func (e *Engine) targetName(cfg *pgfork.Config) (string, error) {
+	if cfg.DropIfExists || !e.Destination.HasDatabase(cfg.TargetDatabase) {
+		return cfg.TargetDatabase, nil
+	}
+	if !cfg.AutoSuffix {
+		return "", fmt.Errorf("target database '%s' already exists (use --drop-if-exists to overwrite or --auto-suffix to pick a free name)", cfg.TargetDatabase)
+	}
+	for attempt := 2; attempt <= maxSuffixAttempts; attempt++ {
+		name := fmt.Sprintf("%s_%d", cfg.TargetDatabase, attempt)
+		if !e.Destination.HasDatabase(name) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for target database '%s' after %d attempts", cfg.TargetDatabase, maxSuffixAttempts)
+}
+
+// Forks returns the forks the engine completed, in order
+func (e *Engine) Forks() []Fork {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Fork(nil), e.forks...)
+}
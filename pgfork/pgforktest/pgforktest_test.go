@@ -0,0 +1,104 @@
+package pgforktest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hongkongkiwi/postgres-db-fork/pgfork"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	server.AddDatabase("app", 1024, "orders", "billing.invoices", "customers")
+
+	conn, err := server.Connect(ctx, &pgfork.DatabaseConfig{Database: "app"})
+	require.NoError(t, err)
+
+	tables, err := conn.GetTableListContext(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"customers", "orders"}, tables)
+	tables, err = conn.GetTableListContext(ctx, "billing")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"invoices"}, tables)
+
+	require.NoError(t, conn.CreateDatabaseContext(ctx, "app_copy", "app", false))
+	assert.Error(t, conn.CreateDatabaseContext(ctx, "app_copy", "app", false))
+	require.NoError(t, conn.CreateDatabaseContext(ctx, "app_copy", "app", true))
+	size, err := conn.GetDatabaseSizeContext(ctx, "app_copy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), size)
+
+	assert.Error(t, conn.DropDatabaseContext(ctx, "app"))
+	require.NoError(t, conn.DropDatabaseContext(ctx, "app_copy"))
+	require.NoError(t, conn.DropDatabaseContext(ctx, "app_copy"))
+	assert.Equal(t, []string{"app", "postgres"}, server.Databases())
+
+	require.NoError(t, conn.Close())
+	_, err = conn.DatabaseExistsContext(ctx, "app")
+	assert.Error(t, err)
+
+	_, err = server.Connect(ctx, &pgfork.DatabaseConfig{Database: "missing"})
+	assert.Error(t, err)
+	server.ConnectErr = errors.New("connection refused")
+	_, err = server.Connect(ctx, &pgfork.DatabaseConfig{Database: "app"})
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	server.AddDatabase("app", 1024, "orders")
+	engine := NewEngine(server, server)
+
+	cfg := &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_pr_1"}
+	report, err := engine.Fork(ctx, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, pgfork.MethodTemplate, report.Method)
+	assert.True(t, server.HasDatabase("app_pr_1"))
+
+	// An existing target fails, is replaced or gets a suffix
+	_, err = engine.Fork(ctx, &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_pr_1"})
+	assert.Error(t, err)
+	_, err = engine.Fork(ctx, &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_pr_1", DropIfExists: true})
+	require.NoError(t, err)
+	cfg = &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_pr_1", AutoSuffix: true}
+	_, err = engine.Fork(ctx, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "app_pr_1_2", cfg.TargetDatabase)
+
+	assert.Equal(t, []Fork{
+		{Source: "app", Target: "app_pr_1", Method: pgfork.MethodTemplate},
+		{Source: "app", Target: "app_pr_1", Method: pgfork.MethodTemplate},
+		{Source: "app", Target: "app_pr_1_2", Method: pgfork.MethodTemplate},
+	}, engine.Forks())
+
+	_, err = engine.Fork(ctx, &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "missing"}, TargetDatabase: "x"})
+	assert.Error(t, err)
+	engine.Err = errors.New("disk full")
+	report, err = engine.Fork(ctx, &pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_pr_2"})
+	assert.EqualError(t, err, "disk full")
+	assert.NotNil(t, report)
+	assert.False(t, server.HasDatabase("app_pr_2"))
+}
+
+func TestEngineCrossServer(t *testing.T) {
+	source, destination := NewServer(), NewServer()
+	source.AddDatabase("app", 2048, "orders")
+
+	report, err := NewEngine(source, destination).Fork(context.Background(),
+		&pgfork.Config{Source: pgfork.DatabaseConfig{Database: "app"}, TargetDatabase: "app_copy"})
+	require.NoError(t, err)
+	assert.Equal(t, pgfork.MethodTransfer, report.Method)
+	assert.False(t, source.HasDatabase("app_copy"))
+
+	conn, err := destination.Connect(context.Background(), &pgfork.DatabaseConfig{Database: "app_copy"})
+	require.NoError(t, err)
+	tables, err := conn.GetTableListContext(context.Background(), "public")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, tables)
+}